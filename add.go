@@ -0,0 +1,240 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// Content added through the cluster is streamed to the IPFS daemon of the
+// peer receiving the request, which chunks it, builds the DAG and pins
+// its roots, so that garbage collection does not remove the blocks. The
+// roots are then pinned in the cluster and their blocks are sent to the
+// allocated peers (see dag_transfer.go). Once these report the content as
+// pinned, the temporary pins are removed, unless this peer is among the
+// allocations. Temporary pins are persisted, so that those left when the
+// peer shuts down are released after it restarts. With the Shard
+// parameter, the content is sharded while it is added instead (see
+// sharding.go), so that no single peer needs to hold it entirely.
+
+// addCheckInterval is how often the status of added content is checked
+// before removing its temporary pins.
+var addCheckInterval = 5 * time.Second
+
+// Add imports the files in a multipart body, as accepted by "ipfs add",
+// and pins the roots of the imported content with the options of the
+// given pin, whose Cid is ignored. Unless it is set, pins are named after
+// the root they pin, and the import options are recorded in their
+// metadata (see AddParams.Metadata). It returns all the imported items.
+func (c *Cluster) Add(params api.AddParams, pin api.Pin, contentType string, body io.Reader) ([]api.AddedOutput, error) {
+	return c.add(c.ctx, "", api.AddRequest{
+		Params:      params,
+		Pin:         pin.ToSerial(),
+		ContentType: contentType,
+		Body:        body,
+	})
+}
+
+// add performs Add on behalf of the given origin.
+func (c *Cluster) add(ctx context.Context, origin api.Origin, req api.AddRequest) ([]api.AddedOutput, error) {
+	adder, ok := c.ipfs.(ContentAdder)
+	if !ok {
+		return nil, errors.New("the IPFS connector cannot add content")
+	}
+	if err := req.Params.Validate(); err != nil {
+		return nil, err
+	}
+
+	if req.Body == nil {
+		return nil, errors.New("nothing to add")
+	}
+	if req.Params.Shard {
+		return c.addSharded(ctx, origin, req)
+	}
+
+	added, err := adder.Add(ctx, req.Params, req.ContentType, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	addedRoots := api.AddedRoots(added, req.Params.WrapWithDirectory)
+	roots := make([]*cid.Cid, 0, len(addedRoots)) // temporarily pinned
+	for _, root := range addedRoots {
+		rootCid, err := cid.Decode(root.Cid)
+		if err != nil {
+			return added, err
+		}
+		roots = append(roots, rootCid)
+	}
+	if err := c.tempPins.add(roots); err != nil {
+		logger.Errorf("error persisting temporary pins: %s", err)
+	}
+	defer func() {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.releaseAddedRoots(roots)
+		}()
+	}()
+
+	for i, root := range addedRoots {
+		rootCid := roots[i]
+		pin := c.addedPin(req, root.Name)
+		pin.Cid = rootCid
+		if err := pin.Validate(); err != nil {
+			return added, err
+		}
+		if _, err := c.pinWithResult(origin, pin); err != nil {
+			return added, err
+		}
+		c.pushAdded(ctx, rootCid)
+	}
+	return added, nil
+}
+
+// addedPin returns the pin of an added root with the given name, without
+// its Cid: a recursive pin with the options of the request, named after
+// the root unless a name is given, and with the import options in its
+// metadata.
+func (c *Cluster) addedPin(req api.AddRequest, name string) api.Pin {
+	pin := req.Pin.ToPin()
+	pin.Recursive = true
+	if pin.Name == "" {
+		pin.Name = name
+	}
+	// record how the content was imported
+	metadata := req.Params.Metadata()
+	for k, v := range pin.Metadata {
+		if _, ok := metadata[k]; !ok {
+			metadata[k] = v
+		}
+	}
+	pin.Metadata = metadata
+	return pin
+}
+
+// releaseTemporaryPins releases the temporary pins left when the peer
+// last shut down. The shared state must be up to date, so that they are
+// not released before their allocations pin them.
+func (c *Cluster) releaseTemporaryPins() {
+	select {
+	case <-c.readyCh:
+	default:
+		return // not ready: shutting down
+	}
+	if roots := c.tempPins.list(); len(roots) > 0 {
+		logger.Infof("releasing %d temporary pins of added items", len(roots))
+		c.releaseAddedRoots(roots)
+	}
+}
+
+// releaseAddedRoots removes the temporary pins of the given roots once
+// they are pinned by their allocations, or as soon as they are not part
+// of the shared state. Temporary pins left when the peer shuts down are
+// released after it restarts.
+func (c *Cluster) releaseAddedRoots(roots []*cid.Cid) {
+	ticker := time.NewTicker(addCheckInterval)
+	defer ticker.Stop()
+	for {
+		var pending []*cid.Cid
+		for _, root := range roots {
+			if !c.addedRootPinned(root) {
+				pending = append(pending, root)
+				continue
+			}
+			if err := c.releaseAddedRoot(root); err != nil {
+				logger.Errorf("error removing the temporary pin of %s: %s", root, err)
+				continue // retried after a restart
+			}
+			if err := c.tempPins.remove(root); err != nil {
+				logger.Errorf("error forgetting the temporary pin of %s: %s", root, err)
+			}
+		}
+		roots = pending
+		if len(roots) == 0 {
+			return
+		}
+
+		select {
+		case <-c.ctx.Done():
+			logger.Warningf("shutting down: %d added items keep their temporary pins until restarted", len(roots))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// addedRootPinned returns whether the peers allocated to an added root
+// report it as pinned. For sharded roots, all the shards must be pinned.
+// Roots which are not in the shared state are considered pinned.
+func (c *Cluster) addedRootPinned(root *cid.Cid) bool {
+	curr, ok := c.getCurrentPin(root)
+	if !ok {
+		return true
+	}
+	targets, err := c.addedTargets(curr)
+	if err != nil {
+		logger.Warning(err)
+		return false
+	}
+	if len(targets) == 0 {
+		return true
+	}
+
+	allocations := make(map[string][]peer.ID, len(targets))
+	cids := make([]*cid.Cid, 0, len(targets))
+	for _, t := range targets {
+		allocations[t.Cid.String()] = t.Allocations
+		cids = append(cids, t.Cid)
+	}
+	gpis, err := c.StatusCids(cids)
+	if err != nil {
+		logger.Warning(err)
+		return false
+	}
+	pinned := 0
+	for _, gpi := range gpis {
+		if gpi.Cid == nil {
+			continue
+		}
+		allocs, ok := allocations[gpi.Cid.String()]
+		if !ok || !pinnedBy(gpi, allocs) {
+			return false
+		}
+		pinned++
+	}
+	return pinned == len(targets)
+}
+
+// addedTargets returns the pins holding the blocks of an added root: its
+// own pin or, when it is sharded, the pins of its shards.
+func (c *Cluster) addedTargets(pin api.Pin) ([]api.Pin, error) {
+	if pin.Type == api.MetaType {
+		return c.shardsOf(pin.Cid)
+	}
+	return []api.Pin{pin}, nil
+}
+
+// releaseAddedRoot removes the temporary pin of an added root. When this
+// peer is allocated to it, the pin of the cluster is restored instead,
+// unless it is the same recursive pin.
+func (c *Cluster) releaseAddedRoot(root *cid.Cid) error {
+	curr, ok := c.getCurrentPin(root)
+	allocatedHere := ok && (containsPeer(curr.Allocations, c.id) || curr.ReplicationFactorMin == -1)
+	if allocatedHere && curr.Recursive && curr.MaxDepth == 0 && curr.Type != api.MetaType {
+		return nil
+	}
+	if err := c.ipfs.Unpin(c.ctx, root); err != nil {
+		return err
+	}
+	if allocatedHere {
+		return c.ipfsPin(c.ctx, curr)
+	}
+	return nil
+}
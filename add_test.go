@@ -0,0 +1,81 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestClusterAdd(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "report.txt")
+	fw.Write([]byte("hello"))
+	mw.Close()
+
+	pin := api.Pin{ReplicationFactorMin: -1, ReplicationFactorMax: -1}
+	added, err := cl.Add(api.AddParams{RawLeaves: true}, pin, mw.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal("add should have worked:", err)
+	}
+	if len(added) != 1 || added[0].Cid != test.TestCid3 {
+		t.Fatal("unexpected added items:", added)
+	}
+
+	c, _ := cid.Decode(test.TestCid3)
+	pin, err = cl.PinGet(c)
+	if err != nil {
+		t.Fatal("the added content should be pinned:", err)
+	}
+	if pin.Name != "report.txt" || !pin.Recursive {
+		t.Error("unexpected pin:", pin)
+	}
+	if pin.Metadata["add.raw_leaves"] != "true" || pin.Metadata["add.hash"] != api.DefaultAddHash {
+		t.Error("the import options should be recorded:", pin.Metadata)
+	}
+
+	_, err = cl.Add(api.AddParams{}, api.Pin{}, mw.FormDataContentType(), nil)
+	if err == nil {
+		t.Error("expected an error adding nothing")
+	}
+
+	_, err = cl.Add(api.AddParams{Hash: "md5"}, api.Pin{}, mw.FormDataContentType(), body)
+	if err == nil {
+		t.Error("expected an error with an unsupported hash")
+	}
+}
+
+func TestClusterReleaseAddedRoots(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	// roots which are not in the shared state are released right away
+	c, _ := cid.Decode(test.TestCid1)
+	if !cl.addedRootPinned(c) {
+		t.Error("a root which is not pinned in the cluster should be released")
+	}
+	cl.tempPins.add([]*cid.Cid{c})
+	cl.releaseAddedRoots([]*cid.Cid{c})
+	if roots := cl.tempPins.list(); len(roots) != 0 {
+		t.Error("released roots should be forgotten:", roots)
+	}
+
+	// roots allocated everywhere keep their pin
+	err := cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	if err := cl.releaseAddedRoot(c); err != nil {
+		t.Error("releasing a root pinned here should work:", err)
+	}
+}
@@ -3,11 +3,14 @@ package ipfscluster
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
 )
 
 // This file gathers allocation logic used when pinning or re-pinning
@@ -23,6 +26,9 @@ import (
 // * Divide the metrics between "current" (peers already pinning the CID)
 //   and "candidates" (peers that could pin the CID), as long as their metrics
 //   are valid.
+// * Run the candidates through a chain of filters (cordoned peers, peers
+//   at their pin limit, peers with old metrics), logging why a peer was
+//   excluded.
 // * Given the candidates:
 //   * Check if we are overpinning an item
 //   * Check if there are not enough candidates for the "needed" replication
@@ -34,7 +40,12 @@ import (
 //       order of preference.
 //     * Take as many final candidates from the list as we can, until
 //       ReplicationFactorMax is reached. Error if there are less than
-//       ReplicationFactorMin.
+//       ReplicationFactorMin, unless the UnderReplicationPolicy accepts
+//       under-replicated pins and there is at least one peer.
+
+// pinCapacityMetricName is the name of the metric used by peers with
+// a pin limit to broadcast how many more items they can pin.
+const pinCapacityMetricName = "pin_capacity"
 
 // allocate finds peers to allocate a hash using the informer and the monitor
 // it should only be used with valid replicationFactors (rplMin and rplMax
@@ -43,8 +54,10 @@ import (
 // it will return the current ones. Note that allocate() does not take
 // into account if the given CID was previously in a "pin everywhere" mode,
 // and will consider such Pins as currently unallocated ones, providing
-// new allocations as available.
-func (c *Cluster) allocate(hash *cid.Cid, rplMin, rplMax int, blacklist []peer.ID, prioritylist []peer.ID) ([]peer.ID, error) {
+// new allocations as available. When the allowlist is not empty, only the
+// peers in it are allocated, and current allocations outside of it are
+// dropped.
+func (c *Cluster) allocate(hash *cid.Cid, rplMin, rplMax int, blacklist, allowlist, prioritylist []peer.ID) ([]peer.ID, error) {
 	// Figure out who is holding the CID
 	currentPin, _ := c.getCurrentPin(hash)
 	currentAllocs := currentPin.Allocations
@@ -52,24 +65,39 @@ func (c *Cluster) allocate(hash *cid.Cid, rplMin, rplMax int, blacklist []peer.I
 	if err != nil {
 		return nil, err
 	}
+	filters := c.candidateFilters()
 
 	currentMetrics := make(map[peer.ID]api.Metric)
 	candidatesMetrics := make(map[peer.ID]api.Metric)
 	priorityMetrics := make(map[peer.ID]api.Metric)
+	// why peers with metrics are not candidates
+	excluded := make(map[peer.ID]string)
 
 	// Divide metrics between current and candidates.
 	// All metrics in metrics are valid (at least the
 	// moment they were compiled by the monitor)
 	for _, m := range metrics {
-		switch {
-		case containsPeer(blacklist, m.Peer):
+		if containsPeer(blacklist, m.Peer) {
 			// discard blacklisted peers
+			excluded[m.Peer] = "peer is blacklisted for this allocation"
+			continue
+		}
+		if len(allowlist) > 0 && !containsPeer(allowlist, m.Peer) {
+			// discard peers which are not allowed
+			excluded[m.Peer] = "peer is not in the allowlist"
 			continue
-		case containsPeer(currentAllocs, m.Peer):
+		}
+		if containsPeer(currentAllocs, m.Peer) {
 			currentMetrics[m.Peer] = m
-		case containsPeer(prioritylist, m.Peer):
+			continue
+		}
+		if reason := filters.excludeReason(m); reason != "" {
+			excluded[m.Peer] = reason
+			continue
+		}
+		if containsPeer(prioritylist, m.Peer) {
 			priorityMetrics[m.Peer] = m
-		default:
+		} else {
 			candidatesMetrics[m.Peer] = m
 		}
 	}
@@ -81,6 +109,7 @@ func (c *Cluster) allocate(hash *cid.Cid, rplMin, rplMax int, blacklist []peer.I
 		currentMetrics,
 		candidatesMetrics,
 		priorityMetrics,
+		excluded,
 	)
 	if err != nil {
 		return newAllocs, err
@@ -103,10 +132,10 @@ func (c *Cluster) getCurrentPin(h *cid.Cid) (api.Pin, bool) {
 }
 
 // getInformerMetrics returns the MonitorLastMetrics() for the
-// configured informer.
+// first configured informer, or for the AllocationMetric when set.
 func (c *Cluster) getInformerMetrics() ([]api.Metric, error) {
 	var metrics []api.Metric
-	metricName := c.informer.Name()
+	metricName := c.allocationMetricName()
 	l, err := c.consensus.Leader()
 	if err != nil {
 		return nil, errors.New("cannot determine leading Monitor")
@@ -122,28 +151,192 @@ func (c *Cluster) getInformerMetrics() ([]api.Metric, error) {
 	return metrics, nil
 }
 
-// allocationError logs an allocation error
-func allocationError(hash *cid.Cid, needed, wanted int, candidatesValid []peer.ID) error {
+// getFullPeers returns the peers which have broadcasted that they
+// cannot pin any more items.
+func (c *Cluster) getFullPeers() []peer.ID {
+	var metrics []api.Metric
+	l, err := c.consensus.Leader()
+	if err != nil {
+		return nil
+	}
+
+	err = c.rpcClient.Call(l,
+		"Cluster", "PeerMonitorLastMetrics",
+		pinCapacityMetricName,
+		&metrics)
+	if err != nil {
+		logger.Warning(err)
+		return nil
+	}
+
+	var full []peer.ID
+	for _, m := range metrics {
+		capacity, err := strconv.Atoi(m.Value)
+		if err == nil && capacity <= 0 {
+			full = append(full, m.Peer)
+		}
+	}
+	return full
+}
+
+// getPeerTags returns the tags broadcasted by the peers.
+func (c *Cluster) getPeerTags() map[peer.ID]map[string]string {
+	var metrics []api.Metric
+	l, err := c.consensus.Leader()
+	if err != nil {
+		return nil
+	}
+
+	err = c.rpcClient.Call(l,
+		"Cluster", "PeerMonitorLastMetrics",
+		tags.MetricName,
+		&metrics)
+	if err != nil {
+		logger.Warning(err)
+		return nil
+	}
+
+	peerTags := make(map[peer.ID]map[string]string)
+	for _, m := range metrics {
+		if m.Discard() {
+			continue
+		}
+		peerTags[m.Peer] = tags.ParseTags(m.Value)
+	}
+	return peerTags
+}
+
+// getMetricsByName returns the last valid metrics of the given names,
+// indexed by name and peer. Metrics which cannot be obtained are
+// missing.
+func (c *Cluster) getMetricsByName(names []string) map[string]map[peer.ID]api.Metric {
+	byName := make(map[string]map[peer.ID]api.Metric)
+	l, err := c.consensus.Leader()
+	if err != nil {
+		return byName
+	}
+
+	for _, name := range names {
+		var metrics []api.Metric
+		err = c.rpcClient.Call(l,
+			"Cluster", "PeerMonitorLastMetrics",
+			name,
+			&metrics)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+
+		byPeer := make(map[peer.ID]api.Metric)
+		for _, m := range metrics {
+			if !m.Discard() {
+				byPeer[m.Peer] = m
+			}
+		}
+		byName[name] = byPeer
+	}
+	return byName
+}
+
+// allocationError logs an allocation error and returns an
+// api.AllocationError listing every cluster peer. The peers which are not
+// usable and were not excluded for a known reason are those without a
+// valid metric.
+func (c *Cluster) allocationError(hash *cid.Cid, needed, wanted int, usable []peer.ID, excluded map[peer.ID]string) error {
+	aerr := &api.AllocationError{
+		Cid:    hash.String(),
+		Needed: needed,
+		Wanted: wanted,
+	}
+
+	peers, err := c.consensus.Peers()
+	if err != nil {
+		peers = usable
+	}
+	var latest map[peer.ID]api.Metric
+	metricName := c.allocationMetricName()
+	for _, p := range peers {
+		candidate := api.AllocationCandidate{Peer: peer.IDB58Encode(p)}
+		switch reason, ok := excluded[p]; {
+		case containsPeer(usable, p):
+			candidate.Usable = true
+		case ok:
+			candidate.Reason = reason
+		default:
+			if latest == nil {
+				latest = c.latestMetrics(metricName)
+			}
+			candidate.Reason = missingMetricReason(metricName, latest[p])
+		}
+		aerr.Candidates = append(aerr.Candidates, candidate)
+	}
+
 	logger.Errorf("Not enough candidates to allocate %s:", hash)
 	logger.Errorf("  Needed: %d", needed)
 	logger.Errorf("  Wanted: %d", wanted)
-	logger.Errorf("  Valid candidates: %d:", len(candidatesValid))
-	for _, c := range candidatesValid {
-		logger.Errorf("    - %s", c.Pretty())
-	}
-	errorMsg := "not enough peers to allocate CID. "
-	errorMsg += fmt.Sprintf("Needed at least: %d. ", needed)
-	errorMsg += fmt.Sprintf("Wanted at most: %d. ", wanted)
-	errorMsg += fmt.Sprintf("Valid candidates: %d. ", len(candidatesValid))
-	errorMsg += "See logs for more info."
-	return errors.New(errorMsg)
+	logger.Errorf("  Valid candidates: %d:", len(usable))
+	for _, candidate := range aerr.Candidates {
+		if candidate.Usable {
+			logger.Errorf("    - %s", candidate.Peer)
+		} else {
+			logger.Errorf("    - %s (unusable: %s)", candidate.Peer, candidate.Reason)
+		}
+	}
+	return aerr
+}
+
+// allocationMetricName returns the name of the metric used to allocate.
+func (c *Cluster) allocationMetricName() string {
+	if c.config.AllocationMetric != "" {
+		return c.config.AllocationMetric
+	}
+	return c.informers[0].Name()
+}
+
+// latestMetrics returns the latest metric of the given name from every
+// peer, as seen by the leading monitor, even if invalid or expired.
+func (c *Cluster) latestMetrics(name string) map[peer.ID]api.Metric {
+	var metrics []api.Metric
+	l, err := c.consensus.Leader()
+	if err == nil {
+		err = c.rpcClient.Call(l,
+			"Cluster", "PeerMonitorLatestMetrics",
+			name,
+			&metrics)
+	}
+	if err != nil {
+		logger.Warningf("error getting the latest %s metrics: %s", name, err)
+	}
+
+	byPeer := make(map[peer.ID]api.Metric, len(metrics))
+	for _, m := range metrics {
+		byPeer[m.Peer] = m
+	}
+	return byPeer
+}
+
+// missingMetricReason explains why the given latest metric of a peer is
+// not usable. It is empty when the peer has sent none.
+func missingMetricReason(name string, last api.Metric) string {
+	switch {
+	case last.Name == "":
+		return fmt.Sprintf("no %s metric", name)
+	case !last.Valid:
+		return fmt.Sprintf("%s metric is invalid", name)
+	case last.Expired():
+		ago := time.Since(time.Unix(0, last.Expire))
+		return fmt.Sprintf("%s metric expired %d seconds ago", name, int(ago.Seconds()))
+	default:
+		return fmt.Sprintf("%s metric is not available from the leading monitor", name)
+	}
 }
 
 func (c *Cluster) obtainAllocations(
 	hash *cid.Cid,
 	rplMin, rplMax int,
 	currentValidMetrics, candidatesMetrics map[peer.ID]api.Metric,
-	priorityMetrics map[peer.ID]api.Metric) ([]peer.ID, error) {
+	priorityMetrics map[peer.ID]api.Metric,
+	excluded map[peer.ID]string) ([]peer.ID, error) {
 
 	// The list of peers in current
 	validAllocations := make([]peer.ID, 0, len(currentValidMetrics))
@@ -175,23 +368,51 @@ func (c *Cluster) obtainAllocations(
 		return nil, nil
 	}
 
+	// With the "accept" under-replication policy, we allocate as many
+	// peers as we can, as long as there is at least one.
+	acceptUnder := c.config.UnderReplicationPolicy == UnderReplicationAccept
+
 	if nCandidatesValid < needed { // not enough candidates
-		candidatesValid := []peer.ID{}
-		for k := range priorityMetrics {
-			candidatesValid = append(candidatesValid, k)
+		if !acceptUnder || nCurrentValid+nCandidatesValid == 0 {
+			usable := append([]peer.ID{}, validAllocations...)
+			for k := range priorityMetrics {
+				usable = append(usable, k)
+			}
+			for k := range candidatesMetrics {
+				usable = append(usable, k)
+			}
+			return nil, c.allocationError(hash, needed, wanted, usable, excluded)
 		}
-		for k := range candidatesMetrics {
-			candidatesValid = append(candidatesValid, k)
+
+		if c.toppingUp(hash) { // already reported
+			logger.Debugf("%s will be under-replicated: %d peers available and %d needed",
+				hash, nCurrentValid+nCandidatesValid, rplMin)
+		} else {
+			logger.Warningf("%s will be under-replicated: %d peers available and %d needed",
+				hash, nCurrentValid+nCandidatesValid, rplMin)
+		}
+		if nCandidatesValid == 0 {
+			return validAllocations, nil
 		}
-		return nil, allocationError(hash, needed, wanted, candidatesValid)
 	}
 
 	// We can allocate from this point. Use the allocator to decide
 	// on the priority of candidates grab as many as "wanted"
 
 	// the allocator returns a list of peers ordered by priority
-	finalAllocs, err := c.allocator.Allocate(
-		hash, currentValidMetrics, candidatesMetrics, priorityMetrics)
+	var finalAllocs []peer.ID
+	var err error
+	if tagAlloc, ok := c.allocator.(TagAllocator); ok {
+		finalAllocs, err = tagAlloc.AllocateWithTags(
+			hash, currentValidMetrics, candidatesMetrics, priorityMetrics, c.getPeerTags())
+	} else if multiAlloc, ok := c.allocator.(MultiMetricAllocator); ok {
+		finalAllocs, err = multiAlloc.AllocateWithMetrics(
+			hash, currentValidMetrics, candidatesMetrics, priorityMetrics,
+			c.getMetricsByName(multiAlloc.MetricNames()))
+	} else {
+		finalAllocs, err = c.allocator.Allocate(
+			hash, currentValidMetrics, candidatesMetrics, priorityMetrics)
+	}
 	if err != nil {
 		return nil, logError(err.Error())
 	}
@@ -200,8 +421,20 @@ func (c *Cluster) obtainAllocations(
 
 	// check that we have enough as the allocator may have returned
 	// less candidates than provided.
-	if got := len(finalAllocs); got < needed {
-		return nil, allocationError(hash, needed, wanted, finalAllocs)
+	if got := len(finalAllocs); got < needed && !(acceptUnder && nCurrentValid+got > 0) {
+		usable := append(append([]peer.ID{}, validAllocations...), finalAllocs...)
+		rejected := make(map[peer.ID]string)
+		for k, v := range excluded {
+			rejected[k] = v
+		}
+		for _, metrics := range []map[peer.ID]api.Metric{priorityMetrics, candidatesMetrics} {
+			for k, m := range metrics {
+				if !containsPeer(finalAllocs, k) {
+					rejected[k] = allocatorRejectReason(m)
+				}
+			}
+		}
+		return nil, c.allocationError(hash, needed, wanted, usable, rejected)
 	}
 
 	allocationsToUse := minInt(wanted, len(finalAllocs))
@@ -210,3 +443,12 @@ func (c *Cluster) obtainAllocations(
 	// along with the ones provided by the allocator
 	return append(validAllocations, finalAllocs[0:allocationsToUse]...), nil
 }
+
+// allocatorRejectReason explains why the allocator did not return a
+// candidate.
+func allocatorRejectReason(m api.Metric) string {
+	if v, err := strconv.ParseFloat(m.Value, 64); err == nil && v <= 0 {
+		return fmt.Sprintf("%s is %s", m.Name, m.Value)
+	}
+	return "rejected by the allocator"
+}
@@ -0,0 +1,148 @@
+package ipfscluster
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// A candidateFilter decides whether a peer, represented by its last
+// informer metric, can be given new allocations. Filters only apply to
+// candidates: peers already holding an item are not affected.
+type candidateFilter interface {
+	// Name identifies the filter in the logs.
+	Name() string
+	// Exclude returns true and a reason when the peer should not
+	// be a candidate.
+	Exclude(m api.Metric) (bool, string)
+}
+
+// candidateFilters is a chain of filters. A peer is excluded as soon
+// as one of the filters excludes it.
+type candidateFilters []candidateFilter
+
+// exclude runs the chain and logs which filter excluded the
+// peer and why.
+func (fs candidateFilters) exclude(m api.Metric) bool {
+	return fs.excludeReason(m) != ""
+}
+
+// excludeReason works like exclude but it returns why the peer was
+// excluded, or an empty string when it was not.
+func (fs candidateFilters) excludeReason(m api.Metric) string {
+	for _, f := range fs {
+		if excluded, reason := f.Exclude(m); excluded {
+			logger.Infof("allocation: %s excluded by %s filter: %s", m.Peer.Pretty(), f.Name(), reason)
+			return reason
+		}
+	}
+	return ""
+}
+
+// candidateFilters returns the chain of filters used for
+// new allocations.
+func (c *Cluster) candidateFilters() candidateFilters {
+	filters := candidateFilters{
+		&peerListFilter{
+			name:   "cordon",
+			reason: "peer is cordoned",
+			peers:  c.config.CordonedPeers,
+		},
+		&peerListFilter{
+			name:   "draining",
+			reason: "peer is leaving the cluster",
+			peers:  c.drainingPeers(),
+		},
+		&peerListFilter{
+			name:   "pin limit",
+			reason: "peer has reached its pin limit",
+			peers:  c.getFullPeers(),
+		},
+		&metricAgeFilter{
+			maxAge: c.config.AllocationMetricMaxAge,
+		},
+	}
+	// the peer tags are only fetched when needed
+	if len(c.config.AllocationTags) > 0 {
+		filters = append(filters, &tagFilter{
+			tags:     c.config.AllocationTags,
+			peerTags: c.getPeerTags(),
+		})
+	}
+	return filters
+}
+
+// peerListFilter excludes the peers in a list.
+type peerListFilter struct {
+	name   string
+	reason string
+	peers  []peer.ID
+}
+
+func (f *peerListFilter) Name() string {
+	return f.name
+}
+
+func (f *peerListFilter) Exclude(m api.Metric) (bool, string) {
+	if containsPeer(f.peers, m.Peer) {
+		return true, f.reason
+	}
+	return false, ""
+}
+
+// metricAgeFilter excludes peers whose metric was received
+// too long ago. A maxAge of 0 disables it.
+type metricAgeFilter struct {
+	maxAge time.Duration
+}
+
+func (f *metricAgeFilter) Name() string {
+	return "metric age"
+}
+
+func (f *metricAgeFilter) Exclude(m api.Metric) (bool, string) {
+	if f.maxAge <= 0 || m.Received == 0 {
+		return false, ""
+	}
+
+	age := time.Since(time.Unix(0, m.Received))
+	if age > f.maxAge {
+		return true, fmt.Sprintf("last metric is %s old", age)
+	}
+	return false, ""
+}
+
+// tagFilter excludes peers which do not have all the given tags, as
+// broadcasted by their tags informer.
+type tagFilter struct {
+	tags     map[string]string
+	peerTags map[peer.ID]map[string]string
+}
+
+func (f *tagFilter) Name() string {
+	return "tags"
+}
+
+func (f *tagFilter) Exclude(m api.Metric) (bool, string) {
+	keys := make([]string, 0, len(f.tags))
+	for k := range f.tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	peerTags := f.peerTags[m.Peer]
+	for _, k := range keys {
+		v, ok := peerTags[k]
+		if !ok {
+			return true, fmt.Sprintf("peer has no %s tag", k)
+		}
+		if v != f.tags[k] {
+			return true, fmt.Sprintf("peer %s tag is %q instead of %q", k, v, f.tags[k])
+		}
+	}
+	return false, ""
+}
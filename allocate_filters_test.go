@@ -0,0 +1,62 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestCandidateFilters(t *testing.T) {
+	filters := candidateFilters{
+		&peerListFilter{
+			name:   "cordon",
+			reason: "peer is cordoned",
+			peers:  []peer.ID{test.TestPeerID1},
+		},
+		&metricAgeFilter{
+			maxAge: time.Minute,
+		},
+	}
+
+	m := api.Metric{
+		Peer:     test.TestPeerID1,
+		Received: time.Now().UnixNano(),
+	}
+	if !filters.exclude(m) {
+		t.Error("cordoned peer should be excluded")
+	}
+
+	m.Peer = test.TestPeerID2
+	if filters.exclude(m) {
+		t.Error("peer with a fresh metric should not be excluded")
+	}
+
+	m.Received = time.Now().Add(-2 * time.Minute).UnixNano()
+	if !filters.exclude(m) {
+		t.Error("peer with an old metric should be excluded")
+	}
+}
+
+func TestTagFilter(t *testing.T) {
+	f := &tagFilter{
+		tags: map[string]string{"region": "eu", "disk": "ssd"},
+		peerTags: map[peer.ID]map[string]string{
+			test.TestPeerID1: {"region": "eu", "disk": "ssd", "rack": "2"},
+			test.TestPeerID2: {"region": "us", "disk": "ssd"},
+			test.TestPeerID3: {"region": "eu"},
+		},
+	}
+
+	if excluded, _ := f.Exclude(api.Metric{Peer: test.TestPeerID1}); excluded {
+		t.Error("peer with matching tags should not be excluded")
+	}
+	for _, p := range []peer.ID{test.TestPeerID2, test.TestPeerID3, test.TestPeerID4} {
+		if excluded, _ := f.Exclude(api.Metric{Peer: p}); !excluded {
+			t.Errorf("%s should be excluded", p.Pretty())
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package ipfscluster
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// allocationHistorySaveInterval specifies how often the changes to the
+// allocation history are written to the AllocationHistoryFile.
+var allocationHistorySaveInterval = time.Minute
+
+var allocationHistoryBucket = []byte("allocations")
+
+// allocationHistory keeps the last allocation changes made by this peer
+// on every pin, up to a maximum per pin. The history of a pin is
+// forgotten when it is unpinned. It is persisted in a BoltDB datastore,
+// with a record per pin, so that only the pins which changed are
+// written.
+type allocationHistory struct {
+	mu      sync.RWMutex
+	size    int
+	changes map[string][]api.AllocationChange
+	// dirty are the pins which changed since the last save.
+	dirty map[string]struct{}
+	db    *bolt.DB
+}
+
+func newAllocationHistory(size int) *allocationHistory {
+	return &allocationHistory{
+		size:    size,
+		changes: make(map[string][]api.AllocationChange),
+		dirty:   make(map[string]struct{}),
+	}
+}
+
+// record adds a change of the allocations of a pin, dropping the oldest
+// ones over the limit.
+func (h *allocationHistory) record(c *cid.Cid, pid peer.ID, from, to []peer.ID, reason api.AllocationReason) {
+	change := api.AllocationChange{
+		Cid:       c.String(),
+		Peer:      peer.IDB58Encode(pid),
+		Timestamp: time.Now(),
+		From:      api.PeersToStrings(from),
+		To:        api.PeersToStrings(to),
+		Reason:    reason,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changes := append(h.changes[c.String()], change)
+	if len(changes) > h.size {
+		changes = changes[len(changes)-h.size:]
+	}
+	h.changes[c.String()] = changes
+	h.dirty[c.String()] = struct{}{}
+}
+
+// forget drops the history of a pin.
+func (h *allocationHistory) forget(c *cid.Cid) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.changes[c.String()]; !ok {
+		return
+	}
+	delete(h.changes, c.String())
+	h.dirty[c.String()] = struct{}{}
+}
+
+func (h *allocationHistory) get(c *cid.Cid) []api.AllocationChange {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	changes := h.changes[c.String()]
+	res := make([]api.AllocationChange, len(changes), len(changes))
+	copy(res, changes)
+	return res
+}
+
+// open loads the history from the datastore at the given path, creating
+// it if needed, and keeps it open to save the changes.
+func (h *allocationHistory) open(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(allocationHistoryBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var changes []api.AllocationChange
+			if err := json.Unmarshal(v, &changes); err != nil {
+				logger.Warningf("skipping malformed allocation history: %s", err)
+				return nil
+			}
+			if len(changes) > h.size {
+				changes = changes[len(changes)-h.size:]
+			}
+			h.changes[string(k)] = changes
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	h.db = db
+	return nil
+}
+
+// save writes the history of the pins which changed since the last
+// save to the datastore, if open.
+func (h *allocationHistory) save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db == nil || len(h.dirty) == 0 {
+		return nil
+	}
+
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(allocationHistoryBucket)
+		for k := range h.dirty {
+			changes, ok := h.changes[k]
+			if !ok {
+				if err := bucket.Delete([]byte(k)); err != nil {
+					return err
+				}
+				continue
+			}
+			raw, err := json.Marshal(changes)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(k), raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.dirty = make(map[string]struct{})
+	return nil
+}
+
+// close saves the pending changes and closes the datastore.
+func (h *allocationHistory) close() error {
+	err := h.save()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db == nil {
+		return err
+	}
+	if cerr := h.db.Close(); err == nil {
+		err = cerr
+	}
+	h.db = nil
+	return err
+}
+
+// saveAllocationHistory regularly persists the allocation history until
+// the peer is shut down.
+func (c *Cluster) saveAllocationHistory() {
+	ticker := time.NewTicker(allocationHistorySaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.allocHistory.save(); err != nil {
+				logger.Errorf("error saving allocation history: %s", err)
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// recordAllocationChange adds an allocation change to the history when
+// the allocations of the pin changed. New pins are recorded as initial
+// allocations, unless they are the new version of an updated pin.
+func (c *Cluster) recordAllocationChange(prev api.Pin, exists bool, pin api.Pin, reason api.AllocationReason) {
+	if !exists {
+		if reason != api.AllocationUpdate {
+			reason = api.AllocationInitial
+		}
+		c.allocHistory.record(pin.Cid, c.id, nil, pin.Allocations, reason)
+		return
+	}
+	if sameAllocations(prev.Allocations, pin.Allocations) {
+		return
+	}
+	c.allocHistory.record(pin.Cid, c.id, prev.Allocations, pin.Allocations, reason)
+}
+
+// sameAllocations returns whether two allocation lists contain the same
+// peers, in any order.
+func sameAllocations(a, b []peer.ID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, p := range a {
+		if !containsPeer(b, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllocationHistory returns the allocation changes made by every cluster
+// peer on the given Cid, oldest first. Unreachable peers are skipped.
+func (c *Cluster) AllocationHistory(h *cid.Cid) ([]api.AllocationChange, error) {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make([][]api.AllocationChange, len(members), len(members))
+	ifaces := make([]interface{}, len(members), len(members))
+	for i := range replies {
+		ifaces[i] = &replies[i]
+	}
+	errs := c.multiRPC(members, "Cluster", "AllocationHistoryLocal", api.PinCid(h).ToSerial(), ifaces)
+
+	history := []api.AllocationChange{}
+	for i, err := range errs {
+		if err != nil {
+			logger.Errorf("%s: error getting the allocation history from %s: %s", c.id, members[i], err)
+			continue
+		}
+		history = append(history, replies[i]...)
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Timestamp.Before(history[j].Timestamp)
+	})
+	return history, nil
+}
+
+// AllocationHistoryLocal returns the allocation changes made by this peer
+// on the given Cid.
+func (c *Cluster) AllocationHistoryLocal(h *cid.Cid) []api.AllocationChange {
+	history := c.allocHistory.get(h)
+	for i := range history {
+		history[i].Peername = c.config.Peername
+	}
+	return history
+}
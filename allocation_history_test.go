@@ -0,0 +1,84 @@
+package ipfscluster
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestAllocationHistory(t *testing.T) {
+	h := newAllocationHistory(2)
+	c, _ := cid.Decode(test.TestCid1)
+	from := []peer.ID{test.TestPeerID1}
+	to := []peer.ID{test.TestPeerID2}
+
+	h.record(c, test.TestPeerID1, nil, from, api.AllocationInitial)
+	h.record(c, test.TestPeerID1, from, to, api.AllocationFailure)
+	h.record(c, test.TestPeerID1, to, from, api.AllocationRebalance)
+
+	changes := h.get(c)
+	if len(changes) != 2 {
+		t.Fatal("expected the history to be bounded")
+	}
+	if changes[0].Reason != api.AllocationFailure || changes[1].Reason != api.AllocationRebalance {
+		t.Error("expected the oldest change to be dropped")
+	}
+	if changes[0].From[0] != test.TestPeerID1.Pretty() || changes[0].To[0] != test.TestPeerID2.Pretty() {
+		t.Error("unexpected allocations: ", changes[0])
+	}
+
+	path := "allocationHistoryFromTests"
+	defer os.Remove(path)
+	err := h.open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, _ := cid.Decode(test.TestCid2)
+	h.record(c2, test.TestPeerID1, nil, from, api.AllocationInitial)
+	err = h.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h2 := newAllocationHistory(1)
+	err = h2.open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes = h2.get(c)
+	if len(changes) != 1 || changes[0].Reason != api.AllocationRebalance {
+		t.Error("expected the last change to be loaded")
+	}
+
+	h2.forget(c2)
+	if len(h2.get(c2)) != 0 {
+		t.Error("expected the history of the pin to be forgotten")
+	}
+	h2.close()
+
+	h3 := newAllocationHistory(1)
+	err = h3.open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h3.close()
+	if len(h3.get(c2)) != 0 || len(h3.get(c)) != 1 {
+		t.Error("expected only the forgotten pin to be removed from the datastore")
+	}
+}
+
+func TestSameAllocations(t *testing.T) {
+	a := []peer.ID{test.TestPeerID1, test.TestPeerID2}
+	b := []peer.ID{test.TestPeerID2, test.TestPeerID1}
+	if !sameAllocations(a, b) {
+		t.Error("the order should not matter")
+	}
+	if sameAllocations(a, b[:1]) {
+		t.Error("different allocations should not be the same")
+	}
+}
@@ -0,0 +1,116 @@
+// Package balanced implements an ipfscluster.PinAllocator which spreads
+// the replicas of a pin across partitions of peers, defined by one of
+// their tags (i.e. "region" or "zone"), so that losing all the peers of a
+// partition does not lose all the replicas. Within a partition, peers
+// with the largest metrics (i.e. free space) come first.
+package balanced
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/ipfs/ipfs-cluster/allocator/util"
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("balancedalloc")
+
+// BalancedAllocator implements the ipfscluster.PinAllocator and
+// ipfscluster.TagAllocator interfaces.
+type BalancedAllocator struct {
+	config *Config
+}
+
+// NewAllocator returns an initialized BalancedAllocator.
+func NewAllocator(cfg *Config) (*BalancedAllocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &BalancedAllocator{config: cfg}, nil
+}
+
+// SetClient does nothing in this allocator
+func (alloc *BalancedAllocator) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing in this allocator
+func (alloc *BalancedAllocator) Shutdown() error { return nil }
+
+// Allocate sorts the candidates by their metric values (largest to
+// smallest), as all of them belong to the same partition when no tags
+// are known.
+func (alloc *BalancedAllocator) Allocate(c *cid.Cid, current,
+	candidates, priority map[peer.ID]api.Metric) ([]peer.ID, error) {
+	return alloc.AllocateWithTags(c, current, candidates, priority, nil)
+}
+
+// AllocateWithTags returns the priority peers followed by the candidates,
+// taking them in turns from the partition with the fewest allocations so
+// far (counting the current ones). Peers without the configured tag form
+// their own partition.
+func (alloc *BalancedAllocator) AllocateWithTags(c *cid.Cid, current,
+	candidates, priority map[peer.ID]api.Metric,
+	tags map[peer.ID]map[string]string) ([]peer.ID, error) {
+
+	partitionOf := func(p peer.ID) string {
+		return tags[p][alloc.config.Tag]
+	}
+
+	allocated := make(map[string]int)
+	for p := range current {
+		allocated[partitionOf(p)]++
+	}
+
+	first := util.SortNumeric(priority, true)
+	for _, p := range first {
+		allocated[partitionOf(p)]++
+	}
+
+	// candidates sorted by metric in every partition
+	partitions := make(map[string][]peer.ID)
+	for _, p := range util.SortNumeric(candidates, true) {
+		part := partitionOf(p)
+		partitions[part] = append(partitions[part], p)
+	}
+
+	var names []string
+	for part := range partitions {
+		names = append(names, part)
+	}
+	// deterministic order on ties: best next candidate, then name
+	value := func(p peer.ID) uint64 {
+		v, _ := strconv.ParseUint(candidates[p].Value, 10, 64)
+		return v
+	}
+
+	last := make([]peer.ID, 0, len(candidates))
+	for len(names) > 0 {
+		sort.Slice(names, func(i, j int) bool {
+			ni, nj := names[i], names[j]
+			if allocated[ni] != allocated[nj] {
+				return allocated[ni] < allocated[nj]
+			}
+			vi, vj := value(partitions[ni][0]), value(partitions[nj][0])
+			if vi != vj {
+				return vi > vj
+			}
+			return ni < nj
+		})
+
+		part := names[0]
+		last = append(last, partitions[part][0])
+		allocated[part]++
+		partitions[part] = partitions[part][1:]
+		if len(partitions[part]) == 0 {
+			names = names[1:]
+		}
+	}
+
+	logger.Debugf("balanced allocation for %s: %s", c, last)
+	return append(first, last...), nil
+}
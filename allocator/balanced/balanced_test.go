@@ -0,0 +1,99 @@
+package balanced
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var (
+	peer0      = peer.ID("QmUQ6Nsejt1SuZAu8yL8WgqQZHHAYreLVYYa4VPsLUCed7")
+	peer1      = peer.ID("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	peer2      = peer.ID("QmPrSBATWGAN56fiiEWEhKX3L1F3mTghEQR7vQwaeo7zHi")
+	peer3      = peer.ID("QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa")
+	peer4      = peer.ID("QmSGCzHkz8gC9fNndMtaCZdf9RFtwtbTEEsGo4zkVfcykD")
+	testCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+)
+
+var inAMinute = time.Now().Add(time.Minute).UnixNano()
+
+func metric(value string) api.Metric {
+	return api.Metric{
+		Name:   "freespace",
+		Value:  value,
+		Expire: inAMinute,
+		Valid:  true,
+	}
+}
+
+var candidates = map[peer.ID]api.Metric{
+	peer0: metric("50"),
+	peer1: metric("40"),
+	peer2: metric("30"),
+	peer3: metric("10"),
+}
+
+var peerTags = map[peer.ID]map[string]string{
+	peer0: {"region": "eu"},
+	peer1: {"region": "eu"},
+	peer2: {"region": "us"},
+	peer3: {"disk": "ssd"},
+	peer4: {"region": "eu"},
+}
+
+func newTestAllocator(t *testing.T) *BalancedAllocator {
+	cfg := &Config{}
+	cfg.Default()
+	alloc, err := NewAllocator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alloc
+}
+
+func checkAllocs(t *testing.T, res, expected []peer.ID) {
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d allocations, got %d: %s", len(expected), len(res), res)
+	}
+	for i, p := range expected {
+		if res[i] != p {
+			t.Errorf("expected %s in position %d, got %s", p, i, res[i])
+		}
+	}
+}
+
+func TestAllocateWithTags(t *testing.T) {
+	alloc := newTestAllocator(t)
+	empty := map[peer.ID]api.Metric{}
+
+	// regions are alternated, untagged peers form their own partition
+	res, err := alloc.AllocateWithTags(testCid, empty, candidates, empty, peerTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocs(t, res, []peer.ID{peer0, peer2, peer3, peer1})
+
+	// a current allocation in "eu" puts the other regions first
+	current := map[peer.ID]api.Metric{peer4: metric("100")}
+	res, err = alloc.AllocateWithTags(testCid, current, candidates, empty, peerTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocs(t, res, []peer.ID{peer2, peer3, peer0, peer1})
+}
+
+func TestAllocate(t *testing.T) {
+	alloc := newTestAllocator(t)
+	empty := map[peer.ID]api.Metric{}
+
+	// without tags, peers are sorted by metric
+	res, err := alloc.Allocate(testCid, empty, candidates, empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocs(t, res, []peer.ID{peer0, peer1, peer2, peer3})
+}
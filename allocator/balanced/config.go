@@ -0,0 +1,74 @@
+package balanced
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "balanced"
+
+// These are the default values for a Config.
+const (
+	DefaultTag = "region"
+)
+
+// Config allows to initialize a BalancedAllocator.
+type Config struct {
+	config.Saver
+
+	// Tag is the key of the peer tags (see the tags informer) used to
+	// partition the peers (i.e. "region" or "zone").
+	Tag string
+}
+
+type jsonConfig struct {
+	Tag string `json:"tag"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Tag = DefaultTag
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.Tag == "" {
+		return errors.New("balanced.tag is invalid")
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling balanced allocator config")
+		return err
+	}
+
+	cfg.Default()
+
+	config.SetIfNotDefault(jcfg.Tag, &cfg.Tag)
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.Tag = cfg.Tag
+
+	return config.DefaultJSONMarshal(jcfg)
+}
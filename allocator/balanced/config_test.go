@@ -0,0 +1,60 @@
+package balanced
+
+import (
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+      "tag": "zone"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tag != "zone" {
+		t.Error("tag was not loaded")
+	}
+
+	err = cfg.LoadJSON([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tag != DefaultTag {
+		t.Error("expected the default tag")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tag != "zone" {
+		t.Error("tag was not preserved")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Tag = ""
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
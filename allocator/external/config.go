@@ -0,0 +1,123 @@
+package external
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "external"
+
+// Configuration defaults
+const (
+	DefaultTimeout = 5 * time.Second
+)
+
+// Config allows to initialize an external Allocator.
+type Config struct {
+	config.Saver
+
+	// Endpoint is the HTTP(S) URL to which the allocation requests
+	// are POSTed.
+	Endpoint string
+
+	// Command is the program, followed by its arguments, which is run
+	// for every allocation request when no Endpoint is set. The request
+	// is written to its standard input and the response is read from
+	// its standard output.
+	Command []string
+
+	// Metrics are the names of the metrics sent to the plugin, besides
+	// the allocation metric.
+	Metrics []string
+
+	// Timeout is the maximum time the plugin can take to answer.
+	Timeout time.Duration
+}
+
+type jsonConfig struct {
+	Endpoint string   `json:"endpoint"`
+	Command  []string `json:"command,omitempty"`
+	Metrics  []string `json:"metrics,omitempty"`
+	Timeout  string   `json:"timeout"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Endpoint = ""
+	cfg.Command = nil
+	cfg.Metrics = nil
+	cfg.Timeout = DefaultTimeout
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.Endpoint != "" && len(cfg.Command) > 0 {
+		return errors.New("external.endpoint and external.command cannot be used together")
+	}
+
+	if cfg.Endpoint != "" {
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.New("external.endpoint is not a valid http(s) URL")
+		}
+	}
+
+	if len(cfg.Command) > 0 && cfg.Command[0] == "" {
+		return errors.New("external.command is invalid")
+	}
+
+	for _, name := range cfg.Metrics {
+		if name == "" {
+			return errors.New("external.metrics contains an empty name")
+		}
+	}
+
+	if cfg.Timeout <= 0 {
+		return errors.New("external.timeout is invalid")
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling external allocator config")
+		return err
+	}
+
+	cfg.Default()
+
+	t, _ := time.ParseDuration(jcfg.Timeout)
+	config.SetIfNotDefault(t, &cfg.Timeout)
+	cfg.Endpoint = jcfg.Endpoint
+	cfg.Command = jcfg.Command
+	cfg.Metrics = jcfg.Metrics
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.Endpoint = cfg.Endpoint
+	jcfg.Command = cfg.Command
+	jcfg.Metrics = cfg.Metrics
+	jcfg.Timeout = cfg.Timeout.String()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
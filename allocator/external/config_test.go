@@ -0,0 +1,73 @@
+package external
+
+import (
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+      "endpoint": "http://127.0.0.1:9999/allocate",
+      "metrics": ["freespace", "latency"],
+      "timeout": "10s"
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Endpoint != "http://127.0.0.1:9999/allocate" ||
+		len(cfg.Metrics) != 2 ||
+		cfg.Timeout != 10*time.Second {
+		t.Error("the configuration was not loaded")
+	}
+
+	err = cfg.LoadJSON([]byte(`{"endpoint": "ftp://example.com"}`))
+	if err == nil {
+		t.Error("expected an error with a non-http endpoint")
+	}
+
+	err = cfg.LoadJSON([]byte(`{"endpoint": "http://example.com", "command": ["allocate"]}`))
+	if err == nil {
+		t.Error("expected an error with both an endpoint and a command")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Endpoint != "http://127.0.0.1:9999/allocate" || cfg.Timeout != 10*time.Second {
+		t.Error("the configuration was not preserved")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Timeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Command = []string{""}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
@@ -0,0 +1,248 @@
+// Package external implements an ipfscluster.PinAllocator which delegates
+// the allocation decisions to an external plugin, so that custom placement
+// policies can be implemented without modifying ipfs-cluster.
+//
+// The plugin is either an HTTP endpoint, to which the requests are POSTed,
+// or a program, which is run for every request and reads it from its
+// standard input. Requests are JSON objects like:
+//
+//	{
+//	  "cid": "Qm...",
+//	  "current": ["Qm..."],
+//	  "candidates": ["Qm...", "Qm..."],
+//	  "priority": [],
+//	  "metrics": {
+//	    "freespace": [{"name": "freespace", "peer": "Qm...", "value": "1000", ...}]
+//	  }
+//	}
+//
+// "current" lists the peers which already pin the content, "candidates"
+// and "priority" the peers which can receive it (priority peers should
+// usually come first) and "metrics" the valid metrics of all those peers,
+// by name. The plugin answers (in the HTTP response body or in the
+// standard output of the program) with the peers which should pin the
+// content, in order of preference:
+//
+//	{"peers": ["Qm...", "Qm..."]}
+//
+// Peers which are not candidates or priority peers are ignored.
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"sort"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("externalalloc")
+
+// Request is sent to the plugin for every allocation.
+type Request struct {
+	Cid        string                        `json:"cid"`
+	Current    []string                      `json:"current"`
+	Candidates []string                      `json:"candidates"`
+	Priority   []string                      `json:"priority"`
+	Metrics    map[string][]api.MetricSerial `json:"metrics"`
+}
+
+// Response is expected from the plugin.
+type Response struct {
+	Peers []string `json:"peers"`
+}
+
+// Allocator implements the ipfscluster.PinAllocator and
+// ipfscluster.MultiMetricAllocator interfaces.
+type Allocator struct {
+	config *Config
+	client *http.Client
+}
+
+// NewAllocator returns an initialized Allocator. Either the Endpoint or
+// the Command must be configured.
+func NewAllocator(cfg *Config) (*Allocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Endpoint == "" && len(cfg.Command) == 0 {
+		return nil, errors.New("external.endpoint or external.command must be set")
+	}
+
+	return &Allocator{
+		config: cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// SetClient does nothing in this allocator
+func (alloc *Allocator) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing in this allocator
+func (alloc *Allocator) Shutdown() error { return nil }
+
+// MetricNames returns the names of the metrics sent to the plugin,
+// besides the allocation metric.
+func (alloc *Allocator) MetricNames() []string {
+	return alloc.config.Metrics
+}
+
+// Allocate asks the plugin to allocate the content using only the given
+// metrics.
+func (alloc *Allocator) Allocate(c *cid.Cid, current,
+	candidates, priority map[peer.ID]api.Metric) ([]peer.ID, error) {
+	return alloc.AllocateWithMetrics(c, current, candidates, priority, nil)
+}
+
+// AllocateWithMetrics asks the plugin to allocate the content. The
+// metrics given, along with the allocation metrics of the current,
+// candidate and priority peers, are sent to it.
+func (alloc *Allocator) AllocateWithMetrics(c *cid.Cid, current,
+	candidates, priority map[peer.ID]api.Metric,
+	metrics map[string]map[peer.ID]api.Metric) ([]peer.ID, error) {
+
+	req := Request{
+		Cid:        c.String(),
+		Current:    peerList(current),
+		Candidates: peerList(candidates),
+		Priority:   peerList(priority),
+		Metrics:    make(map[string][]api.MetricSerial),
+	}
+
+	seen := make(map[string]map[peer.ID]struct{})
+	addMetric := func(p peer.ID, m api.Metric) {
+		if m.Discard() {
+			return
+		}
+		if seen[m.Name] == nil {
+			seen[m.Name] = make(map[peer.ID]struct{})
+		}
+		if _, ok := seen[m.Name][p]; ok {
+			return
+		}
+		seen[m.Name][p] = struct{}{}
+		m.Peer = p
+		serial := m.ToSerial()
+		serial.Signature = nil
+		req.Metrics[m.Name] = append(req.Metrics[m.Name], serial)
+	}
+	for _, ms := range []map[peer.ID]api.Metric{current, candidates, priority} {
+		for p, m := range ms {
+			addMetric(p, m)
+		}
+	}
+	for _, ms := range metrics {
+		for p, m := range ms {
+			addMetric(p, m)
+		}
+	}
+
+	resp, err := alloc.call(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling the external allocator: %s", err)
+	}
+
+	var peers []peer.ID
+	added := make(map[peer.ID]struct{})
+	for _, pstr := range resp.Peers {
+		p, err := peer.IDB58Decode(pstr)
+		if err != nil {
+			logger.Warningf("external allocator returned an invalid peer %s: %s", pstr, err)
+			continue
+		}
+		_, isCandidate := candidates[p]
+		_, isPriority := priority[p]
+		if !isCandidate && !isPriority {
+			logger.Warningf("external allocator returned %s, which is not a candidate. Ignoring", pstr)
+			continue
+		}
+		if _, ok := added[p]; ok {
+			continue
+		}
+		added[p] = struct{}{}
+		peers = append(peers, p)
+	}
+	logger.Debugf("external allocation for %s: %s", c, peers)
+	return peers, nil
+}
+
+// call sends the request to the plugin and returns its response.
+func (alloc *Allocator) call(req Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	if alloc.config.Endpoint != "" {
+		out, err = alloc.post(body)
+	} else {
+		out, err = alloc.run(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &Response{}
+	err = json.Unmarshal(out, resp)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the response: %s", err)
+	}
+	return resp, nil
+}
+
+func (alloc *Allocator) post(body []byte) ([]byte, error) {
+	resp, err := alloc.client.Post(alloc.config.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(out))
+	}
+	return out, nil
+}
+
+func (alloc *Allocator) run(body []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), alloc.config.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, alloc.config.Command[0], alloc.config.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// peerList returns the peers with a valid metric, sorted.
+func peerList(metrics map[peer.ID]api.Metric) []string {
+	peers := make([]string, 0, len(metrics))
+	for p, m := range metrics {
+		if !m.Discard() {
+			peers = append(peers, peer.IDB58Encode(p))
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
@@ -0,0 +1,139 @@
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var (
+	peer0      = peer.ID("QmUQ6Nsejt1SuZAu8yL8WgqQZHHAYreLVYYa4VPsLUCed7")
+	peer1      = peer.ID("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	peer2      = peer.ID("QmPrSBATWGAN56fiiEWEhKX3L1F3mTghEQR7vQwaeo7zHi")
+	testCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+)
+
+var inAMinute = time.Now().Add(time.Minute).UnixNano()
+
+func metric(name, value string) api.Metric {
+	return api.Metric{
+		Name:   name,
+		Value:  value,
+		Expire: inAMinute,
+		Valid:  true,
+	}
+}
+
+func newTestAllocator(t *testing.T, endpoint string, command []string) *Allocator {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Endpoint = endpoint
+	cfg.Command = command
+	cfg.Metrics = []string{"latency"}
+	alloc, err := NewAllocator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alloc
+}
+
+func TestNewAllocator(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if _, err := NewAllocator(cfg); err == nil {
+		t.Error("expected an error without endpoint nor command")
+	}
+}
+
+func TestAllocateEndpoint(t *testing.T) {
+	var req Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// an unknown peer, which should be ignored, and the candidates
+		// in reverse order.
+		json.NewEncoder(w).Encode(Response{
+			Peers: []string{
+				peer.IDB58Encode(peer0),
+				peer.IDB58Encode(peer2),
+				peer.IDB58Encode(peer1),
+			},
+		})
+	}))
+	defer ts.Close()
+
+	alloc := newTestAllocator(t, ts.URL, nil)
+	current := map[peer.ID]api.Metric{peer0: metric("freespace", "1")}
+	candidates := map[peer.ID]api.Metric{
+		peer1: metric("freespace", "10"),
+		peer2: metric("freespace", "20"),
+	}
+	metrics := map[string]map[peer.ID]api.Metric{
+		"latency": {peer1: metric("latency", "5")},
+	}
+
+	res, err := alloc.AllocateWithMetrics(testCid, current, candidates, nil, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0] != peer2 || res[1] != peer1 {
+		t.Errorf("unexpected allocations: %s", res)
+	}
+
+	if req.Cid != testCid.String() || len(req.Current) != 1 || len(req.Candidates) != 2 {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if len(req.Metrics["freespace"]) != 3 || len(req.Metrics["latency"]) != 1 {
+		t.Errorf("unexpected request metrics: %+v", req.Metrics)
+	}
+	if req.Metrics["latency"][0].Peer != peer.IDB58Encode(peer1) {
+		t.Error("the metrics should include their peer")
+	}
+}
+
+func TestAllocateEndpointError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no capacity", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	alloc := newTestAllocator(t, ts.URL, nil)
+	candidates := map[peer.ID]api.Metric{peer1: metric("freespace", "10")}
+	_, err := alloc.Allocate(testCid, nil, candidates, nil)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestAllocateCommand(t *testing.T) {
+	out := fmt.Sprintf(`{"peers": ["%s"]}`, peer.IDB58Encode(peer1))
+	alloc := newTestAllocator(t, "", []string{"sh", "-c", "cat > /dev/null; echo '" + out + "'"})
+	candidates := map[peer.ID]api.Metric{
+		peer1: metric("freespace", "10"),
+		peer2: metric("freespace", "20"),
+	}
+
+	res, err := alloc.Allocate(testCid, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != peer1 {
+		t.Errorf("unexpected allocations: %s", res)
+	}
+
+	alloc = newTestAllocator(t, "", []string{"sh", "-c", "exit 1"})
+	_, err = alloc.Allocate(testCid, nil, candidates, nil)
+	if err == nil {
+		t.Error("expected an error when the command fails")
+	}
+}
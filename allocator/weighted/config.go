@@ -0,0 +1,88 @@
+package weighted
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "weighted"
+
+// DefaultWeights only considers the free space.
+var DefaultWeights = map[string]float64{
+	"freespace": 1,
+}
+
+// Config allows to initialize a WeightedAllocator.
+type Config struct {
+	config.Saver
+
+	// Weights gives the weight of every metric in the score of a
+	// peer. Metrics with positive weights are better when larger (i.e.
+	// "freespace") and metrics with negative weights are better when
+	// smaller (i.e. "pinqueue" or "latency").
+	Weights map[string]float64
+}
+
+type jsonConfig struct {
+	Weights map[string]float64 `json:"weights"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.Weights = make(map[string]float64)
+	for k, v := range DefaultWeights {
+		cfg.Weights[k] = v
+	}
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if len(cfg.Weights) == 0 {
+		return errors.New("weighted.weights is empty")
+	}
+
+	for name, w := range cfg.Weights {
+		if name == "" || w == 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return errors.New("weighted.weights contains an invalid weight")
+		}
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling weighted allocator config")
+		return err
+	}
+
+	cfg.Default()
+
+	if len(jcfg.Weights) > 0 {
+		cfg.Weights = jcfg.Weights
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.Weights = cfg.Weights
+
+	return config.DefaultJSONMarshal(jcfg)
+}
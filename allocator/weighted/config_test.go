@@ -0,0 +1,68 @@
+package weighted
+
+import (
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+      "weights": {
+            "freespace": 2,
+            "pinqueue": -1
+      }
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Weights["freespace"] != 2 || cfg.Weights["pinqueue"] != -1 {
+		t.Error("weights were not loaded")
+	}
+
+	err = cfg.LoadJSON([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Weights) != 1 || cfg.Weights["freespace"] != 1 {
+		t.Error("expected the default weights")
+	}
+
+	err = cfg.LoadJSON([]byte(`{"weights": {"freespace": 0}}`))
+	if err == nil {
+		t.Error("expected an error with a zero weight")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Weights) != 2 || cfg.Weights["pinqueue"] != -1 {
+		t.Error("weights were not preserved")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.Weights = map[string]float64{}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
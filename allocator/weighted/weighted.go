@@ -0,0 +1,159 @@
+// Package weighted implements an ipfscluster.PinAllocator which combines
+// several numeric metrics (i.e. free space, pin queue, bandwidth and
+// latency) into a score for every peer, using configurable weights, and
+// returns the peers with the highest scores first.
+//
+// Every metric is normalized to the [0, 1] range across the candidates
+// before being weighted, so that metrics with different units can be
+// combined. Peers which do not provide a metric get the worst value for
+// it.
+package weighted
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("weightedalloc")
+
+// WeightedAllocator implements the ipfscluster.PinAllocator and
+// ipfscluster.MultiMetricAllocator interfaces.
+type WeightedAllocator struct {
+	config *Config
+}
+
+// NewAllocator returns an initialized WeightedAllocator.
+func NewAllocator(cfg *Config) (*WeightedAllocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &WeightedAllocator{config: cfg}, nil
+}
+
+// SetClient does nothing in this allocator
+func (alloc *WeightedAllocator) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing in this allocator
+func (alloc *WeightedAllocator) Shutdown() error { return nil }
+
+// MetricNames returns the names of the weighted metrics.
+func (alloc *WeightedAllocator) MetricNames() []string {
+	names := make([]string, 0, len(alloc.config.Weights))
+	for name := range alloc.config.Weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Allocate scores the candidates using only the metrics given, which
+// are considered to be the first weighted metric when they have no name.
+func (alloc *WeightedAllocator) Allocate(c *cid.Cid, current,
+	candidates, priority map[peer.ID]api.Metric) ([]peer.ID, error) {
+	metrics := make(map[string]map[peer.ID]api.Metric)
+	for _, ms := range []map[peer.ID]api.Metric{candidates, priority} {
+		for p, m := range ms {
+			if metrics[m.Name] == nil {
+				metrics[m.Name] = make(map[peer.ID]api.Metric)
+			}
+			metrics[m.Name][p] = m
+		}
+	}
+	return alloc.AllocateWithMetrics(c, current, candidates, priority, metrics)
+}
+
+// AllocateWithMetrics returns the priority peers followed by the
+// candidates, each group sorted by score (highest first).
+func (alloc *WeightedAllocator) AllocateWithMetrics(c *cid.Cid, current,
+	candidates, priority map[peer.ID]api.Metric,
+	metrics map[string]map[peer.ID]api.Metric) ([]peer.ID, error) {
+
+	first := alloc.sortByScore(validPeers(priority), metrics)
+	last := alloc.sortByScore(validPeers(candidates), metrics)
+	logger.Debugf("weighted allocation for %s: %s %s", c, first, last)
+	return append(first, last...), nil
+}
+
+func validPeers(metrics map[peer.ID]api.Metric) []peer.ID {
+	peers := make([]peer.ID, 0, len(metrics))
+	for p, m := range metrics {
+		if !m.Discard() {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// sortByScore sorts the peers by their weighted score, highest first.
+// Ties are sorted by peer ID.
+func (alloc *WeightedAllocator) sortByScore(peers []peer.ID, metrics map[string]map[peer.ID]api.Metric) []peer.ID {
+	scores := make(map[peer.ID]float64)
+	for name, w := range alloc.config.Weights {
+		norm := normalize(peers, metrics[name])
+		for _, p := range peers {
+			v, ok := norm[p]
+			if !ok { // worst value
+				v = 0
+				if w < 0 {
+					v = 1
+				}
+			}
+			scores[p] += w * v
+		}
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		si, sj := scores[peers[i]], scores[peers[j]]
+		if si != sj {
+			return si > sj
+		}
+		return peers[i] < peers[j]
+	})
+	return peers
+}
+
+// normalize maps the numeric values of the metrics of the given peers to
+// the [0, 1] range. Peers without a valid numeric metric are missing.
+func normalize(peers []peer.ID, metrics map[peer.ID]api.Metric) map[peer.ID]float64 {
+	values := make(map[peer.ID]float64)
+	for _, p := range peers {
+		m, ok := metrics[p]
+		if !ok || m.Discard() {
+			continue
+		}
+		v, err := strconv.ParseFloat(m.Value, 64)
+		if err != nil {
+			continue
+		}
+		values[p] = v
+	}
+
+	first := true
+	var min, max float64
+	for _, v := range values {
+		if first || v < min {
+			min = v
+		}
+		if first || v > max {
+			max = v
+		}
+		first = false
+	}
+
+	for p, v := range values {
+		if max == min {
+			values[p] = 1
+			continue
+		}
+		values[p] = (v - min) / (max - min)
+	}
+	return values
+}
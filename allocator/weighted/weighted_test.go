@@ -0,0 +1,133 @@
+package weighted
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var (
+	peer0      = peer.ID("QmUQ6Nsejt1SuZAu8yL8WgqQZHHAYreLVYYa4VPsLUCed7")
+	peer1      = peer.ID("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	peer2      = peer.ID("QmPrSBATWGAN56fiiEWEhKX3L1F3mTghEQR7vQwaeo7zHi")
+	peer3      = peer.ID("QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa")
+	testCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+)
+
+var inAMinute = time.Now().Add(time.Minute).UnixNano()
+
+func metric(name, value string) api.Metric {
+	return api.Metric{
+		Name:   name,
+		Value:  value,
+		Expire: inAMinute,
+		Valid:  true,
+	}
+}
+
+func newTestAllocator(t *testing.T, weights map[string]float64) *WeightedAllocator {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Weights = weights
+	alloc, err := NewAllocator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alloc
+}
+
+func checkAllocs(t *testing.T, res, expected []peer.ID) {
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d allocations, got %d: %s", len(expected), len(res), res)
+	}
+	for i := range res {
+		if res[i] != expected[i] {
+			t.Fatalf("expected %s, got %s", expected, res)
+		}
+	}
+}
+
+func TestMetricNames(t *testing.T) {
+	alloc := newTestAllocator(t, map[string]float64{"pinqueue": -1, "freespace": 1})
+	names := alloc.MetricNames()
+	if len(names) != 2 || names[0] != "freespace" || names[1] != "pinqueue" {
+		t.Errorf("unexpected metric names: %s", names)
+	}
+}
+
+func TestAllocateWithMetrics(t *testing.T) {
+	candidates := map[peer.ID]api.Metric{
+		peer0: metric("freespace", "100"),
+		peer1: metric("freespace", "90"),
+		peer2: metric("freespace", "10"),
+	}
+	metrics := map[string]map[peer.ID]api.Metric{
+		"freespace": candidates,
+		"pinqueue": {
+			peer0: metric("pinqueue", "50"),
+			peer1: metric("pinqueue", "0"),
+			// peer2 is missing: the worst value
+		},
+	}
+
+	// Only free space
+	alloc := newTestAllocator(t, map[string]float64{"freespace": 1})
+	res, err := alloc.AllocateWithMetrics(testCid, nil, candidates, nil, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocs(t, res, []peer.ID{peer0, peer1, peer2})
+
+	// The pin queue weights more than the free space
+	alloc = newTestAllocator(t, map[string]float64{"freespace": 1, "pinqueue": -2})
+	res, err = alloc.AllocateWithMetrics(testCid, nil, candidates, nil, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocs(t, res, []peer.ID{peer1, peer0, peer2})
+}
+
+func TestAllocateWithMetricsPriority(t *testing.T) {
+	candidates := map[peer.ID]api.Metric{
+		peer0: metric("freespace", "100"),
+		peer1: metric("freespace", "90"),
+	}
+	priority := map[peer.ID]api.Metric{
+		peer2: metric("freespace", "10"),
+		peer3: metric("freespace", "20"),
+	}
+	metrics := map[string]map[peer.ID]api.Metric{
+		"freespace": {
+			peer0: candidates[peer0],
+			peer1: candidates[peer1],
+			peer2: priority[peer2],
+			peer3: priority[peer3],
+		},
+	}
+
+	alloc := newTestAllocator(t, map[string]float64{"freespace": 1})
+	res, err := alloc.AllocateWithMetrics(testCid, nil, candidates, priority, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocs(t, res, []peer.ID{peer3, peer2, peer0, peer1})
+}
+
+func TestAllocate(t *testing.T) {
+	candidates := map[peer.ID]api.Metric{
+		peer0: metric("freespace", "10"),
+		peer1: metric("freespace", "30"),
+		peer2: metric("freespace", "20"),
+	}
+
+	alloc := newTestAllocator(t, map[string]float64{"freespace": 1})
+	res, err := alloc.Allocate(testCid, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAllocs(t, res, []peer.ID{peer1, peer2, peer0})
+}
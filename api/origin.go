@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// Origin identifies who started an operation: a user of the REST API,
+// a client of the IPFS proxy, another peer or an internal cluster
+// process. It is used in logs and events to tell where an action came
+// from.
+type Origin string
+
+// APIOrigin returns the Origin for requests made to the REST API by the
+// given user (which may be empty when no authentication is configured)
+// from the given remote address.
+func APIOrigin(user, remote string) Origin {
+	if user == "" {
+		return Origin("api:" + remote)
+	}
+	return Origin("api:" + user + "@" + remote)
+}
+
+// ProxyOrigin returns the Origin for requests made to the IPFS proxy
+// from the given remote address.
+func ProxyOrigin(remote string) Origin {
+	return Origin("proxy:" + remote)
+}
+
+// PeerOrigin returns the Origin for operations requested by a cluster
+// peer.
+func PeerOrigin(p peer.ID) Origin {
+	return Origin("peer:" + peer.IDB58Encode(p))
+}
+
+// LocalRPCOrigin returns the Origin for requests made to the local RPC
+// socket.
+func LocalRPCOrigin() Origin {
+	return Origin("localrpc")
+}
+
+// InternalOrigin returns the Origin for operations started by a cluster
+// process (i.e. "repin", "monitor").
+func InternalOrigin(process string) Origin {
+	return Origin("internal:" + process)
+}
+
+type originKey struct{}
+
+// ContextWithOrigin returns a context carrying the given Origin. The
+// context can be used with RPC calls so that the called methods know
+// who started the operation.
+func ContextWithOrigin(ctx context.Context, o Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, o)
+}
+
+// OriginFromContext returns the Origin carried by the context, or an
+// empty Origin when there is none.
+func OriginFromContext(ctx context.Context) Origin {
+	if ctx == nil {
+		return ""
+	}
+	o, _ := ctx.Value(originKey{}).(Origin)
+	return o
+}
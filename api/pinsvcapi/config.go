@@ -0,0 +1,173 @@
+package pinsvcapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/config"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const configKey = "pinsvcapi"
+
+// These are the default values for Config
+const (
+	DefaultHTTPListenAddr     = "/ip4/127.0.0.1/tcp/9097"
+	DefaultHTTPListenAddrIPv6 = "/ip6/::1/tcp/9097"
+	DefaultReadTimeout        = 30 * time.Second
+	DefaultReadHeaderTimeout  = 5 * time.Second
+	DefaultWriteTimeout       = 60 * time.Second
+	DefaultIdleTimeout        = 120 * time.Second
+)
+
+// Config is used to initialize the Pinning Service API component. It
+// implements the config.ComponentConfig interface.
+type Config struct {
+	config.Saver
+
+	// Enabled starts the component. It is disabled by default.
+	Enabled bool
+
+	// Listen address for the HTTP endpoint.
+	HTTPListenAddr ma.Multiaddr
+
+	// Maximum duration before timing out reading a full request
+	ReadTimeout time.Duration
+
+	// Maximum duration before timing out reading the headers of a request
+	ReadHeaderTimeout time.Duration
+
+	// Maximum duration before timing out write of the response
+	WriteTimeout time.Duration
+
+	// Server-side amount of time a Keep-Alive connection will be
+	// kept idle before being reused
+	IdleTimeout time.Duration
+
+	// BearerTokens maps the access tokens accepted in the
+	// Authorization header to the name of their user. They are
+	// required when the component is enabled.
+	BearerTokens map[string]string
+}
+
+type jsonConfig struct {
+	Enabled                bool   `json:"enabled"`
+	HTTPListenMultiaddress string `json:"http_listen_multiaddress"`
+	ReadTimeout            string `json:"read_timeout"`
+	ReadHeaderTimeout      string `json:"read_header_timeout"`
+	WriteTimeout           string `json:"write_timeout"`
+	IdleTimeout            string `json:"idle_timeout"`
+
+	BearerTokens map[string]string `json:"bearer_tokens"`
+}
+
+// ConfigKey returns a human-friendly identifier for this type of
+// Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with working values.
+func (cfg *Config) Default() error {
+	httpListen, _ := ma.NewMultiaddr(types.PreferredAddr(DefaultHTTPListenAddr, DefaultHTTPListenAddrIPv6))
+	cfg.Enabled = false
+	cfg.HTTPListenAddr = httpListen
+	cfg.ReadTimeout = DefaultReadTimeout
+	cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	cfg.WriteTimeout = DefaultWriteTimeout
+	cfg.IdleTimeout = DefaultIdleTimeout
+	cfg.BearerTokens = nil
+	return nil
+}
+
+// Validate makes sure that all fields in this Config have
+// working values, at least in appearance.
+func (cfg *Config) Validate() error {
+	switch {
+	case cfg.HTTPListenAddr == nil:
+		return errors.New("pinsvcapi.http_listen_multiaddress is not set")
+	case cfg.ReadTimeout < 0:
+		return errors.New("pinsvcapi.read_timeout is invalid")
+	case cfg.ReadHeaderTimeout < 0:
+		return errors.New("pinsvcapi.read_header_timeout is invalid")
+	case cfg.WriteTimeout < 0:
+		return errors.New("pinsvcapi.write_timeout is invalid")
+	case cfg.IdleTimeout < 0:
+		return errors.New("pinsvcapi.idle_timeout invalid")
+	case cfg.BearerTokens != nil && len(cfg.BearerTokens) == 0:
+		return errors.New("pinsvcapi.bearer_tokens should be null or have at least one entry")
+	case cfg.Enabled && len(cfg.BearerTokens) == 0:
+		return errors.New("pinsvcapi.bearer_tokens must be set to enable the Pinning Service API")
+	}
+	for token := range cfg.BearerTokens {
+		if token == "" {
+			return errors.New("pinsvcapi.bearer_tokens cannot have empty tokens")
+		}
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte slice created by ToJSON() and sets the
+// configuration fields accordingly.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling pinsvcapi config")
+		return err
+	}
+
+	cfg.Default()
+	cfg.Enabled = jcfg.Enabled
+
+	if l := jcfg.HTTPListenMultiaddress; l != "" {
+		httpAddr, err := ma.NewMultiaddr(l)
+		if err != nil {
+			return fmt.Errorf("error parsing pinsvcapi.http_listen_multiaddress: %s", err)
+		}
+		cfg.HTTPListenAddr = httpAddr
+	}
+
+	err = config.ParseDurations(
+		"pinsvcapi",
+		&config.DurationOpt{jcfg.ReadTimeout, &cfg.ReadTimeout, "read_timeout"},
+		&config.DurationOpt{jcfg.ReadHeaderTimeout, &cfg.ReadHeaderTimeout, "read_header_timeout"},
+		&config.DurationOpt{jcfg.WriteTimeout, &cfg.WriteTimeout, "write_timeout"},
+		&config.DurationOpt{jcfg.IdleTimeout, &cfg.IdleTimeout, "idle_timeout"},
+	)
+	if err != nil {
+		return err
+	}
+
+	cfg.BearerTokens = jcfg.BearerTokens
+
+	return cfg.Validate()
+}
+
+// ToJSON produce a human-friendly JSON representation of the Config
+// object.
+func (cfg *Config) ToJSON() (raw []byte, err error) {
+	// Multiaddress String() may panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+
+	jcfg := &jsonConfig{
+		Enabled:                cfg.Enabled,
+		HTTPListenMultiaddress: cfg.HTTPListenAddr.String(),
+		ReadTimeout:            cfg.ReadTimeout.String(),
+		ReadHeaderTimeout:      cfg.ReadHeaderTimeout.String(),
+		WriteTimeout:           cfg.WriteTimeout.String(),
+		IdleTimeout:            cfg.IdleTimeout.String(),
+		BearerTokens:           cfg.BearerTokens,
+	}
+
+	raw, err = config.DefaultJSONMarshal(jcfg)
+	return
+}
@@ -0,0 +1,118 @@
+package pinsvcapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+      "enabled": true,
+      "http_listen_multiaddress": "/ip4/127.0.0.1/tcp/9097",
+      "read_timeout": "30s",
+      "read_header_timeout": "5s",
+      "write_timeout": "1m0s",
+      "idle_timeout": "2m0s",
+      "bearer_tokens": {
+        "secret": "alice"
+      }
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.ReadTimeout != 30*time.Second ||
+		cfg.WriteTimeout != time.Minute ||
+		cfg.ReadHeaderTimeout != 5*time.Second ||
+		cfg.IdleTimeout != 2*time.Minute {
+		t.Error("error parsing timeouts")
+	}
+	if !cfg.Enabled || cfg.BearerTokens["secret"] != "alice" {
+		t.Error("error parsing enabled and bearer_tokens")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.HTTPListenMultiaddress = "abc"
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding listen multiaddress")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.ReadTimeout = "-1"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error in read_timeout")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.BearerTokens = map[string]string{}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with empty bearer_tokens")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.BearerTokens = map[string]string{"": "alice"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with an empty token")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.BearerTokens = nil
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error enabling the API without bearer_tokens")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BearerTokens["secret"] != "alice" {
+		t.Error("bearer_tokens were not kept")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+	if cfg.Enabled {
+		t.Error("the API should be disabled by default")
+	}
+
+	cfg.Default()
+	cfg.IdleTimeout = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
@@ -0,0 +1,605 @@
+// Package pinsvcapi implements an IPFS Cluster API component which
+// provides the IPFS Pinning Service API
+// (https://ipfs.github.io/pinning-services-api-spec/), so that IPFS
+// clients and other tools can use the cluster as a remote pinning service.
+//
+// The ID of a pin request is the Cid it pins: there is at most one
+// request per Cid, and the requests are the pins in the shared state.
+// Replacing a request pins the new Cid and unpins the previous one.
+//
+// The component must be enabled in its configuration, along with the
+// bearer tokens which clients authenticate with.
+package pinsvcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+
+	mux "github.com/gorilla/mux"
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+var logger = logging.Logger("pinsvcapi")
+
+// Limits of the listings of pin requests.
+const (
+	DefaultLimit = 10
+	MaxLimit     = 1000
+	// MaxCids is the maximum number of Cids to filter listings on.
+	MaxCids = 10
+)
+
+// Reasons of the error responses.
+const (
+	ReasonBadRequest   = "BAD_REQUEST"
+	ReasonUnauthorized = "UNAUTHORIZED"
+	ReasonNotFound     = "NOT_FOUND"
+	ReasonInternal     = "INTERNAL_SERVER_ERROR"
+)
+
+// API implements the Pinning Service API for Cluster.
+type API struct {
+	ctx    context.Context
+	cancel func()
+
+	config *Config
+
+	rpcClient *rpc.Client
+	rpcReady  chan struct{}
+
+	server       *http.Server
+	httpListener net.Listener
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+	wg           sync.WaitGroup
+}
+
+type route struct {
+	Name        string
+	Method      string
+	Pattern     string
+	HandlerFunc http.HandlerFunc
+}
+
+// NewAPI creates a new Pinning Service API component with the given
+// configuration, which must enable it.
+func NewAPI(cfg *Config) (*API, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, errors.New("the Pinning Service API is not enabled")
+	}
+
+	n, addr, err := manet.DialArgs(cfg.HTTPListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen(n, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	router := mux.NewRouter().StrictSlash(true)
+	s := &http.Server{
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		Handler:           router,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	api := &API{
+		ctx:          ctx,
+		cancel:       cancel,
+		config:       cfg,
+		rpcReady:     make(chan struct{}, 1),
+		server:       s,
+		httpListener: l,
+	}
+	api.addRoutes(router)
+
+	api.wg.Add(1)
+	go api.run()
+	return api, nil
+}
+
+// HTTPAddress returns the HTTP listening address in host:port format.
+// Useful when configured to start on a random port (0).
+func (api *API) HTTPAddress() string {
+	return api.httpListener.Addr().String()
+}
+
+func (api *API) addRoutes(router *mux.Router) {
+	for _, route := range api.routes() {
+		route.HandlerFunc = bearerAuth(route.HandlerFunc, api.config.BearerTokens)
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.HandlerFunc)
+	}
+}
+
+func (api *API) routes() []route {
+	return []route{
+		{
+			"ListPins",
+			"GET",
+			"/pins",
+			api.listHandler,
+		},
+		{
+			"AddPin",
+			"POST",
+			"/pins",
+			api.addHandler,
+		},
+		{
+			"GetPin",
+			"GET",
+			"/pins/{requestid}",
+			api.getHandler,
+		},
+		{
+			"ReplacePin",
+			"POST",
+			"/pins/{requestid}",
+			api.replaceHandler,
+		},
+		{
+			"DeletePin",
+			"DELETE",
+			"/pins/{requestid}",
+			api.deleteHandler,
+		},
+	}
+}
+
+// bearerToken returns the token in the Authorization header of a
+// request, if any.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+}
+
+func bearerAuth(h http.HandlerFunc, tokens map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if _, ok := tokens[token]; !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
+			sendFailure(w, 401, ReasonUnauthorized, "a valid access token is required")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// rpcContext returns the context for the RPC calls made to serve a
+// request. It carries the origin of the request: the user of the access
+// token.
+func (api *API) rpcContext(r *http.Request) context.Context {
+	user := api.config.BearerTokens[bearerToken(r)]
+	return types.ContextWithOrigin(r.Context(), types.APIOrigin(user, r.RemoteAddr))
+}
+
+func (api *API) run() {
+	defer api.wg.Done()
+	<-api.rpcReady
+
+	logger.Infof("Pinning Service API (HTTP): %s", api.config.HTTPListenAddr)
+	err := api.server.Serve(api.httpListener)
+	if err != nil && !strings.Contains(err.Error(), "closed network connection") {
+		logger.Error(err)
+	}
+}
+
+// Shutdown stops the API listener.
+func (api *API) Shutdown() error {
+	api.shutdownLock.Lock()
+	defer api.shutdownLock.Unlock()
+
+	if api.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping Pinning Service API")
+
+	api.cancel()
+	close(api.rpcReady)
+	api.server.SetKeepAlivesEnabled(false)
+	api.httpListener.Close()
+
+	api.wg.Wait()
+	api.shutdown = true
+	return nil
+}
+
+// SetClient makes the component ready to perform RPC
+// requests.
+func (api *API) SetClient(c *rpc.Client) {
+	api.rpcClient = c
+	api.rpcReady <- struct{}{}
+}
+
+// listQuery holds the filters of a listing of pin requests.
+type listQuery struct {
+	cids     map[string]bool
+	name     string
+	match    string
+	statuses map[Status]bool
+	before   time.Time
+	after    time.Time
+	limit    int
+	meta     map[string]string
+}
+
+func parseListQuery(r *http.Request) (listQuery, error) {
+	q := r.URL.Query()
+	lq := listQuery{
+		name:     q.Get("name"),
+		match:    q.Get("match"),
+		statuses: map[Status]bool{StatusPinned: true},
+		limit:    DefaultLimit,
+	}
+
+	if cidsStr := q.Get("cid"); cidsStr != "" {
+		lq.cids = make(map[string]bool)
+		for _, c := range strings.Split(cidsStr, ",") {
+			h, err := cid.Decode(c)
+			if err != nil {
+				return lq, errors.New("invalid cid: " + c)
+			}
+			lq.cids[h.String()] = true
+		}
+		if len(lq.cids) > MaxCids {
+			return lq, errors.New("too many cids")
+		}
+	}
+
+	switch lq.match {
+	case "":
+		lq.match = "exact"
+	case "exact", "iexact", "partial", "ipartial":
+	default:
+		return lq, errors.New("invalid match: " + lq.match)
+	}
+
+	if statusStr := q.Get("status"); statusStr != "" {
+		lq.statuses = make(map[Status]bool)
+		for _, st := range strings.Split(statusStr, ",") {
+			switch Status(st) {
+			case StatusQueued, StatusPinning, StatusPinned, StatusFailed:
+				lq.statuses[Status(st)] = true
+			default:
+				return lq, errors.New("invalid status: " + st)
+			}
+		}
+	}
+
+	var err error
+	if s := q.Get("before"); s != "" {
+		if lq.before, err = time.Parse(time.RFC3339, s); err != nil {
+			return lq, errors.New("invalid before: not a RFC3339 date")
+		}
+	}
+	if s := q.Get("after"); s != "" {
+		if lq.after, err = time.Parse(time.RFC3339, s); err != nil {
+			return lq, errors.New("invalid after: not a RFC3339 date")
+		}
+	}
+
+	if s := q.Get("limit"); s != "" {
+		lq.limit, err = strconv.Atoi(s)
+		if err != nil || lq.limit < 1 || lq.limit > MaxLimit {
+			return lq, errors.New("invalid limit: must be between 1 and " + strconv.Itoa(MaxLimit))
+		}
+	}
+
+	if s := q.Get("meta"); s != "" {
+		if err := json.Unmarshal([]byte(s), &lq.meta); err != nil {
+			return lq, errors.New("invalid meta: not a JSON object of strings")
+		}
+	}
+	return lq, nil
+}
+
+// matches tells whether a pin matches the filters, other than the
+// status.
+func (lq listQuery) matches(pin types.PinSerial) bool {
+	if lq.cids != nil && !lq.cids[pin.Cid] {
+		return false
+	}
+	if lq.name != "" {
+		switch lq.match {
+		case "exact":
+			if pin.Name != lq.name {
+				return false
+			}
+		case "iexact":
+			if !strings.EqualFold(pin.Name, lq.name) {
+				return false
+			}
+		case "partial":
+			if !strings.Contains(pin.Name, lq.name) {
+				return false
+			}
+		case "ipartial":
+			if !strings.Contains(strings.ToLower(pin.Name), strings.ToLower(lq.name)) {
+				return false
+			}
+		}
+	}
+	created := time.Unix(0, pin.Timestamp)
+	if !lq.before.IsZero() && !created.Before(lq.before) {
+		return false
+	}
+	if !lq.after.IsZero() && !created.After(lq.after) {
+		return false
+	}
+	return pin.MatchesFilter("", lq.meta)
+}
+
+func (api *API) listHandler(w http.ResponseWriter, r *http.Request) {
+	lq, err := parseListQuery(r)
+	if err != nil {
+		sendFailure(w, 400, ReasonBadRequest, err.Error())
+		return
+	}
+
+	var pins []types.PinSerial
+	err = api.rpcClient.CallContext(api.rpcContext(r), "", "Cluster", "Pins", struct{}{}, &pins)
+	if err != nil {
+		sendFailure(w, 500, ReasonInternal, err.Error())
+		return
+	}
+
+	var candidates []types.PinSerial
+	for _, pin := range pins {
+		// shards are an internal detail of sharded DAGs
+		if pin.Type == types.ShardType || !lq.matches(pin) {
+			continue
+		}
+		candidates = append(candidates, pin)
+	}
+
+	results := PinResults{Results: []PinStatus{}}
+	if len(candidates) == 0 {
+		sendJSONResponse(w, 200, results)
+		return
+	}
+
+	// newest first
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Timestamp > candidates[j].Timestamp
+	})
+
+	// The status of the requests is asked to every peer, so it is only
+	// checked, a page at a time, until enough results are found. The
+	// requests which are left unchecked are included in the count.
+	delegates := api.delegates(r)
+	checked := 0
+	for checked < len(candidates) && len(results.Results) < lq.limit {
+		page := candidates[checked:]
+		if len(page) > lq.limit {
+			page = page[:lq.limit]
+		}
+		checked += len(page)
+
+		statuses, err := api.statuses(r, page)
+		if err != nil {
+			sendFailure(w, 500, ReasonInternal, err.Error())
+			return
+		}
+		for _, pin := range page {
+			st := statuses[pin.Cid]
+			if !lq.statuses[st] {
+				continue
+			}
+			results.Count++
+			if len(results.Results) < lq.limit {
+				results.Results = append(results.Results, pinStatus(pin, st, delegates))
+			}
+		}
+	}
+	results.Count += len(candidates) - checked
+	sendJSONResponse(w, 200, results)
+}
+
+// statuses returns the status of the requests of the given pins. Those
+// which no peer reports are queued.
+func (api *API) statuses(r *http.Request, pins []types.PinSerial) (map[string]Status, error) {
+	cids := make([]string, 0, len(pins))
+	for _, pin := range pins {
+		cids = append(cids, pin.Cid)
+	}
+	var gpis []types.GlobalPinInfoSerial
+	err := api.rpcClient.CallContext(api.rpcContext(r), "", "Cluster", "StatusCids", cids, &gpis)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]Status, len(pins))
+	for _, c := range cids {
+		statuses[c] = StatusQueued
+	}
+	for _, gpi := range gpis {
+		statuses[gpi.Cid] = requestStatus(gpi)
+	}
+	return statuses, nil
+}
+
+func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
+	pin, ok := api.pinRequest(w, r)
+	if !ok {
+		return
+	}
+	sendJSONResponse(w, 202, pin)
+}
+
+func (api *API) getHandler(w http.ResponseWriter, r *http.Request) {
+	pin, ok := api.getPin(w, r)
+	if !ok {
+		return
+	}
+
+	var gpi types.GlobalPinInfoSerial
+	err := api.rpcClient.CallContext(api.rpcContext(r), "", "Cluster", "Status", pin, &gpi)
+	if err != nil {
+		sendFailure(w, 500, ReasonInternal, err.Error())
+		return
+	}
+	sendJSONResponse(w, 200, pinStatus(pin, requestStatus(gpi), api.delegates(r)))
+}
+
+func (api *API) replaceHandler(w http.ResponseWriter, r *http.Request) {
+	prev, ok := api.getPin(w, r)
+	if !ok {
+		return
+	}
+	pin, ok := api.pinRequest(w, r)
+	if !ok {
+		return
+	}
+	if pin.RequestID != prev.Cid {
+		err := api.rpcClient.CallContext(api.rpcContext(r), "", "Cluster", "Unpin", prev, &struct{}{})
+		if err != nil {
+			sendFailure(w, 500, ReasonInternal, "the new pin was added but the previous one could not be removed: "+err.Error())
+			return
+		}
+	}
+	sendJSONResponse(w, 202, pin)
+}
+
+func (api *API) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	pin, ok := api.getPin(w, r)
+	if !ok {
+		return
+	}
+	err := api.rpcClient.CallContext(api.rpcContext(r), "", "Cluster", "Unpin", pin, &struct{}{})
+	if err != nil {
+		sendFailure(w, 500, ReasonInternal, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// getPin returns the pin of the request ID in the URL of the request.
+// It returns false when an error response was sent.
+func (api *API) getPin(w http.ResponseWriter, r *http.Request) (types.PinSerial, bool) {
+	requestID := mux.Vars(r)["requestid"]
+	c, err := cid.Decode(requestID)
+	if err != nil {
+		sendFailure(w, 404, ReasonNotFound, "no pin request with this ID")
+		return types.PinSerial{}, false
+	}
+
+	var pin types.PinSerial
+	err = api.rpcClient.CallContext(api.rpcContext(r), "", "Cluster", "PinGet", types.PinCid(c).ToSerial(), &pin)
+	if err != nil || pin.Type == types.ShardType {
+		sendFailure(w, 404, ReasonNotFound, "no pin request with this ID")
+		return types.PinSerial{}, false
+	}
+	return pin, true
+}
+
+// pinRequest pins what the body of the request describes. It returns
+// false when an error response was sent.
+func (api *API) pinRequest(w http.ResponseWriter, r *http.Request) (PinStatus, bool) {
+	var req Pin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendFailure(w, 400, ReasonBadRequest, "error decoding the pin: "+err.Error())
+		return PinStatus{}, false
+	}
+	c, err := cid.Decode(req.Cid)
+	if err != nil {
+		sendFailure(w, 400, ReasonBadRequest, "invalid cid: "+req.Cid)
+		return PinStatus{}, false
+	}
+
+	pin := types.PinCid(c)
+	pin.Name = req.Name
+	pin.Metadata = req.Meta
+	pin.Providers = req.Origins
+	if err := pin.Validate(); err != nil {
+		sendFailure(w, 400, ReasonBadRequest, err.Error())
+		return PinStatus{}, false
+	}
+
+	var result types.PinResult
+	err = api.rpcClient.CallContext(api.rpcContext(r), "", "Cluster", "PinWithResult", pin.ToSerial(), &result)
+	if err != nil {
+		sendFailure(w, 500, ReasonInternal, err.Error())
+		return PinStatus{}, false
+	}
+	return pinStatus(result.Pin, StatusQueued, api.delegates(r)), true
+}
+
+// delegates returns the addresses of the IPFS daemon of the contacted
+// peer, which clients may connect to.
+func (api *API) delegates(r *http.Request) []string {
+	var id types.IDSerial
+	err := api.rpcClient.CallContext(api.rpcContext(r), "", "Cluster", "ID", struct{}{}, &id)
+	if err != nil {
+		logger.Error(err)
+		return []string{}
+	}
+	delegates := make([]string, 0, len(id.IPFS.Addresses))
+	for _, addr := range id.IPFS.Addresses {
+		delegates = append(delegates, string(addr))
+	}
+	return delegates
+}
+
+// pinStatus describes a pin as a pin request with the given status.
+func pinStatus(pin types.PinSerial, st Status, delegates []string) PinStatus {
+	return PinStatus{
+		RequestID: pin.Cid,
+		Status:    st,
+		Created:   time.Unix(0, pin.Timestamp).UTC(),
+		Pin: Pin{
+			Cid:     pin.Cid,
+			Name:    pin.Name,
+			Origins: pin.Providers,
+			Meta:    pin.Metadata,
+		},
+		Delegates: delegates,
+	}
+}
+
+func sendFailure(w http.ResponseWriter, code int, reason, details string) {
+	logger.Errorf("sending error response: %d: %s", code, details)
+	sendJSONResponse(w, code, Failure{
+		Error: FailureError{
+			Reason:  reason,
+			Details: details,
+		},
+	})
+}
+
+func sendJSONResponse(w http.ResponseWriter, code int, resp interface{}) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,238 @@
+package pinsvcapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const testToken = "secret"
+
+func testAPI(t *testing.T) *API {
+	apiMAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Enabled = true
+	cfg.HTTPListenAddr = apiMAddr
+	cfg.BearerTokens = map[string]string{testToken: "alice"}
+
+	api, err := NewAPI(cfg)
+	if err != nil {
+		t.Fatal("should be able to create a new Api: ", err)
+	}
+
+	// No keep alive for tests
+	api.server.SetKeepAlivesEnabled(false)
+	api.SetClient(test.NewMockRPCClient(t))
+	return api
+}
+
+func makeRequest(t *testing.T, api *API, method, path, token string, body interface{}, resp interface{}) int {
+	var reqBody []byte
+	if body != nil {
+		reqBody, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequest(method, "http://"+api.HTTPAddress()+path, bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("error making request: ", err)
+	}
+	defer httpResp.Body.Close()
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		t.Fatal("error reading body: ", err)
+	}
+	if len(respBody) != 0 && resp != nil {
+		if err := json.Unmarshal(respBody, resp); err != nil {
+			t.Error(string(respBody))
+			t.Fatal("error parsing json: ", err)
+		}
+	}
+	return httpResp.StatusCode
+}
+
+func TestAPIShutdown(t *testing.T) {
+	api := testAPI(t)
+	err := api.Shutdown()
+	if err != nil {
+		t.Error("should shutdown cleanly: ", err)
+	}
+	// test shutting down twice
+	api.Shutdown()
+}
+
+func TestAPIListPins(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	var results PinResults
+	code := makeRequest(t, api, "GET", "/pins", testToken, nil, &results)
+	if code != 200 || results.Count != 3 || len(results.Results) != 3 {
+		t.Fatal("expected the three pinned requests:", code, results)
+	}
+	if len(results.Results[0].Delegates) != 1 {
+		t.Error("expected a delegate:", results.Results[0].Delegates)
+	}
+
+	results = PinResults{}
+	makeRequest(t, api, "GET", "/pins?limit=2", testToken, nil, &results)
+	if results.Count != 3 || len(results.Results) != 2 {
+		t.Error("expected a count of 3 and 2 results:", results)
+	}
+
+	results = PinResults{}
+	makeRequest(t, api, "GET", "/pins?name=DATA&match=ipartial", testToken, nil, &results)
+	if results.Count != 1 || results.Results[0].RequestID != test.TestCid2 {
+		t.Error("expected the dataset pin:", results)
+	}
+
+	results = PinResults{}
+	makeRequest(t, api, "GET", "/pins?meta="+url.QueryEscape(`{"owner":"bob"}`), testToken, nil, &results)
+	if results.Count != 0 || results.Results == nil {
+		t.Error("expected an empty list:", results)
+	}
+
+	results = PinResults{}
+	makeRequest(t, api, "GET", "/pins?cid="+test.TestCid1+","+test.TestCid3, testToken, nil, &results)
+	if results.Count != 2 {
+		t.Error("expected two results:", results)
+	}
+
+	results = PinResults{}
+	makeRequest(t, api, "GET", "/pins?status=queued,failed", testToken, nil, &results)
+	if results.Count != 0 {
+		t.Error("all the requests are pinned:", results)
+	}
+
+	for _, q := range []string{"limit=0", "status=bad", "match=bad", "cid=abc", "before=yesterday", "meta=abc"} {
+		var failure Failure
+		code := makeRequest(t, api, "GET", "/pins?"+q, testToken, nil, &failure)
+		if code != 400 || failure.Error.Reason != ReasonBadRequest {
+			t.Errorf("%s: expected a bad request: %d %+v", q, code, failure)
+		}
+	}
+}
+
+func TestAPIAddPin(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	var status PinStatus
+	pin := Pin{
+		Cid:     test.TestCid1,
+		Name:    "dataset",
+		Origins: []string{"/ip4/1.2.3.4/tcp/4001"},
+		Meta:    map[string]string{"a": "b"},
+	}
+	code := makeRequest(t, api, "POST", "/pins", testToken, pin, &status)
+	if code != 202 {
+		t.Fatal("expected 202:", code)
+	}
+	if status.RequestID != test.TestCid1 ||
+		status.Status != StatusQueued ||
+		status.Pin.Name != "dataset" ||
+		len(status.Pin.Origins) != 1 ||
+		status.Pin.Meta["a"] != "b" {
+		t.Error("unexpected pin status:", status)
+	}
+
+	var failure Failure
+	code = makeRequest(t, api, "POST", "/pins", testToken, Pin{Cid: "abc"}, &failure)
+	if code != 400 || failure.Error.Reason != ReasonBadRequest {
+		t.Error("expected a bad request:", code, failure)
+	}
+
+	badOrigins := Pin{Cid: test.TestCid1, Origins: []string{"1.2.3.4:4001"}}
+	code = makeRequest(t, api, "POST", "/pins", testToken, badOrigins, &failure)
+	if code != 400 || failure.Error.Reason != ReasonBadRequest {
+		t.Error("expected a bad request with invalid origins:", code, failure)
+	}
+
+	code = makeRequest(t, api, "POST", "/pins", testToken, Pin{Cid: test.ErrorCid}, &failure)
+	if code != 500 {
+		t.Error("expected an error:", code)
+	}
+}
+
+func TestAPIGetPin(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	var status PinStatus
+	code := makeRequest(t, api, "GET", "/pins/"+test.TestCid1, testToken, nil, &status)
+	if code != 200 || status.RequestID != test.TestCid1 || status.Status != StatusPinned {
+		t.Error("unexpected pin status:", code, status)
+	}
+
+	var failure Failure
+	code = makeRequest(t, api, "GET", "/pins/"+test.ErrorCid, testToken, nil, &failure)
+	if code != 404 || failure.Error.Reason != ReasonNotFound {
+		t.Error("expected not found:", code, failure)
+	}
+}
+
+func TestAPIReplacePin(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	var status PinStatus
+	code := makeRequest(t, api, "POST", "/pins/"+test.TestCid1, testToken, Pin{Cid: test.TestCid2}, &status)
+	if code != 202 || status.RequestID != test.TestCid2 {
+		t.Error("unexpected pin status:", code, status)
+	}
+
+	code = makeRequest(t, api, "POST", "/pins/"+test.ErrorCid, testToken, Pin{Cid: test.TestCid2}, nil)
+	if code != 404 {
+		t.Error("expected not found:", code)
+	}
+}
+
+func TestAPIDeletePin(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	code := makeRequest(t, api, "DELETE", "/pins/"+test.TestCid1, testToken, nil, nil)
+	if code != 202 {
+		t.Error("expected 202:", code)
+	}
+
+	code = makeRequest(t, api, "DELETE", "/pins/"+test.ErrorCid, testToken, nil, nil)
+	if code != 404 {
+		t.Error("expected not found:", code)
+	}
+}
+
+func TestAPIBearerAuth(t *testing.T) {
+	api := testAPI(t)
+	defer api.Shutdown()
+
+	var failure Failure
+	code := makeRequest(t, api, "GET", "/pins", "", nil, &failure)
+	if code != 401 || failure.Error.Reason != ReasonUnauthorized {
+		t.Error("expected unauthorized:", code, failure)
+	}
+
+	code = makeRequest(t, api, "GET", "/pins", "wrong", nil, nil)
+	if code != 401 {
+		t.Error("expected unauthorized:", code)
+	}
+
+	code = makeRequest(t, api, "GET", "/pins", testToken, nil, nil)
+	if code != 200 {
+		t.Error("expected 200 with a valid token:", code)
+	}
+}
@@ -0,0 +1,91 @@
+package pinsvcapi
+
+import (
+	"time"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+)
+
+// The objects of the IPFS Pinning Service API specification
+// (https://ipfs.github.io/pinning-services-api-spec/).
+
+// Status is the status of a pin request.
+type Status string
+
+// Pin request statuses.
+const (
+	StatusQueued  Status = "queued"
+	StatusPinning Status = "pinning"
+	StatusPinned  Status = "pinned"
+	StatusFailed  Status = "failed"
+)
+
+// Pin describes what a pin request asks to pin. Origins are stored as the
+// providers of the pin.
+type Pin struct {
+	Cid     string            `json:"cid"`
+	Name    string            `json:"name,omitempty"`
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// PinStatus describes a pin request and its current status.
+type PinStatus struct {
+	RequestID string    `json:"requestid"`
+	Status    Status    `json:"status"`
+	Created   time.Time `json:"created"`
+	Pin       Pin       `json:"pin"`
+	Delegates []string  `json:"delegates"`
+}
+
+// PinResults is the response to a listing of pin requests. Count is the
+// total number of matching requests, of which at most the requested
+// limit are returned. Only the statuses needed to fill the page are
+// checked: the other requests are counted as matching the status filter.
+type PinResults struct {
+	Count   int         `json:"count"`
+	Results []PinStatus `json:"results"`
+}
+
+// Failure is the body of the error responses.
+type Failure struct {
+	Error FailureError `json:"error"`
+}
+
+// FailureError describes an error.
+type FailureError struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+}
+
+// requestStatus summarizes the statuses of a Cid in the cluster peers:
+// pinned when any allocated peer has it pinned, failed when they all
+// failed, and pinning or queued otherwise.
+func requestStatus(gpi types.GlobalPinInfoSerial) Status {
+	var pinning, queued, failed, tracked int
+	for _, info := range gpi.PeerMap {
+		switch types.TrackerStatusFromString(info.Status) {
+		case types.TrackerStatusPinned:
+			return StatusPinned
+		case types.TrackerStatusPinning:
+			pinning++
+		case types.TrackerStatusPinQueued:
+			queued++
+		case types.TrackerStatusPinError, types.TrackerStatusClusterError:
+			failed++
+		case types.TrackerStatusRemote:
+			continue
+		}
+		tracked++
+	}
+	switch {
+	case pinning > 0:
+		return StatusPinning
+	case queued > 0:
+		return StatusQueued
+	case tracked > 0 && failed == tracked:
+		return StatusFailed
+	default:
+		return StatusQueued
+	}
+}
@@ -0,0 +1,35 @@
+package pinsvcapi
+
+import (
+	"strconv"
+	"testing"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+)
+
+func TestRequestStatus(t *testing.T) {
+	gpi := func(statuses ...types.TrackerStatus) types.GlobalPinInfoSerial {
+		g := types.GlobalPinInfoSerial{PeerMap: make(map[string]types.PinInfoSerial)}
+		for i, st := range statuses {
+			g.PeerMap["peer"+strconv.Itoa(i)] = types.PinInfoSerial{Status: st.String()}
+		}
+		return g
+	}
+
+	cases := []struct {
+		gpi      types.GlobalPinInfoSerial
+		expected Status
+	}{
+		{gpi(), StatusQueued},
+		{gpi(types.TrackerStatusPinError, types.TrackerStatusPinned), StatusPinned},
+		{gpi(types.TrackerStatusPinError, types.TrackerStatusPinning), StatusPinning},
+		{gpi(types.TrackerStatusPinQueued, types.TrackerStatusRemote), StatusQueued},
+		{gpi(types.TrackerStatusPinError, types.TrackerStatusRemote), StatusFailed},
+		{gpi(types.TrackerStatusRemote), StatusQueued},
+	}
+	for i, c := range cases {
+		if st := requestStatus(c.gpi); st != c.expected {
+			t.Errorf("%d: expected %s, got %s", i, c.expected, st)
+		}
+	}
+}
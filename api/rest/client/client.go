@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/ipfs/ipfs-cluster/api"
+
 	shell "github.com/ipfs/go-ipfs-api"
 	logging "github.com/ipfs/go-log"
 	host "github.com/libp2p/go-libp2p-host"
@@ -17,10 +20,11 @@ import (
 
 // Configuration defaults
 var (
-	DefaultTimeout   = 120 * time.Second
-	DefaultAPIAddr   = "/ip4/127.0.0.1/tcp/9094"
-	DefaultLogLevel  = "info"
-	DefaultProxyPort = 9095
+	DefaultTimeout     = 120 * time.Second
+	DefaultAPIAddr     = "/ip4/127.0.0.1/tcp/9094"
+	DefaultAPIAddrIPv6 = "/ip6/::1/tcp/9094"
+	DefaultLogLevel    = "info"
+	DefaultProxyPort   = 9095
 )
 
 var loggingFacility = "apiclient"
@@ -64,9 +68,17 @@ type Config struct {
 	// and the port used will be ipfs-cluster's proxy default port (9095)
 	ProxyAddr ma.Multiaddr
 
-	// Define timeout for network operations
+	// Define timeout for network operations. It applies to every
+	// request (and retry) and it is sent to the API, which cancels the
+	// operations made to serve the request once it has expired.
 	Timeout time.Duration
 
+	// Retries is how many times a request is retried when the API
+	// cannot be reached or answers that it is unavailable (with a 502,
+	// 503 or 504 status). Only idempotent requests (GET, HEAD,
+	// OPTIONS, PUT and DELETE) without a streamed body are retried.
+	Retries int
+
 	// Specifies if we attempt to re-use connections to the same
 	// hosts.
 	DisableKeepAlives bool
@@ -151,7 +163,9 @@ func (c *Client) setupHostname() error {
 	// When no host/port/multiaddress defined, we set the default
 	if c.config.APIAddr == nil && c.config.Host == "" && c.config.Port == "" {
 		var err error
-		c.config.APIAddr, err = ma.NewMultiaddr(DefaultAPIAddr)
+		c.config.APIAddr, err = ma.NewMultiaddr(
+			api.PreferredAddr(DefaultAPIAddr, DefaultAPIAddrIPv6),
+		)
 		if err != nil {
 			return err
 		}
@@ -167,20 +181,18 @@ func (c *Client) setupHostname() error {
 		// Resolve multiaddress just in case and extract host:port
 		resolveCtx, cancel := context.WithTimeout(c.ctx, c.config.Timeout)
 		defer cancel()
-		resolved, err := madns.Resolve(resolveCtx, c.config.APIAddr)
+		resolved, err := resolveAddr(resolveCtx, c.config.APIAddr)
 		if err != nil {
 			return err
 		}
-		c.config.APIAddr = resolved[0]
+		c.config.APIAddr = resolved
 		_, c.hostname, err = manet.DialArgs(c.config.APIAddr)
 		if err != nil {
 			return err
 		}
 	default:
-		c.hostname = fmt.Sprintf("%s:%s", c.config.Host, c.config.Port)
-		apiAddr, err := ma.NewMultiaddr(
-			fmt.Sprintf("/ip4/%s/tcp/%s", c.config.Host, c.config.Port),
-		)
+		c.hostname = net.JoinHostPort(c.config.Host, c.config.Port)
+		apiAddr, err := hostPortMultiaddr(c.config.Host, c.config.Port)
 		if err != nil {
 			return err
 		}
@@ -211,15 +223,44 @@ func (c *Client) setupProxy() error {
 
 	ctx, cancel := context.WithTimeout(c.ctx, c.config.Timeout)
 	defer cancel()
-	resolved, err := madns.Resolve(ctx, paddr)
+	resolved, err := resolveAddr(ctx, paddr)
 	if err != nil {
 		return err
 	}
 
-	c.config.ProxyAddr = resolved[0]
+	c.config.ProxyAddr = resolved
 	return nil
 }
 
+// resolveAddr resolves a DNS multiaddress and returns the preferred
+// address among the results (see api.SortMultiaddrs).
+func resolveAddr(ctx context.Context, addr ma.Multiaddr) (ma.Multiaddr, error) {
+	resolved, err := madns.Resolve(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(resolved) == 0 {
+		return nil, fmt.Errorf("%s could not be resolved", addr)
+	}
+	api.SortMultiaddrs(resolved)
+	return resolved[0], nil
+}
+
+// hostPortMultiaddr builds a multiaddress from the Host and Port options,
+// which may be an IPv4 or IPv6 address or a hostname.
+func hostPortMultiaddr(host, port string) (ma.Multiaddr, error) {
+	proto := "dns4"
+	if ip := net.ParseIP(host); ip != nil {
+		proto = "ip6"
+		if ip.To4() != nil {
+			proto = "ip4"
+		}
+	} else if !api.IPv4Available(host == "localhost") {
+		proto = "dns6"
+	}
+	return ma.NewMultiaddr(fmt.Sprintf("/%s/%s/tcp/%s", proto, host, port))
+}
+
 // IPFS returns an instance of go-ipfs-api's Shell, pointing to the
 // configured ProxyAddr (or to the default ipfs-cluster's IPFS proxy port).
 // It re-uses this Client's HTTP client, thus will be constrained by
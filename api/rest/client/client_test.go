@@ -3,9 +3,15 @@ package client
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/api/rest"
 	"github.com/ipfs/ipfs-cluster/test"
 
@@ -165,6 +171,77 @@ func TestHostPort(t *testing.T) {
 	}
 }
 
+func TestRetries(t *testing.T) {
+	retryDelay = 10 * time.Millisecond
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(api.RequestTimeoutHeader) != "5s" {
+			t.Error("the timeout should be sent:", r.Header.Get(api.RequestTimeoutHeader))
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"version": "0.0.0"}`))
+	}))
+	defer srv.Close()
+
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	newClient := func(retries int) *Client {
+		c, err := NewClient(&Config{
+			Host:              host,
+			Port:              port,
+			Timeout:           5 * time.Second,
+			Retries:           retries,
+			DisableKeepAlives: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if _, err := newClient(1).Version(); err == nil {
+		t.Error("expected an error after a single retry")
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	v, err := newClient(2).Version()
+	if err != nil {
+		t.Fatal("expected the request to succeed on the last retry:", err)
+	}
+	if v.Version != "0.0.0" || atomic.LoadInt32(&calls) != 3 {
+		t.Error("unexpected response:", v, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	newClient(2).do("POST", "/version", nil, nil)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("POST requests should not be retried:", n)
+	}
+}
+
+func TestHostPortIPv6(t *testing.T) {
+	cfg := &Config{
+		APIAddr:           nil,
+		Host:              "::1",
+		Port:              "9094",
+		DisableKeepAlives: true,
+	}
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.hostname != "[::1]:9094" {
+		t.Error("Host Port should be used")
+	}
+
+	if c.config.ProxyAddr == nil || c.config.ProxyAddr.String() != "/ip6/::1/tcp/9095" {
+		t.Error("proxy address was not guessed correctly")
+	}
+}
+
 func TestDNSMultiaddress(t *testing.T) {
 	addr2, _ := ma.NewMultiaddr("/dns4/localhost/tcp/1234")
 	cfg := &Config{
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// multipartFiles streams the given files and directories, recursively,
+// as a multipart/form-data body as accepted by "ipfs add". Every file and
+// directory is a part named after its path, directories having the
+// "application/x-directory" content type. It returns the body and its
+// content type. Errors reading the files are returned when reading the
+// body.
+func multipartFiles(paths []string) (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		for _, path := range paths {
+			if err := writeMultipartPath(mw, path); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+	return pr, mw.FormDataContentType()
+}
+
+// writeMultipartPath writes a file or a directory and its contents. The
+// names of the parts are relative to the parent of the given path.
+func writeMultipartPath(mw *multipart.Writer, path string) error {
+	parent := filepath.Dir(filepath.Clean(path))
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(parent, p)
+		if err != nil {
+			return err
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition",
+			fmt.Sprintf(`form-data; name="file"; filename="%s"`, url.QueryEscape(filepath.ToSlash(name))))
+		switch {
+		case info.IsDir():
+			header.Set("Content-Type", "application/x-directory")
+			_, err = mw.CreatePart(header)
+			return err
+		case info.Mode().IsRegular():
+			header.Set("Content-Type", "application/octet-stream")
+			w, err := mw.CreatePart(header)
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		default:
+			return fmt.Errorf("%s is not a regular file nor a directory", p)
+		}
+	})
+}
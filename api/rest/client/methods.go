@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
+	"strings"
 	"time"
 
 	cid "github.com/ipfs/go-cid"
@@ -37,6 +39,10 @@ type peerAddBody struct {
 	Addr string `json:"peer_multiaddress"`
 }
 
+type statusCidsBody struct {
+	Cids []string `json:"cids"`
+}
+
 // PeerAdd adds a new peer to the cluster.
 func (c *Client) PeerAdd(addr ma.Multiaddr) (api.ID, error) {
 	addrStr := addr.String()
@@ -51,28 +57,171 @@ func (c *Client) PeerAdd(addr ma.Multiaddr) (api.ID, error) {
 	return id.ToID(), err
 }
 
+type pushMetricBody struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	TTL   string `json:"ttl"`
+}
+
+// PushMetric sends a custom metric for the peer, valid during the given
+// ttl. Custom metrics can be used for allocations.
+func (c *Client) PushMetric(name, value string, ttl time.Duration) error {
+	body := pushMetricBody{
+		Name:  name,
+		Value: value,
+		TTL:   ttl.String(),
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(body)
+
+	return c.do("POST", "/monitor/metrics", &buf, nil)
+}
+
 // PeerRm removes a current peer from the cluster
 func (c *Client) PeerRm(id peer.ID) error {
 	return c.do("DELETE", fmt.Sprintf("/peers/%s", id.Pretty()), nil, nil)
 }
 
+// AnnotatePeer sets a free-form annotation (location, contact...) for a
+// peer, which is kept in the shared state. An empty annotation removes it.
+func (c *Client) AnnotatePeer(id peer.ID, annotation string) error {
+	path := fmt.Sprintf("/peers/%s/annotation", id.Pretty())
+	if annotation == "" {
+		return c.do("DELETE", path, nil, nil)
+	}
+	return c.do("PUT", path, strings.NewReader(annotation), nil)
+}
+
 // Pin tracks a Cid with the given replication factor and a name for
-// human-friendliness.
+// human-friendliness. Use PinWithOptions to set any other option.
 func (c *Client) Pin(ci *cid.Cid, replicationFactorMin, replicationFactorMax int, name string) error {
-	escName := url.QueryEscape(name)
-	err := c.do(
-		"POST",
-		fmt.Sprintf(
-			"/pins/%s?replication_factor_min=%d&replication_factor_max=%d&name=%s",
-			ci.String(),
-			replicationFactorMin,
-			replicationFactorMax,
-			escName,
-		),
-		nil,
-		nil,
+	return c.PinWithOptions(api.Pin{
+		Cid:                  ci,
+		Name:                 name,
+		ReplicationFactorMin: replicationFactorMin,
+		ReplicationFactorMax: replicationFactorMax,
+	})
+}
+
+// PinWithOptions tracks the Cid of the given pin with all its options:
+// replication factors, name, allowed and excluded peers, priority,
+// expiration, metadata and max depth. Allocations are ignored. The pin
+// is recursive: use PinDirect to pin only the Cid itself.
+func (c *Client) PinWithOptions(pin api.Pin) error {
+	path := fmt.Sprintf("/pins/%s?%s", pin.Cid.String(), pinOptionsQuery(pin))
+	return c.do("POST", path, nil, nil)
+}
+
+// PinDirect works like PinWithOptions, but only the Cid itself is pinned,
+// not the DAG under it. The max depth is ignored.
+func (c *Client) PinDirect(pin api.Pin) error {
+	pin.MaxDepth = 0
+	path := fmt.Sprintf("/pins/%s?%s&mode=direct", pin.Cid.String(), pinOptionsQuery(pin))
+	return c.do("POST", path, nil, nil)
+}
+
+// PinOverwrite works like PinWithOptions, or like PinDirect for a
+// non-recursive pin, but the options of an existing pin are replaced with
+// the given ones regardless of the pin_merge_policy of the cluster.
+func (c *Client) PinOverwrite(pin api.Pin) error {
+	path := fmt.Sprintf("/pins/%s?%s&overwrite=true", pin.Cid.String(), pinOptionsQuery(pin))
+	if !pin.Recursive {
+		path += "&mode=direct"
+	}
+	return c.do("POST", path, nil, nil)
+}
+
+// pinOptionsQuery encodes the options of a pin as query parameters.
+func pinOptionsQuery(pin api.Pin) string {
+	query := fmt.Sprintf(
+		"replication_factor_min=%d&replication_factor_max=%d&name=%s",
+		pin.ReplicationFactorMin,
+		pin.ReplicationFactorMax,
+		url.QueryEscape(pin.Name),
 	)
-	return err
+	if len(pin.AllowPeers) > 0 {
+		query += "&allow_peers=" + strings.Join(api.PeersToStrings(pin.AllowPeers), ",")
+	}
+	if len(pin.ExcludePeers) > 0 {
+		query += "&exclude_peers=" + strings.Join(api.PeersToStrings(pin.ExcludePeers), ",")
+	}
+	if pin.Priority != "" && pin.Priority != api.PinPriorityNormal {
+		query += "&priority=" + url.QueryEscape(string(pin.Priority))
+	}
+	if !pin.ExpireAt.IsZero() {
+		query += "&expire_at=" + url.QueryEscape(pin.ExpireAt.Format(time.RFC3339))
+	}
+	if pin.MaxDepth > 0 {
+		query += fmt.Sprintf("&max_depth=%d", pin.MaxDepth)
+	}
+	return query + metadataQuery(pin.Metadata)
+}
+
+// metadataQuery encodes pin metadata as "&meta-<key>=<value>" query
+// parameters.
+func metadataQuery(metadata map[string]string) string {
+	query := ""
+	for k, v := range metadata {
+		query += "&" + url.QueryEscape("meta-"+k) + "=" + url.QueryEscape(v)
+	}
+	return query
+}
+
+// Add imports the given local files and directories, recursively, in the
+// IPFS daemon of the cluster peer and pins the roots of the imported
+// content with the options of the given pin, whose Cid is ignored. The
+// params set how the content is chunked and hashed. It returns the
+// imported items.
+func (c *Client) Add(paths []string, params api.AddParams, pin api.Pin) ([]api.AddedOutput, error) {
+	query := pinOptionsQuery(pin)
+	if params.Chunker != "" {
+		query += "&chunker=" + url.QueryEscape(params.Chunker)
+	}
+	if params.CidVersion > 0 {
+		query += fmt.Sprintf("&cid_version=%d", params.CidVersion)
+	}
+	if params.Hash != "" {
+		query += "&hash=" + url.QueryEscape(params.Hash)
+	}
+	if params.RawLeaves {
+		query += "&raw_leaves=true"
+	}
+	if params.WrapWithDirectory {
+		query += "&wrap_with_directory=true"
+	}
+	if params.Shard {
+		query += "&shard=true"
+	}
+	if params.ShardSize > 0 {
+		query += fmt.Sprintf("&shard_size=%d", params.ShardSize)
+	}
+
+	body, contentType := multipartFiles(paths)
+	defer body.Close()
+	var added []api.AddedOutput
+	err := c.doContentType("POST", "/add?"+query, contentType, body, &added)
+	return added, err
+}
+
+// ImportCAR imports the blocks of a CAR file (version 1) in the IPFS
+// daemon of the cluster peer and pins its roots with the options of the
+// given pin, whose Cid is ignored. It returns the pins of the roots.
+func (c *Client) ImportCAR(car io.Reader, pin api.Pin) ([]api.Pin, error) {
+	var pins []api.PinSerial
+	path := "/car?" + pinOptionsQuery(pin)
+	err := c.doContentType("POST", path, "application/vnd.ipld.car", car, &pins)
+	result := make([]api.Pin, len(pins))
+	for i, p := range pins {
+		result[i] = p.ToPin()
+	}
+	return result, err
+}
+
+// ExportCAR writes the DAG of a pinned Cid to w as a CAR file.
+func (c *Client) ExportCAR(ci *cid.Cid, w io.Writer) error {
+	return c.do("GET", fmt.Sprintf("/pins/%s/car", ci.String()), nil, w)
 }
 
 // Unpin untracks a Cid from cluster.
@@ -80,11 +229,59 @@ func (c *Client) Unpin(ci *cid.Cid) error {
 	return c.do("DELETE", fmt.Sprintf("/pins/%s", ci.String()), nil, nil)
 }
 
+// PinUpdate pins the Cid "to" with the options and allocations of the
+// existing pin of "from", so that peers only fetch the differences
+// between both. "from" is unpinned afterwards when unpinFrom is set. It
+// returns the new pin.
+func (c *Client) PinUpdate(from, to *cid.Cid, unpinFrom bool) (api.Pin, error) {
+	var pin api.PinSerial
+	path := fmt.Sprintf("/pins/%s/update/%s?unpin=%t", from.String(), to.String(), unpinFrom)
+	err := c.do("POST", path, nil, &pin)
+	return pin.ToPin(), err
+}
+
+// Unquarantine makes the cluster accept again the metrics from a peer
+// which was quarantined for sending persistently invalid metrics.
+func (c *Client) Unquarantine(p peer.ID) error {
+	return c.do("DELETE", fmt.Sprintf("/monitor/quarantine/%s", peer.IDB58Encode(p)), nil, nil)
+}
+
+// FailPeer makes the cluster consider the given peer as failed during the
+// given time. It is used to rehearse failure handling and requires the
+// debug operations to be enabled in the cluster peer.
+func (c *Client) FailPeer(p peer.ID, d time.Duration) error {
+	path := fmt.Sprintf("/debug/fail-peer/%s?duration=%s", peer.IDB58Encode(p), url.QueryEscape(d.String()))
+	return c.do("POST", path, nil, nil)
+}
+
+// StrayPins returns the items pinned in the IPFS daemons of the cluster
+// peers which are not allocated to them.
+func (c *Client) StrayPins() ([]api.StrayPin, error) {
+	var strays []api.StrayPin
+	err := c.do("GET", "/pins/stray", nil, &strays)
+	return strays, err
+}
+
+// RemediateStrayPin applies an action (adopt, ignore or remove) to an
+// item reported as stray by the given peer.
+func (c *Client) RemediateStrayPin(p peer.ID, ci *cid.Cid, action api.StrayPinAction) error {
+	path := fmt.Sprintf("/pins/stray/%s/%s?action=%s", peer.IDB58Encode(p), ci.String(), url.QueryEscape(string(action)))
+	return c.do("POST", path, nil, nil)
+}
+
 // Allocations returns the consensus state listing all tracked items and
 // the peers that should be pinning them.
 func (c *Client) Allocations() ([]api.Pin, error) {
+	return c.AllocationsFiltered("", nil)
+}
+
+// AllocationsFiltered works like Allocations, but only returns the pins
+// whose name contains the given one (when not empty) and whose metadata
+// has all the given key-value pairs.
+func (c *Client) AllocationsFiltered(name string, metadata map[string]string) ([]api.Pin, error) {
 	var pins []api.PinSerial
-	err := c.do("GET", "/allocations", nil, &pins)
+	path := "/allocations?name=" + url.QueryEscape(name) + metadataQuery(metadata)
+	err := c.do("GET", path, nil, &pins)
 	result := make([]api.Pin, len(pins))
 	for i, p := range pins {
 		result[i] = p.ToPin()
@@ -99,6 +296,43 @@ func (c *Client) Allocation(ci *cid.Cid) (api.Pin, error) {
 	return pin.ToPin(), err
 }
 
+// AllocationPreview returns the allocations that pinning a Cid with the
+// given replication factors would have, without pinning it.
+func (c *Client) AllocationPreview(ci *cid.Cid, replicationFactorMin, replicationFactorMax int) (api.Pin, error) {
+	var pin api.PinSerial
+	path := fmt.Sprintf(
+		"/allocations/preview?cid=%s&replication_factor_min=%d&replication_factor_max=%d",
+		ci.String(),
+		replicationFactorMin,
+		replicationFactorMax,
+	)
+	err := c.do("POST", path, nil, &pin)
+	return pin.ToPin(), err
+}
+
+// AllocationHistory returns the changes of the allocations of a Cid made
+// by the cluster peers, oldest first.
+func (c *Client) AllocationHistory(ci *cid.Cid) ([]api.AllocationChange, error) {
+	var history []api.AllocationChange
+	err := c.do("GET", fmt.Sprintf("/allocations/%s/history", ci.String()), nil, &history)
+	return history, err
+}
+
+// PinEstimate returns the size of a Cid, the space that pinning it with
+// the given replication factors would use and whether it can be pinned,
+// without pinning it.
+func (c *Client) PinEstimate(ci *cid.Cid, replicationFactorMin, replicationFactorMax int) (api.PinEstimate, error) {
+	var est api.PinEstimate
+	path := fmt.Sprintf(
+		"/pins/%s/estimate?replication_factor_min=%d&replication_factor_max=%d",
+		ci.String(),
+		replicationFactorMin,
+		replicationFactorMax,
+	)
+	err := c.do("POST", path, nil, &est)
+	return est, err
+}
+
 // Status returns the current ipfs state for a given Cid. If local is true,
 // the information affects only the current peer, otherwise the information
 // is fetched from all cluster peers.
@@ -110,8 +344,44 @@ func (c *Client) Status(ci *cid.Cid, local bool) (api.GlobalPinInfo, error) {
 
 // StatusAll gathers Status() for all tracked items.
 func (c *Client) StatusAll(local bool) ([]api.GlobalPinInfo, error) {
+	return c.StatusAllFiltered(local, true)
+}
+
+// StatusAllFiltered works like StatusAll. When remote is false, the
+// entries of the peers which are not allocated the items (REMOTE status)
+// are left out, along with the items which have no other entries.
+func (c *Client) StatusAllFiltered(local, remote bool) ([]api.GlobalPinInfo, error) {
 	var gpis []api.GlobalPinInfoSerial
-	err := c.do("GET", fmt.Sprintf("/pins?local=%t", local), nil, &gpis)
+	err := c.do("GET", fmt.Sprintf("/pins?local=%t&remote=%t", local, remote), nil, &gpis)
+	result := make([]api.GlobalPinInfo, len(gpis))
+	for i, p := range gpis {
+		result[i] = p.ToGlobalPinInfo()
+	}
+	return result, err
+}
+
+// StatusCids returns the current ipfs state for the given Cids, fetched
+// with a single request. If local is true, the information affects only
+// the current peer, otherwise the information is fetched from all cluster
+// peers.
+func (c *Client) StatusCids(cids []*cid.Cid, local bool) ([]api.GlobalPinInfo, error) {
+	return c.StatusCidsFiltered(cids, local, true)
+}
+
+// StatusCidsFiltered works like StatusCids, leaving out the REMOTE
+// entries when remote is false (see StatusAllFiltered).
+func (c *Client) StatusCidsFiltered(cids []*cid.Cid, local, remote bool) ([]api.GlobalPinInfo, error) {
+	body := statusCidsBody{make([]string, len(cids))}
+	for i, ci := range cids {
+		body.Cids[i] = ci.String()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(body)
+
+	var gpis []api.GlobalPinInfoSerial
+	err := c.do("POST", fmt.Sprintf("/pins/status?local=%t&remote=%t", local, remote), &buf, &gpis)
 	result := make([]api.GlobalPinInfo, len(gpis))
 	for i, p := range gpis {
 		result[i] = p.ToGlobalPinInfo()
@@ -151,6 +421,14 @@ func (c *Client) Recover(ci *cid.Cid, local bool) (api.GlobalPinInfo, error) {
 	return gpi.ToGlobalPinInfo(), err
 }
 
+// PinHistory returns the last pin and unpin attempts made by the cluster
+// peers on a Cid, oldest first.
+func (c *Client) PinHistory(ci *cid.Cid) ([]api.PinAttempt, error) {
+	var history []api.PinAttempt
+	err := c.do("GET", fmt.Sprintf("/pins/%s/history", ci.String()), nil, &history)
+	return history, err
+}
+
 // RecoverAll triggers Recover() operations on all tracked items. If local is
 // true, the operation is limited to the current peer. Otherwise, it happens
 // everywhere.
@@ -171,6 +449,61 @@ func (c *Client) Version() (api.Version, error) {
 	return ver, err
 }
 
+// Features lists, for every feature advertised by some cluster peer,
+// which peers advertise it.
+func (c *Client) Features() ([]api.FeatureSupport, error) {
+	var support []api.FeatureSupport
+	err := c.do("GET", "/features", nil, &support)
+	return support, err
+}
+
+// Shutdown stops the cluster peer. When all is set, all the cluster peers
+// are stopped in an orderly way instead.
+func (c *Client) Shutdown(all bool) error {
+	return c.do("POST", fmt.Sprintf("/shutdown?all=%t", all), nil, nil)
+}
+
+// Events returns the events recorded by the cluster peer which
+// happened after the given time. A zero time returns all of them.
+func (c *Client) Events(since time.Time) ([]api.Event, error) {
+	var events []api.Event
+	path := "/events"
+	if !since.IsZero() {
+		path += "?since=" + url.QueryEscape(since.Format(time.RFC3339))
+	}
+	err := c.do("GET", path, nil, &events)
+	return events, err
+}
+
+// MetricsHistory returns the metrics of the given name received from a peer
+// after the given time, ordered from oldest to newest.
+func (c *Client) MetricsHistory(name string, p peer.ID, since time.Time) ([]api.Metric, error) {
+	var serials []api.MetricSerial
+	path := fmt.Sprintf("/monitor/metrics/%s/%s", url.PathEscape(name), peer.IDB58Encode(p))
+	if !since.IsZero() {
+		path += "?since=" + url.QueryEscape(since.Format(time.RFC3339))
+	}
+	err := c.do("GET", path, nil, &serials)
+	return serialsToMetrics(serials), err
+}
+
+// LastMetrics returns the latest valid metrics of the given name for the
+// current cluster peers. These are the metrics used to make allocations.
+func (c *Client) LastMetrics(name string) ([]api.Metric, error) {
+	var serials []api.MetricSerial
+	path := fmt.Sprintf("/monitor/metrics/%s", url.PathEscape(name))
+	err := c.do("GET", path, nil, &serials)
+	return serialsToMetrics(serials), err
+}
+
+func serialsToMetrics(serials []api.MetricSerial) []api.Metric {
+	metrics := make([]api.Metric, len(serials), len(serials))
+	for i, s := range serials {
+		metrics[i] = s.ToMetric()
+	}
+	return metrics
+}
+
 // GetConnectGraph returns an ipfs-cluster connection graph.
 // The serialized version, strings instead of pids, is returned
 func (c *Client) GetConnectGraph() (api.ConnectGraphSerial, error) {
@@ -179,6 +512,21 @@ func (c *Client) GetConnectGraph() (api.ConnectGraphSerial, error) {
 	return graphS, err
 }
 
+// RaftHealth returns the state of the Raft consensus in the peer.
+func (c *Client) RaftHealth() (api.RaftHealth, error) {
+	var health api.RaftHealth
+	err := c.do("GET", "/health/raft", nil, &health)
+	return health, err
+}
+
+// PinQueue returns the pin and unpin operations queued in the peer and
+// the unpins waiting for a garbage collection of the IPFS repository.
+func (c *Client) PinQueue() (api.PinQueue, error) {
+	var queue api.PinQueue
+	err := c.do("GET", "/pins/queue", nil, &queue)
+	return queue, err
+}
+
 // WaitFor is a utility function that allows for a caller to
 // wait for a paticular status for a CID. It returns a channel
 // upon which the caller can wait for the targetStatus.
@@ -302,3 +650,51 @@ func statusReached(target api.TrackerStatus, gblPinInfo api.GlobalPinInfo) (bool
 	}
 	return true, nil
 }
+
+// KVs returns all the key-value records stored in the cluster.
+func (c *Client) KVs() ([]api.KV, error) {
+	var kvs []api.KV
+	err := c.do("GET", "/kv", nil, &kvs)
+	return kvs, err
+}
+
+// KVGet returns the key-value record for the given key.
+func (c *Client) KVGet(key string) (api.KV, error) {
+	var kv api.KV
+	err := c.do("GET", fmt.Sprintf("/kv/%s", url.PathEscape(key)), nil, &kv)
+	return kv, err
+}
+
+// KVSet stores a value under the given key, replacing any previous value.
+func (c *Client) KVSet(key, value string) error {
+	return c.do("PUT", fmt.Sprintf("/kv/%s", url.PathEscape(key)), strings.NewReader(value), nil)
+}
+
+// KVRm removes a key-value record from the cluster.
+func (c *Client) KVRm(key string) error {
+	return c.do("DELETE", fmt.Sprintf("/kv/%s", url.PathEscape(key)), nil, nil)
+}
+
+// Webhooks returns the webhooks registered in the cluster.
+func (c *Client) Webhooks() ([]api.Webhook, error) {
+	var webhooks []api.Webhook
+	err := c.do("GET", "/webhooks", nil, &webhooks)
+	return webhooks, err
+}
+
+// WebhookAdd registers a webhook in the cluster. Its ID is ignored: the
+// registered webhook, with the ID assigned by the cluster, is returned.
+func (c *Client) WebhookAdd(wh api.Webhook) (api.Webhook, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(wh)
+
+	var added api.Webhook
+	err := c.do("POST", "/webhooks", &buf, &added)
+	return added, err
+}
+
+// WebhookRm removes a webhook from the cluster.
+func (c *Client) WebhookRm(id string) error {
+	return c.do("DELETE", fmt.Sprintf("/webhooks/%s", url.PathEscape(id)), nil, nil)
+}
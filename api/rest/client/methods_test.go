@@ -1,7 +1,12 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -46,6 +51,173 @@ func TestVersion(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestFeatures(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		support, err := c.Features()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(support) != 1 || !support[0].All || len(support[0].Peers) != 2 {
+			t.Error("unexpected feature support:", support)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestEvents(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		evs, err := c.Events(time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(evs) != 1 || evs[0].Cid != test.TestCid1 {
+			t.Error("unexpected events")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestMetricsHistory(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		metrics, err := c.MetricsHistory("ping", test.TestPeerID1, time.Now().Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(metrics) != 1 || metrics[0].Peer != test.TestPeerID1 || metrics[0].Name != "ping" {
+			t.Error("unexpected metrics")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPushMetric(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		err := c.PushMetric("gpu", "4", time.Minute)
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = c.PushMetric("ping", "ok", time.Minute)
+		if err == nil {
+			t.Error("expected an error")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestFailPeer(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		err := c.FailPeer(test.TestPeerID1, time.Minute)
+		if err != nil {
+			t.Error(err)
+		}
+
+		err = c.FailPeer(test.TestPeerID3, time.Minute)
+		if err == nil {
+			t.Error("expected an error")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestShutdown(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		err := c.Shutdown(false)
+		if err != nil {
+			t.Error(err)
+		}
+		err = c.Shutdown(true)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestUnquarantine(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		err := c.Unquarantine(test.TestPeerID1)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestStrayPins(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		strays, err := c.StrayPins()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(strays) != 1 || strays[0].Cid != test.TestCid2 {
+			t.Error("unexpected stray pins")
+		}
+
+		ci, _ := cid.Decode(test.TestCid2)
+		err = c.RemediateStrayPin(test.TestPeerID1, ci, "remove")
+		if err != nil {
+			t.Error(err)
+		}
+
+		ci, _ = cid.Decode(test.ErrorCid)
+		err = c.RemediateStrayPin(test.TestPeerID1, ci, "adopt")
+		if err == nil {
+			t.Error("expected an error")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestLastMetrics(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		metrics, err := c.LastMetrics("ping")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(metrics) != 2 || metrics[0].Name != "ping" {
+			t.Error("unexpected metrics")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestID(t *testing.T) {
 	api := testAPI(t)
 	defer shutdown(api)
@@ -131,19 +303,79 @@ func TestPeerRm(t *testing.T) {
 	testClients(t, api, testF)
 }
 
-func TestPin(t *testing.T) {
+func TestAnnotatePeer(t *testing.T) {
 	api := testAPI(t)
 	defer shutdown(api)
 
+	testF := func(t *testing.T, c *Client) {
+		err := c.AnnotatePeer(test.TestPeerID1, "rack 12, contact: ops")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.AnnotatePeer(test.TestPeerID1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.AnnotatePeer(test.TestPeerID3, "rack 12")
+		if err == nil {
+			t.Error("expected an error")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPin(t *testing.T) {
+	tapi := testAPI(t)
+	defer shutdown(tapi)
+
 	testF := func(t *testing.T, c *Client) {
 		ci, _ := cid.Decode(test.TestCid1)
 		err := c.Pin(ci, 6, 7, "hello")
 		if err != nil {
 			t.Fatal(err)
 		}
+
+		err = c.PinWithOptions(api.Pin{
+			Cid:                  ci,
+			Name:                 "hello",
+			ReplicationFactorMin: 1,
+			ReplicationFactorMax: 2,
+			AllowPeers:           []peer.ID{test.TestPeerID1},
+			ExcludePeers:         []peer.ID{test.TestPeerID2},
+			Priority:             api.PinPriorityHigh,
+			ExpireAt:             time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.PinWithOptions(api.Pin{
+			Cid:      ci,
+			Name:     "hello",
+			Metadata: map[string]string{"owner": "alice & bob"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.PinWithOptions(api.Pin{Cid: ci, MaxDepth: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.PinDirect(api.Pin{Cid: ci, Name: "hello"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.PinOverwrite(api.Pin{Cid: ci, Recursive: true, ReplicationFactorMin: 1, ReplicationFactorMax: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	testClients(t, api, testF)
+	testClients(t, tapi, testF)
 }
 
 func TestUnpin(t *testing.T) {
@@ -161,6 +393,85 @@ func TestUnpin(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPinUpdate(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		ci1, _ := cid.Decode(test.TestCid1)
+		ci2, _ := cid.Decode(test.TestCid2)
+		pin, err := c.PinUpdate(ci1, ci2, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pin.Cid.Equals(ci2) || pin.PinUpdate == nil || !pin.PinUpdate.Equals(ci1) {
+			t.Error("expected the updated pin:", pin)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestAdd(t *testing.T) {
+	restAPI := testAPI(t)
+	defer shutdown(restAPI)
+
+	dir, err := ioutil.TempDir("", "ipfs-cluster-add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "folder"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "folder", "file"), []byte("hello"), 0600)
+
+	testF := func(t *testing.T, c *Client) {
+		added, err := c.Add(
+			[]string{filepath.Join(dir, "folder")},
+			api.AddParams{CidVersion: 1, RawLeaves: true},
+			api.Pin{ReplicationFactorMin: 1, ReplicationFactorMax: 2, Name: "folder"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(added) != 1 || added[0].Cid != test.TestCid1 {
+			t.Error("expected the added items:", added)
+		}
+
+		_, err = c.Add([]string{filepath.Join(dir, "missing")}, api.AddParams{}, api.Pin{})
+		if err == nil {
+			t.Error("expected an error adding a missing file")
+		}
+	}
+
+	testClients(t, restAPI, testF)
+}
+
+func TestImportExportCAR(t *testing.T) {
+	restAPI := testAPI(t)
+	defer shutdown(restAPI)
+
+	testF := func(t *testing.T, c *Client) {
+		pins, err := c.ImportCAR(strings.NewReader("car file"), api.Pin{Name: "imported"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pins) != 1 || pins[0].Cid.String() != test.TestCid1 || pins[0].Name != "imported" {
+			t.Error("expected the pinned roots:", pins)
+		}
+
+		ci, _ := cid.Decode(test.TestCid1)
+		var buf bytes.Buffer
+		if err := c.ExportCAR(ci, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "car:"+test.TestCid1 {
+			t.Error("unexpected CAR file:", buf.String())
+		}
+	}
+
+	testClients(t, restAPI, testF)
+}
+
 func TestAllocations(t *testing.T) {
 	api := testAPI(t)
 	defer shutdown(api)
@@ -173,6 +484,14 @@ func TestAllocations(t *testing.T) {
 		if len(pins) == 0 {
 			t.Error("should be some pins")
 		}
+
+		pins, err = c.AllocationsFiltered("data", map[string]string{"owner": "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pins) != 1 || pins[0].Cid.String() != test.TestCid2 || pins[0].Metadata["owner"] != "alice" {
+			t.Error("expected the pins to be filtered:", pins)
+		}
 	}
 
 	testClients(t, api, testF)
@@ -196,6 +515,45 @@ func TestAllocation(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestAllocationPreview(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		ci, _ := cid.Decode(test.TestCid1)
+		pin, err := c.AllocationPreview(ci, 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pin.Cid.String() != test.TestCid1 {
+			t.Error("should be same pin")
+		}
+		if len(pin.Allocations) != 2 {
+			t.Error("expected 2 allocations")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPinEstimate(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		ci, _ := cid.Decode(test.TestCid1)
+		est, err := c.PinEstimate(ci, 2, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if est.Cid != test.TestCid1 || !est.Feasible {
+			t.Error("unexpected estimate")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestStatus(t *testing.T) {
 	api := testAPI(t)
 	defer shutdown(api)
@@ -215,8 +573,8 @@ func TestStatus(t *testing.T) {
 }
 
 func TestStatusAll(t *testing.T) {
-	api := testAPI(t)
-	defer shutdown(api)
+	tapi := testAPI(t)
+	defer shutdown(tapi)
 
 	testF := func(t *testing.T, c *Client) {
 		pins, err := c.StatusAll(false)
@@ -227,6 +585,116 @@ func TestStatusAll(t *testing.T) {
 		if len(pins) == 0 {
 			t.Error("there should be some pins")
 		}
+
+		pins, err = c.StatusAllFiltered(false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, gpi := range pins {
+			for _, pinfo := range gpi.PeerMap {
+				if pinfo.Status == api.TrackerStatusRemote {
+					t.Error("remote entries should have been left out")
+				}
+			}
+		}
+	}
+
+	testClients(t, tapi, testF)
+}
+
+func TestStatusCids(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		ci1, _ := cid.Decode(test.TestCid1)
+		ci2, _ := cid.Decode(test.TestCid2)
+		pins, err := c.StatusCids([]*cid.Cid{ci1, ci2}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(pins) != 2 {
+			t.Fatal("expected two statuses")
+		}
+		if !pins[0].Cid.Equals(ci1) || !pins[1].Cid.Equals(ci2) {
+			t.Error("expected statuses for the requested cids")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestKV(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		kvs, err := c.KVs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kvs) != 2 {
+			t.Error("expected two records")
+		}
+
+		kv, err := c.KVGet("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kv.Key != "a" || kv.Value != "1" {
+			t.Error("unexpected record: ", kv)
+		}
+
+		_, err = c.KVGet(test.ErrorKey)
+		if err == nil {
+			t.Error("expected an error for a missing key")
+		}
+
+		err = c.KVSet("a", "hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.KVRm("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestWebhooks(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		webhooks, err := c.Webhooks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(webhooks) != 1 || webhooks[0].ID != "1" {
+			t.Error("unexpected webhooks: ", webhooks)
+		}
+
+		wh := webhooks[0]
+		wh.ID = ""
+		added, err := c.WebhookAdd(wh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added.ID != "2" || added.URL != wh.URL || added.Metadata["tenant"] != "acme" {
+			t.Error("unexpected webhook: ", added)
+		}
+
+		err = c.WebhookRm("2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.WebhookRm(test.ErrorKey); err == nil {
+			t.Error("expected an error removing a missing webhook")
+		}
 	}
 
 	testClients(t, api, testF)
@@ -268,6 +736,76 @@ func TestSyncAll(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPinHistory(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		ci, _ := cid.Decode(test.TestCid1)
+		history, err := c.PinHistory(ci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].Cid != test.TestCid1 {
+			t.Error("unexpected pin history")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestAllocationHistory(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		ci, _ := cid.Decode(test.TestCid1)
+		history, err := c.AllocationHistory(ci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].Cid != test.TestCid1 {
+			t.Error("unexpected allocation history")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestRaftHealth(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		health, err := c.RaftHealth()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if health.Leader != test.TestPeerID1.Pretty() {
+			t.Error("unexpected raft health")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPinQueue(t *testing.T) {
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c *Client) {
+		queue, err := c.PinQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if queue.PinQueued != 1 || queue.PendingGC != 2 {
+			t.Error("unexpected pin queue")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestRecover(t *testing.T) {
 	api := testAPI(t)
 	defer shutdown(api)
@@ -6,19 +6,70 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
 
 func (c *Client) do(method, path string, body io.Reader, obj interface{}) error {
-	resp, err := c.doRequest(method, path, body)
-	if err != nil {
-		return &api.Error{Code: 0, Message: err.Error()}
+	return c.doContentType(method, path, "", body, obj)
+}
+
+// retryDelay is how long to wait before retrying a request.
+var retryDelay = time.Second
+
+// doContentType works like do but it sets the Content-Type of the body,
+// unless empty.
+func (c *Client) doContentType(method, path, contentType string, body io.Reader, obj interface{}) error {
+	seeker, rewindable := body.(io.Seeker)
+	rewindable = rewindable || body == nil
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.doRequest(method, path, contentType, body)
+		retry := attempt < c.config.Retries && rewindable && isIdempotent(method) &&
+			(err != nil || isUnavailable(resp.StatusCode))
+		if !retry {
+			if err != nil {
+				return &api.Error{Code: 0, Message: err.Error()}
+			}
+			return c.handleResponse(resp, obj)
+		}
+
+		if err != nil {
+			logger.Debugf("retrying %s %s: %s", method, path, err)
+		} else {
+			logger.Debugf("retrying %s %s: %s", method, path, resp.Status)
+			resp.Body.Close()
+		}
+		time.Sleep(retryDelay)
+		if seeker != nil {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return &api.Error{Code: 0, Message: err.Error()}
+			}
+		}
 	}
-	return c.handleResponse(resp, obj)
 }
 
-func (c *Client) doRequest(method, path string, body io.Reader) (*http.Response, error) {
+// isUnavailable returns true for the status codes meaning that the API
+// could not serve the request for now.
+func isUnavailable(code int) bool {
+	return code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout
+}
+
+// isIdempotent returns true for the methods which can be safely retried:
+// repeating them has the same effect as sending them once.
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) doRequest(method, path, contentType string, body io.Reader) (*http.Response, error) {
 	urlpath := c.net + "://" + c.hostname + "/" + strings.TrimPrefix(path, "/")
 	logger.Debugf("%s: %s", method, urlpath)
 
@@ -26,6 +77,12 @@ func (c *Client) doRequest(method, path string, body io.Reader) (*http.Response,
 	if err != nil {
 		return nil, err
 	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if c.config.Timeout > 0 {
+		r.Header.Set(api.RequestTimeoutHeader, c.config.Timeout.String())
+	}
 	if c.config.DisableKeepAlives {
 		r.Close = true
 	}
@@ -38,6 +95,11 @@ func (c *Client) doRequest(method, path string, body io.Reader) (*http.Response,
 }
 
 func (c *Client) handleResponse(resp *http.Response, obj interface{}) error {
+	if w, ok := obj.(io.Writer); ok && resp.StatusCode < 400 {
+		defer resp.Body.Close()
+		return streamResponse(resp, w)
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 
@@ -73,3 +135,16 @@ func (c *Client) handleResponse(resp *http.Response, obj interface{}) error {
 	}
 	return nil
 }
+
+// streamResponse copies the body of a successful response to w, without
+// holding it in memory. Errors happening once the API has started
+// sending the body are reported in the StreamErrorTrailer.
+func streamResponse(resp *http.Response, w io.Writer) error {
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return &api.Error{Code: resp.StatusCode, Message: err.Error()}
+	}
+	if msg := resp.Trailer.Get(api.StreamErrorTrailer); msg != "" {
+		return &api.Error{Code: resp.StatusCode, Message: msg}
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"time"
 
+	types "github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/config"
 
 	crypto "github.com/libp2p/go-libp2p-crypto"
@@ -20,11 +21,13 @@ const configKey = "restapi"
 
 // These are the default values for Config
 const (
-	DefaultHTTPListenAddr    = "/ip4/127.0.0.1/tcp/9094"
-	DefaultReadTimeout       = 30 * time.Second
-	DefaultReadHeaderTimeout = 5 * time.Second
-	DefaultWriteTimeout      = 60 * time.Second
-	DefaultIdleTimeout       = 120 * time.Second
+	DefaultHTTPListenAddr     = "/ip4/127.0.0.1/tcp/9094"
+	DefaultHTTPListenAddrIPv6 = "/ip6/::1/tcp/9094"
+	DefaultReadTimeout        = 30 * time.Second
+	DefaultReadHeaderTimeout  = 5 * time.Second
+	DefaultWriteTimeout       = 60 * time.Second
+	DefaultIdleTimeout        = 120 * time.Second
+	DefaultMaxAddSize         = 10 << 30 // 10 GiB
 )
 
 // Config is used to intialize the API object and allows to
@@ -60,6 +63,10 @@ type Config struct {
 	// kept idle before being reused
 	IdleTimeout time.Duration
 
+	// Maximum size in bytes of the bodies of requests to add content
+	// or to import CAR files
+	MaxAddSize int64
+
 	// Listen address for the Libp2p REST API endpoint.
 	Libp2pListenAddr ma.Multiaddr
 
@@ -82,6 +89,7 @@ type jsonConfig struct {
 	ReadHeaderTimeout      string `json:"read_header_timeout"`
 	WriteTimeout           string `json:"write_timeout"`
 	IdleTimeout            string `json:"idle_timeout"`
+	MaxAddSize             int64  `json:"max_add_size,omitempty"`
 
 	Libp2pListenMultiaddress string `json:"libp2p_listen_multiaddress,omitempty"`
 	ID                       string `json:"id,omitempty"`
@@ -99,7 +107,7 @@ func (cfg *Config) ConfigKey() string {
 // Default initializes this Config with working values.
 func (cfg *Config) Default() error {
 	// http
-	httpListen, _ := ma.NewMultiaddr(DefaultHTTPListenAddr)
+	httpListen, _ := ma.NewMultiaddr(types.PreferredAddr(DefaultHTTPListenAddr, DefaultHTTPListenAddrIPv6))
 	cfg.HTTPListenAddr = httpListen
 	cfg.pathSSLCertFile = ""
 	cfg.pathSSLKeyFile = ""
@@ -107,6 +115,7 @@ func (cfg *Config) Default() error {
 	cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
 	cfg.WriteTimeout = DefaultWriteTimeout
 	cfg.IdleTimeout = DefaultIdleTimeout
+	cfg.MaxAddSize = DefaultMaxAddSize
 
 	// libp2p
 	cfg.ID = ""
@@ -131,6 +140,8 @@ func (cfg *Config) Validate() error {
 		return errors.New("restapi.write_timeout is invalid")
 	case cfg.IdleTimeout < 0:
 		return errors.New("restapi.idle_timeout invalid")
+	case cfg.MaxAddSize <= 0:
+		return errors.New("restapi.max_add_size should be positive")
 	case cfg.BasicAuthCreds != nil && len(cfg.BasicAuthCreds) == 0:
 		return errors.New("restapi.basic_auth_creds should be null or have at least one entry")
 	case (cfg.pathSSLCertFile != "" || cfg.pathSSLKeyFile != "") && cfg.TLS == nil:
@@ -205,6 +216,10 @@ func (cfg *Config) loadHTTPOptions(jcfg *jsonConfig) error {
 		return err
 	}
 
+	if jcfg.MaxAddSize != 0 {
+		cfg.MaxAddSize = jcfg.MaxAddSize
+	}
+
 	return config.ParseDurations(
 		"restapi",
 		&config.DurationOpt{jcfg.ReadTimeout, &cfg.ReadTimeout, "read_timeout"},
@@ -294,6 +309,7 @@ func (cfg *Config) ToJSON() (raw []byte, err error) {
 		ReadHeaderTimeout:      cfg.ReadHeaderTimeout.String(),
 		WriteTimeout:           cfg.WriteTimeout.String(),
 		IdleTimeout:            cfg.IdleTimeout.String(),
+		MaxAddSize:             cfg.MaxAddSize,
 		BasicAuthCreds:         cfg.BasicAuthCreds,
 	}
 
@@ -19,6 +19,7 @@ var cfgJSON = []byte(`
       "read_header_timeout": "5s",
       "write_timeout": "1m0s",
       "idle_timeout": "2m0s",
+      "max_add_size": 1048576,
       "basic_auth_credentials": null
 }
 `)
@@ -36,6 +37,9 @@ func TestLoadJSON(t *testing.T) {
 		cfg.IdleTimeout != 2*time.Minute {
 		t.Error("error parsing timeouts")
 	}
+	if cfg.MaxAddSize != 1048576 {
+		t.Error("error parsing max_add_size")
+	}
 
 	j := &jsonConfig{}
 
@@ -56,6 +60,15 @@ func TestLoadJSON(t *testing.T) {
 		t.Error("expected error in read_timeout")
 	}
 
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MaxAddSize = -1
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error in max_add_size")
+	}
+
 	j = &jsonConfig{}
 	json.Unmarshal(cfgJSON, j)
 	j.BasicAuthCreds = make(map[string]string)
@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// fieldsTree holds the fields requested with the "fields" parameter.
+// Nested fields are separated by dots and "*" matches every key of an
+// object, so "cid,peer_map.*.status" selects the cid and the status
+// reported by every peer. A nil subtree selects the whole value.
+type fieldsTree map[string]fieldsTree
+
+// parseFields returns the fields requested in the query, or nil when
+// the whole objects should be returned.
+func parseFields(r *http.Request) fieldsTree {
+	param := r.URL.Query().Get("fields")
+	if param == "" {
+		return nil
+	}
+
+	tree := make(fieldsTree)
+	for _, f := range strings.Split(param, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		parts := strings.Split(f, ".")
+		node := tree
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+			next, ok := node[part]
+			if ok && next == nil { // whole value already selected
+				break
+			}
+			if !ok {
+				next = make(fieldsTree)
+				node[part] = next
+			}
+			node = next
+		}
+	}
+	if len(tree) == 0 {
+		return nil
+	}
+	return tree
+}
+
+// projectFields returns a copy of a decoded JSON value keeping only the
+// given fields. Arrays are projected element by element.
+func projectFields(v interface{}, fields fieldsTree) interface{} {
+	if fields == nil {
+		return v
+	}
+
+	switch val := v.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(val), len(val))
+		for i, elem := range val {
+			out[i] = projectFields(elem, fields)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for k, sub := range fields {
+			if k == "*" {
+				for key, value := range val {
+					out[key] = projectFields(value, sub)
+				}
+				continue
+			}
+			if value, ok := val[k]; ok {
+				out[k] = projectFields(value, sub)
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// sendFieldsResponse works like sendResponse, but only includes the
+// fields requested with the "fields" parameter, when given.
+func sendFieldsResponse(w http.ResponseWriter, r *http.Request, rpcErr error, resp interface{}) {
+	if !checkRPCErr(w, rpcErr) {
+		return
+	}
+
+	fields := parseFields(r)
+	if fields == nil {
+		sendJSONResponse(w, 200, resp)
+		return
+	}
+
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		sendErrorResponse(w, 500, err.Error())
+		return
+	}
+	var generic interface{}
+	err = json.Unmarshal(raw, &generic)
+	if err != nil {
+		sendErrorResponse(w, 500, err.Error())
+		return
+	}
+	sendJSONResponse(w, 200, projectFields(generic, fields))
+}
@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+)
+
+// metricsHandler exposes the cluster peer observations using the
+// Prometheus text format.
+func (api *API) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	var obs []types.Observation
+	err := api.rpcClient.Call("",
+		"Cluster",
+		"Observations",
+		struct{}{},
+		&obs)
+	if err != nil {
+		sendErrorResponse(w, 500, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	writePrometheusText(w, obs)
+}
+
+// writePrometheusText writes the given observations as gauges, grouped by
+// name, following the Prometheus text exposition format.
+func writePrometheusText(w io.Writer, obs []types.Observation) {
+	byName := make(map[string][]types.Observation)
+	var names []string
+	for _, o := range obs {
+		if _, ok := byName[o.Name]; !ok {
+			names = append(names, o.Name)
+		}
+		byName[o.Name] = append(byName[o.Name], o)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		group := byName[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", name, group[0].Help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		for _, o := range group {
+			fmt.Fprintf(w, "%s%s %s\n",
+				name,
+				formatLabels(o.Labels),
+				strconv.FormatFloat(o.Value, 'g', -1, 64),
+			)
+		}
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", k, strconv.Quote(labels[k]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
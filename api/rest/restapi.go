@@ -13,11 +13,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	types "github.com/ipfs/ipfs-cluster/api"
 
@@ -63,7 +68,11 @@ type API struct {
 	server *http.Server
 	host   host.Host
 
+	// listenerMux protects httpListener, which may be replaced
+	// by SetHTTPListenAddr().
+	listenerMux    sync.Mutex
 	httpListener   net.Listener
+	httpServing    bool
 	libp2pListener net.Listener
 
 	shutdownLock sync.Mutex
@@ -82,6 +91,16 @@ type peerAddBody struct {
 	PeerMultiaddr string `json:"peer_multiaddress"`
 }
 
+type statusCidsBody struct {
+	Cids []string `json:"cids"`
+}
+
+type pushMetricBody struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	TTL   string `json:"ttl"`
+}
+
 // NewAPI creates a new REST API component with the given configuration.
 func NewAPI(cfg *Config) (*API, error) {
 	return NewAPIWithHost(cfg, nil)
@@ -101,7 +120,6 @@ func NewAPIWithHost(cfg *Config, h host.Host) (*API, error) {
 		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
 		WriteTimeout:      cfg.WriteTimeout,
 		IdleTimeout:       cfg.IdleTimeout,
-		Handler:           router,
 	}
 	s.SetKeepAlivesEnabled(true) // A reminder that this can be changed
 
@@ -116,6 +134,7 @@ func NewAPIWithHost(cfg *Config, h host.Host) (*API, error) {
 		rpcReady: make(chan struct{}, 2),
 	}
 	api.addRoutes(router)
+	s.Handler = api.readinessHandler(router)
 
 	// Set up api.httpListener if enabled
 	err = api.setupHTTP()
@@ -142,21 +161,64 @@ func (api *API) setupHTTP() error {
 		return nil
 	}
 
-	n, addr, err := manet.DialArgs(api.config.HTTPListenAddr)
+	l, err := api.listenHTTP(api.config.HTTPListenAddr)
 	if err != nil {
 		return err
 	}
+	api.httpListener = l
+	return nil
+}
+
+func (api *API) listenHTTP(maddr ma.Multiaddr) (net.Listener, error) {
+	n, addr, err := manet.DialArgs(maddr)
+	if err != nil {
+		return nil, err
+	}
 
-	var l net.Listener
 	if api.config.TLS != nil {
-		l, err = tls.Listen(n, addr, api.config.TLS)
-	} else {
-		l, err = net.Listen(n, addr)
+		return tls.Listen(n, addr, api.config.TLS)
+	}
+	return net.Listen(n, addr)
+}
+
+// SetHTTPListenAddr moves the HTTP endpoint to a new address without
+// dropping requests: the new address is bound and served before the old
+// listener is closed, and connections already accepted on the old
+// listener are served until they finish. Returns an error when the HTTP
+// endpoint is not enabled.
+func (api *API) SetHTTPListenAddr(addr ma.Multiaddr) error {
+	api.listenerMux.Lock()
+	defer api.listenerMux.Unlock()
+
+	if api.ctx.Err() != nil {
+		return errors.New("the API is shutting down")
+	}
+
+	if api.httpListener == nil {
+		return ErrHTTPEndpointNotEnabled
+	}
+
+	// compare with the bound address, as the configured one may
+	// not specify the port (tcp/0)
+	bound, err := manet.FromNetAddr(api.httpListener.Addr())
+	if err == nil && addr.Equal(bound) {
+		return nil
 	}
+
+	l, err := api.listenHTTP(addr)
 	if err != nil {
 		return err
 	}
+
+	old := api.httpListener
 	api.httpListener = l
+	api.config.HTTPListenAddr = addr
+	if api.httpServing {
+		api.wg.Add(1)
+		go api.serveHTTP(l)
+	}
+	old.Close()
+	logger.Infof("REST API (HTTP) moved from %s to %s", old.Addr(), l.Addr())
 	return nil
 }
 
@@ -192,6 +254,8 @@ func (api *API) setupLibp2p(ctx context.Context) error {
 // on a random port (0). Returns error when the HTTP endpoint
 // is not enabled.
 func (api *API) HTTPAddress() (string, error) {
+	api.listenerMux.Lock()
+	defer api.listenerMux.Unlock()
 	if api.httpListener == nil {
 		return "", ErrHTTPEndpointNotEnabled
 	}
@@ -208,6 +272,7 @@ func (api *API) Host() host.Host {
 
 func (api *API) addRoutes(router *mux.Router) {
 	for _, route := range api.routes() {
+		route.HandlerFunc = requestTimeout(route.HandlerFunc)
 		if api.config.BasicAuthCreds != nil {
 			route.HandlerFunc = basicAuth(route.HandlerFunc, api.config.BasicAuthCreds)
 		}
@@ -220,6 +285,98 @@ func (api *API) addRoutes(router *mux.Router) {
 	api.router = router
 }
 
+// readinessHandler responds with 503 errors while the cluster peer reports
+// that any of its components is not ready, which may happen at any time
+// (i.e. when the IPFS daemon goes away). Otherwise, or for the paths which
+// must answer regardless (health and metrics), it just calls h.
+func (api *API) readinessHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if readinessExempt(r.URL.Path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var readiness types.Readiness
+		err := api.rpcClient.CallContext(rpcContext(r), "",
+			"Cluster",
+			"Readiness",
+			struct{}{},
+			&readiness)
+		if err != nil || !readiness.Ready {
+			sendNotReadyResponse(w, readiness, err)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// readinessExempt returns true for the paths which are served while the
+// peer is not ready, so that it can still be monitored.
+func readinessExempt(path string) bool {
+	return path == "/metrics" ||
+		path == "/health" ||
+		strings.HasPrefix(path, "/health/")
+}
+
+// notReadyResponse is the body of the 503 responses sent while the peer is
+// not ready. It is an error which carries the readiness of each component.
+type notReadyResponse struct {
+	types.Error
+	types.Readiness
+}
+
+func sendNotReadyResponse(w http.ResponseWriter, readiness types.Readiness, err error) {
+	msg := "cluster peer is not ready"
+	if err != nil {
+		msg += ": " + err.Error()
+	} else {
+		var notReady []string
+		for comp, ok := range readiness.Components {
+			if !ok {
+				notReady = append(notReady, comp)
+			}
+		}
+		sort.Strings(notReady)
+		msg += ". Waiting for: " + strings.Join(notReady, ", ")
+	}
+
+	logger.Debug(msg)
+	sendJSONResponse(w, 503, notReadyResponse{
+		Error: types.Error{
+			Code:    503,
+			Message: msg,
+		},
+		Readiness: readiness,
+	})
+}
+
+// deadlineKey is the request context key holding the context that
+// expires with the RequestTimeoutHeader of a request.
+type deadlineKey struct{}
+
+// requestTimeout attaches a context with a deadline to the requests which
+// carry a RequestTimeoutHeader, so that the RPC calls made to serve them
+// are cancelled once the client has stopped waiting. That context is not
+// derived from the request one: a client going away does not abandon
+// operations halfway.
+func requestTimeout(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeoutStr := r.Header.Get(types.RequestTimeoutHeader)
+		if timeoutStr == "" {
+			h(w, r)
+			return
+		}
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout <= 0 {
+			sendErrorResponse(w, 400, "invalid "+types.RequestTimeoutHeader+" header: not a positive duration")
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		h(w, r.WithContext(context.WithValue(r.Context(), deadlineKey{}, ctx)))
+	}
+}
+
 func basicAuth(h http.HandlerFunc, credentials map[string]string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
@@ -277,6 +434,51 @@ func (api *API) routes() []route {
 			"/version",
 			api.versionHandler,
 		},
+		{
+			"Features",
+			"GET",
+			"/features",
+			api.featuresHandler,
+		},
+		{
+			"Shutdown",
+			"POST",
+			"/shutdown",
+			api.shutdownHandler,
+		},
+
+		{
+			"Events",
+			"GET",
+			"/events",
+			api.eventsHandler,
+		},
+
+		{
+			"Metrics",
+			"GET",
+			"/metrics",
+			api.metricsHandler,
+		},
+
+		{
+			"PushMetric",
+			"POST",
+			"/monitor/metrics",
+			api.pushMetricHandler,
+		},
+		{
+			"LastMetrics",
+			"GET",
+			"/monitor/metrics/{name}",
+			api.lastMetricsHandler,
+		},
+		{
+			"MetricsHistory",
+			"GET",
+			"/monitor/metrics/{name}/{peer}",
+			api.metricsHistoryHandler,
+		},
 
 		{
 			"Peers",
@@ -296,6 +498,18 @@ func (api *API) routes() []route {
 			"/peers/{peer}",
 			api.peerRemoveHandler,
 		},
+		{
+			"PeerAnnotate",
+			"PUT",
+			"/peers/{peer}/annotation",
+			api.peerAnnotateHandler,
+		},
+		{
+			"PeerAnnotationRm",
+			"DELETE",
+			"/peers/{peer}/annotation",
+			api.peerAnnotateHandler,
+		},
 
 		{
 			"Allocations",
@@ -303,12 +517,24 @@ func (api *API) routes() []route {
 			"/allocations",
 			api.allocationsHandler,
 		},
+		{
+			"AllocationPreview",
+			"POST",
+			"/allocations/preview",
+			api.allocationPreviewHandler,
+		},
 		{
 			"Allocation",
 			"GET",
 			"/allocations/{hash}",
 			api.allocationHandler,
 		},
+		{
+			"AllocationHistory",
+			"GET",
+			"/allocations/{hash}/history",
+			api.allocationHistoryHandler,
+		},
 		{
 			"StatusAll",
 			"GET",
@@ -327,6 +553,30 @@ func (api *API) routes() []route {
 			"/pins/recover",
 			api.recoverAllHandler,
 		},
+		{
+			"StatusCids",
+			"POST",
+			"/pins/status",
+			api.statusCidsHandler,
+		},
+		{
+			"StrayPins",
+			"GET",
+			"/pins/stray",
+			api.strayPinsHandler,
+		},
+		{
+			"PinQueue",
+			"GET",
+			"/pins/queue",
+			api.pinQueueHandler,
+		},
+		{
+			"RemediateStrayPin",
+			"POST",
+			"/pins/stray/{peer}/{hash}",
+			api.remediateStrayPinHandler,
+		},
 		{
 			"Status",
 			"GET",
@@ -357,12 +607,108 @@ func (api *API) routes() []route {
 			"/pins/{hash}/recover",
 			api.recoverHandler,
 		},
+		{
+			"PinHistory",
+			"GET",
+			"/pins/{hash}/history",
+			api.pinHistoryHandler,
+		},
+		{
+			"PinEstimate",
+			"POST",
+			"/pins/{hash}/estimate",
+			api.pinEstimateHandler,
+		},
+		{
+			"PinUpdate",
+			"POST",
+			"/pins/{hash}/update/{to}",
+			api.pinUpdateHandler,
+		},
+		{
+			"Add",
+			"POST",
+			"/add",
+			api.addHandler,
+		},
+		{
+			"ImportCAR",
+			"POST",
+			"/car",
+			api.importCARHandler,
+		},
+		{
+			"ExportCAR",
+			"GET",
+			"/pins/{hash}/car",
+			api.exportCARHandler,
+		},
 		{
 			"ConnectionGraph",
 			"GET",
 			"/health/graph",
 			api.graphHandler,
 		},
+		{
+			"RaftHealth",
+			"GET",
+			"/health/raft",
+			api.raftHealthHandler,
+		},
+		{
+			"Unquarantine",
+			"DELETE",
+			"/monitor/quarantine/{peer}",
+			api.unquarantineHandler,
+		},
+		{
+			"FailPeer",
+			"POST",
+			"/debug/fail-peer/{peer}",
+			api.failPeerHandler,
+		},
+		{
+			"KVs",
+			"GET",
+			"/kv",
+			api.kvListHandler,
+		},
+		{
+			"KVGet",
+			"GET",
+			"/kv/{key}",
+			api.kvGetHandler,
+		},
+		{
+			"KVSet",
+			"PUT",
+			"/kv/{key}",
+			api.kvSetHandler,
+		},
+		{
+			"KVRm",
+			"DELETE",
+			"/kv/{key}",
+			api.kvRmHandler,
+		},
+		{
+			"Webhooks",
+			"GET",
+			"/webhooks",
+			api.webhooksHandler,
+		},
+		{
+			"WebhookAdd",
+			"POST",
+			"/webhooks",
+			api.webhookAddHandler,
+		},
+		{
+			"WebhookRm",
+			"DELETE",
+			"/webhooks/{id}",
+			api.webhookRmHandler,
+		},
 	}
 }
 
@@ -383,8 +729,20 @@ func (api *API) runHTTPServer() {
 	defer api.wg.Done()
 	<-api.rpcReady
 
+	api.listenerMux.Lock()
+	l := api.httpListener
+	api.httpServing = true
+	api.listenerMux.Unlock()
+
 	logger.Infof("REST API (HTTP): %s", api.config.HTTPListenAddr)
-	err := api.server.Serve(api.httpListener)
+	api.wg.Add(1)
+	api.serveHTTP(l)
+}
+
+// serveHTTP serves requests on the given listener until it is closed.
+func (api *API) serveHTTP(l net.Listener) {
+	defer api.wg.Done()
+	err := api.server.Serve(l)
 	if err != nil && !strings.Contains(err.Error(), "closed network connection") {
 		logger.Error(err)
 	}
@@ -425,9 +783,11 @@ func (api *API) Shutdown() error {
 	// Cancel any outstanding ops
 	api.server.SetKeepAlivesEnabled(false)
 
+	api.listenerMux.Lock()
 	if api.httpListener != nil {
 		api.httpListener.Close()
 	}
+	api.listenerMux.Unlock()
 	if api.libp2pListener != nil {
 		api.libp2pListener.Close()
 	}
@@ -454,7 +814,7 @@ func (api *API) SetClient(c *rpc.Client) {
 
 func (api *API) idHandler(w http.ResponseWriter, r *http.Request) {
 	idSerial := types.IDSerial{}
-	err := api.rpcClient.Call("",
+	err := api.rpcClient.CallContext(rpcContext(r), "",
 		"Cluster",
 		"ID",
 		struct{}{},
@@ -465,7 +825,7 @@ func (api *API) idHandler(w http.ResponseWriter, r *http.Request) {
 
 func (api *API) versionHandler(w http.ResponseWriter, r *http.Request) {
 	var v types.Version
-	err := api.rpcClient.Call("",
+	err := api.rpcClient.CallContext(rpcContext(r), "",
 		"Cluster",
 		"Version",
 		struct{}{},
@@ -474,9 +834,148 @@ func (api *API) versionHandler(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, err, v)
 }
 
+// featuresHandler lists which cluster peers advertise each feature.
+func (api *API) featuresHandler(w http.ResponseWriter, r *http.Request) {
+	var support []types.FeatureSupport
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"Features",
+		struct{}{},
+		&support)
+
+	sendResponse(w, err, support)
+}
+
+// shutdownHandler stops the peer, or the whole cluster when the "all"
+// parameter is true.
+func (api *API) shutdownHandler(w http.ResponseWriter, r *http.Request) {
+	method := "ShutdownLocal"
+	if r.URL.Query().Get("all") == "true" {
+		method = "ShutdownAll"
+	}
+
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		method,
+		struct{}{},
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+func (api *API) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		t, err := parseTimeParam(sinceStr)
+		if err != nil {
+			sendErrorResponse(w, 400, "error parsing since: "+err.Error())
+			return
+		}
+		since = t
+	}
+
+	var events []types.Event
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"Events",
+		since,
+		&events)
+
+	sendResponse(w, err, events)
+}
+
+// pushMetricHandler lets external processes push custom metrics for
+// this peer.
+func (api *API) pushMetricHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var body pushMetricBody
+	err := dec.Decode(&body)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
+	}
+
+	ttl, err := time.ParseDuration(body.TTL)
+	if err != nil || ttl <= 0 {
+		sendErrorResponse(w, 400, "a valid ttl is required")
+		return
+	}
+
+	m := types.Metric{
+		Name:  body.Name,
+		Value: body.Value,
+		Valid: true,
+	}
+	m.SetTTLDuration(ttl)
+
+	err = api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"PushMetric",
+		m.ToSerial(),
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+// lastMetricsHandler returns the latest valid metrics of a type for the
+// current cluster peers, which are those used for allocations. For
+// compatibility, the history of a peer's metrics is returned instead when
+// the "peer" parameter is given.
+func (api *API) lastMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("peer") != "" {
+		api.metricsHistoryHandler(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	var metrics []types.MetricSerial
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"LastMetrics",
+		vars["name"],
+		&metrics)
+	sendResponse(w, err, metrics)
+}
+
+func (api *API) metricsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	queryValues := r.URL.Query()
+
+	peerStr, ok := vars["peer"]
+	if !ok {
+		peerStr = queryValues.Get("peer")
+	}
+	pid, err := peer.IDB58Decode(peerStr)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding peer: "+err.Error())
+		return
+	}
+
+	var since time.Time
+	if sinceStr := queryValues.Get("since"); sinceStr != "" {
+		since, err = parseTimeParam(sinceStr)
+		if err != nil {
+			sendErrorResponse(w, 400, "error parsing since: "+err.Error())
+			return
+		}
+	}
+
+	var metrics []types.MetricSerial
+	err = api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"MetricsSince",
+		types.MetricsQuery{
+			Name:  vars["name"],
+			Peer:  pid,
+			Since: since,
+		},
+		&metrics)
+	sendResponse(w, err, metrics)
+}
+
 func (api *API) graphHandler(w http.ResponseWriter, r *http.Request) {
 	var graph types.ConnectGraphSerial
-	err := api.rpcClient.Call("",
+	err := api.rpcClient.CallContext(rpcContext(r), "",
 		"Cluster",
 		"ConnectGraph",
 		struct{}{},
@@ -484,15 +983,36 @@ func (api *API) graphHandler(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, err, graph)
 }
 
+// raftHealthHandler returns the state of the Raft consensus in the peer.
+func (api *API) raftHealthHandler(w http.ResponseWriter, r *http.Request) {
+	var health types.RaftHealth
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"RaftHealth",
+		struct{}{},
+		&health)
+	sendResponse(w, err, health)
+}
+
+func (api *API) pinQueueHandler(w http.ResponseWriter, r *http.Request) {
+	var queue types.PinQueue
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"PinQueue",
+		struct{}{},
+		&queue)
+	sendResponse(w, err, queue)
+}
+
 func (api *API) peerListHandler(w http.ResponseWriter, r *http.Request) {
 	var peersSerial []types.IDSerial
-	err := api.rpcClient.Call("",
+	err := api.rpcClient.CallContext(rpcContext(r), "",
 		"Cluster",
 		"Peers",
 		struct{}{},
 		&peersSerial)
 
-	sendResponse(w, err, peersSerial)
+	sendFieldsResponse(w, r, err, peersSerial)
 }
 
 func (api *API) peerAddHandler(w http.ResponseWriter, r *http.Request) {
@@ -513,7 +1033,7 @@ func (api *API) peerAddHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var ids types.IDSerial
-	err = api.rpcClient.Call("",
+	err = api.rpcClient.CallContext(rpcContext(r), "",
 		"Cluster",
 		"PeerAdd",
 		types.MultiaddrToSerial(mAddr),
@@ -523,7 +1043,7 @@ func (api *API) peerAddHandler(w http.ResponseWriter, r *http.Request) {
 
 func (api *API) peerRemoveHandler(w http.ResponseWriter, r *http.Request) {
 	if p := parsePidOrError(w, r); p != "" {
-		err := api.rpcClient.Call("",
+		err := api.rpcClient.CallContext(rpcContext(r), "",
 			"Cluster",
 			"PeerRemove",
 			p,
@@ -532,24 +1052,246 @@ func (api *API) peerRemoveHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// peerAnnotateHandler stores the request body as the annotation of the
+// given peer. DELETE requests remove it.
+func (api *API) peerAnnotateHandler(w http.ResponseWriter, r *http.Request) {
+	p := parsePidOrError(w, r)
+	if p == "" {
+		return
+	}
+
+	var annotation []byte
+	if r.Method == "PUT" {
+		defer r.Body.Close()
+		var err error
+		annotation, err = ioutil.ReadAll(io.LimitReader(r.Body, types.MaxKVValueSize+1))
+		if err != nil {
+			sendErrorResponse(w, 400, "error reading request body: "+err.Error())
+			return
+		}
+		if len(annotation) == 0 || len(annotation) > types.MaxKVValueSize {
+			sendErrorResponse(w, 400, fmt.Sprintf("annotations must have between 1 and %d bytes", types.MaxKVValueSize))
+			return
+		}
+	}
+
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"AnnotatePeer",
+		types.PeerAnnotation{
+			Peer:       peer.IDB58Encode(p),
+			Annotation: string(annotation),
+		},
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+// pinHandler pins a Cid with the options given in the query parameters.
+// When the "overwrite" parameter is true, the options of an existing pin
+// are replaced regardless of the pin_merge_policy.
 func (api *API) pinHandler(w http.ResponseWriter, r *http.Request) {
 	if ps := parseCidOrError(w, r); ps.Cid != "" {
 		logger.Debugf("rest api pinHandler: %s", ps.Cid)
 
-		err := api.rpcClient.Call("",
+		method := "PinWithResult"
+		if r.URL.Query().Get("overwrite") == "true" {
+			method = "PinOverwrite"
+		}
+
+		var result types.PinResult
+		err := api.rpcClient.CallContext(rpcContext(r), "",
 			"Cluster",
-			"Pin",
+			method,
 			ps,
-			&struct{}{})
-		sendAcceptedResponse(w, err)
+			&result)
+		if checkRPCErr(w, err) {
+			sendJSONResponse(w, http.StatusAccepted, result)
+		}
 		logger.Debug("rest api pinHandler done")
 	}
 }
 
+// pinUpdateHandler pins the "to" Cid with the options and allocations of
+// the existing pin of "hash", which is unpinned when the "unpin" query
+// parameter is true.
+func (api *API) pinUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	for _, h := range []string{vars["hash"], vars["to"]} {
+		if _, err := cid.Decode(h); err != nil {
+			sendErrorResponse(w, 400, "error decoding Cid: "+err.Error())
+			return
+		}
+	}
+
+	var pin types.PinSerial
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"PinUpdate",
+		types.PinUpdateRequest{
+			From:  vars["hash"],
+			To:    vars["to"],
+			Unpin: r.URL.Query().Get("unpin") == "true",
+		},
+		&pin)
+	if checkRPCErr(w, err) {
+		sendJSONResponse(w, http.StatusAccepted, pin)
+	}
+}
+
+// addHandler imports the files in a multipart/form-data body, as
+// accepted by "ipfs add", and pins the roots of the imported content
+// with the pin options given in the query parameters. The "chunker",
+// "cid_version", "hash", "raw_leaves" and "wrap_with_directory"
+// parameters set how the content is imported. The body is streamed to
+// the IPFS daemon and cannot be larger than the MaxAddSize.
+func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		sendErrorResponse(w, 400, "the body must be multipart/form-data")
+		return
+	}
+
+	pin, ok := parsePinOptionsOrError(w, r, types.PinSerial{})
+	if !ok {
+		return
+	}
+
+	queryValues := r.URL.Query()
+	params := types.AddParams{
+		Chunker:           queryValues.Get("chunker"),
+		Hash:              queryValues.Get("hash"),
+		RawLeaves:         queryValues.Get("raw_leaves") == "true",
+		WrapWithDirectory: queryValues.Get("wrap_with_directory") == "true",
+	}
+	if v := queryValues.Get("cid_version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			sendErrorResponse(w, 400, "invalid cid_version: must be 0 or 1")
+			return
+		}
+		params.CidVersion = version
+	}
+	if err := params.Validate(); err != nil {
+		sendErrorResponse(w, 400, err.Error())
+		return
+	}
+	params.Shard = queryValues.Get("shard") == "true"
+	if v := queryValues.Get("shard_size"); v != "" {
+		size, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || size == 0 {
+			sendErrorResponse(w, 400, "invalid shard_size: must be a positive integer")
+			return
+		}
+		params.ShardSize = size
+	}
+
+	if r.ContentLength > api.config.MaxAddSize {
+		sendErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the body is larger than %d bytes", api.config.MaxAddSize))
+		return
+	}
+
+	// the body is streamed to the IPFS daemon
+	var added []types.AddedOutput
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"Add",
+		types.AddRequest{
+			Params:      params,
+			Pin:         pin,
+			ContentType: contentType,
+			Body:        http.MaxBytesReader(w, r.Body, api.config.MaxAddSize),
+		},
+		&added)
+	if checkRPCErr(w, err) {
+		sendJSONResponse(w, http.StatusOK, added)
+	}
+}
+
+// importCARHandler imports the CAR file in the body and pins its roots
+// with the pin options given in the query parameters. Like the body of
+// add requests, the CAR file is streamed to the IPFS daemon and cannot be
+// larger than the MaxAddSize.
+func (api *API) importCARHandler(w http.ResponseWriter, r *http.Request) {
+	pin, ok := parsePinOptionsOrError(w, r, types.PinSerial{})
+	if !ok {
+		return
+	}
+
+	if r.ContentLength == 0 {
+		sendErrorResponse(w, 400, "the body must be a CAR file")
+		return
+	}
+	if r.ContentLength > api.config.MaxAddSize {
+		sendErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the body is larger than %d bytes", api.config.MaxAddSize))
+		return
+	}
+
+	var pins []types.PinSerial
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"ImportCAR",
+		types.CARImportRequest{
+			Pin:  pin,
+			Body: http.MaxBytesReader(w, r.Body, api.config.MaxAddSize),
+		},
+		&pins)
+	if checkRPCErr(w, err) {
+		sendJSONResponse(w, http.StatusOK, pins)
+	}
+}
+
+// exportCARHandler streams the DAG of a pinned Cid as a CAR file. Errors
+// happening once the CAR file is being sent are reported in the
+// StreamErrorTrailer.
+func (api *API) exportCARHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := parseCidOrError(w, r); ps.Cid != "" {
+		cw := &carWriter{w: w}
+		err := api.rpcClient.CallContext(rpcContext(r), "",
+			"Cluster",
+			"ExportCAR",
+			types.CARExportRequest{
+				Cid:    ps.Cid,
+				Writer: cw,
+			},
+			&struct{}{})
+		switch {
+		case !cw.started:
+			if checkRPCErr(w, err) {
+				cw.start()
+			}
+		case err != nil:
+			logger.Errorf("error exporting %s: %s", ps.Cid, err)
+			w.Header().Set(types.StreamErrorTrailer, err.Error())
+		}
+	}
+}
+
+// carWriter sends the headers of a response carrying a CAR file before
+// its first write.
+type carWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (cw *carWriter) start() {
+	if cw.started {
+		return
+	}
+	cw.started = true
+	cw.w.Header().Set("Content-Type", "application/vnd.ipld.car")
+	cw.w.Header().Set("Trailer", types.StreamErrorTrailer)
+	cw.w.WriteHeader(http.StatusOK)
+}
+
+func (cw *carWriter) Write(p []byte) (int, error) {
+	cw.start()
+	return cw.w.Write(p)
+}
+
 func (api *API) unpinHandler(w http.ResponseWriter, r *http.Request) {
 	if ps := parseCidOrError(w, r); ps.Cid != "" {
 		logger.Debugf("rest api unpinHandler: %s", ps.Cid)
-		err := api.rpcClient.Call("",
+		err := api.rpcClient.CallContext(rpcContext(r), "",
 			"Cluster",
 			"Unpin",
 			ps,
@@ -559,20 +1301,125 @@ func (api *API) unpinHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// unquarantineHandler makes the cluster accept again the metrics from a
+// quarantined peer.
+func (api *API) unquarantineHandler(w http.ResponseWriter, r *http.Request) {
+	pid, err := peer.IDB58Decode(mux.Vars(r)["peer"])
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding peer: "+err.Error())
+		return
+	}
+
+	err = api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"Unquarantine",
+		pid,
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+// failPeerHandler simulates the failure of a peer during the time given
+// in the "duration" parameter (1 minute by default).
+func (api *API) failPeerHandler(w http.ResponseWriter, r *http.Request) {
+	pid, err := peer.IDB58Decode(mux.Vars(r)["peer"])
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding peer: "+err.Error())
+		return
+	}
+
+	d := time.Minute
+	if dStr := r.URL.Query().Get("duration"); dStr != "" {
+		d, err = time.ParseDuration(dStr)
+		if err != nil || d <= 0 {
+			sendErrorResponse(w, 400, "error parsing duration")
+			return
+		}
+	}
+
+	err = api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"FailPeer",
+		types.FailPeerRequest{
+			Peer:     pid,
+			Duration: d,
+		},
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+func (api *API) strayPinsHandler(w http.ResponseWriter, r *http.Request) {
+	var strays []types.StrayPin
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"StrayPins",
+		struct{}{},
+		&strays)
+	sendResponse(w, err, strays)
+}
+
+// remediateStrayPinHandler applies the remediation given in the "action"
+// parameter (adopt, ignore or remove) to a stray pin reported by a peer.
+func (api *API) remediateStrayPinHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := peer.IDB58Decode(vars["peer"]); err != nil {
+		sendErrorResponse(w, 400, "error decoding peer: "+err.Error())
+		return
+	}
+	if _, err := cid.Decode(vars["hash"]); err != nil {
+		sendErrorResponse(w, 400, "error decoding Cid: "+err.Error())
+		return
+	}
+
+	action := types.StrayPinAction(r.URL.Query().Get("action"))
+	switch action {
+	case types.StrayPinAdopt, types.StrayPinIgnore, types.StrayPinRemove:
+	default:
+		sendErrorResponse(w, 400, "action must be adopt, ignore or remove")
+		return
+	}
+
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"RemediateStrayPin",
+		types.StrayPinRemediation{
+			Peer:   vars["peer"],
+			Cid:    vars["hash"],
+			Action: action,
+		},
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+// allocationsHandler lists the pins in the shared state. They can be
+// filtered by name (substring) and metadata with the "name" and
+// "meta-<key>" query parameters.
 func (api *API) allocationsHandler(w http.ResponseWriter, r *http.Request) {
 	var pins []types.PinSerial
-	err := api.rpcClient.Call("",
+	err := api.rpcClient.CallContext(rpcContext(r), "",
 		"Cluster",
 		"Pins",
 		struct{}{},
 		&pins)
-	sendResponse(w, err, pins)
+
+	queryValues := r.URL.Query()
+	name := queryValues.Get("name")
+	metadata := parseMetadata(queryValues)
+	if name != "" || len(metadata) > 0 {
+		filtered := make([]types.PinSerial, 0, len(pins))
+		for _, pin := range pins {
+			if pin.MatchesFilter(name, metadata) {
+				filtered = append(filtered, pin)
+			}
+		}
+		pins = filtered
+	}
+	sendFieldsResponse(w, r, err, pins)
 }
 
 func (api *API) allocationHandler(w http.ResponseWriter, r *http.Request) {
 	if ps := parseCidOrError(w, r); ps.Cid != "" {
 		var pin types.PinSerial
-		err := api.rpcClient.Call("",
+		err := api.rpcClient.CallContext(rpcContext(r), "",
 			"Cluster",
 			"PinGet",
 			ps,
@@ -581,8 +1428,161 @@ func (api *API) allocationHandler(w http.ResponseWriter, r *http.Request) {
 			sendErrorResponse(w, 404, err.Error())
 			return
 		}
-		sendJSONResponse(w, 200, pin)
+		sendFieldsResponse(w, r, nil, pin)
+	}
+}
+
+// allocationHistoryHandler returns the changes of the allocations of a
+// Cid made by the cluster peers.
+func (api *API) allocationHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := parseCidOrError(w, r); ps.Cid != "" {
+		var history []types.AllocationChange
+		err := api.rpcClient.CallContext(rpcContext(r), "",
+			"Cluster",
+			"AllocationHistory",
+			ps,
+			&history)
+		sendResponse(w, err, history)
+	}
+}
+
+// allocationPreviewHandler returns the allocations that pinning the Cid
+// given in the "cid" parameter would have, without pinning it. The
+// "replication" parameter sets both replication factors and the pin
+// options accepted when pinning can be used too.
+func (api *API) allocationPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	ps := parsePinOrError(w, r, r.URL.Query().Get("cid"))
+	if ps.Cid == "" {
+		return
+	}
+
+	if rplStr := r.URL.Query().Get("replication"); rplStr != "" {
+		rpl, err := strconv.Atoi(rplStr)
+		if err != nil {
+			sendErrorResponse(w, 400, "invalid replication: not a number")
+			return
+		}
+		ps.ReplicationFactorMin = rpl
+		ps.ReplicationFactorMax = rpl
+		if err := ps.ToPin().Validate(); err != nil {
+			sendErrorResponse(w, 400, err.Error())
+			return
+		}
+	}
+
+	var pin types.PinSerial
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"AllocationPreview",
+		ps,
+		&pin)
+	sendResponse(w, err, pin)
+}
+
+func (api *API) kvListHandler(w http.ResponseWriter, r *http.Request) {
+	var kvs []types.KV
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"KVs",
+		struct{}{},
+		&kvs)
+	sendResponse(w, err, kvs)
+}
+
+func (api *API) kvGetHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	var kv types.KV
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"KVGet",
+		key,
+		&kv)
+	if err != nil { // errors here are 404s
+		sendErrorResponse(w, 404, err.Error())
+		return
+	}
+	sendJSONResponse(w, 200, kv)
+}
+
+// kvSetHandler stores the request body as the value for the given key.
+func (api *API) kvSetHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	value, err := ioutil.ReadAll(io.LimitReader(r.Body, types.MaxKVValueSize+1))
+	if err != nil {
+		sendErrorResponse(w, 400, "error reading request body: "+err.Error())
+		return
+	}
+
+	kv := types.KV{
+		Key:   mux.Vars(r)["key"],
+		Value: string(value),
+	}
+	if err := kv.Validate(); err != nil {
+		sendErrorResponse(w, 400, err.Error())
+		return
+	}
+
+	err = api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"KVSet",
+		kv,
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+func (api *API) kvRmHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"KVRm",
+		key,
+		&struct{}{})
+	sendEmptyResponse(w, err)
+}
+
+func (api *API) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	var webhooks []types.Webhook
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"Webhooks",
+		struct{}{},
+		&webhooks)
+	sendResponse(w, err, webhooks)
+}
+
+// webhookAddHandler registers the webhook in the request body. Its ID is
+// assigned by the cluster.
+func (api *API) webhookAddHandler(w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	var wh types.Webhook
+	if err := dec.Decode(&wh); err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
 	}
+	if err := wh.Validate(); err != nil {
+		sendErrorResponse(w, 400, err.Error())
+		return
+	}
+
+	var added types.Webhook
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"WebhookAdd",
+		wh,
+		&added)
+	sendResponse(w, err, added)
+}
+
+func (api *API) webhookRmHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	err := api.rpcClient.CallContext(rpcContext(r), "",
+		"Cluster",
+		"WebhookRm",
+		id,
+		&struct{}{})
+	sendEmptyResponse(w, err)
 }
 
 func (api *API) statusAllHandler(w http.ResponseWriter, r *http.Request) {
@@ -591,20 +1591,59 @@ func (api *API) statusAllHandler(w http.ResponseWriter, r *http.Request) {
 
 	if local == "true" {
 		var pinInfos []types.PinInfoSerial
-		err := api.rpcClient.Call("",
+		err := api.rpcClient.CallContext(rpcContext(r), "",
 			"Cluster",
 			"StatusAllLocal",
 			struct{}{},
 			&pinInfos)
-		sendResponse(w, err, pinInfosToGlobal(pinInfos))
+		sendFieldsResponse(w, r, err, hideRemote(r, pinInfosToGlobal(pinInfos)))
 	} else {
 		var pinInfos []types.GlobalPinInfoSerial
-		err := api.rpcClient.Call("",
+		err := api.rpcClient.CallContext(rpcContext(r), "",
 			"Cluster",
 			"StatusAll",
 			struct{}{},
 			&pinInfos)
-		sendResponse(w, err, pinInfos)
+		sendFieldsResponse(w, r, err, hideRemote(r, pinInfos))
+	}
+}
+
+func (api *API) statusCidsHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	local := queryValues.Get("local")
+
+	var body statusCidsBody
+	dec := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	err := dec.Decode(&body)
+	if err != nil {
+		sendErrorResponse(w, 400, "error decoding request body")
+		return
+	}
+
+	for _, c := range body.Cids {
+		if _, err := cid.Decode(c); err != nil {
+			sendErrorResponse(w, 400, fmt.Sprintf("error decoding Cid %s: %s", c, err))
+			return
+		}
+	}
+
+	if local == "true" {
+		var pinInfos []types.PinInfoSerial
+		err := api.rpcClient.CallContext(rpcContext(r), "",
+			"Cluster",
+			"TrackerStatusCids",
+			body.Cids,
+			&pinInfos)
+		sendFieldsResponse(w, r, err, hideRemote(r, pinInfosToGlobal(pinInfos)))
+	} else {
+		var pinInfos []types.GlobalPinInfoSerial
+		err := api.rpcClient.CallContext(rpcContext(r), "",
+			"Cluster",
+			"StatusCids",
+			body.Cids,
+			&pinInfos)
+		sendFieldsResponse(w, r, err, hideRemote(r, pinInfos))
 	}
 }
 
@@ -615,20 +1654,20 @@ func (api *API) statusHandler(w http.ResponseWriter, r *http.Request) {
 	if ps := parseCidOrError(w, r); ps.Cid != "" {
 		if local == "true" {
 			var pinInfo types.PinInfoSerial
-			err := api.rpcClient.Call("",
+			err := api.rpcClient.CallContext(rpcContext(r), "",
 				"Cluster",
 				"StatusLocal",
 				ps,
 				&pinInfo)
-			sendResponse(w, err, pinInfoToGlobal(pinInfo))
+			sendFieldsResponse(w, r, err, pinInfoToGlobal(pinInfo))
 		} else {
 			var pinInfo types.GlobalPinInfoSerial
-			err := api.rpcClient.Call("",
+			err := api.rpcClient.CallContext(rpcContext(r), "",
 				"Cluster",
 				"Status",
 				ps,
 				&pinInfo)
-			sendResponse(w, err, pinInfo)
+			sendFieldsResponse(w, r, err, pinInfo)
 		}
 	}
 }
@@ -639,7 +1678,7 @@ func (api *API) syncAllHandler(w http.ResponseWriter, r *http.Request) {
 
 	if local == "true" {
 		var pinInfos []types.PinInfoSerial
-		err := api.rpcClient.Call("",
+		err := api.rpcClient.CallContext(rpcContext(r), "",
 			"Cluster",
 			"SyncAllLocal",
 			struct{}{},
@@ -647,7 +1686,7 @@ func (api *API) syncAllHandler(w http.ResponseWriter, r *http.Request) {
 		sendResponse(w, err, pinInfosToGlobal(pinInfos))
 	} else {
 		var pinInfos []types.GlobalPinInfoSerial
-		err := api.rpcClient.Call("",
+		err := api.rpcClient.CallContext(rpcContext(r), "",
 			"Cluster",
 			"SyncAll",
 			struct{}{},
@@ -663,7 +1702,7 @@ func (api *API) syncHandler(w http.ResponseWriter, r *http.Request) {
 	if ps := parseCidOrError(w, r); ps.Cid != "" {
 		if local == "true" {
 			var pinInfo types.PinInfoSerial
-			err := api.rpcClient.Call("",
+			err := api.rpcClient.CallContext(rpcContext(r), "",
 				"Cluster",
 				"SyncLocal",
 				ps,
@@ -671,7 +1710,7 @@ func (api *API) syncHandler(w http.ResponseWriter, r *http.Request) {
 			sendResponse(w, err, pinInfoToGlobal(pinInfo))
 		} else {
 			var pinInfo types.GlobalPinInfoSerial
-			err := api.rpcClient.Call("",
+			err := api.rpcClient.CallContext(rpcContext(r), "",
 				"Cluster",
 				"Sync",
 				ps,
@@ -686,7 +1725,7 @@ func (api *API) recoverAllHandler(w http.ResponseWriter, r *http.Request) {
 	local := queryValues.Get("local")
 	if local == "true" {
 		var pinInfos []types.PinInfoSerial
-		err := api.rpcClient.Call("",
+		err := api.rpcClient.CallContext(rpcContext(r), "",
 			"Cluster",
 			"RecoverAllLocal",
 			struct{}{},
@@ -704,7 +1743,7 @@ func (api *API) recoverHandler(w http.ResponseWriter, r *http.Request) {
 	if ps := parseCidOrError(w, r); ps.Cid != "" {
 		if local == "true" {
 			var pinInfo types.PinInfoSerial
-			err := api.rpcClient.Call("",
+			err := api.rpcClient.CallContext(rpcContext(r), "",
 				"Cluster",
 				"RecoverLocal",
 				ps,
@@ -712,7 +1751,7 @@ func (api *API) recoverHandler(w http.ResponseWriter, r *http.Request) {
 			sendResponse(w, err, pinInfoToGlobal(pinInfo))
 		} else {
 			var pinInfo types.GlobalPinInfoSerial
-			err := api.rpcClient.Call("",
+			err := api.rpcClient.CallContext(rpcContext(r), "",
 				"Cluster",
 				"Recover",
 				ps,
@@ -722,24 +1761,87 @@ func (api *API) recoverHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// pinHistoryHandler returns the last pin and unpin attempts made by
+// the cluster peers on a Cid.
+func (api *API) pinHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := parseCidOrError(w, r); ps.Cid != "" {
+		var history []types.PinAttempt
+		err := api.rpcClient.CallContext(rpcContext(r), "",
+			"Cluster",
+			"PinHistory",
+			ps,
+			&history)
+		sendResponse(w, err, history)
+	}
+}
+
+// pinEstimateHandler returns the size of a Cid, the space that pinning it
+// with the given options would use and whether it can be pinned, without
+// pinning it.
+func (api *API) pinEstimateHandler(w http.ResponseWriter, r *http.Request) {
+	if ps := parseCidOrError(w, r); ps.Cid != "" {
+		var est types.PinEstimate
+		err := api.rpcClient.CallContext(rpcContext(r), "",
+			"Cluster",
+			"PinEstimate",
+			ps,
+			&est)
+		sendResponse(w, err, est)
+	}
+}
+
 func parseCidOrError(w http.ResponseWriter, r *http.Request) types.PinSerial {
-	vars := mux.Vars(r)
-	hash := vars["hash"]
+	return parsePinOrError(w, r, mux.Vars(r)["hash"])
+}
 
+// parsePinOrError builds a pin for the given Cid with the options set in
+// the query parameters of the request.
+func parsePinOrError(w http.ResponseWriter, r *http.Request, hash string) types.PinSerial {
 	_, err := cid.Decode(hash)
 	if err != nil {
 		sendErrorResponse(w, 400, "error decoding Cid: "+err.Error())
 		return types.PinSerial{Cid: ""}
 	}
 
-	pin := types.PinSerial{
-		Cid: hash,
+	pin, ok := parsePinOptionsOrError(w, r, types.PinSerial{Cid: hash})
+	if !ok {
+		return types.PinSerial{Cid: ""}
+	}
+
+	if err := pin.ToPin().Validate(); err != nil {
+		sendErrorResponse(w, 400, err.Error())
+		return types.PinSerial{Cid: ""}
 	}
 
+	return pin
+}
+
+// parsePinOptionsOrError sets the options given in the query parameters
+// of the request on the given pin. It returns false when an error
+// response was sent.
+func parsePinOptionsOrError(w http.ResponseWriter, r *http.Request, pin types.PinSerial) (types.PinSerial, bool) {
 	queryValues := r.URL.Query()
 	name := queryValues.Get("name")
 	pin.Name = name
-	pin.Recursive = true // For now all CLI pins are recursive
+	pin.Priority = types.PinPriority(queryValues.Get("priority"))
+	pin.Metadata = parseMetadata(queryValues)
+	switch mode := queryValues.Get("mode"); mode {
+	case "", "recursive":
+		pin.Recursive = true
+	case "direct":
+		pin.Recursive = false
+	default:
+		sendErrorResponse(w, 400, "invalid mode: must be recursive or direct")
+		return pin, false
+	}
+	if depthStr := queryValues.Get("max_depth"); depthStr != "" {
+		depth, err := strconv.Atoi(depthStr)
+		if err != nil {
+			sendErrorResponse(w, 400, "invalid max_depth: not a number")
+			return pin, false
+		}
+		pin.MaxDepth = depth
+	}
 	rplStr := queryValues.Get("replication_factor")
 	rplStrMin := queryValues.Get("replication_factor_min")
 	rplStrMax := queryValues.Get("replication_factor_max")
@@ -747,14 +1849,90 @@ func parseCidOrError(w http.ResponseWriter, r *http.Request) types.PinSerial {
 		rplStrMin = rplStr
 		rplStrMax = rplStr
 	}
-	if rpl, err := strconv.Atoi(rplStrMin); err == nil {
+	if rplStrMin != "" {
+		rpl, err := strconv.Atoi(rplStrMin)
+		if err != nil {
+			sendErrorResponse(w, 400, "invalid replication_factor_min: not a number")
+			return pin, false
+		}
 		pin.ReplicationFactorMin = rpl
 	}
-	if rpl, err := strconv.Atoi(rplStrMax); err == nil {
+	if rplStrMax != "" {
+		rpl, err := strconv.Atoi(rplStrMax)
+		if err != nil {
+			sendErrorResponse(w, 400, "invalid replication_factor_max: not a number")
+			return pin, false
+		}
 		pin.ReplicationFactorMax = rpl
 	}
 
-	return pin
+	if excludeStr := queryValues.Get("exclude_peers"); excludeStr != "" {
+		for _, pstr := range strings.Split(excludeStr, ",") {
+			if _, err := peer.IDB58Decode(pstr); err != nil {
+				sendErrorResponse(w, 400, "invalid exclude_peers: "+err.Error())
+				return pin, false
+			}
+			pin.ExcludePeers = append(pin.ExcludePeers, pstr)
+		}
+	}
+
+	if allowStr := queryValues.Get("allow_peers"); allowStr != "" {
+		for _, pstr := range strings.Split(allowStr, ",") {
+			if _, err := peer.IDB58Decode(pstr); err != nil {
+				sendErrorResponse(w, 400, "invalid allow_peers: "+err.Error())
+				return pin, false
+			}
+			pin.AllowPeers = append(pin.AllowPeers, pstr)
+		}
+	}
+
+	if expireStr := queryValues.Get("expire_at"); expireStr != "" {
+		expireAt, err := parseTimeParam(expireStr)
+		if err != nil {
+			sendErrorResponse(w, 400, "invalid expire_at: "+err.Error())
+			return pin, false
+		}
+		pin.ExpireAt = expireAt.UnixNano()
+	}
+
+	if expireStr := queryValues.Get("expire_in"); expireStr != "" {
+		expireIn, err := time.ParseDuration(expireStr)
+		if err != nil || expireIn <= 0 {
+			sendErrorResponse(w, 400, "invalid expire_in: not a positive duration")
+			return pin, false
+		}
+		pin.ExpireAt = time.Now().Add(expireIn).UnixNano()
+	}
+
+	return pin, true
+}
+
+// metadataParamPrefix prefixes the query parameters which carry pin
+// metadata, i.e. "meta-owner=alice".
+const metadataParamPrefix = "meta-"
+
+// parseMetadata extracts the pin metadata from the query parameters. It
+// returns nil when there is none.
+func parseMetadata(queryValues url.Values) map[string]string {
+	var metadata map[string]string
+	for k, v := range queryValues {
+		if !strings.HasPrefix(k, metadataParamPrefix) || len(v) == 0 {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[strings.TrimPrefix(k, metadataParamPrefix)] = v[0]
+	}
+	return metadata
+}
+
+// parseTimeParam accepts RFC3339 dates or unix timestamps (in seconds).
+func parseTimeParam(str string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, str)
 }
 
 func parsePidOrError(w http.ResponseWriter, r *http.Request) peer.ID {
@@ -785,17 +1963,55 @@ func pinInfosToGlobal(pInfos []types.PinInfoSerial) []types.GlobalPinInfoSerial
 	return gPInfos
 }
 
+// hideRemote removes the entries of the peers which are not allocated the
+// items (REMOTE status) when the request sets remote=false. Items left
+// without entries are dropped.
+func hideRemote(r *http.Request, gpis []types.GlobalPinInfoSerial) []types.GlobalPinInfoSerial {
+	if r.URL.Query().Get("remote") != "false" {
+		return gpis
+	}
+	remote := types.TrackerStatusRemote.String()
+	filtered := make([]types.GlobalPinInfoSerial, 0, len(gpis))
+	for _, gpi := range gpis {
+		for p, pinfo := range gpi.PeerMap {
+			if pinfo.Status == remote {
+				delete(gpi.PeerMap, p)
+			}
+		}
+		if len(gpi.PeerMap) > 0 {
+			filtered = append(filtered, gpi)
+		}
+	}
+	return filtered
+}
+
 func sendResponse(w http.ResponseWriter, rpcErr error, resp interface{}) {
 	if checkRPCErr(w, rpcErr) {
 		sendJSONResponse(w, 200, resp)
 	}
 }
 
+// rpcContext returns the context for the RPC calls made to serve a
+// request. It carries the origin of the request and it is cancelled when
+// its RequestTimeoutHeader expires.
+func rpcContext(r *http.Request) context.Context {
+	ctx, ok := r.Context().Value(deadlineKey{}).(context.Context)
+	if !ok {
+		ctx = context.Background()
+	}
+	user, _, _ := r.BasicAuth()
+	return types.ContextWithOrigin(ctx, types.APIOrigin(user, r.RemoteAddr))
+}
+
 // checkRPCErr takes care of returning standard error responses if we
 // pass an error to it. It returns true when everythings OK (no error
 // was handled), or false otherwise.
 func checkRPCErr(w http.ResponseWriter, err error) bool {
 	if err != nil {
+		if aerr, ok := types.ParseAllocationError(err.Error()); ok {
+			sendAllocationErrorResponse(w, aerr)
+			return false
+		}
 		sendErrorResponse(w, 500, err.Error())
 		return false
 	}
@@ -822,6 +2038,18 @@ func sendJSONResponse(w http.ResponseWriter, code int, resp interface{}) {
 	}
 }
 
+// sendAllocationErrorResponse sends an error response which lists the
+// peers considered for allocation and why they could not be used.
+func sendAllocationErrorResponse(w http.ResponseWriter, aerr *types.AllocationError) {
+	errorResp := types.Error{
+		Code:       500,
+		Message:    aerr.Summary(),
+		Allocation: aerr,
+	}
+	logger.Errorf("sending error response: %d: %s", errorResp.Code, errorResp.Message)
+	sendJSONResponse(w, errorResp.Code, errorResp)
+}
+
 func sendErrorResponse(w http.ResponseWriter, code int, msg string) {
 	errorResp := types.Error{
 		Code:    code,
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"testing"
 	"strings"
@@ -167,6 +168,14 @@ func makePost(t *testing.T, rest *API, url string, body []byte, resp interface{}
 	processResp(t, httpResp, err, resp)
 }
 
+func makePostWithContentType(t *testing.T, rest *API, url, contentType string, body []byte, resp interface{}) {
+	h := makeHost(t, rest)
+	defer h.Close()
+	c := httpClient(t, h, strings.HasPrefix(url, "https"))
+	httpResp, err := c.Post(url, contentType, bytes.NewReader(body))
+	processResp(t, httpResp, err, resp)
+}
+
 func makeDelete(t *testing.T, rest *API, url string, resp interface{}) {
 	h := makeHost(t, rest)
 	defer h.Close()
@@ -176,6 +185,15 @@ func makeDelete(t *testing.T, rest *API, url string, resp interface{}) {
 	processResp(t, httpResp, err, resp)
 }
 
+func makePut(t *testing.T, rest *API, url string, body []byte, resp interface{}) {
+	h := makeHost(t, rest)
+	defer h.Close()
+	c := httpClient(t, h, strings.HasPrefix(url, "https"))
+	req, _ := http.NewRequest("PUT", url, bytes.NewReader(body))
+	httpResp, err := c.Do(req)
+	processResp(t, httpResp, err, resp)
+}
+
 type testF func(t *testing.T, url urlF)
 
 func testBothEndpoints(t *testing.T, test testF) {
@@ -211,6 +229,37 @@ func TestAPIShutdown(t *testing.T) {
 
 }
 
+func TestAPISetHTTPListenAddr(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	oldURL := httpURL(rest)
+	ver := api.Version{}
+	makeGet(t, rest, oldURL+"/version", &ver)
+
+	newAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+	err := rest.SetHTTPListenAddr(newAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newURL := httpURL(rest)
+	if newURL == oldURL {
+		t.Fatal("the HTTP address should have changed")
+	}
+
+	ver = api.Version{}
+	makeGet(t, rest, newURL+"/version", &ver)
+	if ver.Version != "0.0.mock" {
+		t.Error("the new listener should serve requests")
+	}
+
+	_, err = http.Get(oldURL + "/version")
+	if err == nil {
+		t.Error("the old listener should be closed")
+	}
+}
+
 func TestRestAPIIDEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	httpsrest := testHTTPSAPI(t)
@@ -251,6 +300,282 @@ func TestAPIVersionEndpoint(t *testing.T) {
 	testBothEndpoints(t, tf)
 }
 
+func TestAPIRequestTimeout(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		h := makeHost(t, rest)
+		defer h.Close()
+		c := httpClient(t, h, false)
+
+		for timeout, code := range map[string]int{"10s": 200, "abc": 400, "-1s": 400} {
+			req, _ := http.NewRequest("GET", url(rest)+"/version", nil)
+			req.Header.Set(api.RequestTimeoutHeader, timeout)
+			httpResp, err := c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			httpResp.Body.Close()
+			if httpResp.StatusCode != code {
+				t.Errorf("%s: expected %d, got %d", timeout, code, httpResp.StatusCode)
+			}
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestReadinessExempt(t *testing.T) {
+	for path, exempt := range map[string]bool{
+		"/metrics":      true,
+		"/health/graph": true,
+		"/health/raft":  true,
+		"/healthz":      false,
+		"/pins":         false,
+		"/id":           false,
+	} {
+		if readinessExempt(path) != exempt {
+			t.Errorf("%s: expected exempt to be %t", path, exempt)
+		}
+	}
+}
+
+func TestRPCContext(t *testing.T) {
+	reqCtx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", "/version", nil)
+	req = req.WithContext(reqCtx)
+
+	var ctx context.Context
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		ctx = rpcContext(r)
+	}
+
+	requestTimeout(handler)(nil, req)
+	cancel()
+	if ctx.Err() != nil {
+		t.Error("the RPC context should not be cancelled with the request")
+	}
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("the RPC context should have no deadline")
+	}
+
+	req.Header.Set(api.RequestTimeoutHeader, "10s")
+	requestTimeout(handler)(nil, req)
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("the RPC context should expire with the request timeout")
+	}
+}
+
+func TestAPIFeaturesEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var support []api.FeatureSupport
+		makeGet(t, rest, url(rest)+"/features", &support)
+		if len(support) != 1 || support[0].Feature != api.FeatureDrain || support[0].Total != 2 {
+			t.Error("unexpected feature support:", support)
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIShutdownEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		makePost(t, rest, url(rest)+"/shutdown", []byte{}, &struct{}{})
+		makePost(t, rest, url(rest)+"/shutdown?all=true", []byte{}, &struct{}{})
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIEventsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var events []api.Event
+		makeGet(t, rest, url(rest)+"/events?since=1500000000", &events)
+		if len(events) != 1 || events[0].Type != api.EventPin {
+			t.Error("expected one pin event")
+		}
+
+		errResp := api.Error{}
+		makeGet(t, rest, url(rest)+"/events?since=yesterday", &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected error parsing since")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIPushMetricEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		body := []byte(`{"name": "gpu", "value": "4", "ttl": "1m"}`)
+		makePost(t, rest, url(rest)+"/monitor/metrics", body, &struct{}{})
+
+		errResp := api.Error{}
+		body = []byte(`{"name": "gpu", "value": "4"}`)
+		makePost(t, rest, url(rest)+"/monitor/metrics", body, &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected error without ttl")
+		}
+
+		errResp = api.Error{}
+		body = []byte(`{"name": "ping", "value": "ok", "ttl": "1m"}`)
+		makePost(t, rest, url(rest)+"/monitor/metrics", body, &errResp)
+		if errResp.Code != 500 {
+			t.Error("expected error pushing a ping metric")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIFailPeerEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		prefix := url(rest) + "/debug/fail-peer/"
+		makePost(t, rest, prefix+test.TestPeerID1.Pretty()+"?duration=30s", []byte{}, &struct{}{})
+
+		errResp := api.Error{}
+		makePost(t, rest, prefix+test.TestPeerID1.Pretty()+"?duration=soon", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected error parsing duration")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, prefix+test.TestPeerID3.Pretty(), []byte{}, &errResp)
+		if errResp.Code != 500 {
+			t.Error("expected an error when debug operations are disabled")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIUnquarantineEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		prefix := url(rest) + "/monitor/quarantine/"
+		makeDelete(t, rest, prefix+test.TestPeerID1.Pretty(), &struct{}{})
+
+		errResp := api.Error{}
+		makeDelete(t, rest, prefix+"abc", &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected error decoding peer")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIStrayPinsEndpoints(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var strays []api.StrayPin
+		makeGet(t, rest, url(rest)+"/pins/stray", &strays)
+		if len(strays) != 1 || strays[0].Cid != test.TestCid2 {
+			t.Error("expected one stray pin")
+		}
+
+		prefix := url(rest) + "/pins/stray/" + test.TestPeerID1.Pretty() + "/"
+		makePost(t, rest, prefix+test.TestCid2+"?action=ignore", []byte{}, &struct{}{})
+
+		errResp := api.Error{}
+		makePost(t, rest, prefix+test.TestCid2+"?action=delete", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected error with an unknown action")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, prefix+test.ErrorCid+"?action=remove", []byte{}, &errResp)
+		if errResp.Message != test.ErrBadCid.Error() {
+			t.Error("expected a different error: ", errResp.Message)
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIMonitorMetricsEndpoints(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var last []api.MetricSerial
+		makeGet(t, rest, url(rest)+"/monitor/metrics/ping", &last)
+		if len(last) != 2 || last[0].Name != "ping" {
+			t.Error("expected the last metrics of every peer")
+		}
+
+		var history []api.MetricSerial
+		makeGet(t, rest, url(rest)+"/monitor/metrics/ping/"+test.TestPeerID1.Pretty()+"?since=1500000000", &history)
+		if len(history) != 1 || history[0].Peer != test.TestPeerID1.Pretty() {
+			t.Error("expected the metric history of TestPeerID1")
+		}
+
+		history = nil
+		makeGet(t, rest, url(rest)+"/monitor/metrics/ping?peer="+test.TestPeerID1.Pretty(), &history)
+		if len(history) != 1 {
+			t.Error("expected the metric history when using the peer parameter")
+		}
+
+		errResp := api.Error{}
+		makeGet(t, rest, url(rest)+"/monitor/metrics/ping/abc", &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected error decoding peer")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIMetricsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		h := makeHost(t, rest)
+		defer h.Close()
+		c := httpClient(t, h, false)
+		httpResp, err := c.Get(url(rest) + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+		body, _ := ioutil.ReadAll(httpResp.Body)
+
+		expected := []string{
+			"# TYPE ipfscluster_peers gauge",
+			"ipfscluster_peers 3",
+			`ipfscluster_tracker_items{status="pinned"} 2`,
+		}
+		for _, e := range expected {
+			if !strings.Contains(string(body), e) {
+				t.Errorf("expected %s in metrics output", e)
+			}
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
 func TestAPIPeerstEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
@@ -314,6 +639,31 @@ func TestAPIPeerRemoveEndpoint(t *testing.T) {
 	testBothEndpoints(t, tf)
 }
 
+func TestAPIPeerAnnotateEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		annotationURL := url(rest) + "/peers/" + test.TestPeerID1.Pretty() + "/annotation"
+		makePut(t, rest, annotationURL, []byte("rack 12"), &struct{}{})
+		makeDelete(t, rest, annotationURL, &struct{}{})
+
+		errResp := api.Error{}
+		makePut(t, rest, annotationURL, []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with an empty annotation")
+		}
+
+		errResp = api.Error{}
+		makePut(t, rest, url(rest)+"/peers/"+test.TestPeerID3.Pretty()+"/annotation", []byte("rack 12"), &errResp)
+		if errResp.Code != 500 {
+			t.Error("expected the rpc error to be returned")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
 func TestConnectGraphEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
@@ -353,7 +703,11 @@ func TestAPIPinEndpoint(t *testing.T) {
 
 	tf := func(t *testing.T, url urlF) {
 		// test regular post
-		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1, []byte{}, &struct{}{})
+		var result api.PinResult
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1, []byte{}, &result)
+		if result.Action != api.PinActionPinned || result.Pin.Cid != test.TestCid1 {
+			t.Error("expected a pin result for the pinned cid")
+		}
 
 		errResp := api.Error{}
 		makePost(t, rest, url(rest)+"/pins/"+test.ErrorCid, []byte{}, &errResp)
@@ -365,6 +719,205 @@ func TestAPIPinEndpoint(t *testing.T) {
 		if errResp.Code != 400 {
 			t.Error("should fail with bad Cid")
 		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?replication_factor_min=3&replication_factor_max=2", []byte{}, &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "replication_factor_min") {
+			t.Error("should fail with bad replication factor")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?replication_factor=abc", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with a non-numeric replication factor")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?allow_peers=abc", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with a bad allowed peer")
+		}
+
+		p := test.TestPeerID1.Pretty()
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?allow_peers="+p+"&exclude_peers="+p, []byte{}, &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "allow_peers") {
+			t.Error("should fail with a peer both allowed and excluded")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?priority=urgent", []byte{}, &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "priority") {
+			t.Error("should fail with an unknown priority")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?expire_in=-1h", []byte{}, &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "expire_in") {
+			t.Error("should fail with a negative expiration")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?expire_at=tomorrow", []byte{}, &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "expire_at") {
+			t.Error("should fail with a bad expiration date")
+		}
+
+		result = api.PinResult{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?mode=direct", []byte{}, &result)
+		if result.Pin.Recursive {
+			t.Error("expected a direct pin")
+		}
+
+		result = api.PinResult{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?max_depth=2", []byte{}, &result)
+		if !result.Pin.Recursive || result.Pin.MaxDepth != 2 {
+			t.Error("expected a recursive pin with a max depth of 2:", result.Pin)
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?mode=indirect", []byte{}, &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "mode") {
+			t.Error("should fail with an unknown mode")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"?mode=direct&max_depth=1", []byte{}, &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "max_depth") {
+			t.Error("should fail with a max depth on a direct pin")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIPinUpdateEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var pin api.PinSerial
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"/update/"+test.TestCid2+"?unpin=true", []byte{}, &pin)
+		if pin.Cid != test.TestCid2 || pin.PinUpdate != test.TestCid1 {
+			t.Error("expected the updated pin:", pin)
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"/update/"+test.ErrorCid, []byte{}, &errResp)
+		if errResp.Message != test.ErrBadCid.Error() {
+			t.Error("expected different error: ", errResp.Message)
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"/update/abcd", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad Cid")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIAddEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "file")
+	fw.Write([]byte("hello"))
+	mw.Close()
+
+	tf := func(t *testing.T, url urlF) {
+		var added []api.AddedOutput
+		makePostWithContentType(t, rest, url(rest)+"/add?cid_version=1&replication_factor=2", mw.FormDataContentType(), body.Bytes(), &added)
+		if len(added) != 1 || added[0].Cid != test.TestCid1 {
+			t.Error("expected the added items:", added)
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/add", body.Bytes(), &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail without a multipart body")
+		}
+
+		errResp = api.Error{}
+		makePostWithContentType(t, rest, url(rest)+"/add?cid_version=2", mw.FormDataContentType(), body.Bytes(), &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "cid_version") {
+			t.Error("should fail with a bad cid_version")
+		}
+
+		errResp = api.Error{}
+		makePostWithContentType(t, rest, url(rest)+"/add?hash=md5", mw.FormDataContentType(), body.Bytes(), &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "hash") {
+			t.Error("should fail with a bad hash")
+		}
+
+		errResp = api.Error{}
+		makePostWithContentType(t, rest, url(rest)+"/add?chunker=size-0", mw.FormDataContentType(), body.Bytes(), &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "chunker") {
+			t.Error("should fail with a bad chunker")
+		}
+
+		added = nil
+		makePostWithContentType(t, rest, url(rest)+"/add?shard=true&shard_size=1048576", mw.FormDataContentType(), body.Bytes(), &added)
+		if len(added) != 1 {
+			t.Error("expected the added items when sharding:", added)
+		}
+
+		errResp = api.Error{}
+		makePostWithContentType(t, rest, url(rest)+"/add?shard=true&shard_size=0", mw.FormDataContentType(), body.Bytes(), &errResp)
+		if errResp.Code != 400 || !strings.Contains(errResp.Message, "shard_size") {
+			t.Error("should fail with a bad shard_size")
+		}
+
+		rest.config.MaxAddSize = 10
+		errResp = api.Error{}
+		makePostWithContentType(t, rest, url(rest)+"/add", mw.FormDataContentType(), body.Bytes(), &errResp)
+		rest.config.MaxAddSize = DefaultMaxAddSize
+		if errResp.Code != 413 {
+			t.Error("should fail with a body larger than max_add_size")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPICAREndpoints(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var pins []api.PinSerial
+		makePostWithContentType(t, rest, url(rest)+"/car?name=imported", "application/vnd.ipld.car", []byte("car file"), &pins)
+		if len(pins) != 1 || pins[0].Cid != test.TestCid1 || pins[0].Name != "imported" {
+			t.Error("expected the pinned roots:", pins)
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/car", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail without a CAR file")
+		}
+
+		h := makeHost(t, rest)
+		defer h.Close()
+		c := httpClient(t, h, false)
+		httpResp, err := c.Get(url(rest) + "/pins/" + test.TestCid1 + "/car")
+		if err != nil {
+			t.Fatal(err)
+		}
+		car, _ := ioutil.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if httpResp.StatusCode != 200 || string(car) != "car:"+test.TestCid1 {
+			t.Error("unexpected CAR file:", httpResp.StatusCode, string(car))
+		}
+
+		errResp = api.Error{}
+		makeGet(t, rest, url(rest)+"/pins/"+test.ErrorCid+"/car", &errResp)
+		if errResp.Code != 500 {
+			t.Error("should fail exporting ErrorCid")
+		}
 	}
 
 	testBothEndpoints(t, tf)
@@ -393,6 +946,85 @@ func TestAPIUnpinEndpoint(t *testing.T) {
 	testBothEndpoints(t, tf)
 }
 
+func TestAPIKVEndpoints(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var kvs []api.KV
+		makeGet(t, rest, url(rest)+"/kv", &kvs)
+		if len(kvs) != 2 || kvs[0].Key != "a" {
+			t.Error("unexpected kv list: ", kvs)
+		}
+
+		var kv api.KV
+		makeGet(t, rest, url(rest)+"/kv/a", &kv)
+		if kv.Key != "a" || kv.Value != "1" {
+			t.Error("unexpected kv: ", kv)
+		}
+
+		errResp := api.Error{}
+		makeGet(t, rest, url(rest)+"/kv/"+test.ErrorKey, &errResp)
+		if errResp.Code != 404 {
+			t.Error("expected a 404 for a missing key")
+		}
+
+		makePut(t, rest, url(rest)+"/kv/a", []byte("hello"), &struct{}{})
+
+		errResp = api.Error{}
+		makePut(t, rest, url(rest)+"/kv/a", make([]byte, api.MaxKVValueSize+1), &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected a 400 for a value which is too large")
+		}
+
+		makeDelete(t, rest, url(rest)+"/kv/a", &struct{}{})
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIWebhooksEndpoints(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var webhooks []api.Webhook
+		makeGet(t, rest, url(rest)+"/webhooks", &webhooks)
+		if len(webhooks) != 1 || webhooks[0].ID != "1" || webhooks[0].Metadata["tenant"] != "acme" {
+			t.Error("unexpected webhooks: ", webhooks)
+		}
+
+		var wh api.Webhook
+		body := []byte(`{"url":"http://localhost:9999/hook","events":["pin_error"],"namespace":"backups"}`)
+		makePost(t, rest, url(rest)+"/webhooks", body, &wh)
+		if wh.ID != "2" || wh.Namespace != "backups" || len(wh.Events) != 1 {
+			t.Error("unexpected webhook: ", wh)
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/webhooks", []byte(`{"url":"ftp://localhost/hook"}`), &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected a 400 for an invalid URL")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/webhooks", []byte(`{"url":"http://localhost/hook","events":["teleport"]}`), &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected a 400 for an unknown event type")
+		}
+
+		makeDelete(t, rest, url(rest)+"/webhooks/2", &struct{}{})
+
+		errResp = api.Error{}
+		makeDelete(t, rest, url(rest)+"/webhooks/"+test.ErrorKey, &errResp)
+		if errResp.Code != 500 {
+			t.Error("expected the rpc error to be returned")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
 func TestAPIAllocationsEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
@@ -405,6 +1037,18 @@ func TestAPIAllocationsEndpoint(t *testing.T) {
 			resp[2].Cid != test.TestCid3 {
 			t.Error("unexpected pin list: ", resp)
 		}
+
+		resp = nil
+		makeGet(t, rest, url(rest)+"/allocations?name=data&meta-owner=alice", &resp)
+		if len(resp) != 1 || resp[0].Cid != test.TestCid2 {
+			t.Error("expected the pins to be filtered: ", resp)
+		}
+
+		resp = nil
+		makeGet(t, rest, url(rest)+"/allocations?meta-owner=bob", &resp)
+		if len(resp) != 0 {
+			t.Error("expected no pins: ", resp)
+		}
 	}
 
 	testBothEndpoints(t, tf)
@@ -431,6 +1075,60 @@ func TestAPIAllocationEndpoint(t *testing.T) {
 	testBothEndpoints(t, tf)
 }
 
+func TestAPIAllocationPreviewEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var resp api.PinSerial
+		makePost(t, rest, url(rest)+"/allocations/preview?cid="+test.TestCid1+"&replication=2", []byte{}, &resp)
+		if resp.Cid != test.TestCid1 {
+			t.Error("cid should be the same")
+		}
+		if resp.ReplicationFactorMin != 2 || resp.ReplicationFactorMax != 2 {
+			t.Error("replication factors should be 2")
+		}
+		if len(resp.Allocations) != 2 {
+			t.Error("expected 2 allocations")
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/allocations/preview?cid=abcd", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with a bad cid")
+		}
+
+		errResp = api.Error{}
+		makePost(t, rest, url(rest)+"/allocations/preview?cid="+test.TestCid1+"&replication=a", []byte{}, &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with a bad replication factor")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIPinEstimateEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var est api.PinEstimate
+		makePost(t, rest, url(rest)+"/pins/"+test.TestCid1+"/estimate?replication_factor=2", []byte{}, &est)
+		if est.Cid != test.TestCid1 || est.TotalSize != 2000 || !est.Feasible {
+			t.Errorf("unexpected estimate: %+v", est)
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/pins/"+test.ErrorCid+"/estimate", []byte{}, &errResp)
+		if errResp.Message != test.ErrBadCid.Error() {
+			t.Error("expected different error: ", errResp.Message)
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
 func TestAPIStatusAllEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
@@ -450,11 +1148,77 @@ func TestAPIStatusAllEndpoint(t *testing.T) {
 		if len(resp2) != 2 {
 			t.Errorf("unexpected statusAll+local resp:\n %+v", resp)
 		}
+
+		// Test remote=false
+		var resp3 []api.GlobalPinInfoSerial
+		makeGet(t, rest, url(rest)+"/pins?remote=false", &resp3)
+		if len(resp3) != 3 || len(resp3[2].PeerMap) != 1 {
+			t.Errorf("unexpected statusAll+remote=false resp:\n %+v", resp3)
+		}
+		if _, ok := resp[2].PeerMap[test.TestPeerID2.Pretty()]; !ok {
+			t.Error("remote entries should be shown by default")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIFieldsParameter(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var allocs []map[string]interface{}
+		makeGet(t, rest, url(rest)+"/allocations?fields=cid", &allocs)
+		if len(allocs) != 3 || len(allocs[0]) != 1 || allocs[0]["cid"] != test.TestCid1 {
+			t.Errorf("unexpected allocations with fields: %+v", allocs)
+		}
+
+		var statuses []map[string]map[string]map[string]interface{}
+		makeGet(t, rest, url(rest)+"/pins?fields=peer_map.*.status", &statuses)
+		if len(statuses) != 3 {
+			t.Fatal("expected 3 items")
+		}
+		pinfo := statuses[1]["peer_map"][test.TestPeerID1.Pretty()]
+		if len(pinfo) != 1 || pinfo["status"] != "pinning" {
+			t.Errorf("unexpected status with fields: %+v", pinfo)
+		}
 	}
 
 	testBothEndpoints(t, tf)
 }
 
+func TestProjectFields(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/pins?fields=cid,peer_map.*.status,peer_map", nil)
+	fields := parseFields(r)
+	if len(fields) != 2 || fields["peer_map"] != nil {
+		t.Fatalf("unexpected fields: %+v", fields)
+	}
+
+	r, _ = http.NewRequest("GET", "/pins?fields=cid,peer_map.*.status", nil)
+	fields = parseFields(r)
+	v := map[string]interface{}{
+		"cid":  "a",
+		"name": "b",
+		"peer_map": map[string]interface{}{
+			"p1": map[string]interface{}{"status": "pinned", "error": ""},
+		},
+	}
+	out := projectFields(v, fields).(map[string]interface{})
+	if len(out) != 2 || out["cid"] != "a" {
+		t.Errorf("unexpected projection: %+v", out)
+	}
+	p1 := out["peer_map"].(map[string]interface{})["p1"].(map[string]interface{})
+	if len(p1) != 1 || p1["status"] != "pinned" {
+		t.Errorf("unexpected nested projection: %+v", p1)
+	}
+
+	r, _ = http.NewRequest("GET", "/pins", nil)
+	if parseFields(r) != nil {
+		t.Error("expected no fields")
+	}
+}
+
 func TestAPIStatusEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
@@ -493,6 +1257,37 @@ func TestAPIStatusEndpoint(t *testing.T) {
 	testBothEndpoints(t, tf)
 }
 
+func TestAPIStatusCidsEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		body := []byte(fmt.Sprintf(`{"cids": ["%s", "%s"]}`, test.TestCid1, test.TestCid2))
+		var resp []api.GlobalPinInfoSerial
+		makePost(t, rest, url(rest)+"/pins/status", body, &resp)
+		if len(resp) != 2 {
+			t.Fatal("expected two items")
+		}
+		if resp[0].Cid != test.TestCid1 || resp[1].Cid != test.TestCid2 {
+			t.Error("expected statuses for the requested cids")
+		}
+
+		var resp2 []api.GlobalPinInfoSerial
+		makePost(t, rest, url(rest)+"/pins/status?local=true", body, &resp2)
+		if len(resp2) != 2 {
+			t.Fatal("expected two items")
+		}
+
+		errResp := api.Error{}
+		makePost(t, rest, url(rest)+"/pins/status", []byte(`{"cids": ["abc"]}`), &errResp)
+		if errResp.Code != 400 {
+			t.Error("should fail with bad Cid")
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
 func TestAPISyncAllEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
@@ -557,6 +1352,84 @@ func TestAPISyncEndpoint(t *testing.T) {
 	testBothEndpoints(t, tf)
 }
 
+func TestAPIPinHistoryEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var history []api.PinAttempt
+		makeGet(t, rest, url(rest)+"/pins/"+test.TestCid1+"/history", &history)
+		if len(history) != 1 {
+			t.Fatal("expected one attempt")
+		}
+		if history[0].Cid != test.TestCid1 || history[0].Operation != "pin" || history[0].Error == "" {
+			t.Error("unexpected attempt: ", history[0])
+		}
+
+		errResp := api.Error{}
+		makeGet(t, rest, url(rest)+"/pins/"+test.ErrorCid+"/history", &errResp)
+		if errResp.Message != test.ErrBadCid.Error() {
+			t.Error("expected a different error: ", errResp.Message)
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIAllocationHistoryEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var history []api.AllocationChange
+		makeGet(t, rest, url(rest)+"/allocations/"+test.TestCid1+"/history", &history)
+		if len(history) != 1 {
+			t.Fatal("expected one change")
+		}
+		if history[0].Cid != test.TestCid1 || history[0].Reason != api.AllocationFailure {
+			t.Error("unexpected change: ", history[0])
+		}
+
+		errResp := api.Error{}
+		makeGet(t, rest, url(rest)+"/allocations/"+test.ErrorCid+"/history", &errResp)
+		if errResp.Message != test.ErrBadCid.Error() {
+			t.Error("expected a different error: ", errResp.Message)
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIRaftHealthEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var health api.RaftHealth
+		makeGet(t, rest, url(rest)+"/health/raft", &health)
+		if health.State != "Leader" || health.Term != 2 {
+			t.Error("unexpected raft health: ", health)
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
+func TestAPIPinQueueEndpoint(t *testing.T) {
+	rest := testAPI(t)
+	defer rest.Shutdown()
+
+	tf := func(t *testing.T, url urlF) {
+		var queue api.PinQueue
+		makeGet(t, rest, url(rest)+"/pins/queue", &queue)
+		if queue.InProgress != 1 || queue.PendingGC != 2 || len(queue.Operations) != 2 {
+			t.Error("unexpected pin queue: ", queue)
+		}
+	}
+
+	testBothEndpoints(t, tf)
+}
+
 func TestAPIRecoverEndpoint(t *testing.T) {
 	rest := testAPI(t)
 	defer rest.Shutdown()
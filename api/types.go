@@ -9,13 +9,21 @@
 package api
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
+	crypto "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	protocol "github.com/libp2p/go-libp2p-protocol"
 	ma "github.com/multiformats/go-multiaddr"
@@ -31,7 +39,7 @@ var logger = logging.Logger("apitypes")
 // TrackerStatus values
 const (
 	// IPFSStatus should never take this value
-	TrackerStatusBug = iota
+	TrackerStatusBug TrackerStatus = iota
 	// The cluster node is offline or not responding
 	TrackerStatusClusterError
 	// An error occurred pinning
@@ -52,6 +60,8 @@ const (
 	TrackerStatusPinQueued
 	// The item has been queued for unpinning on the IPFS daemon
 	TrackerStatusUnpinQueued
+	// The item was allocated to a peer which reached its pin limit
+	TrackerStatusOverLimit
 )
 
 // TrackerStatus represents the status of a tracked Cid in the PinTracker
@@ -69,6 +79,7 @@ var trackerStatusString = map[TrackerStatus]string{
 	TrackerStatusRemote:       "remote",
 	TrackerStatusPinQueued:    "pin_queued",
 	TrackerStatusUnpinQueued:  "unpin_queued",
+	TrackerStatusOverLimit:    "over_limit",
 }
 
 // String converts a TrackerStatus into a readable string.
@@ -127,17 +138,25 @@ func (ips IPFSPinStatus) IsPinned() bool {
 type GlobalPinInfo struct {
 	Cid     *cid.Cid
 	PeerMap map[peer.ID]PinInfo
+	// Name and Metadata of the pin, when it is in the shared state.
+	Name     string
+	Metadata map[string]string
 }
 
 // GlobalPinInfoSerial is the serializable version of GlobalPinInfo.
 type GlobalPinInfoSerial struct {
-	Cid     string                   `json:"cid"`
-	PeerMap map[string]PinInfoSerial `json:"peer_map"`
+	Cid      string                   `json:"cid"`
+	PeerMap  map[string]PinInfoSerial `json:"peer_map"`
+	Name     string                   `json:"name,omitempty"`
+	Metadata map[string]string        `json:"metadata,omitempty"`
 }
 
 // ToSerial converts a GlobalPinInfo to its serializable version.
 func (gpi GlobalPinInfo) ToSerial() GlobalPinInfoSerial {
-	s := GlobalPinInfoSerial{}
+	s := GlobalPinInfoSerial{
+		Name:     gpi.Name,
+		Metadata: gpi.Metadata,
+	}
 	if gpi.Cid != nil {
 		s.Cid = gpi.Cid.String()
 	}
@@ -155,8 +174,10 @@ func (gpis GlobalPinInfoSerial) ToGlobalPinInfo() GlobalPinInfo {
 		logger.Debug(gpis.Cid, err)
 	}
 	gpi := GlobalPinInfo{
-		Cid:     c,
-		PeerMap: make(map[peer.ID]PinInfo),
+		Cid:      c,
+		PeerMap:  make(map[peer.ID]PinInfo),
+		Name:     gpis.Name,
+		Metadata: gpis.Metadata,
 	}
 	for k, v := range gpis.PeerMap {
 		p, err := peer.IDB58Decode(k)
@@ -170,21 +191,33 @@ func (gpis GlobalPinInfoSerial) ToGlobalPinInfo() GlobalPinInfo {
 
 // PinInfo holds information about local pins.
 type PinInfo struct {
-	Cid    *cid.Cid
-	Peer   peer.ID
-	Status TrackerStatus
-	TS     time.Time
-	Error  string
+	Cid      *cid.Cid
+	Peer     peer.ID
+	Peername string
+	Status   TrackerStatus
+	TS       time.Time
+	Error    string
+	// Attempts is the number of failed attempts to pin or unpin the item.
+	Attempts int
+	// NextRetry is when the next attempt will be made, if any.
+	NextRetry time.Time
+	// Allocations lists the peers which hold the item when its
+	// status is TrackerStatusRemote.
+	Allocations []peer.ID
 }
 
 // PinInfoSerial is a serializable version of PinInfo.
 // information is marked as
 type PinInfoSerial struct {
-	Cid    string `json:"cid"`
-	Peer   string `json:"peer"`
-	Status string `json:"status"`
-	TS     string `json:"timestamp"`
-	Error  string `json:"error"`
+	Cid         string   `json:"cid"`
+	Peer        string   `json:"peer"`
+	Peername    string   `json:"peername,omitempty"`
+	Status      string   `json:"status"`
+	TS          string   `json:"timestamp"`
+	Error       string   `json:"error"`
+	Attempts    int      `json:"attempts,omitempty"`
+	NextRetry   string   `json:"next_retry,omitempty"`
+	Allocations []string `json:"allocations,omitempty"`
 }
 
 // ToSerial converts a PinInfo to its serializable version.
@@ -197,13 +230,26 @@ func (pi PinInfo) ToSerial() PinInfoSerial {
 	if pi.Peer != "" {
 		p = peer.IDB58Encode(pi.Peer)
 	}
+	next := ""
+	if !pi.NextRetry.IsZero() {
+		next = pi.NextRetry.UTC().Format(time.RFC3339)
+	}
+
+	var allocs []string
+	if len(pi.Allocations) > 0 {
+		allocs = PeersToStrings(pi.Allocations)
+	}
 
 	return PinInfoSerial{
-		Cid:    c,
-		Peer:   p,
-		Status: pi.Status.String(),
-		TS:     pi.TS.UTC().Format(time.RFC3339),
-		Error:  pi.Error,
+		Cid:         c,
+		Peer:        p,
+		Peername:    pi.Peername,
+		Status:      pi.Status.String(),
+		TS:          pi.TS.UTC().Format(time.RFC3339),
+		Error:       pi.Error,
+		Attempts:    pi.Attempts,
+		NextRetry:   next,
+		Allocations: allocs,
 	}
 }
 
@@ -221,12 +267,27 @@ func (pis PinInfoSerial) ToPinInfo() PinInfo {
 	if err != nil {
 		logger.Debug(pis.TS, err)
 	}
+	var next time.Time
+	if pis.NextRetry != "" {
+		next, err = time.Parse(time.RFC3339, pis.NextRetry)
+		if err != nil {
+			logger.Debug(pis.NextRetry, err)
+		}
+	}
+	var allocs []peer.ID
+	if len(pis.Allocations) > 0 {
+		allocs = StringsToPeers(pis.Allocations)
+	}
 	return PinInfo{
-		Cid:    c,
-		Peer:   p,
-		Status: TrackerStatusFromString(pis.Status),
-		TS:     ts,
-		Error:  pis.Error,
+		Cid:         c,
+		Peer:        p,
+		Peername:    pis.Peername,
+		Status:      TrackerStatusFromString(pis.Status),
+		TS:          ts,
+		Error:       pis.Error,
+		Attempts:    pis.Attempts,
+		NextRetry:   next,
+		Allocations: allocs,
 	}
 }
 
@@ -368,6 +429,15 @@ func (swarmS SwarmPeersSerial) ToSwarmPeers() SwarmPeers {
 	return StringsToPeers(swarmS)
 }
 
+// IPFSBandwidth holds the bandwidth statistics reported by an ipfs
+// daemon. Totals are in bytes and rates in bytes per second.
+type IPFSBandwidth struct {
+	TotalIn  uint64
+	TotalOut uint64
+	RateIn   float64
+	RateOut  float64
+}
+
 // ID holds information about the Cluster peer
 type ID struct {
 	ID                    peer.ID
@@ -380,21 +450,73 @@ type ID struct {
 	Error                 string
 	IPFS                  IPFSID
 	Peername              string
+	Tags                  map[string]string
+	Role                  string
+	// Annotation is a free-form note about the peer (location,
+	// contact...) kept in the shared state.
+	Annotation string
+	// GoVersion is the version of Go used to build the peer.
+	GoVersion string
+	// Components describes the components run by the peer.
+	Components IDComponents
+	// Features lists the optional features supported and enabled by
+	// the peer, so that clients can adapt to them.
+	Features []string
 	//PublicKey          crypto.PubKey
 }
 
+// IDComponents describes the components used by a cluster peer.
+type IDComponents struct {
+	Consensus        string   `json:"consensus,omitempty"`
+	PinTracker       string   `json:"pin_tracker,omitempty"`
+	Informers        []string `json:"informers,omitempty"`
+	AllocationMetric string   `json:"allocation_metric,omitempty"`
+}
+
+// Features reported in the ID of a peer. Clients and tools use them to
+// adapt to the capabilities of the peer they talk to, rather than
+// guessing them from its version.
+const (
+	// Supported by every peer of this version.
+	FeaturePinPriority     = "pin_priority"
+	FeaturePinExpiration   = "pin_expiration"
+	FeaturePeerAnnotations = "peer_annotations"
+	FeatureDrain           = "drain"
+	FeatureSignedMetrics   = "signed_metrics"
+	FeatureBatchedCommits  = "batched_commits"
+
+	// Depending on the components and the configuration.
+	FeatureRepoGC           = "repo_gc"
+	FeatureRepinning        = "repinning"
+	FeatureRPCCompression   = "rpc_compression"
+	FeatureDebugRPC         = "debug_rpc"
+	FeatureLocalRPC         = "local_rpc"
+	FeaturePinMerge         = "pin_merge"
+	FeatureUnderReplication = "under_replication"
+	FeatureAutoRecover      = "auto_recover"
+	FeaturePopularityBoost  = "popularity_boost"
+	FeatureAdd              = "add"
+	FeatureCAR              = "car"
+)
+
 // IDSerial is the serializable ID counterpart for RPC requests
 type IDSerial struct {
-	ID                    string           `json:"id"`
-	Addresses             MultiaddrsSerial `json:"addresses"`
-	ClusterPeers          []string         `json:"cluster_peers"`
-	ClusterPeersAddresses MultiaddrsSerial `json:"cluster_peers_addresses"`
-	Version               string           `json:"version"`
-	Commit                string           `json:"commit"`
-	RPCProtocolVersion    string           `json:"rpc_protocol_version"`
-	Error                 string           `json:"error"`
-	IPFS                  IPFSIDSerial     `json:"ipfs"`
-	Peername              string           `json:"peername"`
+	ID                    string            `json:"id"`
+	Addresses             MultiaddrsSerial  `json:"addresses"`
+	ClusterPeers          []string          `json:"cluster_peers"`
+	ClusterPeersAddresses MultiaddrsSerial  `json:"cluster_peers_addresses"`
+	Version               string            `json:"version"`
+	Commit                string            `json:"commit"`
+	RPCProtocolVersion    string            `json:"rpc_protocol_version"`
+	Error                 string            `json:"error"`
+	IPFS                  IPFSIDSerial      `json:"ipfs"`
+	Peername              string            `json:"peername"`
+	Tags                  map[string]string `json:"tags,omitempty"`
+	Role                  string            `json:"role,omitempty"`
+	Annotation            string            `json:"annotation,omitempty"`
+	GoVersion             string            `json:"go_version,omitempty"`
+	Components            IDComponents      `json:"components"`
+	Features              []string          `json:"features,omitempty"`
 	//PublicKey          []byte
 }
 
@@ -421,6 +543,12 @@ func (id ID) ToSerial() IDSerial {
 		Error:                 id.Error,
 		IPFS:                  id.IPFS.ToSerial(),
 		Peername:              id.Peername,
+		Tags:                  id.Tags,
+		Role:                  id.Role,
+		Annotation:            id.Annotation,
+		GoVersion:             id.GoVersion,
+		Components:            id.Components,
+		Features:              id.Features,
 		//PublicKey:          pkey,
 	}
 }
@@ -448,6 +576,12 @@ func (ids IDSerial) ToID() ID {
 	id.Error = ids.Error
 	id.IPFS = ids.IPFS.ToIPFSID()
 	id.Peername = ids.Peername
+	id.Tags = ids.Tags
+	id.Role = ids.Role
+	id.Annotation = ids.Annotation
+	id.GoVersion = ids.GoVersion
+	id.Components = ids.Components
+	id.Features = ids.Features
 	return id
 }
 
@@ -505,9 +639,77 @@ type Pin struct {
 	Allocations          []peer.ID
 	ReplicationFactorMin int
 	ReplicationFactorMax int
-	Recursive            bool
+	// Recursive pins pin the whole DAG under the Cid. Otherwise only
+	// the Cid itself is pinned (direct pin).
+	Recursive bool
+	// MaxDepth, when not 0, limits the depth of the DAG pinned by a
+	// recursive pin: 1 pins the Cid and its children, and so on.
+	MaxDepth int
+	// ExcludePeers lists peers which should never be
+	// allocated to this pin.
+	ExcludePeers []peer.ID
+	// AllowPeers, when not empty, lists the only peers which
+	// may be allocated to this pin.
+	AllowPeers []peer.ID
+	// Priority of the pin in the queues of the PinTrackers. Empty
+	// means PinPriorityNormal.
+	Priority PinPriority
+	// ExpireAt, when not zero, is the time after which the pin is
+	// automatically removed from the cluster.
+	ExpireAt time.Time
+	// Metadata holds free-form key-value pairs which help users
+	// to identify and find their pins.
+	Metadata map[string]string
+	// PinUpdate, when set, is the Cid of the pin which this one
+	// updates. Peers which have it pinned update its pin in IPFS, so
+	// that only the differences between both DAGs are fetched.
+	PinUpdate *cid.Cid
+	// Type tells whether the pin is a regular pin or part of a
+	// sharded DAG. Empty means DataType.
+	Type PinType
+	// Reference, for ShardType pins, is the Cid of the MetaType pin
+	// of the sharded DAG they belong to.
+	Reference *cid.Cid
+	// Timestamp is when the Cid was first pinned in the cluster. It is
+	// set by the cluster peer which commits the pin.
+	Timestamp time.Time
+	// Origin identifies who made the last change to the pin. It is
+	// carried with the pin so that every peer can report it.
+	Origin Origin
+	// Providers are the multiaddresses of nodes which are known to
+	// provide the content, like the origins of the requests of the
+	// Pinning Service API.
+	Providers []string
 }
 
+// PinType tells what a Pin stands for. DAGs too big for any single peer
+// are sharded: they are split in shards, each pinned recursively by
+// different peers, and their root is tracked by a meta pin.
+type PinType string
+
+// Pin types.
+const (
+	// DataType pins are regular pins.
+	DataType PinType = "data"
+	// MetaType pins are the roots of sharded DAGs. They only pin the
+	// root node itself, the rest of the DAG being pinned by its shards.
+	MetaType PinType = "meta"
+	// ShardType pins pin part of a sharded DAG: a node linking to some
+	// of its subtrees, pinned recursively, or one of the intermediate
+	// nodes above those, pinned directly.
+	ShardType PinType = "shard"
+)
+
+// PinPriority indicates how urgently the peers allocated to a Pin should
+// pin it. High priority pins are processed before any queued normal ones.
+type PinPriority string
+
+// Pin priorities.
+const (
+	PinPriorityNormal PinPriority = "normal"
+	PinPriorityHigh   PinPriority = "high"
+)
+
 // PinCid is a shorcut to create a Pin only with a Cid.  Default is for pin to
 // be recursive
 func PinCid(c *cid.Cid) Pin {
@@ -520,12 +722,24 @@ func PinCid(c *cid.Cid) Pin {
 
 // PinSerial is a serializable version of Pin
 type PinSerial struct {
-	Cid                  string   `json:"cid"`
-	Name                 string   `json:"name"`
-	Allocations          []string `json:"allocations"`
-	ReplicationFactorMin int      `json:"replication_factor_min"`
-	ReplicationFactorMax int      `json:"replication_factor_max"`
-	Recursive            bool     `json:"recursive"`
+	Cid                  string            `json:"cid"`
+	Name                 string            `json:"name"`
+	Allocations          []string          `json:"allocations"`
+	ReplicationFactorMin int               `json:"replication_factor_min"`
+	ReplicationFactorMax int               `json:"replication_factor_max"`
+	Recursive            bool              `json:"recursive"`
+	MaxDepth             int               `json:"max_depth,omitempty"`
+	ExcludePeers         []string          `json:"exclude_peers,omitempty"`
+	AllowPeers           []string          `json:"allow_peers,omitempty"`
+	Priority             PinPriority       `json:"priority,omitempty"`
+	ExpireAt             int64             `json:"expire_at,omitempty"` // UnixNano
+	Metadata             map[string]string `json:"metadata,omitempty"`
+	PinUpdate            string            `json:"pin_update,omitempty"`
+	Type                 PinType           `json:"type,omitempty"`
+	Reference            string            `json:"reference,omitempty"`
+	Timestamp            int64             `json:"timestamp,omitempty"` // UnixNano
+	Origin               string            `json:"origin,omitempty"`
+	Providers            []string          `json:"providers,omitempty"`
 }
 
 // ToSerial converts a Pin to PinSerial.
@@ -538,6 +752,36 @@ func (pin Pin) ToSerial() PinSerial {
 	n := pin.Name
 	allocs := PeersToStrings(pin.Allocations)
 
+	priority := pin.Priority
+	if priority == PinPriorityNormal {
+		priority = ""
+	}
+
+	var expireAt int64
+	if !pin.ExpireAt.IsZero() {
+		expireAt = pin.ExpireAt.UnixNano()
+	}
+
+	pinUpdate := ""
+	if pin.PinUpdate != nil {
+		pinUpdate = pin.PinUpdate.String()
+	}
+
+	pinType := pin.Type
+	if pinType == DataType {
+		pinType = ""
+	}
+
+	reference := ""
+	if pin.Reference != nil {
+		reference = pin.Reference.String()
+	}
+
+	var timestamp int64
+	if !pin.Timestamp.IsZero() {
+		timestamp = pin.Timestamp.UnixNano()
+	}
+
 	return PinSerial{
 		Cid:                  c,
 		Name:                 n,
@@ -545,12 +789,24 @@ func (pin Pin) ToSerial() PinSerial {
 		ReplicationFactorMin: pin.ReplicationFactorMin,
 		ReplicationFactorMax: pin.ReplicationFactorMax,
 		Recursive:            pin.Recursive,
+		MaxDepth:             pin.MaxDepth,
+		ExcludePeers:         PeersToStrings(pin.ExcludePeers),
+		AllowPeers:           PeersToStrings(pin.AllowPeers),
+		Priority:             priority,
+		ExpireAt:             expireAt,
+		Metadata:             pin.Metadata,
+		PinUpdate:            pinUpdate,
+		Type:                 pinType,
+		Reference:            reference,
+		Timestamp:            timestamp,
+		Origin:               string(pin.Origin),
+		Providers:            pin.Providers,
 	}
 }
 
 // Equals checks if two pins are the same (with the same allocations).
 // If allocations are the same but in different order, they are still
-// considered equivalent.
+// considered equivalent. Timestamps and origins are not compared.
 func (pin Pin) Equals(pin2 Pin) bool {
 	pin1s := pin.ToSerial()
 	pin2s := pin2.ToSerial()
@@ -567,6 +823,10 @@ func (pin Pin) Equals(pin2 Pin) bool {
 		return false
 	}
 
+	if pin1s.MaxDepth != pin2s.MaxDepth {
+		return false
+	}
+
 	sort.Strings(pin1s.Allocations)
 	sort.Strings(pin2s.Allocations)
 
@@ -581,9 +841,66 @@ func (pin Pin) Equals(pin2 Pin) bool {
 	if pin1s.ReplicationFactorMin != pin2s.ReplicationFactorMin {
 		return false
 	}
+
+	sort.Strings(pin1s.ExcludePeers)
+	sort.Strings(pin2s.ExcludePeers)
+
+	if strings.Join(pin1s.ExcludePeers, ",") != strings.Join(pin2s.ExcludePeers, ",") {
+		return false
+	}
+
+	sort.Strings(pin1s.AllowPeers)
+	sort.Strings(pin2s.AllowPeers)
+
+	if strings.Join(pin1s.AllowPeers, ",") != strings.Join(pin2s.AllowPeers, ",") {
+		return false
+	}
+
+	if pin1s.Priority != pin2s.Priority {
+		return false
+	}
+
+	if pin1s.ExpireAt != pin2s.ExpireAt {
+		return false
+	}
+
+	if pin1s.PinUpdate != pin2s.PinUpdate {
+		return false
+	}
+
+	if pin1s.Type != pin2s.Type || pin1s.Reference != pin2s.Reference {
+		return false
+	}
+
+	if strings.Join(pin1s.Providers, ",") != strings.Join(pin2s.Providers, ",") {
+		return false
+	}
+
+	if len(pin1s.Metadata) != len(pin2s.Metadata) {
+		return false
+	}
+	for k, v := range pin1s.Metadata {
+		if v2, ok := pin2s.Metadata[k]; !ok || v != v2 {
+			return false
+		}
+	}
 	return true
 }
 
+// Expired returns true when the pin has an expiration time and it has
+// passed.
+func (pin Pin) Expired() bool {
+	return !pin.ExpireAt.IsZero() && time.Now().After(pin.ExpireAt)
+}
+
+// UnderReplicated returns true when the pin is allocated to fewer peers
+// than its ReplicationFactorMin. This happens when it was accepted while
+// there were not enough peers available (see the cluster
+// under_replication_policy).
+func (pin Pin) UnderReplicated() bool {
+	return pin.ReplicationFactorMin > 0 && len(pin.Allocations) < pin.ReplicationFactorMin
+}
+
 // ToPin converts a PinSerial to its native form.
 func (pins PinSerial) ToPin() Pin {
 	c, err := cid.Decode(pins.Cid)
@@ -591,6 +908,32 @@ func (pins PinSerial) ToPin() Pin {
 		logger.Debug(pins.Cid, err)
 	}
 
+	var expireAt time.Time
+	if pins.ExpireAt != 0 {
+		expireAt = time.Unix(0, pins.ExpireAt)
+	}
+
+	var pinUpdate *cid.Cid
+	if pins.PinUpdate != "" {
+		pinUpdate, err = cid.Decode(pins.PinUpdate)
+		if err != nil {
+			logger.Debug(pins.PinUpdate, err)
+		}
+	}
+
+	var reference *cid.Cid
+	if pins.Reference != "" {
+		reference, err = cid.Decode(pins.Reference)
+		if err != nil {
+			logger.Debug(pins.Reference, err)
+		}
+	}
+
+	var timestamp time.Time
+	if pins.Timestamp != 0 {
+		timestamp = time.Unix(0, pins.Timestamp)
+	}
+
 	return Pin{
 		Cid:                  c,
 		Name:                 pins.Name,
@@ -598,18 +941,422 @@ func (pins PinSerial) ToPin() Pin {
 		ReplicationFactorMin: pins.ReplicationFactorMin,
 		ReplicationFactorMax: pins.ReplicationFactorMax,
 		Recursive:            pins.Recursive,
+		MaxDepth:             pins.MaxDepth,
+		ExcludePeers:         StringsToPeers(pins.ExcludePeers),
+		AllowPeers:           StringsToPeers(pins.AllowPeers),
+		Priority:             pins.Priority,
+		ExpireAt:             expireAt,
+		Metadata:             pins.Metadata,
+		PinUpdate:            pinUpdate,
+		Type:                 pins.Type,
+		Reference:            reference,
+		Timestamp:            timestamp,
+		Origin:               Origin(pins.Origin),
+		Providers:            pins.Providers,
 	}
 }
 
+// MatchesFilter returns true when the name of the pin contains the given
+// one (when not empty) and its metadata has all the given key-value
+// pairs.
+func (pins PinSerial) MatchesFilter(name string, metadata map[string]string) bool {
+	if name != "" && !strings.Contains(pins.Name, name) {
+		return false
+	}
+	for k, v := range metadata {
+		if v2, ok := pins.Metadata[k]; !ok || v != v2 {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxPinNameLength is the maximum length accepted for Pin names.
+const MaxPinNameLength = 255
+
+// MaxPinMetadataSize is the maximum number of bytes accepted for all the
+// keys and values of the Metadata of a Pin.
+const MaxPinMetadataSize = 4096
+
+// MaxPinProviders is the maximum number of Providers accepted for a Pin.
+const MaxPinProviders = 20
+
+// PinOptionError is returned by Pin.Validate() when one of the options of
+// a Pin is not acceptable. Field carries the name of the offending option as
+// used in the REST API.
+type PinOptionError struct {
+	Field  string
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *PinOptionError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// Validate checks that the options of a Pin are consistent before it
+// is sent further into the cluster. A replication factor of 0 is valid
+// and means that the cluster defaults should be used. It returns a
+// *PinOptionError describing the first offending field.
+func (pin Pin) Validate() error {
+	if pin.Cid == nil {
+		return &PinOptionError{"cid", "missing or undecodable cid"}
+	}
+
+	if len(pin.Name) > MaxPinNameLength {
+		return &PinOptionError{
+			"name",
+			fmt.Sprintf("longer than %d characters", MaxPinNameLength),
+		}
+	}
+
+	metadataSize := 0
+	for k, v := range pin.Metadata {
+		if k == "" {
+			return &PinOptionError{"metadata", "keys cannot be empty"}
+		}
+		metadataSize += len(k) + len(v)
+	}
+	if metadataSize > MaxPinMetadataSize {
+		return &PinOptionError{
+			"metadata",
+			fmt.Sprintf("larger than %d bytes", MaxPinMetadataSize),
+		}
+	}
+
+	for _, p := range pin.AllowPeers {
+		for _, excluded := range pin.ExcludePeers {
+			if p == excluded {
+				return &PinOptionError{
+					"allow_peers",
+					fmt.Sprintf("%s is also excluded", p.Pretty()),
+				}
+			}
+		}
+	}
+
+	if pin.MaxDepth < 0 {
+		return &PinOptionError{"max_depth", "cannot be negative"}
+	}
+
+	if len(pin.Providers) > MaxPinProviders {
+		return &PinOptionError{
+			"providers",
+			fmt.Sprintf("more than %d addresses", MaxPinProviders),
+		}
+	}
+	for _, p := range pin.Providers {
+		if _, err := ma.NewMultiaddr(p); err != nil {
+			return &PinOptionError{"providers", fmt.Sprintf("invalid multiaddress %q", p)}
+		}
+	}
+	if pin.MaxDepth > 0 && !pin.Recursive {
+		return &PinOptionError{"max_depth", "only recursive pins can have a max depth"}
+	}
+
+	switch pin.Priority {
+	case "", PinPriorityNormal, PinPriorityHigh:
+	default:
+		return &PinOptionError{
+			"priority",
+			fmt.Sprintf("must be %q or %q", PinPriorityNormal, PinPriorityHigh),
+		}
+	}
+
+	switch pin.Type {
+	case "", DataType, MetaType:
+	case ShardType:
+		if pin.Reference == nil {
+			return &PinOptionError{"reference", "required by shard pins"}
+		}
+	default:
+		return &PinOptionError{
+			"type",
+			fmt.Sprintf("must be %q, %q or %q", DataType, MetaType, ShardType),
+		}
+	}
+
+	rplMin := pin.ReplicationFactorMin
+	rplMax := pin.ReplicationFactorMax
+
+	if rplMin < -1 {
+		return &PinOptionError{"replication_factor_min", "must be -1 or larger"}
+	}
+
+	if rplMax < -1 {
+		return &PinOptionError{"replication_factor_max", "must be -1 or larger"}
+	}
+
+	// A factor set to 0 takes the cluster default, which is not known
+	// here. The cluster checks them again once the defaults are set.
+	if rplMin == 0 || rplMax == 0 {
+		return nil
+	}
+
+	if (rplMin == -1) != (rplMax == -1) {
+		return &PinOptionError{
+			"replication_factor_min",
+			"must be -1 when replication_factor_max is -1 and viceversa",
+		}
+	}
+
+	if rplMin > rplMax {
+		return &PinOptionError{
+			"replication_factor_min",
+			"larger than replication_factor_max",
+		}
+	}
+	return nil
+}
+
+// PinAction describes what happened to the shared state as a
+// result of a Pin request.
+type PinAction string
+
+// Pin actions.
+const (
+	// PinActionPinned is used when the Cid was not pinned before.
+	PinActionPinned PinAction = "pinned"
+	// PinActionUnchanged is used when the Cid was already pinned
+	// with the same options.
+	PinActionUnchanged PinAction = "unchanged"
+	// PinActionOverwritten is used when the options of an existing
+	// pin were replaced with the requested ones.
+	PinActionOverwritten PinAction = "overwritten"
+	// PinActionMerged is used when the options of an existing pin
+	// were merged with the requested ones.
+	PinActionMerged PinAction = "merged"
+)
+
+// PinResult is returned by Pin requests and describes how the
+// request was applied to the shared state.
+type PinResult struct {
+	Action PinAction `json:"action"`
+	// Pin is the pin as submitted to the shared state.
+	Pin PinSerial `json:"pin"`
+	// Previous is set when the Cid was already pinned.
+	Previous *PinSerial `json:"previous,omitempty"`
+}
+
+// StateChangeType identifies the kind of a StateChange.
+type StateChangeType string
+
+// State change types.
+const (
+	// StateChangePin is used when a pin is added or updated.
+	StateChangePin StateChangeType = "pin"
+	// StateChangeUnpin is used when a pin is removed.
+	StateChangeUnpin StateChangeType = "unpin"
+)
+
+// StateChange describes a change applied by the consensus to the
+// shared state.
+type StateChange struct {
+	Type StateChangeType
+	Pin  Pin
+}
+
+// PinEstimate describes the cost of pinning a Cid with some options,
+// before pinning it.
+type PinEstimate struct {
+	Cid string `json:"cid"`
+	// Size is the size of the DAG under the Cid, in bytes.
+	Size uint64 `json:"size"`
+	// Replication is the number of peers which would pin the Cid.
+	Replication int `json:"replication"`
+	// TotalSize is the space used in the whole cluster.
+	TotalSize   uint64   `json:"total_size"`
+	Allocations []string `json:"allocations"`
+	// Feasible tells whether the pin can be allocated to enough peers
+	// with enough free space. Otherwise, Reason explains why not.
+	Feasible bool   `json:"feasible"`
+	Reason   string `json:"reason,omitempty"`
+}
+
 // Metric transports information about a peer.ID. It is used to decide
 // pin allocations by a PinAllocator. IPFS cluster is agnostic to
 // the Value, which should be interpreted by the PinAllocator.
 type Metric struct {
-	Name   string
-	Peer   peer.ID // filled-in by Cluster.
-	Value  string
-	Expire int64 // UnixNano
-	Valid  bool  // if the metric is not valid it will be discarded
+	Name     string
+	Peer     peer.ID // filled-in by Cluster.
+	Peername string  // filled-in by Cluster.
+	Value    string
+	Expire   int64 // UnixNano
+	Valid    bool  // if the metric is not valid it will be discarded
+	Received int64 // UnixNano, filled-in by the PeerMonitor.
+
+	// Signature is made with the private key of Peer. See Sign().
+	Signature []byte
+}
+
+// MetricSerial is a serializable version of Metric.
+type MetricSerial struct {
+	Name     string `json:"name"`
+	Peer     string `json:"peer"`
+	Peername string `json:"peername,omitempty"`
+	Value    string `json:"value"`
+	Expire   int64  `json:"expire"`
+	Valid    bool   `json:"valid"`
+	Received int64  `json:"received"`
+
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// ToSerial converts a Metric to its serializable version.
+func (m Metric) ToSerial() MetricSerial {
+	return MetricSerial{
+		Name:     m.Name,
+		Peer:     peer.IDB58Encode(m.Peer),
+		Peername: m.Peername,
+		Value:    m.Value,
+		Expire:   m.Expire,
+		Valid:    m.Valid,
+		Received: m.Received,
+
+		Signature: m.Signature,
+	}
+}
+
+// ToMetric converts a MetricSerial to its native form.
+func (ms MetricSerial) ToMetric() Metric {
+	p, err := peer.IDB58Decode(ms.Peer)
+	if err != nil {
+		logger.Debug(ms.Peer, err)
+	}
+
+	return Metric{
+		Name:     ms.Name,
+		Peer:     p,
+		Peername: ms.Peername,
+		Value:    ms.Value,
+		Expire:   ms.Expire,
+		Valid:    ms.Valid,
+		Received: ms.Received,
+
+		Signature: ms.Signature,
+	}
+}
+
+// signedBytes returns the metric fields covered by the signature. Received
+// is set locally by the receiving monitor and is therefore left out. Every
+// field is prefixed by its length, so that different metrics never share
+// the same bytes.
+func (m *Metric) signedBytes() []byte {
+	var buf bytes.Buffer
+	for _, f := range []string{
+		m.Name,
+		peer.IDB58Encode(m.Peer),
+		m.Peername,
+		m.Value,
+		strconv.FormatInt(m.Expire, 10),
+		strconv.FormatBool(m.Valid),
+	} {
+		var l [8]byte
+		binary.BigEndian.PutUint64(l[:], uint64(len(f)))
+		buf.Write(l[:])
+		buf.WriteString(f)
+	}
+	return buf.Bytes()
+}
+
+// Sign signs the metric with the given key, which should be
+// the private key of the metric's Peer.
+func (m *Metric) Sign(key crypto.PrivKey) error {
+	sig, err := key.Sign(m.signedBytes())
+	if err != nil {
+		return err
+	}
+	m.Signature = sig
+	return nil
+}
+
+// VerifySignature checks that the metric was signed by the owner of the
+// given public key, and that the key belongs to the metric's Peer.
+func (m *Metric) VerifySignature(key crypto.PubKey) error {
+	if len(m.Signature) == 0 {
+		return errors.New("metric is not signed")
+	}
+
+	if !m.Peer.MatchesPublicKey(key) {
+		return fmt.Errorf("key does not match metric peer %s", m.Peer.Pretty())
+	}
+
+	ok, err := key.Verify(m.signedBytes(), m.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("bad signature on metric %s from %s", m.Name, m.Peer.Pretty())
+	}
+	return nil
+}
+
+// PeerHealth is a compact summary of the health of a peer. It is carried
+// as the value of the "ping" metric so that it travels with the heartbeat.
+type PeerHealth struct {
+	IPFS   bool `json:"ipfs"`   // the IPFS daemon is reachable
+	State  bool `json:"state"`  // the shared state can be read
+	Queued int  `json:"queued"` // items queued for pinning/unpinning
+	Errors int  `json:"errors"` // items in error state
+	// Time is when the value was produced (UnixNano), according to
+	// the clock of the peer. It allows to estimate the clock skew
+	// between peers.
+	Time int64 `json:"time,omitempty"`
+	// Features lists the features supported and enabled by the peer,
+	// as in its ID, so that the others can tell which features the
+	// whole cluster supports.
+	Features []string `json:"features,omitempty"`
+}
+
+// FeatureSupport tells which cluster peers advertise a feature in their
+// heartbeats. All is set when every peer does, and Quorum when more
+// than half of them do.
+type FeatureSupport struct {
+	Feature string   `json:"feature"`
+	Peers   []string `json:"peers"`
+	Total   int      `json:"total"`
+	All     bool     `json:"all"`
+	Quorum  bool     `json:"quorum"`
+}
+
+// String encodes PeerHealth in a compact form suitable for Metric values.
+func (ph PeerHealth) String() string {
+	b, err := json.Marshal(ph)
+	if err != nil {
+		logger.Error(err)
+		return ""
+	}
+	return string(b)
+}
+
+// PeerHealthFromString parses the value of a "ping" metric. Peers running
+// older versions send empty values, in which case an error is returned.
+func PeerHealthFromString(str string) (PeerHealth, error) {
+	var ph PeerHealth
+	err := json.Unmarshal([]byte(str), &ph)
+	return ph, err
+}
+
+// MetricsQuery is used to request the history of a metric for a peer.
+type MetricsQuery struct {
+	Name  string
+	Peer  peer.ID
+	Since time.Time
+}
+
+// PeerLatency is the round-trip time of a libp2p ping to a cluster
+// peer. Error is set when the peer could not be pinged.
+type PeerLatency struct {
+	Peer  peer.ID
+	RTT   time.Duration
+	Error string
+}
+
+// FailPeerRequest is used to ask a peer monitor to simulate the failure
+// of a peer during some time.
+type FailPeerRequest struct {
+	Peer     peer.ID
+	Duration time.Duration
 }
 
 // SetTTL sets Metric to expire after the given seconds
@@ -643,17 +1390,627 @@ func (m *Metric) Discard() bool {
 
 // Alert carries alerting information about a peer. WIP.
 type Alert struct {
-	Peer       peer.ID
-	MetricName string
+	Peer        peer.ID
+	Peername    string
+	MetricName  string
+	Severity    AlertSeverity
+	TriggeredAt time.Time
+	// MetricTTL is the time the expired metric was valid for
+	// and LastValue its value.
+	MetricTTL time.Duration
+	LastValue string
+	// Suppressed counts the alerts for this peer and metric which were
+	// not sent since the previous one.
+	Suppressed int
+	// Recovered is set when the alert signals that a previously
+	// alerted metric is being received again.
+	Recovered bool
+}
+
+// AlertSeverity indicates how serious the condition which triggered
+// an Alert is.
+type AlertSeverity string
+
+// Alert severities.
+const (
+	// AlertWarning is used when a metric used for allocations is
+	// not received anymore.
+	AlertWarning AlertSeverity = "warning"
+	// AlertCritical is used when a peer appears to be down.
+	AlertCritical AlertSeverity = "critical"
+)
+
+// KV is a small record stored in the shared state alongside the pins. KVs
+// can be used to keep operational information (deployment markers,
+// manifest CIDs, maintenance flags) replicated in the cluster.
+type KV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Limits for KV records.
+const (
+	MaxKVKeyLength = 255
+	MaxKVValueSize = 4096
+)
+
+// Validate checks that a KV can be stored in the shared state.
+func (kv KV) Validate() error {
+	if kv.Key == "" || len(kv.Key) > MaxKVKeyLength {
+		return fmt.Errorf("keys must have between 1 and %d characters", MaxKVKeyLength)
+	}
+	if strings.Contains(kv.Key, "/") {
+		return errors.New("keys cannot contain '/'")
+	}
+	if len(kv.Value) > MaxKVValueSize {
+		return fmt.Errorf("values cannot be larger than %d bytes", MaxKVValueSize)
+	}
+	return nil
+}
+
+// PeerAnnotation is a free-form note about a peer, like its location or
+// who to contact about it. It is stored in the shared state as a KV record.
+type PeerAnnotation struct {
+	Peer       string `json:"peer"`
+	Annotation string `json:"annotation"`
 }
 
+// RequestTimeoutHeader is the HTTP header with which API clients tell how
+// long they wait for a response, as a duration string (i.e. "30s"). The
+// operations done to serve the request are cancelled afterwards.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// StreamErrorTrailer is the HTTP trailer with which APIs report the
+// errors happening once they have started streaming a response, like
+// the IPFS API does.
+const StreamErrorTrailer = "X-Stream-Error"
+
 // Error can be used by APIs to return errors.
 type Error struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	// Allocation is set when the error is an AllocationError.
+	Allocation *AllocationError `json:"allocation,omitempty"`
 }
 
 // Error implements the error interface and returns the error's message.
 func (e *Error) Error() string {
 	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
 }
+
+// AllocationCandidate is a cluster peer considered when allocating a Cid.
+// Reason explains why it could not be used, when it is not Usable.
+type AllocationCandidate struct {
+	Peer   string `json:"peer"`
+	Usable bool   `json:"usable"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AllocationError is returned when there are not enough peers to
+// allocate a Cid. It lists the cluster peers which were considered.
+type AllocationError struct {
+	Cid        string                `json:"cid"`
+	Needed     int                   `json:"needed"`
+	Wanted     int                   `json:"wanted"`
+	Candidates []AllocationCandidate `json:"candidates"`
+}
+
+// The details of an AllocationError are appended to its message as JSON
+// after this separator, so that it can be recovered after going through
+// RPC, which only keeps error messages.
+const allocationErrorDetails = " Details: "
+
+// Summary returns a human-readable description of the error.
+func (e *AllocationError) Summary() string {
+	usable := 0
+	for _, c := range e.Candidates {
+		if c.Usable {
+			usable++
+		}
+	}
+	return fmt.Sprintf(
+		"not enough peers to allocate CID. Needed at least: %d. Wanted at most: %d. Valid candidates: %d.",
+		e.Needed,
+		e.Wanted,
+		usable,
+	)
+}
+
+// Error implements the error interface. It returns the summary followed
+// by the details of the error.
+func (e *AllocationError) Error() string {
+	raw, _ := json.Marshal(e)
+	return e.Summary() + allocationErrorDetails + string(raw)
+}
+
+// ParseAllocationError recovers an AllocationError from an error message.
+// It returns false when the message does not contain one.
+func ParseAllocationError(msg string) (*AllocationError, bool) {
+	i := strings.Index(msg, allocationErrorDetails)
+	if i < 0 {
+		return nil, false
+	}
+	e := &AllocationError{}
+	dec := json.NewDecoder(strings.NewReader(msg[i+len(allocationErrorDetails):]))
+	if err := dec.Decode(e); err != nil || e.Cid == "" {
+		return nil, false
+	}
+	return e, true
+}
+
+// Readiness reports whether a cluster peer has finished starting up, along
+// with the readiness of each of the components that need to be ready.
+type Readiness struct {
+	Ready      bool            `json:"ready"`
+	Components map[string]bool `json:"components"`
+}
+
+// RaftHealth describes the state of the Raft consensus in a cluster
+// peer. LogEntries is the number of entries in the log which are not
+// part of the last snapshot. CommitLatency is a moving average of the
+// time taken to commit an update, including redirections to the leader.
+type RaftHealth struct {
+	Peer              string    `json:"peer"`
+	Peername          string    `json:"peername,omitempty"`
+	State             string    `json:"state"`
+	Leader            string    `json:"leader"`
+	Term              uint64    `json:"term"`
+	LastLogIndex      uint64    `json:"last_log_index"`
+	CommitIndex       uint64    `json:"commit_index"`
+	AppliedIndex      uint64    `json:"applied_index"`
+	LastSnapshotIndex uint64    `json:"last_snapshot_index"`
+	LastSnapshot      time.Time `json:"last_snapshot"`
+	LogEntries        uint64    `json:"log_entries"`
+	LeaderChanges     uint64    `json:"leader_changes"`
+	LastLeaderChange  time.Time `json:"last_leader_change"`
+	CommitLatency     string    `json:"commit_latency"`
+}
+
+// PinQueue describes the pin and unpin operations queued or in progress
+// in the PinTracker of a cluster peer. PinRate is the number of pins
+// completed per second over the last minute. PendingGC is the number of
+// unpins done since the IPFS repository was last garbage collected.
+type PinQueue struct {
+	Peer           string            `json:"peer"`
+	Peername       string            `json:"peername,omitempty"`
+	MaxQueueSize   int               `json:"max_queue_size"`
+	ConcurrentPins int               `json:"concurrent_pins"`
+	PinQueued      int               `json:"pin_queued"`
+	UnpinQueued    int               `json:"unpin_queued"`
+	InProgress     int               `json:"in_progress"`
+	PinsDone       uint64            `json:"pins_done"`
+	PinsFailed     uint64            `json:"pins_failed"`
+	PinRate        float64           `json:"pin_rate"`
+	PendingGC      int               `json:"unpins_pending_gc"`
+	Operations     []QueuedOperation `json:"operations"`
+}
+
+// QueuedOperation is a pin or unpin operation queued or in progress in
+// a PinTracker. Since is the time when it entered its current status.
+type QueuedOperation struct {
+	Cid    string    `json:"cid"`
+	Type   string    `json:"type"`
+	Status string    `json:"status"`
+	Since  time.Time `json:"since"`
+}
+
+// Observation is a numeric value describing some aspect of a cluster
+// peer. Observations are exported to monitoring systems (i.e. Prometheus).
+type Observation struct {
+	Name   string            `json:"name"`
+	Help   string            `json:"help"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// Event types used by cluster to describe things that happened in a peer.
+const (
+	EventPin         = "pin"
+	EventUnpin       = "unpin"
+	EventRepin       = "repin"
+	EventPeerAdded   = "peer_added"
+	EventPeerRemoved = "peer_removed"
+	EventAlert       = "alert"
+	EventRecovered   = "recovered"
+)
+
+// Event records something that happened in a cluster peer. Events
+// are persisted locally by every peer and can be retrieved by
+// external consumers to catch up with what happened.
+type Event struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Peer      string    `json:"peer,omitempty"`
+	Cid       string    `json:"cid,omitempty"`
+	Origin    string    `json:"origin,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// Event types for the changes of the local status of the pins in a peer.
+const (
+	EventPinned     = "pinned"
+	EventPinError   = "pin_error"
+	EventUnpinned   = "unpinned"
+	EventUnpinError = "unpin_error"
+)
+
+// WebhookEventTypes are the types of the events which can be delivered to
+// webhooks: those about pins.
+var WebhookEventTypes = []string{
+	EventPin,
+	EventUnpin,
+	EventRepin,
+	EventPinned,
+	EventPinError,
+	EventUnpinned,
+	EventUnpinError,
+}
+
+// Webhook is a subscription to the events about pins. Every peer POSTs
+// the events it produces, as WebhookEvents, to the URL of the webhooks
+// whose filters they match. Webhooks are stored in the shared state.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Events are the types of the delivered events. All the
+	// WebhookEventTypes when empty.
+	Events []string `json:"events,omitempty"`
+	// Namespace restricts the deliveries to the events produced by
+	// the peers of the cluster with this namespace (the cluster
+	// "namespace" option), for webhooks shared by several clusters.
+	Namespace string `json:"namespace,omitempty"`
+	// Metadata restricts the deliveries to the pins with all these
+	// metadata key/value pairs, i.e. tenant=acme.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Validate checks that the URL and the event types of a webhook are
+// valid.
+func (wh Webhook) Validate() error {
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhooks need an http or https URL")
+	}
+	for _, t := range wh.Events {
+		if !containsString(WebhookEventTypes, t) {
+			return fmt.Errorf("unknown event type %q: must be one of %s",
+				t, strings.Join(WebhookEventTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// Matches tells whether an event about the given pin, produced by a peer
+// of the cluster with the given namespace, must be delivered to the
+// webhook.
+func (wh Webhook) Matches(ev Event, pin Pin, namespace string) bool {
+	if ev.Cid == "" {
+		return false
+	}
+	if len(wh.Events) > 0 && !containsString(wh.Events, ev.Type) {
+		return false
+	}
+	if !containsString(WebhookEventTypes, ev.Type) {
+		return false
+	}
+	if wh.Namespace != "" && wh.Namespace != namespace {
+		return false
+	}
+	for k, v := range wh.Metadata {
+		if pin.Metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// WebhookEvent is the body POSTed to webhooks: an event, with the name
+// and the metadata of the pin it is about, and the namespace of the
+// cluster which produced it.
+type WebhookEvent struct {
+	Event
+	Webhook   string            `json:"webhook"`
+	Namespace string            `json:"namespace,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// StrayPin is an item pinned in the IPFS daemon of a cluster peer which the
+// shared state does not allocate to that peer, usually because it was
+// pinned directly in IPFS. Tracked is set when the item is pinned in the
+// cluster but allocated to other peers.
+type StrayPin struct {
+	Cid      string `json:"cid"`
+	Peer     string `json:"peer"`
+	Peername string `json:"peername,omitempty"`
+	Tracked  bool   `json:"tracked"`
+	Ignored  bool   `json:"ignored"`
+}
+
+// StrayPinAction is a remediation for a stray pin.
+type StrayPinAction string
+
+// Remediations for stray pins.
+const (
+	// StrayPinAdopt pins the item in the cluster.
+	StrayPinAdopt StrayPinAction = "adopt"
+	// StrayPinIgnore marks the item as ignored in the reports.
+	StrayPinIgnore StrayPinAction = "ignore"
+	// StrayPinRemove unpins the item from the IPFS daemon.
+	StrayPinRemove StrayPinAction = "remove"
+)
+
+// StrayPinRemediation is used to request an action on a stray pin
+// reported by a peer.
+type StrayPinRemediation struct {
+	Peer   string         `json:"peer"`
+	Cid    string         `json:"cid"`
+	Action StrayPinAction `json:"action"`
+}
+
+// PinUpdateRequest is used to pin the Cid To with the options and
+// allocations of the existing pin of From, optionally unpinning From.
+type PinUpdateRequest struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Unpin bool   `json:"unpin"`
+}
+
+// AddParams holds the options used to import content in IPFS when it is
+// added through the cluster. They have the meaning of the options of the
+// same name of "ipfs add". Zero values use the defaults of IPFS.
+type AddParams struct {
+	Chunker           string `json:"chunker,omitempty"`
+	CidVersion        int    `json:"cid_version,omitempty"`
+	Hash              string `json:"hash,omitempty"`
+	RawLeaves         bool   `json:"raw_leaves,omitempty"`
+	WrapWithDirectory bool   `json:"wrap_with_directory,omitempty"`
+	// Shard makes the cluster shard the added DAGs, so that no single
+	// peer needs to hold them entirely. Shards hold up to ShardSize
+	// bytes (DefaultShardSize when zero).
+	Shard     bool   `json:"shard,omitempty"`
+	ShardSize uint64 `json:"shard_size,omitempty"`
+}
+
+// Defaults of the options of AddParams, as in IPFS.
+const (
+	DefaultAddChunker = "size-262144"
+	DefaultAddHash    = "sha2-256"
+)
+
+// MaxAddChunkSize is the largest chunk size accepted in AddParams, as in
+// IPFS.
+const MaxAddChunkSize = 1 << 20
+
+// addHashes are the hash functions accepted in AddParams.
+var addHashes = map[string]bool{
+	"sha2-256":     true,
+	"sha2-512":     true,
+	"dbl-sha2-256": true,
+	"sha3-224":     true,
+	"sha3-256":     true,
+	"sha3-384":     true,
+	"sha3-512":     true,
+	"keccak-224":   true,
+	"keccak-256":   true,
+	"keccak-384":   true,
+	"keccak-512":   true,
+	"blake2b-256":  true,
+	"blake2b-384":  true,
+	"blake2b-512":  true,
+	"blake2s-256":  true,
+}
+
+// Validate checks the chunker, CID version and hash function of the
+// AddParams. Like Pin.Validate(), it returns a *PinOptionError.
+func (p AddParams) Validate() error {
+	if !validChunker(p.Chunker) {
+		return &PinOptionError{
+			"chunker",
+			fmt.Sprintf(`must be "size-<bytes>", "rabin[-[<min>-]<avg>[-<max>]]" or "buzhash", with sizes up to %d`, MaxAddChunkSize),
+		}
+	}
+	if p.CidVersion < 0 || p.CidVersion > 1 {
+		return &PinOptionError{"cid_version", "must be 0 or 1"}
+	}
+	if p.Hash != "" && !addHashes[p.Hash] {
+		return &PinOptionError{"hash", "unknown or unsupported hash function " + p.Hash}
+	}
+	return nil
+}
+
+// validChunker returns whether IPFS accepts the given chunker.
+func validChunker(chunker string) bool {
+	switch {
+	case chunker == "", chunker == "rabin", chunker == "buzhash":
+		return true
+	case strings.HasPrefix(chunker, "size-"):
+		size, err := strconv.Atoi(strings.TrimPrefix(chunker, "size-"))
+		return err == nil && size > 0 && size <= MaxAddChunkSize
+	case strings.HasPrefix(chunker, "rabin-"):
+		parts := strings.Split(strings.TrimPrefix(chunker, "rabin-"), "-")
+		if len(parts) != 1 && len(parts) != 3 {
+			return false
+		}
+		sizes := make([]int, len(parts))
+		for i, part := range parts {
+			size, err := strconv.Atoi(part)
+			if err != nil || size <= 0 || size > MaxAddChunkSize {
+				return false
+			}
+			sizes[i] = size
+		}
+		return len(sizes) == 1 || (sizes[0] <= sizes[1] && sizes[1] <= sizes[2])
+	default:
+		return false
+	}
+}
+
+// Metadata returns the import options of the AddParams, with the
+// defaults of IPFS for those which are not set, to be recorded in the
+// metadata of the pins of added content. Adding the same content again
+// with them yields the same Cids. Like in IPFS, hash functions other than
+// sha2-256 imply CID version 1, which implies raw leaves.
+func (p AddParams) Metadata() map[string]string {
+	chunker := p.Chunker
+	if chunker == "" {
+		chunker = DefaultAddChunker
+	}
+	hash := p.Hash
+	if hash == "" {
+		hash = DefaultAddHash
+	}
+	cidVersion := p.CidVersion
+	if hash != DefaultAddHash {
+		cidVersion = 1
+	}
+	return map[string]string{
+		"add.chunker":     chunker,
+		"add.cid_version": strconv.Itoa(cidVersion),
+		"add.hash":        hash,
+		"add.raw_leaves":  strconv.FormatBool(p.RawLeaves || cidVersion > 0),
+	}
+}
+
+// DefaultShardSize is the size of the shards of sharded DAGs when not
+// given.
+const DefaultShardSize uint64 = 100 << 20
+
+// UnixFSNode describes a UnixFS file or directory node built by the
+// cluster when sharding added content. The links of files are their
+// segments, in order, and those of directories their entries.
+type UnixFSNode struct {
+	Directory bool
+	Links     []UnixFSLink
+}
+
+// UnixFSLink is a link of a UnixFSNode. Size is the cumulative size of
+// the linked DAG and FileSize the size of the file data under it.
+type UnixFSLink struct {
+	Name     string
+	Cid      *cid.Cid
+	Size     uint64
+	FileSize uint64
+}
+
+// AddRequest is used to add content to the cluster. Body is a
+// multipart/form-data body, as accepted by "ipfs add", of the given
+// ContentType. The roots of the imported content are pinned with the
+// options of Pin, whose Cid is ignored. Body is streamed, so requests
+// can only be made to the local peer.
+type AddRequest struct {
+	Params      AddParams `json:"params"`
+	Pin         PinSerial `json:"pin"`
+	ContentType string    `json:"content_type"`
+	Body        io.Reader `json:"-"`
+}
+
+// AddedOutput describes an item imported when adding content to the
+// cluster. Name is its path in the added content.
+type AddedOutput struct {
+	Name string `json:"name"`
+	Cid  string `json:"cid"`
+}
+
+// AddedRoots returns the roots of the added items, which are pinned by
+// the cluster: the wrapping directory, which comes last, when wrapping,
+// and the top-level files and directories otherwise.
+func AddedRoots(added []AddedOutput, wrapped bool) []AddedOutput {
+	if wrapped {
+		if len(added) == 0 {
+			return nil
+		}
+		return added[len(added)-1:]
+	}
+	var roots []AddedOutput
+	for _, a := range added {
+		if !strings.Contains(strings.Trim(a.Name, "/"), "/") {
+			roots = append(roots, a)
+		}
+	}
+	return roots
+}
+
+// CARImportRequest is used to import a CAR file in the cluster. Body is
+// the CAR file, whose roots are pinned with the options of Pin, whose
+// Cid is ignored. Body is streamed, so requests can only be made to the
+// local peer.
+type CARImportRequest struct {
+	Pin  PinSerial `json:"pin"`
+	Body io.Reader `json:"-"`
+}
+
+// CARExportRequest is used to export the DAG of a pinned Cid as a CAR
+// file, which is written to Writer. Writer is streamed to, so requests
+// can only be made to the local peer.
+type CARExportRequest struct {
+	Cid    string    `json:"cid"`
+	Writer io.Writer `json:"-"`
+}
+
+// PeerLeaveRequest is used to remove the peer Peer (base58-encoded) from
+// the cluster. When Drain is set, its pins are first re-allocated and
+// pinned by other peers.
+type PeerLeaveRequest struct {
+	Peer  string `json:"peer"`
+	Drain bool   `json:"drain"`
+}
+
+// PinAttempt records a pin or unpin operation made by a peer's tracker
+// on an item: when it started, how long it took and the error, if any.
+type PinAttempt struct {
+	Cid       string    `json:"cid"`
+	Peer      string    `json:"peer"`
+	Peername  string    `json:"peername,omitempty"`
+	Operation string    `json:"operation"`
+	Timestamp time.Time `json:"timestamp"`
+	Duration  string    `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// AllocationReason describes why the allocations of a pin changed.
+type AllocationReason string
+
+// Reasons for allocation changes.
+const (
+	// AllocationInitial is the first allocation of a pin.
+	AllocationInitial AllocationReason = "initial"
+	// AllocationRebalance is a change requested by pinning an
+	// existing pin again or made to adapt it to its popularity.
+	AllocationRebalance AllocationReason = "rebalance"
+	// AllocationFailure moves the content away from a peer which
+	// went down or was removed.
+	AllocationFailure AllocationReason = "failure"
+	// AllocationTopUp adds allocations to an under-replicated pin once
+	// enough peers are available.
+	AllocationTopUp AllocationReason = "top_up"
+	// AllocationDrain moves the content away from a peer which is
+	// leaving the cluster.
+	AllocationDrain AllocationReason = "drain"
+	// AllocationUpdate allocates a new version of a pin, updated with
+	// PinUpdate, preferably to the peers of the previous version.
+	AllocationUpdate AllocationReason = "update"
+)
+
+// AllocationChange records a change of the allocations of a pin made by
+// a cluster peer. From and To are the allocations before and after the
+// change. Empty allocations mean that the item is pinned everywhere,
+// except for From in initial and update allocations.
+type AllocationChange struct {
+	Cid       string           `json:"cid"`
+	Peer      string           `json:"peer"`
+	Peername  string           `json:"peername,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+	From      []string         `json:"from"`
+	To        []string         `json:"to"`
+	Reason    AllocationReason `json:"reason"`
+}
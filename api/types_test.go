@@ -1,11 +1,15 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	cid "github.com/ipfs/go-cid"
+	crypto "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
 )
@@ -15,6 +19,7 @@ var testMAddr, _ = ma.NewMultiaddr("/ip4/1.2.3.4")
 var testMAddr2, _ = ma.NewMultiaddr("/dns4/a.b.c.d")
 var testMAddr3, _ = ma.NewMultiaddr("/ip4/127.0.0.1/tcp/8081/ws/ipfs/QmSoLer265NRgSp2LA3dPaeykiS1J6DifTC88f5uVQKNAd")
 var testCid1, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
+var testCid2, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma")
 var testPeerID1, _ = peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
 var testPeerID2, _ = peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabd")
 var testPeerID3, _ = peer.IDB58Decode("QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa")
@@ -51,10 +56,19 @@ func TestGlobalPinInfoConv(t *testing.T) {
 		Cid: testCid1,
 		PeerMap: map[peer.ID]PinInfo{
 			testPeerID1: {
-				Cid:    testCid1,
-				Peer:   testPeerID1,
-				Status: TrackerStatusPinned,
-				TS:     testTime,
+				Cid:       testCid1,
+				Peer:      testPeerID1,
+				Status:    TrackerStatusPinError,
+				TS:        testTime,
+				Attempts:  2,
+				NextRetry: testTime.Add(time.Minute),
+			},
+			testPeerID2: {
+				Cid:         testCid1,
+				Peer:        testPeerID2,
+				Status:      TrackerStatusRemote,
+				TS:          testTime,
+				Allocations: []peer.ID{testPeerID1},
 			},
 		},
 	}
@@ -70,6 +84,16 @@ func TestGlobalPinInfoConv(t *testing.T) {
 	if !gpi.PeerMap[testPeerID1].TS.Equal(newgpi.PeerMap[testPeerID1].TS) {
 		t.Error("bad time")
 	}
+
+	pi := newgpi.PeerMap[testPeerID1]
+	if pi.Attempts != 2 || !pi.NextRetry.Equal(testTime.Add(time.Minute)) {
+		t.Error("retry information was not converted")
+	}
+
+	remote := newgpi.PeerMap[testPeerID2]
+	if len(remote.Allocations) != 1 || remote.Allocations[0] != testPeerID1 {
+		t.Error("allocations were not converted")
+	}
 }
 
 func TestIDConv(t *testing.T) {
@@ -93,6 +117,13 @@ func TestIDConv(t *testing.T) {
 			Addresses: []ma.Multiaddr{testMAddr3},
 			Error:     "abc",
 		},
+		Tags:      map[string]string{"region": "eu-west"},
+		GoVersion: "go1.9",
+		Components: IDComponents{
+			Consensus: "raft",
+			Informers: []string{"freespace"},
+		},
+		Features: []string{"pin_expiration"},
 	}
 
 	newid := id.ToSerial().ToID()
@@ -116,7 +147,12 @@ func TestIDConv(t *testing.T) {
 	if id.Version != newid.Version ||
 		id.Commit != newid.Commit ||
 		id.RPCProtocolVersion != newid.RPCProtocolVersion ||
-		id.Error != newid.Error {
+		id.Error != newid.Error ||
+		id.Tags["region"] != newid.Tags["region"] ||
+		id.GoVersion != newid.GoVersion ||
+		id.Components.Consensus != newid.Components.Consensus ||
+		len(newid.Components.Informers) != 1 ||
+		len(newid.Features) != 1 {
 		t.Error("some field didn't survive")
 	}
 
@@ -188,17 +224,228 @@ func TestPinConv(t *testing.T) {
 		Allocations:          []peer.ID{testPeerID1},
 		ReplicationFactorMax: -1,
 		ReplicationFactorMin: -1,
+		Recursive:            true,
+		MaxDepth:             3,
+		AllowPeers:           []peer.ID{testPeerID1},
+		Priority:             PinPriorityHigh,
+		ExpireAt:             time.Now().Add(time.Hour),
+		Metadata:             map[string]string{"owner": "alice"},
+		PinUpdate:            testCid2,
+		Type:                 ShardType,
+		Reference:            testCid2,
+		Timestamp:            time.Now(),
+		Origin:               PeerOrigin(testPeerID1),
+		Providers:            []string{"/ip4/1.2.3.4/tcp/4001"},
 	}
 
 	newc := c.ToSerial().ToPin()
+	if !c.Equals(newc) {
+		t.Error("the pins should be equal")
+	}
 	if c.Cid.String() != newc.Cid.String() ||
+		newc.Metadata["owner"] != "alice" ||
+		newc.PinUpdate == nil || !c.PinUpdate.Equals(newc.PinUpdate) ||
+		newc.Type != ShardType ||
+		!newc.Recursive || newc.MaxDepth != 3 ||
+		newc.Reference == nil || !c.Reference.Equals(newc.Reference) ||
+		c.Priority != newc.Priority ||
+		!c.ExpireAt.Equal(newc.ExpireAt) ||
+		!c.Timestamp.Equal(newc.Timestamp) ||
+		c.Origin != newc.Origin ||
+		len(newc.Providers) != 1 || c.Providers[0] != newc.Providers[0] ||
 		c.Allocations[0] != newc.Allocations[0] ||
+		len(newc.AllowPeers) != 1 || c.AllowPeers[0] != newc.AllowPeers[0] ||
 		c.ReplicationFactorMin != newc.ReplicationFactorMin ||
 		c.ReplicationFactorMax != newc.ReplicationFactorMax {
 		t.Error("mismatch")
 	}
 }
 
+func TestPinMatchesFilter(t *testing.T) {
+	pin := PinSerial{
+		Cid:      testCid1.String(),
+		Name:     "my dataset",
+		Metadata: map[string]string{"owner": "alice", "team": "a"},
+	}
+
+	if !pin.MatchesFilter("", nil) {
+		t.Error("empty filters should match")
+	}
+	if !pin.MatchesFilter("data", map[string]string{"owner": "alice"}) {
+		t.Error("the pin should match")
+	}
+	if pin.MatchesFilter("other", nil) {
+		t.Error("the name should not match")
+	}
+	if pin.MatchesFilter("", map[string]string{"owner": "bob"}) {
+		t.Error("the metadata should not match")
+	}
+	if pin.MatchesFilter("", map[string]string{"site": "x"}) {
+		t.Error("missing metadata keys should not match")
+	}
+}
+
+func TestPinExpired(t *testing.T) {
+	pin := PinCid(testCid1)
+	if pin.Expired() {
+		t.Error("pins without expiration never expire")
+	}
+	pin.ExpireAt = time.Now().Add(time.Hour)
+	if pin.Expired() {
+		t.Error("the pin should not have expired yet")
+	}
+	pin.ExpireAt = time.Now().Add(-time.Second)
+	if !pin.Expired() {
+		t.Error("the pin should have expired")
+	}
+}
+
+func TestPinUnderReplicated(t *testing.T) {
+	pin := Pin{
+		Cid:                  testCid1,
+		Allocations:          []peer.ID{testPeerID1},
+		ReplicationFactorMin: 2,
+		ReplicationFactorMax: 3,
+	}
+	if !pin.UnderReplicated() {
+		t.Error("the pin should be under-replicated")
+	}
+
+	pin.Allocations = append(pin.Allocations, testPeerID2)
+	if pin.UnderReplicated() {
+		t.Error("the pin should not be under-replicated")
+	}
+
+	pin.Allocations = nil
+	pin.ReplicationFactorMin = -1
+	pin.ReplicationFactorMax = -1
+	if pin.UnderReplicated() {
+		t.Error("pins everywhere are never under-replicated")
+	}
+}
+
+func TestPinValidate(t *testing.T) {
+	pin := PinCid(testCid1)
+	if err := pin.Validate(); err != nil {
+		t.Error("default pin should be valid:", err)
+	}
+
+	badPins := map[string]Pin{
+		"cid":                    Pin{},
+		"name":                   Pin{Cid: testCid1, Name: strings.Repeat("a", MaxPinNameLength+1)},
+		"metadata":               Pin{Cid: testCid1, Metadata: map[string]string{"": "a"}},
+		"replication_factor_min": Pin{Cid: testCid1, ReplicationFactorMin: 3, ReplicationFactorMax: 2},
+		"replication_factor_max": Pin{Cid: testCid1, ReplicationFactorMin: 1, ReplicationFactorMax: -2},
+		"allow_peers":            Pin{Cid: testCid1, AllowPeers: []peer.ID{testPeerID1}, ExcludePeers: []peer.ID{testPeerID1}},
+		"priority":               Pin{Cid: testCid1, Priority: "urgent"},
+		"type":                   Pin{Cid: testCid1, Type: "clustered"},
+		"reference":              Pin{Cid: testCid1, Type: ShardType},
+		"max_depth":              Pin{Cid: testCid1, MaxDepth: 2},
+		"providers":              Pin{Cid: testCid1, Providers: []string{"1.2.3.4:4001"}},
+	}
+
+	for field, p := range badPins {
+		err := p.Validate()
+		perr, ok := err.(*PinOptionError)
+		if !ok {
+			t.Fatalf("expected a PinOptionError for %s", field)
+		}
+		if perr.Field != field {
+			t.Errorf("expected error in %s but got %s", field, perr.Field)
+		}
+	}
+
+	pin.ReplicationFactorMin = -1
+	pin.ReplicationFactorMax = 2
+	if err := pin.Validate(); err == nil {
+		t.Error("mixing -1 with other values should fail")
+	}
+}
+
+func TestPeerHealth(t *testing.T) {
+	ph := PeerHealth{
+		IPFS:     true,
+		Queued:   3,
+		Errors:   1,
+		Time:     time.Now().UnixNano(),
+		Features: []string{FeatureDrain},
+	}
+
+	ph2, err := PeerHealthFromString(ph.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ph2, ph) {
+		t.Error("peer health should survive encoding")
+	}
+
+	_, err = PeerHealthFromString("")
+	if err == nil {
+		t.Error("expected an error parsing an empty value")
+	}
+}
+
+func TestMetricSignature(t *testing.T) {
+	priv, pub, err := crypto.GenerateKeyPair(crypto.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := Metric{
+		Name:  "test",
+		Peer:  pid,
+		Value: "5",
+		Valid: true,
+	}
+	m.SetTTL(5)
+
+	err = m.VerifySignature(pub)
+	if err == nil {
+		t.Error("unsigned metrics should not verify")
+	}
+
+	err = m.Sign(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Received = time.Now().UnixNano()
+	err = m.VerifySignature(pub)
+	if err != nil {
+		t.Error(err)
+	}
+
+	m2 := m
+	m2.Value = "6"
+	err = m2.VerifySignature(pub)
+	if err == nil {
+		t.Error("tampered metric should not verify")
+	}
+
+	m3 := m
+	m3.Peer = testPeerID1
+	err = m3.VerifySignature(pub)
+	if err == nil {
+		t.Error("metric should not verify with a key from another peer")
+	}
+
+	// moving a separator from one field to the next one changes the
+	// signed bytes
+	m4 := m
+	m4.Peername = "a\n"
+	m4.Value = "5"
+	m5 := m
+	m5.Peername = "a"
+	m5.Value = "\n5"
+	if bytes.Equal(m4.signedBytes(), m5.signedBytes()) {
+		t.Error("signed bytes should be unambiguous")
+	}
+}
+
 func TestMetric(t *testing.T) {
 	m := Metric{
 		Name:  "hello",
@@ -238,3 +485,175 @@ func TestMetric(t *testing.T) {
 		t.Error("looks like a bad ttl")
 	}
 }
+
+func TestOriginContext(t *testing.T) {
+	ctx := context.Background()
+	if OriginFromContext(ctx) != "" {
+		t.Error("expected no origin")
+	}
+
+	o := APIOrigin("admin", "127.0.0.1:1234")
+	if o != "api:admin@127.0.0.1:1234" {
+		t.Error("unexpected api origin: ", o)
+	}
+
+	ctx = ContextWithOrigin(ctx, o)
+	if OriginFromContext(ctx) != o {
+		t.Error("expected the origin to be carried by the context")
+	}
+}
+
+func TestParseAllocationError(t *testing.T) {
+	aerr := &AllocationError{
+		Cid:    testCid1.String(),
+		Needed: 2,
+		Wanted: 3,
+		Candidates: []AllocationCandidate{
+			{Peer: testPeerID1.Pretty(), Usable: true},
+			{Peer: testPeerID2.Pretty(), Reason: "freespace metric expired 35 seconds ago"},
+		},
+	}
+
+	// errors coming through RPC may be wrapped
+	msg := "error pinning: " + aerr.Error()
+	parsed, ok := ParseAllocationError(msg)
+	if !ok {
+		t.Fatal("expected an allocation error")
+	}
+	if parsed.Cid != aerr.Cid || parsed.Needed != 2 || parsed.Wanted != 3 {
+		t.Error("bad allocation error: ", parsed)
+	}
+	if len(parsed.Candidates) != 2 || parsed.Candidates[1].Reason != aerr.Candidates[1].Reason {
+		t.Error("bad candidates: ", parsed.Candidates)
+	}
+	if parsed.Summary() != aerr.Summary() {
+		t.Error("summaries should match")
+	}
+
+	if _, ok := ParseAllocationError("not enough peers"); ok {
+		t.Error("expected no allocation error")
+	}
+}
+
+func TestAddParamsValidate(t *testing.T) {
+	valid := []AddParams{
+		{},
+		{Chunker: "size-1024", CidVersion: 1, Hash: "blake2b-256"},
+		{Chunker: "rabin"},
+		{Chunker: "rabin-1024"},
+		{Chunker: "rabin-512-1024-2048"},
+		{Chunker: "buzhash"},
+	}
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Errorf("%+v should be valid: %s", p, err)
+		}
+	}
+
+	invalid := []struct {
+		params AddParams
+		field  string
+	}{
+		{AddParams{Chunker: "size-0"}, "chunker"},
+		{AddParams{Chunker: "size-2097152"}, "chunker"},
+		{AddParams{Chunker: "rabin-2048-1024-512"}, "chunker"},
+		{AddParams{CidVersion: 2}, "cid_version"},
+		{AddParams{Hash: "md5"}, "hash"},
+	}
+	for _, c := range invalid {
+		err := c.params.Validate()
+		optErr, ok := err.(*PinOptionError)
+		if !ok || optErr.Field != c.field {
+			t.Errorf("%+v: expected an error on %s, got %v", c.params, c.field, err)
+		}
+	}
+}
+
+func TestAddParamsMetadata(t *testing.T) {
+	m := AddParams{}.Metadata()
+	if m["add.chunker"] != DefaultAddChunker ||
+		m["add.cid_version"] != "0" ||
+		m["add.hash"] != DefaultAddHash ||
+		m["add.raw_leaves"] != "false" {
+		t.Error("unexpected defaults:", m)
+	}
+
+	m = AddParams{Hash: "sha3-256"}.Metadata()
+	if m["add.cid_version"] != "1" || m["add.raw_leaves"] != "true" {
+		t.Error("other hashes should imply CIDv1 and raw leaves:", m)
+	}
+}
+
+func TestAddedRoots(t *testing.T) {
+	added := []AddedOutput{
+		{Name: "dir/a", Cid: testCid1.String()},
+		{Name: "dir", Cid: testCid2.String()},
+		{Name: "b", Cid: testCid1.String()},
+	}
+	roots := AddedRoots(added, false)
+	if len(roots) != 2 || roots[0].Name != "dir" || roots[1].Name != "b" {
+		t.Error("expected the top-level items:", roots)
+	}
+
+	added = append(added, AddedOutput{Name: "", Cid: testCid2.String()})
+	roots = AddedRoots(added, true)
+	if len(roots) != 1 || roots[0].Name != "" {
+		t.Error("expected the wrapping directory:", roots)
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	wh := Webhook{URL: "https://example.com/hook", Events: []string{EventPinError}}
+	if err := wh.Validate(); err != nil {
+		t.Error("webhook should be valid:", err)
+	}
+
+	for _, invalid := range []Webhook{
+		{URL: ""},
+		{URL: "example.com/hook"},
+		{URL: "ftp://example.com/hook"},
+		{URL: "http://example.com/hook", Events: []string{EventPeerAdded}},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected an error validating %+v", invalid)
+		}
+	}
+}
+
+func TestWebhookMatches(t *testing.T) {
+	pin := PinCid(testCid1)
+	pin.Name = "backups/db"
+	pin.Metadata = map[string]string{"tenant": "acme", "tier": "gold"}
+	ev := Event{Type: EventPinError, Cid: testCid1.String()}
+
+	if !(Webhook{}).Matches(ev, pin, "") {
+		t.Error("webhooks without filters should match every pin event")
+	}
+	if (Webhook{}).Matches(Event{Type: EventPeerAdded}, pin, "") {
+		t.Error("webhooks should not match events which are not about pins")
+	}
+
+	wh := Webhook{
+		Events:    []string{EventPinError, EventUnpinError},
+		Namespace: "backups",
+		Metadata:  map[string]string{"tenant": "acme"},
+	}
+	if !wh.Matches(ev, pin, "backups") {
+		t.Error("the webhook should match")
+	}
+
+	ev.Type = EventPinned
+	if wh.Matches(ev, pin, "backups") {
+		t.Error("the webhook should not match other event types")
+	}
+	ev.Type = EventPinError
+
+	if wh.Matches(ev, pin, "media") || wh.Matches(ev, pin, "") {
+		t.Error("the webhook should not match events from other namespaces")
+	}
+
+	pin.Metadata["tenant"] = "other"
+	if wh.Matches(ev, pin, "backups") {
+		t.Error("the webhook should not match pins of other tenants")
+	}
+}
@@ -2,9 +2,13 @@ package api
 
 import (
 	"fmt"
+	"net"
+	"sort"
 
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+	manet "github.com/multiformats/go-multiaddr-net"
 )
 
 // PeersToStrings IDB58Encodes a list of peers.
@@ -65,3 +69,85 @@ func MustLibp2pMultiaddrJoin(addr ma.Multiaddr, p peer.ID) ma.Multiaddr {
 	}
 	return addr.Encapsulate(pidAddr)
 }
+
+// interfaceAddrs lists the addresses of the network interfaces. It can be
+// overridden in tests.
+var interfaceAddrs = net.InterfaceAddrs
+
+// IPv4Available returns true when this host has any IPv4 address. When
+// loopback is true, only a loopback IPv4 address is looked for,
+// otherwise only non-loopback ones are considered.
+func IPv4Available(loopback bool) bool {
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		// be conservative
+		return true
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil {
+			continue
+		}
+		if ipnet.IP.IsLoopback() == loopback {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferredAddr returns ip4 unless this host has no IPv4 addresses, in
+// which case ip6 is returned. When ip4 is a loopback multiaddress, the
+// loopback interface is checked instead. It allows to generate default
+// listen and dial addresses which work out of the box in IPv6-only
+// environments.
+func PreferredAddr(ip4, ip6 string) string {
+	loopback := false
+	if addr, err := ma.NewMultiaddr(ip4); err == nil {
+		loopback = manet.IsIPLoopback(addr)
+	}
+	if IPv4Available(loopback) {
+		return ip4
+	}
+	return ip6
+}
+
+// addrRank gives a lower value to the multiaddresses which should be
+// preferred when dialing or persisting them.
+func addrRank(addr ma.Multiaddr, ip4 bool) int {
+	if madns.Matches(addr) {
+		return 0 // resolved on dial, any IP version works
+	}
+
+	_, err := addr.ValueForProtocol(ma.P_IP4)
+	isIP4 := err == nil
+
+	switch {
+	case manet.IsIP6LinkLocal(addr):
+		return 5 // cannot be dialed without a zone
+	case manet.IsIPLoopback(addr):
+		return 4
+	case isIP4 == ip4:
+		return 1
+	case isIP4 || hasIP6(addr):
+		return 2
+	default:
+		return 3
+	}
+}
+
+func hasIP6(addr ma.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(ma.P_IP6)
+	return err == nil
+}
+
+// SortMultiaddrs sorts the given multiaddresses by preference: DNS
+// addresses first, then the addresses of the IP version used by this host
+// (IPv4, unless it is not available), then addresses of the other IP version
+// and finally loopback and IPv6 link-local addresses. The relative order
+// of equally preferred addresses is kept.
+func SortMultiaddrs(addrs []ma.Multiaddr) {
+	ip4 := IPv4Available(false)
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return addrRank(addrs[i], ip4) < addrRank(addrs[j], ip4)
+	})
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func withInterfaceAddrs(t *testing.T, cidrs ...string) func() {
+	var addrs []net.Addr
+	for _, c := range cidrs {
+		ip, ipnet, err := net.ParseCIDR(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipnet.IP = ip
+		addrs = append(addrs, ipnet)
+	}
+	orig := interfaceAddrs
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return addrs, nil
+	}
+	return func() { interfaceAddrs = orig }
+}
+
+func TestPreferredAddr(t *testing.T) {
+	ip4 := "/ip4/0.0.0.0/tcp/9096"
+	ip6 := "/ip6/::/tcp/9096"
+	lo4 := "/ip4/127.0.0.1/tcp/9094"
+	lo6 := "/ip6/::1/tcp/9094"
+
+	restore := withInterfaceAddrs(t, "127.0.0.1/8", "::1/128", "192.168.1.2/24", "2001:db8::1/64")
+	if PreferredAddr(ip4, ip6) != ip4 || PreferredAddr(lo4, lo6) != lo4 {
+		t.Error("expected IPv4 addresses on a dual-stack host")
+	}
+	restore()
+
+	restore = withInterfaceAddrs(t, "::1/128", "2001:db8::1/64")
+	if PreferredAddr(ip4, ip6) != ip6 || PreferredAddr(lo4, lo6) != lo6 {
+		t.Error("expected IPv6 addresses on an IPv6-only host")
+	}
+	restore()
+
+	restore = withInterfaceAddrs(t, "127.0.0.1/8", "::1/128", "2001:db8::1/64")
+	if PreferredAddr(ip4, ip6) != ip6 {
+		t.Error("expected IPv6 listen address when IPv4 is only on loopback")
+	}
+	if PreferredAddr(lo4, lo6) != lo4 {
+		t.Error("expected IPv4 loopback address")
+	}
+	restore()
+}
+
+func TestSortMultiaddrs(t *testing.T) {
+	strs := []string{
+		"/ip6/fe80::1/tcp/9096",
+		"/ip4/127.0.0.1/tcp/9096",
+		"/ip6/2001:db8::1/tcp/9096",
+		"/ip4/192.168.1.2/tcp/9096",
+		"/dns4/cluster.example.com/tcp/9096",
+	}
+	addrs := func() []ma.Multiaddr {
+		var addrs []ma.Multiaddr
+		for _, s := range strs {
+			a, _ := ma.NewMultiaddr(s)
+			addrs = append(addrs, a)
+		}
+		return addrs
+	}
+
+	check := func(addrs []ma.Multiaddr, expected ...string) {
+		for i, e := range expected {
+			if addrs[i].String() != e {
+				t.Errorf("position %d: expected %s, got %s", i, e, addrs[i])
+			}
+		}
+	}
+
+	restore := withInterfaceAddrs(t, "192.168.1.2/24", "2001:db8::1/64")
+	sorted := addrs()
+	SortMultiaddrs(sorted)
+	check(sorted, strs[4], strs[3], strs[2], strs[1], strs[0])
+	restore()
+
+	restore = withInterfaceAddrs(t, "2001:db8::1/64")
+	sorted = addrs()
+	SortMultiaddrs(sorted)
+	check(sorted, strs[4], strs[2], strs[3], strs[1], strs[0])
+	restore()
+}
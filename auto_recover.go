@@ -0,0 +1,92 @@
+package ipfscluster
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// When AutoRecoverInterval is set, every peer regularly recovers the
+// pins which are in PIN_ERROR or UNPIN_ERROR status in its pin tracker,
+// as "recover" does, so that transient failures (i.e. a restart of the
+// IPFS daemon) heal without the intervention of an operator. Runs are
+// delayed by a random fraction of the interval so that peers started
+// together do not hit their daemons at the same time, and at most
+// AutoRecoverMaxPins pins are recovered on every run.
+
+// autoRecoverJitter is the fraction of the AutoRecoverInterval by which
+// every run may be delayed.
+const autoRecoverJitter = 0.2
+
+// watchErroredPins recovers the pins in error every AutoRecoverInterval.
+func (c *Cluster) watchErroredPins() {
+	interval := c.config.AutoRecoverInterval
+	if interval <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(jitter(interval))
+	defer timer.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-timer.C:
+			c.recoverErrored(c.config.AutoRecoverMaxPins)
+			timer.Reset(jitter(interval))
+		}
+	}
+}
+
+// jitter returns the given duration plus a random fraction of it, up to
+// autoRecoverJitter.
+func jitter(d time.Duration) time.Duration {
+	max := int64(float64(d) * autoRecoverJitter)
+	if max <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int63n(max))
+}
+
+// recoverErrored recovers up to max pins in error states (all of them
+// when max is 0) and returns how many were recovered successfully. The
+// pins are picked in random order so that items which keep failing do
+// not prevent others from being retried.
+func (c *Cluster) recoverErrored(max int) int {
+	var errored []api.PinInfo
+	for _, pinfo := range c.tracker.StatusAll() {
+		switch pinfo.Status {
+		case api.TrackerStatusPinError, api.TrackerStatusUnpinError:
+			errored = append(errored, pinfo)
+		}
+	}
+	if len(errored) == 0 {
+		return 0
+	}
+
+	if max <= 0 || max > len(errored) {
+		max = len(errored)
+	}
+	logger.Infof("automatically recovering %d of %d pins in error", max, len(errored))
+
+	recovered := 0
+	for _, i := range rand.Perm(len(errored))[:max] {
+		if c.ctx.Err() != nil {
+			break
+		}
+		h := errored[i].Cid
+		pinfo, err := c.tracker.Recover(h)
+		if err != nil {
+			logger.Debugf("automatic recovery of %s failed: %s", h, err)
+			continue
+		}
+		switch pinfo.Status {
+		case api.TrackerStatusPinError, api.TrackerStatusUnpinError:
+			continue
+		}
+		recovered++
+	}
+	logger.Infof("automatically recovered %d pins", recovered)
+	return recovered
+}
@@ -0,0 +1,57 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestJitter(t *testing.T) {
+	d := 10 * time.Second
+	for i := 0; i < 100; i++ {
+		j := jitter(d)
+		if j < d || j >= d+2*time.Second {
+			t.Fatal("jitter out of bounds:", j)
+		}
+	}
+	if jitter(1) != 1 {
+		t.Error("tiny durations should not be jittered")
+	}
+}
+
+func TestClusterRecoverErrored(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	ipfs.ReturnError = true
+	for _, s := range []string{test.TestCid1, test.TestCid2, test.TestCid3} {
+		c, _ := cid.Decode(s)
+		err := cl.Pin(api.PinCid(c))
+		if err != nil {
+			t.Fatal("pin should have worked:", err)
+		}
+	}
+	pinDelay()
+
+	ipfs.ReturnError = false
+	if n := cl.recoverErrored(2); n != 2 {
+		t.Fatal("expected 2 pins to be recovered:", n)
+	}
+	if n := cl.recoverErrored(0); n != 1 {
+		t.Fatal("expected the last pin to be recovered:", n)
+	}
+	if n := cl.recoverErrored(0); n != 0 {
+		t.Error("there should be nothing left to recover:", n)
+	}
+
+	for _, pinfo := range cl.StatusAllLocal() {
+		if pinfo.Status != api.TrackerStatusPinned {
+			t.Error("all pins should be pinned:", pinfo.Status)
+		}
+	}
+}
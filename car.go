@@ -0,0 +1,358 @@
+package ipfscluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// CAR files imported through the cluster are streamed to the IPFS daemon
+// of the peer receiving them, which pins their roots until their
+// allocations do, like added content (see add.go). The roots, which are
+// read from the header of the file, are then pinned in the cluster and
+// the blocks are sent to the allocated peers. Exported CAR files are
+// produced by the IPFS daemon of a peer which has the DAG pinned,
+// preferably this one, and streamed from it (see dag_transfer.go).
+
+// maxCARHeaderSize limits the size of the headers of the imported CAR
+// files, which only list their roots.
+const maxCARHeaderSize = 1 << 20
+
+// ImportCAR imports the blocks of a CAR file (version 1) and pins its
+// roots with the options of the given pin, whose Cid is ignored. It
+// returns the pins of the roots.
+func (c *Cluster) ImportCAR(pin api.Pin, car io.Reader) ([]api.Pin, error) {
+	return c.importCAR(c.ctx, "", api.CARImportRequest{
+		Pin:  pin.ToSerial(),
+		Body: car,
+	})
+}
+
+// importCAR performs ImportCAR on behalf of the given origin.
+func (c *Cluster) importCAR(ctx context.Context, origin api.Origin, req api.CARImportRequest) ([]api.Pin, error) {
+	transferer, ok := c.ipfs.(CARTransferer)
+	if !ok {
+		return nil, errors.New("the IPFS connector cannot import CAR files")
+	}
+
+	if req.Body == nil {
+		return nil, errors.New("nothing to import")
+	}
+
+	// the header read is imported with the rest of the file
+	var header bytes.Buffer
+	roots, err := carRoots(io.TeeReader(req.Body, &header))
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("the CAR file has no roots")
+	}
+
+	err = transferer.DAGImport(ctx, io.MultiReader(&header, req.Body), true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.tempPins.add(roots); err != nil {
+		logger.Errorf("error persisting temporary pins: %s", err)
+	}
+	defer func() {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.releaseAddedRoots(roots)
+		}()
+	}()
+
+	var pins []api.Pin
+	for _, root := range roots {
+		pin := req.Pin.ToPin()
+		pin.Cid = root
+		pin.Recursive = true
+		if err := pin.Validate(); err != nil {
+			return pins, err
+		}
+		res, err := c.pinWithResult(origin, pin)
+		if err != nil {
+			return pins, err
+		}
+		pins = append(pins, res.Pin.ToPin())
+		c.pushAdded(ctx, root)
+	}
+	return pins, nil
+}
+
+// ExportCAR writes the DAG of a pinned Cid to w as a CAR file (version
+// 1). It is exported by the IPFS daemon of one of the peers allocated to
+// the pin which support it, trying this one first.
+func (c *Cluster) ExportCAR(h *cid.Cid, w io.Writer) error {
+	return c.exportCAR(c.ctx, h, w)
+}
+
+// exportCAR performs ExportCAR. The next peer is only tried when the
+// previous one failed before writing anything. It returns the error of
+// the last peer tried when none could export the DAG.
+func (c *Cluster) exportCAR(ctx context.Context, h *cid.Cid, w io.Writer) error {
+	pin, ok := c.getCurrentPin(h)
+	if !ok {
+		return errors.New("cid is not part of the global state")
+	}
+
+	err := errors.New("no allocated peer can export CAR files")
+	features := c.peerFeatures()
+	cw := &countingWriter{w: w}
+	for _, p := range c.exportPeers(pin) {
+		if !hasFeature(features[p], api.FeatureCAR) {
+			continue
+		}
+		if p == c.id {
+			err = c.exportLocalDAG(h.String(), cw)
+		} else {
+			err = c.pullDAG(ctx, p, h, cw)
+		}
+		if err == nil || cw.n > 0 {
+			return err
+		}
+		logger.Warningf("error exporting %s from %s: %s", h, p.Pretty(), err)
+	}
+	return err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// exportPeers returns the peers which can export the DAG of a pin: its
+// allocations, this peer first, or this peer when it is pinned
+// everywhere.
+func (c *Cluster) exportPeers(pin api.Pin) []peer.ID {
+	if len(pin.Allocations) == 0 || containsPeer(pin.Allocations, c.id) {
+		return append([]peer.ID{c.id}, withoutPeer(pin.Allocations, c.id)...)
+	}
+	return pin.Allocations
+}
+
+// carRoots reads the roots from the header of a CAR file (version 1).
+// The header is a length-prefixed dag-cbor map with "roots" and
+// "version" keys.
+func carRoots(r io.Reader) ([]*cid.Cid, error) {
+	br := bufio.NewReader(r)
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the CAR header: %s", err)
+	}
+	if size == 0 || size > maxCARHeaderSize {
+		return nil, fmt.Errorf("invalid CAR header size: %d", size)
+	}
+	header := make([]byte, size)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("error reading the CAR header: %s", err)
+	}
+
+	cr := &cborReader{buf: header}
+	major, n, err := cr.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMap {
+		return nil, errors.New("invalid CAR header: not a map")
+	}
+
+	var roots []*cid.Cid
+	var version uint64
+	for i := uint64(0); i < n; i++ {
+		key, err := cr.text()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "roots":
+			roots, err = cr.cids()
+		case "version":
+			version, err = cr.uint()
+		default:
+			err = cr.skip()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("unsupported CAR version: %d", version)
+	}
+	return roots, nil
+}
+
+// CBOR major types.
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+	cborTag   = 6
+)
+
+// cborTagCid is the CBOR tag of the links in dag-cbor.
+const cborTagCid = 42
+
+var errInvalidCBOR = errors.New("invalid CAR header: malformed CBOR")
+
+// cborReader decodes the few CBOR items found in the headers of CAR
+// files. Indefinite lengths, which dag-cbor does not allow, are not
+// supported.
+type cborReader struct {
+	buf []byte
+}
+
+// head reads the head of an item and returns its major type and its
+// argument: its value, length or number of items.
+func (cr *cborReader) head() (byte, uint64, error) {
+	if len(cr.buf) == 0 {
+		return 0, 0, errInvalidCBOR
+	}
+	major, info := cr.buf[0]>>5, cr.buf[0]&0x1f
+	cr.buf = cr.buf[1:]
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, errInvalidCBOR
+	}
+	if len(cr.buf) < size {
+		return 0, 0, errInvalidCBOR
+	}
+	var arg uint64
+	for _, b := range cr.buf[:size] {
+		arg = arg<<8 | uint64(b)
+	}
+	cr.buf = cr.buf[size:]
+	return major, arg, nil
+}
+
+// next reads n bytes.
+func (cr *cborReader) next(n uint64) ([]byte, error) {
+	if uint64(len(cr.buf)) < n {
+		return nil, errInvalidCBOR
+	}
+	b := cr.buf[:n]
+	cr.buf = cr.buf[n:]
+	return b, nil
+}
+
+func (cr *cborReader) uint() (uint64, error) {
+	major, arg, err := cr.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != cborUint {
+		return 0, errInvalidCBOR
+	}
+	return arg, nil
+}
+
+func (cr *cborReader) text() (string, error) {
+	major, n, err := cr.head()
+	if err != nil {
+		return "", err
+	}
+	if major != cborText {
+		return "", errInvalidCBOR
+	}
+	b, err := cr.next(n)
+	return string(b), err
+}
+
+// cids reads an array of dag-cbor links: byte strings holding a Cid
+// prefixed by a zero byte and tagged with cborTagCid.
+func (cr *cborReader) cids() ([]*cid.Cid, error) {
+	major, n, err := cr.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborArray {
+		return nil, errInvalidCBOR
+	}
+
+	var cids []*cid.Cid
+	for i := uint64(0); i < n; i++ {
+		major, tag, err := cr.head()
+		if err != nil {
+			return nil, err
+		}
+		if major != cborTag || tag != cborTagCid {
+			return nil, errInvalidCBOR
+		}
+		major, size, err := cr.head()
+		if err != nil {
+			return nil, err
+		}
+		if major != cborBytes {
+			return nil, errInvalidCBOR
+		}
+		b, err := cr.next(size)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) < 2 || b[0] != 0 {
+			return nil, errInvalidCBOR
+		}
+		c, err := cid.Cast(b[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid CAR root: %s", err)
+		}
+		cids = append(cids, c)
+	}
+	return cids, nil
+}
+
+// skip reads an item of any type.
+func (cr *cborReader) skip() error {
+	major, arg, err := cr.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cborBytes, cborText:
+		_, err = cr.next(arg)
+	case cborArray:
+		for i := uint64(0); i < arg && err == nil; i++ {
+			err = cr.skip()
+		}
+	case cborMap:
+		for i := uint64(0); i < 2*arg && err == nil; i++ {
+			err = cr.skip()
+		}
+	case cborTag:
+		err = cr.skip()
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// testCAR returns the header of a CAR file with the given roots and
+// version, followed by some bytes standing for the blocks.
+func testCAR(version byte, roots ...*cid.Cid) []byte {
+	var header bytes.Buffer
+	header.WriteByte(0xa2) // map(2)
+	header.WriteByte(0x65) // text(5)
+	header.WriteString("roots")
+	header.WriteByte(0x80 | byte(len(roots))) // array
+	for _, r := range roots {
+		header.Write([]byte{0xd8, 42}) // tag(42)
+		b := append([]byte{0}, r.Bytes()...)
+		header.Write([]byte{0x58, byte(len(b))}) // bytes
+		header.Write(b)
+	}
+	header.WriteByte(0x67) // text(7)
+	header.WriteString("version")
+	header.WriteByte(version)
+
+	size := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(size, uint64(header.Len()))
+	car := append(size[:n], header.Bytes()...)
+	return append(car, "blocks"...)
+}
+
+func TestCARRoots(t *testing.T) {
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+
+	roots, err := carRoots(bytes.NewReader(testCAR(1, c1, c2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 2 || !roots[0].Equals(c1) || !roots[1].Equals(c2) {
+		t.Error("unexpected roots:", roots)
+	}
+
+	if _, err := carRoots(bytes.NewReader(testCAR(2, c1))); err == nil {
+		t.Error("expected an error with an unsupported version")
+	}
+	car := testCAR(1, c1)
+	if _, err := carRoots(bytes.NewReader(car[:10])); err == nil {
+		t.Error("expected an error with a truncated header")
+	}
+	if _, err := carRoots(bytes.NewReader([]byte("not a car file"))); err == nil {
+		t.Error("expected an error with an invalid file")
+	}
+}
+
+func TestClusterImportExportCAR(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	pin := api.Pin{ReplicationFactorMin: -1, ReplicationFactorMax: -1, Name: "imported"}
+	pins, err := cl.ImportCAR(pin, bytes.NewReader(testCAR(1, c1)))
+	if err != nil {
+		t.Fatal("import should have worked:", err)
+	}
+	if len(pins) != 1 || !pins[0].Cid.Equals(c1) || pins[0].Name != "imported" {
+		t.Fatal("unexpected pins:", pins)
+	}
+	if _, err := cl.PinGet(c1); err != nil {
+		t.Error("the root should be pinned:", err)
+	}
+
+	if _, err := cl.ImportCAR(pin, bytes.NewReader(testCAR(1))); err == nil {
+		t.Error("expected an error importing a CAR file without roots")
+	}
+
+	var car bytes.Buffer
+	err = cl.ExportCAR(c1, &car)
+	if err != nil {
+		t.Fatal("export should have worked:", err)
+	}
+	if car.String() != "car:"+test.TestCid1 {
+		t.Error("unexpected CAR file:", car.String())
+	}
+
+	c2, _ := cid.Decode(test.TestCid2)
+	if err := cl.ExportCAR(c2, ioutil.Discard); err == nil {
+		t.Error("expected an error exporting an item which is not pinned")
+	}
+}
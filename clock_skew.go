@@ -0,0 +1,60 @@
+package ipfscluster
+
+import (
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// clockSkewMetricName is the metric name used in the alerts sent when
+// the clock of a peer is skewed.
+const clockSkewMetricName = "clockskew"
+
+// checkClockSkew checks, in the leader, the clock skew of every peer
+// against MaxClockSkew. Skewed clocks make metrics expire too early or too
+// late, which causes false peer-down alerts. It raises an alert for every
+// peer whose clock skew is larger than MaxClockSkew, and a recovery alert
+// when it is not.
+func (c *Cluster) checkClockSkew(snap *stateSnapshot) {
+	for _, m := range c.monitor.LastMetrics("ping") {
+		skew, ok := clockSkew(m)
+		if !ok {
+			continue
+		}
+
+		alrt := api.Alert{
+			Peer:        m.Peer,
+			Peername:    m.Peername,
+			MetricName:  clockSkewMetricName,
+			Severity:    api.AlertWarning,
+			TriggeredAt: time.Now(),
+			MetricTTL:   time.Duration(m.Expire - m.Received),
+			LastValue:   skew.String(),
+		}
+
+		if skew > c.config.MaxClockSkew || skew < -c.config.MaxClockSkew {
+			logger.Warningf("the clock of %s is off by %s", m.Peer.Pretty(), skew)
+			c.monitor.RaiseAlert(alrt)
+			continue
+		}
+		alrt.Recovered = true
+		c.monitor.RaiseAlert(alrt)
+	}
+}
+
+// clockSkew estimates how far ahead the clock of the peer which sent a
+// ping metric is from the clock of the monitor which received it, by
+// comparing the time the metric was produced with the time it was
+// received. The estimate includes the transmission delay. It returns
+// false when the metric does not carry a production time, as with
+// older peers.
+func clockSkew(m api.Metric) (time.Duration, bool) {
+	if m.Received == 0 {
+		return 0, false
+	}
+	ph, err := api.PeerHealthFromString(m.Value)
+	if err != nil || ph.Time == 0 {
+		return 0, false
+	}
+	return time.Duration(ph.Time - m.Received), true
+}
@@ -0,0 +1,33 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+func TestClockSkew(t *testing.T) {
+	now := time.Now()
+	ph := api.PeerHealth{Time: now.Add(3 * time.Second).UnixNano()}
+	m := api.Metric{
+		Name:     "ping",
+		Value:    ph.String(),
+		Received: now.UnixNano(),
+	}
+
+	skew, ok := clockSkew(m)
+	if !ok || skew != 3*time.Second {
+		t.Error("expected a 3s skew: ", skew)
+	}
+
+	m.Value = ""
+	if _, ok := clockSkew(m); ok {
+		t.Error("pings from older peers should not provide a skew")
+	}
+
+	m.Value = api.PeerHealth{}.String()
+	if _, ok := clockSkew(m); ok {
+		t.Error("pings without time should not provide a skew")
+	}
+}
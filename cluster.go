@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/eventlog"
 	"github.com/ipfs/ipfs-cluster/pstoremgr"
 	"github.com/ipfs/ipfs-cluster/state"
 
@@ -15,6 +20,8 @@ import (
 	cid "github.com/ipfs/go-cid"
 	host "github.com/libp2p/go-libp2p-host"
 	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+	ping "github.com/libp2p/go-libp2p/p2p/protocol/ping"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -24,6 +31,10 @@ import (
 // consensus layer.
 var ReadyTimeout = 30 * time.Second
 
+// PinBatchConcurrency specifies how many pins of a PinBatch request are
+// allocated and submitted at the same time.
+var PinBatchConcurrency = 128
+
 // Cluster is the main IPFS cluster component. It provides
 // the go-API for it and orchestrates the components that make up the system.
 type Cluster struct {
@@ -36,15 +47,17 @@ type Cluster struct {
 	rpcServer   *rpc.Server
 	rpcClient   *rpc.Client
 	peerManager *pstoremgr.Manager
+	events      *eventlog.Log
 
 	consensus Consensus
-	api       API
+	apis      []API
 	ipfs      IPFSConnector
 	state     state.State
 	tracker   PinTracker
 	monitor   PeerMonitor
 	allocator PinAllocator
-	informer  Informer
+	informers []Informer
+	pinger    *ping.PingService
 
 	shutdownLock sync.Mutex
 	shutdownB    bool
@@ -55,6 +68,48 @@ type Cluster struct {
 	wg           sync.WaitGroup
 
 	paMux sync.Mutex
+
+	paused    bool
+	pausedMux sync.RWMutex
+
+	ignoredStrays map[string]struct{}
+	strayMux      sync.Mutex
+
+	pendingRepins map[peer.ID]*time.Timer
+	repinMux      sync.Mutex
+	repinSem      chan struct{}
+
+	broadcastSem   chan struct{}
+	broadcastWaits uint64
+	rpcLatencies   *rpcLatencies
+
+	// enabledFeatures are the gated features supported by enough
+	// cluster peers to be used (see watchFeatures).
+	enabledFeatures    map[string]bool
+	enabledFeaturesMux sync.RWMutex
+
+	// lastWarm is the last time that each boosted pin was seen
+	// retrieved more than PopularityColdThreshold times.
+	lastWarm    map[string]time.Time
+	lastWarmMux sync.Mutex
+
+	// underReplicated holds the backoff of the under-replicated pins
+	// which the leader tries to top up.
+	underReplicated    map[string]*topUpBackoff
+	underReplicatedMux sync.Mutex
+
+	allocHistory *allocationHistory
+	tempPins     *temporaryPins
+
+	webhooks     webhookCache
+	webhookQueue chan webhookDelivery
+
+	// rpcProtocol is RPCProtocol in the namespace of the cluster.
+	rpcProtocol protocol.ID
+	// dagPushProtocol and dagPullProtocol are DAGPushProtocol and
+	// DAGPullProtocol in the namespace of the cluster.
+	dagPushProtocol protocol.ID
+	dagPullProtocol protocol.ID
 }
 
 // NewCluster builds a new IPFS Cluster peer. It initializes a LibP2P host,
@@ -63,23 +118,31 @@ type Cluster struct {
 // The new cluster peer may still be performing initialization tasks when
 // this call returns (consensus may still be bootstrapping). Use Cluster.Ready()
 // if you need to wait until the peer is fully up.
+//
+// The metrics of all the given informers are broadcasted. The metric of the
+// first one is used for allocations unless AllocationMetric is set. Any
+// number of APIs may be given, including none.
 func NewCluster(
 	host host.Host,
 	cfg *Config,
 	consensus Consensus,
-	api API,
+	apis []API,
 	ipfs IPFSConnector,
 	st state.State,
 	tracker PinTracker,
 	monitor PeerMonitor,
 	allocator PinAllocator,
-	informer Informer) (*Cluster, error) {
+	informers []Informer) (*Cluster, error) {
 
 	err := cfg.Validate()
 	if err != nil {
 		return nil, err
 	}
 
+	if len(informers) == 0 {
+		return nil, errors.New("at least one informer is needed")
+	}
+
 	if host == nil {
 		return nil, errors.New("cluster host is nil")
 	}
@@ -97,6 +160,26 @@ func NewCluster(
 
 	peerManager := pstoremgr.New(host, cfg.GetPeerstorePath())
 
+	events, err := eventlog.New(cfg.GetEventsPath(), cfg.EventsRetention)
+	if err != nil {
+		logger.Errorf("error loading events (they will not be persisted): %s", err)
+		events, _ = eventlog.New("", cfg.EventsRetention)
+	}
+
+	allocHistory := newAllocationHistory(cfg.AllocationHistorySize)
+	if path := cfg.GetAllocationHistoryPath(); path != "" {
+		if err := allocHistory.open(path); err != nil {
+			logger.Errorf("error loading allocation history (it will not be persisted): %s", err)
+		}
+	}
+
+	tempPins := newTemporaryPins()
+	if path := cfg.GetTemporaryPinsPath(); path != "" {
+		if err := tempPins.open(path); err != nil {
+			logger.Errorf("error loading temporary pins (they will not be persisted): %s", err)
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	c := &Cluster{
 		ctx:         ctx,
@@ -105,19 +188,37 @@ func NewCluster(
 		config:      cfg,
 		host:        host,
 		consensus:   consensus,
-		api:         api,
+		apis:        apis,
 		ipfs:        ipfs,
 		state:       st,
 		tracker:     tracker,
 		monitor:     monitor,
 		allocator:   allocator,
-		informer:    informer,
+		informers:   informers,
+		pinger:      ping.NewPingService(host),
 		peerManager: peerManager,
+		events:      events,
 		shutdownB:   false,
 		removed:     false,
 		doneCh:      make(chan struct{}),
 		readyCh:     make(chan struct{}),
 		readyB:      false,
+
+		ignoredStrays: make(map[string]struct{}),
+		pendingRepins: make(map[peer.ID]*time.Timer),
+		repinSem:      make(chan struct{}, cfg.RepinConcurrency),
+		broadcastSem:  make(chan struct{}, cfg.BroadcastConcurrency),
+		rpcLatencies:  newRPCLatencies(),
+		lastWarm:      make(map[string]time.Time),
+		allocHistory:  allocHistory,
+		tempPins:      tempPins,
+		rpcProtocol:   NamespacedProtocol(cfg.Namespace, RPCProtocol),
+
+		dagPushProtocol: NamespacedProtocol(cfg.Namespace, DAGPushProtocol),
+		dagPullProtocol: NamespacedProtocol(cfg.Namespace, DAGPullProtocol),
+		enabledFeatures: make(map[string]bool),
+		underReplicated: make(map[string]*topUpBackoff),
+		webhookQueue:    make(chan webhookDelivery, webhookQueueSize),
 	}
 
 	err = c.setupRPC()
@@ -127,6 +228,27 @@ func NewCluster(
 	}
 
 	c.setupRPCClients()
+
+	if c.supportsCAR() {
+		host.SetStreamHandler(c.dagPushProtocol, c.handleDAGPush)
+		host.SetStreamHandler(c.dagPullProtocol, c.handleDAGPull)
+	}
+
+	if notifier, ok := consensus.(StateNotifier); ok {
+		changes := notifier.Subscribe()
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.watchStateChanges(changes)
+		}()
+	}
+
+	err = c.startLocalRPC()
+	if err != nil {
+		c.Shutdown()
+		return nil, err
+	}
+
 	go func() {
 		c.ready(ReadyTimeout)
 		c.run()
@@ -135,13 +257,29 @@ func NewCluster(
 }
 
 func (c *Cluster) setupRPC() error {
-	rpcServer := rpc.NewServer(c.host, RPCProtocol)
+	var rpcHost host.Host = c.host
+	if !c.config.DisableRPCCompression {
+		rpcHost = newCompressingHost(c.host, c.config.RPCCompressionThreshold, func() bool {
+			return c.featureEnabled(api.FeatureRPCCompression)
+		})
+	}
+
+	serverHost := rpcHost
+	if tc, ok := c.consensus.(TrustingConsensus); ok {
+		th, err := newTrustingHost(rpcHost, c.rpcProtocol, tc.IsTrusted, &untrustedRPCAPI{&RPCAPI{c}})
+		if err != nil {
+			return err
+		}
+		serverHost = th
+	}
+
+	rpcServer := rpc.NewServer(serverHost, c.rpcProtocol)
 	err := rpcServer.RegisterName("Cluster", &RPCAPI{c})
 	if err != nil {
 		return err
 	}
 	c.rpcServer = rpcServer
-	rpcClient := rpc.NewClientWithServer(c.host, RPCProtocol, rpcServer)
+	rpcClient := rpc.NewClientWithServer(rpcHost, c.rpcProtocol, rpcServer)
 	c.rpcClient = rpcClient
 	return nil
 }
@@ -149,28 +287,54 @@ func (c *Cluster) setupRPC() error {
 func (c *Cluster) setupRPCClients() {
 	c.tracker.SetClient(c.rpcClient)
 	c.ipfs.SetClient(c.rpcClient)
-	c.api.SetClient(c.rpcClient)
+	for _, api := range c.apis {
+		api.SetClient(c.rpcClient)
+	}
 	c.consensus.SetClient(c.rpcClient)
 	c.monitor.SetClient(c.rpcClient)
 	c.allocator.SetClient(c.rpcClient)
-	c.informer.SetClient(c.rpcClient)
+	for _, inf := range c.informers {
+		inf.SetClient(c.rpcClient)
+	}
 }
 
 // syncWatcher loops and triggers StateSync and SyncAllLocal from time to time
 func (c *Cluster) syncWatcher() {
-	stateSyncTicker := time.NewTicker(c.config.StateSyncInterval)
-	syncTicker := time.NewTicker(c.config.IPFSSyncInterval)
+	stateSyncInterval := newAdaptiveInterval(
+		c.config.StateSyncInterval,
+		c.config.StateSyncIntervalMin,
+		c.config.StateSyncIntervalMax,
+	)
+	ipfsSyncInterval := newAdaptiveInterval(
+		c.config.IPFSSyncInterval,
+		c.config.IPFSSyncIntervalMin,
+		c.config.IPFSSyncIntervalMax,
+	)
+	stateSyncTimer := time.NewTimer(c.config.StateSyncInterval)
+	syncTimer := time.NewTimer(c.config.IPFSSyncInterval)
 
 	for {
 		select {
-		case <-stateSyncTicker.C:
+		case <-stateSyncTimer.C:
+			if !c.stateSyncNeeded() {
+				logger.Debug("skipping StateSync(): the tracker follows the state changes")
+				stateSyncTimer.Reset(stateSyncInterval.next(false))
+				continue
+			}
 			logger.Debug("auto-triggering StateSync()")
-			c.StateSync()
-		case <-syncTicker.C:
+			changed, err := c.StateSync()
+			next := stateSyncInterval.next(err != nil || len(changed) > 0)
+			logger.Debugf("next StateSync() in %s", next)
+			stateSyncTimer.Reset(next)
+		case <-syncTimer.C:
 			logger.Debug("auto-triggering SyncAllLocal()")
-			c.SyncAllLocal()
+			synced, err := c.SyncAllLocal()
+			next := ipfsSyncInterval.next(err != nil || len(synced) > 0)
+			logger.Debugf("next SyncAllLocal() in %s", next)
+			syncTimer.Reset(next)
 		case <-c.ctx.Done():
-			stateSyncTicker.Stop()
+			stateSyncTimer.Stop()
+			syncTimer.Stop()
 			return
 		}
 	}
@@ -192,6 +356,12 @@ func (c *Cluster) broadcastMetric(m api.Metric) error {
 		return nil
 	}
 
+	m.Peername = c.config.Peername
+	err = m.Sign(c.config.PrivateKey)
+	if err != nil {
+		return err
+	}
+
 	// If a peer is down, the rpc call will get locked. Therefore,
 	// we need to do it async. This way we keep broadcasting
 	// even if someone is down. Eventually those requests will
@@ -229,8 +399,76 @@ func (c *Cluster) broadcastMetric(m api.Metric) error {
 	return nil
 }
 
-// push metrics loops and pushes metrics to the leader's monitor
-func (c *Cluster) pushInformerMetrics() {
+// PushMetric broadcasts a metric produced by an external process as if
+// it had been produced by this peer. It allows to feed custom metrics to
+// the monitor, which can then be used for allocations (see
+// AllocationMetric). The metrics produced by the peer itself (ping,
+// pin capacity and informer metrics) cannot be pushed.
+func (c *Cluster) PushMetric(m api.Metric) error {
+	if m.Name == "" {
+		return errors.New("metric name is empty")
+	}
+	for _, name := range c.producedMetrics() {
+		if m.Name == name {
+			return fmt.Errorf("%s metrics are produced by the peer and cannot be pushed", m.Name)
+		}
+	}
+	if m.Expired() {
+		return errors.New("metric has already expired")
+	}
+
+	m.Peer = c.id
+	m.Valid = true
+	return c.broadcastMetric(m)
+}
+
+// producedMetrics returns the names of the metrics broadcasted by
+// this peer.
+func (c *Cluster) producedMetrics() []string {
+	names := []string{"ping", pinCapacityMetricName}
+	for _, inf := range c.informers {
+		if multi, ok := inf.(MultiInformer); ok {
+			names = append(names, multi.MetricNames()...)
+			continue
+		}
+		names = append(names, inf.Name())
+	}
+	return names
+}
+
+// logMetric verifies that a metric was signed by the peer it
+// belongs to before handing it to the PeerMonitor. Peers running older
+// versions do not sign their metrics, so unsigned metrics are accepted
+// until every cluster peer advertises signed metrics.
+func (c *Cluster) logMetric(m api.Metric) error {
+	if len(m.Signature) == 0 {
+		if c.featureEnabled(api.FeatureSignedMetrics) {
+			err := errors.New("metric is not signed")
+			logger.Warningf("rejecting metric %s from %s: %s", m.Name, m.Peer.Pretty(), err)
+			return err
+		}
+		c.monitor.LogMetric(m)
+		return nil
+	}
+
+	pubKey := c.host.Peerstore().PubKey(m.Peer)
+	if pubKey == nil {
+		return fmt.Errorf("unknown public key for %s", m.Peer.Pretty())
+	}
+
+	err := m.VerifySignature(pubKey)
+	if err != nil {
+		logger.Warningf("rejecting metric %s from %s: %s", m.Name, m.Peer.Pretty(), err)
+		return err
+	}
+
+	c.monitor.LogMetric(m)
+	return nil
+}
+
+// push metrics loops and pushes the metrics of an informer to the
+// leader's monitor
+func (c *Cluster) pushInformerMetrics(inf Informer) {
 	timer := time.NewTimer(0) // fire immediately first
 	// The following control how often to make and log
 	// a retry
@@ -244,10 +482,18 @@ func (c *Cluster) pushInformerMetrics() {
 			// wait
 		}
 
-		metric := c.informer.GetMetric()
-		metric.Peer = c.id
-
-		err := c.broadcastMetric(metric)
+		// the metrics are sent again according to the shortest TTL
+		ttl := c.config.MonitorPingInterval
+		var err error
+		for i, metric := range informerMetrics(inf) {
+			metric.Peer = c.id
+			if e := c.broadcastMetric(metric); e != nil {
+				err = e
+			}
+			if t := metric.GetTTL(); i == 0 || t < ttl {
+				ttl = t
+			}
+		}
 
 		if err != nil {
 			if (retries % retryWarnMod) == 0 {
@@ -255,14 +501,23 @@ func (c *Cluster) pushInformerMetrics() {
 				retries++
 			}
 			// retry in retryDelay
-			timer.Reset(metric.GetTTL() / 4)
+			timer.Reset(ttl / 4)
 			continue
 		}
 
 		retries = 0
 		// send metric again in TTL/2
-		timer.Reset(metric.GetTTL() / 2)
+		timer.Reset(ttl / 2)
+	}
+}
+
+// informerMetrics returns the metrics produced by an informer, using
+// GetMetrics for MultiInformers.
+func informerMetrics(inf Informer) []api.Metric {
+	if multi, ok := inf.(MultiInformer); ok {
+		return multi.GetMetrics()
 	}
+	return []api.Metric{inf.GetMetric()}
 }
 
 func (c *Cluster) pushPingMetrics() {
@@ -271,6 +526,57 @@ func (c *Cluster) pushPingMetrics() {
 		metric := api.Metric{
 			Name:  "ping",
 			Peer:  c.id,
+			Value: c.health().String(),
+			Valid: true,
+		}
+		metric.SetTTLDuration(c.config.MonitorPingInterval * 2)
+		c.broadcastMetric(metric)
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// health produces a summary of the status of this peer.
+func (c *Cluster) health() api.PeerHealth {
+	var ph api.PeerHealth
+
+	_, err := c.ipfs.ID()
+	ph.IPFS = err == nil
+
+	_, err = c.consensus.State()
+	ph.State = err == nil
+
+	for _, pinfo := range c.tracker.StatusAll() {
+		switch pinfo.Status {
+		case api.TrackerStatusPinQueued, api.TrackerStatusUnpinQueued:
+			ph.Queued++
+		case api.TrackerStatusPinError, api.TrackerStatusUnpinError, api.TrackerStatusClusterError:
+			ph.Errors++
+		}
+	}
+	ph.Time = time.Now().UnixNano()
+	ph.Features = c.features()
+	return ph
+}
+
+// pushCapacityMetrics broadcasts the remaining pin capacity of this peer
+// when the tracker has a pin limit.
+func (c *Cluster) pushCapacityMetrics() {
+	limiter, ok := c.tracker.(PinLimiter)
+	if !ok || limiter.Capacity() < 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.config.MonitorPingInterval)
+	for {
+		metric := api.Metric{
+			Name:  pinCapacityMetricName,
+			Peer:  c.id,
+			Value: fmt.Sprintf("%d", limiter.Capacity()),
 			Valid: true,
 		}
 		metric.SetTTLDuration(c.config.MonitorPingInterval * 2)
@@ -294,10 +600,19 @@ func (c *Cluster) alertsHandler() {
 			// only the leader handles alerts
 			leader, err := c.consensus.Leader()
 			if err == nil && leader == c.id {
-				logger.Warningf("Peer %s received alert for %s in %s", c.id, alrt.MetricName, alrt.Peer.Pretty())
+				if alrt.Recovered {
+					logger.Infof("Peer %s received recovery alert for %s in %s (%s)", c.id, alrt.MetricName, alrt.Peer.Pretty(), alrt.Peername)
+					c.recordEvent(api.InternalOrigin("monitor"), api.EventRecovered, nil, alrt.Peer, alrt.MetricName)
+					if alrt.MetricName == "ping" {
+						c.cancelRepin(alrt.Peer)
+					}
+					continue
+				}
+				logger.Warningf("Peer %s received %s alert for %s in %s (%s)", c.id, alrt.Severity, alrt.MetricName, alrt.Peer.Pretty(), alrt.Peername)
+				c.recordEvent(api.InternalOrigin("monitor"), api.EventAlert, nil, alrt.Peer, alrt.MetricName)
 				switch alrt.MetricName {
 				case "ping":
-					c.repinFromPeer(alrt.Peer)
+					c.scheduleRepin(alrt.Peer)
 				}
 			}
 		}
@@ -356,36 +671,114 @@ func (c *Cluster) watchPeers() {
 	}
 }
 
-// find all Cids pinned to a given peer and triggers re-pins on them.
-func (c *Cluster) repinFromPeer(p peer.ID) {
-	if c.config.DisableRepinning {
-		logger.Warningf("repinning is disabled. Will not re-allocate cids from %s", p.Pretty())
-		return
+// run launches some go-routines which live throughout the cluster's life
+func (c *Cluster) run() {
+	go c.syncWatcher()
+	go c.pushPingMetrics()
+	// Peers which do not store pins publish no metrics for the
+	// allocator, so they never receive allocations. They still
+	// publish the popularity of the content read through them.
+	for _, inf := range c.informers {
+		if c.config.StoresPins() || inf.Name() == popularityMetricName {
+			go c.pushInformerMetrics(inf)
+		}
 	}
+	if c.config.StoresPins() {
+		go c.pushCapacityMetrics()
+	}
+	go c.watchLeaderChecks()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchFeatures()
+	}()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchErroredPins()
+	}()
+	go c.watchPeers()
+	go c.alertsHandler()
+	// The events log is closed once the waitgroup is done.
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.compactEvents()
+	}()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchStatusChanges()
+	}()
+	for i := 0; i < webhookWorkers; i++ {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.deliverWebhooks()
+		}()
+	}
+	go c.saveAllocationHistory()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.releaseTemporaryPins()
+	}()
+}
 
-	cState, err := c.consensus.State()
-	if err != nil {
-		logger.Warning(err)
+// compactEvents regularly drops events which are older than the
+// configured retention.
+func (c *Cluster) compactEvents() {
+	if c.config.EventsRetention <= 0 {
 		return
 	}
-	list := cState.List()
-	for _, pin := range list {
-		if containsPeer(pin.Allocations, p) {
-			ok, err := c.pin(pin, []peer.ID{p}, []peer.ID{}) // pin blacklisting this peer
-			if ok && err == nil {
-				logger.Infof("repinned %s out of %s", pin.Cid, p.Pretty())
+
+	interval := c.config.EventsRetention / 10
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.events.Compact(); err != nil {
+				logger.Errorf("error compacting events: %s", err)
 			}
 		}
 	}
 }
 
-// run launches some go-routines which live throughout the cluster's life
-func (c *Cluster) run() {
-	go c.syncWatcher()
-	go c.pushPingMetrics()
-	go c.pushInformerMetrics()
-	go c.watchPeers()
-	go c.alertsHandler()
+// recordEvent adds a new event to the events log. Events about a Cid are
+// delivered to the webhooks along with its pin from the shared state.
+func (c *Cluster) recordEvent(origin api.Origin, evType string, h *cid.Cid, p peer.ID, msg string) {
+	var pin api.Pin
+	if h != nil {
+		pin, _ = c.getCurrentPin(h)
+		pin.Cid = h
+	}
+	c.recordPinEvent(origin, evType, pin, p, msg)
+}
+
+// recordPinEvent is recordEvent for events about the given pin, which
+// may be gone from the shared state already.
+func (c *Cluster) recordPinEvent(origin api.Origin, evType string, pin api.Pin, p peer.ID, msg string) {
+	ev := api.Event{
+		Type:      evType,
+		Timestamp: time.Now(),
+		Origin:    string(origin),
+		Message:   msg,
+	}
+	if pin.Cid != nil {
+		ev.Cid = pin.Cid.String()
+	}
+	if p != "" {
+		ev.Peer = peer.IDB58Encode(p)
+	}
+	c.events.Append(ev)
+	c.notifyWebhooks(ev, pin)
 }
 
 func (c *Cluster) ready(timeout time.Duration) {
@@ -445,6 +838,65 @@ This might be due to one or several causes:
 	logger.Info("** IPFS Cluster is READY **")
 }
 
+// Readiness reports which of the components of this peer are ready to
+// operate: consensus must have caught up, the IPFS daemon must be
+// reachable and the tracker must have loaded the shared state.
+func (c *Cluster) Readiness() api.Readiness {
+	consensusReady := false
+	select {
+	case <-c.consensus.Ready():
+		consensusReady = true
+	default:
+	}
+
+	_, err := c.ipfs.ID()
+	ipfsReady := err == nil
+
+	// readyCh is closed after the state has been synced to the tracker.
+	// Unlike readyB, it can be checked concurrently with run().
+	trackerReady := false
+	select {
+	case <-c.readyCh:
+		trackerReady = true
+	default:
+	}
+
+	return api.Readiness{
+		Ready: consensusReady && ipfsReady && trackerReady,
+		Components: map[string]bool{
+			"consensus": consensusReady,
+			"ipfs":      ipfsReady,
+			"tracker":   trackerReady,
+		},
+	}
+}
+
+// RaftHealth reports the state of the Raft consensus in this peer. It
+// fails when the consensus component does not use Raft.
+func (c *Cluster) RaftHealth() (api.RaftHealth, error) {
+	reporter, ok := c.consensus.(RaftReporter)
+	if !ok {
+		return api.RaftHealth{}, errors.New("the consensus component does not use Raft")
+	}
+	health := reporter.RaftHealth()
+	health.Peername = c.config.Peername
+	return health, nil
+}
+
+// PinQueue describes the pin and unpin operations queued in the
+// PinTracker of this peer. It fails when the PinTracker does not
+// report its queue.
+func (c *Cluster) PinQueue() (api.PinQueue, error) {
+	reporter, ok := c.tracker.(PinQueueReporter)
+	if !ok {
+		return api.PinQueue{}, errors.New("the pin tracker does not report its queue")
+	}
+	queue := reporter.PinQueue()
+	queue.Peer = c.id.Pretty()
+	queue.Peername = c.config.Peername
+	return queue, nil
+}
+
 // Ready returns a channel which signals when this peer is
 // fully initialized (including consensus).
 func (c *Cluster) Ready() <-chan struct{} {
@@ -453,6 +905,11 @@ func (c *Cluster) Ready() <-chan struct{} {
 
 // Shutdown stops the IPFS cluster components
 func (c *Cluster) Shutdown() error {
+	return c.shutdown(c.config.LeaveOnShutdown)
+}
+
+// shutdown stops the peer, leaving the cluster first when leave is set.
+func (c *Cluster) shutdown(leave bool) error {
 	c.shutdownLock.Lock()
 	defer c.shutdownLock.Unlock()
 
@@ -467,7 +924,7 @@ func (c *Cluster) Shutdown() error {
 	// - consensus is initialized
 	// - cluster was ready (no bootstrapping error)
 	// - We are not removed already (means watchPeers() called us)
-	if c.consensus != nil && c.config.LeaveOnShutdown && c.readyB && !c.removed {
+	if c.consensus != nil && leave && c.readyB && !c.removed {
 		c.removed = true
 		_, err := c.consensus.Peers()
 		if err == nil {
@@ -507,9 +964,11 @@ func (c *Cluster) Shutdown() error {
 		return err
 	}
 
-	if err := c.api.Shutdown(); err != nil {
-		logger.Errorf("error stopping API: %s", err)
-		return err
+	for _, api := range c.apis {
+		if err := api.Shutdown(); err != nil {
+			logger.Errorf("error stopping API: %s", err)
+			return err
+		}
 	}
 	if err := c.ipfs.Shutdown(); err != nil {
 		logger.Errorf("error stopping IPFS Connector: %s", err)
@@ -524,11 +983,38 @@ func (c *Cluster) Shutdown() error {
 	c.cancel()
 	c.host.Close() // Shutdown all network services
 	c.wg.Wait()
+	c.events.Close()
+	if err := c.allocHistory.close(); err != nil {
+		logger.Errorf("error saving allocation history: %s", err)
+	}
+	if err := c.tempPins.close(); err != nil {
+		logger.Errorf("error closing the temporary pins datastore: %s", err)
+	}
 	c.shutdownB = true
 	close(c.doneCh)
 	return nil
 }
 
+// SetListenAddr makes the libp2p host of this peer listen on a new
+// address, so that other peers can connect to it there. The previous
+// addresses cannot be closed by the libp2p network and keep working
+// until the peer is restarted, which means that the connections
+// established on them are not interrupted.
+func (c *Cluster) SetListenAddr(addr ma.Multiaddr) error {
+	for _, a := range c.host.Network().ListenAddresses() {
+		if a.Equal(addr) {
+			return nil
+		}
+	}
+
+	err := c.host.Network().Listen(addr)
+	if err != nil {
+		return err
+	}
+	logger.Infof("IPFS Cluster now listening on %s", addr)
+	return nil
+}
+
 // Done provides a way to learn if the Peer has been shutdown
 // (for example, because it has been removed from the Cluster)
 func (c *Cluster) Done() <-chan struct{} {
@@ -557,6 +1043,20 @@ func (c *Cluster) ID() api.ID {
 		peers, _ = c.consensus.Peers()
 	}
 
+	var tags map[string]string
+	for _, inf := range c.informers {
+		tagger, ok := inf.(Tagger)
+		if !ok {
+			continue
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		for k, v := range tagger.Tags() {
+			tags[k] = v
+		}
+	}
+
 	return api.ID{
 		ID: c.id,
 		//PublicKey:          c.host.Peerstore().PubKey(c.id),
@@ -565,9 +1065,15 @@ func (c *Cluster) ID() api.ID {
 		ClusterPeersAddresses: c.peerManager.PeersAddresses(peers),
 		Version:               Version,
 		Commit:                Commit,
-		RPCProtocolVersion:    RPCProtocol,
+		RPCProtocolVersion:    c.rpcProtocol,
 		IPFS:                  ipfsID,
 		Peername:              c.config.Peername,
+		Tags:                  tags,
+		Role:                  c.config.Role,
+		Annotation:            c.peerAnnotations()[c.id],
+		GoVersion:             runtime.Version(),
+		Components:            c.components(),
+		Features:              c.features(),
 	}
 }
 
@@ -578,6 +1084,11 @@ func (c *Cluster) ID() api.ID {
 // list of peers). The new peer should be a single-peer cluster,
 // preferable without any relevant state.
 func (c *Cluster) PeerAdd(addr ma.Multiaddr) (api.ID, error) {
+	return c.peerAdd("", addr)
+}
+
+// peerAdd performs PeerAdd on behalf of the given origin.
+func (c *Cluster) peerAdd(origin api.Origin, addr ma.Multiaddr) (api.ID, error) {
 	// starting 10 nodes on the same box for testing
 	// causes deadlock and a global lock here
 	// seems to help.
@@ -644,13 +1155,15 @@ func (c *Cluster) PeerAdd(addr ma.Multiaddr) (api.ID, error) {
 		logger.Error(err)
 	}
 
-	// Log the new peer in the log so everyone gets it.
-	err = c.consensus.AddPeer(pid)
+	// Log the new peer in the log so everyone gets it. Followers
+	// do not vote.
+	err = c.addConsensusPeer(pid)
 	if err != nil {
 		logger.Error(err)
 		id := api.ID{ID: pid, Error: err.Error()}
 		return id, err
 	}
+	c.recordEvent(origin, api.EventPeerAdded, nil, pid, "")
 
 	// Ask the new peer to connect its IPFS daemon to the rest
 	err = c.rpcClient.Call(pid,
@@ -691,9 +1204,15 @@ func (c *Cluster) PeerAdd(addr ma.Multiaddr) (api.ID, error) {
 // The peer will be removed from the consensus peerset, all it's content
 // will be re-pinned and the peer it will shut itself down.
 func (c *Cluster) PeerRemove(pid peer.ID) error {
+	return c.peerRemove("", pid)
+}
+
+// peerRemove performs PeerRemove on behalf of the given origin.
+func (c *Cluster) peerRemove(origin api.Origin, pid peer.ID) error {
 	// We need to repin before removing the peer, otherwise, it won't
 	// be able to submit the pins.
 	logger.Infof("re-allocating all CIDs directly associated to %s", pid)
+	c.cancelRepin(pid)
 	c.repinFromPeer(pid)
 
 	err := c.consensus.RmPeer(pid)
@@ -701,7 +1220,8 @@ func (c *Cluster) PeerRemove(pid peer.ID) error {
 		logger.Error(err)
 		return err
 	}
-
+	logger.Infof("removed peer %s (origin: %s)", pid, origin)
+	c.recordEvent(origin, api.EventPeerRemoved, nil, pid, "")
 	return nil
 }
 
@@ -725,16 +1245,22 @@ func (c *Cluster) Join(addr ma.Multiaddr) error {
 	// Add peer to peerstore so we can talk to it
 	c.peerManager.ImportPeer(addr, true)
 
-	// Note that PeerAdd() on the remote peer will
-	// figure out what our real address is (obviously not
-	// ListenAddr).
-	var myID api.IDSerial
-	err = c.rpcClient.Call(pid,
-		"Cluster",
-		"PeerAdd",
-		api.MultiaddrToSerial(
-			api.MustLibp2pMultiaddrJoin(c.config.ListenAddr, c.id)),
-		&myID)
+	if tc, ok := c.consensus.(TrustingConsensus); ok && !tc.IsTrusted(c.id) {
+		// Followers cannot be added by other peers: they only need
+		// to connect, and they announce themselves when syncing.
+		err = c.host.Connect(c.ctx, c.host.Peerstore().PeerInfo(pid))
+	} else {
+		// Note that PeerAdd() on the remote peer will
+		// figure out what our real address is (obviously not
+		// ListenAddr).
+		var myID api.IDSerial
+		err = c.rpcClient.Call(pid,
+			"Cluster",
+			"PeerAdd",
+			api.MultiaddrToSerial(
+				api.MustLibp2pMultiaddrJoin(c.config.ListenAddr, c.id)),
+			&myID)
+	}
 	if err != nil {
 		logger.Error(err)
 		return err
@@ -773,11 +1299,10 @@ func (c *Cluster) StateSync() ([]api.PinInfo, error) {
 	}
 
 	logger.Debug("syncing state to tracker")
-	clusterPins := cState.List()
 	var changed []*cid.Cid
 
-	// Track items which are not tracked
-	for _, pin := range clusterPins {
+	// Track items allocated to this peer which are not tracked
+	for _, pin := range cState.ListAllocatedTo(c.id) {
 		if c.tracker.Status(pin.Cid).Status == api.TrackerStatusUnpinned {
 			logger.Debugf("StateSync: tracking %s, part of the shared state", pin.Cid)
 			changed = append(changed, pin.Cid)
@@ -821,12 +1346,12 @@ func (c *Cluster) StateSync() ([]api.PinInfo, error) {
 // If an error happens, the slice will contain as much information as
 // could be fetched from other peers.
 func (c *Cluster) StatusAll() ([]api.GlobalPinInfo, error) {
-	return c.globalPinInfoSlice("TrackerStatusAll")
+	return c.globalPinInfoSlice("TrackerStatusAll", struct{}{})
 }
 
 // StatusAllLocal returns the PinInfo for all the tracked Cids in this peer.
 func (c *Cluster) StatusAllLocal() []api.PinInfo {
-	return c.tracker.StatusAll()
+	return c.withRemoteAllocations(c.tracker.StatusAll())
 }
 
 // Status returns the GlobalPinInfo for a given Cid as fetched from all
@@ -838,7 +1363,52 @@ func (c *Cluster) Status(h *cid.Cid) (api.GlobalPinInfo, error) {
 
 // StatusLocal returns this peer's PinInfo for a given Cid.
 func (c *Cluster) StatusLocal(h *cid.Cid) api.PinInfo {
-	return c.tracker.Status(h)
+	return c.withRemoteAllocations([]api.PinInfo{c.tracker.Status(h)})[0]
+}
+
+// StatusCids returns the GlobalPinInfo for the given Cids as fetched from
+// all current peers, with a single request to each of them. If an error
+// happens, the slice will contain as much information as could be fetched
+// from the peers.
+func (c *Cluster) StatusCids(cids []*cid.Cid) ([]api.GlobalPinInfo, error) {
+	cidStrs := make([]string, len(cids), len(cids))
+	for i, h := range cids {
+		cidStrs[i] = h.String()
+	}
+	return c.globalPinInfoSlice("TrackerStatusCids", cidStrs)
+}
+
+// StatusCidsLocal returns this peer's PinInfo for the given Cids.
+func (c *Cluster) StatusCidsLocal(cids []*cid.Cid) []api.PinInfo {
+	pinfos := make([]api.PinInfo, len(cids), len(cids))
+	for i, h := range cids {
+		pinfos[i] = c.tracker.Status(h)
+	}
+	return c.withRemoteAllocations(pinfos)
+}
+
+// withRemoteAllocations sets the peers which hold the items in REMOTE
+// status, as found in the shared state, so that they can be told apart
+// from items which are missing.
+func (c *Cluster) withRemoteAllocations(pinfos []api.PinInfo) []api.PinInfo {
+	var st state.State
+	for i, pinfo := range pinfos {
+		if pinfo.Status != api.TrackerStatusRemote || pinfo.Cid == nil {
+			continue
+		}
+		if st == nil {
+			var err error
+			st, err = c.consensus.State()
+			if err != nil {
+				logger.Debug(err)
+				return pinfos
+			}
+		}
+		if st.Has(pinfo.Cid) {
+			pinfos[i].Allocations = st.Get(pinfo.Cid).Allocations
+		}
+	}
+	return pinfos
 }
 
 // SyncAll triggers SyncAllLocal() operations in all cluster peers, making sure
@@ -846,7 +1416,7 @@ func (c *Cluster) StatusLocal(h *cid.Cid) api.PinInfo {
 // and returning the results as GlobalPinInfo. If an error happens, the slice
 // will contain as much information as could be fetched from the peers.
 func (c *Cluster) SyncAll() ([]api.GlobalPinInfo, error) {
-	return c.globalPinInfoSlice("SyncAllLocal")
+	return c.globalPinInfoSlice("SyncAllLocal", struct{}{})
 }
 
 // SyncAllLocal makes sure that the current state for all tracked items
@@ -932,6 +1502,90 @@ func (c *Cluster) PinGet(h *cid.Cid) (api.Pin, error) {
 	return pin, nil
 }
 
+// KVs returns the list of KV records stored in the shared state.
+func (c *Cluster) KVs() []api.KV {
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return []api.KV{}
+	}
+	return cState.ListKV()
+}
+
+// KVGet returns the KV record for the given key from the shared state. It
+// returns an error if the key is not part of the shared state.
+func (c *Cluster) KVGet(key string) (api.KV, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		return api.KV{}, err
+	}
+	kv, ok := cState.GetKV(key)
+	if !ok {
+		return kv, errors.New("key is not part of the global state")
+	}
+	return kv, nil
+}
+
+// KVSet stores a KV record in the shared state, replacing any
+// previous value for the same key.
+func (c *Cluster) KVSet(kv api.KV) error {
+	if err := kv.Validate(); err != nil {
+		return err
+	}
+	return c.consensus.LogSetKV(kv)
+}
+
+// KVRm removes a KV record from the shared state.
+func (c *Cluster) KVRm(key string) error {
+	if _, err := c.KVGet(key); err != nil {
+		return err
+	}
+	return c.consensus.LogRmKV(key)
+}
+
+// peerAnnotationPrefix is the prefix of the keys of the KV records which
+// hold the annotations of the peers.
+const peerAnnotationPrefix = "peer-annotation:"
+
+// AnnotatePeer stores a free-form annotation for the given peer in the
+// shared state, replacing any previous one. An empty annotation removes
+// it.
+func (c *Cluster) AnnotatePeer(pid peer.ID, annotation string) error {
+	key := peerAnnotationPrefix + peer.IDB58Encode(pid)
+	if annotation == "" {
+		if _, err := c.KVGet(key); err != nil {
+			return nil // nothing to remove
+		}
+		return c.KVRm(key)
+	}
+	return c.KVSet(api.KV{Key: key, Value: annotation})
+}
+
+// peerAnnotations returns the annotations of the peers found in the
+// shared state.
+func (c *Cluster) peerAnnotations() map[peer.ID]string {
+	annotations := make(map[peer.ID]string)
+	// ID() might get called before consensus is set
+	if c.consensus == nil {
+		return annotations
+	}
+	cState, err := c.consensus.State()
+	if err != nil {
+		return annotations
+	}
+	for _, kv := range cState.ListKV() {
+		if !strings.HasPrefix(kv.Key, peerAnnotationPrefix) {
+			continue
+		}
+		pid, err := peer.IDB58Decode(strings.TrimPrefix(kv.Key, peerAnnotationPrefix))
+		if err != nil {
+			continue
+		}
+		annotations[pid] = kv.Value
+	}
+	return annotations
+}
+
 // Pin makes the cluster Pin a Cid. This implies adding the Cid
 // to the IPFS Cluster peers shared-state. Depending on the cluster
 // pinning strategy, the PinTracker may then request the IPFS daemon
@@ -949,18 +1603,239 @@ func (c *Cluster) PinGet(h *cid.Cid) (api.Pin, error) {
 // the cluster.  Priority allocations are best effort.  If any priority peers
 // are unavailable then Pin will simply allocate from the rest of the cluster.
 func (c *Cluster) Pin(pin api.Pin) error {
-	_, err := c.pin(pin, []peer.ID{}, pin.Allocations)
+	_, err := c.PinWithResult(pin)
 	return err
 }
 
+// PinWithResult works like Pin but it returns a PinResult describing how
+// the request was applied. When the Cid is already pinned, the options of
+// the existing pin are overwritten or merged with the given ones,
+// according to the pin_merge_policy configuration option.
+func (c *Cluster) PinWithResult(pin api.Pin) (api.PinResult, error) {
+	return c.pinWithResult("", pin)
+}
+
+// PinOverwrite works like PinWithResult but the options of an existing
+// pin are always overwritten with the given ones, regardless of the
+// pin_merge_policy. It allows lowering replication factors.
+func (c *Cluster) PinOverwrite(pin api.Pin) (api.PinResult, error) {
+	return c.pinWithPolicy("", pin, PinMergeOverwrite)
+}
+
+// pinWithResult performs PinWithResult on behalf of the given origin.
+func (c *Cluster) pinWithResult(origin api.Origin, pin api.Pin) (api.PinResult, error) {
+	return c.pinWithPolicy(origin, pin, c.config.PinMergePolicy)
+}
+
+// pinWithPolicy pins on behalf of the given origin, applying the given
+// merge policy when the Cid is already pinned.
+func (c *Cluster) pinWithPolicy(origin api.Origin, pin api.Pin, policy string) (api.PinResult, error) {
+	prev, exists := c.getCurrentPin(pin.Cid)
+	if exists && policy == PinMergeMerge {
+		pin = mergePins(prev, pin)
+	}
+	if origin != "" {
+		pin.Origin = origin
+	}
+
+	submitted, ok, err := c.pin(pin, []peer.ID{}, pin.Allocations, api.AllocationRebalance)
+	if err != nil {
+		return api.PinResult{}, err
+	}
+	if ok {
+		logger.Infof("pin for %s submitted (origin: %s)", pin.Cid, origin)
+		c.recordEvent(origin, api.EventPin, pin.Cid, "", pin.Name)
+	}
+
+	result := api.PinResult{
+		Action: api.PinActionPinned,
+		Pin:    submitted.ToSerial(),
+	}
+	if exists {
+		prevSerial := prev.ToSerial()
+		result.Previous = &prevSerial
+		switch {
+		case !ok:
+			result.Action = api.PinActionUnchanged
+		case policy == PinMergeMerge:
+			result.Action = api.PinActionMerged
+		default:
+			result.Action = api.PinActionOverwritten
+		}
+	}
+	return result, nil
+}
+
+// PinBatch pins many Cids at once, like Pin does with each of them. The
+// pins are submitted concurrently so that the consensus component can
+// commit them together. It returns an error when any of them failed.
+func (c *Cluster) PinBatch(pins []api.Pin) error {
+	return c.pinBatch("", pins)
+}
+
+// pinBatch performs PinBatch on behalf of the given origin.
+func (c *Cluster) pinBatch(origin api.Origin, pins []api.Pin) error {
+	errs := make([]error, len(pins), len(pins))
+	sem := make(chan struct{}, PinBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, pin := range pins {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, pin api.Pin) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_, errs[i] = c.pinWithResult(origin, pin)
+		}(i, pin)
+	}
+	wg.Wait()
+
+	failed := 0
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		logger.Errorf("error pinning %s in batch: %s", pins[i].Cid, err)
+		if firstErr == nil {
+			firstErr = err
+		}
+		failed++
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d pins failed: %s", failed, len(pins), firstErr)
+	}
+	return nil
+}
+
+// mergePins combines the options of an existing pin with those of a new
+// pin request for the same Cid. The highest replication factors win (-1
+// being the highest), a new name replaces the previous one and the
+// excluded peers are combined. New allowed peers replace the previous
+// ones and a high priority is kept. The pin is recursive when either of
+// them is, with the largest max depth. The latest expiration is kept, and
+// the pin never expires when either of them does not. New metadata
+// values are added to the previous ones.
+func mergePins(prev, pin api.Pin) api.Pin {
+	merged := pin
+
+	rplMin, rplMax := pin.ReplicationFactorMin, pin.ReplicationFactorMax
+	if rplMin == 0 {
+		rplMin = prev.ReplicationFactorMin
+	}
+	if rplMax == 0 {
+		rplMax = prev.ReplicationFactorMax
+	}
+	switch {
+	case rplMin == -1 || prev.ReplicationFactorMin == -1:
+		rplMin, rplMax = -1, -1
+	default:
+		if prev.ReplicationFactorMin > rplMin {
+			rplMin = prev.ReplicationFactorMin
+		}
+		if prev.ReplicationFactorMax > rplMax {
+			rplMax = prev.ReplicationFactorMax
+		}
+	}
+	merged.ReplicationFactorMin = rplMin
+	merged.ReplicationFactorMax = rplMax
+
+	if merged.Name == "" {
+		merged.Name = prev.Name
+	}
+	merged.Recursive = prev.Recursive || pin.Recursive
+	// a recursive pin without a max depth covers any other
+	switch {
+	case !prev.Recursive:
+		merged.MaxDepth = pin.MaxDepth
+	case !pin.Recursive:
+		merged.MaxDepth = prev.MaxDepth
+	case prev.MaxDepth == 0 || pin.MaxDepth == 0:
+		merged.MaxDepth = 0
+	case prev.MaxDepth > pin.MaxDepth:
+		merged.MaxDepth = prev.MaxDepth
+	default:
+		merged.MaxDepth = pin.MaxDepth
+	}
+
+	merged.ExcludePeers = append([]peer.ID{}, prev.ExcludePeers...)
+	for _, p := range pin.ExcludePeers {
+		if !containsPeer(merged.ExcludePeers, p) {
+			merged.ExcludePeers = append(merged.ExcludePeers, p)
+		}
+	}
+
+	if len(merged.AllowPeers) == 0 {
+		merged.AllowPeers = prev.AllowPeers
+	}
+
+	if prev.Priority == api.PinPriorityHigh {
+		merged.Priority = api.PinPriorityHigh
+	}
+
+	if prev.ExpireAt.IsZero() || prev.ExpireAt.After(pin.ExpireAt) && !pin.ExpireAt.IsZero() {
+		merged.ExpireAt = prev.ExpireAt
+	}
+
+	if len(prev.Metadata) > 0 {
+		merged.Metadata = make(map[string]string)
+		for k, v := range prev.Metadata {
+			merged.Metadata[k] = v
+		}
+		for k, v := range pin.Metadata {
+			merged.Metadata[k] = v
+		}
+	}
+	return merged
+}
+
 // pin performs the actual pinning and supports a blacklist to be
-// able to evacuate a node and returns whether the pin was submitted
-// to the consensus layer or skipped (due to error or to the fact
-// that it was already valid).
-func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID) (bool, error) {
+// able to evacuate a node. It returns the pin with its allocations and
+// whether it was submitted to the consensus layer or skipped (due to
+// error or to the fact that it was already valid). Allocation changes
+// of existing pins are recorded with the given reason.
+func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID, reason api.AllocationReason) (api.Pin, bool, error) {
 	if pin.Cid == nil {
-		return false, errors.New("bad pin object")
+		return pin, false, errors.New("bad pin object")
+	}
+	if c.pinsPaused() {
+		return pin, false, errPinsPaused
+	}
+
+	pin, err := c.allocatePin(pin, blacklist, prioritylist)
+	if err != nil {
+		return pin, false, err
+	}
+
+	curr, exists := c.getCurrentPin(pin.Cid)
+	// the timestamp tells when the Cid was first pinned
+	if exists && !curr.Timestamp.IsZero() {
+		pin.Timestamp = curr.Timestamp
+	} else if pin.Timestamp.IsZero() {
+		pin.Timestamp = time.Now()
+	}
+	if curr.Equals(pin) {
+		// skip pinning
+		logger.Debugf("pinning %s skipped: already correctly allocated", pin.Cid)
+		return pin, false, nil
+	}
+
+	if len(pin.Allocations) == 0 {
+		logger.Infof("IPFS cluster pinning %s everywhere:", pin.Cid)
+	} else {
+		logger.Infof("IPFS cluster pinning %s on %s:", pin.Cid, pin.Allocations)
 	}
+
+	err = c.consensus.LogPin(pin)
+	if err != nil {
+		return pin, true, err
+	}
+	c.recordAllocationChange(curr, exists, pin, reason)
+	return pin, true, nil
+}
+
+// allocatePin sets the default replication factors of the pin, when
+// unset, and its allocations, without committing it.
+func (c *Cluster) allocatePin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID) (api.Pin, error) {
 	rplMin := pin.ReplicationFactorMin
 	rplMax := pin.ReplicationFactorMax
 	if rplMin == 0 {
@@ -972,34 +1847,51 @@ func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID)
 		pin.ReplicationFactorMax = rplMax
 	}
 
-	if err := isReplicationFactorValid(rplMin, rplMax); err != nil {
-		return false, err
+	// Pin.Validate() can only check the replication factors when both
+	// are set. Check them again with the defaults so that a request
+	// like min=5/max=0 fails with a field error instead of a
+	// configuration one.
+	rpl := api.Pin{
+		Cid:                  pin.Cid,
+		ReplicationFactorMin: rplMin,
+		ReplicationFactorMax: rplMax,
+	}
+	if err := rpl.Validate(); err != nil {
+		return pin, err
 	}
 
 	switch {
 	case rplMin == -1 && rplMax == -1:
+		if len(pin.AllowPeers) > 0 {
+			return pin, errors.New("allowed peers cannot be used when pinning everywhere")
+		}
 		pin.Allocations = []peer.ID{}
 	default:
-		allocs, err := c.allocate(pin.Cid, rplMin, rplMax, blacklist, prioritylist)
+		blacklist = append(blacklist, pin.ExcludePeers...)
+		allocs, err := c.allocate(pin.Cid, rplMin, rplMax, blacklist, pin.AllowPeers, prioritylist)
 		if err != nil {
-			return false, err
+			return pin, err
 		}
 		pin.Allocations = allocs
 	}
 
-	if curr, _ := c.getCurrentPin(pin.Cid); curr.Equals(pin) {
-		// skip pinning
-		logger.Debugf("pinning %s skipped: already correctly allocated", pin.Cid)
-		return false, nil
-	}
+	return pin, nil
+}
 
-	if len(pin.Allocations) == 0 {
-		logger.Infof("IPFS cluster pinning %s everywhere:", pin.Cid)
-	} else {
-		logger.Infof("IPFS cluster pinning %s on %s:", pin.Cid, pin.Allocations)
+// AllocationPreview returns the given pin with the allocations that
+// pinning it would have, according to the current metrics, without
+// pinning it. The pin_merge_policy is applied when the Cid is already
+// pinned. Empty allocations mean that the Cid would be pinned everywhere.
+func (c *Cluster) AllocationPreview(pin api.Pin) (api.Pin, error) {
+	if pin.Cid == nil {
+		return pin, errors.New("bad pin object")
 	}
 
-	return true, c.consensus.LogPin(pin)
+	prev, exists := c.getCurrentPin(pin.Cid)
+	if exists && c.config.PinMergePolicy == PinMergeMerge {
+		pin = mergePins(prev, pin)
+	}
+	return c.allocatePin(pin, []peer.ID{}, pin.Allocations)
 }
 
 // Unpin makes the cluster Unpin a Cid. This implies adding the Cid
@@ -1009,7 +1901,31 @@ func (c *Cluster) pin(pin api.Pin, blacklist []peer.ID, prioritylist []peer.ID)
 // to the global state. Unpin does not reflect the success or failure
 // of underlying IPFS daemon unpinning operations.
 func (c *Cluster) Unpin(h *cid.Cid) error {
-	logger.Info("IPFS cluster unpinning:", h)
+	return c.unpin("", h)
+}
+
+// unpin performs Unpin on behalf of the given origin.
+func (c *Cluster) unpin(origin api.Origin, h *cid.Cid) error {
+	if c.pinsPaused() {
+		return errPinsPaused
+	}
+	logger.Infof("IPFS cluster unpinning: %s (origin: %s)", h, origin)
+
+	curr, exists := c.getCurrentPin(h)
+	if exists && curr.Type == api.ShardType && curr.Reference != nil {
+		return fmt.Errorf("%s is part of the sharded DAG %s: unpin the latter instead", h, curr.Reference)
+	}
+	if exists && curr.Type == api.MetaType {
+		// unpin the shards first, so that they can still be
+		// found if this fails
+		shards, err := c.shardsOf(h)
+		if err != nil {
+			return err
+		}
+		if err := c.unpinShards(origin, shards); err != nil {
+			return err
+		}
+	}
 
 	pin := api.Pin{
 		Cid: h,
@@ -1019,9 +1935,379 @@ func (c *Cluster) Unpin(h *cid.Cid) error {
 	if err != nil {
 		return err
 	}
+	if !exists {
+		curr = pin
+	}
+	c.recordPinEvent(origin, api.EventUnpin, curr, "", "")
 	return nil
 }
 
+// MetricsSince returns the history of the metrics of the given name
+// received from a peer after the given time, as known by the
+// leading peer monitor.
+func (c *Cluster) MetricsSince(name string, p peer.ID, since time.Time) ([]api.Metric, error) {
+	leader, err := c.consensus.Leader()
+	if err != nil {
+		return nil, errors.New("cannot determine leading Monitor")
+	}
+
+	var metrics []api.Metric
+	err = c.rpcClient.Call(leader,
+		"Cluster", "PeerMonitorMetricsSince",
+		api.MetricsQuery{
+			Name:  name,
+			Peer:  p,
+			Since: since,
+		},
+		&metrics)
+	return metrics, err
+}
+
+// LastMetrics returns the latest valid metrics of the given name for
+// the current cluster peers, as known by the leading peer monitor. These
+// are the metrics used to make allocations.
+func (c *Cluster) LastMetrics(name string) ([]api.Metric, error) {
+	leader, err := c.consensus.Leader()
+	if err != nil {
+		return nil, errors.New("cannot determine leading Monitor")
+	}
+
+	var metrics []api.Metric
+	err = c.rpcClient.Call(leader,
+		"Cluster", "PeerMonitorLastMetrics",
+		name,
+		&metrics)
+	return metrics, err
+}
+
+// PeerMetrics returns the latest valid metrics of every type received
+// from the given peer, as known by the leading peer monitor.
+func (c *Cluster) PeerMetrics(p peer.ID) ([]api.Metric, error) {
+	leader, err := c.consensus.Leader()
+	if err != nil {
+		return nil, errors.New("cannot determine leading Monitor")
+	}
+
+	var metrics []api.Metric
+	err = c.rpcClient.Call(leader,
+		"Cluster", "PeerMonitorPeerMetrics",
+		p,
+		&metrics)
+	return metrics, err
+}
+
+// FailPeer makes the leading peer monitor consider the given peer as
+// failed during the given time, which triggers the alerts and the
+// re-pinning of its content. It is used to rehearse failure handling
+// and requires EnableDebugRPC.
+func (c *Cluster) FailPeer(p peer.ID, d time.Duration) error {
+	if !c.config.EnableDebugRPC {
+		return errors.New("debug operations are disabled (enable_debug_rpc)")
+	}
+
+	leader, err := c.consensus.Leader()
+	if err != nil {
+		return errors.New("cannot determine leading Monitor")
+	}
+
+	return c.rpcClient.Call(leader,
+		"Cluster", "PeerMonitorFailPeer",
+		api.FailPeerRequest{
+			Peer:     p,
+			Duration: d,
+		},
+		&struct{}{})
+}
+
+// Unquarantine makes the peer monitors of all the cluster peers accept
+// again the metrics from a peer which was quarantined for sending
+// persistently invalid metrics. Unreachable peers are skipped.
+func (c *Cluster) Unquarantine(p peer.ID) error {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		return err
+	}
+
+	errs := c.multiRPC(members,
+		"Cluster",
+		"PeerMonitorUnquarantine",
+		p,
+		copyEmptyStructToIfaces(make([]struct{}, len(members), len(members))))
+	for i, err := range errs {
+		if err != nil {
+			logger.Errorf("%s: error releasing %s in %s: %s", c.id, p.Pretty(), members[i].Pretty(), err)
+		}
+	}
+	return nil
+}
+
+// Observations returns a set of values describing the current status of
+// this peer: the last metrics known for every peer, the number of items
+// in every tracker status and consensus information.
+func (c *Cluster) Observations() []api.Observation {
+	var obs []api.Observation
+
+	isLeader := 0.0
+	leader, leaderErr := c.consensus.Leader()
+	if leaderErr == nil && leader == c.id {
+		isLeader = 1
+	}
+	obs = append(obs, api.Observation{
+		Name:  "ipfscluster_consensus_leader",
+		Help:  "Whether this peer is the consensus leader",
+		Value: isLeader,
+	})
+
+	peers, err := c.consensus.Peers()
+	if err == nil {
+		obs = append(obs, api.Observation{
+			Name:  "ipfscluster_peers",
+			Help:  "Number of peers in the cluster",
+			Value: float64(len(peers)),
+		})
+	}
+
+	if cState, err := c.consensus.State(); err == nil {
+		obs = append(obs, api.Observation{
+			Name:  "ipfscluster_pins",
+			Help:  "Number of items in the shared state",
+			Value: float64(len(cState.List())),
+		})
+	}
+
+	if health, err := c.RaftHealth(); err == nil {
+		obs = append(obs, raftObservations(health)...)
+	}
+
+	if queue, err := c.PinQueue(); err == nil {
+		obs = append(obs, pinQueueObservations(queue)...)
+	}
+
+	obs = append(obs, c.broadcastObservations()...)
+	obs = append(obs, c.rpcLatencies.observations()...)
+
+	statusCount := make(map[api.TrackerStatus]int)
+	for _, pinfo := range c.tracker.StatusAll() {
+		statusCount[pinfo.Status]++
+	}
+	for st, n := range statusCount {
+		obs = append(obs, api.Observation{
+			Name:   "ipfscluster_tracker_items",
+			Help:   "Number of items tracked by this peer by status",
+			Labels: map[string]string{"status": st.String()},
+			Value:  float64(n),
+		})
+	}
+
+	if leaderErr == nil {
+		for _, name := range c.producedMetrics() {
+			var metrics []api.Metric
+			err := c.rpcClient.Call(leader,
+				"Cluster", "PeerMonitorLastMetrics",
+				name,
+				&metrics)
+			if err != nil {
+				logger.Warning(err)
+				continue
+			}
+			for _, m := range metrics {
+				labels := map[string]string{
+					"name":     m.Name,
+					"peer":     m.Peer.Pretty(),
+					"peername": m.Peername,
+				}
+				obs = append(obs, api.Observation{
+					Name:   "ipfscluster_peer_metric_ttl_seconds",
+					Help:   "Time before the last metric sent by a peer expires",
+					Labels: labels,
+					Value:  m.GetTTL().Seconds(),
+				})
+				if v, err := strconv.ParseFloat(m.Value, 64); err == nil {
+					obs = append(obs, api.Observation{
+						Name:   "ipfscluster_peer_metric",
+						Help:   "Value of the last metric sent by a peer",
+						Labels: labels,
+						Value:  v,
+					})
+				}
+				if m.Name == "ping" {
+					obs = append(obs, healthObservations(m)...)
+				}
+			}
+		}
+	}
+	return obs
+}
+
+// healthObservations extracts the PeerHealth carried in a ping metric.
+func healthObservations(m api.Metric) []api.Observation {
+	ph, err := api.PeerHealthFromString(m.Value)
+	if err != nil {
+		return nil
+	}
+	labels := map[string]string{
+		"peer":     m.Peer.Pretty(),
+		"peername": m.Peername,
+	}
+	boolToFloat := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	obs := []api.Observation{
+		{
+			Name:   "ipfscluster_peer_ipfs_reachable",
+			Help:   "Whether the IPFS daemon of a peer is reachable",
+			Labels: labels,
+			Value:  boolToFloat(ph.IPFS),
+		},
+		{
+			Name:   "ipfscluster_peer_state_ok",
+			Help:   "Whether a peer can read the shared state",
+			Labels: labels,
+			Value:  boolToFloat(ph.State),
+		},
+		{
+			Name:   "ipfscluster_peer_queued_items",
+			Help:   "Number of items queued for pinning or unpinning in a peer",
+			Labels: labels,
+			Value:  float64(ph.Queued),
+		},
+		{
+			Name:   "ipfscluster_peer_error_items",
+			Help:   "Number of items in error state in a peer",
+			Labels: labels,
+			Value:  float64(ph.Errors),
+		},
+	}
+	if skew, ok := clockSkew(m); ok {
+		obs = append(obs, api.Observation{
+			Name:   "ipfscluster_peer_clock_skew_seconds",
+			Help:   "Estimated clock offset of a peer relative to the leader",
+			Labels: labels,
+			Value:  skew.Seconds(),
+		})
+	}
+	return obs
+}
+
+// raftObservations extracts the figures describing the health of Raft.
+func raftObservations(health api.RaftHealth) []api.Observation {
+	obs := []api.Observation{
+		{
+			Name:  "ipfscluster_raft_term",
+			Help:  "Current Raft term",
+			Value: float64(health.Term),
+		},
+		{
+			Name:  "ipfscluster_raft_applied_index",
+			Help:  "Index of the last Raft log entry applied to the state",
+			Value: float64(health.AppliedIndex),
+		},
+		{
+			Name:  "ipfscluster_raft_commit_index",
+			Help:  "Index of the last committed Raft log entry",
+			Value: float64(health.CommitIndex),
+		},
+		{
+			Name:  "ipfscluster_raft_log_entries",
+			Help:  "Number of Raft log entries not included in the last snapshot",
+			Value: float64(health.LogEntries),
+		},
+		{
+			Name:  "ipfscluster_raft_leader_changes_total",
+			Help:  "Number of Raft leadership changes seen by this peer",
+			Value: float64(health.LeaderChanges),
+		},
+	}
+	if !health.LastSnapshot.IsZero() {
+		obs = append(obs, api.Observation{
+			Name:  "ipfscluster_raft_snapshot_age_seconds",
+			Help:  "Time since the last Raft snapshot was taken",
+			Value: time.Since(health.LastSnapshot).Seconds(),
+		})
+	}
+	if latency, err := time.ParseDuration(health.CommitLatency); err == nil {
+		obs = append(obs, api.Observation{
+			Name:  "ipfscluster_raft_commit_latency_seconds",
+			Help:  "Moving average of the time taken to commit an update",
+			Value: latency.Seconds(),
+		})
+	}
+	return obs
+}
+
+// broadcastObservations describes the usage of the broadcast slots.
+func (c *Cluster) broadcastObservations() []api.Observation {
+	return []api.Observation{
+		{
+			Name:  "ipfscluster_broadcast_in_flight",
+			Help:  "Number of requests to other peers in flight in broadcasts",
+			Value: float64(len(c.broadcastSem)),
+		},
+		{
+			Name:  "ipfscluster_broadcast_concurrency",
+			Help:  "Maximum number of requests in flight in broadcasts",
+			Value: float64(cap(c.broadcastSem)),
+		},
+		{
+			Name:  "ipfscluster_broadcast_waits_total",
+			Help:  "Number of broadcast requests which waited for others to finish",
+			Value: float64(atomic.LoadUint64(&c.broadcastWaits)),
+		},
+	}
+}
+
+// pinQueueObservations extracts the figures describing the pin queue.
+func pinQueueObservations(queue api.PinQueue) []api.Observation {
+	return []api.Observation{
+		{
+			Name:   "ipfscluster_pin_queue_items",
+			Help:   "Number of operations waiting in the pin queue by type",
+			Labels: map[string]string{"type": "pin"},
+			Value:  float64(queue.PinQueued),
+		},
+		{
+			Name:   "ipfscluster_pin_queue_items",
+			Help:   "Number of operations waiting in the pin queue by type",
+			Labels: map[string]string{"type": "unpin"},
+			Value:  float64(queue.UnpinQueued),
+		},
+		{
+			Name:  "ipfscluster_pin_queue_in_progress",
+			Help:  "Number of pin and unpin operations in progress",
+			Value: float64(queue.InProgress),
+		},
+		{
+			Name:  "ipfscluster_pins_done_total",
+			Help:  "Number of pins completed by this peer since it started",
+			Value: float64(queue.PinsDone),
+		},
+		{
+			Name:  "ipfscluster_pins_failed_total",
+			Help:  "Number of pins which failed in this peer since it started",
+			Value: float64(queue.PinsFailed),
+		},
+		{
+			Name:  "ipfscluster_pin_rate",
+			Help:  "Pins completed per second over the last minute",
+			Value: queue.PinRate,
+		},
+		{
+			Name:  "ipfscluster_unpins_pending_gc",
+			Help:  "Unpins done since the IPFS repository was last garbage collected",
+			Value: float64(queue.PendingGC),
+		},
+	}
+}
+
+// Events returns the events recorded by this peer which happened
+// after the given time.
+func (c *Cluster) Events(since time.Time) []api.Event {
+	return c.events.Since(since)
+}
+
 // Version returns the current IPFS Cluster version.
 func (c *Cluster) Version() string {
 	return Version
@@ -1049,13 +2335,19 @@ func (c *Cluster) Peers() []api.ID {
 		}
 	}
 
+	annotations := c.peerAnnotations()
 	for i, ps := range peersSerial {
 		peers[i] = ps.ToID()
+		// use our copy of the state so that annotations are
+		// shown for the peers which did not answer too
+		peers[i].Annotation = annotations[members[i]]
 	}
 	return peers
 }
 
-// Perform an RPC request to multiple destinations
+// Perform an RPC request to multiple destinations. At most
+// BroadcastConcurrency requests are in flight at the same time across
+// all the broadcasts of this peer.
 func (c *Cluster) multiRPC(dests []peer.ID, svcName, svcMethod string, args interface{}, reply []interface{}) []error {
 	if len(dests) != len(reply) {
 		panic("must have matching dests and replies")
@@ -1064,15 +2356,19 @@ func (c *Cluster) multiRPC(dests []peer.ID, svcName, svcMethod string, args inte
 	errs := make([]error, len(dests), len(dests))
 
 	for i := range dests {
+		c.acquireBroadcastSlot()
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
+			defer c.releaseBroadcastSlot()
+			start := time.Now()
 			err := c.rpcClient.Call(
 				dests[i],
 				svcName,
 				svcMethod,
 				args,
 				reply[i])
+			c.rpcLatencies.record(svcName+"."+svcMethod, time.Since(start), err)
 			errs[i] = err
 		}(i)
 	}
@@ -1081,6 +2377,24 @@ func (c *Cluster) multiRPC(dests []peer.ID, svcName, svcMethod string, args inte
 
 }
 
+// acquireBroadcastSlot blocks until less than BroadcastConcurrency
+// broadcast requests are in flight. Waits are counted to report the
+// saturation of the broadcasts.
+func (c *Cluster) acquireBroadcastSlot() {
+	select {
+	case c.broadcastSem <- struct{}{}:
+		return
+	default:
+	}
+	atomic.AddUint64(&c.broadcastWaits, 1)
+	c.broadcastSem <- struct{}{}
+}
+
+// releaseBroadcastSlot frees a slot taken with acquireBroadcastSlot.
+func (c *Cluster) releaseBroadcastSlot() {
+	<-c.broadcastSem
+}
+
 func (c *Cluster) globalPinInfoCid(method string, h *cid.Cid) (api.GlobalPinInfo, error) {
 	pin := api.GlobalPinInfo{
 		Cid:     h,
@@ -1136,10 +2450,21 @@ func (c *Cluster) globalPinInfoCid(method string, h *cid.Cid) (api.GlobalPinInfo
 		}
 	}
 
+	names := c.peerNames()
+	for p, pinfo := range pin.PeerMap {
+		pinfo.Peername = names[p]
+		pin.PeerMap[p] = pinfo
+	}
+
+	if current, ok := c.getCurrentPin(h); ok {
+		pin.Name = current.Name
+		pin.Metadata = current.Metadata
+	}
+
 	return pin, nil
 }
 
-func (c *Cluster) globalPinInfoSlice(method string) ([]api.GlobalPinInfo, error) {
+func (c *Cluster) globalPinInfoSlice(method string, arg interface{}) ([]api.GlobalPinInfo, error) {
 	var infos []api.GlobalPinInfo
 	fullMap := make(map[string]api.GlobalPinInfo)
 
@@ -1152,7 +2477,7 @@ func (c *Cluster) globalPinInfoSlice(method string) ([]api.GlobalPinInfo, error)
 	replies := make([][]api.PinInfoSerial, len(members), len(members))
 	errs := c.multiRPC(members,
 		"Cluster",
-		method, struct{}{},
+		method, arg,
 		copyPinInfoSerialSliceToIfaces(replies))
 
 	mergePins := func(pins []api.PinInfoSerial) {
@@ -1196,13 +2521,73 @@ func (c *Cluster) globalPinInfoSlice(method string) ([]api.GlobalPinInfo, error)
 		}
 	}
 
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Warning(err)
+	}
+
+	names := c.peerNames()
 	for _, v := range fullMap {
+		for p, pinfo := range v.PeerMap {
+			pinfo.Peername = names[p]
+			v.PeerMap[p] = pinfo
+		}
+		if cState != nil && v.Cid != nil && cState.Has(v.Cid) {
+			pin := cState.Get(v.Cid)
+			v.Name = pin.Name
+			v.Metadata = pin.Metadata
+		}
 		infos = append(infos, v)
 	}
 
 	return infos, nil
 }
 
+// peerNames returns the names of the cluster peers, as announced
+// in the last ping metrics received by the leading peer monitor.
+func (c *Cluster) peerNames() map[peer.ID]string {
+	names := map[peer.ID]string{
+		c.id: c.config.Peername,
+	}
+
+	leader, err := c.consensus.Leader()
+	if err != nil {
+		return names
+	}
+
+	var metrics []api.Metric
+	err = c.rpcClient.Call(leader,
+		"Cluster", "PeerMonitorLastMetrics",
+		"ping",
+		&metrics)
+	if err != nil {
+		logger.Debugf("cannot fetch peer names: %s", err)
+		return names
+	}
+
+	for _, m := range metrics {
+		if m.Peername != "" {
+			names[m.Peer] = m.Peername
+		}
+	}
+	return names
+}
+
+// addConsensusPeer adds a peer to the consensus, as a non-voter when its
+// role is RoleFollower and the consensus supports it.
+func (c *Cluster) addConsensusPeer(pid peer.ID) error {
+	nonVoterCon, ok := c.consensus.(NonVoterConsensus)
+	if !ok {
+		return c.consensus.AddPeer(pid)
+	}
+
+	id, err := c.getIDForPeer(pid)
+	if err != nil || id.Role != RoleFollower {
+		return c.consensus.AddPeer(pid)
+	}
+	return nonVoterCon.AddNonVoter(pid)
+}
+
 func (c *Cluster) getIDForPeer(pid peer.ID) (api.ID, error) {
 	idSerial := api.ID{ID: pid}.ToSerial()
 	err := c.rpcClient.Call(
@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/config"
 
 	crypto "github.com/libp2p/go-libp2p-crypto"
@@ -23,17 +25,95 @@ const configKey = "cluster"
 
 // Configuration defaults
 const (
-	DefaultConfigCrypto        = crypto.RSA
-	DefaultConfigKeyLength     = 2048
-	DefaultListenAddr          = "/ip4/0.0.0.0/tcp/9096"
-	DefaultStateSyncInterval   = 60 * time.Second
-	DefaultIPFSSyncInterval    = 130 * time.Second
-	DefaultMonitorPingInterval = 15 * time.Second
-	DefaultPeerWatchInterval   = 5 * time.Second
-	DefaultReplicationFactor   = -1
-	DefaultLeaveOnShutdown     = false
-	DefaultDisableRepinning    = false
-	DefaultPeerstoreFile       = "peerstore"
+	DefaultConfigCrypto            = crypto.RSA
+	DefaultConfigKeyLength         = 2048
+	DefaultListenAddr              = "/ip4/0.0.0.0/tcp/9096"
+	DefaultListenAddrIPv6          = "/ip6/::/tcp/9096"
+	DefaultStateSyncInterval       = 60 * time.Second
+	DefaultIPFSSyncInterval        = 130 * time.Second
+	DefaultMonitorPingInterval     = 15 * time.Second
+	DefaultPeerWatchInterval       = 5 * time.Second
+	DefaultReplicationFactor       = -1
+	DefaultLeaveOnShutdown         = false
+	DefaultDisableRepinning        = false
+	DefaultRepinConcurrency        = 4
+	DefaultBroadcastConcurrency    = 20
+	DefaultPeerstoreFile           = "peerstore"
+	DefaultEventsFile              = "events.db"
+	DefaultEventsRetention         = 24 * time.Hour
+	DefaultDrainTimeout            = time.Hour
+	DefaultAllocationHistoryFile   = "allocation_history.db"
+	DefaultAllocationHistorySize   = 10
+	DefaultTemporaryPinsFile       = "temporary_pins.db"
+	DefaultPinMergePolicy          = PinMergeOverwrite
+	DefaultRPCCompressionThreshold = 1024
+	DefaultEnableDebugRPC          = false
+	DefaultRole                    = RoleStorage
+	DefaultConsensus               = ConsensusRaft
+	DefaultPinTracker              = PinTrackerMap
+	DefaultUnderReplicationPolicy  = UnderReplicationReject
+	DefaultPopularityCooldown      = 10 * time.Minute
+)
+
+// Values for the Consensus option.
+const (
+	// ConsensusRaft uses the Raft consensus component: a leader
+	// orders all updates and a majority of peers must be online.
+	ConsensusRaft = "raft"
+	// ConsensusCRDT uses the CRDT consensus component: peers apply
+	// updates independently and converge eventually, so the peerset
+	// can grow large and peers can come and go.
+	ConsensusCRDT = "crdt"
+)
+
+// Values for the PinTracker option.
+const (
+	// PinTrackerMap uses the map-based pin tracker, which keeps the
+	// status of every pin in memory.
+	PinTrackerMap = "map"
+	// PinTrackerStateless uses the stateless pin tracker, which obtains
+	// the status of the pins from the shared state and the IPFS daemon
+	// when requested, so that it scales to very large pinsets.
+	PinTrackerStateless = "stateless"
+)
+
+// Values for the Role option.
+const (
+	// RoleStorage peers run all the components: they pin content,
+	// receive allocations, serve the APIs and vote in the consensus.
+	RoleStorage = "storage"
+	// RoleGateway peers serve the APIs and vote in the consensus, but
+	// do not pin content nor receive allocations.
+	RoleGateway = "gateway"
+	// RoleArbiter peers only vote in the consensus: they do not pin
+	// content, receive allocations or serve the REST API.
+	RoleArbiter = "arbiter"
+	// RoleFollower peers are storage peers which follow the consensus
+	// without voting, so they never become the leader.
+	RoleFollower = "follower"
+)
+
+// Values for the PinMergePolicy option.
+const (
+	// PinMergeOverwrite replaces the options of an existing pin
+	// with the ones from the new request.
+	PinMergeOverwrite = "overwrite"
+	// PinMergeMerge combines the options of an existing pin with
+	// the ones from the new request: the highest replication factors
+	// are kept, the name is updated when a new one is given and the
+	// excluded peers are added up.
+	PinMergeMerge = "merge"
+)
+
+// Values for the UnderReplicationPolicy option.
+const (
+	// UnderReplicationReject makes pinning fail when there are not
+	// enough peers to satisfy the ReplicationFactorMin of a pin.
+	UnderReplicationReject = "reject"
+	// UnderReplicationAccept allocates under-replicated pins to the
+	// peers which are available, as long as there is at least one, and
+	// adds allocations to them once more peers are available.
+	UnderReplicationAccept = "accept"
 )
 
 // Config is the configuration object containing customizable variables to
@@ -57,6 +137,13 @@ type Config struct {
 	// 64 characters and contain only hexadecimal characters (`[0-9a-f]`).
 	Secret []byte
 
+	// Namespace is included in the libp2p protocol IDs used by the
+	// peers, so that several clusters can share the same libp2p network
+	// without talking to each other. When empty, the protocol IDs are
+	// not namespaced, which keeps the peers compatible with previous
+	// versions.
+	Namespace string
+
 	// Leave Cluster on shutdown. Politely informs other peers
 	// of the departure and removes itself from the consensus
 	// peer set. The Cluster size will be reduced by one.
@@ -115,32 +202,228 @@ type Config struct {
 	// when not wanting to rely on the monitoring system which needs a revamp.
 	DisableRepinning bool
 
+	// RepinDelay is the grace period given to a peer which stops
+	// responding before the pins allocated to it are re-allocated to
+	// other peers. The re-allocation is cancelled if the peer comes
+	// back before. 0 re-allocates them right away. Pins allocated to
+	// removed peers are always re-allocated right away.
+	RepinDelay time.Duration
+
+	// RepinConcurrency is the maximum number of pins which are
+	// re-allocated at the same time.
+	RepinConcurrency int
+
+	// BroadcastConcurrency is the maximum number of requests sent at
+	// the same time when contacting all the peers (i.e. for global
+	// status, sync or metric broadcasts).
+	BroadcastConcurrency int
+
 	// Peerstore file specifies the file on which we persist the
 	// libp2p host peerstore addresses. This file is regularly saved.
 	PeerstoreFile string
+
+	// EventsFile specifies the datastore in which we persist the events
+	// happening in this peer (pins, unpins, peerset changes, alerts).
+	EventsFile string
+
+	// EventsRetention specifies for how long events are kept. Older
+	// events are dropped. 0 keeps events forever.
+	EventsRetention time.Duration
+
+	// DrainTimeout is how long draining a peer waits for its pins to
+	// be pinned by their new allocations before giving up. The peer is
+	// not removed then.
+	DrainTimeout time.Duration
+
+	// AllocationHistoryFile specifies the BoltDB datastore in which we
+	// persist the allocation changes made by this peer.
+	AllocationHistoryFile string
+
+	// AllocationHistorySize is the number of allocation changes
+	// remembered for every pin.
+	AllocationHistorySize int
+
+	// TemporaryPinsFile specifies the BoltDB datastore in which we
+	// persist the items added through this peer which are pinned by
+	// its IPFS daemon until their allocations pin them.
+	TemporaryPinsFile string
+
+	// CordonedPeers are never chosen as candidates for new allocations,
+	// although they keep the content already allocated to them.
+	CordonedPeers []peer.ID
+
+	// AllocationMetricMaxAge excludes from new allocations those
+	// peers whose last informer metric was received longer ago than
+	// this value. 0 disables this check.
+	AllocationMetricMaxAge time.Duration
+
+	// AllocationTags excludes from new allocations those peers whose
+	// tags (see the tags informer) do not include all of these.
+	AllocationTags map[string]string
+
+	// AllocationMetric is the name of the metric used to make
+	// allocations. When empty, the metric produced by the configured
+	// informer is used. It can name a metric pushed by an external
+	// producer (see Cluster.PushMetric).
+	AllocationMetric string
+
+	// PinMergePolicy decides what happens when a Cid which is already
+	// pinned is pinned again with different options. It is either
+	// "overwrite" or "merge".
+	PinMergePolicy string
+
+	// UnderReplicationPolicy decides what happens when there are fewer
+	// peers available than the ReplicationFactorMin of a pin. It is
+	// either "reject" or "accept".
+	UnderReplicationPolicy string
+
+	// DisableRPCCompression disables the negotiation of compressed
+	// RPC streams with other peers.
+	DisableRPCCompression bool
+
+	// RPCCompressionThreshold is the size in bytes above which the
+	// RPC payloads sent through compressed streams are compressed.
+	RPCCompressionThreshold int
+
+	// When both are set, the StateSyncInterval becomes adaptive: it is
+	// shortened down to StateSyncIntervalMin when a sync finds
+	// discrepancies or errors and lengthened up to StateSyncIntervalMax
+	// while syncs find nothing to do.
+	StateSyncIntervalMin time.Duration
+	StateSyncIntervalMax time.Duration
+
+	// IPFSSyncIntervalMin and IPFSSyncIntervalMax make the
+	// IPFSSyncInterval adaptive in the same way.
+	IPFSSyncIntervalMin time.Duration
+	IPFSSyncIntervalMax time.Duration
+
+	// EnableDebugRPC enables the debug operations, like simulating the
+	// failure of a peer. They are meant to rehearse failure handling
+	// and should not be enabled in production.
+	EnableDebugRPC bool
+
+	// TrackedPinsMaxDeviation enables alerts when the number of pins
+	// reported by a peer's "trackedpins" metric differs from the number
+	// of pins allocated to it in the shared state by more than this
+	// fraction of the latter (i.e. 0.5 for 50%). 0 disables these alerts.
+	TrackedPinsMaxDeviation float64
+
+	// PinQueueMaxLength enables alerts when a peer's "pinqueue" metric
+	// reports more queued or ongoing pin and unpin operations than
+	// this. 0 disables these alerts.
+	PinQueueMaxLength int
+
+	// MaxClockSkew enables alerts when the clock of a peer is estimated
+	// to differ from the clock of the leader by more than this. Clock
+	// skew breaks the expiry of metrics. 0 disables these alerts.
+	MaxClockSkew time.Duration
+
+	// LocalRPCSocket is the path of a unix socket on which the internal
+	// RPC API is served to local tools. Relative paths are relative to
+	// BaseDir. Empty disables it.
+	LocalRPCSocket string
+
+	// LocalRPCToken must be provided by the clients of the
+	// LocalRPCSocket. When empty, a random token is generated on every
+	// start and written next to the socket, with a ".token" extension.
+	LocalRPCToken string
+
+	// Role decides which components this peer runs (see the Role*
+	// values). Defaults to RoleStorage.
+	Role string
+
+	// Consensus selects the consensus component used by the peer (see
+	// the Consensus* values). All peers in a cluster must use the same
+	// one. Defaults to ConsensusRaft.
+	Consensus string
+
+	// PinTracker selects the pin tracker component used by the peer
+	// (see the PinTracker* values). Defaults to PinTrackerMap.
+	PinTracker string
+
+	// PopularityHotThreshold enables boosting the replication of
+	// popular content. Pins retrieved more times than this through the
+	// IPFS proxies of all peers, as reported by the last "popularity"
+	// metrics, get their replication factors raised up to
+	// PopularityReplicationFactorMax. They are restored once they have
+	// been retrieved PopularityColdThreshold times or less for
+	// PopularityCooldown. 0 disables it.
+	PopularityHotThreshold         int
+	PopularityColdThreshold        int
+	PopularityReplicationFactorMax int
+	PopularityCooldown             time.Duration
+
+	// AutoRecoverInterval enables the periodic recovery of the pins in
+	// PIN_ERROR or UNPIN_ERROR status on this peer, as done by
+	// "recover", so that transient failures heal by themselves. Every
+	// run is delayed by a random fraction of the interval. 0 disables
+	// it.
+	AutoRecoverInterval time.Duration
+
+	// AutoRecoverMaxPins limits the number of pins recovered on every
+	// run. 0 means no limit.
+	AutoRecoverMaxPins int
 }
 
 // configJSON represents a Cluster configuration as it will look when it is
 // saved using JSON. Most configuration keys are converted into simple types
 // like strings, and key names aim to be self-explanatory for the user.
 type configJSON struct {
-	ID                   string   `json:"id"`
-	Peername             string   `json:"peername"`
-	PrivateKey           string   `json:"private_key"`
-	Secret               string   `json:"secret"`
-	Peers                []string `json:"peers,omitempty"`     // DEPRECATED
-	Bootstrap            []string `json:"bootstrap,omitempty"` // DEPRECATED
-	LeaveOnShutdown      bool     `json:"leave_on_shutdown"`
-	ListenMultiaddress   string   `json:"listen_multiaddress"`
-	StateSyncInterval    string   `json:"state_sync_interval"`
-	IPFSSyncInterval     string   `json:"ipfs_sync_interval"`
-	ReplicationFactor    int      `json:"replication_factor,omitempty"` // legacy
-	ReplicationFactorMin int      `json:"replication_factor_min"`
-	ReplicationFactorMax int      `json:"replication_factor_max"`
-	MonitorPingInterval  string   `json:"monitor_ping_interval"`
-	PeerWatchInterval    string   `json:"peer_watch_interval"`
-	DisableRepinning     bool     `json:"disable_repinning"`
-	PeerstoreFile        string   `json:"peerstore_file,omitempty"`
+	ID                      string            `json:"id"`
+	Peername                string            `json:"peername"`
+	PrivateKey              string            `json:"private_key"`
+	Secret                  string            `json:"secret"`
+	Namespace               string            `json:"namespace,omitempty"`
+	Peers                   []string          `json:"peers,omitempty"`     // DEPRECATED
+	Bootstrap               []string          `json:"bootstrap,omitempty"` // DEPRECATED
+	LeaveOnShutdown         bool              `json:"leave_on_shutdown"`
+	ListenMultiaddress      string            `json:"listen_multiaddress"`
+	StateSyncInterval       string            `json:"state_sync_interval"`
+	IPFSSyncInterval        string            `json:"ipfs_sync_interval"`
+	ReplicationFactor       int               `json:"replication_factor,omitempty"` // legacy
+	ReplicationFactorMin    int               `json:"replication_factor_min"`
+	ReplicationFactorMax    int               `json:"replication_factor_max"`
+	MonitorPingInterval     string            `json:"monitor_ping_interval"`
+	PeerWatchInterval       string            `json:"peer_watch_interval"`
+	DisableRepinning        bool              `json:"disable_repinning"`
+	RepinDelay              string            `json:"repin_delay,omitempty"`
+	RepinConcurrency        int               `json:"repin_concurrency"`
+	BroadcastConcurrency    int               `json:"broadcast_concurrency"`
+	PeerstoreFile           string            `json:"peerstore_file,omitempty"`
+	EventsFile              string            `json:"events_file,omitempty"`
+	EventsRetention         string            `json:"events_retention"`
+	DrainTimeout            string            `json:"drain_timeout"`
+	AllocationHistoryFile   string            `json:"allocation_history_file,omitempty"`
+	AllocationHistorySize   int               `json:"allocation_history_size"`
+	TemporaryPinsFile       string            `json:"temporary_pins_file,omitempty"`
+	CordonedPeers           []string          `json:"cordoned_peers,omitempty"`
+	AllocationMetricMaxAge  string            `json:"allocation_metric_max_age,omitempty"`
+	AllocationTags          map[string]string `json:"allocation_tags,omitempty"`
+	AllocationMetric        string            `json:"allocation_metric,omitempty"`
+	PinMergePolicy          string            `json:"pin_merge_policy"`
+	UnderReplicationPolicy  string            `json:"under_replication_policy,omitempty"`
+	DisableRPCCompression   bool              `json:"disable_rpc_compression"`
+	RPCCompressionThreshold int               `json:"rpc_compression_threshold"`
+	StateSyncIntervalMin    string            `json:"state_sync_interval_min,omitempty"`
+	StateSyncIntervalMax    string            `json:"state_sync_interval_max,omitempty"`
+	IPFSSyncIntervalMin     string            `json:"ipfs_sync_interval_min,omitempty"`
+	IPFSSyncIntervalMax     string            `json:"ipfs_sync_interval_max,omitempty"`
+	EnableDebugRPC          bool              `json:"enable_debug_rpc"`
+	TrackedPinsMaxDeviation float64           `json:"tracked_pins_max_deviation,omitempty"`
+	PinQueueMaxLength       int               `json:"pin_queue_max_length,omitempty"`
+	MaxClockSkew            string            `json:"max_clock_skew,omitempty"`
+	LocalRPCSocket          string            `json:"local_rpc_socket,omitempty"`
+	LocalRPCToken           string            `json:"local_rpc_token,omitempty"`
+	Role                    string            `json:"role,omitempty"`
+	Consensus               string            `json:"consensus,omitempty"`
+	PinTracker              string            `json:"pin_tracker,omitempty"`
+	AutoRecoverInterval     string            `json:"auto_recover_interval,omitempty"`
+	AutoRecoverMaxPins      int               `json:"auto_recover_max_pins,omitempty"`
+
+	PopularityHotThreshold         int    `json:"popularity_hot_threshold,omitempty"`
+	PopularityColdThreshold        int    `json:"popularity_cold_threshold,omitempty"`
+	PopularityReplicationFactorMax int    `json:"popularity_replication_factor_max,omitempty"`
+	PopularityCooldown             string `json:"popularity_cooldown,omitempty"`
 }
 
 // ConfigKey returns a human-readable string to identify
@@ -200,6 +483,10 @@ func (cfg *Config) Validate() error {
 		return errors.New("cluster.listen_addr is indefined")
 	}
 
+	if strings.ContainsAny(cfg.Namespace, "/ \t\n") {
+		return errors.New("cluster.namespace cannot contain slashes or spaces")
+	}
+
 	if cfg.StateSyncInterval <= 0 {
 		return errors.New("cluster.state_sync_interval is invalid")
 	}
@@ -216,12 +503,133 @@ func (cfg *Config) Validate() error {
 		return errors.New("cluster.peer_watch_interval is invalid")
 	}
 
+	if cfg.EventsRetention < 0 {
+		return errors.New("cluster.events_retention is invalid")
+	}
+
+	if cfg.DrainTimeout <= 0 {
+		return errors.New("cluster.drain_timeout is invalid")
+	}
+
+	if cfg.AllocationHistorySize <= 0 {
+		return errors.New("cluster.allocation_history_size is invalid")
+	}
+
+	if cfg.AllocationMetricMaxAge < 0 {
+		return errors.New("cluster.allocation_metric_max_age is invalid")
+	}
+
+	for k := range cfg.AllocationTags {
+		if k == "" {
+			return errors.New("cluster.allocation_tags contains an empty tag")
+		}
+	}
+
+	if !isSyncIntervalRangeValid(cfg.StateSyncInterval, cfg.StateSyncIntervalMin, cfg.StateSyncIntervalMax) {
+		return errors.New("cluster.state_sync_interval_min/max are invalid")
+	}
+
+	if !isSyncIntervalRangeValid(cfg.IPFSSyncInterval, cfg.IPFSSyncIntervalMin, cfg.IPFSSyncIntervalMax) {
+		return errors.New("cluster.ipfs_sync_interval_min/max are invalid")
+	}
+
+	if cfg.TrackedPinsMaxDeviation < 0 {
+		return errors.New("cluster.tracked_pins_max_deviation is invalid")
+	}
+
+	if cfg.PinQueueMaxLength < 0 {
+		return errors.New("cluster.pin_queue_max_length is invalid")
+	}
+
+	if cfg.MaxClockSkew < 0 {
+		return errors.New("cluster.max_clock_skew is invalid")
+	}
+
+	if cfg.RepinDelay < 0 {
+		return errors.New("cluster.repin_delay is invalid")
+	}
+
+	if cfg.AutoRecoverInterval < 0 {
+		return errors.New("cluster.auto_recover_interval is invalid")
+	}
+
+	if cfg.AutoRecoverMaxPins < 0 {
+		return errors.New("cluster.auto_recover_max_pins is invalid")
+	}
+
+	if cfg.RepinConcurrency <= 0 {
+		return errors.New("cluster.repin_concurrency is invalid")
+	}
+
+	if cfg.BroadcastConcurrency <= 0 {
+		return errors.New("cluster.broadcast_concurrency is invalid")
+	}
+
+	if cfg.RPCCompressionThreshold <= 0 {
+		return errors.New("cluster.rpc_compression_threshold is invalid")
+	}
+
+	if cfg.PopularityHotThreshold < 0 || cfg.PopularityColdThreshold < 0 {
+		return errors.New("cluster.popularity_hot_threshold/cold_threshold are invalid")
+	}
+
+	if cfg.PopularityHotThreshold > 0 {
+		if cfg.PopularityColdThreshold >= cfg.PopularityHotThreshold {
+			return errors.New("cluster.popularity_cold_threshold should be lower than popularity_hot_threshold")
+		}
+		if cfg.PopularityReplicationFactorMax <= 0 {
+			return errors.New("cluster.popularity_replication_factor_max is invalid")
+		}
+		if cfg.PopularityCooldown < 0 {
+			return errors.New("cluster.popularity_cooldown is invalid")
+		}
+	}
+
+	switch cfg.PinMergePolicy {
+	case PinMergeOverwrite, PinMergeMerge:
+	default:
+		return errors.New("cluster.pin_merge_policy is invalid")
+	}
+
+	switch cfg.UnderReplicationPolicy {
+	case UnderReplicationReject, UnderReplicationAccept:
+	default:
+		return errors.New("cluster.under_replication_policy is invalid")
+	}
+
+	switch cfg.Role {
+	case RoleStorage, RoleGateway, RoleArbiter, RoleFollower:
+	default:
+		return errors.New("cluster.role is invalid")
+	}
+
+	switch cfg.Consensus {
+	case ConsensusRaft, ConsensusCRDT:
+	default:
+		return errors.New("cluster.consensus is invalid")
+	}
+
+	switch cfg.PinTracker {
+	case PinTrackerMap, PinTrackerStateless:
+	default:
+		return errors.New("cluster.pin_tracker is invalid")
+	}
+
 	rfMax := cfg.ReplicationFactorMax
 	rfMin := cfg.ReplicationFactorMin
 
 	return isReplicationFactorValid(rfMin, rfMax)
 }
 
+// isSyncIntervalRangeValid checks that adaptive sync bounds are either
+// unset or set around the given interval.
+func isSyncIntervalRangeValid(interval, min, max time.Duration) bool {
+	if min == 0 && max == 0 {
+		return true
+	}
+	return min > 0 && min <= interval && interval <= max
+}
+
 func isReplicationFactorValid(rplMin, rplMax int) error {
 	// check Max and Min are correct
 	if rplMin == 0 || rplMax == 0 {
@@ -255,7 +663,7 @@ func (cfg *Config) setDefaults() {
 	}
 	cfg.Peername = hostname
 
-	addr, _ := ma.NewMultiaddr(DefaultListenAddr)
+	addr, _ := ma.NewMultiaddr(api.PreferredAddr(DefaultListenAddr, DefaultListenAddrIPv6))
 	cfg.ListenAddr = addr
 	cfg.LeaveOnShutdown = DefaultLeaveOnShutdown
 	cfg.StateSyncInterval = DefaultStateSyncInterval
@@ -265,7 +673,43 @@ func (cfg *Config) setDefaults() {
 	cfg.MonitorPingInterval = DefaultMonitorPingInterval
 	cfg.PeerWatchInterval = DefaultPeerWatchInterval
 	cfg.DisableRepinning = DefaultDisableRepinning
+	cfg.RepinDelay = 0
+	cfg.RepinConcurrency = DefaultRepinConcurrency
+	cfg.BroadcastConcurrency = DefaultBroadcastConcurrency
 	cfg.PeerstoreFile = "" // empty so it gets ommited.
+	cfg.EventsFile = ""    // empty so it gets ommited.
+	cfg.EventsRetention = DefaultEventsRetention
+	cfg.DrainTimeout = DefaultDrainTimeout
+	cfg.AllocationHistoryFile = "" // empty so it gets ommited.
+	cfg.AllocationHistorySize = DefaultAllocationHistorySize
+	cfg.TemporaryPinsFile = "" // empty so it gets ommited.
+	cfg.CordonedPeers = nil
+	cfg.AllocationMetricMaxAge = 0
+	cfg.AllocationTags = nil
+	cfg.AllocationMetric = ""
+	cfg.PinMergePolicy = DefaultPinMergePolicy
+	cfg.UnderReplicationPolicy = DefaultUnderReplicationPolicy
+	cfg.DisableRPCCompression = false
+	cfg.RPCCompressionThreshold = DefaultRPCCompressionThreshold
+	cfg.StateSyncIntervalMin = 0
+	cfg.StateSyncIntervalMax = 0
+	cfg.IPFSSyncIntervalMin = 0
+	cfg.IPFSSyncIntervalMax = 0
+	cfg.EnableDebugRPC = DefaultEnableDebugRPC
+	cfg.TrackedPinsMaxDeviation = 0
+	cfg.PinQueueMaxLength = 0
+	cfg.MaxClockSkew = 0
+	cfg.LocalRPCSocket = ""
+	cfg.LocalRPCToken = ""
+	cfg.Role = DefaultRole
+	cfg.Consensus = DefaultConsensus
+	cfg.PinTracker = DefaultPinTracker
+	cfg.PopularityHotThreshold = 0
+	cfg.PopularityColdThreshold = 0
+	cfg.PopularityReplicationFactorMax = 0
+	cfg.PopularityCooldown = DefaultPopularityCooldown
+	cfg.AutoRecoverInterval = 0
+	cfg.AutoRecoverMaxPins = 0
 }
 
 // LoadJSON receives a raw json-formatted configuration and
@@ -282,6 +726,10 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	// Make sure all non-defined keys have good values.
 	cfg.setDefaults()
 	config.SetIfNotDefault(jcfg.PeerstoreFile, &cfg.PeerstoreFile)
+	config.SetIfNotDefault(jcfg.EventsFile, &cfg.EventsFile)
+	config.SetIfNotDefault(jcfg.AllocationHistoryFile, &cfg.AllocationHistoryFile)
+	config.SetIfNotDefault(jcfg.AllocationHistorySize, &cfg.AllocationHistorySize)
+	config.SetIfNotDefault(jcfg.TemporaryPinsFile, &cfg.TemporaryPinsFile)
 
 	if jcfg.Peers != nil || jcfg.Bootstrap != nil {
 		logger.Error(`
@@ -338,6 +786,7 @@ for more information.`)
 		return err
 	}
 	cfg.Secret = clusterSecret
+	config.SetIfNotDefault(jcfg.Namespace, &cfg.Namespace)
 
 	clusterAddr, err := ma.NewMultiaddr(jcfg.ListenMultiaddress)
 	if err != nil {
@@ -359,14 +808,64 @@ for more information.`)
 	ipfsSyncInterval := parseDuration(jcfg.IPFSSyncInterval)
 	monitorPingInterval := parseDuration(jcfg.MonitorPingInterval)
 	peerWatchInterval := parseDuration(jcfg.PeerWatchInterval)
+	eventsRetention := parseDuration(jcfg.EventsRetention)
+	drainTimeout := parseDuration(jcfg.DrainTimeout)
+	allocationMetricMaxAge := parseDuration(jcfg.AllocationMetricMaxAge)
+	stateSyncIntervalMin := parseDuration(jcfg.StateSyncIntervalMin)
+	stateSyncIntervalMax := parseDuration(jcfg.StateSyncIntervalMax)
+	ipfsSyncIntervalMin := parseDuration(jcfg.IPFSSyncIntervalMin)
+	ipfsSyncIntervalMax := parseDuration(jcfg.IPFSSyncIntervalMax)
+	maxClockSkew := parseDuration(jcfg.MaxClockSkew)
+	repinDelay := parseDuration(jcfg.RepinDelay)
+	autoRecoverInterval := parseDuration(jcfg.AutoRecoverInterval)
+	popularityCooldown := parseDuration(jcfg.PopularityCooldown)
 
 	config.SetIfNotDefault(stateSyncInterval, &cfg.StateSyncInterval)
 	config.SetIfNotDefault(ipfsSyncInterval, &cfg.IPFSSyncInterval)
 	config.SetIfNotDefault(monitorPingInterval, &cfg.MonitorPingInterval)
 	config.SetIfNotDefault(peerWatchInterval, &cfg.PeerWatchInterval)
+	config.SetIfNotDefault(eventsRetention, &cfg.EventsRetention)
+	config.SetIfNotDefault(drainTimeout, &cfg.DrainTimeout)
+	config.SetIfNotDefault(allocationMetricMaxAge, &cfg.AllocationMetricMaxAge)
+	config.SetIfNotDefault(jcfg.AllocationMetric, &cfg.AllocationMetric)
+	config.SetIfNotDefault(jcfg.PinMergePolicy, &cfg.PinMergePolicy)
+	config.SetIfNotDefault(jcfg.UnderReplicationPolicy, &cfg.UnderReplicationPolicy)
+	config.SetIfNotDefault(jcfg.RPCCompressionThreshold, &cfg.RPCCompressionThreshold)
+	config.SetIfNotDefault(stateSyncIntervalMin, &cfg.StateSyncIntervalMin)
+	config.SetIfNotDefault(stateSyncIntervalMax, &cfg.StateSyncIntervalMax)
+	config.SetIfNotDefault(ipfsSyncIntervalMin, &cfg.IPFSSyncIntervalMin)
+	config.SetIfNotDefault(ipfsSyncIntervalMax, &cfg.IPFSSyncIntervalMax)
+	config.SetIfNotDefault(jcfg.TrackedPinsMaxDeviation, &cfg.TrackedPinsMaxDeviation)
+	config.SetIfNotDefault(jcfg.PinQueueMaxLength, &cfg.PinQueueMaxLength)
+	config.SetIfNotDefault(maxClockSkew, &cfg.MaxClockSkew)
+	config.SetIfNotDefault(repinDelay, &cfg.RepinDelay)
+	config.SetIfNotDefault(jcfg.RepinConcurrency, &cfg.RepinConcurrency)
+	config.SetIfNotDefault(jcfg.BroadcastConcurrency, &cfg.BroadcastConcurrency)
+	config.SetIfNotDefault(jcfg.LocalRPCSocket, &cfg.LocalRPCSocket)
+	config.SetIfNotDefault(jcfg.LocalRPCToken, &cfg.LocalRPCToken)
+	config.SetIfNotDefault(jcfg.Role, &cfg.Role)
+	config.SetIfNotDefault(jcfg.Consensus, &cfg.Consensus)
+	config.SetIfNotDefault(jcfg.PinTracker, &cfg.PinTracker)
+	config.SetIfNotDefault(jcfg.PopularityHotThreshold, &cfg.PopularityHotThreshold)
+	config.SetIfNotDefault(jcfg.PopularityColdThreshold, &cfg.PopularityColdThreshold)
+	config.SetIfNotDefault(jcfg.PopularityReplicationFactorMax, &cfg.PopularityReplicationFactorMax)
+	config.SetIfNotDefault(popularityCooldown, &cfg.PopularityCooldown)
+	config.SetIfNotDefault(autoRecoverInterval, &cfg.AutoRecoverInterval)
+	config.SetIfNotDefault(jcfg.AutoRecoverMaxPins, &cfg.AutoRecoverMaxPins)
+
+	for _, pstr := range jcfg.CordonedPeers {
+		pid, err := peer.IDB58Decode(pstr)
+		if err != nil {
+			return fmt.Errorf("error decoding cordoned peer %s: %s", pstr, err)
+		}
+		cfg.CordonedPeers = append(cfg.CordonedPeers, pid)
+	}
+	cfg.AllocationTags = jcfg.AllocationTags
 
 	cfg.LeaveOnShutdown = jcfg.LeaveOnShutdown
 	cfg.DisableRepinning = jcfg.DisableRepinning
+	cfg.EnableDebugRPC = jcfg.EnableDebugRPC
+	cfg.DisableRPCCompression = jcfg.DisableRPCCompression
 
 	return cfg.Validate()
 }
@@ -394,6 +893,7 @@ func (cfg *Config) ToJSON() (raw []byte, err error) {
 	jcfg.Peername = cfg.Peername
 	jcfg.PrivateKey = pKey
 	jcfg.Secret = EncodeProtectorKey(cfg.Secret)
+	jcfg.Namespace = cfg.Namespace
 	jcfg.ReplicationFactorMin = cfg.ReplicationFactorMin
 	jcfg.ReplicationFactorMax = cfg.ReplicationFactorMax
 	jcfg.LeaveOnShutdown = cfg.LeaveOnShutdown
@@ -403,7 +903,55 @@ func (cfg *Config) ToJSON() (raw []byte, err error) {
 	jcfg.MonitorPingInterval = cfg.MonitorPingInterval.String()
 	jcfg.PeerWatchInterval = cfg.PeerWatchInterval.String()
 	jcfg.DisableRepinning = cfg.DisableRepinning
+	if cfg.RepinDelay > 0 {
+		jcfg.RepinDelay = cfg.RepinDelay.String()
+	}
+	jcfg.RepinConcurrency = cfg.RepinConcurrency
+	jcfg.BroadcastConcurrency = cfg.BroadcastConcurrency
+	jcfg.EnableDebugRPC = cfg.EnableDebugRPC
 	jcfg.PeerstoreFile = cfg.PeerstoreFile
+	jcfg.EventsFile = cfg.EventsFile
+	jcfg.EventsRetention = cfg.EventsRetention.String()
+	jcfg.DrainTimeout = cfg.DrainTimeout.String()
+	jcfg.AllocationHistoryFile = cfg.AllocationHistoryFile
+	jcfg.AllocationHistorySize = cfg.AllocationHistorySize
+	jcfg.TemporaryPinsFile = cfg.TemporaryPinsFile
+	jcfg.CordonedPeers = api.PeersToStrings(cfg.CordonedPeers)
+	if cfg.AllocationMetricMaxAge > 0 {
+		jcfg.AllocationMetricMaxAge = cfg.AllocationMetricMaxAge.String()
+	}
+	jcfg.AllocationTags = cfg.AllocationTags
+	jcfg.AllocationMetric = cfg.AllocationMetric
+	jcfg.PinMergePolicy = cfg.PinMergePolicy
+	jcfg.UnderReplicationPolicy = cfg.UnderReplicationPolicy
+	jcfg.DisableRPCCompression = cfg.DisableRPCCompression
+	jcfg.RPCCompressionThreshold = cfg.RPCCompressionThreshold
+	if cfg.StateSyncIntervalMin > 0 || cfg.StateSyncIntervalMax > 0 {
+		jcfg.StateSyncIntervalMin = cfg.StateSyncIntervalMin.String()
+		jcfg.StateSyncIntervalMax = cfg.StateSyncIntervalMax.String()
+	}
+	if cfg.IPFSSyncIntervalMin > 0 || cfg.IPFSSyncIntervalMax > 0 {
+		jcfg.IPFSSyncIntervalMin = cfg.IPFSSyncIntervalMin.String()
+		jcfg.IPFSSyncIntervalMax = cfg.IPFSSyncIntervalMax.String()
+	}
+	jcfg.TrackedPinsMaxDeviation = cfg.TrackedPinsMaxDeviation
+	jcfg.PinQueueMaxLength = cfg.PinQueueMaxLength
+	if cfg.MaxClockSkew > 0 {
+		jcfg.MaxClockSkew = cfg.MaxClockSkew.String()
+	}
+	jcfg.LocalRPCSocket = cfg.LocalRPCSocket
+	jcfg.LocalRPCToken = cfg.LocalRPCToken
+	jcfg.Role = cfg.Role
+	jcfg.Consensus = cfg.Consensus
+	jcfg.PinTracker = cfg.PinTracker
+	jcfg.PopularityHotThreshold = cfg.PopularityHotThreshold
+	jcfg.PopularityColdThreshold = cfg.PopularityColdThreshold
+	jcfg.PopularityReplicationFactorMax = cfg.PopularityReplicationFactorMax
+	jcfg.PopularityCooldown = cfg.PopularityCooldown.String()
+	if cfg.AutoRecoverInterval > 0 {
+		jcfg.AutoRecoverInterval = cfg.AutoRecoverInterval.String()
+	}
+	jcfg.AutoRecoverMaxPins = cfg.AutoRecoverMaxPins
 
 	raw, err = json.MarshalIndent(jcfg, "", "    ")
 	return
@@ -426,6 +974,72 @@ func (cfg *Config) GetPeerstorePath() string {
 	return filepath.Join(cfg.BaseDir, filename)
 }
 
+// GetEventsPath returns the full path of the EventsFile, obtained by
+// concatenating that value with BaseDir of the configuration, if set.
+// An empty string is returned when BaseDir is not set.
+func (cfg *Config) GetEventsPath() string {
+	if cfg.BaseDir == "" {
+		return ""
+	}
+
+	filename := DefaultEventsFile
+	if cfg.EventsFile != "" {
+		filename = cfg.EventsFile
+	}
+
+	return filepath.Join(cfg.BaseDir, filename)
+}
+
+// GetAllocationHistoryPath returns the full path of the
+// AllocationHistoryFile, obtained by concatenating that value with BaseDir
+// of the configuration, if set. An empty string is returned when BaseDir
+// is not set.
+func (cfg *Config) GetAllocationHistoryPath() string {
+	if cfg.BaseDir == "" {
+		return ""
+	}
+
+	filename := DefaultAllocationHistoryFile
+	if cfg.AllocationHistoryFile != "" {
+		filename = cfg.AllocationHistoryFile
+	}
+
+	return filepath.Join(cfg.BaseDir, filename)
+}
+
+// GetTemporaryPinsPath returns the full path of the TemporaryPinsFile,
+// obtained by concatenating that value with BaseDir of the configuration,
+// if set. An empty string is returned when BaseDir is not set.
+func (cfg *Config) GetTemporaryPinsPath() string {
+	if cfg.BaseDir == "" {
+		return ""
+	}
+
+	filename := DefaultTemporaryPinsFile
+	if cfg.TemporaryPinsFile != "" {
+		filename = cfg.TemporaryPinsFile
+	}
+
+	return filepath.Join(cfg.BaseDir, filename)
+}
+
+// StoresPins returns whether the Role of the peer pins content and
+// receives allocations.
+func (cfg *Config) StoresPins() bool {
+	return cfg.Role == RoleStorage || cfg.Role == RoleFollower
+}
+
+// GetLocalRPCSocketPath returns the full path of the LocalRPCSocket,
+// obtained by concatenating that value with BaseDir of the configuration
+// when it is relative. An empty string is returned when LocalRPCSocket
+// is not set.
+func (cfg *Config) GetLocalRPCSocketPath() string {
+	if cfg.LocalRPCSocket == "" || filepath.IsAbs(cfg.LocalRPCSocket) {
+		return cfg.LocalRPCSocket
+	}
+	return filepath.Join(cfg.BaseDir, cfg.LocalRPCSocket)
+}
+
 // DecodeClusterSecret parses a hex-encoded string, checks that it is exactly
 // 32 bytes long and returns its value as a byte-slice.x
 func DecodeClusterSecret(hexSecret string) ([]byte, error) {
@@ -3,6 +3,7 @@ package ipfscluster
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 var ccfgTestJSON = []byte(`
@@ -18,7 +19,36 @@ var ccfgTestJSON = []byte(`
         "replication_factor_min": 5,
         "replication_factor_max": 5,
         "monitor_ping_interval": "2s",
-        "disable_repinning": true
+        "disable_repinning": true,
+        "repin_delay": "5m",
+        "repin_concurrency": 10,
+        "broadcast_concurrency": 50,
+        "events_retention": "48h0m0s",
+        "drain_timeout": "30m",
+        "allocation_history_size": 20,
+        "cordoned_peers": ["QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc"],
+        "allocation_metric_max_age": "1m",
+        "allocation_tags": {"disk": "ssd"},
+        "allocation_metric": "gpu",
+        "pin_merge_policy": "merge",
+        "under_replication_policy": "accept",
+        "rpc_compression_threshold": 4096,
+        "state_sync_interval_min": "30s",
+        "state_sync_interval_max": "10m",
+        "enable_debug_rpc": true,
+        "tracked_pins_max_deviation": 0.5,
+        "pin_queue_max_length": 1000,
+        "max_clock_skew": "5s",
+        "local_rpc_socket": "rpc.sock",
+        "role": "gateway",
+        "consensus": "crdt",
+        "pin_tracker": "stateless",
+        "popularity_hot_threshold": 100,
+        "popularity_cold_threshold": 10,
+        "popularity_replication_factor_max": 8,
+        "popularity_cooldown": "1h",
+        "auto_recover_interval": "10m",
+        "auto_recover_max_pins": 50
 }
 `)
 
@@ -41,6 +71,98 @@ func TestLoadJSON(t *testing.T) {
 		t.Error("expected disable_repinning to be true")
 	}
 
+	if cfg.RepinDelay != 5*time.Minute || cfg.RepinConcurrency != 10 {
+		t.Error("expected repin options to be loaded")
+	}
+
+	if cfg.BroadcastConcurrency != 50 {
+		t.Error("expected broadcast_concurrency to be 50")
+	}
+
+	if cfg.EventsRetention != 48*time.Hour {
+		t.Error("expected events_retention to be 48h")
+	}
+
+	if cfg.DrainTimeout != 30*time.Minute {
+		t.Error("expected drain_timeout to be 30m")
+	}
+
+	if cfg.AllocationHistorySize != 20 {
+		t.Error("expected allocation_history_size to be 20")
+	}
+
+	if len(cfg.CordonedPeers) != 1 || cfg.AllocationMetricMaxAge != time.Minute ||
+		cfg.AllocationTags["disk"] != "ssd" {
+		t.Error("expected allocation filter options to be loaded")
+	}
+
+	if cfg.AllocationMetric != "gpu" {
+		t.Error("expected allocation_metric to be gpu")
+	}
+
+	if cfg.PinMergePolicy != PinMergeMerge {
+		t.Error("expected pin_merge_policy to be merge")
+	}
+
+	if cfg.RPCCompressionThreshold != 4096 || cfg.DisableRPCCompression {
+		t.Error("expected rpc compression options to be loaded")
+	}
+
+	if cfg.StateSyncIntervalMin != 30*time.Second || cfg.StateSyncIntervalMax != 10*time.Minute {
+		t.Error("expected state sync interval bounds to be loaded")
+	}
+
+	if cfg.IPFSSyncIntervalMin != 0 || cfg.IPFSSyncIntervalMax != 0 {
+		t.Error("expected ipfs sync interval bounds to be unset")
+	}
+
+	if !cfg.EnableDebugRPC {
+		t.Error("expected enable_debug_rpc to be true")
+	}
+
+	if cfg.TrackedPinsMaxDeviation != 0.5 {
+		t.Error("expected tracked_pins_max_deviation to be 0.5")
+	}
+
+	if cfg.PinQueueMaxLength != 1000 {
+		t.Error("expected pin_queue_max_length to be 1000")
+	}
+
+	if cfg.MaxClockSkew != 5*time.Second {
+		t.Error("expected max_clock_skew to be 5s")
+	}
+
+	if cfg.UnderReplicationPolicy != UnderReplicationAccept {
+		t.Error("expected under_replication_policy to be accept")
+	}
+
+	if cfg.AutoRecoverInterval != 10*time.Minute || cfg.AutoRecoverMaxPins != 50 {
+		t.Error("expected auto_recover_interval/max_pins to be loaded")
+	}
+
+	if cfg.LocalRPCSocket != "rpc.sock" || cfg.LocalRPCToken != "" {
+		t.Error("expected local_rpc_socket to be loaded")
+	}
+
+	if cfg.Role != RoleGateway || cfg.StoresPins() {
+		t.Error("expected role to be gateway")
+	}
+
+	if cfg.Consensus != ConsensusCRDT {
+		t.Error("expected consensus to be crdt")
+	}
+
+	if cfg.PinTracker != PinTrackerStateless {
+		t.Error("expected pin_tracker to be stateless")
+	}
+
+	if cfg.PopularityHotThreshold != 100 ||
+		cfg.PopularityColdThreshold != 10 ||
+		cfg.PopularityReplicationFactorMax != 8 ||
+		cfg.PopularityCooldown != time.Hour {
+		t.Error("expected popularity options to be loaded")
+	}
+
 	j := &configJSON{}
 
 	json.Unmarshal(ccfgTestJSON, j)
@@ -51,6 +173,24 @@ func TestLoadJSON(t *testing.T) {
 		t.Error("expected error decoding ID")
 	}
 
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.CordonedPeers = []string{"abc"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding cordoned_peers")
+	}
+
+	j = &configJSON{}
+	json.Unmarshal(ccfgTestJSON, j)
+	j.PinMergePolicy = "union"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding pin_merge_policy")
+	}
+
 	j = &configJSON{}
 	json.Unmarshal(ccfgTestJSON, j)
 	j.Peername = ""
@@ -185,4 +325,144 @@ func TestValidate(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.DrainTimeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.StateSyncIntervalMin = cfg.StateSyncInterval * 2
+	cfg.StateSyncIntervalMax = cfg.StateSyncInterval * 4
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.IPFSSyncIntervalMax = cfg.IPFSSyncInterval
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.TrackedPinsMaxDeviation = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinQueueMaxLength = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MaxClockSkew = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.RepinDelay = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.UnderReplicationPolicy = "maybe"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.AutoRecoverInterval = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.AutoRecoverMaxPins = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.RepinConcurrency = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.BroadcastConcurrency = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.AllocationHistorySize = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Role = "janitor"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Consensus = "paxos"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinTracker = "list"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Namespace = "my/cluster"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PopularityHotThreshold = 10
+	cfg.PopularityColdThreshold = 10
+	cfg.PopularityReplicationFactorMax = 3
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PopularityHotThreshold = 10
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PopularityHotThreshold = 10
+	cfg.PopularityColdThreshold = 1
+	cfg.PopularityReplicationFactorMax = 3
+	cfg.PopularityCooldown = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestNamespacedProtocol(t *testing.T) {
+	if NamespacedProtocol("", RPCProtocol) != RPCProtocol {
+		t.Error("the protocol should not change without namespace")
+	}
+	pid := NamespacedProtocol("mycluster", "/ipfscluster/0.4.0/rpc")
+	if pid != "/ipfscluster/mycluster/0.4.0/rpc" {
+		t.Error("unexpected protocol: ", pid)
+	}
+	pid = NamespacedProtocol("mycluster", "/other/1.0")
+	if pid != "/mycluster/other/1.0" {
+		t.Error("unexpected protocol: ", pid)
+	}
 }
@@ -2,9 +2,9 @@ package ipfscluster
 
 import (
 	"context"
-	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,11 +20,11 @@ import (
 	rpc "github.com/hsanjuan/go-libp2p-gorpc"
 	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 type mockComponent struct {
-	rpcClient   *rpc.Client
-	returnError bool
+	rpcClient *rpc.Client
 }
 
 func (c *mockComponent) Shutdown() error {
@@ -40,58 +40,7 @@ type mockAPI struct {
 	mockComponent
 }
 
-type mockConnector struct {
-	mockComponent
-}
-
-func (ipfs *mockConnector) ID() (api.IPFSID, error) {
-	if ipfs.returnError {
-		return api.IPFSID{}, errors.New("")
-	}
-	return api.IPFSID{
-		ID: test.TestPeerID1,
-	}, nil
-}
-
-func (ipfs *mockConnector) Pin(ctx context.Context, c *cid.Cid, b bool) error {
-	if ipfs.returnError {
-		return errors.New("")
-	}
-	return nil
-}
-
-func (ipfs *mockConnector) Unpin(ctx context.Context, c *cid.Cid) error {
-	if ipfs.returnError {
-		return errors.New("")
-	}
-	return nil
-}
-
-func (ipfs *mockConnector) PinLsCid(ctx context.Context, c *cid.Cid) (api.IPFSPinStatus, error) {
-	if ipfs.returnError {
-		return api.IPFSPinStatusError, errors.New("")
-	}
-	return api.IPFSPinStatusRecursive, nil
-}
-
-func (ipfs *mockConnector) PinLs(ctx context.Context, filter string) (map[string]api.IPFSPinStatus, error) {
-	if ipfs.returnError {
-		return nil, errors.New("")
-	}
-	m := make(map[string]api.IPFSPinStatus)
-	return m, nil
-}
-
-func (ipfs *mockConnector) SwarmPeers() (api.SwarmPeers, error) {
-	return []peer.ID{test.TestPeerID4, test.TestPeerID5}, nil
-}
-
-func (ipfs *mockConnector) ConnectSwarms() error                          { return nil }
-func (ipfs *mockConnector) ConfigKey(keypath string) (interface{}, error) { return nil, nil }
-func (ipfs *mockConnector) FreeSpace() (uint64, error)                    { return 100, nil }
-func (ipfs *mockConnector) RepoSize() (uint64, error)                     { return 0, nil }
-
-func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, *mapstate.MapState, *maptracker.MapPinTracker) {
+func testingCluster(t *testing.T) (*Cluster, *mockAPI, *test.MockConnector, *mapstate.MapState, *maptracker.MapPinTracker) {
 	clusterCfg, _, _, consensusCfg, trackerCfg, monCfg, _ := testingConfigs()
 
 	host, err := NewClusterHost(context.Background(), clusterCfg)
@@ -100,7 +49,7 @@ func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, *mapstate
 	}
 
 	api := &mockAPI{}
-	ipfs := &mockConnector{}
+	ipfs := &test.MockConnector{}
 	st := mapstate.NewMapState()
 	tracker := maptracker.NewMapPinTracker(trackerCfg, clusterCfg.ID)
 	monCfg.CheckInterval = 2 * time.Second
@@ -118,13 +67,13 @@ func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, *mapstate
 		host,
 		clusterCfg,
 		raftcon,
-		api,
+		[]API{api},
 		ipfs,
 		st,
 		tracker,
 		mon,
 		alloc,
-		inf)
+		[]Informer{inf})
 	if err != nil {
 		t.Fatal("cannot create cluster:", err)
 	}
@@ -197,11 +146,48 @@ func TestClusterID(t *testing.T) {
 	if id.Version != Version {
 		t.Error("version should match current version")
 	}
+	if id.GoVersion == "" {
+		t.Error("expected a go version")
+	}
+	comps := id.Components
+	if comps.Consensus != ConsensusRaft || comps.PinTracker != PinTrackerMap {
+		t.Errorf("unexpected components: %+v", comps)
+	}
+	if len(comps.Informers) != 1 || comps.Informers[0] != numpin.MetricName || comps.AllocationMetric != numpin.MetricName {
+		t.Errorf("unexpected informers: %+v", comps)
+	}
+	features := strings.Join(id.Features, ",")
+	if !strings.Contains(features, api.FeaturePinExpiration) || !strings.Contains(features, api.FeatureRepinning) || !strings.Contains(features, api.FeatureAdd) || !strings.Contains(features, api.FeatureCAR) {
+		t.Error("expected features to be reported:", features)
+	}
+	if strings.Contains(features, api.FeatureAutoRecover) || strings.Contains(features, api.FeatureRepoGC) {
+		t.Error("unexpected features:", features)
+	}
 	//if id.PublicKey == nil {
 	//	t.Error("publicKey should not be empty")
 	//}
 }
 
+func TestClusterReadiness(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	r := cl.Readiness()
+	if !r.Ready {
+		t.Fatal("cluster should be ready")
+	}
+
+	ipfs.ReturnError = true
+	r = cl.Readiness()
+	if r.Ready || r.Components["ipfs"] {
+		t.Error("ipfs should not be ready")
+	}
+	if !r.Components["consensus"] || !r.Components["tracker"] {
+		t.Error("consensus and tracker should be ready")
+	}
+}
+
 func TestClusterPin(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
@@ -212,6 +198,25 @@ func TestClusterPin(t *testing.T) {
 	if err != nil {
 		t.Fatal("pin should have worked:", err)
 	}
+	pin, err := cl.PinGet(c)
+	if err != nil || pin.Timestamp.IsZero() {
+		t.Fatal("the pin should have a timestamp:", pin.Timestamp, err)
+	}
+
+	// re-pinning keeps the first timestamp
+	err = cl.Pin(api.Pin{
+		Cid:                  c,
+		Name:                 "renamed",
+		ReplicationFactorMax: -1,
+		ReplicationFactorMin: -1,
+	})
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	pin2, _ := cl.PinGet(c)
+	if pin2.Name != "renamed" || !pin2.Timestamp.Equal(pin.Timestamp) {
+		t.Error("the timestamp should have been kept:", pin2.Timestamp, pin.Timestamp)
+	}
 
 	// test an error case
 	cl.consensus.Shutdown()
@@ -225,6 +230,561 @@ func TestClusterPin(t *testing.T) {
 	}
 }
 
+func TestClusterPinBatch(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	var pins []api.Pin
+	for _, h := range []string{test.TestCid1, test.TestCid2, test.TestCid3} {
+		c, _ := cid.Decode(h)
+		pins = append(pins, api.PinCid(c))
+	}
+	err := cl.PinBatch(pins)
+	if err != nil {
+		t.Fatal("pin batch should have worked:", err)
+	}
+
+	if n := len(cl.Pins()); n != len(pins) {
+		t.Errorf("expected %d pins, got %d", len(pins), n)
+	}
+}
+
+func TestClusterAllocationPreview(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin, err := cl.AllocationPreview(api.Pin{
+		Cid:                  c,
+		ReplicationFactorMax: -1,
+		ReplicationFactorMin: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pin.Allocations) != 0 {
+		t.Errorf("expected to pin everywhere: %s", pin.Allocations)
+	}
+
+	if _, err := cl.PinGet(c); err == nil {
+		t.Error("the preview should not pin the cid")
+	}
+
+	_, err = cl.AllocationPreview(api.Pin{
+		Cid:                  c,
+		ReplicationFactorMax: 1,
+		ReplicationFactorMin: 2,
+	})
+	if err == nil {
+		t.Error("expected an error with invalid replication factors")
+	}
+
+	// the default maximum (-1) does not fit the requested minimum
+	_, err = cl.AllocationPreview(api.Pin{
+		Cid:                  c,
+		ReplicationFactorMin: 5,
+	})
+	perr, ok := err.(*api.PinOptionError)
+	if !ok || perr.Field != "replication_factor_min" {
+		t.Error("expected a replication_factor_min error:", err)
+	}
+}
+
+func TestClusterPinEstimate(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	est, err := cl.PinEstimate(context.Background(), api.Pin{
+		Cid:                  c,
+		ReplicationFactorMax: -1,
+		ReplicationFactorMin: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Size != 1000 || est.Replication != 1 || est.TotalSize != 1000 {
+		t.Errorf("unexpected estimate: %+v", est)
+	}
+	if !est.Feasible {
+		t.Error("pinning everywhere should be feasible:", est.Reason)
+	}
+
+	est, err = cl.PinEstimate(context.Background(), api.Pin{
+		Cid:                  c,
+		ReplicationFactorMax: 5,
+		ReplicationFactorMin: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Feasible || est.Reason == "" {
+		t.Error("there are not enough peers to pin with a replication factor of 5")
+	}
+}
+
+func TestClusterPinWithResult(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	cl.config.PinMergePolicy = PinMergeMerge
+
+	pin := api.PinCid(c)
+	pin.Name = "a"
+	res, err := cl.PinWithResult(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != api.PinActionPinned || res.Previous != nil {
+		t.Error("expected a new pin")
+	}
+
+	res, err = cl.PinWithResult(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != api.PinActionUnchanged || res.Pin.Name != "a" {
+		t.Error("merging without new options should keep the pin unchanged")
+	}
+
+	pin.Name = "b"
+	res, err = cl.PinWithResult(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != api.PinActionMerged || res.Previous == nil || res.Previous.Name != "a" {
+		t.Error("expected a merged pin with the previous one")
+	}
+
+	cl.config.PinMergePolicy = PinMergeOverwrite
+	res, err = cl.PinWithResult(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != api.PinActionOverwritten || res.Pin.Name != "" {
+		t.Error("expected the pin to be overwritten")
+	}
+}
+
+func TestClusterPinOrigin(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	origin := api.APIOrigin("admin", "127.0.0.1:1234")
+	_, err := cl.pinWithResult(origin, api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, ev := range cl.events.Since(time.Time{}) {
+		if ev.Type != api.EventPin {
+			continue
+		}
+		found = true
+		if ev.Origin != string(origin) {
+			t.Error("the pin event should carry the origin of the request")
+		}
+	}
+	if !found {
+		t.Fatal("expected a pin event")
+	}
+
+	pin, ok := cl.getCurrentPin(c)
+	if !ok {
+		t.Fatal("expected the pin in the state")
+	}
+	if pin.Origin != origin {
+		t.Error("the pin in the state should carry the origin of the request")
+	}
+}
+
+func TestClusterSetListenAddr(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	before := len(cl.host.Network().ListenAddresses())
+	addr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+	if err := cl.SetListenAddr(addr); err != nil {
+		t.Fatal(err)
+	}
+	if len(cl.host.Network().ListenAddresses()) != before+1 {
+		t.Error("the peer should listen on the new address")
+	}
+}
+
+func TestClusterLogUnsignedMetric(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	m := api.Metric{Name: "gpu", Peer: cl.id, Value: "1", Valid: true}
+	m.SetTTL(30)
+
+	cl.enabledFeaturesMux.Lock()
+	cl.enabledFeatures[api.FeatureSignedMetrics] = false
+	cl.enabledFeaturesMux.Unlock()
+	if err := cl.logMetric(m); err != nil {
+		t.Error("unsigned metrics should be accepted until all peers sign:", err)
+	}
+
+	signed := m
+	if err := signed.Sign(cl.host.Peerstore().PrivKey(cl.id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.logMetric(signed); err != nil {
+		t.Fatal(err)
+	}
+
+	cl.updateFeatures()
+	if err := cl.logMetric(m); err == nil {
+		t.Error("unsigned metrics should be rejected once all peers sign")
+	}
+}
+
+func TestClusterStatusEvents(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	if err := cl.Pin(api.PinCid(c)); err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	for _, ev := range cl.events.Since(time.Time{}) {
+		if ev.Type == api.EventPinned && ev.Cid == test.TestCid1 {
+			return
+		}
+	}
+	t.Error("the pinned status change should be recorded")
+}
+
+func TestClusterPushMetric(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	ping := api.Metric{Name: "ping", Value: "ok"}
+	ping.SetTTL(30)
+	if cl.PushMetric(ping) == nil {
+		t.Error("ping metrics should not be pushed")
+	}
+
+	expired := api.Metric{Name: "gpu", Value: "1"}
+	if cl.PushMetric(expired) == nil {
+		t.Error("expired metrics should not be pushed")
+	}
+
+	m := api.Metric{Name: "gpu", Value: "4"}
+	m.SetTTL(30)
+	err := cl.PushMetric(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		metrics := cl.monitor.LastMetrics("gpu")
+		if len(metrics) == 1 {
+			if metrics[0].Peer != cl.id || metrics[0].Value != "4" {
+				t.Error("unexpected pushed metric")
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Error("the pushed metric should have reached the monitor")
+}
+
+func TestClusterStrayPins(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	err := cl.Pin(api.PinCid(c1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipfs.Pins = map[string]api.IPFSPinStatus{
+		test.TestCid1: api.IPFSPinStatusRecursive,
+		test.TestCid2: api.IPFSPinStatusRecursive,
+	}
+
+	strays, err := cl.StrayPinsLocal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strays) != 1 || strays[0].Cid != test.TestCid2 || strays[0].Tracked {
+		t.Fatal("expected TestCid2 to be an untracked stray pin")
+	}
+
+	err = cl.RemediateStrayPinLocal(c1, api.StrayPinRemove)
+	if err == nil {
+		t.Error("allocated items should not be removed")
+	}
+
+	err = cl.RemediateStrayPinLocal(c2, api.StrayPinIgnore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strays, _ = cl.StrayPinsLocal()
+	if len(strays) != 1 || !strays[0].Ignored {
+		t.Error("expected TestCid2 to be ignored")
+	}
+
+	err = cl.RemediateStrayPinLocal(c2, api.StrayPinAdopt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strays, _ = cl.StrayPinsLocal()
+	if len(strays) != 0 {
+		t.Error("adopted items should not be stray")
+	}
+}
+
+func TestClusterPinHistory(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	pinDelay()
+
+	history, err := cl.PinHistory(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatal("expected one attempt")
+	}
+	if history[0].Operation != "pin" || history[0].Error != "" {
+		t.Error("expected a successful pin attempt")
+	}
+	if history[0].Peername != cl.config.Peername {
+		t.Error("the attempt should carry the peer name")
+	}
+}
+
+func TestClusterAllocationHistory(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.PinCid(c))
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	pinDelay()
+
+	// same allocations: nothing recorded
+	err = cl.Pin(api.Pin{Cid: c, Name: "a"})
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	pinDelay()
+
+	history, err := cl.AllocationHistory(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatal("expected one allocation change")
+	}
+	if history[0].Reason != api.AllocationInitial || len(history[0].To) != 0 {
+		t.Error("expected an initial allocation everywhere")
+	}
+	if history[0].Peername != cl.config.Peername {
+		t.Error("the change should carry the peer name")
+	}
+}
+
+func TestClusterRaftHealth(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	health, err := cl.RaftHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Leader != cl.id.Pretty() || health.Peername != cl.config.Peername {
+		t.Error("unexpected raft health: ", health)
+	}
+
+	found := false
+	for _, o := range cl.Observations() {
+		if o.Name == "ipfscluster_raft_term" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected raft observations")
+	}
+}
+
+func TestClusterPinQueue(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	h, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.PinCid(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	queue, err := cl.PinQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Peer != cl.id.Pretty() || queue.PinsDone != 1 || len(queue.Operations) != 0 {
+		t.Errorf("unexpected pin queue: %+v", queue)
+	}
+
+	found := false
+	for _, o := range cl.Observations() {
+		if o.Name == "ipfscluster_pins_done_total" && o.Value == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected pin queue observations")
+	}
+}
+
+func TestClusterMultiRPCConcurrency(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	cl.broadcastSem = make(chan struct{}, 1)
+	dests := []peer.ID{cl.id, cl.id, cl.id}
+	ids := make([]api.IDSerial, len(dests), len(dests))
+	errs := cl.multiRPC(dests, "Cluster", "ID", struct{}{}, copyIDSerialsToIfaces(ids))
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range ids {
+		if id.ID != peer.IDB58Encode(cl.id) {
+			t.Error("expected every request to be answered")
+		}
+	}
+	if len(cl.broadcastSem) != 0 {
+		t.Error("all the broadcast slots should have been released")
+	}
+
+	found := false
+	for _, o := range cl.Observations() {
+		if o.Name == "ipfscluster_broadcast_concurrency" && o.Value == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected broadcast observations")
+	}
+}
+
+func TestMergePins(t *testing.T) {
+	prev := api.Pin{
+		Name:                 "prev",
+		ReplicationFactorMin: 2,
+		ReplicationFactorMax: 3,
+		ExcludePeers:         []peer.ID{test.TestPeerID1},
+	}
+
+	merged := mergePins(prev, api.Pin{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 4,
+		ExcludePeers:         []peer.ID{test.TestPeerID1, test.TestPeerID2},
+	})
+	if merged.ReplicationFactorMin != 2 || merged.ReplicationFactorMax != 4 {
+		t.Error("the highest replication factors should be kept")
+	}
+	if merged.Name != "prev" {
+		t.Error("the previous name should be kept when none is given")
+	}
+	if len(merged.ExcludePeers) != 2 {
+		t.Error("excluded peers should be combined")
+	}
+
+	prev.AllowPeers = []peer.ID{test.TestPeerID2}
+	merged = mergePins(prev, api.Pin{})
+	if len(merged.AllowPeers) != 1 || merged.AllowPeers[0] != test.TestPeerID2 {
+		t.Error("the previous allowed peers should be kept when none are given")
+	}
+
+	merged = mergePins(prev, api.Pin{AllowPeers: []peer.ID{test.TestPeerID3}})
+	if len(merged.AllowPeers) != 1 || merged.AllowPeers[0] != test.TestPeerID3 {
+		t.Error("the new allowed peers should replace the previous ones")
+	}
+
+	merged = mergePins(prev, api.Pin{
+		ReplicationFactorMin: -1,
+		ReplicationFactorMax: -1,
+	})
+	if merged.ReplicationFactorMin != -1 || merged.ReplicationFactorMax != -1 {
+		t.Error("pinning everywhere should win")
+	}
+
+	prev.Priority = api.PinPriorityHigh
+	merged = mergePins(prev, api.Pin{})
+	if merged.Priority != api.PinPriorityHigh {
+		t.Error("the high priority should be kept")
+	}
+
+	soon := time.Now().Add(time.Hour)
+	later := soon.Add(time.Hour)
+	prev.ExpireAt = later
+	merged = mergePins(prev, api.Pin{ExpireAt: soon})
+	if !merged.ExpireAt.Equal(later) {
+		t.Error("the latest expiration should be kept")
+	}
+	merged = mergePins(prev, api.Pin{})
+	if !merged.ExpireAt.IsZero() {
+		t.Error("the pin should not expire when the new one does not")
+	}
+
+	prev.Metadata = map[string]string{"owner": "alice", "team": "a"}
+	merged = mergePins(prev, api.Pin{Metadata: map[string]string{"team": "b"}})
+	if merged.Metadata["owner"] != "alice" || merged.Metadata["team"] != "b" {
+		t.Error("the metadata should be merged:", merged.Metadata)
+	}
+
+	prev.Recursive = true
+	prev.MaxDepth = 2
+	merged = mergePins(prev, api.Pin{Recursive: true, MaxDepth: 1})
+	if !merged.Recursive || merged.MaxDepth != 2 {
+		t.Error("the deepest pin should be kept:", merged.MaxDepth)
+	}
+	merged = mergePins(prev, api.Pin{Recursive: true})
+	if merged.MaxDepth != 0 {
+		t.Error("a fully recursive pin should remove the max depth:", merged.MaxDepth)
+	}
+	merged = mergePins(prev, api.Pin{})
+	if !merged.Recursive || merged.MaxDepth != 2 {
+		t.Error("a direct pin should keep the max depth:", merged.MaxDepth)
+	}
+}
+
 func TestClusterPins(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
@@ -306,6 +866,35 @@ func TestClusterPeers(t *testing.T) {
 	}
 }
 
+func TestClusterAnnotatePeer(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	err := cl.AnnotatePeer(cl.id, "host: rack 12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := cl.ID().Annotation; a != "host: rack 12" {
+		t.Errorf("unexpected annotation: %s", a)
+	}
+	if a := cl.Peers()[0].Annotation; a != "host: rack 12" {
+		t.Errorf("peers should include the annotation: %s", a)
+	}
+
+	err = cl.AnnotatePeer(cl.id, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := cl.ID().Annotation; a != "" {
+		t.Errorf("the annotation should have been removed: %s", a)
+	}
+	// removing it again is not an error
+	if err := cl.AnnotatePeer(cl.id, ""); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestVersion(t *testing.T) {
 	cl, _, _, _, _ := testingCluster(t)
 	defer cleanRaft()
@@ -339,3 +928,108 @@ func TestClusterRecoverAllLocal(t *testing.T) {
 		t.Error("the pin should have been recovered")
 	}
 }
+
+type mockMultiInformer struct {
+	test.MockInformer
+}
+
+func (inf *mockMultiInformer) MetricNames() []string {
+	return []string{"multi1", "multi2"}
+}
+
+func (inf *mockMultiInformer) GetMetrics() []api.Metric {
+	return []api.Metric{
+		{Name: "multi1", Value: "1", Valid: true},
+		{Name: "multi2", Value: "2", Valid: true},
+	}
+}
+
+func TestInformerMetrics(t *testing.T) {
+	numpinCfg := &numpin.Config{}
+	numpinCfg.Default()
+	inf, _ := numpin.NewInformer(numpinCfg)
+	multi := &mockMultiInformer{*test.NewMockInformer("multi", "0")}
+
+	if metrics := informerMetrics(inf); len(metrics) != 1 || metrics[0].Name != inf.Name() {
+		t.Error("expected the metric of a single-metric informer")
+	}
+	if metrics := informerMetrics(multi); len(metrics) != 2 || metrics[1].Name != "multi2" {
+		t.Error("expected all the metrics of a multi-metric informer")
+	}
+
+	c := &Cluster{informers: []Informer{inf, multi}}
+	names := c.producedMetrics()
+	expected := []string{"ping", pinCapacityMetricName, inf.Name(), "multi1", "multi2"}
+	if len(names) != len(expected) {
+		t.Fatal("unexpected produced metrics: ", names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Error("unexpected produced metrics: ", names)
+		}
+	}
+}
+
+func TestClusterPausePins(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	cl.PausePinsLocal()
+	if err := cl.Pin(api.PinCid(c)); err != errPinsPaused {
+		t.Error("expected pins to be paused: ", err)
+	}
+	if err := cl.Unpin(c); err != errPinsPaused {
+		t.Error("expected unpins to be paused: ", err)
+	}
+
+	cl.ResumePinsLocal()
+	if err := cl.Pin(api.PinCid(c)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClusterShutdownAll(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	err := cl.ShutdownAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cl.pinsPaused() {
+		t.Error("pins should be paused")
+	}
+
+	select {
+	case <-cl.Done():
+	case <-time.After(ShutdownDelay + 10*time.Second):
+		t.Fatal("the peer should have shut down")
+	}
+}
+
+func TestClusterPinOverwrite(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	cl.config.PinMergePolicy = PinMergeMerge
+
+	pin := api.PinCid(c)
+	pin.Name = "a"
+	_, err := cl.PinWithResult(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cl.PinOverwrite(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != api.PinActionOverwritten || res.Pin.Name != "" {
+		t.Error("expected the pin to be overwritten regardless of the merge policy")
+	}
+}
@@ -72,7 +72,8 @@ var testingTrackerCfg = []byte(`
 `)
 
 var testingMonCfg = []byte(`{
-    "check_interval": "300ms"
+    "check_interval": "300ms",
+    "re_alert_interval": "300ms"
 }`)
 
 var testingDiskInfCfg = []byte(`{
@@ -0,0 +1,205 @@
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/config"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+)
+
+var configKey = "crdt"
+
+// Configuration defaults
+var (
+	DefaultDataSubFolder      = "crdt-data"
+	DefaultSyncInterval       = time.Minute
+	DefaultSyncFanout         = 3
+	DefaultNetworkTimeout     = 10 * time.Second
+	DefaultTombstoneRetention = 7 * 24 * time.Hour
+)
+
+// Config allows to configure the CRDT Consensus component for
+// ipfs-cluster.
+type Config struct {
+	config.Saver
+
+	// will shutdown libp2p host on shutdown. Useful for testing
+	hostShutdown bool
+
+	// Namespace is inserted in the ProtocolID so that several clusters
+	// can share the same libp2p network. It is not saved: peers set it
+	// to the namespace of the cluster.
+	Namespace string
+
+	// A folder to store the updates received by this peer.
+	DataFolder string
+
+	// SyncInterval specifies how often the updates are pulled from
+	// other peers, in order to obtain those which were missed.
+	SyncInterval time.Duration
+
+	// SyncFanout specifies from how many random peers the updates are
+	// pulled on every SyncInterval.
+	SyncFanout int
+
+	// NetworkTimeout specifies how long before a request to another
+	// peer is timed out.
+	NetworkTimeout time.Duration
+
+	// TombstoneRetention specifies how long the removals of pins, KV
+	// records and peers are remembered. They prevent older updates
+	// from adding the removed items back, so it should be longer than
+	// the time peers may stay offline.
+	TombstoneRetention time.Duration
+
+	// TrustedPeers, when not empty, are the only peers which can
+	// modify the shared state. Their updates must be signed, and the
+	// updates of any other peer are ignored. The other peers are
+	// followers: they replicate the shared state and pin content, but
+	// cannot pin, unpin or modify the peerset, other than adding
+	// themselves to it. It is not supported by the raft consensus.
+	TrustedPeers []peer.ID
+}
+
+type jsonConfig struct {
+	DataFolder     string   `json:"data_folder,omitempty"`
+	SyncInterval   string   `json:"sync_interval"`
+	SyncFanout     int      `json:"sync_fanout"`
+	NetworkTimeout string   `json:"network_timeout"`
+	TrustedPeers   []string `json:"trusted_peers,omitempty"`
+
+	TombstoneRetention string `json:"tombstone_retention,omitempty"`
+}
+
+// ConfigKey returns a human-friendly indentifier for this Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Validate checks that this configuration has working values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	if cfg.SyncInterval <= 0 {
+		return errors.New("crdt.sync_interval is invalid")
+	}
+
+	if cfg.SyncFanout <= 0 {
+		return errors.New("crdt.sync_fanout is invalid")
+	}
+
+	if cfg.NetworkTimeout <= 0 {
+		return errors.New("crdt.network_timeout is invalid")
+	}
+
+	if cfg.TombstoneRetention <= 0 {
+		return errors.New("crdt.tombstone_retention is invalid")
+	}
+	return nil
+}
+
+// LoadJSON parses a json-encoded configuration (see jsonConfig).
+// The Config will have default values for all fields not explicited
+// in the given json object.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling crdt config")
+		return err
+	}
+
+	cfg.Default()
+
+	parseDuration := func(txt string) time.Duration {
+		d, _ := time.ParseDuration(txt)
+		if txt != "" && d == 0 {
+			logger.Warningf("%s is not a valid duration. Default will be used", txt)
+		}
+		return d
+	}
+
+	syncInterval := parseDuration(jcfg.SyncInterval)
+	networkTimeout := parseDuration(jcfg.NetworkTimeout)
+	tombstoneRetention := parseDuration(jcfg.TombstoneRetention)
+
+	config.SetIfNotDefault(jcfg.DataFolder, &cfg.DataFolder)
+	config.SetIfNotDefault(syncInterval, &cfg.SyncInterval)
+	config.SetIfNotDefault(jcfg.SyncFanout, &cfg.SyncFanout)
+	config.SetIfNotDefault(networkTimeout, &cfg.NetworkTimeout)
+	config.SetIfNotDefault(tombstoneRetention, &cfg.TombstoneRetention)
+
+	for _, pstr := range jcfg.TrustedPeers {
+		pid, err := peer.IDB58Decode(pstr)
+		if err != nil {
+			return fmt.Errorf("error decoding trusted peer %s: %s", pstr, err)
+		}
+		cfg.TrustedPeers = append(cfg.TrustedPeers, pid)
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON returns the pretty JSON representation of a Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{
+		DataFolder:     cfg.DataFolder,
+		SyncInterval:   cfg.SyncInterval.String(),
+		SyncFanout:     cfg.SyncFanout,
+		NetworkTimeout: cfg.NetworkTimeout.String(),
+		TrustedPeers:   api.PeersToStrings(cfg.TrustedPeers),
+
+		TombstoneRetention: cfg.TombstoneRetention.String(),
+	}
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+// Default initializes this configuration with working defaults.
+func (cfg *Config) Default() error {
+	cfg.DataFolder = "" // empty so it gets omitted
+	cfg.SyncInterval = DefaultSyncInterval
+	cfg.SyncFanout = DefaultSyncFanout
+	cfg.NetworkTimeout = DefaultNetworkTimeout
+	cfg.TombstoneRetention = DefaultTombstoneRetention
+	cfg.TrustedPeers = nil
+	return nil
+}
+
+// GetProtocolID returns the ProtocolID with the Namespace, when set,
+// inserted after the "/ipfscluster" prefix.
+func (cfg *Config) GetProtocolID() protocol.ID {
+	if cfg.Namespace == "" {
+		return ProtocolID
+	}
+	return protocol.ID("/ipfscluster/" + cfg.Namespace + strings.TrimPrefix(string(ProtocolID), "/ipfscluster"))
+}
+
+// IsTrusted returns whether the given peer can modify the shared state:
+// it is one of the TrustedPeers, or there are no TrustedPeers.
+func (cfg *Config) IsTrusted(p peer.ID) bool {
+	if len(cfg.TrustedPeers) == 0 {
+		return true
+	}
+	for _, tp := range cfg.TrustedPeers {
+		if tp == p {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDataFolder returns the data folder that we are using.
+func (cfg *Config) GetDataFolder() string {
+	if cfg.DataFolder == "" {
+		return filepath.Join(cfg.BaseDir, DefaultDataSubFolder)
+	}
+	return cfg.DataFolder
+}
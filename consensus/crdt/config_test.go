@@ -0,0 +1,113 @@
+package crdt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+var cfgJSON = []byte(`
+{
+    "sync_interval": "30s",
+    "sync_fanout": 5,
+    "network_timeout": "5s",
+    "tombstone_retention": "24h",
+    "trusted_peers": ["QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc"]
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SyncInterval != 30*time.Second ||
+		cfg.SyncFanout != 5 ||
+		cfg.NetworkTimeout != 5*time.Second ||
+		cfg.TombstoneRetention != 24*time.Hour ||
+		len(cfg.TrustedPeers) != 1 {
+		t.Error("the configuration was not loaded")
+	}
+
+	if !cfg.IsTrusted(test.TestPeerID1) || cfg.IsTrusted(test.TestPeerID2) {
+		t.Error("only the trusted peers should be trusted")
+	}
+
+	err = cfg.LoadJSON([]byte(`{"trusted_peers": ["abc"]}`))
+	if err == nil {
+		t.Error("expected an error decoding the trusted peers")
+	}
+
+	err = cfg.LoadJSON([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SyncInterval != DefaultSyncInterval {
+		t.Error("expected the default sync_interval")
+	}
+	if !cfg.IsTrusted(test.TestPeerID2) {
+		t.Error("all peers should be trusted without trusted_peers")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SyncFanout != 5 {
+		t.Error("the configuration was not preserved")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.SyncInterval = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.SyncFanout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.NetworkTimeout = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.TombstoneRetention = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestGetProtocolID(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.GetProtocolID() != ProtocolID {
+		t.Error("the protocol should not change without namespace")
+	}
+	cfg.Namespace = "mycluster"
+	if cfg.GetProtocolID() != "/ipfscluster/mycluster/crdt/0.2.0" {
+		t.Error("unexpected protocol: ", cfg.GetProtocolID())
+	}
+}
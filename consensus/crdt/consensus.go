@@ -0,0 +1,802 @@
+// Package crdt implements a Consensus component for IPFS Cluster which
+// needs neither a leader nor a stable peerset, so that clusters can grow
+// to many peers which come and go.
+//
+// The shared state is made of last-writer-wins registers (see Delta).
+// Updates are applied locally and sent to all the known peers, which can
+// apply them in any order and reach the same state. Peers which miss
+// updates get them by regularly pulling, from some random peers, the
+// updates which those applied since the last pull. The peerset is itself
+// part of the shared state. Removals are forgotten after the
+// TombstoneRetention.
+//
+// When TrustedPeers are configured, only they can modify the shared
+// state. Their updates are signed and the updates from any other origin
+// are ignored, so that untrusted peers can safely help replicating the
+// content as followers. Followers can only add themselves to the
+// peerset, so that content is allocated to them, and never lead.
+//
+// There is no real leader, as updates need no ordering. Cluster only
+// uses the leader to run some periodic checks on the shared state, and
+// any trusted peer can run them, so the leader is simply the trusted
+// peer with the lowest ID among the known peers which this peer is
+// connected to. This
+// needs no coordination, and all the connected peers agree on it. When
+// the connectivity changes, peers may disagree for a while, so that the
+// checks run twice or are skipped during that time, which they
+// tolerate.
+package crdt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+)
+
+var logger = logging.Logger("crdt")
+
+// ProtocolID is the libp2p protocol used by the peers to exchange
+// updates.
+var ProtocolID = protocol.ID("/ipfscluster/crdt/0.2.0")
+
+// saveInterval specifies how often the updates are written to the
+// DataFolder when they have changed.
+var saveInterval = 5 * time.Second
+
+const deltasFile = "deltas.json"
+
+// ErrNotTrusted is returned when a peer which is not one of the
+// TrustedPeers tries to modify the shared state.
+var ErrNotTrusted = errors.New("this peer is a follower: only trusted peers can modify the shared state")
+
+// Consensus handles the work of keeping a shared-state between
+// the peers of an IPFS Cluster, as well as modifying that state and
+// applying any updates in a thread-safe manner.
+type Consensus struct {
+	ctx    context.Context
+	cancel func()
+	config *Config
+
+	host      host.Host
+	rpcServer *rpc.Server
+	rpcClient *rpc.Client
+
+	// clusterRPC is used to contact the local Cluster.
+	clusterRPC *rpc.Client
+	rpcReady   chan struct{}
+	readyCh    chan struct{}
+	syncedCh   chan struct{}
+
+	mu     sync.Mutex
+	state  state.State
+	deltas map[string]Delta
+	clock  uint64
+	dirty  bool
+
+	// seq numbers the updates in the order this peer applied them,
+	// within an epoch which changes on every start, so that other
+	// peers can pull only the updates they have not seen (see
+	// deltasSince).
+	epoch string
+	seq   uint64
+	seqs  map[string]uint64
+	// heads are the epoch and the seq of the last pull from every
+	// peer.
+	heads map[peer.ID]DeltasResponse
+	// tombstones are the times at which the removals were applied.
+	tombstones map[string]time.Time
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+}
+
+// NewConsensus builds a new CRDT Consensus component. The updates saved
+// in the DataFolder are loaded into the given state.
+func NewConsensus(host host.Host, cfg *Config, st state.State) (*Consensus, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cc := newOfflineConsensus(cfg, st)
+	cc.ctx = ctx
+	cc.cancel = cancel
+	cc.host = host
+	cc.epoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+	cc.rpcReady = make(chan struct{}, 1)
+	cc.readyCh = make(chan struct{}, 1)
+	cc.syncedCh = make(chan struct{})
+
+	err = cc.load()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// make ourselves known, unless we were removed
+	me := peer.IDB58Encode(host.ID())
+	_, known := cc.deltas[Delta{Type: DeltaAddPeer, Peer: me}.key()]
+	if !known {
+		d := cc.newDelta(DeltaAddPeer)
+		d.Peer = me
+		cc.sign(&d)
+		cc.apply(d, false)
+	}
+
+	cc.rpcServer = rpc.NewServer(host, cfg.GetProtocolID())
+	err = cc.rpcServer.RegisterName("CRDT", &rpcService{cc})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	cc.rpcClient = rpc.NewClientWithServer(host, cfg.GetProtocolID(), cc.rpcServer)
+
+	go cc.finishBootstrap()
+	return cc, nil
+}
+
+// finishBootstrap pulls the updates from the peers we are connected to
+// and signals that the component is ready.
+func (cc *Consensus) finishBootstrap() {
+	select {
+	case <-cc.ctx.Done():
+		return
+	case <-cc.rpcReady:
+	}
+
+	peers := cc.connectedPeers()
+	cc.sync(peers)
+	cc.announce(peers)
+	close(cc.syncedCh)
+	logger.Debug("consensus ready")
+	cc.readyCh <- struct{}{}
+
+	go cc.syncLoop()
+	go cc.saveLoop()
+}
+
+// Shutdown stops the component so it will not process any
+// more updates.
+func (cc *Consensus) Shutdown() error {
+	cc.shutdownLock.Lock()
+	defer cc.shutdownLock.Unlock()
+
+	if cc.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping Consensus component")
+	cc.cancel()
+	cc.host.RemoveStreamHandler(cc.config.GetProtocolID())
+	if err := cc.save(); err != nil {
+		logger.Error(err)
+	}
+
+	if cc.config.hostShutdown {
+		cc.host.Close()
+	}
+
+	cc.shutdown = true
+	close(cc.rpcReady)
+	return nil
+}
+
+// SetClient makes the component ready to perform RPC requets
+func (cc *Consensus) SetClient(c *rpc.Client) {
+	cc.clusterRPC = c
+	cc.rpcReady <- struct{}{}
+}
+
+// Ready returns a channel which is signaled when the Consensus
+// has pulled the updates from the connected peers and is ready to use.
+func (cc *Consensus) Ready() <-chan struct{} {
+	return cc.readyCh
+}
+
+// LogPin submits a Cid to the shared state of the cluster.
+func (cc *Consensus) LogPin(pin api.Pin) error {
+	d := cc.newDelta(DeltaPin)
+	d.Pin = pin.ToSerial()
+	return cc.commit(d)
+}
+
+// LogUnpin removes a Cid from the shared state of the cluster.
+func (cc *Consensus) LogUnpin(pin api.Pin) error {
+	d := cc.newDelta(DeltaUnpin)
+	d.Pin = pin.ToSerial()
+	return cc.commit(d)
+}
+
+// LogSetKV stores a KV record in the shared state of the cluster.
+func (cc *Consensus) LogSetKV(kv api.KV) error {
+	d := cc.newDelta(DeltaSetKV)
+	d.KV = kv
+	return cc.commit(d)
+}
+
+// LogRmKV removes a KV record from the shared state of the cluster.
+func (cc *Consensus) LogRmKV(key string) error {
+	d := cc.newDelta(DeltaRmKV)
+	d.KV = api.KV{Key: key}
+	return cc.commit(d)
+}
+
+// AddPeer adds a new peer to the peerset.
+func (cc *Consensus) AddPeer(pid peer.ID) error {
+	d := cc.newDelta(DeltaAddPeer)
+	d.Peer = peer.IDB58Encode(pid)
+	return cc.commit(d)
+}
+
+// RmPeer removes a peer from the peerset.
+func (cc *Consensus) RmPeer(pid peer.ID) error {
+	d := cc.newDelta(DeltaRmPeer)
+	d.Peer = peer.IDB58Encode(pid)
+	return cc.commit(d)
+}
+
+// State returns the current shared state.
+func (cc *Consensus) State() (state.State, error) {
+	return cc.state, nil
+}
+
+// Leader returns the trusted peer with the lowest ID among the peers in
+// the peerset which this peer is connected to, including itself. See the
+// package documentation.
+func (cc *Consensus) Leader() (peer.ID, error) {
+	peers, err := cc.Peers()
+	if err != nil {
+		return "", err
+	}
+	for _, p := range peers {
+		if !cc.config.IsTrusted(p) {
+			continue
+		}
+		if p == cc.host.ID() || cc.host.Network().Connectedness(p) == inet.Connected {
+			return p, nil
+		}
+	}
+	return "", errors.New("no trusted peer is reachable")
+}
+
+// IsTrusted returns whether the given peer can modify the shared state.
+func (cc *Consensus) IsTrusted(p peer.ID) bool {
+	return cc.config.IsTrusted(p)
+}
+
+// WaitForSync pulls the updates from the peers this peer is connected to,
+// and announces this peer to them.
+func (cc *Consensus) WaitForSync() error {
+	select {
+	case <-cc.ctx.Done():
+		return errors.New("consensus component is shutdown")
+	case <-cc.syncedCh:
+	}
+	peers := cc.connectedPeers()
+	cc.sync(peers)
+	cc.announce(peers)
+	return nil
+}
+
+// Clean removes all the saved updates. It can only be called when the
+// component is shutdown.
+func (cc *Consensus) Clean() error {
+	cc.shutdownLock.Lock()
+	defer cc.shutdownLock.Unlock()
+	if !cc.shutdown {
+		return errors.New("consensus component is not shutdown")
+	}
+	logger.Infof("cleaning CRDT data folder (%s)", cc.config.GetDataFolder())
+	return os.RemoveAll(cc.config.GetDataFolder())
+}
+
+// Peers returns the current peerset, sorted.
+func (cc *Consensus) Peers() ([]peer.ID, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	var peers []peer.ID
+	for _, d := range cc.deltas {
+		if d.Type != DeltaAddPeer {
+			continue
+		}
+		pid, err := peer.IDB58Decode(d.Peer)
+		if err != nil {
+			continue
+		}
+		peers = append(peers, pid)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i] < peers[j] })
+	return peers, nil
+}
+
+// newDelta returns a Delta of the given type made by this peer, with
+// a clock higher than any seen so far.
+func (cc *Consensus) newDelta(t DeltaType) Delta {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.clock++
+	return Delta{
+		Type:   t,
+		Clock:  cc.clock,
+		Origin: peer.IDB58Encode(cc.host.ID()),
+	}
+}
+
+// commit applies an update made by this peer and sends it to the
+// other peers. Followers cannot make updates.
+func (cc *Consensus) commit(d Delta) error {
+	if !cc.config.IsTrusted(cc.host.ID()) {
+		return ErrNotTrusted
+	}
+	if err := cc.sign(&d); err != nil {
+		return err
+	}
+	cc.apply(d, true)
+
+	peers, _ := cc.Peers()
+	go cc.broadcast(peers, []Delta{d})
+	return nil
+}
+
+// sign signs an update made by this peer with its private key. Updates
+// are left unsigned when the key is not available.
+func (cc *Consensus) sign(d *Delta) error {
+	key := cc.host.Peerstore().PrivKey(cc.host.ID())
+	if key == nil {
+		return nil
+	}
+	return d.sign(key)
+}
+
+// trusted returns the updates which can be applied: those made by the
+// TrustedPeers and the announcements of any peer, with a valid
+// signature, or all of them when there are no TrustedPeers.
+func (cc *Consensus) trusted(deltas []Delta) []Delta {
+	if len(cc.config.TrustedPeers) == 0 {
+		return deltas
+	}
+
+	valid := make([]Delta, 0, len(deltas))
+	for _, d := range deltas {
+		origin, err := peer.IDB58Decode(d.Origin)
+		if err != nil || !(cc.config.IsTrusted(origin) || d.announcement()) {
+			logger.Debugf("ignoring update from untrusted peer %s", d.Origin)
+			continue
+		}
+		pubKey, err := cc.pubKey(origin, d)
+		if err != nil {
+			logger.Debugf("ignoring update from %s: %s", d.Origin, err)
+			continue
+		}
+		if err := d.verify(pubKey); err != nil {
+			logger.Warningf("ignoring update: %s", err)
+			continue
+		}
+		valid = append(valid, d)
+	}
+	return valid
+}
+
+// pubKey returns the public key of the origin of an update, from the
+// peerstore or, for peers which this peer never connected to, from the
+// update itself. verify checks that it matches the origin.
+func (cc *Consensus) pubKey(origin peer.ID, d Delta) (crypto.PubKey, error) {
+	if pubKey := cc.host.Peerstore().PubKey(origin); pubKey != nil {
+		return pubKey, nil
+	}
+	if len(d.PubKey) == 0 {
+		return nil, errors.New("unknown public key")
+	}
+	return crypto.UnmarshalPublicKey(d.PubKey)
+}
+
+// apply applies an update to the state unless a newer one was already
+// applied. When notify is set, the PinTracker is asked to track or
+// untrack the item. It returns whether the update was applied.
+func (cc *Consensus) apply(d Delta, notify bool) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	key := d.key()
+	if prev, ok := cc.deltas[key]; ok && !d.newer(prev) {
+		return false
+	}
+	cc.deltas[key] = d
+	if d.Clock > cc.clock {
+		cc.clock = d.Clock
+	}
+	cc.dirty = true
+	cc.seq++
+	cc.seqs[key] = cc.seq
+	if d.removal() {
+		cc.tombstones[key] = time.Now()
+	} else {
+		delete(cc.tombstones, key)
+	}
+
+	var err error
+	var method string
+	switch d.Type {
+	case DeltaPin:
+		err = cc.state.Add(d.Pin.ToPin())
+		method = "Track"
+	case DeltaUnpin:
+		pin := d.Pin.ToPin()
+		if cc.state.Has(pin.Cid) {
+			err = cc.state.Rm(pin.Cid)
+		}
+		method = "Untrack"
+	case DeltaSetKV:
+		err = cc.state.SetKV(d.KV)
+	case DeltaRmKV:
+		if _, ok := cc.state.GetKV(d.KV.Key); ok {
+			err = cc.state.RmKV(d.KV.Key)
+		}
+	}
+	if err != nil {
+		logger.Errorf("error applying update to the state: %s", err)
+		return true
+	}
+
+	if notify && method != "" && cc.clusterRPC != nil {
+		// Async, we let the PinTracker take care of any problems
+		cc.clusterRPC.Go("",
+			"Cluster",
+			method,
+			d.Pin,
+			&struct{}{},
+			nil)
+	}
+	return true
+}
+
+// announce sends the update adding this peer to the peerset to the
+// given peers, so that the peers which do not pull from this one, like
+// the trusted peers of a follower, learn about it.
+func (cc *Consensus) announce(peers []peer.ID) {
+	cc.mu.Lock()
+	d, ok := cc.deltas[Delta{Type: DeltaAddPeer, Peer: peer.IDB58Encode(cc.host.ID())}.key()]
+	cc.mu.Unlock()
+	if ok && d.Type == DeltaAddPeer {
+		cc.broadcast(peers, []Delta{d})
+	}
+}
+
+// broadcast sends updates to the given peers, except this one.
+func (cc *Consensus) broadcast(peers []peer.ID, deltas []Delta) {
+	for _, p := range peers {
+		if p == cc.host.ID() {
+			continue
+		}
+		go func(p peer.ID) {
+			ctx, cancel := context.WithTimeout(cc.ctx, cc.config.NetworkTimeout)
+			defer cancel()
+			err := cc.rpcClient.CallContext(ctx, p, "CRDT", "Apply", deltas, &struct{}{})
+			if err != nil {
+				logger.Debugf("error sending updates to %s: %s", p.Pretty(), err)
+			}
+		}(p)
+	}
+}
+
+// sync pulls the updates from the given peers and applies them. Only
+// the updates which a peer applied since the previous pull are sent.
+func (cc *Consensus) sync(peers []peer.ID) {
+	var wg sync.WaitGroup
+	for _, p := range peers {
+		if p == cc.host.ID() {
+			continue
+		}
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(cc.ctx, cc.config.NetworkTimeout)
+			defer cancel()
+			cc.mu.Lock()
+			head := cc.heads[p]
+			cc.mu.Unlock()
+
+			var resp DeltasResponse
+			req := DeltasRequest{Epoch: head.Epoch, Since: head.Head}
+			err := cc.rpcClient.CallContext(ctx, p, "CRDT", "Deltas", req, &resp)
+			if err != nil {
+				logger.Debugf("error pulling updates from %s: %s", p.Pretty(), err)
+				return
+			}
+			cc.applyAll(cc.trusted(resp.Deltas), true)
+
+			cc.mu.Lock()
+			cc.heads[p] = DeltasResponse{Epoch: resp.Epoch, Head: resp.Head}
+			cc.mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+}
+
+// applyAll applies the updates in clock order and returns how many were
+// applied.
+func (cc *Consensus) applyAll(deltas []Delta, notify bool) int {
+	sort.Slice(deltas, func(i, j int) bool { return deltas[j].newer(deltas[i]) })
+	applied := 0
+	for _, d := range deltas {
+		if cc.apply(d, notify) {
+			applied++
+		}
+	}
+	return applied
+}
+
+// deltasSince returns the updates applied after the given seq, or all
+// of them when the epoch is not the current one.
+func (cc *Consensus) deltasSince(epoch string, since uint64) DeltasResponse {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if epoch != cc.epoch {
+		since = 0
+	}
+	resp := DeltasResponse{
+		Epoch:  cc.epoch,
+		Head:   cc.seq,
+		Deltas: []Delta{},
+	}
+	for key, d := range cc.deltas {
+		if cc.seqs[key] > since {
+			resp.Deltas = append(resp.Deltas, d)
+		}
+	}
+	return resp
+}
+
+// pruneTombstones forgets the removals applied longer than the
+// TombstoneRetention ago.
+func (cc *Consensus) pruneTombstones() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for key, t := range cc.tombstones {
+		if time.Since(t) < cc.config.TombstoneRetention {
+			continue
+		}
+		delete(cc.deltas, key)
+		delete(cc.seqs, key)
+		delete(cc.tombstones, key)
+		cc.dirty = true
+	}
+}
+
+// connectedPeers returns the peers in the peerset and the peers this
+// peer is connected to, which may not know about it yet.
+func (cc *Consensus) connectedPeers() []peer.ID {
+	peers, _ := cc.Peers()
+	seen := make(map[peer.ID]struct{})
+	for _, p := range peers {
+		seen[p] = struct{}{}
+	}
+	for _, p := range cc.host.Network().Peers() {
+		if _, ok := seen[p]; !ok {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// syncLoop regularly pulls the updates from SyncFanout random peers,
+// and forgets the old removals.
+func (cc *Consensus) syncLoop() {
+	ticker := time.NewTicker(cc.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cc.ctx.Done():
+			return
+		case <-ticker.C:
+			peers, _ := cc.Peers()
+			var others []peer.ID
+			for _, p := range peers {
+				if p != cc.host.ID() {
+					others = append(others, p)
+				}
+			}
+			var selected []peer.ID
+			for _, i := range rand.Perm(len(others)) {
+				if len(selected) == cc.config.SyncFanout {
+					break
+				}
+				selected = append(selected, others[i])
+			}
+			cc.sync(selected)
+			cc.pruneTombstones()
+		}
+	}
+}
+
+// saveLoop regularly writes the updates to the DataFolder.
+func (cc *Consensus) saveLoop() {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cc.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cc.save(); err != nil {
+				logger.Errorf("error saving the crdt updates: %s", err)
+			}
+		}
+	}
+}
+
+// load applies the updates saved in the DataFolder, if any. The
+// unsigned updates made by this peer (i.e. by StateSave) are signed.
+func (cc *Consensus) load() error {
+	deltas, err := readDeltas(cc.config)
+	if err != nil {
+		return err
+	}
+	me := peer.IDB58Encode(cc.host.ID())
+	for i := range deltas {
+		if deltas[i].Origin == me && len(deltas[i].Signature) == 0 {
+			cc.sign(&deltas[i])
+		}
+	}
+	logger.Infof("loaded %d updates", cc.applyAll(deltas, false))
+	cc.dirty = false
+	return nil
+}
+
+// save writes the updates to the DataFolder when they have changed
+// since the last save. The file is replaced atomically.
+func (cc *Consensus) save() error {
+	cc.mu.Lock()
+	if !cc.dirty {
+		cc.mu.Unlock()
+		return nil
+	}
+	deltas := make([]Delta, 0, len(cc.deltas))
+	for _, d := range cc.deltas {
+		deltas = append(deltas, d)
+	}
+	cc.dirty = false
+	cc.mu.Unlock()
+
+	return writeDeltas(cc.config, deltas)
+}
+
+// readDeltas returns the updates saved in the DataFolder. It returns
+// no updates when there are none.
+func readDeltas(cfg *Config) ([]Delta, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(cfg.GetDataFolder(), deltasFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var deltas []Delta
+	err = json.Unmarshal(raw, &deltas)
+	return deltas, err
+}
+
+// writeDeltas saves the given updates to the DataFolder, replacing the
+// saved ones atomically.
+func writeDeltas(cfg *Config, deltas []Delta) error {
+	raw, err := json.Marshal(deltas)
+	if err != nil {
+		return err
+	}
+
+	folder := cfg.GetDataFolder()
+	err = os.MkdirAll(folder, 0700)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(folder, deltasFile)
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, raw, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// newOfflineConsensus returns a Consensus which can only apply updates
+// to the given state.
+func newOfflineConsensus(cfg *Config, st state.State) *Consensus {
+	return &Consensus{
+		config:     cfg,
+		state:      st,
+		deltas:     make(map[string]Delta),
+		seqs:       make(map[string]uint64),
+		heads:      make(map[peer.ID]DeltasResponse),
+		tombstones: make(map[string]time.Time),
+	}
+}
+
+// LastState applies the updates saved in the DataFolder of the given
+// configuration to the given state, so that it can be read while the
+// peer is not running. It returns whether there were saved updates.
+func LastState(cfg *Config, st state.State) (bool, error) {
+	deltas, err := readDeltas(cfg)
+	if err != nil || len(deltas) == 0 {
+		return false, err
+	}
+
+	cc := newOfflineConsensus(cfg, st)
+	cc.applyAll(deltas, false)
+	return true, nil
+}
+
+// LastPeers returns the peerset resulting from the updates saved in the
+// DataFolder of the given configuration, so that it can be read while
+// the peer is not running. It returns whether there were saved updates.
+func LastPeers(cfg *Config) ([]peer.ID, bool, error) {
+	deltas, err := readDeltas(cfg)
+	if err != nil || len(deltas) == 0 {
+		return nil, false, err
+	}
+
+	cc := newOfflineConsensus(cfg, mapstate.NewMapState())
+	cc.applyAll(deltas, false)
+	peers, err := cc.Peers()
+	return peers, true, err
+}
+
+// StateSave replaces the updates saved in the DataFolder of the given
+// configuration with ones producing the given state and a peerset made
+// of the given peer. Any saved updates are backed up with a ".old"
+// extension.
+func StateSave(cfg *Config, st state.State, pid peer.ID) error {
+	origin := peer.IDB58Encode(pid)
+	var clock uint64
+	next := func(t DeltaType) Delta {
+		clock++
+		return Delta{Type: t, Clock: clock, Origin: origin}
+	}
+
+	var deltas []Delta
+	d := next(DeltaAddPeer)
+	d.Peer = origin
+	deltas = append(deltas, d)
+	for _, pin := range st.List() {
+		d := next(DeltaPin)
+		d.Pin = pin.ToSerial()
+		deltas = append(deltas, d)
+	}
+	for _, kv := range st.ListKV() {
+		d := next(DeltaSetKV)
+		d.KV = kv
+		deltas = append(deltas, d)
+	}
+
+	path := filepath.Join(cfg.GetDataFolder(), deltasFile)
+	if _, err := os.Stat(path); err == nil {
+		err = os.Rename(path, path+".old")
+		if err != nil {
+			return err
+		}
+	}
+	return writeDeltas(cfg, deltas)
+}
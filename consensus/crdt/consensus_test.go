@@ -0,0 +1,378 @@
+package crdt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	libp2p "github.com/libp2p/go-libp2p"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+func cleanCRDT(idn int) {
+	os.RemoveAll(fmt.Sprintf("crdtFolderFromTests-%d", idn))
+}
+
+func makeTestingHost(t *testing.T) host.Host {
+	h, err := libp2p.New(
+		context.Background(),
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func testingConsensus(t *testing.T, idn int) *Consensus {
+	return testingConsensusWithHost(t, idn, makeTestingHost(t), nil)
+}
+
+func testingConsensusWithHost(t *testing.T, idn int, h host.Host, trusted []peer.ID) *Consensus {
+	cleanCRDT(idn)
+	st := mapstate.NewMapState()
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.DataFolder = fmt.Sprintf("crdtFolderFromTests-%d", idn)
+	cfg.TrustedPeers = trusted
+	cfg.hostShutdown = true
+
+	cc, err := NewConsensus(h, cfg, st)
+	if err != nil {
+		t.Fatal("cannot create Consensus:", err)
+	}
+	cc.SetClient(test.NewMockRPCClientWithHost(t, h))
+	<-cc.Ready()
+	return cc
+}
+
+func TestConsensusPin(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, _ := cc.State()
+	if !st.Has(c) {
+		t.Fatal("the pin should be in the state")
+	}
+
+	err = cc.LogUnpin(api.PinCid(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Has(c) {
+		t.Error("the pin should have been removed")
+	}
+
+	cc.LogSetKV(api.KV{Key: "a", Value: "b"})
+	if kv, ok := st.GetKV("a"); !ok || kv.Value != "b" {
+		t.Error("the KV record should be in the state")
+	}
+	cc.LogRmKV("a")
+	if _, ok := st.GetKV("a"); ok {
+		t.Error("the KV record should have been removed")
+	}
+}
+
+func TestConsensusLastWriterWins(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := Delta{Type: DeltaPin, Pin: api.PinCid(c).ToSerial(), Clock: 10, Origin: "b"}
+	unpin := Delta{Type: DeltaUnpin, Pin: api.PinCid(c).ToSerial(), Clock: 10, Origin: "a"}
+
+	// the unpin arrives later but loses the tie
+	cc.applyAll([]Delta{pin}, false)
+	cc.applyAll([]Delta{unpin}, false)
+	st, _ := cc.State()
+	if !st.Has(c) {
+		t.Error("the pin should have won")
+	}
+
+	if d := cc.newDelta(DeltaPin); d.Clock <= 10 {
+		t.Error("new updates should have a higher clock than the ones seen")
+	}
+}
+
+func TestConsensusPeers(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+	defer cc.Shutdown()
+
+	peers, _ := cc.Peers()
+	if len(peers) != 1 || peers[0] != cc.host.ID() {
+		t.Fatal("the peerset should contain this peer")
+	}
+
+	cc.AddPeer(test.TestPeerID1)
+	peers, _ = cc.Peers()
+	if len(peers) != 2 {
+		t.Fatal("the peer should have been added")
+	}
+
+	// not connected to it
+	if l, _ := cc.Leader(); l != cc.host.ID() {
+		t.Error("this peer should be the leader")
+	}
+
+	cc.RmPeer(test.TestPeerID1)
+	peers, _ = cc.Peers()
+	if len(peers) != 1 {
+		t.Error("the peer should have been removed")
+	}
+}
+
+func TestConsensusReplication(t *testing.T) {
+	cc1 := testingConsensus(t, 1)
+	cc2 := testingConsensus(t, 2)
+	defer cleanCRDT(1)
+	defer cleanCRDT(2)
+	defer cc1.Shutdown()
+	defer cc2.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	// made before knowing each other
+	cc1.LogPin(api.Pin{Cid: c, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+
+	cc1.host.Peerstore().AddAddrs(cc2.host.ID(), cc2.host.Addrs(), peerstore.PermanentAddrTTL)
+	err := cc1.AddPeer(cc2.host.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc2.host.Peerstore().AddAddrs(cc1.host.ID(), cc1.host.Addrs(), peerstore.PermanentAddrTTL)
+	cc2.host.Connect(context.Background(), cc1.host.Peerstore().PeerInfo(cc1.host.ID()))
+
+	err = cc2.WaitForSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st2, _ := cc2.State()
+	if !st2.Has(c) {
+		t.Fatal("the pin should have been pulled")
+	}
+	if peers, _ := cc2.Peers(); len(peers) != 2 {
+		t.Error("the peerset should have been pulled")
+	}
+
+	// sent to the other peer
+	cc2.LogUnpin(api.PinCid(c))
+	st1, _ := cc1.State()
+	for i := 0; i < 50 && st1.Has(c); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if st1.Has(c) {
+		t.Error("the unpin should have been received")
+	}
+}
+
+func TestConsensusDeltasSince(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	cc.LogPin(api.Pin{Cid: c, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+
+	rpcs := &rpcService{cc}
+	var resp DeltasResponse
+	rpcs.Deltas(context.Background(), DeltasRequest{}, &resp)
+	if len(resp.Deltas) != 2 {
+		t.Fatal("all the updates should be sent to a new peer:", resp.Deltas)
+	}
+
+	head := resp
+	rpcs.Deltas(context.Background(), DeltasRequest{Epoch: head.Epoch, Since: head.Head}, &resp)
+	if len(resp.Deltas) != 0 {
+		t.Error("no updates should be sent when nothing changed")
+	}
+
+	cc.LogUnpin(api.PinCid(c))
+	rpcs.Deltas(context.Background(), DeltasRequest{Epoch: head.Epoch, Since: head.Head}, &resp)
+	if len(resp.Deltas) != 1 || resp.Deltas[0].Type != DeltaUnpin {
+		t.Error("only the new update should be sent:", resp.Deltas)
+	}
+
+	rpcs.Deltas(context.Background(), DeltasRequest{Epoch: "old", Since: resp.Head}, &resp)
+	if len(resp.Deltas) != 2 {
+		t.Error("all the updates should be sent after a restart:", resp.Deltas)
+	}
+}
+
+func TestConsensusPruneTombstones(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.Pin{Cid: c, ReplicationFactorMin: -1, ReplicationFactorMax: -1}
+	cc.LogPin(pin)
+	cc.LogUnpin(pin)
+	key := Delta{Type: DeltaUnpin, Pin: pin.ToSerial()}.key()
+
+	cc.pruneTombstones()
+	if _, ok := cc.deltas[key]; !ok {
+		t.Fatal("recent removals should be kept")
+	}
+
+	cc.config.TombstoneRetention = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	cc.pruneTombstones()
+	if _, ok := cc.deltas[key]; ok {
+		t.Error("old removals should be forgotten")
+	}
+	if peers, _ := cc.Peers(); len(peers) != 1 {
+		t.Error("the peerset should be kept")
+	}
+}
+
+func TestConsensusTrustedPeers(t *testing.T) {
+	h1 := makeTestingHost(t)
+	h2 := makeTestingHost(t)
+	trusted := []peer.ID{h1.ID()}
+	cc1 := testingConsensusWithHost(t, 1, h1, trusted)
+	cc2 := testingConsensusWithHost(t, 2, h2, trusted)
+	defer cleanCRDT(1)
+	defer cleanCRDT(2)
+	defer cc1.Shutdown()
+	defer cc2.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.Pin{Cid: c, ReplicationFactorMin: -1, ReplicationFactorMax: -1}
+	if err := cc2.LogPin(pin); err != ErrNotTrusted {
+		t.Fatal("followers should not be able to pin:", err)
+	}
+	if err := cc2.AddPeer(test.TestPeerID1); err != ErrNotTrusted {
+		t.Fatal("followers should not be able to modify the peerset:", err)
+	}
+	if peers, _ := cc2.Peers(); len(peers) != 1 || peers[0] != h2.ID() {
+		t.Error("followers should only add themselves to the peerset:", peers)
+	}
+	if _, err := cc2.Leader(); err == nil {
+		t.Error("followers should not lead")
+	}
+
+	if err := cc1.LogPin(pin); err != nil {
+		t.Fatal(err)
+	}
+	h2.Peerstore().AddAddrs(h1.ID(), h1.Addrs(), peerstore.PermanentAddrTTL)
+	h2.Connect(context.Background(), h1.Peerstore().PeerInfo(h1.ID()))
+	if err := cc2.WaitForSync(); err != nil {
+		t.Fatal(err)
+	}
+	st2, _ := cc2.State()
+	if !st2.Has(c) {
+		t.Fatal("followers should replicate the updates of trusted peers")
+	}
+
+	cc2.announce([]peer.ID{h1.ID()})
+	time.Sleep(500 * time.Millisecond)
+	if peers, _ := cc1.Peers(); len(peers) != 2 {
+		t.Error("trusted peers should learn about the followers:", peers)
+	}
+	if l, _ := cc1.Leader(); l != h1.ID() {
+		t.Error("only trusted peers should lead:", l)
+	}
+
+	// the updates of trusted peers carry their key
+	cc3 := testingConsensusWithHost(t, 3, makeTestingHost(t), trusted)
+	defer cleanCRDT(3)
+	defer cc3.Shutdown()
+	signed := cc1.newDelta(DeltaPin)
+	signed.Pin = pin.ToSerial()
+	cc1.sign(&signed)
+	(&rpcService{cc3}).Apply(context.Background(), []Delta{signed}, &struct{}{})
+	if st3, _ := cc3.State(); !st3.Has(c) {
+		t.Error("updates from unknown trusted peers should be verified with their key")
+	}
+
+	// forged or unsigned updates are ignored
+	c2, _ := cid.Decode(test.TestCid2)
+	forged := cc2.newDelta(DeltaPin)
+	forged.Pin = api.PinCid(c2).ToSerial()
+	cc2.sign(&forged)
+	unsigned := forged
+	unsigned.Origin = peer.IDB58Encode(h1.ID())
+	unsigned.Signature = nil
+	rpcs := &rpcService{cc1}
+	rpcs.Apply(context.Background(), []Delta{forged, unsigned}, &struct{}{})
+	st1, _ := cc1.State()
+	if st1.Has(c2) {
+		t.Error("updates from untrusted peers should be ignored")
+	}
+}
+
+func TestConsensusPersistence(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanCRDT(1)
+
+	c, _ := cid.Decode(test.TestCid1)
+	cc.LogPin(api.Pin{Cid: c, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	cc.Shutdown()
+
+	st := mapstate.NewMapState()
+	cc2, err := NewConsensus(makeTestingHost(t), cc.config, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc2.Shutdown()
+	if !st.Has(c) {
+		t.Error("the pin should have been loaded")
+	}
+}
+
+func TestStateSave(t *testing.T) {
+	cleanCRDT(1)
+	defer cleanCRDT(1)
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.DataFolder = "crdtFolderFromTests-1"
+
+	c, _ := cid.Decode(test.TestCid1)
+	st := mapstate.NewMapState()
+	st.Add(api.Pin{Cid: c, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	st.SetKV(api.KV{Key: "a", Value: "b"})
+
+	err := StateSave(cfg, st, test.TestPeerID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st2 := mapstate.NewMapState()
+	exists, err := LastState(cfg, st2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || !st2.Has(c) {
+		t.Fatal("the pin should have been saved")
+	}
+	if _, ok := st2.GetKV("a"); !ok {
+		t.Error("the KV record should have been saved")
+	}
+
+	peers, exists, err := LastPeers(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || len(peers) != 1 || peers[0] != test.TestPeerID1 {
+		t.Error("the peerset should have been saved:", peers)
+	}
+}
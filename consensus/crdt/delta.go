@@ -0,0 +1,140 @@
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// DeltaType identifies the kind of update carried by a Delta.
+type DeltaType int
+
+// Types of updates
+const (
+	DeltaPin DeltaType = iota + 1
+	DeltaUnpin
+	DeltaSetKV
+	DeltaRmKV
+	DeltaAddPeer
+	DeltaRmPeer
+)
+
+// Delta is an update to the shared state. Every pin, KV record and peer
+// is a last-writer-wins register: for a given key, the Delta with the
+// highest Clock, or the highest Origin when the clocks are equal, wins,
+// regardless of the order in which the updates are received. Removals
+// are kept as tombstones, so that older updates cannot resurrect the
+// removed items.
+type Delta struct {
+	Type DeltaType     `json:"type"`
+	Pin  api.PinSerial `json:"pin,omitempty"`
+	KV   api.KV        `json:"kv,omitempty"`
+	Peer string        `json:"peer,omitempty"`
+
+	// Clock is a Lamport timestamp and Origin the peer which made
+	// the update.
+	Clock  uint64 `json:"clock"`
+	Origin string `json:"origin"`
+
+	// Signature is made by the Origin over the rest of the Delta. It
+	// is only required when the consensus has TrustedPeers. PubKey is
+	// the public key of the Origin, so that the peers which never
+	// connected to it can verify the Signature.
+	Signature []byte `json:"signature,omitempty"`
+	PubKey    []byte `json:"pubkey,omitempty"`
+}
+
+// key identifies the register the Delta updates.
+func (d Delta) key() string {
+	switch d.Type {
+	case DeltaPin, DeltaUnpin:
+		return "/pins/" + d.Pin.Cid
+	case DeltaSetKV, DeltaRmKV:
+		return "/kv/" + d.KV.Key
+	default:
+		return "/peers/" + d.Peer
+	}
+}
+
+// removal tells whether the Delta removes the item of its register.
+func (d Delta) removal() bool {
+	switch d.Type {
+	case DeltaUnpin, DeltaRmKV, DeltaRmPeer:
+		return true
+	default:
+		return false
+	}
+}
+
+// announcement tells whether the Delta adds its Origin to the peerset.
+// Any peer, trusted or not, can announce itself.
+func (d Delta) announcement() bool {
+	return d.Type == DeltaAddPeer && d.Peer == d.Origin
+}
+
+// newer tells whether d wins over other.
+func (d Delta) newer(other Delta) bool {
+	if d.Clock != other.Clock {
+		return d.Clock > other.Clock
+	}
+	return d.Origin > other.Origin
+}
+
+// signedBytes returns the bytes covered by the Signature.
+func (d Delta) signedBytes() ([]byte, error) {
+	d.Signature = nil
+	return json.Marshal(d)
+}
+
+// sign signs the Delta with the private key of its Origin.
+func (d *Delta) sign(key crypto.PrivKey) error {
+	pubKey, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		return err
+	}
+	d.PubKey = pubKey
+	b, err := d.signedBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := key.Sign(b)
+	if err != nil {
+		return err
+	}
+	d.Signature = sig
+	return nil
+}
+
+// verify checks that the Delta was signed by the owner of the given
+// public key, and that the key belongs to its Origin.
+func (d Delta) verify(key crypto.PubKey) error {
+	if len(d.Signature) == 0 {
+		return errors.New("update is not signed")
+	}
+
+	origin, err := peer.IDB58Decode(d.Origin)
+	if err != nil {
+		return err
+	}
+	if !origin.MatchesPublicKey(key) {
+		return fmt.Errorf("key does not match update origin %s", d.Origin)
+	}
+
+	b, err := d.signedBytes()
+	if err != nil {
+		return err
+	}
+	ok, err := key.Verify(b, d.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("bad signature on update from %s", d.Origin)
+	}
+	return nil
+}
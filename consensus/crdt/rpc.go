@@ -0,0 +1,38 @@
+package crdt
+
+import "context"
+
+// DeltasRequest asks a peer for the updates it applied after the Since
+// seq of the given Epoch. All of them are sent when the Epoch is not the
+// current one of the peer.
+type DeltasRequest struct {
+	Epoch string
+	Since uint64
+}
+
+// DeltasResponse carries the updates requested with a DeltasRequest,
+// along with the current Epoch and seq of the peer to ask from next
+// time.
+type DeltasResponse struct {
+	Epoch  string
+	Head   uint64
+	Deltas []Delta
+}
+
+// rpcService is served to the other peers on the ProtocolID.
+type rpcService struct {
+	cc *Consensus
+}
+
+// Apply applies the given updates, when they come from trusted peers.
+func (rpcs *rpcService) Apply(ctx context.Context, in []Delta, out *struct{}) error {
+	rpcs.cc.applyAll(rpcs.cc.trusted(in), true)
+	return nil
+}
+
+// Deltas returns the updates applied by this peer since the given
+// head.
+func (rpcs *rpcService) Deltas(ctx context.Context, in DeltasRequest, out *DeltasResponse) error {
+	*out = rpcs.cc.deltasSince(in.Epoch, in.Since)
+	return nil
+}
@@ -0,0 +1,175 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// The leader coalesces the pin and unpin operations it receives at the
+// same time (i.e. from a PinBatch request or from many clients) into a
+// single LogOpBatch entry, so that they need a single Raft round-trip.
+// A batch is committed when it reaches BatchMaxSize operations or when
+// BatchFlushInterval has passed since its first operation was queued.
+// Batching is disabled until SetBatching enables it.
+// Operations are not batched by followers, which redirect them to the
+// leader one by one.
+
+// errNotLeader is returned to the operations of a batch when this peer
+// lost the leadership before committing it.
+var errNotLeader = errors.New("this peer is not the Raft leader")
+
+var errBatcherShutdown = errors.New("consensus is shutting down")
+
+type batchItem struct {
+	op  *LogOp
+	res chan error
+}
+
+type batcher struct {
+	ctx           context.Context
+	cc            *Consensus
+	maxSize       int
+	flushInterval time.Duration
+	queue         chan batchItem
+}
+
+func newBatcher(ctx context.Context, cc *Consensus, maxSize int, flushInterval time.Duration) *batcher {
+	b := &batcher{
+		ctx:           ctx,
+		cc:            cc,
+		maxSize:       maxSize,
+		flushInterval: flushInterval,
+		queue:         make(chan batchItem, maxSize),
+	}
+	go b.run()
+	return b
+}
+
+// add queues an operation and waits until the batch containing it has
+// been committed.
+func (b *batcher) add(op *LogOp) error {
+	item := batchItem{
+		op:  op,
+		res: make(chan error, 1),
+	}
+
+	select {
+	case b.queue <- item:
+	case <-b.ctx.Done():
+		return errBatcherShutdown
+	}
+
+	select {
+	case err := <-item.res:
+		return err
+	case <-b.ctx.Done():
+		return errBatcherShutdown
+	}
+}
+
+func (b *batcher) run() {
+	var batch []batchItem
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case item := <-b.queue:
+			batch = append(batch, item)
+			if len(batch) == 1 {
+				flush = time.After(b.flushInterval)
+			}
+			if len(batch) < b.maxSize {
+				continue
+			}
+		case <-flush:
+		}
+
+		b.commit(batch)
+		batch = nil
+		flush = nil
+	}
+}
+
+// commit commits the operations of the batch in a single log entry and
+// returns the result to all of them.
+func (b *batcher) commit(batch []batchItem) {
+	op := batch[0].op
+	if len(batch) > 1 {
+		ops := make([]LogOp, len(batch), len(batch))
+		for i, item := range batch {
+			ops[i] = *item.op
+		}
+		op = &LogOp{
+			Type:  LogOpBatch,
+			Batch: ops,
+		}
+	}
+
+	err := b.cc.commitLocal(op)
+	for _, item := range batch {
+		item.res <- err
+	}
+}
+
+// SetBatching enables or disables batching, when configured. Cluster
+// enables it once all the peers can apply batched log entries.
+func (cc *Consensus) SetBatching(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&cc.batching, v)
+}
+
+// commitBatched commits an operation as part of a batch when this peer is
+// the leader. Otherwise, or when batching is disabled, the operation is
+// committed on its own.
+func (cc *Consensus) commitBatched(op *LogOp, rpcOp string, redirectArg interface{}) error {
+	if cc.batcher == nil || atomic.LoadInt32(&cc.batching) == 0 || !cc.isLeader() {
+		return cc.commit(op, rpcOp, redirectArg)
+	}
+
+	start := time.Now()
+	err := cc.batcher.add(op)
+	if err == errNotLeader {
+		// redirect it to the new leader
+		return cc.commit(op, rpcOp, redirectArg)
+	}
+	if err == nil {
+		cc.stats.observeCommit(time.Since(start))
+	}
+	return err
+}
+
+// commitLocal commits an operation to the log while this peer is the
+// leader. It retries upon failures.
+func (cc *Consensus) commitLocal(op *LogOp) error {
+	var err error
+	for i := 0; i <= cc.config.CommitRetries; i++ {
+		if !cc.isLeader() {
+			return errNotLeader
+		}
+		if err != nil {
+			logger.Errorf("retrying upon failed commit (retry %d): %s ",
+				i, err)
+		}
+
+		cc.shutdownLock.Lock() // do not shut down while committing
+		_, err = cc.consensus.CommitOp(op)
+		cc.shutdownLock.Unlock()
+		if err == nil {
+			logCommit(op)
+			return nil
+		}
+		time.Sleep(cc.config.CommitRetryDelay)
+	}
+	return err
+}
+
+func (cc *Consensus) isLeader() bool {
+	leader, err := cc.Leader()
+	return err == nil && leader == cc.host.ID()
+}
@@ -26,6 +26,8 @@ var (
 	DefaultNetworkTimeout       = 10 * time.Second
 	DefaultCommitRetryDelay     = 200 * time.Millisecond
 	DefaultBackupsRotate        = 6
+	DefaultBatchMaxSize         = 1
+	DefaultBatchFlushInterval   = 10 * time.Millisecond
 )
 
 // Config allows to configure the Raft Consensus component for ipfs-cluster.
@@ -58,6 +60,15 @@ type Config struct {
 	// BackupsRotate specifies the maximum number of Raft's DataFolder
 	// copies that we keep as backups (renaming) after cleanup.
 	BackupsRotate int
+	// BatchMaxSize specifies how many pin and unpin operations received
+	// by the leader are coalesced in a single Raft log entry at most.
+	// A value of 1 disables batching. Peers running versions which do
+	// not understand batched log entries ignore them, so batches are
+	// only committed once all the peers advertise support for them.
+	BatchMaxSize int
+	// BatchFlushInterval specifies how long the leader waits for more
+	// operations before committing a batch which is not full.
+	BatchFlushInterval time.Duration
 
 	// A Hashicorp Raft's configuration object.
 	RaftConfig *hraft.Config
@@ -95,6 +106,13 @@ type jsonConfig struct {
 	// copies that we keep as backups (renaming) after cleanup.
 	BackupsRotate int `json:"backups_rotate"`
 
+	// How many pin/unpin operations are committed in a single log entry
+	// at most
+	BatchMaxSize int `json:"batch_max_size"`
+
+	// How long to wait for more operations before committing a batch
+	BatchFlushInterval string `json:"batch_flush_interval"`
+
 	// HeartbeatTimeout specifies the time in follower state without
 	// a leader before we attempt an election.
 	HeartbeatTimeout string `json:"heartbeat_timeout,omitempty"`
@@ -165,6 +183,14 @@ func (cfg *Config) Validate() error {
 		return errors.New("backups_rotate should be larger than 0")
 	}
 
+	if cfg.BatchMaxSize <= 0 {
+		return errors.New("batch_max_size should be larger than 0")
+	}
+
+	if cfg.BatchFlushInterval <= 0 {
+		return errors.New("batch_flush_interval is invalid")
+	}
+
 	return hraft.ValidateConfig(cfg.RaftConfig)
 }
 
@@ -193,6 +219,7 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	waitForLeaderTimeout := parseDuration(jcfg.WaitForLeaderTimeout)
 	networkTimeout := parseDuration(jcfg.NetworkTimeout)
 	commitRetryDelay := parseDuration(jcfg.CommitRetryDelay)
+	batchFlushInterval := parseDuration(jcfg.BatchFlushInterval)
 	heartbeatTimeout := parseDuration(jcfg.HeartbeatTimeout)
 	electionTimeout := parseDuration(jcfg.ElectionTimeout)
 	commitTimeout := parseDuration(jcfg.CommitTimeout)
@@ -209,6 +236,8 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	cfg.CommitRetries = jcfg.CommitRetries
 	config.SetIfNotDefault(commitRetryDelay, &cfg.CommitRetryDelay)
 	config.SetIfNotDefault(jcfg.BackupsRotate, &cfg.BackupsRotate)
+	config.SetIfNotDefault(jcfg.BatchMaxSize, &cfg.BatchMaxSize)
+	config.SetIfNotDefault(batchFlushInterval, &cfg.BatchFlushInterval)
 
 	// Raft values
 	config.SetIfNotDefault(heartbeatTimeout, &cfg.RaftConfig.HeartbeatTimeout)
@@ -234,6 +263,8 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 		CommitRetries:        cfg.CommitRetries,
 		CommitRetryDelay:     cfg.CommitRetryDelay.String(),
 		BackupsRotate:        cfg.BackupsRotate,
+		BatchMaxSize:         cfg.BatchMaxSize,
+		BatchFlushInterval:   cfg.BatchFlushInterval.String(),
 		HeartbeatTimeout:     cfg.RaftConfig.HeartbeatTimeout.String(),
 		ElectionTimeout:      cfg.RaftConfig.ElectionTimeout.String(),
 		CommitTimeout:        cfg.RaftConfig.CommitTimeout.String(),
@@ -256,6 +287,8 @@ func (cfg *Config) Default() error {
 	cfg.CommitRetries = DefaultCommitRetries
 	cfg.CommitRetryDelay = DefaultCommitRetryDelay
 	cfg.BackupsRotate = DefaultBackupsRotate
+	cfg.BatchMaxSize = DefaultBatchMaxSize
+	cfg.BatchFlushInterval = DefaultBatchFlushInterval
 	cfg.RaftConfig = hraft.DefaultConfig()
 
 	// These options are imposed over any Default Raft Config.
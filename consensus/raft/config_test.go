@@ -3,6 +3,7 @@ package raft
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	hraft "github.com/hashicorp/raft"
 )
@@ -15,6 +16,8 @@ var cfgJSON = []byte(`
     "commit_retries": 1,
     "commit_retry_delay": "200ms",
     "backups_rotate": 5,
+    "batch_max_size": 64,
+    "batch_flush_interval": "20ms",
     "heartbeat_timeout": "1s",
     "election_timeout": "1s",
     "commit_timeout": "50ms",
@@ -49,6 +52,9 @@ func TestLoadJSON(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if cfg.BatchMaxSize != 64 || cfg.BatchFlushInterval != 20*time.Millisecond {
+		t.Error("batch options not parsed correctly")
+	}
 	def := hraft.DefaultConfig()
 	if cfg.RaftConfig.LeaderLeaseTimeout != def.LeaderLeaseTimeout {
 		t.Error("expected default leader lease")
@@ -75,6 +81,9 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() != nil {
 		t.Fatal("error validating")
 	}
+	if cfg.BatchMaxSize != 1 {
+		t.Error("batching should be disabled by default")
+	}
 
 	cfg.RaftConfig.HeartbeatTimeout = 0
 	if cfg.Validate() == nil {
@@ -105,4 +114,16 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.BatchMaxSize = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.BatchFlushInterval = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
@@ -24,6 +24,10 @@ import (
 
 var logger = logging.Logger("consensus")
 
+// ChangesChannelCap specifies how many state changes are buffered for
+// the subscriber before new ones are dropped.
+var ChangesChannelCap = 1024
+
 // Consensus handles the work of keeping a shared-state between
 // the peers of an IPFS Cluster, as well as modifying that state and
 // applying any updates in a thread-safe manner.
@@ -38,6 +42,8 @@ type Consensus struct {
 	actor     consensus.Actor
 	baseOp    *LogOp
 	raft      *raftWrapper
+	batcher   *batcher
+	batching  int32 // atomic, set by SetBatching
 
 	rpcClient *rpc.Client
 	rpcReady  chan struct{}
@@ -45,6 +51,12 @@ type Consensus struct {
 
 	shutdownLock sync.Mutex
 	shutdown     bool
+
+	changesMux    sync.Mutex
+	changes       chan api.StateChange
+	changesMissed bool
+
+	stats raftStats
 }
 
 // NewConsensus builds a new ClusterConsensus component using Raft. The state
@@ -67,7 +79,8 @@ func NewConsensus(
 
 	logger.Debug("starting Consensus and waiting for a leader...")
 	consensus := libp2praft.NewOpLog(state, baseOp)
-	raft, err := newRaftWrapper(host, cfg, consensus.FSM(), staging)
+	fsm := &notifyingFSM{FSM: consensus.FSM()}
+	raft, err := newRaftWrapper(host, cfg, fsm, staging)
 	if err != nil {
 		logger.Error("error creating raft: ", err)
 		return nil, err
@@ -88,11 +101,18 @@ func NewConsensus(
 		raft:      raft,
 		rpcReady:  make(chan struct{}, 1),
 		readyCh:   make(chan struct{}, 1),
+		// the state loaded on start has not been notified
+		changesMissed: true,
 	}
 
 	baseOp.consensus = cc
+	fsm.setConsensus(cc)
+	if cfg.BatchMaxSize > 1 {
+		cc.batcher = newBatcher(ctx, cc, cfg.BatchMaxSize, cfg.BatchFlushInterval)
+	}
 
 	go cc.finishBootstrap()
+	go cc.watchLeader()
 	return cc, nil
 }
 
@@ -122,9 +142,9 @@ func (cc *Consensus) WaitForSync() error {
 		return errors.New("error waiting for leader: " + err.Error())
 	}
 
-	err = cc.raft.WaitForVoter(cc.ctx)
+	err = cc.raft.WaitForMember(cc.ctx)
 	if err != nil {
-		return errors.New("error waiting to become a Voter: " + err.Error())
+		return errors.New("error waiting to join the peerset: " + err.Error())
 	}
 
 	err = cc.raft.WaitForUpdates(cc.ctx)
@@ -205,6 +225,54 @@ func (cc *Consensus) Ready() <-chan struct{} {
 	return cc.readyCh
 }
 
+// Subscribe returns a channel on which the pins and unpins applied to
+// the shared state are sent, in order. From then on, the PinTracker is
+// not asked to Track and Untrack them anymore. Changes are dropped when
+// the channel is full (see ChangesChannelCap and MissedChanges).
+// Subsequent calls return the same channel.
+func (cc *Consensus) Subscribe() <-chan api.StateChange {
+	cc.changesMux.Lock()
+	defer cc.changesMux.Unlock()
+	if cc.changes == nil {
+		cc.changes = make(chan api.StateChange, ChangesChannelCap)
+	}
+	return cc.changes
+}
+
+// MissedChanges returns whether some changes were not sent to the
+// subscriber since the last call, either because it did not keep up or
+// because a snapshot was restored. It is true on start.
+func (cc *Consensus) MissedChanges() bool {
+	cc.changesMux.Lock()
+	defer cc.changesMux.Unlock()
+	missed := cc.changesMissed
+	cc.changesMissed = false
+	return missed
+}
+
+func (cc *Consensus) missChanges() {
+	cc.changesMux.Lock()
+	defer cc.changesMux.Unlock()
+	cc.changesMissed = true
+}
+
+// notify sends a change to the subscriber. It returns false when there
+// is no subscriber.
+func (cc *Consensus) notify(change api.StateChange) bool {
+	cc.changesMux.Lock()
+	defer cc.changesMux.Unlock()
+	if cc.changes == nil {
+		return false
+	}
+	select {
+	case cc.changes <- change:
+	default:
+		logger.Warning("the state changes subscriber is too slow, dropping change")
+		cc.changesMissed = true
+	}
+	return true
+}
+
 func (cc *Consensus) op(pin api.Pin, t LogOpType) *LogOp {
 	return &LogOp{
 		Cid:  pin.ToSerial(),
@@ -212,6 +280,13 @@ func (cc *Consensus) op(pin api.Pin, t LogOpType) *LogOp {
 	}
 }
 
+func (cc *Consensus) kvOp(kv api.KV, t LogOpType) *LogOp {
+	return &LogOp{
+		KV:   kv,
+		Type: t,
+	}
+}
+
 // returns true if the operation was redirected to the leader
 // note that if the leader just dissappeared, the rpc call will
 // fail because we haven't heard that it's gone.
@@ -270,6 +345,7 @@ func (cc *Consensus) redirectToLeader(method string, arg interface{}) (bool, err
 
 // commit submits a cc.consensus commit. It retries upon failures.
 func (cc *Consensus) commit(op *LogOp, rpcOp string, redirectArg interface{}) error {
+	start := time.Now()
 	var finalErr error
 	for i := 0; i <= cc.config.CommitRetries; i++ {
 		logger.Debugf("attempt #%d: committing %+v", i, op)
@@ -285,6 +361,9 @@ func (cc *Consensus) commit(op *LogOp, rpcOp string, redirectArg interface{}) er
 		// we're done here.
 		ok, err := cc.redirectToLeader(rpcOp, redirectArg)
 		if err != nil || ok {
+			if err == nil {
+				cc.stats.observeCommit(time.Since(start))
+			}
 			return err
 		}
 
@@ -298,12 +377,8 @@ func (cc *Consensus) commit(op *LogOp, rpcOp string, redirectArg interface{}) er
 			goto RETRY
 		}
 
-		switch op.Type {
-		case LogOpPin:
-			logger.Infof("pin committed to global state: %s", op.Cid.Cid)
-		case LogOpUnpin:
-			logger.Infof("unpin committed to global state: %s", op.Cid.Cid)
-		}
+		logCommit(op)
+		cc.stats.observeCommit(time.Since(start))
 		break
 
 	RETRY:
@@ -312,27 +387,58 @@ func (cc *Consensus) commit(op *LogOp, rpcOp string, redirectArg interface{}) er
 	return finalErr
 }
 
+func logCommit(op *LogOp) {
+	switch op.Type {
+	case LogOpPin:
+		logger.Infof("pin committed to global state: %s", op.Cid.Cid)
+	case LogOpUnpin:
+		logger.Infof("unpin committed to global state: %s", op.Cid.Cid)
+	case LogOpSetKV:
+		logger.Infof("key committed to global state: %s", op.KV.Key)
+	case LogOpRmKV:
+		logger.Infof("key removal committed to global state: %s", op.KV.Key)
+	case LogOpBatch:
+		for i := range op.Batch {
+			logCommit(&op.Batch[i])
+		}
+	}
+}
+
 // LogPin submits a Cid to the shared state of the cluster. It will forward
-// the operation to the leader if this is not it.
+// the operation to the leader if this is not it. Pins received by the
+// leader at the same time are committed together.
 func (cc *Consensus) LogPin(pin api.Pin) error {
 	op := cc.op(pin, LogOpPin)
-	err := cc.commit(op, "ConsensusLogPin", pin.ToSerial())
+	err := cc.commitBatched(op, "ConsensusLogPin", pin.ToSerial())
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// LogUnpin removes a Cid from the shared state of the cluster.
+// LogUnpin removes a Cid from the shared state of the cluster. Like pins,
+// unpins may be committed together.
 func (cc *Consensus) LogUnpin(pin api.Pin) error {
 	op := cc.op(pin, LogOpUnpin)
-	err := cc.commit(op, "ConsensusLogUnpin", pin.ToSerial())
+	err := cc.commitBatched(op, "ConsensusLogUnpin", pin.ToSerial())
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// LogSetKV stores a KV record in the shared state of the cluster.
+func (cc *Consensus) LogSetKV(kv api.KV) error {
+	op := cc.kvOp(kv, LogOpSetKV)
+	return cc.commit(op, "ConsensusLogSetKV", kv)
+}
+
+// LogRmKV removes a KV record from the shared state of the cluster.
+func (cc *Consensus) LogRmKV(key string) error {
+	op := cc.kvOp(api.KV{Key: key}, LogOpRmKV)
+	return cc.commit(op, "ConsensusLogRmKV", key)
+}
+
 // AddPeer adds a new peer to participate in this consensus. It will
 // forward the operation to the leader if this is not it.
 func (cc *Consensus) AddPeer(pid peer.ID) error {
@@ -360,6 +466,34 @@ func (cc *Consensus) AddPeer(pid peer.ID) error {
 	return finalErr
 }
 
+// AddNonVoter adds a new peer which receives the shared state but does
+// not vote nor become the leader. It will forward the operation to the
+// leader if this is not it.
+func (cc *Consensus) AddNonVoter(pid peer.ID) error {
+	var finalErr error
+	for i := 0; i <= cc.config.CommitRetries; i++ {
+		logger.Debugf("attempt #%d: AddNonVoter %s", i, pid.Pretty())
+		if finalErr != nil {
+			logger.Errorf("retrying to add non-voter. Attempt #%d failed: %s", i, finalErr)
+		}
+		ok, err := cc.redirectToLeader("ConsensusAddNonVoter", pid)
+		if err != nil || ok {
+			return err
+		}
+		// Being here means we are the leader and can commit
+		cc.shutdownLock.Lock() // do not shutdown while committing
+		finalErr = cc.raft.AddNonVoter(peer.IDB58Encode(pid))
+		cc.shutdownLock.Unlock()
+		if finalErr != nil {
+			time.Sleep(cc.config.CommitRetryDelay)
+			continue
+		}
+		logger.Infof("non-voter added to Raft: %s", pid.Pretty())
+		break
+	}
+	return finalErr
+}
+
 // RmPeer removes a peer from this consensus. It will
 // forward the operation to the leader if this is not it.
 func (cc *Consensus) RmPeer(pid peer.ID) error {
@@ -113,6 +113,43 @@ func TestConsensusPin(t *testing.T) {
 	}
 }
 
+func TestConsensusPinBatched(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanRaft(1)
+	defer cc.Shutdown()
+
+	// only commit full batches
+	cc.batcher = newBatcher(cc.ctx, cc, 3, time.Minute)
+	cc.SetBatching(true)
+
+	before := cc.raft.raft.LastIndex()
+	cids := []string{test.TestCid1, test.TestCid2, test.TestCid3}
+	errs := make(chan error, len(cids))
+	for _, c := range cids {
+		go func(c string) {
+			h, _ := cid.Decode(c)
+			errs <- cc.LogPin(api.Pin{Cid: h, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+		}(c)
+	}
+	for range cids {
+		if err := <-errs; err != nil {
+			t.Error("the operation did not make it to the log:", err)
+		}
+	}
+
+	if n := cc.raft.raft.LastIndex() - before; n != 1 {
+		t.Errorf("expected the pins to be committed in 1 log entry, got %d", n)
+	}
+
+	st, err := cc.State()
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+	if len(st.List()) != len(cids) {
+		t.Error("all the pins should be in the state")
+	}
+}
+
 func TestConsensusUnpin(t *testing.T) {
 	cc := testingConsensus(t, 1)
 	defer cleanRaft(1)
@@ -125,6 +162,44 @@ func TestConsensusUnpin(t *testing.T) {
 	}
 }
 
+func TestConsensusSubscribe(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanRaft(1)
+	defer cc.Shutdown()
+
+	changes := cc.Subscribe()
+	if !cc.MissedChanges() {
+		t.Error("the changes should be missed on start")
+	}
+	if cc.MissedChanges() {
+		t.Error("missed changes should have been reset")
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	if err != nil {
+		t.Fatal("the operation did not make it to the log:", err)
+	}
+	err = cc.LogUnpin(api.PinCid(c))
+	if err != nil {
+		t.Fatal("the operation did not make it to the log:", err)
+	}
+
+	for _, typ := range []api.StateChangeType{api.StateChangePin, api.StateChangeUnpin} {
+		select {
+		case change := <-changes:
+			if change.Type != typ || change.Pin.Cid.String() != test.TestCid1 {
+				t.Errorf("unexpected change: %+v", change)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a state change")
+		}
+	}
+	if cc.MissedChanges() {
+		t.Error("no change should have been missed")
+	}
+}
+
 func TestConsensusAddPeer(t *testing.T) {
 	cc := testingConsensus(t, 1)
 	cc2 := testingConsensus(t, 2)
@@ -285,3 +360,57 @@ func TestRaftLatestSnapshot(t *testing.T) {
 		t.Fatal("Latest snapshot not read")
 	}
 }
+
+func TestRaftLastSnapshotPeers(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanRaft(1)
+	defer cc.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c1, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	if err != nil {
+		t.Error("the pin did not make it to the log:", err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	err = cc.raft.Snapshot()
+	if err != nil {
+		t.Error("the snapshot was not taken successfully")
+	}
+
+	peers, snapExists, err := LastSnapshotPeers(cc.config)
+	if !snapExists {
+		t.Fatal("No snapshot found by LastSnapshotPeers")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0] != cc.host.ID() {
+		t.Error("expected the snapshot peerset to contain only this peer:", peers)
+	}
+}
+
+func TestRaftLastPeers(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanRaft(1)
+
+	c1, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c1, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	if err != nil {
+		t.Error("the pin did not make it to the log:", err)
+	}
+	id := cc.host.ID()
+	cc.Shutdown()
+
+	// no snapshot was taken: the peerset comes from the log.
+	peers, found, err := LastPeers(cc.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("expected a peerset")
+	}
+	if len(peers) != 1 || peers[0] != id {
+		t.Error("expected the peerset to contain only this peer:", peers)
+	}
+}
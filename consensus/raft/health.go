@@ -0,0 +1,123 @@
+package raft
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// leaderWatchInterval specifies how often the Raft leader is checked in
+// order to count leadership changes.
+var leaderWatchInterval = time.Second
+
+// commitLatencyWeight is the weight of the last commit in the moving
+// average of the commit latency.
+const commitLatencyWeight = 0.2
+
+// raftStats holds the figures about this Raft peer which Raft does not
+// report by itself.
+type raftStats struct {
+	mu               sync.Mutex
+	leader           string
+	leaderChanges    uint64
+	lastLeaderChange time.Time
+	commitLatency    time.Duration
+}
+
+// observeLeader counts a leadership change when the leader differs from
+// the last one observed. Losing the leader is not a change.
+func (s *raftStats) observeLeader(leader string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if leader == "" || leader == s.leader {
+		return
+	}
+	if s.leader != "" {
+		s.leaderChanges++
+	}
+	s.leader = leader
+	s.lastLeaderChange = time.Now()
+}
+
+// observeCommit updates the moving average of the commit latency.
+func (s *raftStats) observeCommit(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.commitLatency == 0 {
+		s.commitLatency = d
+		return
+	}
+	s.commitLatency = time.Duration(commitLatencyWeight*float64(d) +
+		(1-commitLatencyWeight)*float64(s.commitLatency))
+}
+
+// watchLeader regularly checks the Raft leader to count leadership
+// changes until the component is shut down.
+func (cc *Consensus) watchLeader() {
+	ticker := time.NewTicker(leaderWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cc.ctx.Done():
+			return
+		case <-ticker.C:
+			cc.stats.observeLeader(cc.raft.Leader())
+		}
+	}
+}
+
+// RaftHealth returns the state of Raft in this peer: its role, the
+// current leader and term, the log indexes, the last snapshot, the
+// leadership changes seen and the commit latency.
+func (cc *Consensus) RaftHealth() api.RaftHealth {
+	stats := cc.raft.raft.Stats()
+	parse := func(key string) uint64 {
+		n, _ := strconv.ParseUint(stats[key], 10, 64)
+		return n
+	}
+
+	health := api.RaftHealth{
+		Peer:              peer.IDB58Encode(cc.host.ID()),
+		State:             stats["state"],
+		Leader:            cc.raft.Leader(),
+		Term:              parse("term"),
+		LastLogIndex:      parse("last_log_index"),
+		CommitIndex:       parse("commit_index"),
+		AppliedIndex:      parse("applied_index"),
+		LastSnapshotIndex: parse("last_snapshot_index"),
+	}
+	if health.LastLogIndex > health.LastSnapshotIndex {
+		health.LogEntries = health.LastLogIndex - health.LastSnapshotIndex
+	}
+
+	if metas, err := cc.raft.snapshotStore.List(); err == nil && len(metas) > 0 {
+		health.LastSnapshot = snapshotTime(metas[0].ID)
+	}
+
+	cc.stats.mu.Lock()
+	health.LeaderChanges = cc.stats.leaderChanges
+	health.LastLeaderChange = cc.stats.lastLeaderChange
+	health.CommitLatency = cc.stats.commitLatency.String()
+	cc.stats.mu.Unlock()
+	return health
+}
+
+// snapshotTime returns when a snapshot was taken from its ID, which Raft
+// builds as "<term>-<index>-<unix milliseconds>". It returns the zero
+// time when the ID does not have that format.
+func snapshotTime(id string) time.Time {
+	parts := strings.Split(id, "-")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	msec, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, msec*int64(time.Millisecond))
+}
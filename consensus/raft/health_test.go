@@ -0,0 +1,59 @@
+package raft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestRaftHealth(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	defer cleanRaft(1)
+	defer cc.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cc.LogPin(api.Pin{Cid: c, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+
+	health := cc.RaftHealth()
+	if health.State != "Leader" || health.Leader != cc.host.ID().Pretty() {
+		t.Error("this peer should be the leader: ", health)
+	}
+	if health.Term == 0 || health.AppliedIndex == 0 || health.LogEntries == 0 {
+		t.Error("unexpected log figures: ", health)
+	}
+	if health.CommitLatency == "0s" {
+		t.Error("the commit latency should have been measured")
+	}
+}
+
+func TestRaftStatsLeader(t *testing.T) {
+	s := &raftStats{}
+	s.observeLeader("a")
+	s.observeLeader("")
+	s.observeLeader("a")
+	if s.leaderChanges != 0 {
+		t.Error("the first leader or losing it are not changes")
+	}
+	s.observeLeader("b")
+	if s.leaderChanges != 1 {
+		t.Error("expected one leadership change")
+	}
+}
+
+func TestSnapshotTime(t *testing.T) {
+	ts := snapshotTime("2-10-1530000000000")
+	if ts.Unix() != 1530000000 {
+		t.Error("unexpected snapshot time: ", ts)
+	}
+	if !snapshotTime("bad").IsZero() {
+		t.Error("expected zero time for bad IDs")
+	}
+}
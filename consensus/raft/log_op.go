@@ -13,6 +13,9 @@ import (
 const (
 	LogOpPin = iota + 1
 	LogOpUnpin
+	LogOpSetKV
+	LogOpRmKV
+	LogOpBatch
 )
 
 // LogOpType expresses the type of a consensus Operation
@@ -23,7 +26,9 @@ type LogOpType int
 // Consensus component.
 type LogOp struct {
 	Cid       api.PinSerial
+	KV        api.KV
 	Type      LogOpType
+	Batch     []LogOp // for LogOpBatch
 	consensus *Consensus
 }
 
@@ -42,6 +47,9 @@ func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
 		if err != nil {
 			goto ROLLBACK
 		}
+		if op.consensus.notify(api.StateChange{Type: api.StateChangePin, Pin: op.Cid.ToPin()}) {
+			break
+		}
 		// Async, we let the PinTracker take care of any problems
 		op.consensus.rpcClient.Go("",
 			"Cluster",
@@ -54,6 +62,9 @@ func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
 		if err != nil {
 			goto ROLLBACK
 		}
+		if op.consensus.notify(api.StateChange{Type: api.StateChangeUnpin, Pin: op.Cid.ToPin()}) {
+			break
+		}
 		// Async, we let the PinTracker take care of any problems
 		op.consensus.rpcClient.Go("",
 			"Cluster",
@@ -61,7 +72,24 @@ func (op *LogOp) ApplyTo(cstate consensus.State) (consensus.State, error) {
 			op.Cid,
 			&struct{}{},
 			nil)
-
+	case LogOpSetKV:
+		err = state.SetKV(op.KV)
+		if err != nil {
+			goto ROLLBACK
+		}
+	case LogOpRmKV:
+		err = state.RmKV(op.KV.Key)
+		if err != nil {
+			goto ROLLBACK
+		}
+	case LogOpBatch:
+		for i := range op.Batch {
+			batchOp := &op.Batch[i]
+			batchOp.consensus = op.consensus
+			if _, err := batchOp.ApplyTo(state); err != nil {
+				return nil, err
+			}
+		}
 	default:
 		logger.Error("unknown LogOp type. Ignoring")
 	}
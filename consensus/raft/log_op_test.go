@@ -48,6 +48,28 @@ func TestApplyToUnpin(t *testing.T) {
 	}
 }
 
+func TestApplyToBatch(t *testing.T) {
+	cc := testingConsensus(t, 1)
+	op := &LogOp{
+		Type: LogOpBatch,
+		Batch: []LogOp{
+			{Cid: api.PinSerial{Cid: test.TestCid1}, Type: LogOpPin},
+			{Cid: api.PinSerial{Cid: test.TestCid2}, Type: LogOpPin},
+			{Cid: api.PinSerial{Cid: test.TestCid1}, Type: LogOpUnpin},
+		},
+		consensus: cc,
+	}
+	defer cleanRaft(1)
+	defer cc.Shutdown()
+
+	st := mapstate.NewMapState()
+	op.ApplyTo(st)
+	pins := st.List()
+	if len(pins) != 1 || pins[0].Cid.String() != test.TestCid2 {
+		t.Error("the state was not modified correctly")
+	}
+}
+
 func TestApplyToBadState(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
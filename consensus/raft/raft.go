@@ -1,12 +1,14 @@
 package raft
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	hraft "github.com/hashicorp/raft"
@@ -14,6 +16,7 @@ import (
 	host "github.com/libp2p/go-libp2p-host"
 	peer "github.com/libp2p/go-libp2p-peer"
 	p2praft "github.com/libp2p/go-libp2p-raft"
+	msgpack "github.com/multiformats/go-multicodec/msgpack"
 
 	"github.com/ipfs/ipfs-cluster/state"
 )
@@ -48,6 +51,32 @@ var waitForUpdatesInterval = 100 * time.Millisecond
 // How many times to retry snapshotting when shutting down
 var maxShutdownSnapshotRetries = 5
 
+// notifyingFSM wraps the FSM to let the Consensus know when a snapshot
+// is restored, since the changes it brings are not notified.
+type notifyingFSM struct {
+	hraft.FSM
+
+	mu sync.Mutex
+	cc *Consensus
+}
+
+func (fsm *notifyingFSM) setConsensus(cc *Consensus) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	fsm.cc = cc
+}
+
+// Restore restores the FSM from a snapshot.
+func (fsm *notifyingFSM) Restore(r io.ReadCloser) error {
+	err := fsm.FSM.Restore(r)
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	if fsm.cc != nil {
+		fsm.cc.missChanges()
+	}
+	return err
+}
+
 // raftWrapper wraps the hraft.Raft object and related things like the
 // different stores used or the hraft.Configuration.
 // Its methods provide functionality for working with Raft.
@@ -286,8 +315,10 @@ func (rw *raftWrapper) WaitForLeader(ctx context.Context) (string, error) {
 	}
 }
 
-func (rw *raftWrapper) WaitForVoter(ctx context.Context) error {
-	logger.Debug("waiting until we are promoted to a voter")
+// WaitForMember holds until we are part of the Raft configuration, as
+// a voter or a non-voter.
+func (rw *raftWrapper) WaitForMember(ctx context.Context) error {
+	logger.Debug("waiting until we are part of the peerset")
 
 	pid := hraft.ServerID(peer.IDB58Encode(rw.host.ID()))
 	for {
@@ -300,7 +331,7 @@ func (rw *raftWrapper) WaitForVoter(ctx context.Context) error {
 				return err
 			}
 
-			if isVoter(pid, configFuture.Configuration()) {
+			if isMember(pid, configFuture.Configuration()) {
 				return nil
 			}
 
@@ -309,9 +340,9 @@ func (rw *raftWrapper) WaitForVoter(ctx context.Context) error {
 	}
 }
 
-func isVoter(srvID hraft.ServerID, cfg hraft.Configuration) bool {
+func isMember(srvID hraft.ServerID, cfg hraft.Configuration) bool {
 	for _, server := range cfg.Servers {
-		if server.ID == srvID && server.Suffrage == hraft.Voter {
+		if server.ID == srvID && server.Suffrage != hraft.Staging {
 			return true
 		}
 	}
@@ -469,6 +500,31 @@ func (rw *raftWrapper) AddPeer(peer string) error {
 	return err
 }
 
+// AddNonVoter adds a peer to Raft which does not vote
+func (rw *raftWrapper) AddNonVoter(peer string) error {
+	// Check that we don't have it to not waste
+	// log entries if so.
+	peers, err := rw.Peers()
+	if err != nil {
+		return err
+	}
+	if find(peers, peer) {
+		logger.Infof("%s is already a raft peer", peer)
+		return nil
+	}
+
+	future := rw.raft.AddNonvoter(
+		hraft.ServerID(peer),
+		hraft.ServerAddress(peer),
+		0,
+		0)
+	err = future.Error()
+	if err != nil {
+		logger.Error("raft cannot add non-voter: ", err)
+	}
+	return err
+}
+
 // RemovePeer removes a peer from Raft
 func (rw *raftWrapper) RemovePeer(peer string) error {
 	// Check that we have it to not waste
@@ -562,6 +618,135 @@ func LastStateRaw(cfg *Config) (io.Reader, bool, error) {
 	return r, true, nil
 }
 
+// LastSnapshotPeers returns the peerset stored in the last snapshot and a
+// flag indicating whether any snapshot was found.
+func LastSnapshotPeers(cfg *Config) ([]peer.ID, bool, error) {
+	dataFolder := cfg.GetDataFolder()
+	if _, err := os.Stat(dataFolder); os.IsNotExist(err) {
+		// nothing to read
+		return nil, false, nil
+	}
+
+	meta, r, err := latestSnapshot(dataFolder)
+	if err != nil {
+		return nil, false, err
+	}
+	if meta == nil { // no snapshots could be read
+		return nil, false, nil
+	}
+	r.Close()
+
+	var pids []peer.ID
+	for _, srv := range meta.Configuration.Servers {
+		pid, err := peer.IDB58Decode(string(srv.ID))
+		if err != nil {
+			return nil, true, err
+		}
+		pids = append(pids, pid)
+	}
+	return pids, true, nil
+}
+
+// LastPeers returns the current Raft peerset: the one stored in the last
+// snapshot, updated with the membership changes logged after it. The flag
+// indicates whether any peerset was found. It must not be used while the
+// Raft instance is running, as it opens the log store.
+func LastPeers(cfg *Config) ([]peer.ID, bool, error) {
+	dataFolder := cfg.GetDataFolder()
+	if _, err := os.Stat(dataFolder); os.IsNotExist(err) {
+		// nothing to read
+		return nil, false, nil
+	}
+
+	var servers []hraft.Server
+	var snapIndex uint64
+	found := false
+	meta, r, err := latestSnapshot(dataFolder)
+	if err != nil {
+		return nil, false, err
+	}
+	if meta != nil {
+		r.Close()
+		servers = meta.Configuration.Servers
+		snapIndex = meta.Index
+		found = true
+	}
+
+	dbPath := filepath.Join(dataFolder, "raft.db")
+	if _, err := os.Stat(dbPath); err == nil {
+		logged, ok, err := lastLoggedServers(dbPath, snapIndex)
+		if err != nil {
+			return nil, found, err
+		}
+		if ok {
+			servers = logged
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, false, nil
+	}
+	pids, err := serverIDs(servers)
+	return pids, true, err
+}
+
+// lastLoggedServers returns the servers of the last configuration change
+// in the log store which comes after the given index.
+func lastLoggedServers(dbPath string, after uint64) ([]hraft.Server, bool, error) {
+	store, err := raftboltdb.NewBoltStore(dbPath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer store.Close()
+
+	first, err := store.FirstIndex()
+	if err != nil {
+		return nil, false, err
+	}
+	last, err := store.LastIndex()
+	if err != nil {
+		return nil, false, err
+	}
+	if first <= after {
+		first = after + 1
+	}
+
+	// Configuration changes are rare: look for the last one backwards.
+	for i := last; i >= first && i > 0; i-- {
+		var entry hraft.Log
+		err := store.GetLog(i, &entry)
+		if err == hraft.ErrLogNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if entry.Type != hraft.LogConfiguration {
+			continue
+		}
+		var conf hraft.Configuration
+		dec := msgpack.Codec(msgpack.DefaultMsgpackHandle()).Decoder(bytes.NewReader(entry.Data))
+		if err := dec.Decode(&conf); err != nil {
+			return nil, false, err
+		}
+		return conf.Servers, true, nil
+	}
+	return nil, false, nil
+}
+
+func serverIDs(servers []hraft.Server) ([]peer.ID, error) {
+	var pids []peer.ID
+	for _, srv := range servers {
+		pid, err := peer.IDB58Decode(string(srv.ID))
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
 // SnapshotSave saves the provided state to a snapshot in the
 // raft data path.  Old raft data is backed up and replaced
 // by the new snapshot.  pids contains the config-specified
@@ -0,0 +1,266 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+)
+
+// DAGs are transferred between cluster peers as CAR files, exported by
+// the IPFS daemon of one peer and streamed to the other, without holding
+// them in memory.
+//
+// The blocks of the content added through a peer are sent to the IPFS
+// daemons of the peers allocated to it, rather than left for them to
+// find and fetch through IPFS. They are streamed over the DAGPushProtocol
+// to the other peers, whose daemons import them. Once the CAR file is
+// written, the sending side closes the stream for writing and the
+// receiving one replies with an error message, or nothing when the
+// import worked.
+//
+// CAR files exported through a peer whose daemon does not hold the DAG
+// are requested from another peer over the DAGPullProtocol. The
+// requesting side writes the Cid and closes the stream for writing. The
+// other one replies with a status byte followed by the CAR file, or by
+// an error message. Errors happening once the CAR file is being sent
+// reset the stream.
+
+// DAGPushProtocol is used to send the blocks of a DAG to the IPFS daemon
+// of another cluster peer.
+var DAGPushProtocol = protocol.ID("/ipfscluster/" + Version + "/dagpush")
+
+// DAGPullProtocol is used to export a DAG as a CAR file from the IPFS
+// daemon of another cluster peer.
+var DAGPullProtocol = protocol.ID("/ipfscluster/" + Version + "/dagpull")
+
+// maxDAGPushReplySize limits the size of the replies to DAG pushes and
+// of the errors replied to DAG pulls.
+const maxDAGPushReplySize = 4096
+
+// maxDAGPullRequestSize limits the size of the Cids requested in DAG
+// pulls.
+const maxDAGPullRequestSize = 256
+
+// Status bytes starting the replies to DAG pulls.
+const (
+	dagPullOK byte = iota
+	dagPullError
+)
+
+// pushAdded sends the blocks of an added root, or of its shards, to the
+// peers allocated to them which can import CAR files. Failures are only
+// logged: the allocations can still fetch the blocks through IPFS.
+func (c *Cluster) pushAdded(ctx context.Context, root *cid.Cid) {
+	curr, ok := c.getCurrentPin(root)
+	if !ok {
+		return
+	}
+	targets, err := c.addedTargets(curr)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	features := c.peerFeatures()
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		for _, p := range target.Allocations {
+			if p == c.id || !hasFeature(features[p], api.FeatureCAR) {
+				continue
+			}
+			wg.Add(1)
+			go func(p peer.ID, h *cid.Cid) {
+				defer wg.Done()
+				if err := c.pushDAG(ctx, p, h); err != nil {
+					logger.Warningf("error sending %s to %s (it will be fetched through IPFS): %s", h, p.Pretty(), err)
+				}
+			}(p, target.Cid)
+		}
+	}
+	wg.Wait()
+}
+
+// pushDAG sends the blocks of the DAG under the given Cid to the IPFS
+// daemon of another peer.
+func (c *Cluster) pushDAG(ctx context.Context, p peer.ID, h *cid.Cid) error {
+	transferer, ok := c.ipfs.(CARTransferer)
+	if !ok {
+		return errors.New("the IPFS connector cannot export CAR files")
+	}
+
+	s, err := c.host.NewStream(ctx, p, c.dagPushProtocol)
+	if err != nil {
+		return err
+	}
+	defer resetOnDone(ctx, s)()
+	if err := transferer.DAGExport(ctx, h, s); err != nil {
+		s.Reset()
+		return err
+	}
+	// done writing: wait for the reply
+	if err := s.Close(); err != nil {
+		return err
+	}
+	reply, err := ioutil.ReadAll(io.LimitReader(s, maxDAGPushReplySize))
+	if err != nil {
+		return err
+	}
+	if len(reply) > 0 {
+		return errors.New(string(reply))
+	}
+	logger.Debugf("sent %s to %s", h, p.Pretty())
+	return nil
+}
+
+// resetOnDone resets the stream if the context is done before the
+// returned function is called.
+func resetOnDone(ctx context.Context, s inet.Stream) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Reset()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// handleDAGPush imports the blocks sent over a stream of the
+// DAGPushProtocol and replies with the error, if any.
+func (c *Cluster) handleDAGPush(s inet.Stream) {
+	defer s.Close()
+
+	from := s.Conn().RemotePeer()
+	if err := c.importPushedDAG(from, s); err != nil {
+		logger.Warningf("error importing the blocks sent by %s: %s", from.Pretty(), err)
+		io.WriteString(s, err.Error())
+	}
+}
+
+// pullDAG writes the DAG under the given Cid, exported as a CAR file by
+// the IPFS daemon of another peer, to w.
+func (c *Cluster) pullDAG(ctx context.Context, p peer.ID, h *cid.Cid, w io.Writer) error {
+	s, err := c.host.NewStream(ctx, p, c.dagPullProtocol)
+	if err != nil {
+		return err
+	}
+	defer resetOnDone(ctx, s)()
+	if _, err := io.WriteString(s, h.String()); err != nil {
+		s.Reset()
+		return err
+	}
+	// done writing: wait for the reply
+	if err := s.Close(); err != nil {
+		s.Reset()
+		return err
+	}
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(s, status); err != nil {
+		s.Reset()
+		return err
+	}
+	if status[0] != dagPullOK {
+		msg, err := ioutil.ReadAll(io.LimitReader(s, maxDAGPushReplySize))
+		if err != nil {
+			s.Reset()
+			return err
+		}
+		return errors.New(string(msg))
+	}
+	if _, err := io.Copy(w, s); err != nil {
+		s.Reset()
+		return err
+	}
+	return nil
+}
+
+// handleDAGPull sends the DAG requested over a stream of the
+// DAGPullProtocol, exported as a CAR file by the IPFS daemon.
+func (c *Cluster) handleDAGPull(s inet.Stream) {
+	from := s.Conn().RemotePeer()
+	req, err := ioutil.ReadAll(io.LimitReader(s, maxDAGPullRequestSize))
+	if err != nil {
+		s.Reset()
+		return
+	}
+
+	w := &dagPullWriter{w: s}
+	err = c.exportLocalDAG(string(req), w)
+	switch {
+	case err == nil:
+		err = w.start()
+	case !w.started:
+		logger.Warningf("error exporting the DAG requested by %s: %s", from.Pretty(), err)
+		s.Write([]byte{dagPullError})
+		io.WriteString(s, err.Error())
+		err = nil
+	}
+	if err != nil {
+		logger.Warningf("error sending the DAG requested by %s: %s", from.Pretty(), err)
+		s.Reset()
+		return
+	}
+	s.Close()
+}
+
+// exportLocalDAG writes the DAG under the given Cid, exported as a CAR
+// file by the IPFS daemon of this peer, to w.
+func (c *Cluster) exportLocalDAG(arg string, w io.Writer) error {
+	h, err := cid.Decode(arg)
+	if err != nil {
+		return err
+	}
+	transferer, ok := c.ipfs.(CARTransferer)
+	if !ok {
+		return errors.New("the IPFS connector cannot export CAR files")
+	}
+	return transferer.DAGExport(c.ctx, h, w)
+}
+
+// dagPullWriter writes the OK status byte of a reply to a DAG pull before
+// the first write of the CAR file.
+type dagPullWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (dw *dagPullWriter) start() error {
+	if dw.started {
+		return nil
+	}
+	dw.started = true
+	_, err := dw.w.Write([]byte{dagPullOK})
+	return err
+}
+
+func (dw *dagPullWriter) Write(p []byte) (int, error) {
+	if err := dw.start(); err != nil {
+		return 0, err
+	}
+	return dw.w.Write(p)
+}
+
+// importPushedDAG imports a CAR file sent by the given peer, unless it
+// is not trusted to modify the shared state.
+func (c *Cluster) importPushedDAG(from peer.ID, car io.Reader) error {
+	if tc, ok := c.consensus.(TrustingConsensus); ok && !tc.IsTrusted(from) {
+		return errUntrustedRPC
+	}
+	transferer, ok := c.ipfs.(CARTransferer)
+	if !ok {
+		return errors.New("the IPFS connector cannot import CAR files")
+	}
+	// the allocations pin the pushed roots through the cluster
+	return transferer.DAGImport(c.ctx, car, false)
+}
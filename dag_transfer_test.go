@@ -0,0 +1,115 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	libp2p "github.com/libp2p/go-libp2p"
+	inet "github.com/libp2p/go-libp2p-net"
+)
+
+func TestClusterDAGPush(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	ctx := context.Background()
+	h2, err := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+	if err := h2.Connect(ctx, cl.host.Peerstore().PeerInfo(cl.id)); err != nil {
+		t.Fatal(err)
+	}
+
+	// receiving: the CAR file is imported and the reply is empty
+	s, err := h2.NewStream(ctx, cl.id, cl.dagPushProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(s, "car")
+	s.Close()
+	reply, err := ioutil.ReadAll(s)
+	if err != nil || len(reply) != 0 {
+		t.Error("the import should have worked:", err, string(reply))
+	}
+
+	// sending: the CAR file is exported and the error replied returned
+	received := make(chan string, 1)
+	h2.SetStreamHandler(cl.dagPushProtocol, func(s inet.Stream) {
+		defer s.Close()
+		car, _ := ioutil.ReadAll(s)
+		received <- string(car)
+		io.WriteString(s, "import failed")
+	})
+	c, _ := cid.Decode(test.TestCid1)
+	err = cl.pushDAG(ctx, h2.ID(), c)
+	if err == nil || err.Error() != "import failed" {
+		t.Error("expected the error of the receiving peer:", err)
+	}
+	if car := <-received; car != "car:"+test.TestCid1 {
+		t.Error("unexpected CAR file:", car)
+	}
+}
+
+func TestClusterDAGPull(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	ctx := context.Background()
+	h2, err := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+	if err := h2.Connect(ctx, cl.host.Peerstore().PeerInfo(cl.id)); err != nil {
+		t.Fatal(err)
+	}
+
+	// sending: the CAR file follows the OK status
+	s, err := h2.NewStream(ctx, cl.id, cl.dagPullProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(s, test.TestCid1)
+	s.Close()
+	reply, err := ioutil.ReadAll(s)
+	if err != nil || string(reply) != string(dagPullOK)+"car:"+test.TestCid1 {
+		t.Error("the export should have worked:", err, string(reply))
+	}
+
+	// receiving: the CAR file is written or the error replied returned
+	h2.SetStreamHandler(cl.dagPullProtocol, func(s inet.Stream) {
+		defer s.Close()
+		req, _ := ioutil.ReadAll(s)
+		if string(req) == test.TestCid1 {
+			s.Write([]byte{dagPullOK})
+			io.WriteString(s, "car:"+string(req))
+			return
+		}
+		s.Write([]byte{dagPullError})
+		io.WriteString(s, "export failed")
+	})
+	c1, _ := cid.Decode(test.TestCid1)
+	var car bytes.Buffer
+	if err := cl.pullDAG(ctx, h2.ID(), c1, &car); err != nil {
+		t.Fatal(err)
+	}
+	if car.String() != "car:"+test.TestCid1 {
+		t.Error("unexpected CAR file:", car.String())
+	}
+
+	c2, _ := cid.Decode(test.TestCid2)
+	err = cl.pullDAG(ctx, h2.ID(), c2, ioutil.Discard)
+	if err == nil || err.Error() != "export failed" {
+		t.Error("expected the error of the sending peer:", err)
+	}
+}
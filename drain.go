@@ -0,0 +1,311 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// Draining removes a peer from the cluster without lowering the
+// replication of its pins. The peer is first marked as leaving, which
+// excludes it from new allocations. Its pins are then allocated to other
+// peers while it keeps its copy, and it is only removed from their
+// allocations, and then from the cluster, once the new allocations
+// report the items as pinned.
+
+// drainingPeerPrefix is the prefix of the keys of the KV records which
+// mark the peers being drained.
+const drainingPeerPrefix = "draining-peer:"
+
+// drainCheckInterval is how often the status of the re-allocated pins
+// is checked while draining a peer.
+var drainCheckInterval = 5 * time.Second
+
+// PeerDrain re-allocates the pins of the given peer to other peers,
+// waits until they have pinned them and then removes the peer from the
+// cluster, like PeerRemove. Nothing is re-allocated when the remaining
+// peers cannot hold the pins of the leaving one. Draining fails, and
+// the peer is kept, when the pins are not pinned elsewhere within the
+// DrainTimeout.
+func (c *Cluster) PeerDrain(pid peer.ID) error {
+	return c.peerDrain(c.ctx, "", pid)
+}
+
+// peerDrain performs PeerDrain on behalf of the given origin. Draining
+// stops when the context is cancelled or the DrainTimeout expires. The
+// pins re-allocated until then get their previous allocations back.
+func (c *Cluster) peerDrain(ctx context.Context, origin api.Origin, pid peer.ID) error {
+	peers, err := c.consensus.Peers()
+	if err != nil {
+		return err
+	}
+	if !containsPeer(peers, pid) {
+		return fmt.Errorf("%s is not a cluster peer", pid.Pretty())
+	}
+
+	if c.pinsPaused() {
+		return errPinsPaused
+	}
+
+	// peers which do not know about draining would keep allocating
+	// pins to the leaving one
+	if err := c.requireFeature(api.FeatureDrain, false); err != nil {
+		return err
+	}
+
+	key := drainingPeerPrefix + peer.IDB58Encode(pid)
+	err = c.KVSet(api.KV{Key: key, Value: time.Now().UTC().Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+	logger.Infof("draining %s (origin: %s)", pid.Pretty(), origin)
+	ctx, cancel := context.WithTimeout(ctx, c.config.DrainTimeout)
+	err = c.drain(ctx, origin, pid)
+	cancel()
+	// unmark before removing, as the peer may be removing itself
+	c.KVRm(key)
+	if err != nil {
+		return err
+	}
+	return c.peerRemove(origin, pid)
+}
+
+// drainedPin is a pin re-allocated while draining a peer.
+type drainedPin struct {
+	// prev are the allocations before draining.
+	prev []peer.ID
+	// target is the pin with its new allocations, without the peer.
+	target api.Pin
+}
+
+// drain moves the pins of the given peer to other peers and removes it
+// from their allocations once they are pinned elsewhere. When they are
+// not, the pins get their previous allocations back.
+func (c *Cluster) drain(ctx context.Context, origin api.Origin, pid peer.ID) error {
+	drained, err := c.drainAllocations(pid)
+	if err != nil {
+		return err
+	}
+
+	targets := make([]api.Pin, 0, len(drained))
+	for _, d := range drained {
+		targets = append(targets, d.target)
+	}
+	err = c.waitDrained(ctx, targets)
+	if err != nil {
+		return withLeftovers(err, c.rollbackDrain(pid, drained))
+	}
+
+	var left []string
+	for _, target := range targets {
+		curr, ok := c.getCurrentPin(target.Cid)
+		if !ok || !containsPeer(curr.Allocations, pid) {
+			continue // changed in the meantime
+		}
+		pin := curr
+		pin.Allocations = withoutPeer(curr.Allocations, pid)
+		if err = c.consensus.LogPin(pin); err != nil {
+			logger.Errorf("draining: removing %s from the allocations of %s: %s", pid.Pretty(), pin.Cid, err)
+			left = append(left, pin.Cid.String())
+			continue
+		}
+		c.recordAllocationChange(curr, true, pin, api.AllocationDrain)
+		c.recordEvent(origin, api.EventRepin, pin.Cid, pid, "peer drained")
+	}
+	if len(left) > 0 {
+		return withLeftovers(errors.New("draining could not complete"), left)
+	}
+	return nil
+}
+
+// drainAllocations allocates the pins of the given peer to other peers,
+// keeping it among their allocations until they are pinned elsewhere.
+// All the allocations are obtained before committing any of them, so
+// that nothing changes when some pin cannot be re-allocated, and the
+// committed ones are rolled back when committing fails.
+func (c *Cluster) drainAllocations(pid peer.ID) ([]drainedPin, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		return nil, err
+	}
+
+	var drained []drainedPin
+	for _, pin := range cState.ListAllocatedTo(pid) {
+		if !containsPeer(pin.Allocations, pid) { // replicated everywhere
+			continue
+		}
+		target, err := c.allocatePin(pin, []peer.ID{pid}, withoutPeer(pin.Allocations, pid))
+		if err != nil {
+			return nil, fmt.Errorf("cannot re-allocate %s: %s", pin.Cid, err)
+		}
+		drained = append(drained, drainedPin{prev: pin.Allocations, target: target})
+	}
+
+	for i, d := range drained {
+		curr, exists := c.getCurrentPin(d.target.Cid)
+		pin := d.target
+		pin.Allocations = drainAllocationsOf(d, pid)
+		if err := c.consensus.LogPin(pin); err != nil {
+			return nil, withLeftovers(err, c.rollbackDrain(pid, drained[:i]))
+		}
+		c.recordAllocationChange(curr, exists, pin, api.AllocationDrain)
+	}
+	return drained, nil
+}
+
+// drainAllocationsOf returns the allocations committed for a drained pin
+// while waiting for it to be pinned elsewhere: the new ones plus the
+// leaving peer.
+func drainAllocationsOf(d drainedPin, pid peer.ID) []peer.ID {
+	return append(withoutPeer(d.target.Allocations, pid), pid)
+}
+
+// rollbackDrain restores the previous allocations of the drained pins,
+// unless they were changed since. It returns the Cids of the pins which
+// could not be restored and are left allocated to both the leaving peer
+// and its replacements.
+func (c *Cluster) rollbackDrain(pid peer.ID, drained []drainedPin) []string {
+	var left []string
+	for _, d := range drained {
+		curr, ok := c.getCurrentPin(d.target.Cid)
+		if !ok || !sameAllocations(curr.Allocations, drainAllocationsOf(d, pid)) {
+			continue // changed in the meantime
+		}
+		pin := curr
+		pin.Allocations = d.prev
+		if err := c.consensus.LogPin(pin); err != nil {
+			logger.Errorf("draining: restoring the allocations of %s: %s", pin.Cid, err)
+			left = append(left, pin.Cid.String())
+			continue
+		}
+		c.recordAllocationChange(curr, true, pin, api.AllocationDrain)
+	}
+	return left
+}
+
+// withLeftovers adds the Cids of the pins left over-allocated by a
+// failed drain to its error.
+func withLeftovers(err error, left []string) error {
+	if len(left) == 0 {
+		return err
+	}
+	sort.Strings(left)
+	return fmt.Errorf(
+		"%s; %d items are left over-allocated: %s",
+		err,
+		len(left),
+		strings.Join(left, ", "),
+	)
+}
+
+// waitDrained waits until the given pins are pinned by all the peers in
+// their allocations. The error returned when the context is done lists
+// the items which were still pending.
+func (c *Cluster) waitDrained(ctx context.Context, targets []api.Pin) error {
+	pending := make(map[string]api.Pin)
+	for _, target := range targets {
+		pending[target.Cid.String()] = target
+	}
+
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for len(pending) > 0 {
+		cids := make([]*cid.Cid, 0, len(pending))
+		for _, target := range pending {
+			cids = append(cids, target.Cid)
+		}
+		gpis, err := c.StatusCids(cids)
+		if err != nil {
+			logger.Warning(err)
+		}
+		for _, gpi := range gpis {
+			if gpi.Cid == nil {
+				continue
+			}
+			target, ok := pending[gpi.Cid.String()]
+			if ok && pinnedBy(gpi, target.Allocations) {
+				delete(pending, gpi.Cid.String())
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		logger.Infof("draining: waiting for %d items to be pinned", len(pending))
+
+		select {
+		case <-ctx.Done():
+			stopped := "cancelled"
+			if ctx.Err() == context.DeadlineExceeded {
+				stopped = "timed out"
+			}
+			return fmt.Errorf(
+				"draining %s before %d items were pinned elsewhere: %s",
+				stopped,
+				len(pending),
+				strings.Join(pendingCids(pending), ", "),
+			)
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// pendingCids returns the sorted Cids of the pending pins.
+func pendingCids(pending map[string]api.Pin) []string {
+	cids := make([]string, 0, len(pending))
+	for c := range pending {
+		cids = append(cids, c)
+	}
+	sort.Strings(cids)
+	return cids
+}
+
+// pinnedBy returns whether all the given peers report the item as pinned.
+func pinnedBy(gpi api.GlobalPinInfo, peers []peer.ID) bool {
+	for _, p := range peers {
+		if gpi.PeerMap[p].Status != api.TrackerStatusPinned {
+			return false
+		}
+	}
+	return true
+}
+
+// drainingPeers returns the peers marked as leaving the cluster in the
+// shared state.
+func (c *Cluster) drainingPeers() []peer.ID {
+	cState, err := c.consensus.State()
+	if err != nil {
+		return nil
+	}
+	var draining []peer.ID
+	for _, kv := range cState.ListKV() {
+		if !strings.HasPrefix(kv.Key, drainingPeerPrefix) {
+			continue
+		}
+		pid, err := peer.IDB58Decode(strings.TrimPrefix(kv.Key, drainingPeerPrefix))
+		if err != nil {
+			continue
+		}
+		draining = append(draining, pid)
+	}
+	return draining
+}
+
+// withoutPeer returns a copy of the list without the given peer.
+func withoutPeer(list []peer.ID, pid peer.ID) []peer.ID {
+	res := make([]peer.ID, 0, len(list))
+	for _, p := range list {
+		if p != pid {
+			res = append(res, p)
+		}
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestClusterPeerDrain(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	if err := cl.PeerDrain(test.TestPeerID2); err == nil {
+		t.Error("expected an error draining a peer which is not in the cluster")
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.ReplicationFactorMin = 1
+	pin.ReplicationFactorMax = 1
+	if err := cl.Pin(pin); err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	// there is nowhere to move the pin
+	if err := cl.PeerDrain(cl.id); err == nil {
+		t.Fatal("expected an error draining the only peer")
+	}
+	pin, err := cl.PinGet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pin.Allocations) != 1 || pin.Allocations[0] != cl.id {
+		t.Error("the allocations should not have changed:", pin.Allocations)
+	}
+	if len(cl.drainingPeers()) != 0 {
+		t.Error("the peer should not be marked as draining anymore")
+	}
+}
+
+func TestClusterWaitDrainedTimeout(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	drainCheckInterval = 10 * time.Millisecond
+	defer func() { drainCheckInterval = 5 * time.Second }()
+
+	// TestPeerID2 never reports the item as pinned
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.Allocations = []peer.ID{cl.id, test.TestPeerID2}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := cl.waitDrained(ctx, []api.Pin{pin})
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if !strings.Contains(err.Error(), "timed out") || !strings.Contains(err.Error(), test.TestCid1) {
+		t.Error("the error should report the pending items:", err)
+	}
+}
+
+func TestClusterRollbackDrain(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.PinCid(c)
+	pin.Allocations = []peer.ID{test.TestPeerID2, cl.id}
+	if err := cl.consensus.LogPin(pin); err != nil {
+		t.Fatal(err)
+	}
+
+	target := pin
+	target.Allocations = []peer.ID{test.TestPeerID2}
+	drained := []drainedPin{{prev: []peer.ID{cl.id}, target: target}}
+	if left := cl.rollbackDrain(cl.id, drained); len(left) != 0 {
+		t.Fatal("nothing should be left over-allocated:", left)
+	}
+	pin, err := cl.PinGet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pin.Allocations) != 1 || pin.Allocations[0] != cl.id {
+		t.Error("the previous allocations should be restored:", pin.Allocations)
+	}
+
+	err = withLeftovers(errors.New("timed out"), []string{test.TestCid2, test.TestCid1})
+	if !strings.Contains(err.Error(), "2 items are left over-allocated: "+test.TestCid1+", "+test.TestCid2) {
+		t.Error("the error should report the over-allocated items:", err)
+	}
+}
+
+func TestDrainingPeersFilter(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	m := api.Metric{Peer: test.TestPeerID2}
+	if cl.candidateFilters().exclude(m) {
+		t.Fatal("the peer should be a candidate")
+	}
+
+	err := cl.KVSet(api.KV{
+		Key:   drainingPeerPrefix + peer.IDB58Encode(test.TestPeerID2),
+		Value: "now",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	draining := cl.drainingPeers()
+	if len(draining) != 1 || draining[0] != test.TestPeerID2 {
+		t.Fatal("unexpected draining peers:", draining)
+	}
+	if reason := cl.candidateFilters().excludeReason(m); reason != "peer is leaving the cluster" {
+		t.Error("a draining peer should be excluded:", reason)
+	}
+}
+
+func TestWithoutPeer(t *testing.T) {
+	list := []peer.ID{test.TestPeerID1, test.TestPeerID2, test.TestPeerID3}
+	res := withoutPeer(list, test.TestPeerID2)
+	if len(res) != 2 || res[0] != test.TestPeerID1 || res[1] != test.TestPeerID3 {
+		t.Error("unexpected result:", res)
+	}
+	if len(list) != 3 {
+		t.Error("the list should not be modified")
+	}
+}
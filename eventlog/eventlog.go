@@ -0,0 +1,199 @@
+// Package eventlog provides a Log which keeps track of the events happening
+// in a cluster peer (pins, unpins, membership changes, alerts...). Events
+// are persisted in a BoltDB datastore as they happen so that they can be
+// retrieved after a restart, and dropped once they are older than the
+// configured retention.
+package eventlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	"github.com/boltdb/bolt"
+	logging "github.com/ipfs/go-log"
+)
+
+var logger = logging.Logger("eventlog")
+
+var eventsBucket = []byte("events")
+
+// Log stores events in a BoltDB datastore, indexed by their timestamp.
+// When no datastore is used, events are kept in memory.
+type Log struct {
+	mux       sync.RWMutex
+	retention time.Duration
+	db        *bolt.DB
+	events    []api.Event
+}
+
+// New creates a Log which stores events in a datastore at the given path,
+// dropping those which are older than retention. If path is empty, events
+// are only kept in memory. A retention of 0 means events are never
+// dropped.
+func New(path string, retention time.Duration) (*Log, error) {
+	l := &Log{
+		retention: retention,
+	}
+
+	if path == "" {
+		return l, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(eventsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	l.db = db
+
+	err = l.Compact()
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// eventKey returns the key of an event: its timestamp followed by a
+// sequence number, so that keys sort chronologically and never collide.
+func eventKey(t time.Time, seq uint64) []byte {
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, timeKey(t))
+	binary.BigEndian.PutUint64(k[8:], seq)
+	return k
+}
+
+// timeKey returns the sortable representation of a timestamp. Times
+// before the epoch sort first.
+func timeKey(t time.Time) uint64 {
+	if t.Unix() < 0 {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// Append records a new event. The timestamp is set to the
+// current time if not provided.
+func (l *Log) Append(ev api.Event) {
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now()
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.db == nil {
+		l.events = append(l.events, ev)
+		return
+	}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	err = l.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(eventKey(ev.Timestamp, seq), b)
+	})
+	if err != nil {
+		logger.Errorf("error persisting event: %s", err)
+	}
+}
+
+// Since returns the events which happened after the given time, in
+// chronological order.
+func (l *Log) Since(t time.Time) []api.Event {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	evs := []api.Event{}
+	if l.db == nil {
+		for _, ev := range l.events {
+			if ev.Timestamp.After(t) {
+				evs = append(evs, ev)
+			}
+		}
+		return evs
+	}
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		for k, v := c.Seek(eventKey(t, 0)); k != nil; k, v = c.Next() {
+			var ev api.Event
+			if err := json.Unmarshal(v, &ev); err != nil {
+				logger.Warningf("skipping malformed event: %s", err)
+				continue
+			}
+			if ev.Timestamp.After(t) {
+				evs = append(evs, ev)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("error reading events: %s", err)
+	}
+	return evs
+}
+
+// Compact drops events which are older than the retention period.
+func (l *Log) Compact() error {
+	if l.retention <= 0 {
+		return nil
+	}
+	limit := time.Now().Add(-l.retention)
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.db == nil {
+		kept := make([]api.Event, 0, len(l.events))
+		for _, ev := range l.events {
+			if ev.Timestamp.After(limit) {
+				kept = append(kept, ev)
+			}
+		}
+		l.events = kept
+		return nil
+	}
+
+	limitKey := eventKey(limit, 0)
+	return l.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, limitKey) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the underlying datastore.
+func (l *Log) Close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.db == nil {
+		return nil
+	}
+	err := l.db.Close()
+	l.db = nil
+	return err
+}
@@ -0,0 +1,88 @@
+package eventlog
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+var testPath = "testevents"
+
+func TestLogSince(t *testing.T) {
+	l, err := New("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	l.Append(api.Event{Type: api.EventPin, Timestamp: start.Add(-time.Minute)})
+	l.Append(api.Event{Type: api.EventUnpin})
+
+	evs := l.Since(start)
+	if len(evs) != 1 || evs[0].Type != api.EventUnpin {
+		t.Fatal("expected only the unpin event")
+	}
+
+	evs = l.Since(time.Time{})
+	if len(evs) != 2 {
+		t.Fatal("expected all events")
+	}
+}
+
+func TestLogPersistAndRetention(t *testing.T) {
+	defer os.Remove(testPath)
+
+	l, err := New(testPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Append(api.Event{Type: api.EventPin, Timestamp: time.Now().Add(-2 * time.Hour)})
+	l.Append(api.Event{Type: api.EventPeerAdded, Peer: "abc"})
+	l.Close()
+
+	l, err = New(testPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	evs := l.Since(time.Time{})
+	if len(evs) != 1 {
+		t.Fatal("expired event should have been dropped")
+	}
+	if evs[0].Type != api.EventPeerAdded || evs[0].Peer != "abc" {
+		t.Error("event was not restored correctly")
+	}
+}
+
+func TestLogCompact(t *testing.T) {
+	defer os.Remove(testPath)
+
+	l, err := New(testPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Now()
+	l.Append(api.Event{Type: api.EventPin, Timestamp: now.Add(-3 * time.Hour)})
+	l.Append(api.Event{Type: api.EventUnpin, Timestamp: now.Add(-2 * time.Hour)})
+	l.Append(api.Event{Type: api.EventPeerAdded})
+
+	if len(l.Since(time.Time{})) != 3 {
+		t.Fatal("expected all events before compacting")
+	}
+	if err := l.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	evs := l.Since(time.Time{})
+	if len(evs) != 1 || evs[0].Type != api.EventPeerAdded {
+		t.Error("expired events should have been dropped")
+	}
+	if len(l.Since(now.Add(time.Minute))) != 0 {
+		t.Error("expected no events in the future")
+	}
+}
@@ -0,0 +1,265 @@
+package ipfscluster
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// components describes the components used by this peer.
+func (c *Cluster) components() api.IDComponents {
+	comps := api.IDComponents{
+		Consensus:  c.config.Consensus,
+		PinTracker: c.config.PinTracker,
+	}
+	for _, inf := range c.informers {
+		comps.Informers = append(comps.Informers, inf.Name())
+	}
+	if len(c.informers) > 0 {
+		comps.AllocationMetric = c.allocationMetricName()
+	}
+	return comps
+}
+
+// features lists, sorted, the features supported by this peer and
+// those enabled in its configuration.
+func (c *Cluster) features() []string {
+	features := []string{
+		api.FeaturePinPriority,
+		api.FeaturePinExpiration,
+		api.FeaturePeerAnnotations,
+		api.FeatureDrain,
+		api.FeatureSignedMetrics,
+		api.FeatureBatchedCommits,
+	}
+
+	enabled := map[string]bool{
+		api.FeatureRepoGC:           c.supportsRepoGC(),
+		api.FeatureRepinning:        !c.config.DisableRepinning,
+		api.FeatureRPCCompression:   !c.config.DisableRPCCompression,
+		api.FeatureDebugRPC:         c.config.EnableDebugRPC,
+		api.FeatureLocalRPC:         c.config.LocalRPCSocket != "",
+		api.FeaturePinMerge:         c.config.PinMergePolicy == PinMergeMerge,
+		api.FeatureUnderReplication: c.config.UnderReplicationPolicy == UnderReplicationAccept,
+		api.FeatureAutoRecover:      c.config.AutoRecoverInterval > 0,
+		api.FeaturePopularityBoost:  c.config.PopularityHotThreshold > 0,
+		api.FeatureAdd:              c.supportsAdd(),
+		api.FeatureCAR:              c.supportsCAR(),
+	}
+	for f, ok := range enabled {
+		if ok {
+			features = append(features, f)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// Peers advertise their features in the PeerHealth carried by their ping
+// metrics. Features which change how peers interact, or what they write
+// to the shared state, are only used once every peer, or a quorum of
+// them, advertises them, so that clusters running mixed versions during
+// rolling upgrades keep working. Peers whose features are unknown, like
+// those running older versions, count as not supporting any feature.
+
+// gatedFeatures are enabled by watchFeatures once all the cluster peers,
+// or a quorum of them when set to true, advertise them:
+//   - rejecting unsigned metrics would reject those of older peers.
+//   - older peers ignore batched log entries.
+//   - compressed RPC streams are negotiated, so a quorum is enough.
+var gatedFeatures = map[string]bool{
+	api.FeatureSignedMetrics:  false,
+	api.FeatureBatchedCommits: false,
+	api.FeatureRPCCompression: true,
+}
+
+// errNoQuorum is returned when not enough peers advertise a feature.
+var errNoQuorum = errors.New("not enough cluster peers support this feature: upgrade them first")
+
+// peerFeatures returns the features advertised by the cluster peers in
+// the last ping metrics received by the leading peer monitor. Peers which
+// did not advertise features are not included, except this peer.
+func (c *Cluster) peerFeatures() map[peer.ID][]string {
+	features := map[peer.ID][]string{
+		c.id: c.features(),
+	}
+
+	leader, err := c.consensus.Leader()
+	if err != nil {
+		return features
+	}
+
+	var metrics []api.Metric
+	err = c.rpcClient.Call(leader,
+		"Cluster", "PeerMonitorLastMetrics",
+		"ping",
+		&metrics)
+	if err != nil {
+		logger.Debugf("cannot fetch peer features: %s", err)
+		return features
+	}
+
+	for _, m := range metrics {
+		if m.Peer == c.id {
+			continue
+		}
+		ph, err := api.PeerHealthFromString(m.Value)
+		if err != nil || len(ph.Features) == 0 {
+			continue
+		}
+		features[m.Peer] = ph.Features
+	}
+	return features
+}
+
+// Features tells, for every feature advertised by some cluster peer,
+// which peers advertise it.
+func (c *Cluster) Features() ([]api.FeatureSupport, error) {
+	peers, err := c.consensus.Peers()
+	if err != nil {
+		return nil, err
+	}
+	peerFeatures := c.peerFeatures()
+
+	supporting := make(map[string][]string)
+	for _, p := range peers {
+		for _, f := range peerFeatures[p] {
+			supporting[f] = append(supporting[f], peer.IDB58Encode(p))
+		}
+	}
+
+	support := make([]api.FeatureSupport, 0, len(supporting))
+	for f, ps := range supporting {
+		support = append(support, api.FeatureSupport{
+			Feature: f,
+			Peers:   ps,
+			Total:   len(peers),
+			All:     len(ps) == len(peers),
+			Quorum:  len(ps) > len(peers)/2,
+		})
+	}
+	sort.Slice(support, func(i, j int) bool {
+		return support[i].Feature < support[j].Feature
+	})
+	return support, nil
+}
+
+// requireFeature returns errNoQuorum unless all the cluster peers, or
+// more than half of them when quorum is set, advertise the given
+// feature.
+func (c *Cluster) requireFeature(feature string, quorum bool) error {
+	peers, err := c.consensus.Peers()
+	if err != nil {
+		return err
+	}
+
+	n, ok := featureSupport(peers, c.peerFeatures(), feature, quorum)
+	if ok {
+		return nil
+	}
+	logger.Warningf("%d out of %d peers support %s", n, len(peers), feature)
+	return errNoQuorum
+}
+
+// featureSupport returns how many of the given peers advertise a feature
+// and whether they are all of them, or more than half of them when
+// quorum is set.
+func featureSupport(peers []peer.ID, peerFeatures map[peer.ID][]string, feature string, quorum bool) (int, bool) {
+	n := 0
+	for _, p := range peers {
+		if hasFeature(peerFeatures[p], feature) {
+			n++
+		}
+	}
+	return n, n == len(peers) || (quorum && n > len(peers)/2)
+}
+
+// watchFeatures updates the gated features every MonitorPingInterval.
+func (c *Cluster) watchFeatures() {
+	ticker := time.NewTicker(c.config.MonitorPingInterval)
+	defer ticker.Stop()
+	for {
+		c.updateFeatures()
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateFeatures enables the gated features which this peer enables and
+// enough cluster peers advertise, and disables the others.
+func (c *Cluster) updateFeatures() {
+	peers, err := c.consensus.Peers()
+	if err != nil {
+		logger.Debugf("cannot update the enabled features: %s", err)
+		return
+	}
+	own := c.features()
+	peerFeatures := c.peerFeatures()
+
+	for feature, quorum := range gatedFeatures {
+		_, ok := featureSupport(peers, peerFeatures, feature, quorum)
+		enabled := ok && hasFeature(own, feature)
+
+		c.enabledFeaturesMux.Lock()
+		changed := c.enabledFeatures[feature] != enabled
+		c.enabledFeatures[feature] = enabled
+		c.enabledFeaturesMux.Unlock()
+		if !changed {
+			continue
+		}
+
+		if enabled {
+			logger.Infof("enabling %s: supported by the cluster peers", feature)
+		} else {
+			logger.Infof("disabling %s: not supported by enough cluster peers", feature)
+		}
+		if bc, ok := c.consensus.(BatchingConsensus); ok && feature == api.FeatureBatchedCommits {
+			bc.SetBatching(enabled)
+		}
+	}
+}
+
+// featureEnabled returns true when a gated feature is in use.
+func (c *Cluster) featureEnabled(feature string) bool {
+	c.enabledFeaturesMux.RLock()
+	defer c.enabledFeaturesMux.RUnlock()
+	return c.enabledFeatures[feature]
+}
+
+// hasFeature returns true when the list contains the given feature.
+func hasFeature(features []string, feature string) bool {
+	for _, f := range features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// supportsRepoGC returns true when the IPFSConnector can run the garbage
+// collection of the IPFS repository.
+func (c *Cluster) supportsRepoGC() bool {
+	_, ok := c.ipfs.(GarbageCollector)
+	return ok
+}
+
+// supportsAdd returns true when the IPFSConnector can import content
+// added through the cluster.
+func (c *Cluster) supportsAdd() bool {
+	_, ok := c.ipfs.(ContentAdder)
+	return ok
+}
+
+// supportsCAR returns true when the IPFSConnector can import and export
+// CAR files.
+func (c *Cluster) supportsCAR() bool {
+	_, ok := c.ipfs.(CARTransferer)
+	return ok
+}
@@ -0,0 +1,73 @@
+package ipfscluster
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+func TestClusterFeatures(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	support, err := cl.Features()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, fs := range support {
+		if fs.Total != 1 || !fs.All || !fs.Quorum || len(fs.Peers) != 1 {
+			t.Error("unexpected feature support:", fs)
+		}
+		if fs.Feature == api.FeatureDrain {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("the drain feature should be listed")
+	}
+
+	if err := cl.requireFeature(api.FeatureDrain, false); err != nil {
+		t.Error("all peers support draining:", err)
+	}
+	if err := cl.requireFeature("unknown", true); err != errNoQuorum {
+		t.Error("expected errNoQuorum for an unknown feature:", err)
+	}
+}
+
+func TestHealthFeatures(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	ph, err := api.PeerHealthFromString(cl.health().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasFeature(ph.Features, api.FeatureDrain) {
+		t.Error("the ping metric should carry the features:", ph.Features)
+	}
+}
+
+func TestClusterUpdateFeatures(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	cl.enabledFeaturesMux.Lock()
+	cl.enabledFeatures = make(map[string]bool)
+	cl.enabledFeaturesMux.Unlock()
+	if cl.featureEnabled(api.FeatureBatchedCommits) {
+		t.Error("batched commits should not be enabled yet")
+	}
+
+	// a single peer supports everything it enables
+	cl.updateFeatures()
+	if !cl.featureEnabled(api.FeatureBatchedCommits) || !cl.featureEnabled(api.FeatureSignedMetrics) {
+		t.Error("the gated features should be enabled")
+	}
+	if cl.featureEnabled(api.FeatureRPCCompression) != !cl.config.DisableRPCCompression {
+		t.Error("RPC compression should follow the configuration")
+	}
+}
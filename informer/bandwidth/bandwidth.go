@@ -0,0 +1,106 @@
+// Package bandwidth implements an ipfs-cluster informer which provides the
+// inbound or outbound bandwidth rate of the IPFS daemon, as reported by
+// "ipfs stats bw", as an api.Metric.
+package bandwidth
+
+import (
+	"fmt"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricType identifies the bandwidth rate to report.
+type MetricType int
+
+const (
+	// MetricRateIn provides the inbound rate in bytes per second
+	MetricRateIn MetricType = iota
+	// MetricRateOut provides the outbound rate in bytes per second
+	MetricRateOut
+)
+
+var logger = logging.Logger("bwinfo")
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces.
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an initialized informer using the given Config.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// Name returns the user-facing name of this informer, which is
+// "bandwidth_in" or "bandwidth_out".
+func (bw *Informer) Name() string {
+	switch bw.config.Type {
+	case MetricRateOut:
+		return "bandwidth_out"
+	default:
+		return "bandwidth_in"
+	}
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (bw *Informer) SetClient(c *rpc.Client) {
+	bw.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (bw *Informer) Shutdown() error {
+	bw.rpcClient = nil
+	return nil
+}
+
+// GetMetric returns the configured bandwidth rate, in bytes per
+// second, rounded to an integer so that it can be used by the
+// allocators.
+func (bw *Informer) GetMetric() api.Metric {
+	if bw.rpcClient == nil {
+		return api.Metric{
+			Name:  bw.Name(),
+			Valid: false,
+		}
+	}
+
+	var stats api.IPFSBandwidth
+	valid := true
+	err := bw.rpcClient.Call("",
+		"Cluster",
+		"IPFSBandwidthStats",
+		struct{}{},
+		&stats)
+	if err != nil {
+		logger.Error(err)
+		valid = false
+	}
+
+	rate := stats.RateIn
+	if bw.config.Type == MetricRateOut {
+		rate = stats.RateOut
+	}
+
+	m := api.Metric{
+		Name:  bw.Name(),
+		Value: fmt.Sprintf("%.0f", rate),
+		Valid: valid,
+	}
+
+	m.SetTTLDuration(bw.config.MetricTTL)
+	return m
+}
@@ -0,0 +1,46 @@
+package bandwidth
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func Test(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown()
+	m := inf.GetMetric()
+	if m.Valid {
+		t.Error("metric should be invalid")
+	}
+	inf.SetClient(test.NewMockRPCClient(t))
+	m = inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	// See the mock RPC implementation
+	if m.Name != "bandwidth_in" || m.Value != "2048" {
+		t.Error("bad inbound rate metric:", m.Name, m.Value)
+	}
+}
+
+func TestRateOut(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Type = MetricRateOut
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown()
+	inf.SetClient(test.NewMockRPCClient(t))
+	m := inf.GetMetric()
+	if m.Name != "bandwidth_out" || m.Value != "1024" {
+		t.Error("bad outbound rate metric:", m.Name, m.Value)
+	}
+}
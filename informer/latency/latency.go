@@ -0,0 +1,149 @@
+// Package latency implements an ipfs-cluster informer which pings the
+// other cluster peers over libp2p and provides the round-trip times as
+// api.Metrics.
+package latency
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricName is the name of the metric with the average round-trip time
+// to the other peers, in milliseconds. Unreachable peers are left out,
+// and the metric is invalid when no peer can be reached. It can be used
+// for allocations.
+var MetricName = "latency"
+
+// PeersMetricName is the name of the metric with the round-trip time to
+// every other peer. See FormatLatencies.
+var PeersMetricName = "peer_latencies"
+
+var logger = logging.Logger("latencyinfo")
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (li *Informer) SetClient(c *rpc.Client) {
+	li.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (li *Informer) Shutdown() error {
+	li.rpcClient = nil
+	return nil
+}
+
+// Name returns the name of the metric used for allocations.
+func (li *Informer) Name() string {
+	return MetricName
+}
+
+// MetricNames returns the names of the metrics produced by GetMetrics.
+func (li *Informer) MetricNames() []string {
+	return []string{MetricName, PeersMetricName}
+}
+
+// GetMetric returns the average round-trip time to the other peers.
+func (li *Informer) GetMetric() api.Metric {
+	return li.GetMetrics()[0]
+}
+
+// GetMetrics pings the other peers and returns the average round-trip
+// time and the round-trip time to every peer.
+func (li *Informer) GetMetrics() []api.Metric {
+	if li.rpcClient == nil {
+		return []api.Metric{
+			{Name: MetricName, Valid: false},
+			{Name: PeersMetricName, Valid: false},
+		}
+	}
+
+	// Every peer is pinged with its own timeout, so that unreachable
+	// peers do not prevent measuring the others.
+	var latencies []api.PeerLatency
+	err := li.rpcClient.CallContext(context.Background(), "", // Local call
+		"Cluster",             // Service name
+		"PeerLatencies",       // Method name
+		li.config.PingTimeout, // in arg
+		&latencies)            // out arg
+
+	valid := err == nil
+	if err != nil {
+		logger.Error(err)
+	}
+
+	var total time.Duration
+	reachable := 0
+	for _, l := range latencies {
+		if l.Error != "" {
+			logger.Debugf("skipping unreachable peer %s: %s", l.Peer.Pretty(), l.Error)
+			continue
+		}
+		total += l.RTT
+		reachable++
+	}
+	var avg time.Duration
+	if reachable > 0 {
+		avg = total / time.Duration(reachable)
+	}
+
+	metrics := []api.Metric{
+		{
+			Name:  MetricName,
+			Value: fmt.Sprintf("%d", avg/time.Millisecond),
+			Valid: valid && (reachable > 0 || len(latencies) == 0),
+		},
+		{
+			Name:  PeersMetricName,
+			Value: FormatLatencies(latencies),
+			Valid: valid,
+		},
+	}
+	for i := range metrics {
+		metrics[i].SetTTLDuration(li.config.MetricTTL)
+	}
+	return metrics
+}
+
+// FormatLatencies encodes round-trip times as "peer=milliseconds" pairs
+// separated by commas and sorted by peer. Unreachable peers have a -1
+// value.
+func FormatLatencies(latencies []api.PeerLatency) string {
+	pairs := make([]string, 0, len(latencies))
+	for _, l := range latencies {
+		ms := int64(l.RTT / time.Millisecond)
+		if l.Error != "" {
+			ms = -1
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%d", l.Peer.Pretty(), ms))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,85 @@
+package latency
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+)
+
+type mockService struct{}
+
+func mockRPCClient(t *testing.T) *rpc.Client {
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("Cluster", &mockService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (mock *mockService) PeerLatencies(ctx context.Context, in time.Duration, out *[]api.PeerLatency) error {
+	*out = []api.PeerLatency{
+		{
+			Peer: test.TestPeerID2,
+			RTT:  10 * time.Millisecond,
+		},
+		{
+			Peer: test.TestPeerID1,
+			RTT:  30 * time.Millisecond,
+		},
+		{
+			Peer:  test.TestPeerID3,
+			Error: "timeout",
+		},
+	}
+	return nil
+}
+
+func Test(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.PingTimeout = 2 * time.Second
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := inf.GetMetric()
+	if m.Valid {
+		t.Error("metric should be invalid")
+	}
+	inf.SetClient(mockRPCClient(t))
+
+	metrics := inf.GetMetrics()
+	if len(metrics) != 2 {
+		t.Fatal("expected 2 metrics")
+	}
+	for i, name := range inf.MetricNames() {
+		if metrics[i].Name != name || !metrics[i].Valid {
+			t.Error("unexpected metric: ", metrics[i])
+		}
+	}
+
+	// (10 + 30) / 2: unreachable peers are skipped
+	if metrics[0].Value != "20" {
+		t.Error("bad average latency: ", metrics[0].Value)
+	}
+
+	expected := FormatLatencies([]api.PeerLatency{
+		{Peer: test.TestPeerID1, RTT: 30 * time.Millisecond},
+		{Peer: test.TestPeerID2, RTT: 10 * time.Millisecond},
+		{Peer: test.TestPeerID3, Error: "timeout"},
+	})
+	if metrics[1].Value != expected {
+		t.Error("bad peer latencies: ", metrics[1].Value)
+	}
+	if !strings.Contains(expected, test.TestPeerID3.Pretty()+"=-1") {
+		t.Error("unreachable peers should have a -1 latency")
+	}
+}
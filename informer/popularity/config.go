@@ -0,0 +1,87 @@
+package popularity
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "popularity"
+
+// These are the default values for a Config.
+const (
+	DefaultMetricTTL = 30 * time.Second
+	DefaultMaxItems  = 50
+)
+
+// Config allows to initialize an Informer.
+type Config struct {
+	config.Saver
+
+	MetricTTL time.Duration
+
+	// MaxItems is the maximum number of Cids included in the metric,
+	// the most retrieved first.
+	MaxItems int
+}
+
+type jsonConfig struct {
+	MetricTTL string `json:"metric_ttl"`
+	MaxItems  int    `json:"max_items"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.MetricTTL = DefaultMetricTTL
+	cfg.MaxItems = DefaultMaxItems
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.MetricTTL <= 0 {
+		return errors.New("popularity.metric_ttl is invalid")
+	}
+
+	if cfg.MaxItems <= 0 {
+		return errors.New("popularity.max_items is invalid")
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling popularity informer config")
+		return err
+	}
+
+	cfg.Default()
+
+	t, _ := time.ParseDuration(jcfg.MetricTTL)
+	cfg.MetricTTL = t
+	config.SetIfNotDefault(jcfg.MaxItems, &cfg.MaxItems)
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.MetricTTL = cfg.MetricTTL.String()
+	jcfg.MaxItems = cfg.MaxItems
+
+	return config.DefaultJSONMarshal(jcfg)
+}
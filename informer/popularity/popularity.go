@@ -0,0 +1,133 @@
+// Package popularity implements an ipfs-cluster informer which provides
+// how many times the content under every Cid was read through the IPFS
+// proxy of the peer as an api.Metric. The cluster uses these metrics to
+// boost the replication factor of popular content.
+package popularity
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricName specifies the name of our metric
+var MetricName = "popularity"
+
+var logger = logging.Logger("popularityinfo")
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (pi *Informer) SetClient(c *rpc.Client) {
+	pi.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (pi *Informer) Shutdown() error {
+	pi.rpcClient = nil
+	return nil
+}
+
+// Name returns the name of this informer.
+func (pi *Informer) Name() string {
+	return MetricName
+}
+
+// GetMetric returns the number of retrievals of the most retrieved Cids
+// since the previous metric. See FormatRetrievals.
+func (pi *Informer) GetMetric() api.Metric {
+	if pi.rpcClient == nil {
+		return api.Metric{
+			Name:  MetricName,
+			Valid: false,
+		}
+	}
+
+	var retrievals map[string]uint64
+	err := pi.rpcClient.Call("", // Local call
+		"Cluster",        // Service name
+		"IPFSRetrievals", // Method name
+		struct{}{},       // in arg
+		&retrievals)      // out arg
+
+	valid := err == nil
+	if err != nil {
+		logger.Error(err)
+	}
+
+	m := api.Metric{
+		Name:  MetricName,
+		Value: FormatRetrievals(retrievals, pi.config.MaxItems),
+		Valid: valid,
+	}
+	m.SetTTLDuration(pi.config.MetricTTL)
+	return m
+}
+
+// FormatRetrievals encodes the retrievals of up to max Cids, the most
+// retrieved first, as "cid=count" pairs separated by commas.
+func FormatRetrievals(retrievals map[string]uint64, max int) string {
+	cids := make([]string, 0, len(retrievals))
+	for c := range retrievals {
+		cids = append(cids, c)
+	}
+	sort.Slice(cids, func(i, j int) bool {
+		ri, rj := retrievals[cids[i]], retrievals[cids[j]]
+		if ri != rj {
+			return ri > rj
+		}
+		return cids[i] < cids[j]
+	})
+	if len(cids) > max {
+		cids = cids[:max]
+	}
+
+	pairs := make([]string, len(cids), len(cids))
+	for i, c := range cids {
+		pairs[i] = fmt.Sprintf("%s=%d", c, retrievals[c])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// ParseRetrievals decodes a metric value produced by FormatRetrievals.
+// Malformed pairs are skipped.
+func ParseRetrievals(value string) map[string]uint64 {
+	retrievals := make(map[string]uint64)
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		retrievals[kv[0]] += n
+	}
+	return retrievals
+}
@@ -0,0 +1,65 @@
+package popularity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/test"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+)
+
+type mockService struct{}
+
+func mockRPCClient(t *testing.T) *rpc.Client {
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("Cluster", &mockService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (mock *mockService) IPFSRetrievals(ctx context.Context, in struct{}, out *map[string]uint64) error {
+	*out = map[string]uint64{
+		test.TestCid1: 2,
+		test.TestCid2: 10,
+		test.TestCid3: 5,
+	}
+	return nil
+}
+
+func Test(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MaxItems = 2
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := inf.GetMetric()
+	if m.Valid {
+		t.Error("metric should be invalid")
+	}
+	inf.SetClient(mockRPCClient(t))
+	m = inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	expected := test.TestCid2 + "=10," + test.TestCid3 + "=5"
+	if m.Value != expected {
+		t.Errorf("expected %s, got %s", expected, m.Value)
+	}
+}
+
+func TestParseRetrievals(t *testing.T) {
+	r := ParseRetrievals(test.TestCid1 + "=3,bad," + test.TestCid2 + "=x," + test.TestCid3 + "=1")
+	if len(r) != 2 || r[test.TestCid1] != 3 || r[test.TestCid3] != 1 {
+		t.Errorf("unexpected retrievals: %v", r)
+	}
+
+	if len(ParseRetrievals("")) != 0 {
+		t.Error("expected no retrievals")
+	}
+}
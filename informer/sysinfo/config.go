@@ -0,0 +1,110 @@
+package sysinfo
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "sysinfo"
+
+// Default values for sysinfo Config
+const (
+	DefaultMetricTTL  = 30 * time.Second
+	DefaultMetricType = MetricCPU
+)
+
+// String returns a string representation for MetricType.
+func (t MetricType) String() string {
+	switch t {
+	case MetricCPU:
+		return "cpu"
+	case MetricMemory:
+		return "memory"
+	case MetricLoad:
+		return "load"
+	}
+	return ""
+}
+
+// Config is used to initialize an Informer and customize
+// the parameters of the metrics it produces.
+type Config struct {
+	config.Saver
+
+	MetricTTL time.Duration
+	// Type selects the metric returned by GetMetric, which is the
+	// one used for allocations when the informer comes first.
+	Type MetricType
+}
+
+type jsonConfig struct {
+	MetricTTL string `json:"metric_ttl"`
+	Type      string `json:"metric_type"`
+}
+
+// ConfigKey returns a human-friendly identifier for this type of Metric.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.MetricTTL = DefaultMetricTTL
+	cfg.Type = DefaultMetricType
+	return nil
+}
+
+// Validate checks that the fields of this Config have working values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	if cfg.MetricTTL <= 0 {
+		return errors.New("sysinfo.metric_ttl is invalid")
+	}
+
+	if _, ok := metricNames[cfg.Type]; !ok {
+		return errors.New("sysinfo.metric_type is invalid")
+	}
+	return nil
+}
+
+// LoadJSON reads the fields of this Config from a JSON byteslice as
+// generated by ToJSON.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling sysinfo informer config")
+		return err
+	}
+
+	t, _ := time.ParseDuration(jcfg.MetricTTL)
+	cfg.MetricTTL = t
+
+	switch jcfg.Type {
+	case "cpu":
+		cfg.Type = MetricCPU
+	case "memory":
+		cfg.Type = MetricMemory
+	case "load":
+		cfg.Type = MetricLoad
+	default:
+		return errors.New("sysinfo.metric_type is invalid")
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a JSON-formatted human-friendly representation of this
+// Config.
+func (cfg *Config) ToJSON() (raw []byte, err error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.MetricTTL = cfg.MetricTTL.String()
+	jcfg.Type = cfg.Type.String()
+
+	raw, err = config.DefaultJSONMarshal(jcfg)
+	return
+}
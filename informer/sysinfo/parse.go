@@ -0,0 +1,83 @@
+package sysinfo
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var errNotSupported = errors.New("system information is not available on this platform")
+
+// parseCPUTimes reads the aggregated "cpu" line of /proc/stat and returns
+// the idle (including iowait) and total time spent by the CPUs.
+func parseCPUTimes(r io.Reader) (idle, total uint64, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		// user nice system idle iowait irq softirq steal. Guest
+		// times are already included in user and nice.
+		for i, f := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+			total += v
+			if i == 3 || i == 4 {
+				idle += v
+			}
+		}
+		return idle, total, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	return 0, 0, errors.New("cpu line not found")
+}
+
+// parseMemAvailable reads the MemAvailable entry of /proc/meminfo and
+// returns it in bytes.
+func parseMemAvailable(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if len(fields) > 2 && fields[2] == "kB" {
+			v *= 1024
+		}
+		return v, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("MemAvailable not found")
+}
+
+// parseLoadAverage reads the 1-minute load average from /proc/loadavg.
+func parseLoadAverage(r io.Reader) (float64, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("empty load average")
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) == 0 {
+		return 0, errors.New("empty load average")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,30 @@
+package sysinfo
+
+import "os"
+
+func readCPUTimes() (uint64, uint64, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return parseCPUTimes(f)
+}
+
+func readMemAvailable() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseMemAvailable(f)
+}
+
+func readLoadAverage() (float64, error) {
+	f, err := os.Open("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseLoadAverage(f)
+}
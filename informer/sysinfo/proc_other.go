@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package sysinfo
+
+func readCPUTimes() (uint64, uint64, error) {
+	return 0, 0, errNotSupported
+}
+
+func readMemAvailable() (uint64, error) {
+	return 0, errNotSupported
+}
+
+func readLoadAverage() (float64, error) {
+	return 0, errNotSupported
+}
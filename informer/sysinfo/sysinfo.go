@@ -0,0 +1,160 @@
+// Package sysinfo implements an ipfs-cluster informer which provides
+// information about the load of the host running the peer (CPU usage,
+// available memory and load average) as api.Metrics.
+package sysinfo
+
+import (
+	"fmt"
+	"sync"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricType identifies the system information to report.
+type MetricType int
+
+const (
+	// MetricCPU provides the percentage of CPU time used since the
+	// previous metric (or since boot, for the first one).
+	MetricCPU MetricType = iota
+	// MetricMemory provides the memory available for new processes,
+	// in bytes.
+	MetricMemory
+	// MetricLoad provides the 1-minute load average multiplied by 100,
+	// so that it can be compared as an integer by the allocators.
+	MetricLoad
+)
+
+var logger = logging.Logger("sysinfo")
+
+// metricTypes lists all the metric types, in the order in which
+// GetMetrics returns them.
+var metricTypes = []MetricType{MetricCPU, MetricMemory, MetricLoad}
+
+// metricNames maps from a metric type to the name of the metrics
+// produced.
+var metricNames = map[MetricType]string{
+	MetricCPU:    "cpu_usage",
+	MetricMemory: "mem_available",
+	MetricLoad:   "load_avg",
+}
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces.
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+
+	cpuMux    sync.Mutex
+	prevIdle  uint64
+	prevTotal uint64
+}
+
+// NewInformer returns an initialized informer using the given Config.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// Name returns the user-facing name of the metric of the configured type,
+// which is "cpu_usage", "mem_available" or "load_avg".
+func (si *Informer) Name() string {
+	return metricNames[si.config.Type]
+}
+
+// MetricNames returns the names of all the metrics produced by
+// GetMetrics.
+func (si *Informer) MetricNames() []string {
+	names := make([]string, 0, len(metricTypes))
+	for _, t := range metricTypes {
+		names = append(names, metricNames[t])
+	}
+	return names
+}
+
+// SetClient provides us with an rpc.Client. It is not used, since the
+// information is obtained from the operating system.
+func (si *Informer) SetClient(c *rpc.Client) {
+	si.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown.
+func (si *Informer) Shutdown() error {
+	si.rpcClient = nil
+	return nil
+}
+
+// GetMetric returns the metric of the configured type. The metric
+// is invalid when the information is not available in this platform.
+func (si *Informer) GetMetric() api.Metric {
+	return si.getMetric(si.config.Type)
+}
+
+// GetMetrics returns the CPU usage, available memory and load average
+// metrics.
+func (si *Informer) GetMetrics() []api.Metric {
+	metrics := make([]api.Metric, 0, len(metricTypes))
+	for _, t := range metricTypes {
+		metrics = append(metrics, si.getMetric(t))
+	}
+	return metrics
+}
+
+func (si *Informer) getMetric(t MetricType) api.Metric {
+	var value uint64
+	var err error
+	switch t {
+	case MetricCPU:
+		value, err = si.cpuUsage()
+	case MetricMemory:
+		value, err = readMemAvailable()
+	case MetricLoad:
+		var load float64
+		load, err = readLoadAverage()
+		value = uint64(load*100 + 0.5)
+	}
+
+	valid := err == nil
+	if err != nil {
+		logger.Error(err)
+	}
+
+	m := api.Metric{
+		Name:  metricNames[t],
+		Value: fmt.Sprintf("%d", value),
+		Valid: valid,
+	}
+
+	m.SetTTLDuration(si.config.MetricTTL)
+	return m
+}
+
+// cpuUsage returns the percentage of non-idle CPU time since the
+// previous call.
+func (si *Informer) cpuUsage() (uint64, error) {
+	idle, total, err := readCPUTimes()
+	if err != nil {
+		return 0, err
+	}
+
+	si.cpuMux.Lock()
+	defer si.cpuMux.Unlock()
+	dIdle := idle - si.prevIdle
+	dTotal := total - si.prevTotal
+	si.prevIdle = idle
+	si.prevTotal = total
+
+	if dTotal == 0 {
+		return 0, nil
+	}
+	return 100 * (dTotal - dIdle) / dTotal, nil
+}
@@ -0,0 +1,95 @@
+package sysinfo
+
+import (
+	"strings"
+	"testing"
+)
+
+const procStat = `cpu  100 10 50 800 40 0 0 0 0 0
+cpu0 50 5 25 400 20 0 0 0 0 0
+intr 1000
+`
+
+const procMeminfo = `MemTotal:        8000000 kB
+MemFree:         1000000 kB
+MemAvailable:    4000000 kB
+`
+
+const procLoadavg = `0.52 0.58 0.59 2/1000 12345
+`
+
+func TestParseCPUTimes(t *testing.T) {
+	idle, total, err := parseCPUTimes(strings.NewReader(procStat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idle != 840 || total != 1000 {
+		t.Errorf("unexpected cpu times: idle %d, total %d", idle, total)
+	}
+
+	_, _, err = parseCPUTimes(strings.NewReader("intr 1000\n"))
+	if err == nil {
+		t.Error("expected an error without a cpu line")
+	}
+}
+
+func TestParseMemAvailable(t *testing.T) {
+	mem, err := parseMemAvailable(strings.NewReader(procMeminfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mem != 4000000*1024 {
+		t.Error("unexpected available memory: ", mem)
+	}
+}
+
+func TestParseLoadAverage(t *testing.T) {
+	load, err := parseLoadAverage(strings.NewReader(procLoadavg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if load != 0.52 {
+		t.Error("unexpected load average: ", load)
+	}
+}
+
+func Test(t *testing.T) {
+	for _, mt := range []MetricType{MetricCPU, MetricMemory, MetricLoad} {
+		cfg := &Config{}
+		cfg.Default()
+		cfg.Type = mt
+		inf, err := NewInformer(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := inf.GetMetric()
+		if m.Name != metricNames[mt] {
+			t.Error("unexpected metric name: ", m.Name)
+		}
+		if m.Valid && m.Value == "" {
+			t.Error("valid metrics should have a value")
+		}
+		inf.Shutdown()
+	}
+}
+
+func TestGetMetrics(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown()
+
+	names := inf.MetricNames()
+	metrics := inf.GetMetrics()
+	if len(metrics) != 3 || len(names) != 3 {
+		t.Fatal("expected 3 metrics")
+	}
+	for i, m := range metrics {
+		if m.Name != names[i] {
+			t.Error("unexpected metric name: ", m.Name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package tags
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "tags"
+
+// These are the default values for a Config.
+const (
+	DefaultMetricTTL = 30 * time.Second
+)
+
+// Config allows to initialize an Informer.
+type Config struct {
+	config.Saver
+
+	MetricTTL time.Duration
+
+	// Tags are the labels of this peer (i.e. "region": "eu-west",
+	// "disk": "ssd").
+	Tags map[string]string
+}
+
+type jsonConfig struct {
+	MetricTTL string            `json:"metric_ttl"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.MetricTTL = DefaultMetricTTL
+	cfg.Tags = nil
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.MetricTTL <= 0 {
+		return errors.New("tags.metric_ttl is invalid")
+	}
+
+	for k, v := range cfg.Tags {
+		if k == "" || strings.ContainsAny(k, "=,") || strings.Contains(v, ",") {
+			return errors.New("tags.tags contains an invalid tag")
+		}
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling tags informer config")
+		return err
+	}
+
+	t, _ := time.ParseDuration(jcfg.MetricTTL)
+	cfg.MetricTTL = t
+	cfg.Tags = jcfg.Tags
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.MetricTTL = cfg.MetricTTL.String()
+	jcfg.Tags = cfg.Tags
+
+	return config.DefaultJSONMarshal(jcfg)
+}
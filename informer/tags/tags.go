@@ -0,0 +1,97 @@
+// Package tags implements an ipfs-cluster informer which publishes the
+// tags configured by the operator for this peer (i.e. region, zone or
+// rack) as an api.Metric.
+package tags
+
+import (
+	"sort"
+	"strings"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricName specifies the name of our metric
+var MetricName = "tags"
+
+var logger = logging.Logger("tagsinfo")
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	config *Config
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// SetClient does nothing, as the tags are read from the configuration.
+func (ti *Informer) SetClient(c *rpc.Client) {}
+
+// Shutdown does nothing.
+func (ti *Informer) Shutdown() error {
+	return nil
+}
+
+// Name returns the name of this informer
+func (ti *Informer) Name() string {
+	return MetricName
+}
+
+// Tags returns a copy of the tags of this peer.
+func (ti *Informer) Tags() map[string]string {
+	tags := make(map[string]string, len(ti.config.Tags))
+	for k, v := range ti.config.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// GetMetric returns a metric whose value are the configured tags as
+// "key=value" pairs separated by commas and sorted by key
+// (i.e. "disk=ssd,region=eu-west"). See ParseTags.
+func (ti *Informer) GetMetric() api.Metric {
+	m := api.Metric{
+		Name:  MetricName,
+		Value: FormatTags(ti.config.Tags),
+		Valid: true,
+	}
+
+	m.SetTTLDuration(ti.config.MetricTTL)
+	return m
+}
+
+// FormatTags encodes tags as the value of a tags metric.
+func FormatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ParseTags decodes the value of a tags metric. Malformed pairs
+// are ignored.
+func ParseTags(value string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags
+}
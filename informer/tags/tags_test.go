@@ -0,0 +1,37 @@
+package tags
+
+import "testing"
+
+func Test(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Tags = map[string]string{
+		"region": "eu-west",
+		"disk":   "ssd",
+	}
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	if m.Value != "disk=ssd,region=eu-west" {
+		t.Error("bad metric value: ", m.Value)
+	}
+
+	tags := ParseTags(m.Value)
+	if len(tags) != 2 || tags["region"] != "eu-west" || tags["disk"] != "ssd" {
+		t.Error("tags did not survive")
+	}
+
+	inf.Tags()["region"] = "us-east"
+	if cfg.Tags["region"] != "eu-west" {
+		t.Error("Tags should return a copy")
+	}
+
+	if len(ParseTags("")) != 0 {
+		t.Error("expected no tags")
+	}
+}
@@ -0,0 +1,101 @@
+package tracked
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "tracked"
+
+// These are the default values for a Config.
+const (
+	DefaultMetricTTL  = 10 * time.Second
+	DefaultMetricType = MetricTrackedPins
+)
+
+// String returns a string representation for MetricType.
+func (t MetricType) String() string {
+	switch t {
+	case MetricTrackedPins:
+		return "tracked"
+	case MetricPinQueue:
+		return "queue"
+	}
+	return ""
+}
+
+// Config allows to initialize an Informer.
+type Config struct {
+	config.Saver
+
+	MetricTTL time.Duration
+	Type      MetricType
+}
+
+type jsonConfig struct {
+	MetricTTL string `json:"metric_ttl"`
+	Type      string `json:"metric_type,omitempty"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.MetricTTL = DefaultMetricTTL
+	cfg.Type = DefaultMetricType
+	return nil
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if cfg.MetricTTL <= 0 {
+		return errors.New("tracked.metric_ttl is invalid")
+	}
+
+	if cfg.Type.String() == "" {
+		return errors.New("tracked.metric_type is invalid")
+	}
+
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	t, _ := time.ParseDuration(jcfg.MetricTTL)
+	cfg.MetricTTL = t
+
+	switch jcfg.Type {
+	case "", "tracked":
+		cfg.Type = MetricTrackedPins
+	case "queue":
+		cfg.Type = MetricPinQueue
+	default:
+		return errors.New("tracked.metric_type is invalid")
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.MetricTTL = cfg.MetricTTL.String()
+	jcfg.Type = cfg.Type.String()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
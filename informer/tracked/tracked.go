@@ -0,0 +1,131 @@
+// Package tracked implements an ipfs-cluster informer which determines how
+// many items this peer's pin tracker has pinned or is pinning, or how many
+// pin operations it has queued, and returns it as api.Metric.
+package tracked
+
+import (
+	"fmt"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// MetricType identifies the value provided by the informer.
+type MetricType int
+
+const (
+	// MetricTrackedPins provides the number of pinned and pinning items
+	MetricTrackedPins MetricType = iota
+	// MetricPinQueue provides the number of queued and ongoing pin and
+	// unpin operations
+	MetricPinQueue
+)
+
+// MetricName specifies the name of our metric
+var MetricName = "trackedpins"
+
+// QueueMetricName specifies the name of the metric produced with
+// MetricPinQueue
+var QueueMetricName = "pinqueue"
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (ti *Informer) SetClient(c *rpc.Client) {
+	ti.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (ti *Informer) Shutdown() error {
+	ti.rpcClient = nil
+	return nil
+}
+
+// Name returns the name of this informer, which is "trackedpins" or
+// "pinqueue" depending on the metric type.
+func (ti *Informer) Name() string {
+	if ti.config.Type == MetricPinQueue {
+		return QueueMetricName
+	}
+	return MetricName
+}
+
+// GetMetric asks the local PinTracker for the status of all the items.
+// With MetricTrackedPins, it returns how many of them are pinned or being
+// pinned. Queued and errored items are not counted, so a tracker which
+// stops making progress produces a value lower than expected. With
+// MetricPinQueue, it returns how many pin and unpin operations are queued
+// or ongoing, so that the allocator can prefer peers which are not
+// backlogged.
+func (ti *Informer) GetMetric() api.Metric {
+	if ti.rpcClient == nil {
+		return api.Metric{
+			Name:  ti.Name(),
+			Valid: false,
+		}
+	}
+
+	var pinfos []api.PinInfoSerial
+	err := ti.rpcClient.Call("", // Local call
+		"Cluster",          // Service name
+		"TrackerStatusAll", // Method name
+		struct{}{},         // in arg
+		&pinfos)            // out arg
+
+	valid := err == nil
+
+	n := 0
+	for _, pinfo := range pinfos {
+		if ti.countStatus(api.TrackerStatusFromString(pinfo.Status)) {
+			n++
+		}
+	}
+
+	m := api.Metric{
+		Name:  ti.Name(),
+		Value: fmt.Sprintf("%d", n),
+		Valid: valid,
+	}
+
+	m.SetTTLDuration(ti.config.MetricTTL)
+	return m
+}
+
+// countStatus returns whether items with the given status are counted for
+// the configured metric type.
+func (ti *Informer) countStatus(st api.TrackerStatus) bool {
+	switch ti.config.Type {
+	case MetricPinQueue:
+		switch st {
+		case api.TrackerStatusPinQueued, api.TrackerStatusPinning,
+			api.TrackerStatusUnpinQueued, api.TrackerStatusUnpinning:
+			return true
+		}
+	default:
+		switch st {
+		case api.TrackerStatusPinned, api.TrackerStatusPinning:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package tracked
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+)
+
+type mockService struct{}
+
+func mockRPCClient(t *testing.T) *rpc.Client {
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("Cluster", &mockService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (mock *mockService) TrackerStatusAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+	*out = []api.PinInfoSerial{
+		{
+			Cid:    "QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa",
+			Status: api.TrackerStatusPinned.String(),
+		},
+		{
+			Cid:    "QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6",
+			Status: api.TrackerStatusPinning.String(),
+		},
+		{
+			Cid:    "QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc",
+			Status: api.TrackerStatusPinQueued.String(),
+		},
+		{
+			Cid:    "QmZ4zcYAcHZH6U7Bg6ZeU3t5RvjU3D3J4RNaNrXczbCLhY",
+			Status: api.TrackerStatusRemote.String(),
+		},
+	}
+	return nil
+}
+
+func Test(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := inf.GetMetric()
+	if m.Valid {
+		t.Error("metric should be invalid")
+	}
+	inf.SetClient(mockRPCClient(t))
+	m = inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	if m.Value != "2" {
+		t.Error("bad metric value")
+	}
+}
+
+func TestPinQueue(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Type = MetricPinQueue
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inf.Name() != QueueMetricName {
+		t.Error("bad informer name")
+	}
+	inf.SetClient(mockRPCClient(t))
+	m := inf.GetMetric()
+	if !m.Valid {
+		t.Error("metric should be valid")
+	}
+	if m.Name != QueueMetricName {
+		t.Error("bad metric name")
+	}
+	if m.Value != "2" {
+		t.Error("bad metric value")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
@@ -24,6 +25,37 @@ func jsonFormatObject(resp interface{}) {
 		jsonFormatPrint(resp.(api.Version))
 	case api.Error:
 		jsonFormatPrint(resp.(api.Error))
+	case api.KV:
+		jsonFormatPrint(resp.(api.KV))
+	case []api.KV:
+		jsonFormatPrint(resp.([]api.KV))
+	case api.Webhook:
+		jsonFormatPrint(resp.(api.Webhook))
+	case []api.Webhook:
+		jsonFormatPrint(resp.([]api.Webhook))
+	case []api.StrayPin:
+		jsonFormatPrint(resp.([]api.StrayPin))
+	case []api.PinAttempt:
+		jsonFormatPrint(resp.([]api.PinAttempt))
+	case []api.AllocationChange:
+		jsonFormatPrint(resp.([]api.AllocationChange))
+	case []api.AddedOutput:
+		jsonFormatPrint(resp.([]api.AddedOutput))
+	case []api.FeatureSupport:
+		jsonFormatPrint(resp.([]api.FeatureSupport))
+	case api.PinEstimate:
+		jsonFormatPrint(resp.(api.PinEstimate))
+	case api.RaftHealth:
+		jsonFormatPrint(resp.(api.RaftHealth))
+	case api.PinQueue:
+		jsonFormatPrint(resp.(api.PinQueue))
+	case []api.Metric:
+		r := resp.([]api.Metric)
+		serials := make([]api.MetricSerial, len(r), len(r))
+		for i, item := range r {
+			serials[i] = item.ToSerial()
+		}
+		jsonFormatPrint(serials)
 	case []api.ID:
 		r := resp.([]api.ID)
 		serials := make([]api.IDSerial, len(r), len(r))
@@ -76,6 +108,54 @@ func textFormatObject(resp interface{}) {
 	case api.Error:
 		serial := resp.(api.Error)
 		textFormatPrintError(&serial)
+	case api.KV:
+		serial := resp.(api.KV)
+		textFormatPrintKV(&serial)
+	case []api.KV:
+		for _, item := range resp.([]api.KV) {
+			textFormatPrintKV(&item)
+		}
+	case api.Webhook:
+		serial := resp.(api.Webhook)
+		textFormatPrintWebhook(&serial)
+	case []api.Webhook:
+		for _, item := range resp.([]api.Webhook) {
+			textFormatPrintWebhook(&item)
+		}
+	case []api.StrayPin:
+		for _, item := range resp.([]api.StrayPin) {
+			textFormatPrintStrayPin(&item)
+		}
+	case []api.PinAttempt:
+		for _, item := range resp.([]api.PinAttempt) {
+			textFormatPrintPinAttempt(&item)
+		}
+	case []api.AllocationChange:
+		for _, item := range resp.([]api.AllocationChange) {
+			textFormatPrintAllocationChange(&item)
+		}
+	case []api.AddedOutput:
+		for _, item := range resp.([]api.AddedOutput) {
+			textFormatPrintAddedOutput(&item)
+		}
+	case []api.FeatureSupport:
+		for _, item := range resp.([]api.FeatureSupport) {
+			textFormatPrintFeatureSupport(&item)
+		}
+	case api.RaftHealth:
+		serial := resp.(api.RaftHealth)
+		textFormatPrintRaftHealth(&serial)
+	case api.PinQueue:
+		serial := resp.(api.PinQueue)
+		textFormatPrintPinQueue(&serial)
+	case api.PinEstimate:
+		serial := resp.(api.PinEstimate)
+		textFormatPrintPinEstimate(&serial)
+	case []api.Metric:
+		for _, item := range resp.([]api.Metric) {
+			serial := item.ToSerial()
+			textFormatPrintMetric(&serial)
+		}
 	case []api.ID:
 		for _, item := range resp.([]api.ID) {
 			textFormatObject(item)
@@ -110,6 +190,28 @@ func textFormatPrintIDSerial(obj *api.IDSerial) {
 	for _, a := range addrs {
 		fmt.Printf("    - %s\n", a)
 	}
+	if len(obj.Tags) > 0 {
+		tags := make(sort.StringSlice, 0, len(obj.Tags))
+		for k, v := range obj.Tags {
+			tags = append(tags, k+"="+v)
+		}
+		tags.Sort()
+		fmt.Printf("  > Tags: %s\n", strings.Join(tags, ", "))
+	}
+	if obj.Role != "" {
+		fmt.Printf("  > Role: %s\n", obj.Role)
+	}
+	if obj.Annotation != "" {
+		fmt.Printf("  > Annotation: %s\n", obj.Annotation)
+	}
+	if obj.Components.Consensus != "" {
+		comps := obj.Components
+		fmt.Printf("  > Components: consensus: %s | pin tracker: %s | informers: %s\n",
+			comps.Consensus, comps.PinTracker, strings.Join(comps.Informers, ", "))
+	}
+	if len(obj.Features) > 0 {
+		fmt.Printf("  > Features: %s\n", strings.Join(obj.Features, ", "))
+	}
 	if obj.IPFS.Error != "" {
 		fmt.Printf("  > IPFS ERROR: %s\n", obj.IPFS.Error)
 		return
@@ -127,7 +229,14 @@ func textFormatPrintIDSerial(obj *api.IDSerial) {
 }
 
 func textFormatPrintGPInfo(obj *api.GlobalPinInfoSerial) {
-	fmt.Printf("%s :\n", obj.Cid)
+	header := []string{obj.Cid}
+	if obj.Name != "" {
+		header = append(header, obj.Name)
+	}
+	if len(obj.Metadata) > 0 {
+		header = append(header, formatMetadata(obj.Metadata))
+	}
+	fmt.Printf("%s :\n", strings.Join(header, " | "))
 	peers := make(sort.StringSlice, 0, len(obj.PeerMap))
 	for k := range obj.PeerMap {
 		peers = append(peers, k)
@@ -136,12 +245,45 @@ func textFormatPrintGPInfo(obj *api.GlobalPinInfoSerial) {
 
 	for _, k := range peers {
 		v := obj.PeerMap[k]
+		label := k
+		if v.Peername != "" {
+			label = fmt.Sprintf("%s (%s)", v.Peername, k)
+		}
+		retries := ""
+		if v.Attempts > 0 {
+			retries = fmt.Sprintf(" | %d failed attempts", v.Attempts)
+			if v.NextRetry != "" {
+				retries += fmt.Sprintf(", retrying at %s", v.NextRetry)
+			}
+		}
 		if v.Error != "" {
-			fmt.Printf("    > Peer %s : ERROR | %s\n", k, v.Error)
+			fmt.Printf("    > Peer %s : ERROR | %s%s\n", label, v.Error, retries)
+			continue
+		}
+		holders := ""
+		if len(v.Allocations) > 0 {
+			holders = " | held by: " + remoteHolders(obj, v.Allocations)
+		}
+		fmt.Printf("    > Peer %s : %s | %s%s%s\n", label, strings.ToUpper(v.Status), v.TS, retries, holders)
+	}
+}
+
+// remoteHolders describes the peers which hold an item, with their status
+// when it is part of the given GlobalPinInfo.
+func remoteHolders(obj *api.GlobalPinInfoSerial, allocs []string) string {
+	holders := make([]string, len(allocs), len(allocs))
+	for i, p := range allocs {
+		holders[i] = p
+		pinfo, ok := obj.PeerMap[p]
+		if !ok {
 			continue
 		}
-		fmt.Printf("    > Peer %s : %s | %s\n", k, strings.ToUpper(v.Status), v.TS)
+		if pinfo.Peername != "" {
+			holders[i] = pinfo.Peername
+		}
+		holders[i] += fmt.Sprintf(" (%s)", strings.ToUpper(pinfo.Status))
 	}
+	return strings.Join(holders, ", ")
 }
 
 func textFormatPrintPInfo(obj *api.PinInfoSerial) {
@@ -162,18 +304,187 @@ func textFormatPrintPin(obj *api.PinSerial) {
 	fmt.Printf("%s | %s | ", obj.Cid, obj.Name)
 
 	if obj.ReplicationFactorMin < 0 {
-		fmt.Printf("Repl. Factor: -1 | Allocations: [everywhere]\n")
+		fmt.Printf("Repl. Factor: -1 | Allocations: [everywhere]")
 	} else {
 		var sortAlloc sort.StringSlice = obj.Allocations
 		sortAlloc.Sort()
-		fmt.Printf("Repl. Factor: %d--%d | Allocations: %s\n",
+		fmt.Printf("Repl. Factor: %d--%d | Allocations: %s",
 			obj.ReplicationFactorMin, obj.ReplicationFactorMax,
 			sortAlloc)
 	}
+	if obj.Priority == api.PinPriorityHigh {
+		fmt.Printf(" | Priority: %s", obj.Priority)
+	}
+	switch obj.Type {
+	case api.MetaType:
+		fmt.Printf(" | Sharded DAG")
+	case api.ShardType:
+		fmt.Printf(" | Shard of %s", obj.Reference)
+	default:
+		switch {
+		case !obj.Recursive:
+			fmt.Printf(" | Mode: direct")
+		case obj.MaxDepth > 0:
+			fmt.Printf(" | Mode: recursive (max depth %d)", obj.MaxDepth)
+		}
+	}
+	if obj.ToPin().UnderReplicated() {
+		fmt.Printf(" | Under-replicated")
+	}
+	if obj.ExpireAt != 0 {
+		fmt.Printf(" | Expires: %s", time.Unix(0, obj.ExpireAt).Format(time.RFC3339))
+	}
+	if len(obj.Metadata) > 0 {
+		fmt.Printf(" | Metadata: %s", formatMetadata(obj.Metadata))
+	}
+	fmt.Printf("\n")
+}
+
+// formatMetadata prints pin metadata as sorted key=value pairs.
+func formatMetadata(metadata map[string]string) string {
+	pairs := make(sort.StringSlice, 0, len(metadata))
+	for k, v := range metadata {
+		pairs = append(pairs, k+"="+v)
+	}
+	pairs.Sort()
+	return strings.Join(pairs, ", ")
+}
+
+func textFormatPrintMetric(obj *api.MetricSerial) {
+	received := time.Unix(0, obj.Received).Format(time.RFC3339)
+	expire := time.Unix(0, obj.Expire).Format(time.RFC3339)
+	p := obj.Peer
+	if obj.Peername != "" {
+		p = fmt.Sprintf("%s (%s)", obj.Peername, obj.Peer)
+	}
+	fmt.Printf("%s | %s | %s: %s | Expires: %s | Valid: %t\n",
+		received, p, obj.Name, obj.Value, expire, obj.Valid)
+}
+
+func textFormatPrintKV(obj *api.KV) {
+	fmt.Printf("%s: %s\n", obj.Key, obj.Value)
+}
+
+func textFormatPrintWebhook(obj *api.Webhook) {
+	fmt.Printf("%s | %s", obj.ID, obj.URL)
+	if len(obj.Events) > 0 {
+		fmt.Printf(" | Events: %s", strings.Join(obj.Events, ", "))
+	}
+	if obj.Namespace != "" {
+		fmt.Printf(" | Namespace: %s", obj.Namespace)
+	}
+	if len(obj.Metadata) > 0 {
+		fmt.Printf(" | Metadata: %s", formatMetadata(obj.Metadata))
+	}
+	fmt.Printf("\n")
+}
+
+func textFormatPrintAddedOutput(obj *api.AddedOutput) {
+	fmt.Printf("added %s %s\n", obj.Cid, obj.Name)
+}
+
+func textFormatPrintFeatureSupport(obj *api.FeatureSupport) {
+	status := "some peers"
+	switch {
+	case obj.All:
+		status = "all peers"
+	case obj.Quorum:
+		status = "quorum"
+	}
+	fmt.Printf("%s: %d/%d peers (%s)\n", obj.Feature, len(obj.Peers), obj.Total, status)
+}
+
+func textFormatPrintStrayPin(obj *api.StrayPin) {
+	peer := obj.Peer
+	if obj.Peername != "" {
+		peer = obj.Peername
+	}
+	fmt.Printf("%s: %s", obj.Cid, peer)
+	if obj.Tracked {
+		fmt.Printf(" | tracked")
+	}
+	if obj.Ignored {
+		fmt.Printf(" | ignored")
+	}
+	fmt.Printf("\n")
+}
+
+func textFormatPrintPinAttempt(obj *api.PinAttempt) {
+	peer := obj.Peer
+	if obj.Peername != "" {
+		peer = obj.Peername
+	}
+	fmt.Printf("%s | %s | %s | %s (%s)",
+		obj.Timestamp.Format(time.RFC3339), peer, obj.Cid, obj.Operation, obj.Duration)
+	if obj.Error != "" {
+		fmt.Printf(" | ERROR: %s", obj.Error)
+	}
+	fmt.Printf("\n")
+}
+
+func textFormatPrintAllocationChange(obj *api.AllocationChange) {
+	peer := obj.Peer
+	if obj.Peername != "" {
+		peer = obj.Peername
+	}
+	fmt.Printf("%s | %s | %s | %s: %s -> %s\n",
+		obj.Timestamp.Format(time.RFC3339), peer, obj.Cid, obj.Reason, obj.From, obj.To)
+}
+
+func textFormatPrintRaftHealth(obj *api.RaftHealth) {
+	peer := obj.Peer
+	if obj.Peername != "" {
+		peer = obj.Peername
+	}
+	fmt.Printf("%s | %s | Leader: %s | Term: %d\n", peer, obj.State, obj.Leader, obj.Term)
+	fmt.Printf("  Log: last index %d | commit index %d | applied index %d | %d entries\n",
+		obj.LastLogIndex, obj.CommitIndex, obj.AppliedIndex, obj.LogEntries)
+	if obj.LastSnapshot.IsZero() {
+		fmt.Printf("  Last snapshot: none\n")
+	} else {
+		fmt.Printf("  Last snapshot: index %d at %s\n", obj.LastSnapshotIndex, obj.LastSnapshot.Format(time.RFC3339))
+	}
+	fmt.Printf("  Leader changes: %d | Commit latency: %s\n", obj.LeaderChanges, obj.CommitLatency)
+}
+
+func textFormatPrintPinQueue(obj *api.PinQueue) {
+	peer := obj.Peer
+	if obj.Peername != "" {
+		peer = obj.Peername
+	}
+	fmt.Printf("%s | Queued pins: %d | Queued unpins: %d | In progress: %d\n",
+		peer, obj.PinQueued, obj.UnpinQueued, obj.InProgress)
+	fmt.Printf("  Pins done: %d | Pins failed: %d | Rate: %.2f/s | Unpins pending GC: %d\n",
+		obj.PinsDone, obj.PinsFailed, obj.PinRate, obj.PendingGC)
+	for _, op := range obj.Operations {
+		fmt.Printf("  > %s | %s | %s since %s\n",
+			op.Cid, op.Type, op.Status, op.Since.Format(time.RFC3339))
+	}
+}
+
+func textFormatPrintPinEstimate(obj *api.PinEstimate) {
+	fmt.Printf("%s | Size: %d | Replication: %d | Total size: %d\n",
+		obj.Cid, obj.Size, obj.Replication, obj.TotalSize)
+	fmt.Printf("  Allocations: %s\n", obj.Allocations)
+	if obj.Feasible {
+		fmt.Printf("  Feasible: yes\n")
+		return
+	}
+	fmt.Printf("  Feasible: no (%s)\n", obj.Reason)
 }
 
 func textFormatPrintError(obj *api.Error) {
 	fmt.Printf("An error occurred:\n")
 	fmt.Printf("  Code: %d\n", obj.Code)
 	fmt.Printf("  Message: %s\n", obj.Message)
+	if obj.Allocation != nil {
+		fmt.Printf("  Allocation candidates for %s:\n", obj.Allocation.Cid)
+		for _, c := range obj.Allocation.Candidates {
+			if c.Usable {
+				fmt.Printf("    > %s: usable\n", c.Peer)
+			} else {
+				fmt.Printf("    > %s: %s\n", c.Peer, c.Reason)
+			}
+		}
+	}
 }
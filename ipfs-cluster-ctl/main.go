@@ -27,7 +27,7 @@ const programName = `ipfs-cluster-ctl`
 const Version = "0.3.5"
 
 var (
-	defaultHost          = "/ip4/127.0.0.1/tcp/9094"
+	defaultHost          = api.PreferredAddr("/ip4/127.0.0.1/tcp/9094", "/ip6/::1/tcp/9094")
 	defaultTimeout       = 120
 	defaultUsername      = ""
 	defaultPassword      = ""
@@ -53,6 +53,10 @@ API endpoint, use "--host" with the full cluster libp2p listener
 address (including the "/ipfs/<peerID>" part), and --secret (the
 32-byte cluster secret as it appears in the cluster configuration).
 
+Requests fail after --timeout seconds, and the peer serving them stops
+working on them then. With --retries, idempotent requests are retried when
+the API cannot be reached or is temporarily unavailable.
+
 For feedback, bug reports or any additional information, visit
 https://github.com/ipfs/ipfs-cluster.
 `,
@@ -110,7 +114,12 @@ func main() {
 		cli.IntFlag{
 			Name:  "timeout, t",
 			Value: defaultTimeout,
-			Usage: "number of seconds to wait before timing out a request",
+			Usage: "number of seconds to wait before timing out a request. The peer stops serving it too",
+		},
+		cli.IntFlag{
+			Name:  "retries",
+			Value: 0,
+			Usage: "number of times to retry an idempotent request when the API cannot be reached or is unavailable",
 		},
 		cli.BoolFlag{
 			Name:  "debug, d",
@@ -156,6 +165,7 @@ requires authorization. implies --https, which you can disable with --force-http
 		}
 
 		cfg.Timeout = time.Duration(c.Int("timeout")) * time.Second
+		cfg.Retries = c.Int("retries")
 
 		if cfg.PeerAddr != nil && c.Bool("https") {
 			logger.Warning("Using libp2p-http. SSL flags will be ignored")
@@ -205,15 +215,48 @@ This command displays information about the peer that the tool is contacting
 					Usage: "list the nodes participating in the IPFS Cluster",
 					Description: `
 This command provides a list of the ID information of all the peers in the Cluster.
+
+With --verbose, the annotations of the peers (see "peers annotate") are
+included.
 `,
-					Flags:     []cli.Flag{},
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "verbose, v",
+							Usage: "include the annotations of the peers",
+						},
+					},
 					ArgsUsage: " ",
 					Action: func(c *cli.Context) error {
 						resp, cerr := globalClient.Peers()
+						if !c.Bool("verbose") {
+							for i := range resp {
+								resp[i].Annotation = ""
+							}
+						}
 						formatResponse(c, resp, cerr)
 						return nil
 					},
 				},
+				{
+					Name:  "annotate",
+					Usage: "set a free-form annotation for a peer",
+					Description: `
+This command attaches a free-form annotation to a peer, i.e. its location
+or who to contact about it ("host: rack 12, contact: ops@example.org"). The
+annotation is stored in the shared state, so it is seen by all the peers,
+and it is shown by "peers ls --verbose". It replaces any previous
+annotation. When no annotation is given, the current one is removed.
+`,
+					ArgsUsage: "<peer ID> [annotation]",
+					Action: func(c *cli.Context) error {
+						p, err := peer.IDB58Decode(c.Args().First())
+						checkErr("parsing peer ID", err)
+						annotation := strings.Join(c.Args().Tail(), " ")
+						cerr := globalClient.AnnotatePeer(p, annotation)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
 				{
 					Name:  "rm",
 					Usage: "remove a peer from the Cluster",
@@ -236,6 +279,225 @@ cluster peers.
 				},
 			},
 		},
+		{
+			Name:  "add",
+			Usage: "Add files and directories to IPFS Cluster",
+			Description: `
+This command imports the given files and directories, recursively, in the
+IPFS daemon of the cluster peer and pins the resulting root CIDs in the
+cluster, like "ipfs add" followed by "pin add". The content is not
+pinned in that daemon unless it is allocated to it: the allocated peers
+fetch it from there.
+
+--chunker, --cid-version, --hash, --raw-leaves and --wrap-with-directory
+work like the "ipfs add" options of the same name. The pin options work
+like those of "pin add". Unless --name is given, each pin is named after
+the file or directory it pins.
+
+With --shard, content too large for a single peer is split in shards of
+up to --shard-size bytes (100MiB by default), each pinned with the given
+options and allocated, when possible, to different peers. The root CID
+is then pinned as a sharded DAG: unpinning it unpins all its shards.
+
+The command lists the CIDs of all the imported items, unless --quiet is
+given, in which case it only prints the pinned root CIDs.
+`,
+			ArgsUsage: "<path> ...",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "chunker, s",
+					Usage: "Chunking algorithm, i.e. size-262144 or rabin",
+				},
+				cli.IntFlag{
+					Name:  "cid-version",
+					Usage: "CID version: 0 or 1",
+				},
+				cli.StringFlag{
+					Name:  "hash",
+					Usage: "Hash function, i.e. sha2-256 or blake2b-256",
+				},
+				cli.BoolFlag{
+					Name:  "raw-leaves",
+					Usage: "Use raw blocks for the leaf nodes",
+				},
+				cli.BoolFlag{
+					Name:  "wrap-with-directory, w",
+					Usage: "Wrap the added files in a directory",
+				},
+				cli.BoolFlag{
+					Name:  "shard",
+					Usage: "Shard the added content across peers",
+				},
+				cli.Uint64Flag{
+					Name:  "shard-size",
+					Usage: "Maximum size of the shards in bytes (with --shard)",
+				},
+				cli.IntFlag{
+					Name:  "replication, r",
+					Value: 0,
+					Usage: "Sets a custom replication factor (overrides -rmax and -rmin)",
+				},
+				cli.IntFlag{
+					Name:  "replication-min, rmin",
+					Value: 0,
+					Usage: "Sets the minimum replication factor for the pins",
+				},
+				cli.IntFlag{
+					Name:  "replication-max, rmax",
+					Value: 0,
+					Usage: "Sets the maximum replication factor for the pins",
+				},
+				cli.StringFlag{
+					Name:  "name, n",
+					Value: "",
+					Usage: "Sets a name for the pins",
+				},
+				cli.StringSliceFlag{
+					Name:  "metadata",
+					Usage: "Sets a metadata key=value pair for the pins (can be repeated)",
+				},
+				cli.BoolFlag{
+					Name:  "quiet, q",
+					Usage: "Only print the pinned root CIDs",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				paths := c.Args()
+				if len(paths) == 0 {
+					checkErr("", errors.New("no files to add"))
+				}
+
+				rplMin := c.Int("replication-min")
+				rplMax := c.Int("replication-max")
+				if rpl := c.Int("replication"); rpl != 0 {
+					rplMin = rpl
+					rplMax = rpl
+				}
+
+				params := api.AddParams{
+					Chunker:           c.String("chunker"),
+					CidVersion:        c.Int("cid-version"),
+					Hash:              c.String("hash"),
+					RawLeaves:         c.Bool("raw-leaves"),
+					WrapWithDirectory: c.Bool("wrap-with-directory"),
+					Shard:             c.Bool("shard"),
+					ShardSize:         c.Uint64("shard-size"),
+				}
+				added, cerr := globalClient.Add(paths, params, api.Pin{
+					Name:                 c.String("name"),
+					ReplicationFactorMin: rplMin,
+					ReplicationFactorMax: rplMax,
+					Metadata:             parseMetadata(c.StringSlice("metadata")),
+				})
+				if cerr == nil && c.Bool("quiet") {
+					added = api.AddedRoots(added, params.WrapWithDirectory)
+				}
+				formatResponse(c, added, cerr)
+				return nil
+			},
+		},
+		{
+			Name:        "car",
+			Usage:       "Import and export CAR files",
+			Description: "Import and export content as CAR files",
+			Subcommands: []cli.Command{
+				{
+					Name:  "import",
+					Usage: "Import a CAR file and pin its roots",
+					Description: `
+This command imports the blocks of the given CAR file (version 1) in the
+IPFS daemon of the cluster peer and pins the roots listed in its header in
+the cluster. The content is not pinned in that daemon unless it is
+allocated to it: the allocated peers fetch it from there. The pin options
+work like those of "pin add".
+`,
+					ArgsUsage: "<file.car>",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "replication, r",
+							Value: 0,
+							Usage: "Sets a custom replication factor (overrides -rmax and -rmin)",
+						},
+						cli.IntFlag{
+							Name:  "replication-min, rmin",
+							Value: 0,
+							Usage: "Sets the minimum replication factor for the pins",
+						},
+						cli.IntFlag{
+							Name:  "replication-max, rmax",
+							Value: 0,
+							Usage: "Sets the maximum replication factor for the pins",
+						},
+						cli.StringFlag{
+							Name:  "name, n",
+							Value: "",
+							Usage: "Sets a name for the pins",
+						},
+						cli.StringSliceFlag{
+							Name:  "metadata",
+							Usage: "Sets a metadata key=value pair for the pins (can be repeated)",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						path := c.Args().First()
+						if path == "" {
+							checkErr("", errors.New("a CAR file is required"))
+						}
+						f, err := os.Open(path)
+						checkErr("opening the CAR file", err)
+						defer f.Close()
+
+						rplMin := c.Int("replication-min")
+						rplMax := c.Int("replication-max")
+						if rpl := c.Int("replication"); rpl != 0 {
+							rplMin = rpl
+							rplMax = rpl
+						}
+
+						pins, cerr := globalClient.ImportCAR(f, api.Pin{
+							Name:                 c.String("name"),
+							ReplicationFactorMin: rplMin,
+							ReplicationFactorMax: rplMax,
+							Metadata:             parseMetadata(c.StringSlice("metadata")),
+						})
+						formatResponse(c, pins, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "export",
+					Usage: "Export the DAG of a pinned CID as a CAR file",
+					Description: `
+This command exports the DAG of the given CID, which must be pinned in the
+cluster, as a CAR file. It is produced by the IPFS daemon of one of the
+peers allocated to the pin. The file is written to standard output unless
+--output is given.
+`,
+					ArgsUsage: "<cid>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "Write the CAR file to the given path",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						ci, err := cid.Decode(c.Args().First())
+						checkErr("parsing cid", err)
+
+						var w io.Writer = os.Stdout
+						if output := c.String("output"); output != "" {
+							f, err := os.Create(output)
+							checkErr("creating the output file", err)
+							defer f.Close()
+							w = f
+						}
+						cerr := globalClient.ExportCAR(ci, w)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+			},
+		},
 		{
 			Name:        "pin",
 			Description: "add, remove or list items managed by IPFS Cluster",
@@ -254,6 +516,24 @@ in the cluster and should be part of the list offered by "pin ls".
 An optional replication factor can be provided: -1 means "pin everywhere"
 and 0 means use cluster's default setting. Positive values indicate how many
 peers should pin this content.
+
+The peers which may pin this content can be restricted with --allow-peers
+and --exclude-peers, which take comma-separated lists of peer IDs. Allowed
+peers cannot be used when pinning everywhere.
+
+Pins added with "--priority high" are processed by the allocated peers
+before any queued pins with normal priority.
+
+Pins added with --expire-in (i.e. "--expire-in 720h") are automatically
+unpinned from the cluster once that time has passed.
+
+Free-form metadata can be attached to the pin with --metadata key=value,
+which can be repeated. It is shown by "pin ls" and "status" and can be
+used to filter "pin ls".
+
+Pins are recursive by default. Use --recursive=false to pin only the CID
+itself, or --max-depth to pin only the DAG levels up to that depth
+(1 pins the CID and its children).
 `,
 					ArgsUsage: "<CID>",
 					Flags: []cli.Flag{
@@ -277,6 +557,36 @@ peers should pin this content.
 							Value: "",
 							Usage: "Sets a name for this pin",
 						},
+						cli.StringFlag{
+							Name:  "allow-peers",
+							Usage: "Only allocate this pin to these peers (comma-separated)",
+						},
+						cli.StringFlag{
+							Name:  "exclude-peers",
+							Usage: "Never allocate this pin to these peers (comma-separated)",
+						},
+						cli.StringFlag{
+							Name:  "priority",
+							Value: string(api.PinPriorityNormal),
+							Usage: "Sets the priority of this pin: normal or high",
+						},
+						cli.DurationFlag{
+							Name:  "expire-in",
+							Usage: "Unpin this item after the given time (i.e. 720h)",
+						},
+						cli.StringSliceFlag{
+							Name:  "metadata",
+							Usage: "Sets a metadata key=value pair for this pin (can be repeated)",
+						},
+						cli.BoolTFlag{
+							Name:  "recursive",
+							Usage: "Pins the whole DAG under the CID, use --recursive=false to pin only the CID",
+						},
+						cli.IntFlag{
+							Name:  "max-depth",
+							Value: 0,
+							Usage: "Only pins the DAG up to this depth (recursive pins only)",
+						},
 						cli.BoolFlag{
 							Name:  "no-status, ns",
 							Usage: "Prevents fetching pin status after pinning (faster, quieter)",
@@ -304,7 +614,34 @@ peers should pin this content.
 							rplMax = rpl
 						}
 
-						cerr := globalClient.Pin(ci, rplMin, rplMax, c.String("name"))
+						allow := parsePeers(c.String("allow-peers"))
+						exclude := parsePeers(c.String("exclude-peers"))
+						priority := api.PinPriority(c.String("priority"))
+						var expireAt time.Time
+						if expireIn := c.Duration("expire-in"); expireIn > 0 {
+							expireAt = time.Now().Add(expireIn)
+						}
+						pin := api.Pin{
+							Cid:                  ci,
+							Name:                 c.String("name"),
+							ReplicationFactorMin: rplMin,
+							ReplicationFactorMax: rplMax,
+							AllowPeers:           allow,
+							ExcludePeers:         exclude,
+							Priority:             priority,
+							ExpireAt:             expireAt,
+							Metadata:             parseMetadata(c.StringSlice("metadata")),
+						}
+						var cerr error
+						if c.BoolT("recursive") {
+							pin.MaxDepth = c.Int("max-depth")
+							cerr = globalClient.PinWithOptions(pin)
+						} else {
+							if c.Int("max-depth") != 0 {
+								checkErr("", errors.New("--max-depth cannot be used with --recursive=false"))
+							}
+							cerr = globalClient.PinDirect(pin)
+						}
 						if cerr != nil {
 							formatResponse(c, nil, cerr)
 							return nil
@@ -363,6 +700,61 @@ although unpinning operations in the cluster may take longer or fail.
 						return nil
 					},
 				},
+				{
+					Name:  "update",
+					Usage: "Pin a new version of a CID with the same options",
+					Description: `
+This command tells IPFS Cluster to pin the second CID with the same
+options, metadata and, when possible, the same allocations as the
+existing pin of the first one. This is useful for mutating datasets:
+the IPFS nodes which hold the first CID update its pin, only fetching
+the blocks which changed.
+
+With --unpin, the first CID is unpinned once the second one has been
+pinned in the cluster.
+
+When the request has succeeded, the command returns the status of the new
+CID in the cluster.
+`,
+					ArgsUsage: "<from-CID> <to-CID>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "unpin",
+							Usage: "Unpin the first CID after pinning the second one",
+						},
+						cli.BoolFlag{
+							Name:  "no-status, ns",
+							Usage: "Prevents fetching pin status after pinning (faster, quieter)",
+						},
+						cli.BoolFlag{
+							Name:  "wait, w",
+							Usage: "Wait for all nodes to report a status of pinned before returning",
+						},
+						cli.DurationFlag{
+							Name:  "wait-timeout, wt",
+							Value: 0,
+							Usage: "How long to --wait (in seconds), default is indefinitely",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						from, err := cid.Decode(c.Args().Get(0))
+						checkErr("parsing cid", err)
+						to, err := cid.Decode(c.Args().Get(1))
+						checkErr("parsing cid", err)
+						_, cerr := globalClient.PinUpdate(from, to, c.Bool("unpin"))
+						if cerr != nil {
+							formatResponse(c, nil, cerr)
+							return nil
+						}
+
+						handlePinResponseFormatFlags(
+							c,
+							to,
+							api.TrackerStatusPinned,
+						)
+						return nil
+					},
+				},
 				{
 					Name:  "ls",
 					Usage: "List tracked CIDs",
@@ -372,9 +764,22 @@ which peers they are currently allocated. This list does not include
 any monitoring information about the IPFS status of the CIDs, it
 merely represents the list of pins which are part of the shared state of
 the cluster. For IPFS-status information about the pins, use "status".
+
+The list can be filtered with --name, which matches the pins whose name
+contains the given text, and with --metadata key=value, which can be
+repeated.
 `,
 					ArgsUsage: "[CID]",
-					Flags:     []cli.Flag{},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "only list the pins whose name contains this",
+						},
+						cli.StringSliceFlag{
+							Name:  "metadata",
+							Usage: "only list the pins with this metadata key=value pair (can be repeated)",
+						},
+					},
 					Action: func(c *cli.Context) error {
 						cidStr := c.Args().First()
 						if cidStr != "" {
@@ -383,68 +788,337 @@ the cluster. For IPFS-status information about the pins, use "status".
 							resp, cerr := globalClient.Allocation(ci)
 							formatResponse(c, resp, cerr)
 						} else {
-							resp, cerr := globalClient.Allocations()
+							resp, cerr := globalClient.AllocationsFiltered(
+								c.String("name"),
+								parseMetadata(c.StringSlice("metadata")),
+							)
 							formatResponse(c, resp, cerr)
 						}
 						return nil
 					},
 				},
-			},
-		},
-		{
-			Name:  "status",
-			Usage: "Retrieve the status of tracked items",
-			Description: `
-This command retrieves the status of the CIDs tracked by IPFS
-Cluster, including which member is pinning them and any errors.
-If a CID is provided, the status will be only fetched for a single
-item.
-
-The status of a CID may not be accurate. A manual sync can be triggered
-with "sync".
-
-When the --local flag is passed, it will only fetch the status from the
-contacted cluster peer. By default, status will be fetched from all peers.
+				{
+					Name:  "preview",
+					Usage: "Show which peers would be allocated a CID",
+					Description: `
+This command shows which peers would be allocated the given CID if it was
+pinned with the given replication factors, according to the current
+metrics and the allocation strategy of the cluster. Nothing is pinned.
+It is useful to debug the allocations and for capacity planning.
 `,
-			ArgsUsage: "[CID]",
-			Flags: []cli.Flag{
-				localFlag(),
-			},
-			Action: func(c *cli.Context) error {
-				cidStr := c.Args().First()
-				if cidStr != "" {
-					ci, err := cid.Decode(cidStr)
-					checkErr("parsing cid", err)
-					resp, cerr := globalClient.Status(ci, c.Bool("local"))
-					formatResponse(c, resp, cerr)
-				} else {
-					resp, cerr := globalClient.StatusAll(c.Bool("local"))
-					formatResponse(c, resp, cerr)
-				}
-				return nil
-			},
-		},
-		{
-			Name:  "sync",
-			Usage: "Sync status of tracked items",
-			Description: `
-This command asks Cluster peers to verify that the current status of tracked
-CIDs is accurate by triggering queries to the IPFS daemons that pin them.
-If a CID is provided, the sync and recover operations will be limited to
-that single item.
-
-Unless providing a specific CID, the command will output only items which
-have changed status because of the sync or are in error state in some node,
-therefore, the output should be empty if no operations were performed.
+					ArgsUsage: "<CID>",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "replication, r",
+							Value: 0,
+							Usage: "Sets a custom replication factor (overrides -rmax and -rmin)",
+						},
+						cli.IntFlag{
+							Name:  "replication-min, rmin",
+							Value: 0,
+							Usage: "Sets the minimum replication factor",
+						},
+						cli.IntFlag{
+							Name:  "replication-max, rmax",
+							Value: 0,
+							Usage: "Sets the maximum replication factor",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						cidStr := c.Args().First()
+						ci, err := cid.Decode(cidStr)
+						checkErr("parsing cid", err)
 
-CIDs in error state may be manually recovered with "recover".
+						rpl := c.Int("replication")
+						rplMin := c.Int("replication-min")
+						rplMax := c.Int("replication-max")
+						if rpl != 0 {
+							rplMin = rpl
+							rplMax = rpl
+						}
 
-When the --local flag is passed, it will only trigger sync
-operations on the contacted peer. By default, all peers will sync.
+						resp, cerr := globalClient.AllocationPreview(ci, rplMin, rplMax)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "allocation-history",
+					Usage: "Show the allocation changes of a CID",
+					Description: `
+This command shows the changes of the allocations of the given CID made by
+every cluster peer: when they happened, from which peers to which peers and
+why ("initial", "rebalance" or "failure"). It helps auditing how the data
+moves around the cluster.
 `,
-			ArgsUsage: "[CID]",
-			Flags: []cli.Flag{
-				localFlag(),
+					ArgsUsage: "<CID>",
+					Action: func(c *cli.Context) error {
+						cidStr := c.Args().First()
+						ci, err := cid.Decode(cidStr)
+						checkErr("parsing cid", err)
+						resp, cerr := globalClient.AllocationHistory(ci)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "estimate",
+					Usage: "Estimate the storage cost of pinning a CID",
+					Description: `
+This command estimates the size of the DAG under the given CID and the total
+space it would use in the cluster if it was pinned with the given replication
+factors. It also tells whether the allocated peers have enough free space.
+Nothing is pinned.
+`,
+					ArgsUsage: "<CID>",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "replication, r",
+							Value: 0,
+							Usage: "Sets a custom replication factor (overrides -rmax and -rmin)",
+						},
+						cli.IntFlag{
+							Name:  "replication-min, rmin",
+							Value: 0,
+							Usage: "Sets the minimum replication factor",
+						},
+						cli.IntFlag{
+							Name:  "replication-max, rmax",
+							Value: 0,
+							Usage: "Sets the maximum replication factor",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						cidStr := c.Args().First()
+						ci, err := cid.Decode(cidStr)
+						checkErr("parsing cid", err)
+
+						rpl := c.Int("replication")
+						rplMin := c.Int("replication-min")
+						rplMax := c.Int("replication-max")
+						if rpl != 0 {
+							rplMin = rpl
+							rplMax = rpl
+						}
+
+						resp, cerr := globalClient.PinEstimate(ci, rplMin, rplMax)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "set-rf",
+					Usage: "Change the replication factor of existing pins",
+					Description: `
+This command changes the replication factors of the tracked CIDs given as
+arguments, or of all the tracked CIDs when --all is used. --name-prefix
+restricts the selection to pins whose name starts with the given prefix.
+
+Pins are updated one by one (waiting --interval between them) so that the
+cluster can allocate or release the content incrementally. The progress is
+printed as each pin is updated. Pins which already have the requested
+replication factors are skipped.
+
+When only --rmin or --rmax is given, the other factor is adjusted if needed
+to keep the pair valid. The new factors always replace the current ones,
+even when the cluster merges the options of repeated pins.
+`,
+					ArgsUsage: "[CID...]",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "replication-min, rmin",
+							Value: 0,
+							Usage: "Sets the minimum replication factor",
+						},
+						cli.IntFlag{
+							Name:  "replication-max, rmax",
+							Value: 0,
+							Usage: "Sets the maximum replication factor",
+						},
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "Apply to all tracked CIDs",
+						},
+						cli.StringFlag{
+							Name:  "name-prefix",
+							Usage: "Only apply to pins whose name starts with this prefix",
+						},
+						cli.DurationFlag{
+							Name:  "interval",
+							Value: 0,
+							Usage: "Time to wait between updating two pins",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if !c.Bool("all") && c.NArg() == 0 {
+							checkErr("", errors.New("provide some CIDs or use --all"))
+						}
+						rplMin := c.Int("replication-min")
+						rplMax := c.Int("replication-max")
+						if rplMin == 0 && rplMax == 0 {
+							checkErr("", errors.New("--rmin and/or --rmax are required"))
+						}
+						if rplMin != 0 && rplMax != 0 && ((rplMin == -1) != (rplMax == -1) || rplMin > rplMax) {
+							checkErr("", errors.New("--rmin must not be larger than --rmax, and both must be -1 if one of them is"))
+						}
+
+						var pins []api.Pin
+						if c.Bool("all") {
+							resp, cerr := globalClient.Allocations()
+							checkErr("listing pins", cerr)
+							pins = resp
+						} else {
+							for _, arg := range c.Args() {
+								ci, err := cid.Decode(arg)
+								checkErr("parsing cid", err)
+								pin, cerr := globalClient.Allocation(ci)
+								checkErr("fetching pin "+arg, cerr)
+								pins = append(pins, pin)
+							}
+						}
+
+						pins = filterPinsByNamePrefix(pins, c.String("name-prefix"))
+						setReplicationFactors(pins, rplMin, rplMax, c.Duration("interval"))
+						return nil
+					},
+				},
+				{
+					Name:  "stray",
+					Usage: "List or fix items pinned in IPFS outside of the cluster",
+					Description: `
+This command lists the items which are pinned in the IPFS daemons of the
+cluster peers without being allocated to those peers by the cluster
+("stray pins"). These are usually the result of pinning directly in IPFS.
+Items marked as tracked are pinned in the cluster, but allocated to
+other peers.
+
+When --action is given along with a peer ID and a CID, the remediation is
+applied to that stray pin instead:
+
+  - adopt: pin the item in the cluster (only for items not tracked)
+  - ignore: mark the item as ignored in the reports of that peer
+  - remove: unpin the item from the IPFS daemon of that peer
+`,
+					ArgsUsage: "[<peer ID> <CID>]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "action",
+							Usage: "remediation to apply: adopt, ignore or remove",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						action := c.String("action")
+						if action == "" {
+							resp, cerr := globalClient.StrayPins()
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+
+						if c.NArg() != 2 {
+							checkErr("", errors.New("a peer ID and a CID are required"))
+						}
+						p, err := peer.IDB58Decode(c.Args().Get(0))
+						checkErr("parsing peer ID", err)
+						ci, err := cid.Decode(c.Args().Get(1))
+						checkErr("parsing cid", err)
+						cerr := globalClient.RemediateStrayPin(p, ci, api.StrayPinAction(action))
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "history",
+					Usage: "Show the last pin and unpin attempts on an item",
+					Description: `
+This command shows the last pin and unpin attempts made by every cluster
+peer on the given CID, with their start time, duration and error, if any.
+It helps finding out why an item keeps failing to pin. The history of an
+item in a peer is forgotten once it is successfully unpinned there.
+`,
+					ArgsUsage: "<CID>",
+					Action: func(c *cli.Context) error {
+						cidStr := c.Args().First()
+						ci, err := cid.Decode(cidStr)
+						checkErr("parsing cid", err)
+						resp, cerr := globalClient.PinHistory(ci)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "status",
+			Usage: "Retrieve the status of tracked items",
+			Description: `
+This command retrieves the status of the CIDs tracked by IPFS
+Cluster, including which member is pinning them and any errors.
+If one or more CIDs are provided, the status will be only fetched for those
+items, using a single request.
+
+The status of a CID may not be accurate. A manual sync can be triggered
+with "sync".
+
+When the --local flag is passed, it will only fetch the status from the
+contacted cluster peer. By default, status will be fetched from all peers.
+
+Peers which are not allocated an item report it as REMOTE, along with the
+peers which hold it. The --hide-remote flag leaves those entries out, so
+that only the peers responsible for each item are shown.
+`,
+			ArgsUsage: "[CID...]",
+			Flags: []cli.Flag{
+				localFlag(),
+				cli.BoolFlag{
+					Name:  "hide-remote",
+					Usage: "do not show the peers which are not allocated the items",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				cidStr := c.Args().First()
+				remote := !c.Bool("hide-remote")
+				if c.NArg() > 1 || (c.NArg() == 1 && !remote) {
+					cids := make([]*cid.Cid, c.NArg())
+					for i, arg := range c.Args() {
+						ci, err := cid.Decode(arg)
+						checkErr("parsing cid", err)
+						cids[i] = ci
+					}
+					resp, cerr := globalClient.StatusCidsFiltered(cids, c.Bool("local"), remote)
+					formatResponse(c, resp, cerr)
+				} else if cidStr != "" {
+					ci, err := cid.Decode(cidStr)
+					checkErr("parsing cid", err)
+					resp, cerr := globalClient.Status(ci, c.Bool("local"))
+					formatResponse(c, resp, cerr)
+				} else {
+					resp, cerr := globalClient.StatusAllFiltered(c.Bool("local"), remote)
+					formatResponse(c, resp, cerr)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "sync",
+			Usage: "Sync status of tracked items",
+			Description: `
+This command asks Cluster peers to verify that the current status of tracked
+CIDs is accurate by triggering queries to the IPFS daemons that pin them.
+If a CID is provided, the sync and recover operations will be limited to
+that single item.
+
+Unless providing a specific CID, the command will output only items which
+have changed status because of the sync or are in error state in some node,
+therefore, the output should be empty if no operations were performed.
+
+CIDs in error state may be manually recovered with "recover".
+
+When the --local flag is passed, it will only trigger sync
+operations on the contacted peer. By default, all peers will sync.
+`,
+			ArgsUsage: "[CID]",
+			Flags: []cli.Flag{
+				localFlag(),
 			},
 			Action: func(c *cli.Context) error {
 				cidStr := c.Args().First()
@@ -493,6 +1167,32 @@ operations on the contacted peer (as opposed to on every peer).
 			},
 		},
 
+		{
+			Name:  "shutdown",
+			Usage: "Stop the cluster peer or the whole cluster",
+			Description: `
+This command stops the contacted cluster peer.
+
+With --all, all the cluster peers are stopped in an orderly way, for the
+maintenance of the whole installation. The leader pauses new pins and unpins
+in all the peers, applies all the pending operations to the shared state,
+stops the other peers and finally stops itself, taking a snapshot of the
+state. Peers do not leave the cluster, regardless of "leave_on_shutdown", so
+that it can be started again as it was.
+`,
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "stop all the cluster peers",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				cerr := globalClient.Shutdown(c.Bool("all"))
+				formatResponse(c, nil, cerr)
+				return nil
+			},
+		},
 		{
 			Name:  "version",
 			Usage: "Retrieve cluster version",
@@ -508,6 +1208,22 @@ to check that it matches the CLI version (shown by -v).
 				return nil
 			},
 		},
+		{
+			Name:  "features",
+			Usage: "List the features supported by the cluster peers",
+			Description: `
+This command lists the features advertised by the cluster peers and how
+many peers advertise each of them. Some features are only used when all
+the peers, or a quorum of them, support them, so that clusters keep
+working while peers are upgraded one by one.
+`,
+			ArgsUsage: " ",
+			Action: func(c *cli.Context) error {
+				resp, cerr := globalClient.Features()
+				formatResponse(c, resp, cerr)
+				return nil
+			},
+		},
 		{
 			Name:        "health",
 			Description: "Display information on clusterhealth",
@@ -552,6 +1268,341 @@ graph of the connections.  Output is a dot file encoding the cluster's connectio
 						return nil
 					},
 				},
+				{
+					Name:  "raft",
+					Usage: "display the state of the Raft consensus in the peer",
+					Description: `
+This command displays the state of the Raft consensus in the contacted peer:
+its role, the current leader and term, the log indexes, when the last snapshot
+was taken, the leadership changes seen and the average commit latency. A
+growing number of leadership changes or an applied index which does not
+follow the commit index point to an unhealthy consensus.
+`,
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.RaftHealth()
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "queue",
+					Usage: "display the pin queue of the peer",
+					Description: `
+This command displays the pin and unpin operations which are queued or in
+progress in the contacted peer, along with the pin rate and the number of
+unpins done since the IPFS repository was last garbage collected (see the
+"gc_after_unpins" option of the pin tracker).
+`,
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.PinQueue()
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "push-metric",
+					Usage: "push a custom metric for the peer",
+					Description: `
+This command sends a custom metric for the contacted peer, which is valid
+during --ttl. It is meant to let external processes feed metrics (i.e. GPU
+availability) to the cluster. Custom metrics can be used to make allocations
+by setting "allocation_metric" in the cluster configuration. They must be
+pushed again before they expire.
+`,
+					ArgsUsage: "<metric name> <value>",
+					Flags: []cli.Flag{
+						cli.DurationFlag{
+							Name:  "ttl",
+							Value: time.Minute,
+							Usage: "how long the metric is valid",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 2 {
+							checkErr("", errors.New("a metric name and a value are required"))
+						}
+						cerr := globalClient.PushMetric(c.Args().Get(0), c.Args().Get(1), c.Duration("ttl"))
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "metrics",
+					Usage: "display the last values or the recent history of a metric",
+					Description: `
+This command displays the last valid values of the given metric (i.e. "ping",
+"freespace") for every cluster peer, as used by the allocator.
+
+When a peer is given, it displays instead the values received from that peer
+by the leading peer monitor, from oldest to newest. The history is limited to
+the metrics kept in the monitor window.
+`,
+					ArgsUsage: "<metric name>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "peer, p",
+							Usage: "peer ID to display the metric history for",
+						},
+						cli.DurationFlag{
+							Name:  "since, s",
+							Value: 0,
+							Usage: "only show metrics received in this last period (i.e. 10m)",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						name := c.Args().First()
+						if name == "" {
+							checkErr("", errors.New("a metric name is required"))
+						}
+						if c.String("peer") == "" {
+							resp, cerr := globalClient.LastMetrics(name)
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+
+						p, err := peer.IDB58Decode(c.String("peer"))
+						checkErr("parsing peer ID", err)
+
+						var since time.Time
+						if d := c.Duration("since"); d > 0 {
+							since = time.Now().Add(-d)
+						}
+						resp, cerr := globalClient.MetricsHistory(name, p, since)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "unquarantine",
+					Usage: "accept again the metrics from a quarantined peer",
+					Description: `
+This command makes all the cluster peers accept again the metrics from a peer
+which was quarantined after sending "quarantine_threshold" consecutive invalid
+metrics (i.e. already expired because of a wrong clock). While quarantined, the
+metrics of a peer are not used for allocations. An alert is sent when a peer
+is quarantined.
+`,
+					ArgsUsage: "<peer ID>",
+					Action: func(c *cli.Context) error {
+						p, err := peer.IDB58Decode(c.Args().First())
+						checkErr("parsing peer ID", err)
+						cerr := globalClient.Unquarantine(p)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:        "kv",
+			Usage:       "Manage key-value records stored in the cluster",
+			Description: "Manage key-value records stored in the cluster",
+			Subcommands: []cli.Command{
+				{
+					Name:      "ls",
+					Usage:     "List all key-value records",
+					ArgsUsage: " ",
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.KVs()
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "get",
+					Usage: "Display the value stored under a key",
+					Description: `
+This command displays the key-value record for the given key. It fails
+if the key is not part of the cluster state.
+`,
+					ArgsUsage: "<key>",
+					Action: func(c *cli.Context) error {
+						key := c.Args().First()
+						if key == "" {
+							checkErr("", errors.New("a key is required"))
+						}
+						resp, cerr := globalClient.KVGet(key)
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "set",
+					Usage: "Store a value under a key",
+					Description: `
+This command stores the given value under the given key, replacing any
+previous value. Records are replicated to all cluster peers as part of the
+shared state, therefore they are meant to be small: keys are limited to 255
+characters and values to 4KiB.
+`,
+					ArgsUsage: "<key> <value>",
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 2 {
+							checkErr("", errors.New("a key and a value are required"))
+						}
+						cerr := globalClient.KVSet(c.Args().Get(0), c.Args().Get(1))
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+				{
+					Name:      "rm",
+					Usage:     "Remove a key-value record",
+					ArgsUsage: "<key>",
+					Action: func(c *cli.Context) error {
+						key := c.Args().First()
+						if key == "" {
+							checkErr("", errors.New("a key is required"))
+						}
+						cerr := globalClient.KVRm(key)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:        "webhook",
+			Usage:       "Manage the webhooks notified of pin events",
+			Description: "Manage the webhooks notified of pin events",
+			Subcommands: []cli.Command{
+				{
+					Name:      "ls",
+					Usage:     "List the webhooks",
+					ArgsUsage: " ",
+					Action: func(c *cli.Context) error {
+						resp, cerr := globalClient.Webhooks()
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "add",
+					Usage: "Register a webhook",
+					Description: `
+This command registers a webhook: every cluster peer POSTs the events
+about pins it produces, as JSON, to the given URL. Webhooks are stored in
+the shared state. The events can be filtered:
+
+  * --event restricts them to some types (can be repeated): "pin",
+    "unpin" and "repin" report the operations of the cluster, while
+    "pinned", "pin_error", "unpinned" and "unpin_error" report the
+    changes of the local status of the pins in each peer.
+  * --namespace restricts them to the events produced by the peers of
+    the cluster with the given namespace (see the cluster "namespace"
+    option), for webhooks shared by several clusters.
+  * --metadata restricts them to the pins with the given metadata
+    key=value pair (can be repeated), i.e. a tenant.
+
+The command prints the registered webhook, with its ID.
+`,
+					ArgsUsage: "<url>",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "event",
+							Usage: "Only deliver events of this type (can be repeated)",
+						},
+						cli.StringFlag{
+							Name:  "namespace",
+							Usage: "Only deliver events produced by the cluster with this namespace",
+						},
+						cli.StringSliceFlag{
+							Name:  "metadata",
+							Usage: "Only deliver events about pins with this key=value metadata (can be repeated)",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						url := c.Args().First()
+						if url == "" {
+							checkErr("", errors.New("an URL is required"))
+						}
+						resp, cerr := globalClient.WebhookAdd(api.Webhook{
+							URL:       url,
+							Events:    c.StringSlice("event"),
+							Namespace: c.String("namespace"),
+							Metadata:  parseMetadata(c.StringSlice("metadata")),
+						})
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:      "rm",
+					Usage:     "Remove a webhook",
+					ArgsUsage: "<id>",
+					Action: func(c *cli.Context) error {
+						id := c.Args().First()
+						if id == "" {
+							checkErr("", errors.New("a webhook ID is required"))
+						}
+						cerr := globalClient.WebhookRm(id)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "top",
+			Usage: "Display a live overview of the cluster",
+			Description: `
+This command displays an overview of the cluster which is refreshed at every
+--interval until interrupted with Ctrl-C: the peers, how long ago their last
+ping was received, their free space and the length of their pin queues,
+along with the latest alerts recorded by the contacted peer. Alerts are
+recorded by the leader, so contacting it shows all of them.
+
+Free space is only known when the peers use the "freespace" disk informer.
+`,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "interval, i",
+					Value: 2 * time.Second,
+					Usage: "how often the view is refreshed",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				interval := c.Duration("interval")
+				if interval <= 0 {
+					checkErr("", errors.New("the interval must be positive"))
+				}
+				runTop(interval)
+				return nil
+			},
+		},
+		{
+			Name:        "debug",
+			Usage:       "Debugging and failure rehearsal tools",
+			Description: "Debugging and failure rehearsal tools",
+			Subcommands: []cli.Command{
+				{
+					Name:  "fail-peer",
+					Usage: "Simulate the failure of a peer",
+					Description: `
+This command makes the leading peer monitor consider the given peer as failed
+during --duration, as if its metrics had expired. Alerts are sent and the
+content allocated to the peer is re-pinned elsewhere, which allows to
+rehearse failure handling and to verify alerting and rebalancing settings.
+
+This operation is disabled unless "enable_debug_rpc" is set in the
+cluster configuration.
+`,
+					ArgsUsage: "<peer ID>",
+					Flags: []cli.Flag{
+						cli.DurationFlag{
+							Name:  "duration, d",
+							Value: time.Minute,
+							Usage: "how long the peer is considered failed",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						p, err := peer.IDB58Decode(c.Args().First())
+						checkErr("parsing peer ID", err)
+						cerr := globalClient.FailPeer(p, c.Duration("duration"))
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
 			},
 		},
 		{
@@ -577,6 +1628,36 @@ func parseFlag(t int) cli.IntFlag {
 	}
 }
 
+// parsePeers decodes a comma-separated list of peer IDs.
+func parsePeers(str string) []peer.ID {
+	var peers []peer.ID
+	if str == "" {
+		return peers
+	}
+	for _, pstr := range strings.Split(str, ",") {
+		p, err := peer.IDB58Decode(strings.TrimSpace(pstr))
+		checkErr("parsing peer ID "+pstr, err)
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// parseMetadata parses a list of key=value pairs.
+func parseMetadata(pairs []string) map[string]string {
+	if len(pairs) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string)
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			checkErr("parsing metadata", fmt.Errorf("%q is not a key=value pair", pair))
+		}
+		metadata[kv[0]] = kv[1]
+	}
+	return metadata
+}
+
 func localFlag() cli.BoolFlag {
 	return cli.BoolFlag{
 		Name:  "local",
@@ -672,6 +1753,83 @@ func handlePinResponseFormatFlags(
 	formatResponse(c, status, cerr)
 }
 
+func filterPinsByNamePrefix(pins []api.Pin, prefix string) []api.Pin {
+	if prefix == "" {
+		return pins
+	}
+	var filtered []api.Pin
+	for _, pin := range pins {
+		if strings.HasPrefix(pin.Name, prefix) {
+			filtered = append(filtered, pin)
+		}
+	}
+	return filtered
+}
+
+// replicationFactors returns the replication factors of the given pin
+// once updated with the given ones. A factor of 0 keeps the current
+// value, unless it must follow the other factor for the pair to remain
+// valid: i.e. raising only the minimum above the current maximum raises
+// the maximum too.
+func replicationFactors(pin api.Pin, rplMin, rplMax int) (int, int) {
+	newMin, newMax := pin.ReplicationFactorMin, pin.ReplicationFactorMax
+	switch {
+	case rplMin != 0 && rplMax != 0:
+		newMin, newMax = rplMin, rplMax
+	case rplMin != 0:
+		newMin = rplMin
+		if newMin == -1 || newMax == -1 || newMin > newMax {
+			newMax = newMin
+		}
+	case rplMax != 0:
+		newMax = rplMax
+		if newMax == -1 || newMin == -1 || newMin > newMax {
+			newMin = newMax
+		}
+	}
+	return newMin, newMax
+}
+
+// setReplicationFactors re-pins the given pins with new replication
+// factors, one by one, and reports the progress. The options of the
+// pins are overwritten, so that factors can be lowered regardless of the
+// pin_merge_policy of the cluster.
+func setReplicationFactors(pins []api.Pin, rplMin, rplMax int, interval time.Duration) {
+	total := len(pins)
+	failed := 0
+	for i, pin := range pins {
+		newMin, newMax := replicationFactors(pin, rplMin, rplMax)
+
+		if newMin == pin.ReplicationFactorMin && newMax == pin.ReplicationFactorMax {
+			fmt.Printf("[%d/%d] %s: skipped (already %d--%d)\n", i+1, total, pin.Cid, newMin, newMax)
+			continue
+		}
+
+		repin := pin
+		repin.ReplicationFactorMin = newMin
+		repin.ReplicationFactorMax = newMax
+		err := repin.Validate()
+		if err == nil {
+			err = globalClient.PinOverwrite(repin)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("[%d/%d] %s: error: %s\n", i+1, total, pin.Cid, err)
+			continue
+		}
+		fmt.Printf("[%d/%d] %s: %d--%d -> %d--%d\n", i+1, total, pin.Cid,
+			pin.ReplicationFactorMin, pin.ReplicationFactorMax, newMin, newMax)
+
+		if interval > 0 && i < total-1 {
+			time.Sleep(interval)
+		}
+	}
+
+	if failed > 0 {
+		checkErr("setting replication factors", fmt.Errorf("%d of %d pins failed", failed, total))
+	}
+}
+
 func waitFor(
 	ci *cid.Cid,
 	target api.TrackerStatus,
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestReplicationFactors(t *testing.T) {
+	ci, _ := cid.Decode(test.TestCid1)
+	pin := func(rplMin, rplMax int) api.Pin {
+		return api.Pin{Cid: ci, ReplicationFactorMin: rplMin, ReplicationFactorMax: rplMax}
+	}
+
+	cases := []struct {
+		pin            api.Pin
+		rplMin, rplMax int
+		expMin, expMax int
+	}{
+		{pin(2, 3), 1, 0, 1, 3},
+		{pin(2, 3), 5, 0, 5, 5},
+		{pin(2, 3), 0, 1, 1, 1},
+		{pin(2, 3), 0, 4, 2, 4},
+		{pin(2, 3), -1, 0, -1, -1},
+		{pin(2, 3), 0, -1, -1, -1},
+		{pin(-1, -1), 2, 0, 2, 2},
+		{pin(-1, -1), 0, 2, 2, 2},
+		{pin(2, 3), 1, 2, 1, 2},
+	}
+	for i, c := range cases {
+		rplMin, rplMax := replicationFactors(c.pin, c.rplMin, c.rplMax)
+		if rplMin != c.expMin || rplMax != c.expMax {
+			t.Errorf("%d: expected %d--%d, got %d--%d", i, c.expMin, c.expMax, rplMin, rplMax)
+		}
+		if err := pin(rplMin, rplMax).Validate(); err != nil {
+			t.Errorf("%d: %s", i, err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// The "top" command is a live view of the cluster, redrawn at every
+// interval. It only uses the regular endpoints of the REST API: the
+// peers, the last ping, freespace and pinqueue metrics and the events
+// of the contacted peer, of which alerts are kept.
+
+// topAlerts is the number of recent alerts shown by "top".
+const topAlerts = 10
+
+// clearScreen moves the cursor to the top-left corner and clears the
+// terminal.
+const clearScreen = "\033[H\033[2J"
+
+// topMetrics are the metrics shown for every peer.
+var topMetrics = []string{"ping", "freespace", "pinqueue"}
+
+// topView holds what "top" displays.
+type topView struct {
+	peers   []api.ID
+	metrics map[string]map[peer.ID]api.Metric
+	alerts  []api.Event
+	lastEv  time.Time
+	err     error
+}
+
+// update fetches the peers, the metrics and the events which happened
+// since the last update.
+func (v *topView) update() {
+	v.err = nil
+	peers, err := globalClient.Peers()
+	if err != nil {
+		v.err = err
+		return
+	}
+	v.peers = peers
+
+	v.metrics = make(map[string]map[peer.ID]api.Metric)
+	for _, name := range topMetrics {
+		metrics, err := globalClient.LastMetrics(name)
+		if err != nil {
+			v.err = err
+			return
+		}
+		v.metrics[name] = make(map[peer.ID]api.Metric)
+		for _, m := range metrics {
+			v.metrics[name][m.Peer] = m
+		}
+	}
+
+	events, err := globalClient.Events(v.lastEv)
+	if err != nil {
+		v.err = err
+		return
+	}
+	v.addEvents(events)
+}
+
+// addEvents keeps the alert and recovered events among the given ones
+// which are newer than the last seen event, up to topAlerts.
+func (v *topView) addEvents(events []api.Event) {
+	for _, ev := range events {
+		if !ev.Timestamp.After(v.lastEv) {
+			continue // since has a one second precision
+		}
+		v.lastEv = ev.Timestamp
+		if ev.Type == api.EventAlert || ev.Type == api.EventRecovered {
+			v.alerts = append(v.alerts, ev)
+		}
+	}
+	if len(v.alerts) > topAlerts {
+		v.alerts = v.alerts[len(v.alerts)-topAlerts:]
+	}
+}
+
+// render writes the view to w.
+func (v *topView) render(w io.Writer, now time.Time, interval time.Duration) {
+	fmt.Fprintf(w, "ipfs-cluster top - %s (every %s, Ctrl-C to quit)\n\n", now.Format(time.RFC3339), interval)
+	if v.err != nil {
+		fmt.Fprintf(w, "error: %s\n\n", v.err)
+	}
+
+	peers := make([]api.ID, len(v.peers))
+	copy(peers, v.peers)
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].ID.Pretty() < peers[j].ID.Pretty()
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PEER\tNAME\tLAST PING\tFREE SPACE\tPIN QUEUE\t")
+	for _, p := range peers {
+		name := p.Peername
+		if p.Error != "" {
+			name = "error: " + p.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n",
+			p.ID.Pretty(),
+			name,
+			v.pingFreshness(p.ID, now),
+			v.freeSpace(p.ID),
+			v.metricValue("pinqueue", p.ID),
+		)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nRecent alerts:\n")
+	if len(v.alerts) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+	for i := len(v.alerts) - 1; i >= 0; i-- {
+		ev := v.alerts[i]
+		fmt.Fprintf(w, "  %s  %-9s  %s  %s\n",
+			ev.Timestamp.Format(time.RFC3339), ev.Type, ev.Message, ev.Peer)
+	}
+}
+
+// pingFreshness describes how long ago the last ping of a peer was
+// received.
+func (v *topView) pingFreshness(p peer.ID, now time.Time) string {
+	m, ok := v.metrics["ping"][p]
+	if !ok {
+		return "missing"
+	}
+	ago := now.Sub(time.Unix(0, m.Received)).Truncate(time.Second)
+	if ago < 0 {
+		ago = 0
+	}
+	return ago.String() + " ago"
+}
+
+// freeSpace returns the free space of a peer in a readable form.
+func (v *topView) freeSpace(p peer.ID) string {
+	value := v.metricValue("freespace", p)
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	return formatBytes(n)
+}
+
+// metricValue returns the value of the last metric of the given name
+// of a peer, or "-" when there is none.
+func (v *topView) metricValue(name string, p peer.ID) string {
+	m, ok := v.metrics[name][p]
+	if !ok {
+		return "-"
+	}
+	return m.Value
+}
+
+// formatBytes formats a number of bytes with a binary unit.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// runTop redraws the view at every interval until interrupted.
+func runTop(interval time.Duration) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	v := &topView{lastEv: time.Now().Add(-time.Hour)}
+	for {
+		v.update()
+		fmt.Print(clearScreen)
+		v.render(os.Stdout, time.Now(), interval)
+
+		select {
+		case <-interrupt:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[uint64]string{
+		0:                  "0 B",
+		1023:               "1023 B",
+		1024:               "1.0 KiB",
+		1536:               "1.5 KiB",
+		5 * 1024 * 1024:    "5.0 MiB",
+		1024 * 1024 * 1024: "1.0 GiB",
+	}
+	for n, expected := range cases {
+		if s := formatBytes(n); s != expected {
+			t.Errorf("%d: expected %s, got %s", n, expected, s)
+		}
+	}
+}
+
+func TestTopViewAddEvents(t *testing.T) {
+	now := time.Now()
+	v := &topView{lastEv: now.Add(-time.Minute)}
+	v.addEvents([]api.Event{
+		{Type: api.EventAlert, Timestamp: now.Add(-2 * time.Minute), Message: "old"},
+		{Type: api.EventPin, Timestamp: now.Add(-time.Second)},
+		{Type: api.EventAlert, Timestamp: now, Message: "ping"},
+	})
+	if len(v.alerts) != 1 || v.alerts[0].Message != "ping" || !v.lastEv.Equal(now) {
+		t.Fatal("expected only the new alert:", v.alerts)
+	}
+
+	// events of the last second are returned again
+	v.addEvents([]api.Event{{Type: api.EventAlert, Timestamp: now, Message: "ping"}})
+	if len(v.alerts) != 1 {
+		t.Error("the alert should not be repeated:", v.alerts)
+	}
+
+	for i := 0; i < topAlerts+5; i++ {
+		v.addEvents([]api.Event{{
+			Type:      api.EventRecovered,
+			Timestamp: now.Add(time.Duration(i+1) * time.Second),
+		}})
+	}
+	if len(v.alerts) != topAlerts || v.alerts[0].Type != api.EventRecovered {
+		t.Error("only the latest alerts should be kept:", v.alerts)
+	}
+}
+
+func TestTopViewRender(t *testing.T) {
+	now := time.Now()
+	v := &topView{
+		peers: []api.ID{
+			{ID: test.TestPeerID1, Peername: "peer1"},
+			{ID: test.TestPeerID2, Peername: "peer2"},
+		},
+		metrics: map[string]map[peer.ID]api.Metric{
+			"ping": {
+				test.TestPeerID1: {Received: now.Add(-3 * time.Second).UnixNano()},
+			},
+			"freespace": {
+				test.TestPeerID1: {Value: "2048"},
+			},
+			"pinqueue": {
+				test.TestPeerID1: {Value: "7"},
+			},
+		},
+		alerts: []api.Event{
+			{Type: api.EventAlert, Timestamp: now, Message: "ping", Peer: test.TestPeerID2.Pretty()},
+		},
+	}
+
+	var buf bytes.Buffer
+	v.render(&buf, now, time.Second)
+	lines := strings.Split(buf.String(), "\n")
+
+	var peer1, peer2 string
+	for _, l := range lines {
+		if strings.HasPrefix(l, test.TestPeerID1.Pretty()) {
+			peer1 = l
+		}
+		if strings.HasPrefix(l, test.TestPeerID2.Pretty()) {
+			peer2 = l
+		}
+	}
+	for _, s := range []string{"peer1", "3s ago", "2.0 KiB", "7"} {
+		if !strings.Contains(peer1, s) {
+			t.Errorf("expected %q in %q", s, peer1)
+		}
+	}
+	if !strings.Contains(peer2, "missing") {
+		t.Error("expected a missing ping for peer2:", peer2)
+	}
+	if !strings.Contains(buf.String(), "alert      ping  "+test.TestPeerID2.Pretty()) {
+		t.Error("expected the alert in the output:", buf.String())
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	ipfscluster "github.com/ipfs/ipfs-cluster"
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
+	"github.com/ipfs/ipfs-cluster/consensus/raft"
+	"github.com/ipfs/ipfs-cluster/ipfsconn/ipfshttp"
+	"github.com/ipfs/ipfs-cluster/pstoremgr"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// Startup checks cross-check the local components before the peer starts
+// and print a report with hints to fix any problems found. They do not
+// stop the peer from starting, but some problems can be fixed
+// automatically with the --repair flag.
+
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarning
+	checkError
+)
+
+func (st checkStatus) String() string {
+	switch st {
+	case checkOK:
+		return "[ok]"
+	case checkWarning:
+		return "[warning]"
+	default:
+		return "[error]"
+	}
+}
+
+// checkResult is the outcome of a startup check. When a problem can
+// be fixed automatically, fix describes how and repair does it.
+type checkResult struct {
+	name   string
+	status checkStatus
+	msg    string
+	hint   string
+	fix    string
+	repair func() error
+}
+
+// runStartupChecks runs the startup checks, prints the report and, when
+// requested, repairs the problems which can be fixed automatically.
+// Listing the IPFS pins can take long with large pinsets, so the pins
+// allocated to this peer are only checked when checkPinset is set.
+func runStartupChecks(ctx context.Context, cfgs *cfgs, ipfs *ipfshttp.Connector, repair, checkPinset bool) {
+	var st *mapstate.MapState
+	var results []checkResult
+	if cfgs.clusterCfg.Consensus == ipfscluster.ConsensusCRDT {
+		st, results = checkCRDTState(cfgs)
+		results = append(results, checkCRDTPeerset(cfgs)...)
+	} else {
+		st, results = checkConsensusState(cfgs)
+		results = append(results, checkPeerset(cfgs)...)
+	}
+	// arbiters do not need IPFS
+	if cfgs.clusterCfg.Role != ipfscluster.RoleArbiter {
+		if !checkPinset {
+			st = nil
+		}
+		results = append(results, checkIPFS(ctx, cfgs, ipfs, st)...)
+	}
+
+	out("Startup checks:\n")
+	fixable := false
+	for _, r := range results {
+		out("  %-9s %s: %s\n", r.status, r.name, r.msg)
+		if r.hint != "" {
+			out("  %-9s hint: %s\n", "", r.hint)
+		}
+		if r.repair != nil {
+			fixable = true
+		}
+	}
+
+	if !fixable {
+		return
+	}
+	if !repair {
+		out("Some problems can be fixed automatically by starting with --repair.\n")
+		return
+	}
+
+	// Several problems may share a fix.
+	done := make(map[string]bool)
+	for _, r := range results {
+		if r.repair == nil || done[r.fix] {
+			continue
+		}
+		done[r.fix] = true
+		out("Repairing: %s\n", r.fix)
+		checkErr("repairing %s", r.repair(), r.name)
+	}
+}
+
+// checkConsensusState verifies that the last snapshot of the shared state
+// can be read and has the current format. It returns the state when it
+// could be read.
+func checkConsensusState(cfgs *cfgs) (*mapstate.MapState, []checkResult) {
+	res := checkResult{name: "consensus state"}
+	cleanup := func() error { return cleanupState(cfgs.consensusCfg) }
+
+	r, snapExists, err := raft.LastStateRaw(cfgs.consensusCfg)
+	if err == nil && !snapExists {
+		res.msg = "no saved state"
+		return nil, []checkResult{res}
+	}
+
+	var raw []byte
+	if err == nil {
+		raw, err = ioutil.ReadAll(r)
+	}
+	st := mapstate.NewMapState()
+	if err == nil {
+		err = st.Unmarshal(raw)
+	}
+	if err != nil {
+		res.status = checkError
+		res.msg = fmt.Sprintf("the last snapshot cannot be read: %s", err)
+		res.hint = "run 'ipfs-cluster-service state cleanup' to start with an empty state (a backup is kept) and bootstrap to a running peer"
+		res.fix = "clean up the consensus state"
+		res.repair = cleanup
+		return nil, []checkResult{res}
+	}
+
+	if st.GetVersion() != mapstate.Version {
+		res.status = checkError
+		res.msg = fmt.Sprintf("the state format version is %d but %d is expected", st.GetVersion(), mapstate.Version)
+		res.hint = "run 'ipfs-cluster-service state upgrade'"
+		res.fix = "upgrade the consensus state"
+		res.repair = upgrade
+		return nil, []checkResult{res}
+	}
+
+	res.msg = fmt.Sprintf("%d pins (format version %d)", len(st.List()), mapstate.Version)
+	return st, []checkResult{res}
+}
+
+// checkCRDTState verifies that the updates saved by the CRDT consensus
+// component can be read. It returns the resulting state when they could.
+func checkCRDTState(cfgs *cfgs) (*mapstate.MapState, []checkResult) {
+	res := checkResult{name: "consensus state"}
+
+	st := mapstate.NewMapState()
+	exists, err := crdt.LastState(cfgs.crdtCfg, st)
+	if err != nil {
+		res.status = checkError
+		res.msg = fmt.Sprintf("the saved updates cannot be read: %s", err)
+		res.hint = fmt.Sprintf("remove %s to start with an empty state and let the peer sync from the others", cfgs.crdtCfg.GetDataFolder())
+		return nil, []checkResult{res}
+	}
+	if !exists {
+		res.msg = "no saved state"
+		return nil, []checkResult{res}
+	}
+
+	res.msg = fmt.Sprintf("%d pins", len(st.List()))
+	return st, []checkResult{res}
+}
+
+// checkPeerset verifies that this peer is part of the current Raft
+// peerset and that the addresses of the other peers are known.
+func checkPeerset(cfgs *cfgs) []checkResult {
+	res := checkResult{name: "peerset"}
+
+	peers, exists, err := raft.LastPeers(cfgs.consensusCfg)
+	if err != nil {
+		res.status = checkError
+		res.msg = fmt.Sprintf("the peerset cannot be read: %s", err)
+		return []checkResult{res}
+	}
+	if !exists {
+		res.msg = "no saved peerset"
+		return []checkResult{res}
+	}
+
+	if !containsPeer(peers, cfgs.clusterCfg.ID) {
+		res.status = checkError
+		res.msg = fmt.Sprintf("this peer (%s) is not part of the saved peerset", cfgs.clusterCfg.ID.Pretty())
+		res.hint = "the peer was removed from the cluster or its identity changed. Run 'ipfs-cluster-service state cleanup' and bootstrap to a running peer"
+		res.fix = "clean up the consensus state"
+		res.repair = func() error { return cleanupState(cfgs.consensusCfg) }
+		return []checkResult{res}
+	}
+
+	return checkPeerAddresses(cfgs, res, peers)
+}
+
+// checkCRDTPeerset verifies that the addresses of the peers in the
+// peerset saved by the CRDT consensus component are known. Peers which
+// are not part of it yet join it on start, unless they are followers.
+func checkCRDTPeerset(cfgs *cfgs) []checkResult {
+	res := checkResult{name: "peerset"}
+
+	peers, exists, err := crdt.LastPeers(cfgs.crdtCfg)
+	if err != nil {
+		// already reported by the consensus state check
+		return nil
+	}
+	if !exists {
+		res.msg = "no saved peerset"
+		return []checkResult{res}
+	}
+	return checkPeerAddresses(cfgs, res, peers)
+}
+
+// checkPeerAddresses completes the given peerset check result with a
+// warning when the addresses of some of the given peers are unknown.
+func checkPeerAddresses(cfgs *cfgs, res checkResult, peers []peer.ID) []checkResult {
+	pm := pstoremgr.New(nil, cfgs.clusterCfg.GetPeerstorePath())
+	known := ipfscluster.PeersFromMultiaddrs(pm.LoadPeerstore())
+	var unknown []string
+	for _, p := range peers {
+		if p != cfgs.clusterCfg.ID && !containsPeer(known, p) {
+			unknown = append(unknown, p.Pretty())
+		}
+	}
+	if len(unknown) > 0 {
+		res.status = checkWarning
+		res.msg = fmt.Sprintf("no known addresses for %d peers: %s", len(unknown), unknown)
+		res.hint = fmt.Sprintf("add their multiaddresses to %s or bootstrap to a running peer", cfgs.clusterCfg.GetPeerstorePath())
+		return []checkResult{res}
+	}
+
+	res.msg = fmt.Sprintf("%d peers", len(peers))
+	return []checkResult{res}
+}
+
+// checkIPFS verifies that the IPFS daemon is reachable and, when a
+// shared state is given and the peer stores pins, that the pins
+// allocated to this peer are pinned in IPFS.
+func checkIPFS(ctx context.Context, cfgs *cfgs, ipfs *ipfshttp.Connector, st *mapstate.MapState) []checkResult {
+	res := checkResult{name: "ipfs daemon"}
+
+	id, err := ipfs.ID()
+	if err != nil {
+		res.status = checkError
+		res.msg = err.Error()
+		res.hint = fmt.Sprintf("check that the IPFS daemon is running and that its API listens on %s", cfgs.ipfshttpCfg.NodeAddr)
+		return []checkResult{res}
+	}
+	res.msg = fmt.Sprintf("reachable (%s)", id.ID.Pretty())
+
+	if st == nil || !cfgs.clusterCfg.StoresPins() {
+		return []checkResult{res}
+	}
+
+	pinset := checkResult{name: "pinset"}
+	pinned := make(map[string]api.IPFSPinStatus)
+	for _, t := range []string{"recursive", "direct"} {
+		pins, err := ipfs.PinLs(ctx, t)
+		if err != nil {
+			pinset.status = checkError
+			pinset.msg = fmt.Sprintf("cannot list the IPFS pins: %s", err)
+			return []checkResult{res, pinset}
+		}
+		for k, v := range pins {
+			pinned[k] = v
+		}
+	}
+
+	missing := 0
+	for _, pin := range st.ListAllocatedTo(cfgs.clusterCfg.ID) {
+		if !pinned[pin.Cid.String()].IsPinned() {
+			missing++
+		}
+	}
+	if missing > 0 {
+		pinset.status = checkWarning
+		pinset.msg = fmt.Sprintf("%d pins allocated to this peer are not pinned in IPFS", missing)
+		pinset.hint = "they will be pinned after start. Check 'ipfs-cluster-ctl status' if they do not progress and run 'ipfs-cluster-ctl recover' for those in error"
+		return []checkResult{res, pinset}
+	}
+	pinset.msg = "all pins allocated to this peer are pinned in IPFS"
+	return []checkResult{res, pinset}
+}
+
+func containsPeer(list []peer.ID, p peer.ID) bool {
+	for _, pid := range list {
+		if pid == p {
+			return true
+		}
+	}
+	return false
+}
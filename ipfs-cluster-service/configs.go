@@ -6,46 +6,94 @@ import (
 	"path/filepath"
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
+	"github.com/ipfs/ipfs-cluster/allocator/balanced"
+	"github.com/ipfs/ipfs-cluster/allocator/external"
+	"github.com/ipfs/ipfs-cluster/allocator/weighted"
+	"github.com/ipfs/ipfs-cluster/api/pinsvcapi"
 	"github.com/ipfs/ipfs-cluster/api/rest"
 	"github.com/ipfs/ipfs-cluster/config"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
+	"github.com/ipfs/ipfs-cluster/informer/bandwidth"
 	"github.com/ipfs/ipfs-cluster/informer/disk"
+	"github.com/ipfs/ipfs-cluster/informer/latency"
 	"github.com/ipfs/ipfs-cluster/informer/numpin"
+	"github.com/ipfs/ipfs-cluster/informer/popularity"
+	"github.com/ipfs/ipfs-cluster/informer/sysinfo"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
+	"github.com/ipfs/ipfs-cluster/informer/tracked"
 	"github.com/ipfs/ipfs-cluster/ipfsconn/ipfshttp"
 	"github.com/ipfs/ipfs-cluster/monitor/basic"
 	"github.com/ipfs/ipfs-cluster/pintracker/maptracker"
+	"github.com/ipfs/ipfs-cluster/pintracker/stateless"
 )
 
 type cfgs struct {
-	clusterCfg   *ipfscluster.Config
-	apiCfg       *rest.Config
-	ipfshttpCfg  *ipfshttp.Config
-	consensusCfg *raft.Config
-	trackerCfg   *maptracker.Config
-	monCfg       *basic.Config
-	diskInfCfg   *disk.Config
-	numpinInfCfg *numpin.Config
+	clusterCfg    *ipfscluster.Config
+	apiCfg        *rest.Config
+	pinsvcapiCfg  *pinsvcapi.Config
+	ipfshttpCfg   *ipfshttp.Config
+	consensusCfg  *raft.Config
+	crdtCfg       *crdt.Config
+	trackerCfg    *maptracker.Config
+	statelessCfg  *stateless.Config
+	monCfg        *basic.Config
+	balancedCfg   *balanced.Config
+	weightedCfg   *weighted.Config
+	externalCfg   *external.Config
+	diskInfCfg    *disk.Config
+	numpinInfCfg  *numpin.Config
+	trackedInfCfg *tracked.Config
+	bwInfCfg      *bandwidth.Config
+	sysInfCfg     *sysinfo.Config
+	tagsInfCfg    *tags.Config
+	latencyInfCfg *latency.Config
+	popInfCfg     *popularity.Config
 }
 
 func makeConfigs() (*config.Manager, *cfgs) {
 	cfg := config.NewManager()
 	clusterCfg := &ipfscluster.Config{}
 	apiCfg := &rest.Config{}
+	pinsvcapiCfg := &pinsvcapi.Config{}
 	ipfshttpCfg := &ipfshttp.Config{}
 	consensusCfg := &raft.Config{}
+	crdtCfg := &crdt.Config{}
 	trackerCfg := &maptracker.Config{}
+	statelessCfg := &stateless.Config{}
 	monCfg := &basic.Config{}
+	balancedCfg := &balanced.Config{}
+	weightedCfg := &weighted.Config{}
+	externalCfg := &external.Config{}
 	diskInfCfg := &disk.Config{}
 	numpinInfCfg := &numpin.Config{}
+	trackedInfCfg := &tracked.Config{}
+	bwInfCfg := &bandwidth.Config{}
+	sysInfCfg := &sysinfo.Config{}
+	tagsInfCfg := &tags.Config{}
+	latencyInfCfg := &latency.Config{}
+	popInfCfg := &popularity.Config{}
 	cfg.RegisterComponent(config.Cluster, clusterCfg)
 	cfg.RegisterComponent(config.API, apiCfg)
+	cfg.RegisterComponent(config.API, pinsvcapiCfg)
 	cfg.RegisterComponent(config.IPFSConn, ipfshttpCfg)
 	cfg.RegisterComponent(config.Consensus, consensusCfg)
+	cfg.RegisterComponent(config.Consensus, crdtCfg)
 	cfg.RegisterComponent(config.PinTracker, trackerCfg)
+	cfg.RegisterComponent(config.PinTracker, statelessCfg)
 	cfg.RegisterComponent(config.Monitor, monCfg)
+	cfg.RegisterComponent(config.Allocator, balancedCfg)
+	cfg.RegisterComponent(config.Allocator, weightedCfg)
+	cfg.RegisterComponent(config.Allocator, externalCfg)
 	cfg.RegisterComponent(config.Informer, diskInfCfg)
 	cfg.RegisterComponent(config.Informer, numpinInfCfg)
-	return cfg, &cfgs{clusterCfg, apiCfg, ipfshttpCfg, consensusCfg, trackerCfg, monCfg, diskInfCfg, numpinInfCfg}
+	cfg.RegisterComponent(config.Informer, trackedInfCfg)
+	cfg.RegisterComponent(config.Informer, bwInfCfg)
+	cfg.RegisterComponent(config.Informer, sysInfCfg)
+	cfg.RegisterComponent(config.Informer, tagsInfCfg)
+	cfg.RegisterComponent(config.Informer, latencyInfCfg)
+	cfg.RegisterComponent(config.Informer, popInfCfg)
+	return cfg, &cfgs{clusterCfg, apiCfg, pinsvcapiCfg, ipfshttpCfg, consensusCfg, crdtCfg, trackerCfg, statelessCfg, monCfg, balancedCfg, weightedCfg, externalCfg, diskInfCfg, numpinInfCfg, trackedInfCfg, bwInfCfg, sysInfCfg, tagsInfCfg, latencyInfCfg, popInfCfg}
 }
 
 func saveConfig(cfg *config.Manager, force bool) {
@@ -12,14 +12,26 @@ import (
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
 	"github.com/ipfs/ipfs-cluster/allocator/ascendalloc"
+	"github.com/ipfs/ipfs-cluster/allocator/balanced"
 	"github.com/ipfs/ipfs-cluster/allocator/descendalloc"
+	"github.com/ipfs/ipfs-cluster/allocator/external"
+	"github.com/ipfs/ipfs-cluster/allocator/weighted"
+	"github.com/ipfs/ipfs-cluster/api/pinsvcapi"
 	"github.com/ipfs/ipfs-cluster/api/rest"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
+	"github.com/ipfs/ipfs-cluster/informer/bandwidth"
 	"github.com/ipfs/ipfs-cluster/informer/disk"
+	"github.com/ipfs/ipfs-cluster/informer/latency"
 	"github.com/ipfs/ipfs-cluster/informer/numpin"
+	"github.com/ipfs/ipfs-cluster/informer/popularity"
+	"github.com/ipfs/ipfs-cluster/informer/sysinfo"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
+	"github.com/ipfs/ipfs-cluster/informer/tracked"
 	"github.com/ipfs/ipfs-cluster/ipfsconn/ipfshttp"
 	"github.com/ipfs/ipfs-cluster/monitor/basic"
 	"github.com/ipfs/ipfs-cluster/pintracker/maptracker"
+	"github.com/ipfs/ipfs-cluster/pintracker/stateless"
 	"github.com/ipfs/ipfs-cluster/pstoremgr"
 	"github.com/ipfs/ipfs-cluster/state/mapstate"
 
@@ -78,7 +90,7 @@ func daemon(c *cli.Context) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	cluster, err := createCluster(ctx, c, cfgs, raftStaging)
+	cluster, lstnrs, err := createCluster(ctx, c, cfgs, raftStaging)
 	checkErr("starting cluster", err)
 
 	// noop if no bootstraps
@@ -88,7 +100,14 @@ func daemon(c *cli.Context) error {
 	// will realize).
 	go bootstrap(cluster, bootstraps)
 
-	return handleSignals(cluster)
+	return handleSignals(cluster, cfgs, lstnrs)
+}
+
+// listeners holds the components whose listening addresses can be
+// changed without restarting the peer. api is nil for arbiters.
+type listeners struct {
+	api   *rest.API
+	proxy *ipfshttp.Connector
 }
 
 func createCluster(
@@ -96,7 +115,7 @@ func createCluster(
 	c *cli.Context,
 	cfgs *cfgs,
 	raftStaging bool,
-) (*ipfscluster.Cluster, error) {
+) (*ipfscluster.Cluster, *listeners, error) {
 
 	host, err := ipfscluster.NewClusterHost(ctx, cfgs.clusterCfg)
 	checkErr("creating libP2P Host", err)
@@ -104,44 +123,108 @@ func createCluster(
 	peerstoreMgr := pstoremgr.New(host, cfgs.clusterCfg.GetPeerstorePath())
 	peerstoreMgr.ImportPeersFromPeerstore(false)
 
-	api, err := rest.NewAPIWithHost(cfgs.apiCfg, host)
-	checkErr("creating REST API component", err)
+	// Arbiters do not serve any API.
+	var apis []ipfscluster.API
+	var restapi *rest.API
+	if cfgs.clusterCfg.Role != ipfscluster.RoleArbiter {
+		restapi, err = rest.NewAPIWithHost(cfgs.apiCfg, host)
+		checkErr("creating REST API component", err)
+		apis = append(apis, restapi)
+		if cfgs.pinsvcapiCfg.Enabled {
+			pinsvc, err := pinsvcapi.NewAPI(cfgs.pinsvcapiCfg)
+			checkErr("creating Pinning Service API component", err)
+			apis = append(apis, pinsvc)
+		}
+	}
 
 	proxy, err := ipfshttp.NewConnector(cfgs.ipfshttpCfg)
 	checkErr("creating IPFS Connector component", err)
 
+	runStartupChecks(ctx, cfgs, proxy, c.Bool("repair"), c.Bool("check-pinset"))
+
 	state := mapstate.NewMapState()
 
 	err = validateVersion(cfgs.clusterCfg, cfgs.consensusCfg)
 	checkErr("validating version", err)
 
-	raftcon, err := raft.NewConsensus(
-		host,
-		cfgs.consensusCfg,
-		state,
-		raftStaging,
-	)
+	var consensus ipfscluster.Consensus
+	switch cfgs.clusterCfg.Consensus {
+	case ipfscluster.ConsensusCRDT:
+		cfgs.crdtCfg.Namespace = cfgs.clusterCfg.Namespace
+		consensus, err = crdt.NewConsensus(
+			host,
+			cfgs.crdtCfg,
+			state,
+		)
+		ipfscluster.ReadyTimeout = cfgs.crdtCfg.NetworkTimeout + 5*time.Second
+	default:
+		if len(cfgs.crdtCfg.TrustedPeers) > 0 {
+			checkErr("creating consensus component", errors.New("crdt.trusted_peers is only supported by the crdt consensus"))
+		}
+		consensus, err = raft.NewConsensus(
+			host,
+			cfgs.consensusCfg,
+			state,
+			raftStaging,
+		)
+		ipfscluster.ReadyTimeout = cfgs.consensusCfg.WaitForLeaderTimeout + 5*time.Second
+	}
 	checkErr("creating consensus component", err)
 
-	tracker := maptracker.NewMapPinTracker(cfgs.trackerCfg, cfgs.clusterCfg.ID)
+	var tracker ipfscluster.PinTracker
+	switch cfgs.clusterCfg.PinTracker {
+	case ipfscluster.PinTrackerStateless:
+		// The stateless tracker does not count the pinned items.
+		if cfgs.trackerCfg.MaxPins > 0 {
+			checkErr("creating pin tracker", errors.New("maptracker.max_pins is not supported by the stateless pin tracker"))
+		}
+		spt := stateless.NewStatelessPinTracker(cfgs.statelessCfg, cfgs.clusterCfg.ID)
+		spt.SetRemoteOnly(!cfgs.clusterCfg.StoresPins())
+		tracker = spt
+	default:
+		mpt := maptracker.NewMapPinTracker(cfgs.trackerCfg, cfgs.clusterCfg.ID)
+		mpt.SetRemoteOnly(!cfgs.clusterCfg.StoresPins())
+		tracker = mpt
+	}
 	mon, err := basic.NewMonitor(cfgs.monCfg)
 	checkErr("creating Monitor component", err)
-	informer, alloc := setupAllocation(c.String("alloc"), cfgs.diskInfCfg, cfgs.numpinInfCfg)
-
-	ipfscluster.ReadyTimeout = cfgs.consensusCfg.WaitForLeaderTimeout + 5*time.Second
+	informers, alloc := setupAllocation(
+		c.String("alloc"),
+		cfgs.diskInfCfg,
+		cfgs.numpinInfCfg,
+		cfgs.bwInfCfg,
+		cfgs.trackedInfCfg,
+		cfgs.latencyInfCfg,
+		cfgs.balancedCfg,
+		cfgs.weightedCfg,
+		cfgs.externalCfg,
+	)
+	sysInf, err := sysinfo.NewInformer(cfgs.sysInfCfg)
+	checkErr("creating informer", err)
+	informers = append(informers, sysInf)
+	tagsInf, err := tags.NewInformer(cfgs.tagsInfCfg)
+	checkErr("creating informer", err)
+	informers = append(informers, tagsInf)
+	if c.String("alloc") != "latency" {
+		informers = append(informers, latencyInformers(cfgs.latencyInfCfg)...)
+	}
+	popInf, err := popularity.NewInformer(cfgs.popInfCfg)
+	checkErr("creating informer", err)
+	informers = append(informers, popInf)
 
-	return ipfscluster.NewCluster(
+	cluster, err := ipfscluster.NewCluster(
 		host,
 		cfgs.clusterCfg,
-		raftcon,
-		api,
+		consensus,
+		apis,
 		proxy,
 		state,
 		tracker,
 		mon,
 		alloc,
-		informer,
+		informers,
 	)
+	return cluster, &listeners{restapi, proxy}, err
 }
 
 // bootstrap will bootstrap this peer to one of the bootstrap addresses
@@ -156,27 +239,74 @@ func bootstrap(cluster *ipfscluster.Cluster, bootstraps []ma.Multiaddr) {
 	}
 }
 
-func handleSignals(cluster *ipfscluster.Cluster) error {
+func handleSignals(cluster *ipfscluster.Cluster, cfgs *cfgs, lstnrs *listeners) error {
 	signalChan := make(chan os.Signal, 20)
 	signal.Notify(
 		signalChan,
 		syscall.SIGINT,
 		syscall.SIGTERM,
-		syscall.SIGHUP,
 	)
 
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+
 	var ctrlcCount int
 	for {
 		select {
 		case <-signalChan:
 			ctrlcCount++
 			handleCtrlC(cluster, ctrlcCount)
+		case <-reloadChan:
+			reloadListeners(cluster, cfgs, lstnrs)
 		case <-cluster.Done():
 			return nil
 		}
 	}
 }
 
+// reloadListeners reads the configuration file again and moves the REST API,
+// the IPFS proxy and the cluster peer to the configured addresses if they
+// have changed. In-flight requests on the old addresses are not interrupted.
+func reloadListeners(cluster *ipfscluster.Cluster, cfgs *cfgs, lstnrs *listeners) {
+	logger.Info("SIGHUP received: reloading listen addresses from the configuration")
+
+	cfgMgr, newCfgs := makeConfigs()
+	defer cfgMgr.Shutdown()
+
+	err := cfgMgr.LoadJSONFromFile(configPath)
+	if err != nil {
+		logger.Errorf("error reloading configuration: %s", err)
+		return
+	}
+
+	if lstnrs.api != nil && newCfgs.apiCfg.HTTPListenAddr != nil {
+		err = lstnrs.api.SetHTTPListenAddr(newCfgs.apiCfg.HTTPListenAddr)
+		if err != nil {
+			logger.Errorf("error moving the REST API listener: %s", err)
+		}
+	}
+
+	err = lstnrs.proxy.SetProxyAddr(newCfgs.ipfshttpCfg.ProxyAddr)
+	if err != nil {
+		logger.Errorf("error moving the IPFS proxy listener: %s", err)
+	}
+
+	if newCfgs.clusterCfg.ListenAddr != nil &&
+		!equalAddrs(newCfgs.clusterCfg.ListenAddr, cfgs.clusterCfg.ListenAddr) {
+		err = cluster.SetListenAddr(newCfgs.clusterCfg.ListenAddr)
+		if err != nil {
+			logger.Errorf("error moving the cluster listener: %s", err)
+		}
+	}
+}
+
+func equalAddrs(a, b ma.Multiaddr) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(b)
+}
+
 func handleCtrlC(cluster *ipfscluster.Cluster, ctrlcCount int) {
 	switch ctrlcCount {
 	case 1:
@@ -197,30 +327,159 @@ Note that this may corrupt the local cluster state.
 `)
 	case 3:
 		out("exiting cluster NOW")
-		os.Exit(-1)
+		exit(-1)
 	}
 }
 
+// setupAllocation returns the informers and the allocator for the given
+// allocation strategy. The first informer provides the metric used for
+// allocations. The disk and tracked pins metrics are always broadcasted.
+// The latency metrics are broadcasted by the daemon when not used for
+// allocations.
 func setupAllocation(name string,
 	diskInfCfg *disk.Config,
 	numpinInfCfg *numpin.Config,
-) (ipfscluster.Informer, ipfscluster.PinAllocator) {
+	bwInfCfg *bandwidth.Config,
+	trackedInfCfg *tracked.Config,
+	latencyInfCfg *latency.Config,
+	balancedCfg *balanced.Config,
+	weightedCfg *weighted.Config,
+	externalCfg *external.Config,
+) ([]ipfscluster.Informer, ipfscluster.PinAllocator) {
 	switch name {
 	case "disk", "disk-freespace":
-		informer, err := disk.NewInformer(diskInfCfg)
-		checkErr("creating informer", err)
-		return informer, descendalloc.NewAllocator()
+		informers := append(
+			diskInformers(diskInfCfg, disk.MetricFreeSpace),
+			trackedInformers(trackedInfCfg, tracked.MetricTrackedPins)...,
+		)
+		return informers, descendalloc.NewAllocator()
 	case "disk-reposize":
-		informer, err := disk.NewInformer(diskInfCfg)
-		checkErr("creating informer", err)
-		return informer, ascendalloc.NewAllocator()
+		informers := append(
+			diskInformers(diskInfCfg, disk.MetricRepoSize),
+			trackedInformers(trackedInfCfg, tracked.MetricTrackedPins)...,
+		)
+		return informers, ascendalloc.NewAllocator()
 	case "numpin", "pincount":
 		informer, err := numpin.NewInformer(numpinInfCfg)
 		checkErr("creating informer", err)
-		return informer, ascendalloc.NewAllocator()
+		informers := append(
+			[]ipfscluster.Informer{informer},
+			diskInformers(diskInfCfg, disk.MetricFreeSpace)...,
+		)
+		informers = append(informers, trackedInformers(trackedInfCfg, tracked.MetricTrackedPins)...)
+		return informers, ascendalloc.NewAllocator()
+	case "bandwidth", "bandwidth-in":
+		informers := append(
+			bandwidthInformers(bwInfCfg),
+			diskInformers(diskInfCfg, disk.MetricFreeSpace)...,
+		)
+		informers = append(informers, trackedInformers(trackedInfCfg, tracked.MetricTrackedPins)...)
+		return informers, ascendalloc.NewAllocator()
+	case "pinqueue":
+		informers := append(
+			trackedInformers(trackedInfCfg, tracked.MetricPinQueue),
+			diskInformers(diskInfCfg, disk.MetricFreeSpace)...,
+		)
+		return informers, ascendalloc.NewAllocator()
+	case "latency":
+		informers := append(
+			latencyInformers(latencyInfCfg),
+			diskInformers(diskInfCfg, disk.MetricFreeSpace)...,
+		)
+		informers = append(informers, trackedInformers(trackedInfCfg, tracked.MetricTrackedPins)...)
+		return informers, ascendalloc.NewAllocator()
+	case "balanced":
+		informers := append(
+			diskInformers(diskInfCfg, disk.MetricFreeSpace),
+			trackedInformers(trackedInfCfg, tracked.MetricTrackedPins)...,
+		)
+		alloc, err := balanced.NewAllocator(balancedCfg)
+		checkErr("creating allocator", err)
+		return informers, alloc
+	case "weighted":
+		informers := append(
+			diskInformers(diskInfCfg, disk.MetricFreeSpace),
+			trackedInformers(trackedInfCfg, tracked.MetricTrackedPins)...,
+		)
+		informers = append(informers, bandwidthInformers(bwInfCfg)...)
+		alloc, err := weighted.NewAllocator(weightedCfg)
+		checkErr("creating allocator", err)
+		return informers, alloc
+	case "external":
+		informers := append(
+			diskInformers(diskInfCfg, disk.MetricFreeSpace),
+			trackedInformers(trackedInfCfg, tracked.MetricTrackedPins)...,
+		)
+		informers = append(informers, bandwidthInformers(bwInfCfg)...)
+		alloc, err := external.NewAllocator(externalCfg)
+		checkErr("creating allocator", err)
+		return informers, alloc
 	default:
 		err := errors.New("unknown allocation strategy")
 		checkErr("", err)
 		return nil, nil
 	}
 }
+
+// diskInformers returns a disk informer for every disk metric type,
+// starting with the given one.
+func diskInformers(diskInfCfg *disk.Config, first disk.MetricType) []ipfscluster.Informer {
+	types := []disk.MetricType{first}
+	for _, t := range []disk.MetricType{disk.MetricFreeSpace, disk.MetricRepoSize} {
+		if t != first {
+			types = append(types, t)
+		}
+	}
+
+	var informers []ipfscluster.Informer
+	for _, t := range types {
+		cfg := *diskInfCfg
+		cfg.Type = t
+		informer, err := disk.NewInformer(&cfg)
+		checkErr("creating informer", err)
+		informers = append(informers, informer)
+	}
+	return informers
+}
+
+// trackedInformers returns a tracked informer for the tracked pins and
+// for the pin queue length, starting with the given one.
+func trackedInformers(trackedInfCfg *tracked.Config, first tracked.MetricType) []ipfscluster.Informer {
+	types := []tracked.MetricType{first}
+	for _, t := range []tracked.MetricType{tracked.MetricTrackedPins, tracked.MetricPinQueue} {
+		if t != first {
+			types = append(types, t)
+		}
+	}
+
+	var informers []ipfscluster.Informer
+	for _, t := range types {
+		cfg := *trackedInfCfg
+		cfg.Type = t
+		informer, err := tracked.NewInformer(&cfg)
+		checkErr("creating informer", err)
+		informers = append(informers, informer)
+	}
+	return informers
+}
+
+// bandwidthInformers returns an informer for the inbound bandwidth rate,
+// used for allocations, followed by one for the outbound rate.
+func bandwidthInformers(bwInfCfg *bandwidth.Config) []ipfscluster.Informer {
+	var informers []ipfscluster.Informer
+	for _, t := range []bandwidth.MetricType{bandwidth.MetricRateIn, bandwidth.MetricRateOut} {
+		cfg := *bwInfCfg
+		cfg.Type = t
+		informer, err := bandwidth.NewInformer(&cfg)
+		checkErr("creating informer", err)
+		informers = append(informers, informer)
+	}
+	return informers
+}
+
+// latencyInformers returns an informer which pings the other peers.
+func latencyInformers(latencyInfCfg *latency.Config) []ipfscluster.Informer {
+	informer, err := latency.NewInformer(latencyInfCfg)
+	checkErr("creating informer", err)
+	return []ipfscluster.Informer{informer}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+
+	ipfscluster "github.com/ipfs/ipfs-cluster"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// The dev command runs a throw-away, single-peer cluster to try out the
+// REST API and ipfs-cluster-ctl without setting anything up. Every
+// component uses its default configuration, except that:
+//
+//   - the configuration and all data live in a temporary folder which is
+//     removed on exit (unless --data is given, in which case a configuration
+//     there is overwritten).
+//   - the CRDT consensus is used, as a single peer does not need Raft.
+//   - the cluster only listens on localhost.
+//   - when built with the "devmock" tag, an in-process IPFS mock is used
+//     unless --ipfs is given. The mock implements the IPFS API used by the
+//     cluster and records the pins, but it does not store any content.
+//   - logging is verbose.
+//
+// The temporary folder and the mock are also cleaned up when exiting
+// because of an error.
+func dev(c *cli.Context) error {
+	if !c.GlobalIsSet("loglevel") {
+		setupLogLevel("debug")
+	}
+
+	dir := c.String("data")
+	if dir == "" {
+		tmp, err := ioutil.TempDir("", "ipfs-cluster-dev")
+		checkErr("creating temporary folder", err)
+		defer atExit(func() { os.RemoveAll(tmp) })()
+		dir = tmp
+	} else {
+		err := os.MkdirAll(dir, 0700)
+		checkErr("creating data folder", err)
+	}
+
+	cfgMgr, cfgs := makeConfigs()
+	defer cfgMgr.Shutdown()
+	err := cfgMgr.Default()
+	checkErr("generating default configuration", err)
+
+	cfgs.clusterCfg.Peername = "dev"
+	cfgs.clusterCfg.Consensus = ipfscluster.ConsensusCRDT
+	cfgs.clusterCfg.ListenAddr, _ = ma.NewMultiaddr("/ip4/127.0.0.1/tcp/9096")
+
+	ipfsAddr := c.String("ipfs")
+	if ipfsAddr == "" {
+		if mockAddr, stop, ok := startIPFSMock(); ok {
+			defer atExit(stop)()
+			ipfsAddr = mockAddr
+		}
+	}
+	if ipfsAddr != "" {
+		cfgs.ipfshttpCfg.NodeAddr, err = ma.NewMultiaddr(ipfsAddr)
+		checkErr("parsing the IPFS API multiaddress", err)
+	}
+
+	// Saving and loading the configuration places the data of all the
+	// components in the folder, and lets the listeners be reloaded on
+	// SIGHUP as usual.
+	configPath = filepath.Join(dir, DefaultConfigFile)
+	err = cfgMgr.SaveJSON(configPath)
+	checkErr("saving configuration", err)
+	err = cfgMgr.LoadJSONFromFile(configPath)
+	checkErr("loading configuration", err)
+
+	out("Development cluster (data in %s)\n", dir)
+	out("  REST API: %s\n", cfgs.apiCfg.HTTPListenAddr)
+	if cfgs.pinsvcapiCfg.Enabled {
+		out("  Pinning Service API: %s\n", cfgs.pinsvcapiCfg.HTTPListenAddr)
+	}
+	out("  IPFS API: %s\n", cfgs.ipfshttpCfg.NodeAddr)
+	out("  IPFS Proxy: %s\n", cfgs.ipfshttpCfg.ProxyAddr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cluster, lstnrs, err := createCluster(ctx, c, cfgs, false)
+	checkErr("starting cluster", err)
+
+	return handleSignals(cluster, cfgs, lstnrs)
+}
+
+// atExit makes f run when exiting early (see exit) and returns it, so
+// that it can also be deferred.
+func atExit(f func()) func() {
+	exitHooks = append(exitHooks, f)
+	return f
+}
@@ -0,0 +1,17 @@
+//go:build devmock
+// +build devmock
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+// startIPFSMock starts the in-process IPFS mock used by the dev command
+// and returns the multiaddress of its API and a function to stop it.
+func startIPFSMock() (string, func(), bool) {
+	mock := test.NewIpfsMock()
+	return fmt.Sprintf("/ip4/%s/tcp/%d", mock.Addr, mock.Port), mock.Close, true
+}
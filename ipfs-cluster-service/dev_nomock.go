@@ -0,0 +1,11 @@
+//go:build !devmock
+// +build !devmock
+
+package main
+
+// startIPFSMock is not available without the "devmock" build tag, so
+// that the mocks and the testing package are left out of the release
+// binaries.
+func startIPFSMock() (string, func(), bool) {
+	return "", nil, false
+}
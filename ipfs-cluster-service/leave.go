@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// The leave command asks the running peer to remove itself from the
+// cluster. It talks to the peer through its local RPC socket, so the
+// local_rpc_socket option must be set. With --drain, the pins of the peer
+// are first re-allocated and pinned by the other peers, so that leaving
+// does not lower their replication.
+func leave(c *cli.Context) error {
+	cfgMgr, cfgs := makeConfigs()
+	err := cfgMgr.LoadJSONFromFile(configPath)
+	checkErr("loading configuration", err)
+
+	socket := cfgs.clusterCfg.GetLocalRPCSocketPath()
+	if socket == "" {
+		checkErr("leaving the cluster", errors.New("local_rpc_socket is not set in the configuration"))
+	}
+	token := cfgs.clusterCfg.LocalRPCToken
+	if token == "" {
+		tokenBytes, err := ioutil.ReadFile(socket + ".token")
+		checkErr("reading the local RPC token", err)
+		token = strings.TrimSpace(string(tokenBytes))
+	}
+
+	body, err := json.Marshal(api.PeerLeaveRequest{
+		Peer:  peer.IDB58Encode(cfgs.clusterCfg.ID),
+		Drain: c.Bool("drain"),
+	})
+	checkErr("encoding the request", err)
+
+	client := &http.Client{
+		Timeout: c.Duration("timeout"),
+		Transport: &http.Transport{
+			Dial: func(_, _ string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		},
+	}
+	req, err := http.NewRequest("POST", "http://local-rpc/PeerLeave", bytes.NewReader(body))
+	checkErr("creating the request", err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if c.Bool("drain") {
+		out("draining: waiting for the pins of this peer to be pinned elsewhere\n")
+	}
+	resp, err := client.Do(req)
+	checkErr("contacting the running peer", err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr api.Error
+		err = json.NewDecoder(resp.Body).Decode(&apiErr)
+		if err == nil {
+			err = errors.New(apiErr.Message)
+		}
+		checkErr("leaving the cluster", err)
+	}
+	fmt.Printf("%s left the cluster\n", cfgs.clusterCfg.ID.Pretty())
+	return nil
+}
@@ -139,10 +139,22 @@ func checkErr(doing string, err error, args ...interface{}) {
 		if err != nil {
 			out("error releasing execution lock: %s\n", err)
 		}
-		os.Exit(1)
+		exit(1)
 	}
 }
 
+// exitHooks are run, last first, when the program exits early because
+// of an error or an interruption.
+var exitHooks []func()
+
+// exit runs the exitHooks and exits with the given code.
+func exit(code int) {
+	for i := len(exitHooks) - 1; i >= 0; i-- {
+		exitHooks[i]()
+	}
+	os.Exit(code)
+}
+
 func main() {
 	// go func() {
 	//	log.Println(http.ListenAndServe("localhost:6060", nil))
@@ -240,11 +252,79 @@ configuration.
 				cli.StringFlag{
 					Name:  "alloc, a",
 					Value: defaultAllocation,
-					Usage: "allocation strategy to use [disk-freespace,disk-reposize,numpin].",
+					Usage: "allocation strategy to use [disk-freespace,disk-reposize,numpin,bandwidth,pinqueue,latency,balanced,weighted,external].",
+				},
+				cli.BoolFlag{
+					Name:  "repair",
+					Usage: "fix the problems found by the startup checks which can be fixed automatically",
+				},
+				cli.BoolFlag{
+					Name:  "check-pinset",
+					Usage: "check on startup that the pins allocated to this peer are pinned in IPFS (lists all the IPFS pins)",
 				},
 			},
 			Action: daemon,
 		},
+		{
+			Name:  "leave",
+			Usage: "remove the running peer from the cluster",
+			Description: fmt.Sprintf(`
+This command asks the running %s peer to remove itself from the
+cluster. It uses the local RPC socket of the peer, which must be enabled
+with the "local_rpc_socket" option.
+
+By default the peer is removed right away, like with "peers rm": its pins
+are re-allocated without waiting for other peers to pin them. With --drain, the peer is excluded from
+new allocations, its pins are re-allocated to other peers and it is only
+removed once they have pinned them, so that the replication of the pins
+never goes down. The peer keeps running afterwards and can be shut down.
+`, programName),
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "drain",
+					Usage: "re-allocate the pins of the peer and wait until they are pinned elsewhere before leaving",
+				},
+				cli.DurationFlag{
+					Name:  "timeout, t",
+					Usage: "how long to wait for the peer to leave. 0 waits forever",
+				},
+			},
+			Action: leave,
+		},
+		{
+			Name:  "dev",
+			Usage: "run a throw-away single-peer cluster for development",
+			Description: fmt.Sprintf(`
+This command runs a single %s peer with default settings, without the
+need to initialize a configuration or to run IPFS. It uses the CRDT
+consensus, listens on localhost only, serves the REST API on its
+default port and logs verbosely.
+
+Unless --ipfs is given, the IPFS daemon listening on the default API
+address is used. Binaries built with the "devmock" tag use an
+in-process IPFS mock instead, which records pins but does not store
+any content.
+
+The configuration and all data are kept in a temporary folder which is
+removed on exit, unless --data is given.
+`, programName),
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "ipfs",
+					Usage: "multiaddress of the API of the IPFS daemon to use",
+				},
+				cli.StringFlag{
+					Name:  "data",
+					Usage: "folder to keep the configuration and data in",
+				},
+				cli.StringFlag{
+					Name:  "alloc, a",
+					Value: defaultAllocation,
+					Usage: "allocation strategy to use [disk-freespace,disk-reposize,numpin,bandwidth,pinqueue,latency,balanced,weighted,external].",
+				},
+			},
+			Action: dev,
+		},
 		{
 			Name:  "state",
 			Usage: "Manage ipfs-cluster-state",
@@ -285,6 +365,10 @@ This command reads the current cluster state and saves it as json for
 human readability and editing.  Only state formats compatible with this
 version of ipfs-cluster-service can be exported.  By default this command
 prints the state to stdout.
+
+The state saved by the configured consensus component is exported, unless
+another one is given with --consensus. Together with "import", this allows
+to migrate the pinset between consensus components.
 `,
 					Flags: []cli.Flag{
 						cli.StringFlag{
@@ -292,6 +376,11 @@ prints the state to stdout.
 							Value: "",
 							Usage: "sets an output file for exported state",
 						},
+						cli.StringFlag{
+							Name:  "consensus",
+							Value: "",
+							Usage: "export the state saved by this consensus component [raft,crdt]",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						err := locker.lock()
@@ -310,7 +399,7 @@ prints the state to stdout.
 						}
 						defer w.Close()
 
-						err = export(w)
+						err = export(w, c.String("consensus"))
 						checkErr("exporting state", err)
 						return nil
 					},
@@ -323,7 +412,17 @@ This command reads in an exported state file storing the state as a persistent
 snapshot to be loaded as the cluster state when the cluster peer is restarted.
 If an argument is provided, cluster will treat it as the path of the file to
 import.  If no argument is provided cluster will read json from stdin
+
+The state is imported for the configured consensus component, unless another
+one is given with --consensus.
 `,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "consensus",
+							Value: "",
+							Usage: "import the state for this consensus component [raft,crdt]",
+						},
+					},
 					Action: func(c *cli.Context) error {
 						err := locker.lock()
 						checkErr("acquiring execution lock", err)
@@ -346,7 +445,7 @@ import.  If no argument is provided cluster will read json from stdin
 							checkErr("reading import file", err)
 						}
 						defer r.Close()
-						err = stateImport(r)
+						err = stateImport(r, c.String("consensus"))
 						checkErr("importing state", err)
 						logger.Info("the given state has been correctly imported to this peer.  Make sure all peers have consistent states")
 						return nil
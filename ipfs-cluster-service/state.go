@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/consensus/crdt"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
 	"github.com/ipfs/ipfs-cluster/pstoremgr"
 	"github.com/ipfs/ipfs-cluster/state/mapstate"
@@ -39,8 +41,28 @@ func upgrade() error {
 	return raft.SnapshotSave(cfgs.consensusCfg, newState, raftPeers)
 }
 
-func export(w io.Writer) error {
-	stateToExport, _, err := restoreStateFromDisk()
+// export writes the state saved by the given consensus component ("raft"
+// or "crdt"), or by the configured one when empty.
+func export(w io.Writer, consensus string) error {
+	cfgMgr, cfgs := makeConfigs()
+
+	err := cfgMgr.LoadJSONFromFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	consensus, err = stateBackend(consensus, cfgs.clusterCfg)
+	if err != nil {
+		return err
+	}
+
+	var stateToExport *mapstate.MapState
+	switch consensus {
+	case ipfscluster.ConsensusCRDT:
+		stateToExport, err = restoreCRDTStateFromDisk(cfgs.crdtCfg)
+	default:
+		stateToExport, _, err = restoreStateFromDisk()
+	}
 	if err != nil {
 		return err
 	}
@@ -48,6 +70,30 @@ func export(w io.Writer) error {
 	return exportState(stateToExport, w)
 }
 
+// stateBackend returns the given consensus component or, when empty, the
+// one set in the configuration.
+func stateBackend(consensus string, cfg *ipfscluster.Config) (string, error) {
+	switch consensus {
+	case "":
+		return cfg.Consensus, nil
+	case ipfscluster.ConsensusRaft, ipfscluster.ConsensusCRDT:
+		return consensus, nil
+	default:
+		return "", fmt.Errorf("unknown consensus component: %s", consensus)
+	}
+}
+
+// restoreCRDTStateFromDisk returns a mapstate with the updates saved by
+// the CRDT consensus component.
+func restoreCRDTStateFromDisk(cfg *crdt.Config) (*mapstate.MapState, error) {
+	st := mapstate.NewMapState()
+	exists, err := crdt.LastState(cfg, st)
+	if err == nil && !exists {
+		err = errNoSnapshot
+	}
+	return st, err
+}
+
 // restoreStateFromDisk returns a mapstate containing the latest
 // snapshot, a flag set to true when the state format has the
 // current version and an error
@@ -91,7 +137,10 @@ func restoreStateFromDisk() (*mapstate.MapState, bool, error) {
 	return stateFromSnap, false, nil
 }
 
-func stateImport(r io.Reader) error {
+// stateImport saves the state read from r so that it is loaded by the
+// given consensus component ("raft" or "crdt"), or by the configured one
+// when empty, when the peer starts.
+func stateImport(r io.Reader, consensus string) error {
 	cfgMgr, cfgs := makeConfigs()
 
 	err := cfgMgr.LoadJSONFromFile(configPath)
@@ -99,6 +148,11 @@ func stateImport(r io.Reader) error {
 		return err
 	}
 
+	consensus, err = stateBackend(consensus, cfgs.clusterCfg)
+	if err != nil {
+		return err
+	}
+
 	pinSerials := make([]api.PinSerial, 0)
 	dec := json.NewDecoder(r)
 	err = dec.Decode(&pinSerials)
@@ -114,6 +168,10 @@ func stateImport(r io.Reader) error {
 		}
 	}
 
+	if consensus == ipfscluster.ConsensusCRDT {
+		return crdt.StateSave(cfgs.crdtCfg, stateToImport, cfgs.clusterCfg.ID)
+	}
+
 	pm := pstoremgr.New(nil, cfgs.clusterCfg.GetPeerstorePath())
 	raftPeers := append(ipfscluster.PeersFromMultiaddrs(pm.LoadPeerstore()), cfgs.clusterCfg.ID)
 	return raft.SnapshotSave(cfgs.consensusCfg, stateToImport, raftPeers)
@@ -10,6 +10,9 @@ package ipfscluster
 
 import (
 	"context"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
@@ -23,6 +26,21 @@ import (
 // RPCProtocol is used to send libp2p messages between cluster peers
 var RPCProtocol = protocol.ID("/ipfscluster/" + Version + "/rpc")
 
+// NamespacedProtocol returns the given protocol ID with the namespace
+// inserted after the "/ipfscluster" prefix, i.e.
+// "/ipfscluster/<namespace>/<version>/rpc". The protocol ID is returned
+// untouched when the namespace is empty.
+func NamespacedProtocol(namespace string, pid protocol.ID) protocol.ID {
+	if namespace == "" {
+		return pid
+	}
+	const prefix = "/ipfscluster/"
+	if strings.HasPrefix(string(pid), prefix) {
+		return protocol.ID(prefix + namespace + "/" + strings.TrimPrefix(string(pid), prefix))
+	}
+	return protocol.ID("/" + namespace + string(pid))
+}
+
 // Component represents a piece of ipfscluster. Cluster components
 // usually run their own goroutines (a http server for example). They
 // communicate with the main Cluster component and other components
@@ -46,6 +64,10 @@ type Consensus interface {
 	LogPin(c api.Pin) error
 	// Logs an unpin operation
 	LogUnpin(c api.Pin) error
+	// Logs an operation storing a KV record
+	LogSetKV(kv api.KV) error
+	// Logs an operation removing a KV record
+	LogRmKV(key string) error
 	AddPeer(p peer.ID) error
 	RmPeer(p peer.ID) error
 	State() (state.State, error)
@@ -61,6 +83,65 @@ type Consensus interface {
 	Peers() ([]peer.ID, error)
 }
 
+// MultiMetricAllocator is an optional interface for PinAllocators which
+// sort the candidates using several metrics. When implemented,
+// AllocateWithMetrics is used instead of Allocate. The metrics map
+// contains the last valid metrics of every name returned by
+// MetricNames, indexed by peer.
+type MultiMetricAllocator interface {
+	MetricNames() []string
+	AllocateWithMetrics(c *cid.Cid, current, candidates, priority map[peer.ID]api.Metric, metrics map[string]map[peer.ID]api.Metric) ([]peer.ID, error)
+}
+
+// NonVoterConsensus is an optional interface for Consensus components
+// which can add peers which follow the consensus without voting (see
+// RoleFollower).
+type NonVoterConsensus interface {
+	// AddNonVoter adds a peer which receives the shared state but
+	// does not vote and cannot become the leader.
+	AddNonVoter(p peer.ID) error
+}
+
+// StateNotifier is an optional interface for Consensus components
+// which notify the pins and unpins they apply to the shared state, so
+// that the PinTracker can react to them without scanning the state.
+type StateNotifier interface {
+	// Subscribe returns a channel on which the changes applied to
+	// the shared state are sent, in order.
+	Subscribe() <-chan api.StateChange
+	// MissedChanges tells whether some changes were not sent since
+	// the last call, in which case the PinTracker needs to be
+	// reconciled with the shared state.
+	MissedChanges() bool
+}
+
+// RaftReporter is an optional interface for Consensus components based
+// on Raft which report the health of Raft in the peer.
+type RaftReporter interface {
+	RaftHealth() api.RaftHealth
+}
+
+// TrustingConsensus is an optional interface for Consensus components
+// in which only some peers can modify the shared state. The RPC methods
+// which modify the shared state, or act on behalf of the peer, are not
+// served to the other peers.
+type TrustingConsensus interface {
+	IsTrusted(p peer.ID) bool
+}
+
+// BatchingConsensus is an optional interface for Consensus components
+// which can commit several operations in a single log entry. Batching is
+// only enabled once every cluster peer advertises batched commits.
+type BatchingConsensus interface {
+	SetBatching(enabled bool)
+}
+
+// PinQueueReporter is an optional interface for PinTrackers which queue
+// pin and unpin operations and can describe their queue.
+type PinQueueReporter interface {
+	PinQueue() api.PinQueue
+}
+
 // API is a component which offers an API for Cluster. This is
 // a base component.
 type API interface {
@@ -90,6 +171,75 @@ type IPFSConnector interface {
 	// RepoSize returns the current repository size as expressed
 	// by "repo stat".
 	RepoSize() (uint64, error)
+	// BandwidthStats returns the bandwidth usage of the daemon as
+	// expressed by "stats bw".
+	BandwidthStats() (api.IPFSBandwidth, error)
+}
+
+// RetrievalCounter is an optional interface for IPFSConnectors which
+// count how many times content is read through them.
+type RetrievalCounter interface {
+	// Retrievals returns the number of retrievals of every root Cid
+	// since the previous call.
+	Retrievals() map[string]uint64
+}
+
+// PinUpdater is an optional interface for IPFSConnectors which can pin a
+// Cid by updating the pin of another one, fetching only the differences
+// between both DAGs.
+type PinUpdater interface {
+	PinUpdate(ctx context.Context, from, to *cid.Cid) error
+}
+
+// ContentAdder is an optional interface for IPFSConnectors which can
+// import content in the IPFS daemon, which pins its roots recursively as
+// part of the import, so that they cannot be garbage-collected before
+// they are pinned in the cluster. The body is a
+// multipart/form-data body, as accepted by "ipfs add", of the given
+// content type. The imported items are returned in the order given by
+// IPFS, which lists directories after their contents.
+type ContentAdder interface {
+	Add(ctx context.Context, params api.AddParams, contentType string, body io.Reader) ([]api.AddedOutput, error)
+}
+
+// CARTransferer is an optional interface for IPFSConnectors which can
+// import the blocks of a CAR file in the IPFS daemon, pinning its roots
+// recursively as part of the import when pinRoots is set, and export a
+// DAG as a CAR file.
+type CARTransferer interface {
+	DAGImport(ctx context.Context, car io.Reader, pinRoots bool) error
+	DAGExport(ctx context.Context, c *cid.Cid, w io.Writer) error
+}
+
+// GarbageCollector is an optional interface for IPFSConnectors which can
+// trigger the garbage collection of the IPFS repository.
+type GarbageCollector interface {
+	RepoGC(ctx context.Context) error
+}
+
+// DAGSizer is an optional interface for IPFSConnectors which can tell
+// the size of a DAG without fetching it entirely.
+type DAGSizer interface {
+	DAGSize(ctx context.Context, c *cid.Cid) (uint64, error)
+}
+
+// DAGLinker is an optional interface for IPFSConnectors which can store
+// new DAG nodes linking to given DAGs: nodes made of a list of links and
+// UnixFS file and directory nodes. The latter are pinned directly, so
+// that they cannot be garbage-collected before they are pinned in the
+// cluster. Along with ContentAdder and DAGSizer, it allows to shard
+// added content.
+type DAGLinker interface {
+	PutLinks(ctx context.Context, links []*cid.Cid) (*cid.Cid, error)
+	PutUnixFS(ctx context.Context, node api.UnixFSNode) (*cid.Cid, error)
+}
+
+// DepthPinner is an optional interface for IPFSConnectors which can pin
+// a DAG up to a given depth and unpin it, for pins with a MaxDepth.
+// UnpinDepth must leave pinned the nodes needed by the keep pins.
+type DepthPinner interface {
+	PinDepth(ctx context.Context, c *cid.Cid, maxDepth int) error
+	UnpinDepth(ctx context.Context, c *cid.Cid, maxDepth int, keep []api.Pin) error
 }
 
 // Peered represents a component which needs to be aware of the peers
@@ -127,6 +277,52 @@ type PinTracker interface {
 	Recover(*cid.Cid) (api.PinInfo, error)
 }
 
+// PinLimiter is an optional interface for PinTrackers which limit the
+// number of items that can be pinned by the peer. When implemented,
+// Cluster regularly broadcasts the remaining capacity so that full peers
+// are not allocated new content.
+type PinLimiter interface {
+	// Capacity returns how many more items can be pinned, or -1
+	// when there is no limit.
+	Capacity() int
+}
+
+// PinHistorian is an optional interface for PinTrackers which keep a
+// bounded history of the pin and unpin attempts made on each item.
+type PinHistorian interface {
+	// History returns the last attempts made on a Cid, oldest first.
+	History(*cid.Cid) []api.PinAttempt
+}
+
+// StatusNotifier is an optional interface for PinTrackers which report
+// the changes of the local status of the items, so that they can be
+// delivered to webhooks.
+type StatusNotifier interface {
+	// StatusChanges returns a channel on which the new status of the
+	// items is sent whenever it changes. Changes may be dropped when
+	// they are not received fast enough.
+	StatusChanges() <-chan api.PinInfo
+}
+
+// Tagger is an optional interface for Informers which provide the labels
+// of the peer (i.e. region, zone or rack). The tags of all the informers
+// implementing it are included in the peer's ID.
+type Tagger interface {
+	// Tags returns the labels of the peer.
+	Tags() map[string]string
+}
+
+// MultiInformer is an optional interface for Informers which produce
+// several metrics. When implemented, GetMetrics is used instead of
+// GetMetric to obtain the metrics to broadcast, and Name is the name of
+// the metric used for allocations.
+type MultiInformer interface {
+	// MetricNames returns the names of all the metrics produced.
+	MetricNames() []string
+	// GetMetrics returns all the metrics produced.
+	GetMetrics() []api.Metric
+}
+
 // Informer provides Metric information from a peer. The metrics produced by
 // informers are then passed to a PinAllocator which will use them to
 // determine where to pin content. The metric is agnostic to the rest of
@@ -152,6 +348,14 @@ type PinAllocator interface {
 	Allocate(c *cid.Cid, current, candidates, priority map[peer.ID]api.Metric) ([]peer.ID, error)
 }
 
+// TagAllocator is an optional interface for PinAllocators which sort
+// the candidates using the tags of the peers (see Tagger). When
+// implemented, AllocateWithTags is used instead of Allocate. The tags
+// map contains the last tags broadcasted by every peer.
+type TagAllocator interface {
+	AllocateWithTags(c *cid.Cid, current, candidates, priority map[peer.ID]api.Metric, tags map[peer.ID]map[string]string) ([]peer.ID, error)
+}
+
 // PeerMonitor is a component in charge of monitoring the peers in the cluster
 // and providing candidates to the PinAllocator when a pin request arrives.
 type PeerMonitor interface {
@@ -162,6 +366,26 @@ type PeerMonitor interface {
 	// LastMetrics returns a map with the latest metrics of matching name
 	// for the current cluster peers.
 	LastMetrics(name string) []api.Metric
+	// MetricsSince returns the metrics of the given name received from
+	// a peer after the given time, ordered from oldest to newest.
+	MetricsSince(name string, p peer.ID, since time.Time) []api.Metric
+	// LatestMetrics returns the latest metric of matching name from
+	// every peer, even if it is invalid or expired.
+	LatestMetrics(name string) []api.Metric
+	// PeerMetrics returns the latest valid metrics of every type
+	// received from the given peer.
+	PeerMetrics(p peer.ID) []api.Metric
+	// FailPeer makes the monitor consider a peer as failed during the
+	// given time, regardless of its metrics. It is used to rehearse
+	// failure handling.
+	FailPeer(p peer.ID, d time.Duration)
+	// Unquarantine accepts again the metrics from a peer which was
+	// quarantined after sending persistently invalid metrics.
+	Unquarantine(p peer.ID)
+	// RaiseAlert delivers an alert produced outside of the monitor,
+	// subject to the same thresholds and suppression as the alerts
+	// produced by the monitor itself.
+	RaiseAlert(alrt api.Alert)
 	// Alerts delivers alerts generated when this peer monitor detects
 	// a problem (i.e. metrics not arriving as expected). Alerts are used to
 	// trigger rebalancing operations.
@@ -80,6 +80,15 @@ func randomBytes() []byte {
 }
 
 func createComponents(t *testing.T, i int, clusterSecret []byte, staging bool) (host.Host, *Config, *raft.Consensus, API, IPFSConnector, state.State, PinTracker, PeerMonitor, PinAllocator, Informer, *test.IpfsMock) {
+	newHost := func(cfg *Config) (host.Host, error) {
+		return NewClusterHost(context.Background(), cfg)
+	}
+	return createComponentsWithHost(t, i, clusterSecret, staging, newHost)
+}
+
+// createComponentsWithHost is like createComponents but lets the caller
+// create the libp2p host (i.e. on a mock network).
+func createComponentsWithHost(t *testing.T, i int, clusterSecret []byte, staging bool, newHost func(*Config) (host.Host, error)) (host.Host, *Config, *raft.Consensus, API, IPFSConnector, state.State, PinTracker, PeerMonitor, PinAllocator, Informer, *test.IpfsMock) {
 	mock := test.NewIpfsMock()
 	//
 	//clusterAddr, _ := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", clusterPort+i))
@@ -110,7 +119,7 @@ func createComponents(t *testing.T, i int, clusterSecret []byte, staging bool) (
 
 	ReadyTimeout = consensusCfg.WaitForLeaderTimeout + 1*time.Second
 
-	host, err := NewClusterHost(context.Background(), clusterCfg)
+	host, err := newHost(clusterCfg)
 	checkErr(t, err)
 
 	apiCfg.HTTPListenAddr = apiAddr
@@ -136,7 +145,7 @@ func createComponents(t *testing.T, i int, clusterSecret []byte, staging bool) (
 }
 
 func createCluster(t *testing.T, host host.Host, clusterCfg *Config, raftCons *raft.Consensus, api API, ipfs IPFSConnector, state state.State, tracker PinTracker, mon PeerMonitor, alloc PinAllocator, inf Informer) *Cluster {
-	cl, err := NewCluster(host, clusterCfg, raftCons, api, ipfs, state, tracker, mon, alloc, inf)
+	cl, err := NewCluster(host, clusterCfg, raftCons, []API{api}, ipfs, state, tracker, mon, alloc, []Informer{inf})
 	checkErr(t, err)
 	return cl
 }
@@ -454,6 +463,18 @@ func TestClustersStatusAll(t *testing.T) {
 			t.Error("the hash should have been pinned")
 		}
 
+		if info[c.host.ID()].Peername != c.config.Peername {
+			t.Error("the status should include the peer name")
+		}
+
+		batch, err := c.StatusCids([]*cid.Cid{h})
+		if err != nil {
+			t.Error(err)
+		}
+		if len(batch) != 1 || batch[0].PeerMap[c.host.ID()].Status != api.TrackerStatusPinned {
+			t.Error("batch status should report the hash as pinned")
+		}
+
 		status, err := c.Status(h)
 		if err != nil {
 			t.Error(err)
@@ -843,6 +864,10 @@ func TestClustersReplication(t *testing.T) {
 				numLocal++
 			} else if v.Status == api.TrackerStatusRemote {
 				numRemote++
+				if len(v.Allocations) != nClusters-1 {
+					t.Errorf("remote status should list the %d holders: %s",
+						nClusters-1, v.Allocations)
+				}
 			}
 		}
 		if numLocal != nClusters-1 {
@@ -1083,6 +1108,21 @@ func TestClustersReplicationFactorMin(t *testing.T) {
 	if !strings.Contains(err.Error(), fmt.Sprintf("not enough peers to allocate CID")) {
 		t.Fatal(err)
 	}
+
+	aerr, ok := api.ParseAllocationError(err.Error())
+	if !ok {
+		t.Fatal("expected an allocation error")
+	}
+	if len(aerr.Candidates) != nClusters {
+		t.Fatalf("expected %d candidates, got %d", nClusters, len(aerr.Candidates))
+	}
+	for _, c := range clusters[nClusters-2:] {
+		for _, cand := range aerr.Candidates {
+			if cand.Peer == peer.IDB58Encode(c.id) && (cand.Usable || cand.Reason == "") {
+				t.Errorf("%s should be unusable with a reason", cand.Peer)
+			}
+		}
+	}
 }
 
 // This tests checks that repinning something that has becomed
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/config"
 
 	ma "github.com/multiformats/go-multiaddr"
@@ -17,6 +18,8 @@ const configKey = "ipfshttp"
 const (
 	DefaultProxyAddr              = "/ip4/127.0.0.1/tcp/9095"
 	DefaultNodeAddr               = "/ip4/127.0.0.1/tcp/5001"
+	DefaultProxyAddrIPv6          = "/ip6/::1/tcp/9095"
+	DefaultNodeAddrIPv6           = "/ip6/::1/tcp/5001"
 	DefaultConnectSwarmsDelay     = 30 * time.Second
 	DefaultProxyReadTimeout       = 10 * time.Minute
 	DefaultProxyReadHeaderTimeout = 5 * time.Second
@@ -26,6 +29,7 @@ const (
 	DefaultIPFSRequestTimeout     = 5 * time.Minute
 	DefaultPinTimeout             = 24 * time.Hour
 	DefaultUnpinTimeout           = 3 * time.Hour
+	DefaultProxyPinLsClusterOnly  = false
 )
 
 // Config is used to initialize a Connector and allows to customize
@@ -70,6 +74,12 @@ type Config struct {
 
 	// Unpin Operation timeout
 	UnpinTimeout time.Duration
+
+	// When set, "pin/ls" requests to the proxy only list the items
+	// pinned in the cluster, rather than these and the items pinned
+	// by the IPFS daemon. Requests can override it with the
+	// "cluster-only" argument.
+	ProxyPinLsClusterOnly bool
 }
 
 type jsonConfig struct {
@@ -84,6 +94,7 @@ type jsonConfig struct {
 	IPFSRequestTimeout      string `json:"ipfs_request_timeout"`
 	PinTimeout              string `json:"pin_timeout"`
 	UnpinTimeout            string `json:"unpin_timeout"`
+	ProxyPinLsClusterOnly   bool   `json:"proxy_pin_ls_cluster_only"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -93,8 +104,8 @@ func (cfg *Config) ConfigKey() string {
 
 // Default sets the fields of this Config to sensible default values.
 func (cfg *Config) Default() error {
-	proxy, _ := ma.NewMultiaddr(DefaultProxyAddr)
-	node, _ := ma.NewMultiaddr(DefaultNodeAddr)
+	proxy, _ := ma.NewMultiaddr(api.PreferredAddr(DefaultProxyAddr, DefaultProxyAddrIPv6))
+	node, _ := ma.NewMultiaddr(api.PreferredAddr(DefaultNodeAddr, DefaultNodeAddrIPv6))
 	cfg.ProxyAddr = proxy
 	cfg.NodeAddr = node
 	cfg.ConnectSwarmsDelay = DefaultConnectSwarmsDelay
@@ -106,6 +117,7 @@ func (cfg *Config) Default() error {
 	cfg.IPFSRequestTimeout = DefaultIPFSRequestTimeout
 	cfg.PinTimeout = DefaultPinTimeout
 	cfg.UnpinTimeout = DefaultUnpinTimeout
+	cfg.ProxyPinLsClusterOnly = DefaultProxyPinLsClusterOnly
 
 	return nil
 }
@@ -201,6 +213,7 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 	}
 
 	config.SetIfNotDefault(jcfg.PinMethod, &cfg.PinMethod)
+	cfg.ProxyPinLsClusterOnly = jcfg.ProxyPinLsClusterOnly
 
 	return cfg.Validate()
 }
@@ -228,6 +241,7 @@ func (cfg *Config) ToJSON() (raw []byte, err error) {
 	jcfg.IPFSRequestTimeout = cfg.IPFSRequestTimeout.String()
 	jcfg.PinTimeout = cfg.PinTimeout.String()
 	jcfg.UnpinTimeout = cfg.UnpinTimeout.String()
+	jcfg.ProxyPinLsClusterOnly = cfg.ProxyPinLsClusterOnly
 
 	raw, err = config.DefaultJSONMarshal(jcfg)
 	return
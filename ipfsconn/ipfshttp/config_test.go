@@ -17,7 +17,8 @@ var cfgJSON = []byte(`
       "pin_method": "pin",
       "ipfs_request_timeout": "5m0s",
       "pin_timeout": "24h",
-      "unpin_timeout": "3h"
+      "unpin_timeout": "3h",
+      "proxy_pin_ls_cluster_only": true
 }
 `)
 
@@ -27,6 +28,9 @@ func TestLoadJSON(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if !cfg.ProxyPinLsClusterOnly {
+		t.Error("expected proxy_pin_ls_cluster_only to be set")
+	}
 
 	j := &jsonConfig{}
 	json.Unmarshal(cfgJSON, j)
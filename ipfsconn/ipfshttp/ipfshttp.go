@@ -5,15 +5,19 @@ package ipfshttp
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -51,13 +55,22 @@ type Connector struct {
 	rpcClient *rpc.Client
 	rpcReady  chan struct{}
 
-	listener net.Listener // proxy listener
-	server   *http.Server // proxy server
-	client   *http.Client // client to ipfs daemon
+	// listenerMux protects the listener, which may be replaced
+	// by SetProxyAddr().
+	listenerMux  sync.Mutex
+	listener     net.Listener // proxy listener
+	proxyServing bool
+	server       *http.Server // proxy server
+	client       *http.Client // client to ipfs daemon
 
 	shutdownLock sync.Mutex
 	shutdown     bool
 	wg           sync.WaitGroup
+
+	// retrievals counts the content read through the proxy,
+	// by root Cid, since the last call to Retrievals().
+	retrievalsMux sync.Mutex
+	retrievals    map[string]uint64
 }
 
 type ipfsError struct {
@@ -87,6 +100,49 @@ type ipfsRepoStatResp struct {
 	NumObjects uint64
 }
 
+type ipfsObjectStatResp struct {
+	Hash           string
+	CumulativeSize uint64
+}
+
+type ipfsBlockStatResp struct {
+	Key  string
+	Size uint64
+}
+
+type ipfsBandwidthResp struct {
+	TotalIn  uint64
+	TotalOut uint64
+	RateIn   float64
+	RateOut  float64
+}
+
+type ipfsRefsResp struct {
+	Ref string
+	Err string
+}
+
+type ipfsDagPutResp struct {
+	Cid struct {
+		Target string `json:"/"`
+	}
+}
+
+type ipfsObject struct {
+	Data  string
+	Links []ipfsObjectLink
+}
+
+type ipfsObjectLink struct {
+	Name string
+	Hash string
+	Size uint64
+}
+
+type ipfsObjectPutResp struct {
+	Hash string
+}
+
 type ipfsAddResp struct {
 	Name  string
 	Hash  string
@@ -144,15 +200,16 @@ func NewConnector(cfg *Config) (*Connector, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	ipfs := &Connector{
-		ctx:      ctx,
-		config:   cfg,
-		cancel:   cancel,
-		nodeAddr: nodeAddr,
-		handlers: make(map[string]func(http.ResponseWriter, *http.Request)),
-		rpcReady: make(chan struct{}, 1),
-		listener: l,
-		server:   s,
-		client:   c,
+		ctx:        ctx,
+		config:     cfg,
+		cancel:     cancel,
+		nodeAddr:   nodeAddr,
+		handlers:   make(map[string]func(http.ResponseWriter, *http.Request)),
+		rpcReady:   make(chan struct{}, 1),
+		listener:   l,
+		server:     s,
+		client:     c,
+		retrievals: make(map[string]uint64),
 	}
 
 	smux.HandleFunc("/", ipfs.defaultHandler)
@@ -164,6 +221,10 @@ func NewConnector(cfg *Config) (*Connector, error) {
 	smux.HandleFunc("/api/v0/pin/ls/", ipfs.pinLsHandler)
 	smux.HandleFunc("/api/v0/add", ipfs.addHandler)
 	smux.HandleFunc("/api/v0/add/", ipfs.addHandler)
+	for _, path := range readPaths {
+		smux.HandleFunc(path, ipfs.readHandler)
+		smux.HandleFunc(path+"/", ipfs.readHandler)
+	}
 
 	go ipfs.run()
 	return ipfs, nil
@@ -180,19 +241,16 @@ func (ipfs *Connector) run() {
 	defer ipfs.shutdownLock.Unlock()
 
 	// This launches the proxy
+	ipfs.listenerMux.Lock()
+	logger.Infof(
+		"IPFS Proxy: %s -> %s",
+		ipfs.config.ProxyAddr,
+		ipfs.config.NodeAddr,
+	)
 	ipfs.wg.Add(1)
-	go func() {
-		defer ipfs.wg.Done()
-		logger.Infof(
-			"IPFS Proxy: %s -> %s",
-			ipfs.config.ProxyAddr,
-			ipfs.config.NodeAddr,
-		)
-		err := ipfs.server.Serve(ipfs.listener) // hangs here
-		if err != nil && !strings.Contains(err.Error(), "closed network connection") {
-			logger.Error(err)
-		}
-	}()
+	go ipfs.serveProxy(ipfs.listener)
+	ipfs.proxyServing = true
+	ipfs.listenerMux.Unlock()
 
 	// This runs ipfs swarm connect to the daemons of other cluster members
 	ipfs.wg.Add(1)
@@ -267,6 +325,39 @@ func (ipfs *Connector) defaultHandler(w http.ResponseWriter, r *http.Request) {
 	res.Body.Close()
 }
 
+// readPaths are the IPFS API endpoints which read content. Requests to
+// them are counted by Retrievals().
+var readPaths = []string{
+	"/api/v0/cat",
+	"/api/v0/get",
+	"/api/v0/block/get",
+	"/api/v0/dag/get",
+}
+
+// readHandler counts a retrieval of the requested content and proxies
+// the request.
+func (ipfs *Connector) readHandler(w http.ResponseWriter, r *http.Request) {
+	if arg, ok := extractArgument(r.URL); ok {
+		if c, ok := rootCid(arg); ok {
+			ipfs.retrievalsMux.Lock()
+			ipfs.retrievals[c]++
+			ipfs.retrievalsMux.Unlock()
+		}
+	}
+	ipfs.defaultHandler(w, r)
+}
+
+// rootCid returns the Cid at the root of an IPFS path, which may be given
+// with or without the /ipfs/ prefix.
+func rootCid(path string) (string, bool) {
+	path = strings.TrimPrefix(path, "/ipfs/")
+	c, err := cid.Decode(strings.Split(path, "/")[0])
+	if err != nil {
+		return "", false
+	}
+	return c.String(), true
+}
+
 func ipfsErrorResponder(w http.ResponseWriter, errMsg string) {
 	res := ipfsError{errMsg}
 	resBytes, _ := json.Marshal(res)
@@ -276,6 +367,12 @@ func ipfsErrorResponder(w http.ResponseWriter, errMsg string) {
 	return
 }
 
+// proxyContext returns the context for the RPC calls made when proxying
+// a request. It carries the origin of the request.
+func proxyContext(r *http.Request) context.Context {
+	return api.ContextWithOrigin(context.Background(), api.ProxyOrigin(r.RemoteAddr))
+}
+
 func (ipfs *Connector) pinOpHandler(op string, w http.ResponseWriter, r *http.Request) {
 	arg, ok := extractArgument(r.URL)
 	if !ok {
@@ -288,7 +385,8 @@ func (ipfs *Connector) pinOpHandler(op string, w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err = ipfs.rpcClient.Call(
+	err = ipfs.rpcClient.CallContext(
+		proxyContext(r),
 		"",
 		"Cluster",
 		op,
@@ -320,10 +418,25 @@ func (ipfs *Connector) unpinHandler(w http.ResponseWriter, r *http.Request) {
 	ipfs.pinOpHandler("Unpin", w, r)
 }
 
+// pinLsHandler lists the items pinned in the cluster together with the
+// items pinned by the IPFS daemon, unless the "cluster-only" query
+// argument, or ProxyPinLsClusterOnly when it is not given, is set.
+// Items pinned in the cluster are always listed as recursive.
 func (ipfs *Connector) pinLsHandler(w http.ResponseWriter, r *http.Request) {
 	pinLs := ipfsPinLsResp{}
 	pinLs.Keys = make(map[string]ipfsPinType)
 
+	q := r.URL.Query()
+	typeFilter := q.Get("type")
+	clusterOnly := ipfs.config.ProxyPinLsClusterOnly
+	if v := q.Get("cluster-only"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			ipfsErrorResponder(w, "invalid cluster-only argument: "+err.Error())
+			return
+		}
+		clusterOnly = b
+	}
 	arg, ok := extractArgument(r.URL)
 	if ok {
 		c, err := cid.Decode(arg)
@@ -331,6 +444,9 @@ func (ipfs *Connector) pinLsHandler(w http.ResponseWriter, r *http.Request) {
 			ipfsErrorResponder(w, err.Error())
 			return
 		}
+		if !clusterOnly {
+			pinLs.Keys = ipfs.localPinLs(arg, typeFilter)
+		}
 		var pin api.PinSerial
 		err = ipfs.rpcClient.Call(
 			"",
@@ -339,14 +455,19 @@ func (ipfs *Connector) pinLsHandler(w http.ResponseWriter, r *http.Request) {
 			api.PinCid(c).ToSerial(),
 			&pin,
 		)
-		if err != nil {
+		if err == nil && matchesPinType(pin, typeFilter) {
+			pinLs.Keys[pin.Cid] = ipfsPinType{
+				Type: clusterPinType(pin),
+			}
+		}
+		if len(pinLs.Keys) == 0 {
 			ipfsErrorResponder(w, fmt.Sprintf("Error: path '%s' is not pinned", arg))
 			return
 		}
-		pinLs.Keys[pin.Cid] = ipfsPinType{
-			Type: "recursive",
-		}
 	} else {
+		if !clusterOnly {
+			pinLs.Keys = ipfs.localPinLs("", typeFilter)
+		}
 		var pins []api.PinSerial
 		err := ipfs.rpcClient.Call(
 			"",
@@ -361,8 +482,10 @@ func (ipfs *Connector) pinLsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		for _, pin := range pins {
-			pinLs.Keys[pin.Cid] = ipfsPinType{
-				Type: "recursive",
+			if matchesPinType(pin, typeFilter) {
+				pinLs.Keys[pin.Cid] = ipfsPinType{
+					Type: clusterPinType(pin),
+				}
 			}
 		}
 	}
@@ -373,6 +496,58 @@ func (ipfs *Connector) pinLsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(resBytes)
 }
 
+// clusterPinType returns the type of a cluster pin as reported by the
+// IPFS daemon: depth-limited pins are made of direct pins.
+func clusterPinType(pin api.PinSerial) string {
+	if pin.Recursive && pin.MaxDepth <= 0 {
+		return "recursive"
+	}
+	return "direct"
+}
+
+// matchesPinType tells whether a cluster pin must be listed by a pin/ls
+// request with the given type filter. Cluster pins are never indirect.
+func matchesPinType(pin api.PinSerial, typeFilter string) bool {
+	switch typeFilter {
+	case "", "all":
+		return true
+	default:
+		return clusterPinType(pin) == typeFilter
+	}
+}
+
+// localPinLs returns the items pinned by the IPFS daemon, optionally
+// only the given one, with the given type. Errors, including the item
+// not being pinned, result in an empty list.
+func (ipfs *Connector) localPinLs(arg, typeFilter string) map[string]ipfsPinType {
+	keys := make(map[string]ipfsPinType)
+
+	q := url.Values{}
+	if arg != "" {
+		q.Set("arg", arg)
+	}
+	if typeFilter != "" {
+		q.Set("type", typeFilter)
+	}
+	body, err := ipfs.post("pin/ls?" + q.Encode())
+	if err != nil {
+		if arg == "" {
+			logger.Warningf("proxy pin/ls: cannot list the pins of the IPFS daemon: %s", err)
+		}
+		return keys
+	}
+
+	var res ipfsPinLsResp
+	if err := json.Unmarshal(body, &res); err != nil {
+		logger.Error("parsing pin/ls response")
+		return keys
+	}
+	for k, v := range res.Keys {
+		keys[k] = v
+	}
+	return keys
+}
+
 func (ipfs *Connector) addHandler(w http.ResponseWriter, r *http.Request) {
 	// Handle some request options
 	q := r.URL.Query()
@@ -450,7 +625,8 @@ func (ipfs *Connector) addHandler(w http.ResponseWriter, r *http.Request) {
 
 	logger.Debugf("proxy /add request and will pin %s", pinHashes)
 	for _, pin := range pinHashes {
-		err := ipfs.rpcClient.Call(
+		err := ipfs.rpcClient.CallContext(
+			proxyContext(r),
 			"",
 			"Cluster",
 			"Pin",
@@ -535,6 +711,17 @@ func decideRecursivePins(added []ipfsAddResp, q url.Values) []string {
 	return toPin
 }
 
+// Retrievals returns how many times the content under every root Cid
+// was read through the proxy (with cat, get, block/get or dag/get) since
+// the previous call.
+func (ipfs *Connector) Retrievals() map[string]uint64 {
+	ipfs.retrievalsMux.Lock()
+	defer ipfs.retrievalsMux.Unlock()
+	res := ipfs.retrievals
+	ipfs.retrievals = make(map[string]uint64)
+	return res
+}
+
 // SetClient makes the component ready to perform RPC
 // requests.
 func (ipfs *Connector) SetClient(c *rpc.Client) {
@@ -542,6 +729,53 @@ func (ipfs *Connector) SetClient(c *rpc.Client) {
 	ipfs.rpcReady <- struct{}{}
 }
 
+// serveProxy serves proxy requests on the given listener until it is closed.
+func (ipfs *Connector) serveProxy(l net.Listener) {
+	defer ipfs.wg.Done()
+	err := ipfs.server.Serve(l) // hangs here
+	if err != nil && !strings.Contains(err.Error(), "closed network connection") {
+		logger.Error(err)
+	}
+}
+
+// SetProxyAddr moves the IPFS proxy to a new address without dropping
+// requests: the new address is bound and served before the old listener
+// is closed, and connections already accepted on the old listener are
+// served until they finish.
+func (ipfs *Connector) SetProxyAddr(addr ma.Multiaddr) error {
+	ipfs.listenerMux.Lock()
+	defer ipfs.listenerMux.Unlock()
+
+	if ipfs.ctx.Err() != nil {
+		return errors.New("the IPFS connector is shutting down")
+	}
+
+	if addr.Equal(ipfs.config.ProxyAddr) {
+		return nil
+	}
+
+	proxyNet, proxyAddr, err := manet.DialArgs(addr)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen(proxyNet, proxyAddr)
+	if err != nil {
+		return err
+	}
+
+	old := ipfs.listener
+	ipfs.listener = l
+	ipfs.config.ProxyAddr = addr
+	if ipfs.proxyServing {
+		ipfs.wg.Add(1)
+		go ipfs.serveProxy(l)
+	}
+	old.Close()
+	logger.Infof("IPFS Proxy moved from %s to %s", old.Addr(), l.Addr())
+	return nil
+}
+
 // Shutdown stops any listeners and stops the component from taking
 // any requests.
 func (ipfs *Connector) Shutdown() error {
@@ -558,7 +792,9 @@ func (ipfs *Connector) Shutdown() error {
 	ipfs.cancel()
 	close(ipfs.rpcReady)
 	ipfs.server.SetKeepAlivesEnabled(false)
+	ipfs.listenerMux.Lock()
 	ipfs.listener.Close()
+	ipfs.listenerMux.Unlock()
 
 	ipfs.wg.Wait()
 	ipfs.shutdown = true
@@ -636,6 +872,301 @@ func (ipfs *Connector) Pin(ctx context.Context, hash *cid.Cid, recursive bool) e
 	return nil
 }
 
+// depthPinBatch is the number of Cids pinned or unpinned by each request
+// made by PinDepth and UnpinDepth.
+const depthPinBatch = 100
+
+// PinDepth pins a Cid and the DAG under it up to the given depth. IPFS
+// cannot pin part of a DAG, so the root and every node up to that depth
+// are pinned directly.
+func (ipfs *Connector) PinDepth(ctx context.Context, hash *cid.Cid, maxDepth int) error {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.PinTimeout)
+	defer cancel()
+	nodes, err := ipfs.depthNodes(ctx, hash, maxDepth)
+	if err != nil {
+		return err
+	}
+	err = ipfs.postBatches(ctx, "pin/add?recursive=false", nodes)
+	if err == nil {
+		logger.Infof("IPFS Pin request succeeded: %s (max depth %d)", hash, maxDepth)
+	}
+	return err
+}
+
+// UnpinDepth unpins what PinDepth pinned. Nodes which are not directly
+// pinned anymore are skipped. The other pins of the cluster which may
+// overlap are given in keep: their Cids, and the nodes under those which
+// are depth pins of this daemon, stay pinned.
+func (ipfs *Connector) UnpinDepth(ctx context.Context, hash *cid.Cid, maxDepth int, keep []api.Pin) error {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.UnpinTimeout)
+	defer cancel()
+	direct, err := ipfs.PinLs(ctx, "direct")
+	if err != nil {
+		return err
+	}
+	if _, ok := direct[hash.String()]; !ok {
+		logger.Debug("IPFS object is already unpinned: ", hash)
+		return nil
+	}
+	nodes, err := ipfs.depthNodes(ctx, hash, maxDepth)
+	if err != nil {
+		return err
+	}
+	candidates := make(map[string]*cid.Cid)
+	for _, n := range nodes {
+		if _, ok := direct[n.String()]; ok {
+			candidates[n.String()] = n
+		}
+	}
+	if err := ipfs.keepNodes(ctx, keep, direct, candidates); err != nil {
+		return err
+	}
+	pinned := make([]*cid.Cid, 0, len(candidates))
+	for _, n := range nodes {
+		if _, ok := candidates[n.String()]; ok {
+			pinned = append(pinned, n)
+		}
+	}
+	err = ipfs.postBatches(ctx, "pin/rm?recursive=false", pinned)
+	if err == nil {
+		logger.Infof("IPFS Unpin request succeeded: %s (max depth %d)", hash, maxDepth)
+	}
+	return err
+}
+
+// keepNodes removes from the candidates to unpin the Cids of the given
+// pins and the nodes under those which are depth pins of this daemon,
+// that is, whose root is directly pinned. The DAGs of the depth pins are
+// only listed while some candidates are left.
+func (ipfs *Connector) keepNodes(ctx context.Context, pins []api.Pin, direct map[string]api.IPFSPinStatus, candidates map[string]*cid.Cid) error {
+	var depthPins []api.Pin
+	for _, p := range pins {
+		if _, ok := candidates[p.Cid.String()]; ok {
+			logger.Debugf("%s is pinned by the cluster: keeping it pinned", p.Cid)
+			delete(candidates, p.Cid.String())
+		}
+		if !p.Recursive || p.MaxDepth <= 0 {
+			continue
+		}
+		if _, ok := direct[p.Cid.String()]; ok {
+			depthPins = append(depthPins, p)
+		}
+	}
+	for _, p := range depthPins {
+		if len(candidates) == 0 {
+			return nil
+		}
+		nodes, err := ipfs.depthNodes(ctx, p.Cid, p.MaxDepth)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			if _, ok := candidates[n.String()]; ok {
+				logger.Debugf("%s is needed by %s: keeping it pinned", n, p.Cid)
+				delete(candidates, n.String())
+			}
+		}
+	}
+	return nil
+}
+
+// depthNodes returns a Cid followed by the nodes of the DAG under it up
+// to the given depth, as listed by "refs".
+func (ipfs *Connector) depthNodes(ctx context.Context, hash *cid.Cid, maxDepth int) ([]*cid.Cid, error) {
+	path := fmt.Sprintf("refs?arg=%s&recursive=true&unique=true&max-depth=%d", hash, maxDepth)
+	res, err := ipfs.postCtx(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := parseRefs(res)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*cid.Cid{hash}
+	for _, r := range refs {
+		if !r.Equals(hash) {
+			nodes = append(nodes, r)
+		}
+	}
+	return nodes, nil
+}
+
+// postBatches makes a request to the given path for every batch of
+// depthPinBatch Cids, which are given as "arg" parameters.
+func (ipfs *Connector) postBatches(ctx context.Context, path string, cids []*cid.Cid) error {
+	for start := 0; start < len(cids); start += depthPinBatch {
+		end := start + depthPinBatch
+		if end > len(cids) {
+			end = len(cids)
+		}
+		batchPath := path
+		for _, c := range cids[start:end] {
+			batchPath += "&arg=" + c.String()
+		}
+		if _, err := ipfs.postCtx(ctx, batchPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PinUpdate pins the Cid "to" by updating the pin of the Cid "from"
+// in the configured IPFS daemon, which only fetches the blocks that
+// differ between both. The pin of "from" is kept.
+func (ipfs *Connector) PinUpdate(ctx context.Context, from, to *cid.Cid) error {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.PinTimeout)
+	defer cancel()
+	path := fmt.Sprintf("pin/update?arg=%s&arg=%s&unpin=false", from, to)
+	_, err := ipfs.postCtx(ctx, path)
+	if err == nil {
+		logger.Infof("IPFS Pin update request succeeded: %s -> %s", from, to)
+	}
+	return err
+}
+
+// Add imports the files in the given multipart body in the configured
+// IPFS daemon, which pins their roots, and returns the imported items.
+// Like pin requests, it is bound by the PinTimeout.
+func (ipfs *Connector) Add(ctx context.Context, params api.AddParams, contentType string, body io.Reader) ([]api.AddedOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.PinTimeout)
+	defer cancel()
+
+	q := url.Values{}
+	q.Set("pin", "true")
+	q.Set("progress", "false")
+	if params.Chunker != "" {
+		q.Set("chunker", params.Chunker)
+	}
+	if params.CidVersion > 0 {
+		q.Set("cid-version", strconv.Itoa(params.CidVersion))
+	}
+	if params.Hash != "" {
+		q.Set("hash", params.Hash)
+	}
+	if params.RawLeaves {
+		q.Set("raw-leaves", "true")
+	}
+	if params.WrapWithDirectory {
+		q.Set("wrap-with-directory", "true")
+	}
+
+	req, err := http.NewRequest("POST", ipfs.apiURL()+"/add?"+q.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	res, err := ipfs.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		return nil, checkResponse("add", res.StatusCode, resBody)
+	}
+
+	var added []api.AddedOutput
+	dec := json.NewDecoder(res.Body)
+	for dec.More() {
+		var addResp ipfsAddResp
+		if err := dec.Decode(&addResp); err != nil {
+			return nil, err
+		}
+		if addResp.Hash == "" {
+			continue // progress notification
+		}
+		added = append(added, api.AddedOutput{
+			Name: addResp.Name,
+			Cid:  addResp.Hash,
+		})
+	}
+	if len(added) == 0 {
+		return nil, errors.New("nothing was added")
+	}
+	logger.Infof("IPFS Add request succeeded: %d items", len(added))
+	return added, nil
+}
+
+// DAGImport imports the blocks of a CAR file in the configured IPFS
+// daemon, which pins its roots recursively when pinRoots is set. Like
+// Add, it is bound by the PinTimeout.
+func (ipfs *Connector) DAGImport(ctx context.Context, car io.Reader, pinRoots bool) error {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.PinTimeout)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		fw, err := mw.CreateFormFile("file", "import.car")
+		if err == nil {
+			_, err = io.Copy(fw, car)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	path := fmt.Sprintf("dag/import?pin-roots=%t", pinRoots)
+	req, err := http.NewRequest("POST", ipfs.apiURL()+"/"+path, pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	res, err := ipfs.client.Do(req.WithContext(ctx))
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(path, res.StatusCode, resBody); err != nil {
+		return err
+	}
+	if streamErr := res.Trailer.Get("X-Stream-Error"); streamErr != "" {
+		return fmt.Errorf("IPFS unsuccessful: %s", streamErr)
+	}
+	logger.Info("IPFS DAG import request succeeded")
+	return nil
+}
+
+// DAGExport writes the DAG under the given Cid as a CAR file, as
+// exported by the configured IPFS daemon. Like Add, it is bound by the
+// PinTimeout.
+func (ipfs *Connector) DAGExport(ctx context.Context, h *cid.Cid, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.PinTimeout)
+	defer cancel()
+
+	path := fmt.Sprintf("dag/export?arg=%s", h)
+	req, err := http.NewRequest("POST", ipfs.apiURL()+"/"+path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := ipfs.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		return checkResponse(path, res.StatusCode, resBody)
+	}
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return err
+	}
+	if streamErr := res.Trailer.Get("X-Stream-Error"); streamErr != "" {
+		return fmt.Errorf("IPFS unsuccessful: %s", streamErr)
+	}
+	return nil
+}
+
 // Unpin performs an unpin request against the configured IPFS
 // daemon.
 func (ipfs *Connector) Unpin(ctx context.Context, hash *cid.Cid) error {
@@ -905,6 +1436,220 @@ func (ipfs *Connector) RepoSize() (uint64, error) {
 	return stats.RepoSize, nil
 }
 
+// RepoGC runs the garbage collection of the IPFS repository and waits
+// until it finishes.
+func (ipfs *Connector) RepoGC(ctx context.Context) error {
+	err := ipfs.postDiscardBodyCtx(ctx, "repo/gc")
+	if err != nil {
+		logger.Error(err)
+	}
+	return err
+}
+
+// DAGSize returns the size of the DAG under the given Cid. For dag-pb
+// Cids, it is the cumulative size given by "object stat", which only
+// reads the root node. Otherwise it is the size of the block given by
+// "block stat".
+func (ipfs *Connector) DAGSize(ctx context.Context, h *cid.Cid) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+
+	if h.Type() == cid.DagProtobuf {
+		res, err := ipfs.postCtx(ctx, fmt.Sprintf("object/stat?arg=%s", h))
+		if err != nil {
+			return 0, err
+		}
+		var stat ipfsObjectStatResp
+		err = json.Unmarshal(res, &stat)
+		return stat.CumulativeSize, err
+	}
+
+	res, err := ipfs.postCtx(ctx, fmt.Sprintf("block/stat?arg=%s", h))
+	if err != nil {
+		return 0, err
+	}
+	var stat ipfsBlockStatResp
+	err = json.Unmarshal(res, &stat)
+	return stat.Size, err
+}
+
+// parseRefs decodes the Cids in a "refs" response.
+func parseRefs(res []byte) ([]*cid.Cid, error) {
+	var links []*cid.Cid
+	dec := json.NewDecoder(bytes.NewReader(res))
+	for dec.More() {
+		var ref ipfsRefsResp
+		if err := dec.Decode(&ref); err != nil {
+			return nil, err
+		}
+		if ref.Err != "" {
+			return nil, errors.New(ref.Err)
+		}
+		c, err := cid.Decode(ref.Ref)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, c)
+	}
+	return links, nil
+}
+
+// PutLinks stores, with "dag put", a dag-cbor node made of a list of
+// links to the given Cids and returns its Cid.
+func (ipfs *Connector) PutLinks(ctx context.Context, links []*cid.Cid) (*cid.Cid, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+
+	node := make([]map[string]string, len(links))
+	for i, l := range links {
+		node[i] = map[string]string{"/": l.String()}
+	}
+	nodeJSON, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ipfs.postNodeCtx(ctx, "dag/put?format=cbor&input-enc=json", nodeJSON)
+	if err != nil {
+		return nil, err
+	}
+	var putResp ipfsDagPutResp
+	if err := json.Unmarshal(res, &putResp); err != nil {
+		return nil, err
+	}
+	return cid.Decode(putResp.Cid.Target)
+}
+
+// PutUnixFS stores, with "object put", a UnixFS file or directory node
+// linking to the given DAGs, pins it directly and returns its Cid. Nodes
+// are stored as CIDv0 dag-pb nodes.
+func (ipfs *Connector) PutUnixFS(ctx context.Context, node api.UnixFSNode) (*cid.Cid, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+
+	obj := ipfsObject{
+		Data:  base64.StdEncoding.EncodeToString(unixfsData(node)),
+		Links: make([]ipfsObjectLink, 0, len(node.Links)),
+	}
+	for _, l := range node.Links {
+		obj.Links = append(obj.Links, ipfsObjectLink{
+			Name: l.Name,
+			Hash: l.Cid.String(),
+			Size: l.Size,
+		})
+	}
+	objJSON, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ipfs.postNodeCtx(ctx, "object/put?inputenc=json&datafieldenc=base64", objJSON)
+	if err != nil {
+		return nil, err
+	}
+	var putResp ipfsObjectPutResp
+	if err := json.Unmarshal(res, &putResp); err != nil {
+		return nil, err
+	}
+	c, err := cid.Decode(putResp.Hash)
+	if err != nil {
+		return nil, err
+	}
+	err = ipfs.postDiscardBodyCtx(ctx, fmt.Sprintf("pin/add?arg=%s&recursive=false", c))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UnixFS node types, as in the unixfs protobuf definition.
+const (
+	unixfsDirectory = 1
+	unixfsFile      = 2
+)
+
+// unixfsData encodes the protobuf Data of a UnixFS node: its type and,
+// for files, their size and the file size under every link.
+func unixfsData(node api.UnixFSNode) []byte {
+	var buf bytes.Buffer
+	varint := make([]byte, binary.MaxVarintLen64)
+	field := func(key byte, v uint64) {
+		buf.WriteByte(key)
+		buf.Write(varint[:binary.PutUvarint(varint, v)])
+	}
+
+	if node.Directory {
+		field(0x08, unixfsDirectory) // Type
+		return buf.Bytes()
+	}
+	var size uint64
+	for _, l := range node.Links {
+		size += l.FileSize
+	}
+	field(0x08, unixfsFile) // Type
+	field(0x18, size)       // filesize
+	for _, l := range node.Links {
+		field(0x20, l.FileSize) // blocksizes
+	}
+	return buf.Bytes()
+}
+
+// postNodeCtx posts a node, encoded as a file in a multipart body, to
+// the given path, and returns the response body.
+func (ipfs *Connector) postNodeCtx(ctx context.Context, path string, node []byte) ([]byte, error) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "node.json")
+	if err != nil {
+		return nil, err
+	}
+	fw.Write(node)
+	mw.Close()
+
+	req, err := http.NewRequest("POST", ipfs.apiURL()+"/"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	res, err := ipfs.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(path, res.StatusCode, resBody); err != nil {
+		return nil, err
+	}
+	return resBody, nil
+}
+
+// BandwidthStats returns the bandwidth totals and rates of the ipfs
+// daemon as provided by "stats bw".
+func (ipfs *Connector) BandwidthStats() (api.IPFSBandwidth, error) {
+	res, err := ipfs.post("stats/bw")
+	if err != nil {
+		logger.Error(err)
+		return api.IPFSBandwidth{}, err
+	}
+
+	var stats ipfsBandwidthResp
+	err = json.Unmarshal(res, &stats)
+	if err != nil {
+		logger.Error(err)
+		return api.IPFSBandwidth{}, err
+	}
+	return api.IPFSBandwidth{
+		TotalIn:  stats.TotalIn,
+		TotalOut: stats.TotalOut,
+		RateIn:   stats.RateIn,
+		RateOut:  stats.RateOut,
+	}, nil
+}
+
 // SwarmPeers returns the peers currently connected to this ipfs daemon
 func (ipfs *Connector) SwarmPeers() (api.SwarmPeers, error) {
 	swarm := api.SwarmPeers{}
@@ -126,6 +126,79 @@ func TestIPFSUnpin(t *testing.T) {
 	}
 }
 
+func TestIPFSPinDepth(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+	c, _ := cid.Decode(test.TestCid1)
+
+	err := ipfs.UnpinDepth(ctx, c, 2, nil)
+	if err != nil {
+		t.Error("expected success unpinning non-pinned cid:", err)
+	}
+
+	err = ipfs.PinDepth(ctx, c, 2)
+	if err != nil {
+		t.Fatal("expected success pinning cid:", err)
+	}
+	pinSt, err := ipfs.PinLsCid(ctx, c)
+	if err != nil || !pinSt.IsPinned() {
+		t.Fatal("cid should have been pinned")
+	}
+
+	// nodes needed by other pins are kept
+	err = ipfs.UnpinDepth(ctx, c, 2, []api.Pin{api.PinCid(c)})
+	if err != nil {
+		t.Fatal("expected success unpinning pinned cid:", err)
+	}
+	pinSt, err = ipfs.PinLsCid(ctx, c)
+	if err != nil || !pinSt.IsPinned() {
+		t.Fatal("cid needed by another pin should stay pinned")
+	}
+
+	err = ipfs.UnpinDepth(ctx, c, 2, nil)
+	if err != nil {
+		t.Fatal("expected success unpinning pinned cid:", err)
+	}
+	pinSt, err = ipfs.PinLsCid(ctx, c)
+	if err != nil || pinSt.IsPinned() {
+		t.Error("cid should have been unpinned")
+	}
+
+	c2, _ := cid.Decode(test.ErrorCid)
+	err = ipfs.PinDepth(ctx, c2, 1)
+	if err == nil {
+		t.Error("expected error pinning cid")
+	}
+}
+
+func TestIPFSPinUpdate(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+	c, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+
+	err := ipfs.PinUpdate(ctx, c, c2)
+	if err == nil {
+		t.Error("expected an error updating a non-pinned cid")
+	}
+
+	ipfs.Pin(ctx, c, true)
+	err = ipfs.PinUpdate(ctx, c, c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []*cid.Cid{c, c2} {
+		ips, err := ipfs.PinLsCid(ctx, h)
+		if err != nil || !ips.IsPinned() {
+			t.Error("both cids should be pinned:", h)
+		}
+	}
+}
+
 func TestIPFSPinLsCid(t *testing.T) {
 	ctx := context.Background()
 	ipfs, mock := testIPFSConnector(t)
@@ -146,6 +219,117 @@ func TestIPFSPinLsCid(t *testing.T) {
 	}
 }
 
+func TestIPFSAdd(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "testfile")
+	fw.Write([]byte("this is a test"))
+	mw.Close()
+
+	added, err := ipfs.Add(ctx, api.AddParams{CidVersion: 1, RawLeaves: true}, mw.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0].Cid != test.TestCid3 || added[0].Name != "testfile" {
+		t.Error("unexpected added items:", added)
+	}
+	c, _ := cid.Decode(test.TestCid3)
+	pinSt, err := ipfs.PinLsCid(ctx, c)
+	if err != nil || !pinSt.IsPinned() {
+		t.Error("the added root should be pinned:", pinSt, err)
+	}
+
+	_, err = ipfs.Add(ctx, api.AddParams{}, "text/plain", bytes.NewReader([]byte("abc")))
+	if err == nil {
+		t.Error("expected an error adding without files")
+	}
+}
+
+func TestIPFSDAGImportExport(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	err := ipfs.DAGImport(ctx, bytes.NewReader([]byte("car file")), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := cid.Decode(test.TestCid1)
+	var buf bytes.Buffer
+	err = ipfs.DAGExport(ctx, c, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "car:"+test.TestCid1 {
+		t.Error("unexpected CAR file:", buf.String())
+	}
+}
+
+func TestIPFSPutLinks(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	node, err := ipfs.PutLinks(ctx, []*cid.Cid{c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.String() != test.TestCid2 {
+		t.Error("unexpected node:", node)
+	}
+}
+
+func TestIPFSPutUnixFS(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	file := api.UnixFSNode{
+		Links: []api.UnixFSLink{
+			{Cid: c1, Size: 110, FileSize: 100},
+			{Cid: c2, Size: 60, FileSize: 50},
+		},
+	}
+	node, err := ipfs.PutUnixFS(ctx, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.String() != test.TestCid3 {
+		t.Error("unexpected node:", node)
+	}
+	if st, _ := ipfs.PinLsCid(ctx, node); !st.IsPinned() {
+		t.Error("the node should be pinned")
+	}
+}
+
+func TestUnixFSData(t *testing.T) {
+	dir := unixfsData(api.UnixFSNode{Directory: true})
+	if !bytes.Equal(dir, []byte{0x08, 1}) {
+		t.Errorf("unexpected directory data: %x", dir)
+	}
+
+	file := unixfsData(api.UnixFSNode{
+		Links: []api.UnixFSLink{{FileSize: 100}, {FileSize: 300}},
+	})
+	// type 2, filesize 400, blocksizes 100 and 300
+	expected := []byte{0x08, 2, 0x18, 0x90, 0x03, 0x20, 100, 0x20, 0xac, 0x02}
+	if !bytes.Equal(file, expected) {
+		t.Errorf("unexpected file data: %x", file)
+	}
+}
+
 func TestIPFSPinLs(t *testing.T) {
 	ctx := context.Background()
 	ipfs, mock := testIPFSConnector(t)
@@ -486,6 +670,67 @@ func TestIPFSProxyPinLs(t *testing.T) {
 			t.Error("the request should have failed")
 		}
 	})
+
+	pinLsKeys := func(t *testing.T, query string) map[string]ipfsPinType {
+		res, err := http.Post(fmt.Sprintf("%s/pin/ls?%s", proxyURL(ipfs), query), "", nil)
+		if err != nil {
+			t.Fatal("should have succeeded: ", err)
+		}
+		defer res.Body.Close()
+		var resp ipfsPinLsResp
+		if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Keys
+	}
+
+	// pinned by the IPFS daemon only
+	c, _ := cid.Decode(test.TestSlowCid1)
+	if err := ipfs.Pin(context.Background(), c, true); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("pin/ls local and cluster pins", func(t *testing.T) {
+		keys := pinLsKeys(t, "")
+		_, ok := keys[test.TestSlowCid1]
+		if len(keys) != 4 || !ok {
+			t.Error("expected the local and cluster pins:", keys)
+		}
+	})
+
+	t.Run("pin/ls cluster only", func(t *testing.T) {
+		ipfs.config.ProxyPinLsClusterOnly = true
+		defer func() { ipfs.config.ProxyPinLsClusterOnly = false }()
+		keys := pinLsKeys(t, "")
+		_, ok := keys[test.TestSlowCid1]
+		if len(keys) != 3 || ok {
+			t.Error("expected the cluster pins only:", keys)
+		}
+
+		keys = pinLsKeys(t, "type=recursive")
+		if len(keys) != 2 || keys[test.TestCid1].Type != "recursive" {
+			t.Error("expected the recursive cluster pins:", keys)
+		}
+
+		// depth-limited pins are made of direct pins
+		keys = pinLsKeys(t, "type=direct")
+		if len(keys) != 1 || keys[test.TestCid3].Type != "direct" {
+			t.Error("expected the depth-limited cluster pin:", keys)
+		}
+
+		keys = pinLsKeys(t, "cluster-only=false")
+		if len(keys) != 4 {
+			t.Error("expected the local and cluster pins:", keys)
+		}
+	})
+
+	t.Run("pin/ls cluster only argument", func(t *testing.T) {
+		keys := pinLsKeys(t, "cluster-only=true")
+		_, ok := keys[test.TestSlowCid1]
+		if len(keys) != 3 || ok {
+			t.Error("expected the cluster pins only:", keys)
+		}
+	})
 }
 
 func TestProxyAdd(t *testing.T) {
@@ -663,6 +908,35 @@ func TestProxyError(t *testing.T) {
 	}
 }
 
+func TestProxyRetrievals(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	paths := []string{
+		"/cat?arg=" + test.TestCid1,
+		"/cat?arg=/ipfs/" + test.TestCid1 + "/file",
+		"/block/get?arg=" + test.TestCid2,
+		"/cat?arg=notacid",
+	}
+	for _, p := range paths {
+		res, err := http.Post(proxyURL(ipfs)+p, "", nil)
+		if err != nil {
+			t.Fatal("should have succeeded: ", err)
+		}
+		res.Body.Close()
+	}
+
+	retrievals := ipfs.Retrievals()
+	if len(retrievals) != 2 || retrievals[test.TestCid1] != 2 || retrievals[test.TestCid2] != 1 {
+		t.Errorf("unexpected retrievals: %v", retrievals)
+	}
+
+	if len(ipfs.Retrievals()) != 0 {
+		t.Error("retrievals should have been reset")
+	}
+}
+
 func TestIPFSShutdown(t *testing.T) {
 	ipfs, mock := testIPFSConnector(t)
 	defer mock.Close()
@@ -736,6 +1010,55 @@ func TestRepoSize(t *testing.T) {
 	}
 }
 
+func TestDAGSize(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	s, err := ipfs.DAGSize(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// See the ipfs mock implementation
+	if s != 1000 {
+		t.Error("expected 1000 bytes of size")
+	}
+}
+
+func TestRepoGC(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	err := ipfs.RepoGC(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mock.GCRuns() != 1 {
+		t.Error("expected a garbage collection run")
+	}
+}
+
+func TestBandwidthStats(t *testing.T) {
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown()
+
+	bw, err := ipfs.BandwidthStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// See the ipfs mock implementation
+	if bw.TotalIn != 1000000 || bw.TotalOut != 500000 {
+		t.Error("unexpected bandwidth totals")
+	}
+	if bw.RateIn != 2048.5 || bw.RateOut != 1024 {
+		t.Error("unexpected bandwidth rates")
+	}
+}
+
 func TestConfigKey(t *testing.T) {
 	ipfs, mock := testIPFSConnector(t)
 	defer mock.Close()
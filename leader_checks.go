@@ -0,0 +1,107 @@
+package ipfscluster
+
+import (
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+)
+
+// Some checks only run in the leader: they compare the metrics of the
+// peers with the shared state (tracked pins, pin queues, clock skew) or
+// adjust the pins in it (popularity, under-replication, expiration).
+// They share a single ticker and a single snapshot of the state per
+// tick.
+
+// stateSnapshot is the shared state as seen by a round of leader checks.
+// The pins are only listed once, when a check first needs them.
+type stateSnapshot struct {
+	state.State
+	pins []api.Pin
+}
+
+// List returns the pins in the state at the time of the first call.
+func (snap *stateSnapshot) List() []api.Pin {
+	if snap.pins == nil {
+		snap.pins = snap.State.List()
+	}
+	return snap.pins
+}
+
+// leaderCheck is a check run regularly in the leader.
+type leaderCheck func(snap *stateSnapshot)
+
+// leaderChecks returns the enabled leader checks. Pins are unpinned
+// after the other checks have run, so that no check re-pins an expired
+// pin from the snapshot.
+func (c *Cluster) leaderChecks() []leaderCheck {
+	var checks []leaderCheck
+	if c.config.TrackedPinsMaxDeviation > 0 {
+		checks = append(checks, c.checkTrackedPins)
+	}
+	if c.config.PinQueueMaxLength > 0 {
+		checks = append(checks, c.checkPinQueues)
+	}
+	if c.config.MaxClockSkew > 0 {
+		checks = append(checks, c.checkClockSkew)
+	}
+	if c.config.PopularityHotThreshold > 0 {
+		checks = append(checks, c.checkPopularity)
+	}
+	if c.config.UnderReplicationPolicy == UnderReplicationAccept {
+		checks = append(checks, func(snap *stateSnapshot) {
+			c.topUpUnderReplicated(snap)
+		})
+	}
+	checks = append(checks, func(snap *stateSnapshot) {
+		c.unpinExpired(snap)
+	})
+	return checks
+}
+
+// watchLeaderChecks runs the leader checks every MonitorPingInterval.
+func (c *Cluster) watchLeaderChecks() {
+	checks := c.leaderChecks()
+
+	ticker := time.NewTicker(c.config.MonitorPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.runLeaderChecks(checks...)
+		}
+	}
+}
+
+// runLeaderChecks runs the given checks with a snapshot of the state,
+// unless this peer is not the leader.
+func (c *Cluster) runLeaderChecks(checks ...leaderCheck) {
+	leader, err := c.consensus.Leader()
+	if err != nil || leader != c.id {
+		return
+	}
+
+	snap, err := c.stateSnapshot()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	for _, check := range checks {
+		if c.ctx.Err() != nil {
+			return
+		}
+		check(snap)
+	}
+}
+
+// stateSnapshot returns a snapshot of the current shared state.
+func (c *Cluster) stateSnapshot() (*stateSnapshot, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		return nil, err
+	}
+	return &stateSnapshot{State: cState}, nil
+}
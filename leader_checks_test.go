@@ -0,0 +1,38 @@
+package ipfscluster
+
+import (
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state/mapstate"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+// testStateSnapshot returns a snapshot of the state of the given cluster
+// to run leader checks in tests.
+func testStateSnapshot(t *testing.T, cl *Cluster) *stateSnapshot {
+	snap, err := cl.stateSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snap
+}
+
+func TestStateSnapshotList(t *testing.T) {
+	st := mapstate.NewMapState()
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	st.Add(api.PinCid(c1))
+
+	snap := &stateSnapshot{State: st}
+	if len(snap.List()) != 1 {
+		t.Fatal("expected one pin in the snapshot")
+	}
+
+	st.Add(api.PinCid(c2))
+	if len(snap.List()) != 1 {
+		t.Error("the pins should only be listed once per snapshot")
+	}
+}
@@ -0,0 +1,181 @@
+package ipfscluster
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// The local RPC socket exposes the internal RPC API to local tools, so
+// that they can use the same methods as the cluster components rather
+// than the REST API. It is served over HTTP on the LocalRPCSocket and
+// every request must carry the LocalRPCToken in an
+// "Authorization: Bearer <token>" header:
+//
+//  - GET /methods lists the available methods.
+//  - POST /<method> calls a method of the "Cluster" RPC service. The
+//    body is the JSON-encoded argument and the response the
+//    JSON-encoded result, or an api.Error.
+//
+// Methods taking no argument accept an empty body.
+
+// rpcMethod holds the argument and result types of an RPC method.
+type rpcMethod struct {
+	argType   reflect.Type
+	replyType reflect.Type
+}
+
+// rpcMethods lists the methods of the RPCAPI by name.
+func rpcMethods() map[string]rpcMethod {
+	methods := make(map[string]rpcMethod)
+	t := reflect.TypeOf(&RPCAPI{})
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		// receiver, context, argument and result
+		if m.Type.NumIn() != 4 || m.Type.In(3).Kind() != reflect.Ptr {
+			continue
+		}
+		methods[m.Name] = rpcMethod{
+			argType:   m.Type.In(2),
+			replyType: m.Type.In(3).Elem(),
+		}
+	}
+	return methods
+}
+
+type localRPCHandler struct {
+	rpcClient *rpc.Client
+	token     string
+	methods   map[string]rpcMethod
+}
+
+func newLocalRPCHandler(rpcClient *rpc.Client, token string) *localRPCHandler {
+	return &localRPCHandler{
+		rpcClient: rpcClient,
+		token:     token,
+		methods:   rpcMethods(),
+	}
+}
+
+func (h *localRPCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte(h.token)) != 1 {
+		h.sendError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "methods" && r.Method == "GET" {
+		names := make([]string, 0, len(h.methods))
+		for n := range h.methods {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		h.send(w, http.StatusOK, names)
+		return
+	}
+
+	method, ok := h.methods[name]
+	if !ok {
+		h.sendError(w, http.StatusNotFound, fmt.Sprintf("unknown method: %s", name))
+		return
+	}
+	if r.Method != "POST" {
+		h.sendError(w, http.StatusMethodNotAllowed, "methods must be called with POST")
+		return
+	}
+
+	arg := reflect.New(method.argType)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		err = json.Unmarshal(body, arg.Interface())
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, fmt.Sprintf("error decoding argument: %s", err))
+			return
+		}
+	}
+
+	reply := reflect.New(method.replyType)
+	ctx := api.ContextWithOrigin(r.Context(), api.LocalRPCOrigin())
+	err = h.rpcClient.CallContext(ctx, "", "Cluster", name, arg.Elem().Interface(), reply.Interface())
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.send(w, http.StatusOK, reply.Interface())
+}
+
+func (h *localRPCHandler) send(w http.ResponseWriter, code int, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error(err)
+	}
+}
+
+func (h *localRPCHandler) sendError(w http.ResponseWriter, code int, msg string) {
+	h.send(w, code, api.Error{Code: code, Message: msg})
+}
+
+// startLocalRPC serves the RPC API on the LocalRPCSocket, when set. When
+// no LocalRPCToken is configured, a random one is written next to the
+// socket.
+func (c *Cluster) startLocalRPC() error {
+	path := c.config.GetLocalRPCSocketPath()
+	if path == "" {
+		return nil
+	}
+
+	token := c.config.LocalRPCToken
+	if token == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		token = hex.EncodeToString(buf)
+		err := ioutil.WriteFile(path+".token", []byte(token+"\n"), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	// Only the user running the peer can connect.
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return err
+	}
+
+	srv := &http.Server{Handler: newLocalRPCHandler(c.rpcClient, token)}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		<-c.ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	go srv.Serve(l)
+	logger.Infof("local RPC API listening on %s", path)
+	return nil
+}
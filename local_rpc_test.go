@@ -0,0 +1,73 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestLocalRPCHandler(t *testing.T) {
+	h := newLocalRPCHandler(test.NewMockRPCClient(t), "secret")
+
+	call := func(method, path, token string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := call("POST", "/ID", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Error("expected unauthorized without token:", rec.Code)
+	}
+	if rec := call("POST", "/ID", "wrong", nil); rec.Code != http.StatusUnauthorized {
+		t.Error("expected unauthorized with a wrong token:", rec.Code)
+	}
+	if rec := call("POST", "/Nothing", "secret", nil); rec.Code != http.StatusNotFound {
+		t.Error("expected not found for unknown methods:", rec.Code)
+	}
+
+	rec := call("GET", "/methods", "secret", nil)
+	var methods []string
+	json.Unmarshal(rec.Body.Bytes(), &methods)
+	found := false
+	for _, m := range methods {
+		found = found || m == "PeerMonitorLastMetrics"
+	}
+	if !found {
+		t.Error("expected the monitor methods to be listed")
+	}
+
+	rec = call("POST", "/ID", "secret", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatal("ID call failed:", rec.Body.String())
+	}
+	var id api.IDSerial
+	json.Unmarshal(rec.Body.Bytes(), &id)
+	if id.ID != test.TestPeerID1.Pretty() {
+		t.Error("unexpected ID:", id.ID)
+	}
+
+	arg, _ := json.Marshal(api.PinSerial{Cid: test.TestCid1})
+	rec = call("POST", "/PinGet", "secret", arg)
+	if rec.Code != http.StatusOK {
+		t.Fatal("PinGet call failed:", rec.Body.String())
+	}
+	var pin api.PinSerial
+	json.Unmarshal(rec.Body.Bytes(), &pin)
+	if pin.Cid != test.TestCid1 {
+		t.Error("unexpected pin:", pin.Cid)
+	}
+
+	rec = call("POST", "/PinGet", "secret", []byte("{bad"))
+	if rec.Code != http.StatusBadRequest {
+		t.Error("expected bad request for invalid arguments:", rec.Code)
+	}
+}
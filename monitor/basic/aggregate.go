@@ -0,0 +1,176 @@
+package basic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// AggregateFunc reduces the values of the metrics in a window to a
+// single value. It is never called with an empty slice.
+type AggregateFunc func(values []float64) float64
+
+// Avg returns the average of the values.
+func Avg(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// Min returns the smallest of the values.
+func Min(values []float64) float64 {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Max returns the largest of the values.
+func Max(values []float64) float64 {
+	max := values[0]
+	for _, v := range values[1:] {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// Percentile returns an AggregateFunc which provides the p-th
+// percentile (0-100) of the values, using the nearest-rank method.
+func Percentile(p float64) AggregateFunc {
+	return func(values []float64) float64 {
+		sorted := append([]float64{}, values...)
+		sort.Float64s(sorted)
+		rank := int(p/100*float64(len(sorted)) + 0.5)
+		if rank < 1 {
+			rank = 1
+		}
+		if rank > len(sorted) {
+			rank = len(sorted)
+		}
+		return sorted[rank-1]
+	}
+}
+
+// parseAggregation returns the AggregateFunc for the given name: "avg",
+// "min", "max" or "pNN" for the NN-th percentile (i.e. "p90").
+func parseAggregation(name string) (AggregateFunc, error) {
+	switch name {
+	case "avg":
+		return Avg, nil
+	case "min":
+		return Min, nil
+	case "max":
+		return Max, nil
+	}
+
+	if strings.HasPrefix(name, "p") {
+		p, err := strconv.ParseFloat(name[1:], 64)
+		if err == nil && p > 0 && p <= 100 {
+			return Percentile(p), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown aggregation: %s", name)
+}
+
+// Window returns the valid metrics of the given name received from the
+// given peer which are part of the window configured for that metric,
+// ordered from oldest to newest. When no window is configured, all the
+// valid metrics kept by the monitor are returned.
+func (mon *Monitor) Window(name string, p peer.ID) []api.Metric {
+	mon.metricsMux.RLock()
+	defer mon.metricsMux.RUnlock()
+
+	metrics := []api.Metric{}
+	mbyp, ok := mon.metrics[name]
+	if !ok {
+		return metrics
+	}
+	pmets, ok := mbyp[p]
+	if !ok {
+		return metrics
+	}
+
+	window := mon.config.MetricWindows[name]
+	var since int64
+	if window.Duration > 0 {
+		since = time.Now().Add(-window.Duration).UnixNano()
+	}
+
+	for _, m := range pmets.all() { // newest to oldest
+		if window.Samples > 0 && len(metrics) >= window.Samples {
+			break
+		}
+		if m.Received < since {
+			break
+		}
+		if !m.Valid {
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+
+	// reverse to return oldest to newest
+	for i, j := 0, len(metrics)-1; i < j; i, j = i+1, j-1 {
+		metrics[i], metrics[j] = metrics[j], metrics[i]
+	}
+	return metrics
+}
+
+// Aggregate returns, for every current cluster peer with a valid last
+// metric of the given name, that last metric with its value replaced by
+// the result of applying fn to the values in the peer's window. Metrics
+// whose values are not numeric are returned unmodified.
+func (mon *Monitor) Aggregate(name string, fn AggregateFunc) []api.Metric {
+	lastMetrics := mon.lastMetrics(name)
+	for i, last := range lastMetrics {
+		value, err := aggregateWindow(mon.Window(name, last.Peer), fn)
+		if err != nil {
+			logger.Debugf("not aggregating %s metric from %s: %s", name, last.Peer, err)
+			continue
+		}
+		lastMetrics[i].Value = value
+	}
+	return lastMetrics
+}
+
+// aggregateWindow applies fn to the values of the given metrics. The
+// result is an integer when all values are integers, so that it can be
+// used in place of the original values.
+func aggregateWindow(window []api.Metric, fn AggregateFunc) (string, error) {
+	if len(window) == 0 {
+		return "", errors.New("empty window")
+	}
+
+	values := make([]float64, len(window))
+	integers := true
+	for i, m := range window {
+		v, err := strconv.ParseFloat(m.Value, 64)
+		if err != nil {
+			return "", err
+		}
+		if _, err := strconv.ParseUint(m.Value, 10, 64); err != nil {
+			integers = false
+		}
+		values[i] = v
+	}
+
+	result := fn(values)
+	if integers {
+		return strconv.FormatUint(uint64(result+0.5), 10), nil
+	}
+	return strconv.FormatFloat(result, 'f', -1, 64), nil
+}
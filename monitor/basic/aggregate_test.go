@@ -0,0 +1,84 @@
+package basic
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestAggregateFuncs(t *testing.T) {
+	values := []float64{4, 1, 3, 2, 10}
+
+	if Avg(values) != 4 {
+		t.Error("bad average")
+	}
+	if Min(values) != 1 || Max(values) != 10 {
+		t.Error("bad min or max")
+	}
+	if p := Percentile(50)(values); p != 3 {
+		t.Error("bad median: ", p)
+	}
+	if p := Percentile(100)(values); p != 10 {
+		t.Error("bad 100th percentile: ", p)
+	}
+
+	if _, err := parseAggregation("p90"); err != nil {
+		t.Error(err)
+	}
+	if _, err := parseAggregation("p0"); err == nil {
+		t.Error("expected an error for p0")
+	}
+	if _, err := parseAggregation("median"); err == nil {
+		t.Error("expected an error for an unknown aggregation")
+	}
+}
+
+func TestPeerMonitorWindowAndAggregate(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+	pm.config.MetricWindows = map[string]MetricWindow{
+		"test": {Samples: 3},
+	}
+
+	for _, v := range []string{"100", "1", "2", "6"} {
+		m := newMetric("test", test.TestPeerID1)
+		m.Value = v
+		pm.LogMetric(m)
+	}
+
+	window := pm.Window("test", test.TestPeerID1)
+	if len(window) != 3 || window[0].Value != "1" || window[2].Value != "6" {
+		t.Fatal("window should contain the last 3 samples, oldest first")
+	}
+
+	aggr := pm.Aggregate("test", Avg)
+	if len(aggr) != 1 || aggr[0].Value != "3" {
+		t.Error("expected the average of the window: ", aggr)
+	}
+
+	pm.config.MetricWindows["test"] = MetricWindow{Samples: 3, Aggregation: "max"}
+	last := pm.LastMetrics("test")
+	if len(last) != 1 || last[0].Value != "6" {
+		t.Error("LastMetrics should use the configured aggregation")
+	}
+
+	m := newMetric("other", test.TestPeerID1)
+	m.Value = "abc"
+	pm.LogMetric(m)
+	aggr = pm.Aggregate("other", Avg)
+	if len(aggr) != 1 || aggr[0].Value != "abc" {
+		t.Error("non-numeric metrics should not be aggregated")
+	}
+}
+
+func TestAggregateWindowFloats(t *testing.T) {
+	window := []api.Metric{{Value: "0.5"}, {Value: "1"}}
+	v, err := aggregateWindow(window, Avg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "0.75" {
+		t.Error("expected a float average: ", v)
+	}
+}
@@ -3,6 +3,8 @@ package basic
 import (
 	"encoding/json"
 	"errors"
+	"net/url"
+	"path/filepath"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/config"
@@ -12,7 +14,25 @@ const configKey = "monbasic"
 
 // Default values for this Config.
 const (
-	DefaultCheckInterval = 15 * time.Second
+	DefaultCheckInterval       = 15 * time.Second
+	DefaultReAlertInterval     = time.Minute
+	DefaultMaxRepeatedAlerts   = 0
+	DefaultFailureDetector     = TTLDetector
+	DefaultPhiThreshold        = 8.0
+	DefaultFailureThreshold    = 1
+	DefaultMaxPeersPerMetric   = 0
+	DefaultQuarantineThreshold = 0
+)
+
+// Failure detectors which can be used by the Monitor.
+const (
+	// TTLDetector considers that a peer has failed as soon as
+	// its last metric expires.
+	TTLDetector = "ttl"
+	// PhiAccrualDetector considers that a peer has failed when the
+	// phi value computed from the arrival times of its metrics is
+	// above the PhiThreshold.
+	PhiAccrualDetector = "phi_accrual"
 )
 
 // Config allows to initialize a Monitor and customize some parameters.
@@ -20,10 +40,98 @@ type Config struct {
 	config.Saver
 
 	CheckInterval time.Duration
+
+	// ReAlertInterval is the minimum time between two alerts for
+	// the same peer and metric while the metric stays expired.
+	ReAlertInterval time.Duration
+	// MaxRepeatedAlerts is the number of alerts sent for the same peer
+	// and metric before further alerts are suppressed until the peer
+	// recovers. 0 means no limit.
+	MaxRepeatedAlerts int
+
+	// FailureDetector selects how the monitor decides that a peer has
+	// failed: "ttl" or "phi_accrual".
+	FailureDetector string
+	// PhiThreshold is the phi value above which a peer is considered
+	// down when using the "phi_accrual" failure detector.
+	PhiThreshold float64
+	// FailureThreshold is the number of consecutive checks in which
+	// a peer must appear as failed before an alert is sent.
+	FailureThreshold int
+
+	// AlertWebhooks is a list of URLs to which alerts are POSTed.
+	AlertWebhooks []string
+	// AlertCommands is a list of commands which are run for
+	// every alert. Each command is the program followed by its
+	// arguments.
+	AlertCommands [][]string
+
+	// MetricWindows configures, by metric name, which of the received
+	// metrics are considered by Window() and Aggregate().
+	MetricWindows map[string]MetricWindow
+
+	// MetricsFile is the file, relative to the configuration folder,
+	// where the last metrics received from every peer are persisted so
+	// that they are available right after a restart. Persistence is
+	// disabled when empty.
+	MetricsFile string
+
+	// MaxPeersPerMetric limits how many peers metrics are kept for,
+	// for every metric type. When exceeded, the peers whose last metric
+	// is the oldest are evicted. 0 means no limit. Regardless of this
+	// option, the metrics of peers which left the peerset are evicted
+	// once they expire.
+	MaxPeersPerMetric int
+
+	// ExportSocket is the path, relative to the configuration folder, of
+	// a unix socket on which every metric received is written as a line
+	// of JSON for the consumption of other local processes. The exporter
+	// is disabled when empty.
+	ExportSocket string
+
+	// QuarantineThreshold is the number of consecutive invalid metrics
+	// of a type (i.e. already expired or expiring too far in the future)
+	// received from a peer before all its metrics are considered invalid
+	// until it is manually released. Metrics which the peer marks as
+	// invalid itself are not counted. 0 disables the quarantine.
+	QuarantineThreshold int
+}
+
+// MetricWindow limits the metrics of a type used for aggregations to the
+// last Samples metrics received in the last Duration. A zero value
+// disables each limit. When Aggregation is set ("avg", "min", "max" or
+// "pNN" for a percentile), LastMetrics returns aggregated values for
+// this metric type. Capacity is the number of metrics of this type kept
+// for every peer, which defaults to WindowCap when 0.
+type MetricWindow struct {
+	Samples     int
+	Duration    time.Duration
+	Aggregation string
+	Capacity    int
+}
+
+type metricWindowJSON struct {
+	Samples     int    `json:"samples,omitempty"`
+	Duration    string `json:"duration,omitempty"`
+	Aggregation string `json:"aggregation,omitempty"`
+	Capacity    int    `json:"capacity,omitempty"`
 }
 
 type jsonConfig struct {
-	CheckInterval string `json:"check_interval"`
+	CheckInterval       string     `json:"check_interval"`
+	ReAlertInterval     string     `json:"re_alert_interval"`
+	MaxRepeatedAlerts   int        `json:"max_repeated_alerts"`
+	FailureDetector     string     `json:"failure_detector"`
+	PhiThreshold        float64    `json:"phi_threshold"`
+	FailureThreshold    int        `json:"failure_threshold"`
+	AlertWebhooks       []string   `json:"alert_webhooks,omitempty"`
+	AlertCommands       [][]string `json:"alert_commands,omitempty"`
+	MetricsFile         string     `json:"metrics_file,omitempty"`
+	MaxPeersPerMetric   int        `json:"max_peers_per_metric"`
+	ExportSocket        string     `json:"export_socket,omitempty"`
+	QuarantineThreshold int        `json:"quarantine_threshold"`
+
+	MetricWindows map[string]metricWindowJSON `json:"metric_windows,omitempty"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -34,6 +142,18 @@ func (cfg *Config) ConfigKey() string {
 // Default sets the fields of this Config to sensible values.
 func (cfg *Config) Default() error {
 	cfg.CheckInterval = DefaultCheckInterval
+	cfg.ReAlertInterval = DefaultReAlertInterval
+	cfg.MaxRepeatedAlerts = DefaultMaxRepeatedAlerts
+	cfg.FailureDetector = DefaultFailureDetector
+	cfg.PhiThreshold = DefaultPhiThreshold
+	cfg.FailureThreshold = DefaultFailureThreshold
+	cfg.AlertWebhooks = nil
+	cfg.AlertCommands = nil
+	cfg.MetricsFile = ""
+	cfg.MaxPeersPerMetric = DefaultMaxPeersPerMetric
+	cfg.ExportSocket = ""
+	cfg.QuarantineThreshold = DefaultQuarantineThreshold
+	cfg.MetricWindows = nil
 	return nil
 }
 
@@ -43,9 +163,74 @@ func (cfg *Config) Validate() error {
 	if cfg.CheckInterval <= 0 {
 		return errors.New("basic.check_interval too low")
 	}
+
+	if cfg.ReAlertInterval < 0 {
+		return errors.New("basic.re_alert_interval is invalid")
+	}
+
+	if cfg.MaxRepeatedAlerts < 0 {
+		return errors.New("basic.max_repeated_alerts is invalid")
+	}
+
+	switch cfg.FailureDetector {
+	case TTLDetector, PhiAccrualDetector:
+	default:
+		return errors.New("basic.failure_detector is invalid")
+	}
+
+	if cfg.PhiThreshold <= 0 {
+		return errors.New("basic.phi_threshold is invalid")
+	}
+
+	if cfg.FailureThreshold < 1 {
+		return errors.New("basic.failure_threshold is invalid")
+	}
+
+	if cfg.MaxPeersPerMetric < 0 {
+		return errors.New("basic.max_peers_per_metric is invalid")
+	}
+
+	if cfg.QuarantineThreshold < 0 {
+		return errors.New("basic.quarantine_threshold is invalid")
+	}
+
+	for _, u := range cfg.AlertWebhooks {
+		if !isValidWebhookURL(u) {
+			return errors.New("basic.alert_webhooks contains an invalid URL")
+		}
+	}
+
+	for _, c := range cfg.AlertCommands {
+		if len(c) == 0 || c[0] == "" {
+			return errors.New("basic.alert_commands contains an empty command")
+		}
+	}
+
+	for _, w := range cfg.MetricWindows {
+		if w.Samples < 0 || w.Duration < 0 || w.Capacity < 0 {
+			return errors.New("basic.metric_windows is invalid")
+		}
+		if w.Capacity > 0 && w.Samples > w.Capacity {
+			return errors.New("basic.metric_windows samples cannot be larger than capacity")
+		}
+		if w.Aggregation != "" {
+			if _, err := parseAggregation(w.Aggregation); err != nil {
+				return errors.New("basic.metric_windows contains an invalid aggregation")
+			}
+		}
+	}
 	return nil
 }
 
+// isValidWebhookURL returns true for absolute http(s) URLs with a host.
+func isValidWebhookURL(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	return parsed.Scheme == "http" || parsed.Scheme == "https"
+}
+
 // LoadJSON sets the fields of this Config to the values defined by the JSON
 // representation of it, as generated by ToJSON.
 func (cfg *Config) LoadJSON(raw []byte) error {
@@ -56,8 +241,45 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 		return err
 	}
 
+	cfg.Default()
+
 	interval, _ := time.ParseDuration(jcfg.CheckInterval)
 	cfg.CheckInterval = interval
+	// 0s is a valid value which disables the re-alert interval, so
+	// only a missing key keeps the default.
+	if jcfg.ReAlertInterval != "" {
+		reAlertInterval, err := time.ParseDuration(jcfg.ReAlertInterval)
+		if err != nil {
+			return errors.New("basic.re_alert_interval is invalid")
+		}
+		cfg.ReAlertInterval = reAlertInterval
+	}
+	config.SetIfNotDefault(jcfg.MaxRepeatedAlerts, &cfg.MaxRepeatedAlerts)
+	config.SetIfNotDefault(jcfg.FailureDetector, &cfg.FailureDetector)
+	config.SetIfNotDefault(jcfg.PhiThreshold, &cfg.PhiThreshold)
+	config.SetIfNotDefault(jcfg.FailureThreshold, &cfg.FailureThreshold)
+	cfg.AlertWebhooks = jcfg.AlertWebhooks
+	cfg.AlertCommands = jcfg.AlertCommands
+	cfg.MetricsFile = jcfg.MetricsFile
+	config.SetIfNotDefault(jcfg.MaxPeersPerMetric, &cfg.MaxPeersPerMetric)
+	cfg.ExportSocket = jcfg.ExportSocket
+	config.SetIfNotDefault(jcfg.QuarantineThreshold, &cfg.QuarantineThreshold)
+
+	if len(jcfg.MetricWindows) > 0 {
+		cfg.MetricWindows = make(map[string]MetricWindow)
+	}
+	for name, jw := range jcfg.MetricWindows {
+		d, err := time.ParseDuration(jw.Duration)
+		if jw.Duration != "" && err != nil {
+			return errors.New("basic.metric_windows contains an invalid duration")
+		}
+		cfg.MetricWindows[name] = MetricWindow{
+			Samples:     jw.Samples,
+			Duration:    d,
+			Aggregation: jw.Aggregation,
+			Capacity:    jw.Capacity,
+		}
+	}
 
 	return cfg.Validate()
 }
@@ -67,6 +289,58 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 	jcfg := &jsonConfig{}
 
 	jcfg.CheckInterval = cfg.CheckInterval.String()
+	jcfg.ReAlertInterval = cfg.ReAlertInterval.String()
+	jcfg.MaxRepeatedAlerts = cfg.MaxRepeatedAlerts
+	jcfg.FailureDetector = cfg.FailureDetector
+	jcfg.PhiThreshold = cfg.PhiThreshold
+	jcfg.FailureThreshold = cfg.FailureThreshold
+	jcfg.AlertWebhooks = cfg.AlertWebhooks
+	jcfg.AlertCommands = cfg.AlertCommands
+	jcfg.MetricsFile = cfg.MetricsFile
+	jcfg.MaxPeersPerMetric = cfg.MaxPeersPerMetric
+	jcfg.ExportSocket = cfg.ExportSocket
+	jcfg.QuarantineThreshold = cfg.QuarantineThreshold
+
+	if len(cfg.MetricWindows) > 0 {
+		jcfg.MetricWindows = make(map[string]metricWindowJSON)
+	}
+	for name, w := range cfg.MetricWindows {
+		jw := metricWindowJSON{
+			Samples:     w.Samples,
+			Aggregation: w.Aggregation,
+			Capacity:    w.Capacity,
+		}
+		if w.Duration > 0 {
+			jw.Duration = w.Duration.String()
+		}
+		jcfg.MetricWindows[name] = jw
+	}
 
 	return json.MarshalIndent(jcfg, "", "    ")
 }
+
+// GetMetricsPath returns the full path of the MetricsFile, obtained by
+// concatenating that value with BaseDir of the configuration, if set.
+// An empty string is returned when persistence is disabled.
+func (cfg *Config) GetMetricsPath() string {
+	if cfg.MetricsFile == "" {
+		return ""
+	}
+	if filepath.IsAbs(cfg.MetricsFile) || cfg.BaseDir == "" {
+		return cfg.MetricsFile
+	}
+	return filepath.Join(cfg.BaseDir, cfg.MetricsFile)
+}
+
+// GetExportSocketPath returns the full path of the ExportSocket, obtained
+// by concatenating that value with BaseDir of the configuration, if set.
+// An empty string is returned when the exporter is disabled.
+func (cfg *Config) GetExportSocketPath() string {
+	if cfg.ExportSocket == "" {
+		return ""
+	}
+	if filepath.IsAbs(cfg.ExportSocket) || cfg.BaseDir == "" {
+		return cfg.ExportSocket
+	}
+	return filepath.Join(cfg.BaseDir, cfg.ExportSocket)
+}
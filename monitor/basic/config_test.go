@@ -3,11 +3,29 @@ package basic
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 var cfgJSON = []byte(`
 {
-      "check_interval": "15s"
+      "check_interval": "15s",
+      "re_alert_interval": "30s",
+      "max_repeated_alerts": 5,
+      "failure_detector": "phi_accrual",
+      "phi_threshold": 10.5,
+      "failure_threshold": 2,
+      "metrics_file": "metrics",
+      "max_peers_per_metric": 500,
+      "export_socket": "metrics.sock",
+      "quarantine_threshold": 5,
+      "metric_windows": {
+          "freespace": {
+              "samples": 10,
+              "duration": "10m",
+              "aggregation": "avg",
+              "capacity": 20
+          }
+      }
 }
 `)
 
@@ -18,17 +36,128 @@ func TestLoadJSON(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	if cfg.ReAlertInterval != 30*time.Second || cfg.MaxRepeatedAlerts != 5 {
+		t.Error("alert options were not loaded")
+	}
+
+	if cfg.FailureDetector != PhiAccrualDetector || cfg.PhiThreshold != 10.5 || cfg.FailureThreshold != 2 {
+		t.Error("failure detector options were not loaded")
+	}
+
+	if cfg.MaxPeersPerMetric != 500 {
+		t.Error("max_peers_per_metric was not loaded")
+	}
+
+	if cfg.QuarantineThreshold != 5 {
+		t.Error("quarantine_threshold was not loaded")
+	}
+
+	w := cfg.MetricWindows["freespace"]
+	if w.Samples != 10 || w.Duration != 10*time.Minute || w.Aggregation != "avg" || w.Capacity != 20 {
+		t.Error("metric windows were not loaded")
+	}
+
+	cfg.BaseDir = "/tmp/cluster"
+	if cfg.GetMetricsPath() != "/tmp/cluster/metrics" {
+		t.Error("unexpected metrics path: ", cfg.GetMetricsPath())
+	}
+	if cfg.GetExportSocketPath() != "/tmp/cluster/metrics.sock" {
+		t.Error("unexpected export socket path: ", cfg.GetExportSocketPath())
+	}
+
 	j := &jsonConfig{}
 
 	json.Unmarshal(cfgJSON, j)
-	j.CheckInterval = "-10"
+	j.MaxRepeatedAlerts = -1
 	tst, _ := json.Marshal(j)
 	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding max_repeated_alerts")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MetricWindows["freespace"] = metricWindowJSON{Aggregation: "median"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding metric_windows aggregation")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MetricWindows["freespace"] = metricWindowJSON{Samples: 30, Capacity: 20}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding metric_windows samples over capacity")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.AlertCommands = [][]string{{"mail", "admin@example.org"}, {}}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding an empty alert command")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.FailureDetector = "gossip"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding failure_detector")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MaxPeersPerMetric = -1
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding max_peers_per_metric")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.QuarantineThreshold = -1
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding quarantine_threshold")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.CheckInterval = "-10"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
 	if err == nil {
 		t.Error("expected error decoding check_interval")
 	}
 }
 
+func TestLoadJSONReAlertInterval(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON([]byte(`{"check_interval": "15s", "re_alert_interval": "0s"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ReAlertInterval != 0 {
+		t.Error("re_alert_interval should be 0")
+	}
+
+	err = cfg.LoadJSON([]byte(`{"check_interval": "15s"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ReAlertInterval != DefaultReAlertInterval {
+		t.Error("a missing re_alert_interval should take the default")
+	}
+}
+
 func TestToJSON(t *testing.T) {
 	cfg := &Config{}
 	cfg.LoadJSON(cfgJSON)
@@ -55,3 +184,21 @@ func TestDefault(t *testing.T) {
 		t.Fatal("expected error validating")
 	}
 }
+
+func TestValidateAlertWebhooks(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	for u, valid := range map[string]bool{
+		"https://example.org/alerts": true,
+		"http://localhost:9000":      true,
+		"example.org/alerts":         false,
+		"ftp://example.org":          false,
+		"http://":                    false,
+		"":                           false,
+	} {
+		cfg.AlertWebhooks = []string{u}
+		if (cfg.Validate() == nil) != valid {
+			t.Errorf("%q: expected valid to be %t", u, valid)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package basic
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// The exporter makes the metrics received by the Monitor available to
+// local processes ("sidecars"), written in any language, without the need
+// to speak the cluster RPC protocol. When the ExportSocket option is set,
+// the Monitor listens on that unix socket and writes every metric it
+// receives to all connected clients as a line of JSON:
+//
+//  {"name":"freespace","peer":"Qm...","peername":"peer1","value":"1000","expire":1530000000000000000,"valid":true,"received":1529999970000000000}
+//
+//  - name: the metric name (i.e. "ping", "freespace", "numpin").
+//  - peer: the ID of the peer the metric belongs to.
+//  - peername: the name of that peer, if known.
+//  - value: the metric value, always as a string.
+//  - expire: when the metric expires, in nanoseconds since the Unix epoch.
+//  - valid: whether the producer could obtain the value.
+//  - received: when the metric was received, in nanoseconds since the Unix epoch.
+//
+// Clients only need to read from the socket. Metrics are not buffered for
+// clients which are not connected, and those which cannot keep up lose
+// metrics.
+
+// ExporterBufferSize specifies how many metrics are buffered for every
+// exporter client before new ones are dropped.
+var ExporterBufferSize = 256
+
+// exporterWriteTimeout specifies how long writing a metric to an exporter
+// client may take before the client is disconnected.
+var exporterWriteTimeout = 10 * time.Second
+
+type exporter struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[*exporterClient]struct{}
+	closed  bool
+}
+
+type exporterClient struct {
+	conn net.Conn
+	ch   chan []byte
+}
+
+// newExporter listens on the unix socket at the given path, replacing
+// any socket left from a previous run.
+func newExporter(path string) (*exporter, error) {
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &exporter{
+		listener: l,
+		clients:  make(map[*exporterClient]struct{}),
+	}
+	go e.accept()
+	return e, nil
+}
+
+func (e *exporter) accept() {
+	for {
+		conn, err := e.listener.Accept()
+		if err != nil {
+			return // closed
+		}
+
+		client := &exporterClient{
+			conn: conn,
+			ch:   make(chan []byte, ExporterBufferSize),
+		}
+
+		e.mu.Lock()
+		if e.closed {
+			e.mu.Unlock()
+			conn.Close()
+			return
+		}
+		e.clients[client] = struct{}{}
+		e.mu.Unlock()
+
+		go e.serve(client)
+	}
+}
+
+// serve writes the metrics for a client until the exporter is closed or
+// writing fails.
+func (e *exporter) serve(client *exporterClient) {
+	defer func() {
+		e.mu.Lock()
+		delete(e.clients, client)
+		e.mu.Unlock()
+		client.conn.Close()
+	}()
+
+	for line := range client.ch {
+		client.conn.SetWriteDeadline(time.Now().Add(exporterWriteTimeout))
+		if _, err := client.conn.Write(line); err != nil {
+			logger.Debugf("exporter client disconnected: %s", err)
+			return
+		}
+	}
+}
+
+// export sends a metric to all the connected clients.
+func (e *exporter) export(m api.Metric) {
+	serial := m.ToSerial()
+	serial.Signature = nil
+	line, err := json.Marshal(serial)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	line = append(line, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	for client := range e.clients {
+		select {
+		case client.ch <- line:
+		default:
+			logger.Warning("exporter client is too slow, dropping metric")
+		}
+	}
+}
+
+// close stops listening and disconnects all clients.
+func (e *exporter) close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	for client := range e.clients {
+		close(client.ch)
+	}
+	return e.listener.Close()
+}
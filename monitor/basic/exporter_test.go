@@ -0,0 +1,61 @@
+package basic
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestPeerMonitorExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor-exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ExportSocket = filepath.Join(dir, "metrics.sock")
+	pm, err := NewMonitor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Shutdown()
+	pm.SetClient(test.NewMockRPCClient(t))
+
+	conn, err := net.Dial("unix", cfg.ExportSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	time.Sleep(100 * time.Millisecond) // let the client be registered
+
+	mtr := newMetric("test", test.TestPeerID1)
+	pm.LogMetric(mtr)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m api.MetricSerial
+	err = json.Unmarshal(line, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "test" || m.Peer != test.TestPeerID1.Pretty() || m.Value != mtr.Value {
+		t.Error("unexpected exported metric: ", string(line))
+	}
+	if m.Received == 0 {
+		t.Error("exported metric should have a received time")
+	}
+}
@@ -0,0 +1,180 @@
+package basic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// NotifyTimeout specifies how long a Notifier may take to deliver
+// an alert before it is cancelled.
+var NotifyTimeout = 10 * time.Second
+
+// MaxCommandOutput is the maximum number of bytes of the output of a
+// failed alert command which are kept to be included in the error.
+var MaxCommandOutput = 4096
+
+// Notifier sends alerts produced by the Monitor to external systems.
+// Notifiers can be registered with Monitor.AddNotifier() or configured
+// through the "alert_webhooks" and "alert_commands" options.
+type Notifier interface {
+	Notify(ctx context.Context, alrt api.Alert) error
+}
+
+// alertJSON is the representation of an Alert sent to webhooks
+// and passed to commands on their standard input.
+type alertJSON struct {
+	Peer        string    `json:"peer"`
+	Peername    string    `json:"peername,omitempty"`
+	MetricName  string    `json:"metric_name"`
+	Severity    string    `json:"severity"`
+	TriggeredAt time.Time `json:"triggered_at"`
+	MetricTTL   string    `json:"metric_ttl"`
+	LastValue   string    `json:"last_value"`
+	Suppressed  int       `json:"suppressed"`
+	Recovered   bool      `json:"recovered"`
+}
+
+func alertToJSON(alrt api.Alert) ([]byte, error) {
+	return json.Marshal(alertJSON{
+		Peer:        alrt.Peer.Pretty(),
+		Peername:    alrt.Peername,
+		MetricName:  alrt.MetricName,
+		Severity:    string(alrt.Severity),
+		TriggeredAt: alrt.TriggeredAt,
+		MetricTTL:   alrt.MetricTTL.String(),
+		LastValue:   alrt.LastValue,
+		Suppressed:  alrt.Suppressed,
+		Recovered:   alrt.Recovered,
+	})
+}
+
+// WebhookNotifier POSTs a JSON representation of the alerts to an URL.
+type WebhookNotifier struct {
+	URL    string
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a Notifier which sends alerts to the given URL.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		client: &http.Client{},
+	}
+}
+
+// Notify POSTs the alert to the configured URL.
+func (wn *WebhookNotifier) Notify(ctx context.Context, alrt api.Alert) error {
+	body, err := alertToJSON(alrt)
+	if err != nil {
+		return err
+	}
+	return wn.post(ctx, body)
+}
+
+// Post POSTs the JSON representation of any value to the configured URL,
+// so that other events than alerts can be delivered to webhooks.
+func (wn *WebhookNotifier) Post(ctx context.Context, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return wn.post(ctx, body)
+}
+
+func (wn *WebhookNotifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest("POST", wn.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(ctx)
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with %d", wn.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// CommandNotifier runs a command for every alert. The alert is passed
+// as JSON on the standard input of the command, and the CLUSTER_ALERT_PEER,
+// CLUSTER_ALERT_PEERNAME, CLUSTER_ALERT_METRIC, CLUSTER_ALERT_SEVERITY and
+// CLUSTER_ALERT_RECOVERED environment variables are set.
+// It can be used, for example, to send emails.
+type CommandNotifier struct {
+	// Command is the program, followed by its arguments.
+	Command []string
+}
+
+// NewCommandNotifier returns a Notifier which runs the given command:
+// a program followed by its arguments.
+func NewCommandNotifier(command []string) *CommandNotifier {
+	return &CommandNotifier{
+		Command: command,
+	}
+}
+
+// Notify runs the command.
+func (cn *CommandNotifier) Notify(ctx context.Context, alrt api.Alert) error {
+	body, err := alertToJSON(alrt)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, cn.Command[0], cn.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"CLUSTER_ALERT_PEER="+alrt.Peer.Pretty(),
+		"CLUSTER_ALERT_PEERNAME="+alrt.Peername,
+		"CLUSTER_ALERT_METRIC="+alrt.MetricName,
+		"CLUSTER_ALERT_SEVERITY="+string(alrt.Severity),
+		fmt.Sprintf("CLUSTER_ALERT_RECOVERED=%t", alrt.Recovered),
+	)
+	out := &cappedBuffer{max: MaxCommandOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s: %s: %s", cn.Command[0], err, out)
+	}
+	return nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the
+// rest, so that a chatty command cannot use up memory.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (cb *cappedBuffer) Write(p []byte) (int, error) {
+	if room := cb.max - cb.buf.Len(); len(p) > room {
+		if room > 0 {
+			cb.buf.Write(p[:room])
+		}
+		cb.truncated = true
+		return len(p), nil
+	}
+	return cb.buf.Write(p)
+}
+
+func (cb *cappedBuffer) String() string {
+	if cb.truncated {
+		return cb.buf.String() + "... (truncated)"
+	}
+	return cb.buf.String()
+}
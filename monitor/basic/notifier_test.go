@@ -0,0 +1,101 @@
+package basic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+type mockNotifier struct {
+	alerts chan api.Alert
+}
+
+func (mn *mockNotifier) Notify(ctx context.Context, alrt api.Alert) error {
+	mn.alerts <- alrt
+	return nil
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan alertJSON, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a alertJSON
+		json.NewDecoder(r.Body).Decode(&a)
+		received <- a
+	}))
+	defer srv.Close()
+
+	wn := NewWebhookNotifier(srv.URL)
+	err := wn.Notify(context.Background(), api.Alert{
+		Peer:       test.TestPeerID1,
+		MetricName: "ping",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := <-received
+	if a.Peer != test.TestPeerID1.Pretty() || a.MetricName != "ping" {
+		t.Error("webhook received a bad alert")
+	}
+}
+
+func TestCommandNotifier(t *testing.T) {
+	cn := NewCommandNotifier([]string{"sh", "-c", `test "$CLUSTER_ALERT_METRIC" = "$1"`, "sh", "ping"})
+	err := cn.Notify(context.Background(), api.Alert{
+		Peer:       test.TestPeerID1,
+		MetricName: "ping",
+	})
+	if err != nil {
+		t.Fatal("the command should run with its arguments:", err)
+	}
+
+	err = cn.Notify(context.Background(), api.Alert{
+		Peer:       test.TestPeerID1,
+		MetricName: "freespace",
+	})
+	if err == nil {
+		t.Error("expected an error from the command")
+	}
+}
+
+func TestPeerMonitorNotifiers(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+
+	mn := &mockNotifier{make(chan api.Alert, 10)}
+	pm.AddNotifier(mn)
+
+	mtr := newMetric("test", test.TestPeerID1)
+	mtr.SetTTL(0)
+	pm.LogMetric(mtr)
+
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifier should have received an alert by now")
+	case alrt := <-mn.alerts:
+		if alrt.Peer != test.TestPeerID1 {
+			t.Error("Peer should be TestPeerID1")
+		}
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	cb := &cappedBuffer{max: 4}
+	n, err := cb.Write([]byte("abc"))
+	if n != 3 || err != nil {
+		t.Fatal("write should have worked")
+	}
+	n, err = cb.Write([]byte("defg"))
+	if n != 4 || err != nil {
+		t.Fatal("writes past the limit should be discarded without errors")
+	}
+	if cb.String() != "abcd... (truncated)" {
+		t.Error("unexpected output:", cb.String())
+	}
+}
@@ -6,6 +6,7 @@ package basic
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/monitor/util"
 )
 
 var logger = logging.Logger("monitor")
@@ -21,7 +23,8 @@ var logger = logging.Logger("monitor")
 // AlertChannelCap specifies how much buffer the alerts channel has.
 var AlertChannelCap = 256
 
-// WindowCap specifies how many metrics to keep for given host and metric type
+// WindowCap specifies how many metrics to keep for given host and metric
+// type, unless a capacity is configured for the type (see MetricWindow).
 var WindowCap = 100
 
 // peerMetrics is just a circular queue
@@ -73,7 +76,7 @@ func (pmets *peerMetrics) all() []api.Metric {
 	for i := pmets.last; i >= 0; i-- {
 		res = append(res, pmets.window[i])
 	}
-	for i := wlen; i > pmets.last; i-- {
+	for i := wlen - 1; i > pmets.last; i-- {
 		res = append(res, pmets.window[i])
 	}
 	return res
@@ -81,6 +84,20 @@ func (pmets *peerMetrics) all() []api.Metric {
 
 type metricsByPeer map[peer.ID]*peerMetrics
 
+type alertKey struct {
+	peer   peer.ID
+	metric string
+}
+
+// alertState tracks the failed checks and the alerts sent for a
+// peer and metric while the metric stays expired.
+type alertState struct {
+	failures   int
+	lastSent   time.Time
+	sent       int
+	suppressed int
+}
+
 // Monitor is a component in charge of monitoring peers, logging
 // metrics and detecting failures
 type Monitor struct {
@@ -95,6 +112,24 @@ type Monitor struct {
 
 	alerts chan api.Alert
 
+	alertStates    map[alertKey]*alertState
+	alertStatesMux sync.Mutex
+
+	notifiers    []Notifier
+	notifiersMux sync.RWMutex
+	// notifyStopped is set, under notifiersMux, once Shutdown starts
+	// waiting for the notifications in flight.
+	notifyStopped bool
+
+	failedPeers    map[peer.ID]time.Time
+	failedPeersMux sync.RWMutex
+
+	invalidMetrics map[alertKey]int
+	quarantined    map[peer.ID]time.Time
+	quarantineMux  sync.Mutex
+
+	exporter *exporter
+
 	config *Config
 
 	shutdownLock sync.Mutex
@@ -127,9 +162,35 @@ func NewMonitor(cfg *Config) (*Monitor, error) {
 		windowCap: WindowCap,
 		alerts:    make(chan api.Alert, AlertChannelCap),
 
+		alertStates: make(map[alertKey]*alertState),
+		failedPeers: make(map[peer.ID]time.Time),
+
+		invalidMetrics: make(map[alertKey]int),
+		quarantined:    make(map[peer.ID]time.Time),
+
 		config: cfg,
 	}
 
+	if err := mon.loadMetrics(); err != nil {
+		logger.Errorf("error loading persisted metrics: %s", err)
+	}
+
+	if path := cfg.GetExportSocketPath(); path != "" {
+		mon.exporter, err = newExporter(path)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		logger.Infof("exporting metrics on %s", path)
+	}
+
+	for _, u := range cfg.AlertWebhooks {
+		mon.AddNotifier(NewWebhookNotifier(u))
+	}
+	for _, c := range cfg.AlertCommands {
+		mon.AddNotifier(NewCommandNotifier(c))
+	}
+
 	go mon.run()
 	return mon, nil
 }
@@ -162,13 +223,37 @@ func (mon *Monitor) Shutdown() error {
 	logger.Info("stopping Monitor")
 	close(mon.rpcReady)
 	mon.cancel()
+	// No notification may be added to the waitgroup once we wait on it.
+	mon.notifiersMux.Lock()
+	mon.notifyStopped = true
+	mon.notifiersMux.Unlock()
 	mon.wg.Wait()
+	if err := mon.saveMetrics(); err != nil {
+		logger.Errorf("error persisting metrics: %s", err)
+	}
+	if mon.exporter != nil {
+		mon.exporter.close()
+	}
 	mon.shutdown = true
 	return nil
 }
 
-// LogMetric stores a metric so it can later be retrieved.
+// LogMetric stores a metric so it can later be retrieved. The metrics
+// from quarantined peers are stored as invalid, which leaves them out of
+// LastMetrics and therefore of allocations.
 func (mon *Monitor) LogMetric(m api.Metric) {
+	m.Received = time.Now().UnixNano()
+	if mon.checkQuarantine(m) {
+		m.Valid = false
+	}
+	mon.addMetric(m)
+	if mon.exporter != nil {
+		mon.exporter.export(m)
+	}
+	logger.Debugf("logged '%s' metric from '%s'. Expires on %d", m.Name, m.Peer, m.Expire)
+}
+
+func (mon *Monitor) addMetric(m api.Metric) {
 	mon.metricsMux.Lock()
 	defer mon.metricsMux.Unlock()
 	name := m.Name
@@ -180,14 +265,21 @@ func (mon *Monitor) LogMetric(m api.Metric) {
 	}
 	pmets, ok := mbyp[peer]
 	if !ok {
-		pmets = newPeerMetrics(mon.windowCap)
+		pmets = newPeerMetrics(mon.windowCapFor(name))
 		mbyp[peer] = pmets
 	}
-
-	logger.Debugf("logged '%s' metric from '%s'. Expires on %d", name, peer, m.Expire)
 	pmets.add(m)
 }
 
+// windowCapFor returns how many metrics of the given type are kept for
+// every peer.
+func (mon *Monitor) windowCapFor(name string) int {
+	if c := mon.config.MetricWindows[name].Capacity; c > 0 {
+		return c
+	}
+	return mon.windowCap
+}
+
 // func (mon *Monitor) getLastMetric(name string, p peer.ID) api.Metric {
 // 	mon.metricsMux.RLock()
 // 	defer mon.metricsMux.RUnlock()
@@ -216,7 +308,20 @@ func (mon *Monitor) LogMetric(m api.Metric) {
 
 // LastMetrics returns last known VALID metrics of a given type. A metric
 // is only valid if it has not expired and belongs to a current cluster peer.
+// When an aggregation is configured for the metric, the values are
+// aggregated over the metric window (see Aggregate).
 func (mon *Monitor) LastMetrics(name string) []api.Metric {
+	if agg := mon.config.MetricWindows[name].Aggregation; agg != "" {
+		fn, err := parseAggregation(agg)
+		if err == nil {
+			return mon.Aggregate(name, fn)
+		}
+		logger.Error(err)
+	}
+	return mon.lastMetrics(name)
+}
+
+func (mon *Monitor) lastMetrics(name string) []api.Metric {
 	// Ger current list of peers
 	var peers []peer.ID
 	err := mon.rpcClient.Call("",
@@ -243,7 +348,7 @@ func (mon *Monitor) LastMetrics(name string) []api.Metric {
 	// only show metrics for current set of peers
 	for _, peer := range peers {
 		peerMetrics, ok := mbyp[peer]
-		if !ok {
+		if !ok || mon.simulatedFailure(peer) {
 			continue
 		}
 		last, err := peerMetrics.latest()
@@ -257,6 +362,94 @@ func (mon *Monitor) LastMetrics(name string) []api.Metric {
 	return metrics
 }
 
+// LatestMetrics returns the latest metric of the given name received from
+// every peer, including those which are invalid or expired, so that it
+// can be told why a peer has no usable metric.
+func (mon *Monitor) LatestMetrics(name string) []api.Metric {
+	mon.metricsMux.RLock()
+	defer mon.metricsMux.RUnlock()
+
+	metrics := []api.Metric{}
+	for p, peerMetrics := range mon.metrics[name] {
+		if mon.simulatedFailure(p) {
+			continue
+		}
+		if last, err := peerMetrics.latest(); err == nil {
+			metrics = append(metrics, last)
+		}
+	}
+	return metrics
+}
+
+// MetricsSince returns the metrics of the given name that were received from
+// the given peer after the given time and are still in the window. They are
+// ordered from oldest to newest.
+func (mon *Monitor) MetricsSince(name string, p peer.ID, since time.Time) []api.Metric {
+	mon.metricsMux.RLock()
+	defer mon.metricsMux.RUnlock()
+
+	metrics := []api.Metric{}
+	mbyp, ok := mon.metrics[name]
+	if !ok {
+		return metrics
+	}
+	peerMetrics, ok := mbyp[p]
+	if !ok {
+		return metrics
+	}
+
+	sinceNano := since.UnixNano()
+	all := peerMetrics.all() // newest to oldest
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].Received > sinceNano {
+			metrics = append(metrics, all[i])
+		}
+	}
+	return metrics
+}
+
+// PeerMetrics returns the latest valid metric of every type received
+// from the given peer, sorted by name.
+func (mon *Monitor) PeerMetrics(p peer.ID) []api.Metric {
+	mon.metricsMux.RLock()
+	defer mon.metricsMux.RUnlock()
+
+	metrics := []api.Metric{}
+	for _, mbyp := range mon.metrics {
+		peerMetrics, ok := mbyp[p]
+		if !ok {
+			continue
+		}
+		last, err := peerMetrics.latest()
+		if err != nil || last.Discard() {
+			continue
+		}
+		metrics = append(metrics, last)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	return metrics
+}
+
+// FailPeer makes the monitor consider the given peer as failed during the
+// given time: alerts are sent for all its metrics and they are left out of
+// LastMetrics, as if they had expired. It is meant to rehearse failure
+// handling.
+func (mon *Monitor) FailPeer(p peer.ID, d time.Duration) {
+	mon.failedPeersMux.Lock()
+	defer mon.failedPeersMux.Unlock()
+	mon.failedPeers[p] = time.Now().Add(d)
+	logger.Warningf("simulating the failure of %s during %s", p.Pretty(), d)
+}
+
+func (mon *Monitor) simulatedFailure(p peer.ID) bool {
+	mon.failedPeersMux.RLock()
+	defer mon.failedPeersMux.RUnlock()
+	until, ok := mon.failedPeers[p]
+	return ok && time.Now().Before(until)
+}
+
 // Alerts returns a channel on which alerts are sent when the
 // monitor detects a failure.
 func (mon *Monitor) Alerts() <-chan api.Alert {
@@ -288,6 +481,11 @@ func (mon *Monitor) monitor() {
 				logger.Debug("check metrics ", k)
 				mon.checkMetrics(peers, k)
 			}
+			mon.prune(peers)
+			mon.pruneFailedPeers(peers)
+			if err := mon.saveMetrics(); err != nil {
+				logger.Errorf("error persisting metrics: %s", err)
+			}
 		case <-mon.ctx.Done():
 			ticker.Stop()
 			return
@@ -316,22 +514,182 @@ func (mon *Monitor) checkMetrics(peers []peer.ID, metricName string) {
 		if err != nil { // no metrics for this peer
 			continue
 		}
-		// send alert if metric is expired (but was valid at some point)
-		if last.Valid && last.Expired() {
+		// send alert if the peer looks down (and the metric was valid
+		// at some point)
+		if last.Valid && (mon.simulatedFailure(p) || mon.failed(last, pMetrics)) {
 			logger.Debugf("Metric %s from peer %s expired at %s", metricName, p, last.Expire)
-			mon.sendAlert(p, metricName)
+			send, suppressed := mon.shouldAlert(p, metricName)
+			if !send {
+				continue
+			}
+			mon.sendAlert(newAlert(last, suppressed))
+			continue
+		}
+		// send a recovery alert when a valid metric arrives for a
+		// peer which had been alerted.
+		if mon.resetAlerts(p, metricName) && last.Valid {
+			logger.Infof("Metric %s from peer %s is being received again", metricName, p)
+			mon.sendAlert(newRecoveryAlert(last))
+		}
+	}
+}
+
+// failed decides whether a peer is down according to the
+// configured failure detector.
+func (mon *Monitor) failed(last api.Metric, pmets *peerMetrics) bool {
+	if mon.config.FailureDetector == PhiAccrualDetector {
+		all := pmets.all()
+		arrivals := make([]time.Time, 0, len(all))
+		for _, m := range all {
+			arrivals = append(arrivals, time.Unix(0, m.Received))
 		}
+		phi, ok := util.Phi(arrivals, time.Now())
+		if ok {
+			return phi > mon.config.PhiThreshold
+		}
+		// not enough metrics yet
+	}
+	return last.Expired()
+}
+
+// newAlert creates an Alert for an expired metric.
+func newAlert(last api.Metric, suppressed int) api.Alert {
+	severity := api.AlertWarning
+	if last.Name == "ping" {
+		severity = api.AlertCritical
+	}
+
+	var ttl time.Duration
+	if last.Received > 0 {
+		ttl = time.Duration(last.Expire - last.Received)
+	}
+
+	return api.Alert{
+		Peer:        last.Peer,
+		Peername:    last.Peername,
+		MetricName:  last.Name,
+		Severity:    severity,
+		TriggeredAt: time.Now(),
+		MetricTTL:   ttl,
+		LastValue:   last.Value,
+		Suppressed:  suppressed,
+	}
+}
+
+// newRecoveryAlert creates an Alert signaling that a fresh metric has been
+// received for a peer which was previously alerted.
+func newRecoveryAlert(last api.Metric) api.Alert {
+	alrt := newAlert(last, 0)
+	alrt.Recovered = true
+	return alrt
+}
+
+// shouldAlert is called for every check in which a peer appears as failed
+// and decides whether an alert for the given peer and metric can be sent
+// now, according to the FailureThreshold, ReAlertInterval and
+// MaxRepeatedAlerts options. It returns the number of alerts suppressed
+// since the last one was sent.
+func (mon *Monitor) shouldAlert(p peer.ID, metricName string) (bool, int) {
+	mon.alertStatesMux.Lock()
+	defer mon.alertStatesMux.Unlock()
+
+	key := alertKey{p, metricName}
+	st, ok := mon.alertStates[key]
+	if !ok {
+		st = &alertState{}
+		mon.alertStates[key] = st
+	}
+
+	st.failures++
+	if st.failures < mon.config.FailureThreshold {
+		logger.Debugf("%s from %s failed %d consecutive checks", metricName, p, st.failures)
+		return false, 0
+	}
+
+	max := mon.config.MaxRepeatedAlerts
+	if (max > 0 && st.sent >= max) || time.Since(st.lastSent) < mon.config.ReAlertInterval {
+		st.suppressed++
+		return false, 0
+	}
+
+	suppressed := st.suppressed
+	st.lastSent = time.Now()
+	st.sent++
+	st.suppressed = 0
+	return true, suppressed
+}
+
+// resetAlerts forgets the alerts sent for a peer and metric,
+// once the metric is valid again. It returns true when at least
+// one alert had been sent.
+func (mon *Monitor) resetAlerts(p peer.ID, metricName string) bool {
+	mon.alertStatesMux.Lock()
+	defer mon.alertStatesMux.Unlock()
+	key := alertKey{p, metricName}
+	st, ok := mon.alertStates[key]
+	if !ok {
+		return false
 	}
+	delete(mon.alertStates, key)
+	return st.sent > 0
 }
 
-func (mon *Monitor) sendAlert(p peer.ID, metricName string) {
-	alrt := api.Alert{
-		Peer:       p,
-		MetricName: metricName,
+// RaiseAlert sends an alert produced by other components. Like the alerts
+// for expired metrics, it is only sent after FailureThreshold consecutive
+// calls for the same peer and metric, and repeated alerts are suppressed.
+// Recovery alerts are only sent when an alert was sent before.
+func (mon *Monitor) RaiseAlert(alrt api.Alert) {
+	if alrt.Recovered {
+		if mon.resetAlerts(alrt.Peer, alrt.MetricName) {
+			mon.sendAlert(alrt)
+		}
+		return
 	}
+
+	send, suppressed := mon.shouldAlert(alrt.Peer, alrt.MetricName)
+	if !send {
+		return
+	}
+	alrt.Suppressed = suppressed
+	mon.sendAlert(alrt)
+}
+
+func (mon *Monitor) sendAlert(alrt api.Alert) {
 	select {
 	case mon.alerts <- alrt:
 	default:
 		logger.Error("alert channel is full")
 	}
+	mon.notify(alrt)
+}
+
+// AddNotifier registers a Notifier which will be called for every
+// alert produced by this monitor.
+func (mon *Monitor) AddNotifier(n Notifier) {
+	mon.notifiersMux.Lock()
+	defer mon.notifiersMux.Unlock()
+	mon.notifiers = append(mon.notifiers, n)
+}
+
+// notify delivers an alert to all the registered notifiers
+// in the background.
+func (mon *Monitor) notify(alrt api.Alert) {
+	mon.notifiersMux.RLock()
+	defer mon.notifiersMux.RUnlock()
+
+	if mon.notifyStopped {
+		return
+	}
+
+	for _, n := range mon.notifiers {
+		mon.wg.Add(1)
+		go func(n Notifier) {
+			defer mon.wg.Done()
+			ctx, cancel := context.WithTimeout(mon.ctx, NotifyTimeout)
+			defer cancel()
+			if err := n.Notify(ctx, alrt); err != nil {
+				logger.Errorf("error notifying alert: %s", err)
+			}
+		}(n)
+	}
 }
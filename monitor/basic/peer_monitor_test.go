@@ -20,6 +20,7 @@ func testPeerMonitor(t *testing.T) *Monitor {
 	cfg := &Config{}
 	cfg.Default()
 	cfg.CheckInterval = 2 * time.Second
+	cfg.ReAlertInterval = time.Second
 	mon, err := NewMonitor(cfg)
 	if err != nil {
 		t.Fatal(err)
@@ -160,6 +161,161 @@ func TestPeerMonitorLogMetric(t *testing.T) {
 	}
 }
 
+func TestPeerMetricsAll(t *testing.T) {
+	pmets := newPeerMetrics(3)
+	for i := 0; i < 5; i++ {
+		pmets.add(api.Metric{Value: fmt.Sprintf("%d", i)})
+	}
+
+	// the window has wrapped around: last is not the final slot
+	all := pmets.all()
+	if len(all) != 3 {
+		t.Fatalf("expected 3 metrics, got %d", len(all))
+	}
+	for i, v := range []string{"4", "3", "2"} {
+		if all[i].Value != v {
+			t.Errorf("%d: expected metric %s, got %s", i, v, all[i].Value)
+		}
+	}
+}
+
+func TestPeerMonitorWindowCapacity(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+	pm.config.MetricWindows = map[string]MetricWindow{
+		"ping": {Capacity: 2},
+	}
+
+	for i := 0; i < 5; i++ {
+		pm.LogMetric(newMetric("ping", test.TestPeerID1))
+		pm.LogMetric(newMetric("freespace", test.TestPeerID1))
+	}
+
+	if n := len(pm.Window("ping", test.TestPeerID1)); n != 2 {
+		t.Errorf("expected 2 ping metrics to be kept, got %d", n)
+	}
+	if n := len(pm.Window("freespace", test.TestPeerID1)); n != 5 {
+		t.Errorf("expected 5 freespace metrics to be kept, got %d", n)
+	}
+}
+
+func TestPeerMonitorMetricsSince(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+
+	// Fill more than the window to test wrap-around
+	for i := 0; i < WindowCap+10; i++ {
+		pm.LogMetric(newMetric("test", test.TestPeerID1))
+	}
+	start := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	last := newMetric("test", test.TestPeerID1)
+	pm.LogMetric(last)
+
+	all := pm.MetricsSince("test", test.TestPeerID1, time.Time{})
+	if len(all) != WindowCap {
+		t.Fatalf("expected %d metrics but got %d", WindowCap, len(all))
+	}
+	if all[len(all)-1].Value != last.Value {
+		t.Error("last metric should be the newest")
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Received < all[i-1].Received {
+			t.Fatal("metrics should be ordered from oldest to newest")
+		}
+	}
+
+	recent := pm.MetricsSince("test", test.TestPeerID1, start)
+	if len(recent) != 1 || recent[0].Value != last.Value {
+		t.Error("expected only the last metric")
+	}
+
+	if len(pm.MetricsSince("test", test.TestPeerID2, time.Time{})) != 0 {
+		t.Error("expected no metrics for TestPeerID2")
+	}
+}
+
+func TestPeerMonitorPeerMetrics(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+
+	pm.LogMetric(newMetric("b", test.TestPeerID1))
+	pm.LogMetric(newMetric("a", test.TestPeerID1))
+	last := newMetric("a", test.TestPeerID1)
+	pm.LogMetric(last)
+	pm.LogMetric(newMetric("a", test.TestPeerID2))
+	expired := newMetric("c", test.TestPeerID1)
+	expired.SetTTL(0)
+	pm.LogMetric(expired)
+
+	metrics := pm.PeerMetrics(test.TestPeerID1)
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics but got %d", len(metrics))
+	}
+	if metrics[0].Name != "a" || metrics[1].Name != "b" {
+		t.Error("metrics should be sorted by name")
+	}
+	if metrics[0].Value != last.Value {
+		t.Error("expected the latest metric")
+	}
+
+	if len(pm.PeerMetrics(test.TestPeerID3)) != 0 {
+		t.Error("expected no metrics for TestPeerID3")
+	}
+}
+
+func TestPeerMonitorLatestMetrics(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+
+	pm.LogMetric(newMetric("a", test.TestPeerID1))
+	expired := newMetric("a", test.TestPeerID2)
+	expired.SetTTL(0)
+	pm.LogMetric(expired)
+
+	metrics := pm.LatestMetrics("a")
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics but got %d", len(metrics))
+	}
+	for _, m := range metrics {
+		if m.Peer == test.TestPeerID2 && !m.Expired() {
+			t.Error("expected the expired metric")
+		}
+	}
+
+	if len(pm.LatestMetrics("b")) != 0 {
+		t.Error("expected no metrics")
+	}
+}
+
+func TestPeerMonitorFailPeer(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+
+	mtr := newMetric("test", test.TestPeerID1)
+	mtr.SetTTL(60)
+	pm.LogMetric(mtr)
+	pm.FailPeer(test.TestPeerID1, time.Minute)
+
+	if len(pm.LastMetrics("test")) != 0 {
+		t.Error("metrics of failed peers should not be returned")
+	}
+
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("should have thrown an alert by now")
+	case alrt := <-pm.Alerts():
+		if alrt.Peer != test.TestPeerID1 || alrt.Recovered {
+			t.Error("expected an alert for TestPeerID1")
+		}
+	}
+
+	pm.FailPeer(test.TestPeerID1, 0)
+	if len(pm.LastMetrics("test")) != 1 {
+		t.Error("the simulated failure should be over")
+	}
+}
+
 func TestPeerMonitorAlerts(t *testing.T) {
 	pm := testPeerMonitor(t)
 	defer pm.Shutdown()
@@ -182,6 +338,171 @@ func TestPeerMonitorAlerts(t *testing.T) {
 			if alrt.Peer != test.TestPeerID1 {
 				t.Error("Peer should be TestPeerID1")
 			}
+			if alrt.Severity != api.AlertWarning {
+				t.Error("Alert should be a warning")
+			}
+			if alrt.TriggeredAt.IsZero() {
+				t.Error("Alert should have a trigger time")
+			}
+			if alrt.LastValue != mtr.Value {
+				t.Error("Alert should carry the last metric value")
+			}
+		}
+	}
+}
+
+func TestPeerMonitorRecoveryAlerts(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+
+	mtr := newMetric("test", test.TestPeerID1)
+	mtr.SetTTL(0)
+	pm.LogMetric(mtr)
+
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("should have thrown an alert by now")
+	case alrt := <-pm.Alerts():
+		if alrt.Recovered {
+			t.Fatal("first alert should not be a recovery")
+		}
+	}
+
+	pm.LogMetric(newMetric("test", test.TestPeerID1))
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case <-timeout:
+			t.Fatal("should have thrown a recovery alert by now")
+		case alrt := <-pm.Alerts():
+			if !alrt.Recovered {
+				continue // expiry alerts sent before the new metric
+			}
+			if alrt.Peer != test.TestPeerID1 || alrt.MetricName != "test" {
+				t.Error("recovery alert for the wrong peer or metric")
+			}
+			return
+		}
+	}
+}
+
+func TestPeerMonitorFailureThreshold(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+	pm.config.FailureThreshold = 3
+	pm.config.ReAlertInterval = 0
+
+	for i := 0; i < 2; i++ {
+		if send, _ := pm.shouldAlert(test.TestPeerID1, "test"); send {
+			t.Fatal("should not alert before reaching the failure threshold")
+		}
+	}
+	if send, _ := pm.shouldAlert(test.TestPeerID1, "test"); !send {
+		t.Error("should alert once the failure threshold is reached")
+	}
+
+	pm.resetAlerts(test.TestPeerID1, "test")
+	if send, _ := pm.shouldAlert(test.TestPeerID1, "test"); send {
+		t.Error("the failure count should start again after a valid metric")
+	}
+}
+
+func TestPeerMonitorPhiAccrualDetector(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+	pm.config.FailureDetector = PhiAccrualDetector
+
+	pmets := newPeerMetrics(10)
+	now := time.Now()
+	for i := 5; i > 0; i-- {
+		m := newMetric("test", test.TestPeerID1)
+		m.Received = now.Add(-time.Duration(i) * time.Second).UnixNano()
+		m.SetTTL(0)
+		pmets.add(m)
+	}
+	last, _ := pmets.latest()
+
+	if pm.failed(last, pmets) {
+		t.Error("an expired metric which is not late should not fail with phi accrual")
+	}
+
+	pm.config.FailureDetector = TTLDetector
+	if !pm.failed(last, pmets) {
+		t.Error("an expired metric should fail with the ttl detector")
+	}
+}
+
+func TestPeerMonitorAlertSuppression(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+	pm.config.ReAlertInterval = time.Hour
+	pm.config.MaxRepeatedAlerts = 2
+
+	send, _ := pm.shouldAlert(test.TestPeerID1, "test")
+	if !send {
+		t.Fatal("first alert should be sent")
+	}
+
+	send, _ = pm.shouldAlert(test.TestPeerID1, "test")
+	if send {
+		t.Error("alert should be suppressed during the re-alert interval")
+	}
+
+	pm.config.ReAlertInterval = 0
+	send, suppressed := pm.shouldAlert(test.TestPeerID1, "test")
+	if !send || suppressed != 1 {
+		t.Error("second alert should be sent and count one suppressed alert")
+	}
+
+	send, _ = pm.shouldAlert(test.TestPeerID1, "test")
+	if send {
+		t.Error("alerts over max_repeated_alerts should be suppressed")
+	}
+
+	pm.resetAlerts(test.TestPeerID1, "test")
+	send, _ = pm.shouldAlert(test.TestPeerID1, "test")
+	if !send {
+		t.Error("alerts should be sent again after the peer recovers")
+	}
+}
+
+func TestPeerMonitorRaiseAlert(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+
+	alrt := api.Alert{
+		Peer:       test.TestPeerID1,
+		MetricName: "external",
+		Severity:   api.AlertWarning,
+	}
+
+	recovered := alrt
+	recovered.Recovered = true
+	pm.RaiseAlert(recovered)
+	select {
+	case <-pm.Alerts():
+		t.Fatal("recovery alerts should not be sent for peers which were not alerted")
+	default:
+	}
+
+	pm.RaiseAlert(alrt)
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("should have thrown an alert by now")
+	case a := <-pm.Alerts():
+		if a.MetricName != "external" || a.Recovered {
+			t.Error("unexpected alert")
+		}
+	}
+
+	pm.RaiseAlert(recovered)
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("should have thrown a recovery alert by now")
+	case a := <-pm.Alerts():
+		if !a.Recovered {
+			t.Error("expected a recovery alert")
 		}
 	}
 }
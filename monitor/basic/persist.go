@@ -0,0 +1,78 @@
+package basic
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// loadMetrics restores the metrics persisted in the MetricsFile. Metrics
+// which have expired in the meantime are discarded.
+func (mon *Monitor) loadMetrics() error {
+	path := mon.config.GetMetricsPath()
+	if path == "" {
+		return nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var serials []api.MetricSerial
+	err = json.Unmarshal(raw, &serials)
+	if err != nil {
+		return err
+	}
+
+	loaded := 0
+	for _, ms := range serials {
+		m := ms.ToMetric()
+		if m.Expired() {
+			continue
+		}
+		mon.addMetric(m)
+		loaded++
+	}
+	logger.Infof("loaded %d persisted metrics from %s", loaded, path)
+	return nil
+}
+
+// saveMetrics writes the last metric of every type received from every
+// peer to the MetricsFile. The file is replaced atomically.
+func (mon *Monitor) saveMetrics() error {
+	path := mon.config.GetMetricsPath()
+	if path == "" {
+		return nil
+	}
+
+	mon.metricsMux.RLock()
+	serials := []api.MetricSerial{}
+	for _, mbyp := range mon.metrics {
+		for _, pmets := range mbyp {
+			last, err := pmets.latest()
+			if err != nil || last.Expired() {
+				continue
+			}
+			serials = append(serials, last.ToSerial())
+		}
+	}
+	mon.metricsMux.RUnlock()
+
+	raw, err := json.Marshal(serials)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, raw, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,50 @@
+package basic
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestPeerMonitorPersistMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monbasic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pm := testPeerMonitor(t)
+	pm.config.BaseDir = dir
+	pm.config.MetricsFile = "metrics"
+
+	mtr := newMetric("test", test.TestPeerID1)
+	pm.LogMetric(mtr)
+	expired := newMetric("test", test.TestPeerID2)
+	expired.SetTTL(0)
+	pm.LogMetric(expired)
+	pm.Shutdown()
+
+	pm2 := testPeerMonitor(t)
+	defer pm2.Shutdown()
+	pm2.config.BaseDir = dir
+	pm2.config.MetricsFile = "metrics"
+	err = pm2.loadMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := pm2.MetricsSince("test", test.TestPeerID1, time.Time{})
+	if len(metrics) != 1 || metrics[0].Value != mtr.Value {
+		t.Fatal("metric should have been restored")
+	}
+	if metrics[0].Received == 0 {
+		t.Error("restored metric should keep the time it was received")
+	}
+
+	if len(pm2.MetricsSince("test", test.TestPeerID2, time.Time{})) != 0 {
+		t.Error("expired metrics should not be restored")
+	}
+}
@@ -0,0 +1,103 @@
+package basic
+
+import (
+	"sort"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// prune evicts stored metrics so that memory usage stays bounded when
+// peers come and go. The metrics of peers which are not part of the
+// given peerset are removed once their last metric has expired (peers
+// which just joined may send metrics before they are in the peerset).
+// Then, when MaxPeersPerMetric is set, the peers whose last metric is
+// the oldest are evicted until the limit is respected. It returns the
+// number of evicted entries.
+func (mon *Monitor) prune(peers []peer.ID) int {
+	current := make(map[peer.ID]struct{}, len(peers))
+	for _, p := range peers {
+		current[p] = struct{}{}
+	}
+
+	mon.metricsMux.Lock()
+	defer mon.metricsMux.Unlock()
+
+	var evicted []alertKey
+	for name, mbyp := range mon.metrics {
+		for p, pmets := range mbyp {
+			if _, ok := current[p]; ok {
+				continue
+			}
+			last, err := pmets.latest()
+			if err == nil && !last.Expired() {
+				continue
+			}
+			delete(mbyp, p)
+			evicted = append(evicted, alertKey{p, name})
+		}
+
+		max := mon.config.MaxPeersPerMetric
+		if max > 0 && len(mbyp) > max {
+			evicted = append(evicted, evictOldest(name, mbyp, len(mbyp)-max)...)
+		}
+
+		if len(mbyp) == 0 {
+			delete(mon.metrics, name)
+		}
+	}
+
+	if len(evicted) > 0 {
+		mon.alertStatesMux.Lock()
+		for _, key := range evicted {
+			delete(mon.alertStates, key)
+		}
+		mon.alertStatesMux.Unlock()
+		logger.Debugf("pruned %d metric entries", len(evicted))
+	}
+	return len(evicted)
+}
+
+// evictOldest removes the n peers whose last metric was received the
+// longest time ago.
+func evictOldest(name string, mbyp metricsByPeer, n int) []alertKey {
+	type entry struct {
+		peer     peer.ID
+		received int64
+	}
+
+	entries := make([]entry, 0, len(mbyp))
+	for p, pmets := range mbyp {
+		last, _ := pmets.latest()
+		entries = append(entries, entry{p, last.Received})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].received < entries[j].received
+	})
+
+	evicted := make([]alertKey, 0, n)
+	for _, e := range entries[:n] {
+		delete(mbyp, e.peer)
+		evicted = append(evicted, alertKey{e.peer, name})
+	}
+	return evicted
+}
+
+// pruneFailedPeers forgets the simulated failures which are over and
+// those of peers which are no longer part of the given peerset.
+func (mon *Monitor) pruneFailedPeers(peers []peer.ID) {
+	current := make(map[peer.ID]struct{}, len(peers))
+	for _, p := range peers {
+		current[p] = struct{}{}
+	}
+
+	now := time.Now()
+	mon.failedPeersMux.Lock()
+	defer mon.failedPeersMux.Unlock()
+	for p, until := range mon.failedPeers {
+		_, ok := current[p]
+		if !ok || !now.Before(until) {
+			delete(mon.failedPeers, p)
+		}
+	}
+}
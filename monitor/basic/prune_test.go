@@ -0,0 +1,74 @@
+package basic
+
+import (
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestPeerMonitorPrune(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+
+	expired := newMetric("test", test.TestPeerID3)
+	expired.SetTTL(0)
+	pm.LogMetric(expired)
+	pm.LogMetric(newMetric("test", test.TestPeerID2))
+	pm.LogMetric(newMetric("test", test.TestPeerID1))
+
+	peers := []peer.ID{test.TestPeerID1}
+	if n := pm.prune(peers); n != 1 {
+		t.Fatalf("expected 1 evicted entry but got %d", n)
+	}
+	if len(pm.MetricsSince("test", test.TestPeerID3, time.Time{})) != 0 {
+		t.Error("expired metrics of departed peers should be evicted")
+	}
+	if len(pm.MetricsSince("test", test.TestPeerID2, time.Time{})) == 0 {
+		t.Error("valid metrics of peers not in the peerset should be kept")
+	}
+
+	pm.config.MaxPeersPerMetric = 1
+	if n := pm.prune(peers); n != 1 {
+		t.Fatalf("expected 1 evicted entry but got %d", n)
+	}
+	if len(pm.MetricsSince("test", test.TestPeerID2, time.Time{})) != 0 {
+		t.Error("the oldest entry should have been evicted")
+	}
+	if len(pm.MetricsSince("test", test.TestPeerID1, time.Time{})) == 0 {
+		t.Error("the newest entry should have been kept")
+	}
+
+	pm.config.MaxPeersPerMetric = 0
+	expired = newMetric("other", test.TestPeerID2)
+	expired.SetTTL(0)
+	pm.LogMetric(expired)
+	pm.prune(peers)
+	pm.metricsMux.RLock()
+	_, ok := pm.metrics["other"]
+	pm.metricsMux.RUnlock()
+	if ok {
+		t.Error("metric types without entries should be removed")
+	}
+}
+
+func TestPeerMonitorPruneFailedPeers(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+
+	pm.FailPeer(test.TestPeerID1, time.Minute)
+	pm.FailPeer(test.TestPeerID2, 0)
+	pm.FailPeer(test.TestPeerID3, time.Minute)
+
+	pm.pruneFailedPeers([]peer.ID{test.TestPeerID1, test.TestPeerID2})
+	pm.failedPeersMux.RLock()
+	defer pm.failedPeersMux.RUnlock()
+	if len(pm.failedPeers) != 1 {
+		t.Fatalf("expected 1 failed peer but got %d", len(pm.failedPeers))
+	}
+	if _, ok := pm.failedPeers[test.TestPeerID1]; !ok {
+		t.Error("ongoing failures of current peers should be kept")
+	}
+}
@@ -0,0 +1,129 @@
+package basic
+
+import (
+	"errors"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// QuarantineMetricName is the metric name used in the alerts sent when a
+// peer is quarantined, and in the recovery alerts sent when it is
+// released.
+const QuarantineMetricName = "quarantine"
+
+// MaxMetricTTL is the longest time a received metric may be valid for.
+// Metrics expiring later are considered invalid, as they usually come
+// from peers with a wrong clock.
+var MaxMetricTTL = 24 * time.Hour
+
+// validateMetric checks that a received metric can be trusted. The
+// signature is verified before the metric reaches the Monitor. Signature
+// failures are not counted here since the peer in a forged metric is
+// not the one sending it. Metrics marked as invalid by their peer are
+// not checked: they report a failure, such as an IPFS daemon which is
+// down, rather than a peer which cannot be trusted.
+func validateMetric(m api.Metric) error {
+	if m.Expire <= m.Received {
+		return errors.New("metric expired before it was received")
+	}
+	if time.Duration(m.Expire-m.Received) > MaxMetricTTL {
+		return errors.New("metric expires too far in the future")
+	}
+	return nil
+}
+
+// checkQuarantine validates a received metric and returns whether the
+// metrics from its peer are quarantined. A peer is quarantined after
+// QuarantineThreshold consecutive invalid metrics of the same type and
+// stays so until Unquarantine is called, even if its metrics become
+// valid again. Metrics marked as invalid by their peer neither count nor
+// reset the invalid metrics.
+func (mon *Monitor) checkQuarantine(m api.Metric) bool {
+	if mon.config.QuarantineThreshold <= 0 {
+		return false
+	}
+
+	mon.quarantineMux.Lock()
+	if _, ok := mon.quarantined[m.Peer]; ok {
+		mon.quarantineMux.Unlock()
+		return true
+	}
+	if !m.Valid {
+		mon.quarantineMux.Unlock()
+		return false
+	}
+
+	key := alertKey{m.Peer, m.Name}
+	err := validateMetric(m)
+	if err == nil {
+		delete(mon.invalidMetrics, key)
+		mon.quarantineMux.Unlock()
+		return false
+	}
+
+	mon.invalidMetrics[key]++
+	n := mon.invalidMetrics[key]
+	if n < mon.config.QuarantineThreshold {
+		mon.quarantineMux.Unlock()
+		logger.Debugf("invalid %s metric from %s (%d): %s", m.Name, m.Peer.Pretty(), n, err)
+		return false
+	}
+	mon.forgetInvalidMetrics(m.Peer)
+	mon.quarantined[m.Peer] = time.Now()
+	mon.quarantineMux.Unlock()
+
+	logger.Warningf("quarantining the metrics from %s after %d invalid %s metrics: %s", m.Peer.Pretty(), n, m.Name, err)
+	mon.sendAlert(api.Alert{
+		Peer:        m.Peer,
+		Peername:    m.Peername,
+		MetricName:  QuarantineMetricName,
+		Severity:    api.AlertWarning,
+		TriggeredAt: time.Now(),
+		LastValue:   err.Error(),
+	})
+	return true
+}
+
+// Quarantined returns whether the metrics from the given peer are
+// quarantined.
+func (mon *Monitor) Quarantined(p peer.ID) bool {
+	mon.quarantineMux.Lock()
+	defer mon.quarantineMux.Unlock()
+	_, ok := mon.quarantined[p]
+	return ok
+}
+
+// Unquarantine accepts again the metrics from a quarantined peer. A
+// recovery alert is sent when the peer was quarantined.
+func (mon *Monitor) Unquarantine(p peer.ID) {
+	mon.quarantineMux.Lock()
+	_, ok := mon.quarantined[p]
+	delete(mon.quarantined, p)
+	mon.forgetInvalidMetrics(p)
+	mon.quarantineMux.Unlock()
+
+	if !ok {
+		return
+	}
+	logger.Infof("accepting the metrics from %s again", p.Pretty())
+	mon.sendAlert(api.Alert{
+		Peer:        p,
+		MetricName:  QuarantineMetricName,
+		Severity:    api.AlertWarning,
+		TriggeredAt: time.Now(),
+		Recovered:   true,
+	})
+}
+
+// forgetInvalidMetrics resets the invalid metric counts of a peer. It must
+// be called with quarantineMux held.
+func (mon *Monitor) forgetInvalidMetrics(p peer.ID) {
+	for key := range mon.invalidMetrics {
+		if key.peer == p {
+			delete(mon.invalidMetrics, key)
+		}
+	}
+}
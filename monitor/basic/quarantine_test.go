@@ -0,0 +1,98 @@
+package basic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestValidateMetric(t *testing.T) {
+	m := newMetric("test", test.TestPeerID1)
+	m.Received = time.Now().UnixNano()
+	if err := validateMetric(m); err != nil {
+		t.Error("metric should be valid: ", err)
+	}
+
+	expired := m
+	expired.Expire = m.Received - 1
+	if validateMetric(expired) == nil {
+		t.Error("expired metrics should not be valid")
+	}
+
+	future := m
+	future.SetTTLDuration(MaxMetricTTL + time.Hour)
+	if validateMetric(future) == nil {
+		t.Error("metrics expiring too late should not be valid")
+	}
+}
+
+func TestPeerMonitorQuarantine(t *testing.T) {
+	pm := testPeerMonitor(t)
+	defer pm.Shutdown()
+	pm.config.QuarantineThreshold = 2
+
+	expired := func() api.Metric {
+		m := newMetric("test", test.TestPeerID1)
+		m.Expire = time.Now().Add(-time.Minute).UnixNano()
+		return m
+	}
+
+	pm.LogMetric(expired())
+	pm.LogMetric(newMetric("test", test.TestPeerID1))
+	pm.LogMetric(expired())
+	if pm.Quarantined(test.TestPeerID1) {
+		t.Fatal("only consecutive invalid metrics should quarantine a peer")
+	}
+
+	// neither valid metrics of other types nor metrics marked as
+	// invalid by the peer reset or add to the count.
+	pm.LogMetric(newMetric("other", test.TestPeerID1))
+	for i := 0; i < 3; i++ {
+		down := newMetric("test", test.TestPeerID1)
+		down.Valid = false
+		pm.LogMetric(down)
+	}
+	if pm.Quarantined(test.TestPeerID1) {
+		t.Fatal("metrics marked as invalid should not quarantine a peer")
+	}
+
+	pm.LogMetric(expired())
+	if !pm.Quarantined(test.TestPeerID1) {
+		t.Fatal("peer should be quarantined")
+	}
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("should have thrown an alert by now")
+	case a := <-pm.Alerts():
+		if a.MetricName != QuarantineMetricName || a.Peer != test.TestPeerID1 || a.Recovered {
+			t.Error("unexpected alert")
+		}
+	}
+
+	pm.LogMetric(newMetric("test", test.TestPeerID1))
+	pm.LogMetric(newMetric("test", test.TestPeerID2))
+	lastMetrics := pm.LastMetrics("test")
+	if len(lastMetrics) != 1 || lastMetrics[0].Peer != test.TestPeerID2 {
+		t.Error("metrics from the quarantined peer should be left out")
+	}
+
+	pm.Unquarantine(test.TestPeerID1)
+	if pm.Quarantined(test.TestPeerID1) {
+		t.Fatal("peer should not be quarantined")
+	}
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("should have thrown a recovery alert by now")
+	case a := <-pm.Alerts():
+		if a.MetricName != QuarantineMetricName || !a.Recovered {
+			t.Error("expected a recovery alert")
+		}
+	}
+
+	pm.LogMetric(newMetric("test", test.TestPeerID1))
+	if len(pm.LastMetrics("test")) != 2 {
+		t.Error("metrics from the released peer should be used again")
+	}
+}
@@ -0,0 +1,85 @@
+// Package util is a utility package used by the peer monitor
+// implementations. This package provides the Phi function, an
+// implementation of the phi-accrual failure detector, which may be used
+// to decide when a peer should be considered down based on the arrival
+// times of its metrics.
+package util
+
+import (
+	"math"
+	"time"
+)
+
+// MinSamples is the minimum number of arrival times needed by Phi.
+const MinSamples = 3
+
+// MinStdDevRatio bounds the standard deviation of the arrival intervals
+// to this fraction of their mean, so that peers sending metrics with a very
+// regular period are not suspected as soon as one arrives a little late.
+var MinStdDevRatio = 0.1
+
+// Phi returns the suspicion level that a peer is down, given the times
+// at which its metrics arrived (in any order) and the current time. It
+// assumes the intervals between arrivals follow a normal distribution.
+// A phi of 1 means a 10% chance of being wrong when suspecting the
+// peer, 2 a 1% chance, 3 a 0.1% chance and so on.
+// The second value is false when there are less than MinSamples arrival
+// times.
+func Phi(arrivals []time.Time, now time.Time) (float64, bool) {
+	if len(arrivals) < MinSamples {
+		return 0, false
+	}
+
+	last := arrivals[0]
+	first := arrivals[0]
+	for _, a := range arrivals[1:] {
+		if a.After(last) {
+			last = a
+		}
+		if a.Before(first) {
+			first = a
+		}
+	}
+
+	n := float64(len(arrivals) - 1)
+	mean := float64(last.Sub(first)) / n
+	if mean <= 0 {
+		return 0, false
+	}
+
+	sorted := sortedTimes(arrivals)
+	var variance float64
+	for i := 1; i < len(sorted); i++ {
+		d := float64(sorted[i].Sub(sorted[i-1])) - mean
+		variance += d * d
+	}
+	stdDev := math.Sqrt(variance / n)
+	if min := mean * MinStdDevRatio; stdDev < min {
+		stdDev = min
+	}
+
+	elapsed := float64(now.Sub(last))
+	return phi(elapsed, mean, stdDev), true
+}
+
+// phi uses the logistic approximation of the normal cumulative
+// distribution function.
+func phi(elapsed, mean, stdDev float64) float64 {
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1.0 + e))
+	}
+	return -math.Log10(1.0 - 1.0/(1.0+e))
+}
+
+func sortedTimes(times []time.Time) []time.Time {
+	sorted := append([]time.Time{}, times...)
+	// insertion sort: arrivals are usually almost sorted
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j].Before(sorted[j-1]); j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+	return sorted
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func arrivals(n int, interval time.Duration, end time.Time) []time.Time {
+	as := make([]time.Time, n)
+	for i := range as {
+		as[i] = end.Add(-time.Duration(n-1-i) * interval)
+	}
+	return as
+}
+
+func TestPhi(t *testing.T) {
+	now := time.Now()
+	as := arrivals(10, time.Second, now)
+
+	if _, ok := Phi(as[:2], now); ok {
+		t.Error("phi should need at least MinSamples arrivals")
+	}
+
+	onTime, ok := Phi(as, now.Add(time.Second))
+	if !ok {
+		t.Fatal("phi should be computed")
+	}
+	late, _ := Phi(as, now.Add(2*time.Second))
+	veryLate, _ := Phi(as, now.Add(10*time.Second))
+
+	if onTime >= 1 {
+		t.Error("a metric arriving on time should not be suspected: ", onTime)
+	}
+	if !(onTime < late && late < veryLate) {
+		t.Error("phi should grow with the time since the last arrival")
+	}
+	if veryLate < 8 {
+		t.Error("a peer missing many intervals should be suspected: ", veryLate)
+	}
+}
+
+func TestPhiUnsorted(t *testing.T) {
+	now := time.Now()
+	as := arrivals(5, time.Second, now)
+	reversed := []time.Time{as[4], as[3], as[2], as[1], as[0]}
+
+	p1, _ := Phi(as, now.Add(3*time.Second))
+	p2, _ := Phi(reversed, now.Add(3*time.Second))
+	if p1 != p2 {
+		t.Error("the order of the arrivals should not matter")
+	}
+}
@@ -0,0 +1,376 @@
+package ipfscluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// The partition harness runs clusters on a mock libp2p network, in which
+// the links between peers can be cut, delayed and restored, and in which
+// peers can crash. Tests pin items while injecting failures and then
+// check that every peer converges to the same pinset and that no pin
+// which was reported as committed is lost.
+
+// convergenceTimeout is how long peers have to agree on the pinset once
+// the network is healed.
+var convergenceTimeout = 30 * time.Second
+
+type partitionHarness struct {
+	t        *testing.T
+	mn       mocknet.Mocknet
+	clusters []*Cluster
+	mocks    []*test.IpfsMock
+
+	mu        sync.Mutex
+	crashed   map[int]bool
+	committed map[string]bool // items for which Pin returned no error
+}
+
+func newPartitionHarness(t *testing.T, n int) *partitionHarness {
+	os.RemoveAll("./e2eTestRaft")
+	h := &partitionHarness{
+		t:         t,
+		mn:        mocknet.New(context.Background()),
+		clusters:  make([]*Cluster, n, n),
+		mocks:     make([]*test.IpfsMock, n, n),
+		crashed:   make(map[int]bool),
+		committed: make(map[string]bool),
+	}
+
+	newHost := func(cfg *Config) (host.Host, error) {
+		addr, _ := ma.NewMultiaddr(fmt.Sprintf("/ip4/10.0.0.%d/tcp/9096", len(h.mn.Peers())+1))
+		return h.mn.AddPeer(cfg.PrivateKey, addr)
+	}
+
+	hosts := make([]host.Host, n, n)
+	starts := make([]func() *Cluster, n, n)
+	for i := 0; i < n; i++ {
+		hst, clusterCfg, raftCon, apiComp, ipfs, state, tracker, mon, alloc, inf, mock := createComponentsWithHost(t, i, testingClusterSecret, i != 0, newHost)
+		hosts[i] = hst
+		h.mocks[i] = mock
+		starts[i] = func() *Cluster {
+			return createCluster(t, hst, clusterCfg, raftCon, apiComp, ipfs, state, tracker, mon, alloc, inf)
+		}
+	}
+
+	checkErr(t, h.mn.LinkAll())
+	checkErr(t, h.mn.ConnectAllButSelf())
+
+	h.clusters[0] = starts[0]()
+	<-h.clusters[0].Ready()
+	bootstrap := api.MustLibp2pMultiaddrJoin(hosts[0].Addrs()[0], hosts[0].ID())
+	for i := 1; i < n; i++ {
+		h.clusters[i] = starts[i]()
+		checkErr(t, h.clusters[i].Join(bootstrap))
+		<-h.clusters[i].Ready()
+	}
+	waitForLeader(t, h.clusters)
+	return h
+}
+
+func (h *partitionHarness) shutdown() {
+	for i, cl := range h.clusters {
+		if !h.isCrashed(i) {
+			cl.Shutdown()
+		}
+		h.mocks[i].Close()
+	}
+	h.mn.Close()
+	os.RemoveAll("./e2eTestRaft")
+}
+
+func (h *partitionHarness) isCrashed(i int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.crashed[i]
+}
+
+func (h *partitionHarness) live() []*Cluster {
+	var live []*Cluster
+	for i, cl := range h.clusters {
+		if !h.isCrashed(i) {
+			live = append(live, cl)
+		}
+	}
+	return live
+}
+
+// cut removes the links between two peers and closes their connections.
+func (h *partitionHarness) cut(i, j int) {
+	a, b := h.clusters[i].id, h.clusters[j].id
+	h.mn.UnlinkPeers(a, b)
+	h.mn.DisconnectPeers(a, b)
+}
+
+// link restores the link between two peers and connects them.
+func (h *partitionHarness) link(i, j int) {
+	a, b := h.clusters[i].id, h.clusters[j].id
+	if len(h.mn.LinksBetweenPeers(a, b)) == 0 {
+		h.mn.LinkPeers(a, b)
+	}
+	h.mn.ConnectPeers(a, b)
+}
+
+// partition cuts all the links between peers in different groups. Peers
+// which are not part of any group are isolated.
+func (h *partitionHarness) partition(groups ...[]int) {
+	group := make(map[int]int)
+	for g, members := range groups {
+		for _, i := range members {
+			group[i] = g + 1
+		}
+	}
+	for i := range h.clusters {
+		for j := i + 1; j < len(h.clusters); j++ {
+			if group[i] == 0 || group[i] != group[j] {
+				h.cut(i, j)
+			}
+		}
+	}
+}
+
+// heal links every pair of live peers again.
+func (h *partitionHarness) heal() {
+	for i := range h.clusters {
+		for j := i + 1; j < len(h.clusters); j++ {
+			if !h.isCrashed(i) && !h.isCrashed(j) {
+				h.link(i, j)
+			}
+		}
+	}
+}
+
+// setLatency delays the messages on every existing and future link.
+func (h *partitionHarness) setLatency(d time.Duration) {
+	opts := mocknet.LinkOptions{Latency: d}
+	h.mn.SetLinkDefaults(opts)
+	for _, a := range h.mn.Peers() {
+		for _, b := range h.mn.Peers() {
+			for _, l := range h.mn.LinksBetweenPeers(a, b) {
+				l.SetOptions(opts)
+			}
+		}
+	}
+}
+
+// crash isolates a peer and shuts it down without letting it leave the
+// cluster.
+func (h *partitionHarness) crash(i int) {
+	for j := range h.clusters {
+		if j != i {
+			h.cut(i, j)
+		}
+	}
+	h.mu.Lock()
+	h.crashed[i] = true
+	h.mu.Unlock()
+	h.clusters[i].Shutdown()
+}
+
+// leader returns the index of the peer which the i-th peer sees as
+// leader, or -1.
+func (h *partitionHarness) leader(i int) int {
+	pid, err := h.clusters[i].consensus.Leader()
+	if err != nil {
+		return -1
+	}
+	return h.index(pid)
+}
+
+func (h *partitionHarness) index(pid peer.ID) int {
+	for i, cl := range h.clusters {
+		if cl.id == pid {
+			return i
+		}
+	}
+	return -1
+}
+
+// pin pins a random item through the i-th peer and remembers it as
+// committed when no error is returned.
+func (h *partitionHarness) pin(i int) (*cid.Cid, error) {
+	exampleCid, _ := cid.Decode(test.TestCid1)
+	c, err := exampleCid.Prefix().Sum(randomBytes())
+	checkErr(h.t, err)
+	err = h.clusters[i].Pin(api.PinCid(c))
+	if err == nil {
+		h.mu.Lock()
+		h.committed[c.String()] = true
+		h.mu.Unlock()
+	}
+	return c, err
+}
+
+func (h *partitionHarness) pinset(cl *Cluster) []string {
+	st, err := cl.consensus.State()
+	if err != nil {
+		return nil
+	}
+	var cids []string
+	for _, p := range st.List() {
+		cids = append(cids, p.Cid.String())
+	}
+	sort.Strings(cids)
+	return cids
+}
+
+// assertConverged waits until all live peers have the same pinset and
+// checks that it includes every committed item.
+func (h *partitionHarness) assertConverged() {
+	live := h.live()
+	deadline := time.Now().Add(convergenceTimeout)
+	var pinsets [][]string
+	for {
+		pinsets = pinsets[:0]
+		agree := true
+		for _, cl := range live {
+			ps := h.pinset(cl)
+			pinsets = append(pinsets, ps)
+			if strings.Join(ps, ",") != strings.Join(pinsets[0], ",") {
+				agree = false
+			}
+		}
+		if agree {
+			break
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatal("peers did not converge to the same pinset")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	pinned := make(map[string]bool)
+	for _, c := range pinsets[0] {
+		pinned[c] = true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.committed {
+		if !pinned[c] {
+			h.t.Errorf("committed pin %s was lost", c)
+		}
+	}
+}
+
+func TestPartitionMinority(t *testing.T) {
+	h := newPartitionHarness(t, 5)
+	defer h.shutdown()
+
+	h.partition([]int{0, 1, 2}, []int{3, 4})
+	time.Sleep(time.Second) // let the majority elect a leader if needed
+	waitForLeader(t, h.clusters[0:3])
+
+	for i := 0; i < 10; i++ {
+		if _, err := h.pin(i % 3); err != nil {
+			t.Errorf("pinning in the majority failed: %s", err)
+		}
+	}
+	// these may fail, but must not be lost when they do not
+	h.pin(3)
+	h.pin(4)
+
+	h.heal()
+	waitForLeader(t, h.clusters)
+	h.assertConverged()
+}
+
+func TestPartitionLeaderIsolated(t *testing.T) {
+	h := newPartitionHarness(t, 5)
+	defer h.shutdown()
+
+	for i := 0; i < 5; i++ {
+		h.pin(i)
+	}
+
+	l := h.leader(0)
+	if l < 0 {
+		t.Fatal("no leader")
+	}
+	var others []int
+	for i := range h.clusters {
+		if i != l {
+			others = append(others, i)
+		}
+	}
+	h.partition(others)
+	time.Sleep(time.Second) // let a new leader be elected
+
+	for _, i := range others {
+		if _, err := h.pin(i); err != nil {
+			t.Errorf("pinning after the leader was isolated failed: %s", err)
+		}
+	}
+	h.pin(l) // the old leader cannot commit on its own
+
+	h.heal()
+	waitForLeader(t, h.clusters)
+	h.assertConverged()
+}
+
+func TestPartitionCrashes(t *testing.T) {
+	h := newPartitionHarness(t, 5)
+	defer h.shutdown()
+
+	for i := 0; i < 5; i++ {
+		h.pin(i)
+	}
+
+	l := h.leader(0)
+	if l < 0 {
+		t.Fatal("no leader")
+	}
+	h.crash(l)
+	h.crash((l + 1) % 5)
+	time.Sleep(time.Second) // let a new leader be elected
+	waitForLeader(t, h.live())
+
+	for i := range h.clusters {
+		if h.isCrashed(i) {
+			continue
+		}
+		if _, err := h.pin(i); err != nil {
+			t.Errorf("pinning after two crashes failed: %s", err)
+		}
+	}
+	h.assertConverged()
+}
+
+func TestPartitionLatency(t *testing.T) {
+	h := newPartitionHarness(t, 3)
+	defer h.shutdown()
+
+	h.setLatency(20 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if _, err := h.pin(i); err != nil {
+					t.Errorf("pinning with latency failed: %s", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	h.cut(0, 1)
+	h.pin(2)
+	h.heal()
+	h.assertConverged()
+}
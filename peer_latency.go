@@ -0,0 +1,76 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// PeerLatencies pings every other cluster peer over libp2p and returns
+// the round-trip times. Every ping is abandoned after the given timeout,
+// when not 0, or when the context is cancelled, in which case the peers
+// which did not answer are returned with an error.
+func (c *Cluster) PeerLatencies(ctx context.Context, timeout time.Duration) ([]api.PeerLatency, error) {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []peer.ID
+	for _, p := range members {
+		if p != c.id {
+			peers = append(peers, p)
+		}
+	}
+
+	latencies := make([]api.PeerLatency, len(peers), len(peers))
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		c.acquireBroadcastSlot()
+		wg.Add(1)
+		go func(i int, p peer.ID) {
+			defer wg.Done()
+			defer c.releaseBroadcastSlot()
+			latencies[i].Peer = p
+			pingCtx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				pingCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			rtt, err := c.pingPeer(pingCtx, p)
+			if err != nil {
+				latencies[i].Error = err.Error()
+				return
+			}
+			latencies[i].RTT = rtt
+		}(i, p)
+	}
+	wg.Wait()
+	return latencies, nil
+}
+
+// pingPeer returns the round-trip time of a single libp2p ping.
+func (c *Cluster) pingPeer(ctx context.Context, p peer.ID) (time.Duration, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops pinging
+
+	ch, err := c.pinger.Ping(ctx, p)
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case rtt, ok := <-ch:
+		if !ok {
+			return 0, errors.New("ping failed")
+		}
+		return rtt, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
@@ -0,0 +1,75 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// freeSpaceMetricName is the name of the metric broadcasted by the disk
+// informer (informer/disk) with the free space of a peer.
+const freeSpaceMetricName = "freespace"
+
+// PinEstimate returns the size of the DAG under the Cid of the given pin,
+// the space that pinning it with the given options would use in the
+// cluster and whether it can be allocated to enough peers with enough
+// free space. Nothing is pinned. Peers without a free space metric are
+// assumed to have enough space.
+func (c *Cluster) PinEstimate(ctx context.Context, pin api.Pin) (api.PinEstimate, error) {
+	if pin.Cid == nil {
+		return api.PinEstimate{}, errors.New("bad pin object")
+	}
+	est := api.PinEstimate{
+		Cid:         pin.Cid.String(),
+		Allocations: []string{},
+	}
+
+	sizer, ok := c.ipfs.(DAGSizer)
+	if !ok {
+		return est, errors.New("the IPFS connector cannot tell the size of a DAG")
+	}
+	size, err := sizer.DAGSize(ctx, pin.Cid)
+	if err != nil {
+		return est, err
+	}
+	est.Size = size
+
+	preview, err := c.AllocationPreview(pin)
+	if err != nil {
+		est.Reason = err.Error()
+		return est, nil
+	}
+	est.Allocations = api.PeersToStrings(preview.Allocations)
+
+	peers := preview.Allocations
+	if len(peers) == 0 { // pinned everywhere
+		peers, err = c.consensus.Peers()
+		if err != nil {
+			return est, err
+		}
+	}
+	est.Replication = len(peers)
+	est.TotalSize = size * uint64(len(peers))
+
+	freeSpace := c.getMetricsByName([]string{freeSpaceMetricName})[freeSpaceMetricName]
+	for _, p := range peers {
+		m, ok := freeSpace[p]
+		if !ok {
+			continue
+		}
+		free, err := strconv.ParseUint(m.Value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if free < size {
+			est.Reason = fmt.Sprintf("%s has %d bytes free but %d are needed", p.Pretty(), free, size)
+			return est, nil
+		}
+	}
+
+	est.Feasible = true
+	return est, nil
+}
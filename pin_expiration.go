@@ -0,0 +1,33 @@
+package ipfscluster
+
+import (
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// Pins with an ExpireAt time are removed from the shared state by the
+// leader once that time has passed, which unpins them from every peer.
+
+// unpinExpired unpins, in the leader, the pins whose expiration time has
+// passed and returns how many were unpinned.
+func (c *Cluster) unpinExpired(snap *stateSnapshot) int {
+	unpinned := 0
+	for _, pin := range snap.List() {
+		if c.ctx.Err() != nil {
+			break
+		}
+		if !pin.Expired() {
+			continue
+		}
+
+		err := c.unpin(api.InternalOrigin("expiration"), pin.Cid)
+		if err != nil {
+			logger.Errorf("error unpinning expired pin %s: %s", pin.Cid, err)
+			continue
+		}
+		unpinned++
+		logger.Infof("unpinned %s: it expired at %s", pin.Cid, pin.ExpireAt.Format(time.RFC3339))
+	}
+	return unpinned
+}
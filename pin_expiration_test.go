@@ -0,0 +1,43 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestClusterUnpinExpired(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	c3, _ := cid.Decode(test.TestCid3)
+
+	expired := api.PinCid(c1)
+	expired.ExpireAt = time.Now().Add(-time.Second)
+	valid := api.PinCid(c2)
+	valid.ExpireAt = time.Now().Add(time.Hour)
+	for _, pin := range []api.Pin{expired, valid, api.PinCid(c3)} {
+		if err := cl.Pin(pin); err != nil {
+			t.Fatal("pin should have worked:", err)
+		}
+	}
+
+	if n := cl.unpinExpired(testStateSnapshot(t, cl)); n != 1 {
+		t.Fatal("expected one expired pin to be unpinned:", n)
+	}
+	if _, err := cl.PinGet(c1); err == nil {
+		t.Error("the expired pin should have been unpinned")
+	}
+	for _, c := range []*cid.Cid{c2, c3} {
+		if _, err := cl.PinGet(c); err != nil {
+			t.Error("the pin should not have been unpinned:", c)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package ipfscluster
+
+import (
+	"sort"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// PinHistory returns the last pin and unpin attempts made by every cluster
+// peer on the given Cid, oldest first. Unreachable peers are skipped.
+func (c *Cluster) PinHistory(h *cid.Cid) ([]api.PinAttempt, error) {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make([][]api.PinAttempt, len(members), len(members))
+	ifaces := make([]interface{}, len(members), len(members))
+	for i := range replies {
+		ifaces[i] = &replies[i]
+	}
+	errs := c.multiRPC(members, "Cluster", "PinHistoryLocal", api.PinCid(h).ToSerial(), ifaces)
+
+	history := []api.PinAttempt{}
+	for i, err := range errs {
+		if err != nil {
+			logger.Errorf("%s: error getting the pin history from %s: %s", c.id, members[i], err)
+			continue
+		}
+		history = append(history, replies[i]...)
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Timestamp.Before(history[j].Timestamp)
+	})
+	return history, nil
+}
+
+// PinHistoryLocal returns the last pin and unpin attempts made by this
+// peer on the given Cid. It is empty when the tracker does not keep
+// a history.
+func (c *Cluster) PinHistoryLocal(h *cid.Cid) []api.PinAttempt {
+	historian, ok := c.tracker.(PinHistorian)
+	if !ok {
+		return []api.PinAttempt{}
+	}
+
+	history := historian.History(h)
+	for i := range history {
+		history[i].Peername = c.config.Peername
+	}
+	return history
+}
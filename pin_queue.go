@@ -0,0 +1,54 @@
+package ipfscluster
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// pinQueueMetricName is the name of the metric broadcasted by the tracked
+// pins informer (informer/tracked) with the number of pin and unpin
+// operations queued or ongoing in a peer.
+const pinQueueMetricName = "pinqueue"
+
+// pinQueueAlertName is the metric name used in the alerts sent when the
+// pin queue of a peer is too long. It differs from pinQueueMetricName so
+// that the monitor does not clear these alerts whenever a new pinqueue
+// metric arrives.
+const pinQueueAlertName = "pinqueuelength"
+
+// checkPinQueues checks, in the leader, the pinqueue metric of every peer
+// against PinQueueMaxLength. This catches peers which receive pins faster
+// than they can process them. It raises an alert for every peer whose
+// pin queue is longer than PinQueueMaxLength, and a recovery alert when
+// it is not.
+func (c *Cluster) checkPinQueues(snap *stateSnapshot) {
+	for _, m := range c.monitor.LastMetrics(pinQueueMetricName) {
+		if !m.Valid {
+			continue
+		}
+		queued, err := strconv.Atoi(m.Value)
+		if err != nil {
+			continue
+		}
+
+		alrt := api.Alert{
+			Peer:        m.Peer,
+			Peername:    m.Peername,
+			MetricName:  pinQueueAlertName,
+			Severity:    api.AlertWarning,
+			TriggeredAt: time.Now(),
+			MetricTTL:   time.Duration(m.Expire - m.Received),
+			LastValue:   m.Value,
+		}
+
+		if queued > c.config.PinQueueMaxLength {
+			logger.Warningf("%s has %d queued pin operations", m.Peer.Pretty(), queued)
+			c.monitor.RaiseAlert(alrt)
+			continue
+		}
+		alrt.Recovered = true
+		c.monitor.RaiseAlert(alrt)
+	}
+}
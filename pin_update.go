@@ -0,0 +1,164 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+var errNoDepthPins = errors.New("the IPFS connector cannot pin DAGs up to a max depth")
+
+// pinUpdateCheckInterval is how often the status of an updated pin is
+// checked until it is pinned by all the peers allocated to it.
+var pinUpdateCheckInterval = 5 * time.Second
+
+// PinUpdate pins a new version of a mutating dataset: the Cid "to" is
+// pinned with the options, metadata and (when possible) the allocations
+// of the existing pin of "from". The allocated peers which have "from"
+// pinned update its pin in IPFS, so that only the blocks that differ
+// are transferred. When unpinFrom is set, "from" is unpinned once all
+// the peers allocated to "to" have pinned it. Its blocks remain in the
+// repositories until they are garbage collected, which keeps the
+// transfer cheap in any case.
+func (c *Cluster) PinUpdate(from, to *cid.Cid, unpinFrom bool) (api.Pin, error) {
+	return c.pinUpdate("", from, to, unpinFrom)
+}
+
+// pinUpdate performs PinUpdate on behalf of the given origin.
+func (c *Cluster) pinUpdate(origin api.Origin, from, to *cid.Cid, unpinFrom bool) (api.Pin, error) {
+	if from == nil || to == nil {
+		return api.Pin{}, errors.New("bad pin update request")
+	}
+	if from.Equals(to) {
+		return api.Pin{}, errors.New("cannot update a pin to the same Cid")
+	}
+
+	prev, exists := c.getCurrentPin(from)
+	if !exists {
+		return api.Pin{}, fmt.Errorf("%s is not pinned", from)
+	}
+
+	pin := prev
+	pin.Cid = to
+	pin.PinUpdate = from
+	pin, _, err := c.pin(pin, nil, prev.Allocations, api.AllocationUpdate)
+	if err != nil {
+		return pin, err
+	}
+	logger.Infof("pin of %s updated to %s (origin: %s)", from, to, origin)
+	c.recordEvent(origin, api.EventPin, to, "", "updated from "+from.String())
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.finishPinUpdate(origin, from, to, unpinFrom)
+	}()
+	return pin, nil
+}
+
+// finishPinUpdate waits until the peers allocated to an updated pin have
+// pinned it. It then clears its PinUpdate field, which is only needed
+// to pin it, and unpins the previous version when requested. It gives up
+// when the pin is changed or removed in the meantime.
+func (c *Cluster) finishPinUpdate(origin api.Origin, from, to *cid.Cid, unpinFrom bool) {
+	ticker := time.NewTicker(pinUpdateCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pin, ok := c.getCurrentPin(to)
+		if !ok || pin.PinUpdate == nil || !pin.PinUpdate.Equals(from) {
+			return
+		}
+		gpi, err := c.Status(to)
+		if err != nil || !pinnedByAllocations(gpi) {
+			continue
+		}
+
+		pin.PinUpdate = nil
+		if err := c.consensus.LogPin(pin); err != nil {
+			logger.Errorf("error finishing the update of %s to %s: %s", from, to, err)
+			continue
+		}
+		if unpinFrom {
+			if err := c.unpin(origin, from); err != nil {
+				logger.Errorf("error unpinning %s after updating it to %s: %s", from, to, err)
+			}
+		}
+		return
+	}
+}
+
+// pinnedByAllocations returns true when every peer reports an item as
+// pinned, or as remote when it is not allocated to it.
+func pinnedByAllocations(gpi api.GlobalPinInfo) bool {
+	for _, pinfo := range gpi.PeerMap {
+		switch pinfo.Status {
+		case api.TrackerStatusPinned, api.TrackerStatusRemote:
+		default:
+			return false
+		}
+	}
+	return len(gpi.PeerMap) > 0
+}
+
+// ipfsPin pins an item in the IPFS daemon. Items created with PinUpdate
+// are pinned by updating the pin of their previous version when the
+// IPFSConnector supports it and the previous version is pinned
+// recursively in the daemon. Items with a MaxDepth need an IPFSConnector
+// which is a DepthPinner.
+func (c *Cluster) ipfsPin(ctx context.Context, pin api.Pin) error {
+	if pin.Recursive && pin.MaxDepth > 0 {
+		depthPinner, ok := c.ipfs.(DepthPinner)
+		if !ok {
+			return errNoDepthPins
+		}
+		return depthPinner.PinDepth(ctx, pin.Cid, pin.MaxDepth)
+	}
+
+	updater, ok := c.ipfs.(PinUpdater)
+	if ok && pin.PinUpdate != nil && pin.Recursive {
+		st, err := c.ipfs.PinLsCid(ctx, pin.PinUpdate)
+		if err == nil && st == api.IPFSPinStatusRecursive {
+			err = updater.PinUpdate(ctx, pin.PinUpdate, pin.Cid)
+			if err == nil {
+				return nil
+			}
+			logger.Warningf("updating the pin of %s to %s failed, pinning it instead: %s", pin.PinUpdate, pin.Cid, err)
+		}
+	}
+	return c.ipfs.Pin(ctx, pin.Cid, pin.Recursive)
+}
+
+// ipfsUnpin unpins an item from the IPFS daemon. The nodes of depth pins
+// which other pins allocated to this peer need are kept.
+func (c *Cluster) ipfsUnpin(ctx context.Context, pin api.Pin) error {
+	if pin.Recursive && pin.MaxDepth > 0 {
+		depthPinner, ok := c.ipfs.(DepthPinner)
+		if !ok {
+			return errNoDepthPins
+		}
+		cState, err := c.consensus.State()
+		if err != nil {
+			return err
+		}
+		// only the pins of this peer can overlap in its daemon
+		var keep []api.Pin
+		for _, p := range cState.ListAllocatedTo(c.id) {
+			if !p.Cid.Equals(pin.Cid) {
+				keep = append(keep, p)
+			}
+		}
+		return depthPinner.UnpinDepth(ctx, pin.Cid, pin.MaxDepth, keep)
+	}
+	return c.ipfs.Unpin(ctx, pin.Cid)
+}
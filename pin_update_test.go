@@ -0,0 +1,78 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestClusterPinUpdate(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	interval := pinUpdateCheckInterval
+	pinUpdateCheckInterval = 100 * time.Millisecond
+	defer func() { pinUpdateCheckInterval = interval }()
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	c3, _ := cid.Decode(test.TestCid3)
+
+	if _, err := cl.PinUpdate(c1, c2, false); err == nil {
+		t.Error("expected an error updating a Cid which is not pinned")
+	}
+
+	pin := api.PinCid(c1)
+	pin.Name = "dataset"
+	pin.Metadata = map[string]string{"version": "1"}
+	if err := cl.Pin(pin); err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	if _, err := cl.PinUpdate(c1, c1, false); err == nil {
+		t.Error("expected an error updating a pin to the same Cid")
+	}
+
+	updated, err := cl.PinUpdate(c1, c2, false)
+	if err != nil {
+		t.Fatal("pin update should have worked:", err)
+	}
+	if !updated.PinUpdate.Equals(c1) || updated.Name != "dataset" || updated.Metadata["version"] != "1" {
+		t.Error("the options of the previous pin should be kept:", updated)
+	}
+	if _, err := cl.PinGet(c1); err != nil {
+		t.Error("the previous pin should have been kept")
+	}
+
+	if _, err := cl.PinUpdate(c2, c3, true); err != nil {
+		t.Fatal("pin update should have worked:", err)
+	}
+	if _, err := cl.PinGet(c2); err != nil {
+		t.Error("the previous pin should be kept until the new one is pinned")
+	}
+	if _, err := cl.PinGet(c3); err != nil {
+		t.Error("the new pin should be in the state")
+	}
+
+	pinDelay()
+	pinfo := cl.StatusLocal(c3)
+	if pinfo.Status != api.TrackerStatusPinned {
+		t.Error("the new pin should be pinned:", pinfo.Status)
+	}
+	if _, err := cl.PinGet(c2); err == nil {
+		t.Error("the previous pin should have been unpinned")
+	}
+	updated, err = cl.PinGet(c3)
+	if err != nil || updated.PinUpdate != nil {
+		t.Error("the update should be cleared once applied:", updated.PinUpdate)
+	}
+	changes := cl.AllocationHistoryLocal(c3)
+	if len(changes) == 0 || changes[0].Reason != api.AllocationUpdate {
+		t.Error("expected an update allocation change:", changes)
+	}
+}
@@ -3,6 +3,8 @@ package maptracker
 import (
 	"encoding/json"
 	"errors"
+	"path/filepath"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/config"
 )
@@ -11,8 +13,15 @@ const configKey = "maptracker"
 
 // Default values for this Config.
 const (
-	DefaultMaxPinQueueSize = 4096
-	DefaultConcurrentPins  = 1
+	DefaultMaxPinQueueSize  = 4096
+	DefaultConcurrentPins   = 1
+	DefaultMaxPins          = 0
+	DefaultHistorySize      = 10
+	DefaultMaxPinRetries    = 3
+	DefaultPinRetryDelay    = 10 * time.Second
+	DefaultPinRetryMaxDelay = 5 * time.Minute
+	DefaultGCAfterUnpins    = 0
+	DefaultGCDelay          = time.Minute
 )
 
 // Config allows to initialize a Monitor and customize some parameters.
@@ -25,11 +34,44 @@ type Config struct {
 	// daemon in parallel. If the pinning method is "refs", it might increase
 	// speed. Unpin requests are always processed one by one.
 	ConcurrentPins int
+	// MaxPins is the maximum number of items that this peer is willing
+	// to pin. Further allocations to this peer are rejected. 0 means
+	// no limit.
+	MaxPins int
+	// HistorySize is the number of pin and unpin attempts remembered
+	// for every item.
+	HistorySize int
+	// HistoryFile is the file, relative to the configuration folder,
+	// in which the history of attempts is persisted. When empty, the
+	// history is lost on restart.
+	HistoryFile string
+	// MaxPinRetries is the number of times a failed pin or unpin is retried
+	// before leaving it in error until it is recovered. 0 disables
+	// retries.
+	MaxPinRetries int
+	// PinRetryDelay is the time to wait before the first retry. It
+	// doubles with every new attempt, up to PinRetryMaxDelay.
+	PinRetryDelay    time.Duration
+	PinRetryMaxDelay time.Duration
+	// GCAfterUnpins is the number of unpins after which a garbage
+	// collection of the IPFS repository is requested. Unpins are
+	// batched: the collection also runs when GCDelay passes without
+	// new unpins. 0 disables it.
+	GCAfterUnpins int
+	GCDelay       time.Duration
 }
 
 type jsonConfig struct {
-	MaxPinQueueSize int `json:"max_pin_queue_size"`
-	ConcurrentPins  int `json:"concurrent_pins"`
+	MaxPinQueueSize  int    `json:"max_pin_queue_size"`
+	ConcurrentPins   int    `json:"concurrent_pins"`
+	MaxPins          int    `json:"max_pins"`
+	HistorySize      int    `json:"history_size"`
+	HistoryFile      string `json:"history_file,omitempty"`
+	MaxPinRetries    *int   `json:"max_pin_retries,omitempty"`
+	PinRetryDelay    string `json:"pin_retry_delay"`
+	PinRetryMaxDelay string `json:"pin_retry_max_delay"`
+	GCAfterUnpins    int    `json:"gc_after_unpins"`
+	GCDelay          string `json:"gc_delay"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -41,6 +83,14 @@ func (cfg *Config) ConfigKey() string {
 func (cfg *Config) Default() error {
 	cfg.MaxPinQueueSize = DefaultMaxPinQueueSize
 	cfg.ConcurrentPins = DefaultConcurrentPins
+	cfg.MaxPins = DefaultMaxPins
+	cfg.HistorySize = DefaultHistorySize
+	cfg.HistoryFile = ""
+	cfg.MaxPinRetries = DefaultMaxPinRetries
+	cfg.PinRetryDelay = DefaultPinRetryDelay
+	cfg.PinRetryMaxDelay = DefaultPinRetryMaxDelay
+	cfg.GCAfterUnpins = DefaultGCAfterUnpins
+	cfg.GCDelay = DefaultGCDelay
 	return nil
 }
 
@@ -54,6 +104,30 @@ func (cfg *Config) Validate() error {
 	if cfg.ConcurrentPins <= 0 {
 		return errors.New("maptracker.concurrent_pins is too low")
 	}
+
+	if cfg.MaxPins < 0 {
+		return errors.New("maptracker.max_pins is invalid")
+	}
+
+	if cfg.HistorySize <= 0 {
+		return errors.New("maptracker.history_size is invalid")
+	}
+
+	if cfg.MaxPinRetries < 0 {
+		return errors.New("maptracker.max_pin_retries is invalid")
+	}
+
+	if cfg.PinRetryDelay <= 0 || cfg.PinRetryMaxDelay < cfg.PinRetryDelay {
+		return errors.New("maptracker.pin_retry_delay or pin_retry_max_delay is invalid")
+	}
+
+	if cfg.GCAfterUnpins < 0 {
+		return errors.New("maptracker.gc_after_unpins is invalid")
+	}
+
+	if cfg.GCDelay <= 0 {
+		return errors.New("maptracker.gc_delay is invalid")
+	}
 	return nil
 }
 
@@ -71,6 +145,20 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 
 	config.SetIfNotDefault(jcfg.MaxPinQueueSize, &cfg.MaxPinQueueSize)
 	config.SetIfNotDefault(jcfg.ConcurrentPins, &cfg.ConcurrentPins)
+	config.SetIfNotDefault(jcfg.MaxPins, &cfg.MaxPins)
+	config.SetIfNotDefault(jcfg.HistorySize, &cfg.HistorySize)
+	config.SetIfNotDefault(jcfg.HistoryFile, &cfg.HistoryFile)
+	// 0 disables retries, so an omitted key keeps the default
+	if jcfg.MaxPinRetries != nil {
+		cfg.MaxPinRetries = *jcfg.MaxPinRetries
+	}
+	retryDelay, _ := time.ParseDuration(jcfg.PinRetryDelay)
+	config.SetIfNotDefault(retryDelay, &cfg.PinRetryDelay)
+	retryMaxDelay, _ := time.ParseDuration(jcfg.PinRetryMaxDelay)
+	config.SetIfNotDefault(retryMaxDelay, &cfg.PinRetryMaxDelay)
+	config.SetIfNotDefault(jcfg.GCAfterUnpins, &cfg.GCAfterUnpins)
+	gcDelay, _ := time.ParseDuration(jcfg.GCDelay)
+	config.SetIfNotDefault(gcDelay, &cfg.GCDelay)
 
 	return cfg.Validate()
 }
@@ -81,6 +169,40 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 
 	jcfg.MaxPinQueueSize = cfg.MaxPinQueueSize
 	jcfg.ConcurrentPins = cfg.ConcurrentPins
+	jcfg.MaxPins = cfg.MaxPins
+	jcfg.HistorySize = cfg.HistorySize
+	jcfg.HistoryFile = cfg.HistoryFile
+	jcfg.MaxPinRetries = &cfg.MaxPinRetries
+	jcfg.PinRetryDelay = cfg.PinRetryDelay.String()
+	jcfg.PinRetryMaxDelay = cfg.PinRetryMaxDelay.String()
+	jcfg.GCAfterUnpins = cfg.GCAfterUnpins
+	jcfg.GCDelay = cfg.GCDelay.String()
 
 	return config.DefaultJSONMarshal(jcfg)
 }
+
+// retryDelay returns how long to wait before retrying a pin which
+// or an unpin which failed the given number of times.
+func (cfg *Config) retryDelay(failures int) time.Duration {
+	d := cfg.PinRetryDelay
+	for i := 1; i < failures && d < cfg.PinRetryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > cfg.PinRetryMaxDelay {
+		d = cfg.PinRetryMaxDelay
+	}
+	return d
+}
+
+// GetHistoryPath returns the full path of the HistoryFile, obtained by
+// concatenating that value with BaseDir of the configuration, if set.
+// An empty string is returned when no HistoryFile is configured.
+func (cfg *Config) GetHistoryPath() string {
+	if cfg.HistoryFile == "" {
+		return ""
+	}
+	if filepath.IsAbs(cfg.HistoryFile) || cfg.BaseDir == "" {
+		return cfg.HistoryFile
+	}
+	return filepath.Join(cfg.BaseDir, cfg.HistoryFile)
+}
@@ -3,12 +3,20 @@ package maptracker
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 var cfgJSON = []byte(`
 {
       "max_pin_queue_size": 4092,
-      "concurrent_pins": 2
+      "concurrent_pins": 2,
+      "history_size": 5,
+      "history_file": "history",
+      "max_pin_retries": 5,
+      "pin_retry_delay": "1s",
+      "pin_retry_max_delay": "10s",
+      "gc_after_unpins": 100,
+      "gc_delay": "30s"
 }
 `)
 
@@ -31,6 +39,44 @@ func TestLoadJSON(t *testing.T) {
 	if cfg.ConcurrentPins != 10 {
 		t.Error("expected 10 concurrent pins")
 	}
+	if cfg.HistorySize != 5 || cfg.HistoryFile != "history" {
+		t.Error("expected history options to be loaded")
+	}
+	if cfg.MaxPinRetries != 5 || cfg.PinRetryDelay != time.Second || cfg.PinRetryMaxDelay != 10*time.Second {
+		t.Error("expected retry options to be loaded")
+	}
+	if cfg.GCAfterUnpins != 100 || cfg.GCDelay != 30*time.Second {
+		t.Error("expected gc options to be loaded")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MaxPinRetries = nil
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxPinRetries != DefaultMaxPinRetries {
+		t.Error("expected the default max_pin_retries when the key is omitted")
+	}
+
+	zero := 0
+	j.MaxPinRetries = &zero
+	tst, _ = json.Marshal(j)
+	cfg.LoadJSON(tst)
+	if cfg.MaxPinRetries != 0 {
+		t.Error("expected max_pin_retries 0 to disable retries")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.PinRetryMaxDelay = "500ms"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding pin_retry_max_delay")
+	}
 }
 
 func TestToJSON(t *testing.T) {
@@ -58,4 +104,42 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.MaxPins = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.HistorySize = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MaxPinRetries = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.GCDelay = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.PinRetryDelay = time.Second
+	cfg.PinRetryMaxDelay = 5 * time.Second
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, e := range expected {
+		if d := cfg.retryDelay(i + 1); d != e {
+			t.Errorf("failure %d: expected %s, got %s", i+1, e, d)
+		}
+	}
 }
@@ -0,0 +1,42 @@
+package maptracker
+
+import (
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// historySaveInterval specifies how often the history is written to the
+// HistoryFile when it has changed.
+var historySaveInterval = time.Minute
+
+// saveHistory regularly persists the history to the HistoryFile until
+// the tracker is shut down.
+func (mpt *MapPinTracker) saveHistory() {
+	path := mpt.config.GetHistoryPath()
+	if path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(historySaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := mpt.history.Save(path); err != nil {
+				logger.Errorf("error saving pin history: %s", err)
+			}
+		case <-mpt.ctx.Done():
+			return
+		}
+	}
+}
+
+// History returns the last pin and unpin attempts made by this peer on
+// the given Cid, oldest first. The history of an item is forgotten once
+// it is successfully unpinned.
+func (mpt *MapPinTracker) History(c *cid.Cid) []api.PinAttempt {
+	return mpt.history.Get(c)
+}
@@ -0,0 +1,47 @@
+package maptracker
+
+import (
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestHistory(t *testing.T) {
+	mpt := testSlowMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(pinCancelCid)
+
+	for _, h := range []*cid.Cid{h1, h2} {
+		mpt.Track(api.Pin{
+			Cid:                  h,
+			ReplicationFactorMin: -1,
+			ReplicationFactorMax: -1,
+		})
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	hist := mpt.History(h1)
+	if len(hist) != 1 {
+		t.Fatal("expected one attempt for TestCid1")
+	}
+	if hist[0].Operation != "pin" || hist[0].Error != "" || hist[0].Cid != test.TestCid1 {
+		t.Error("unexpected attempt: ", hist[0])
+	}
+
+	hist = mpt.History(h2)
+	if len(hist) != 1 || hist[0].Error == "" {
+		t.Fatal("expected a failed attempt for the cancelled cid")
+	}
+
+	mpt.Untrack(h1)
+	time.Sleep(200 * time.Millisecond)
+	if len(mpt.History(h1)) != 0 {
+		t.Error("history should be forgotten after unpinning")
+	}
+}
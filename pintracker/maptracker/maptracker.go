@@ -5,10 +5,14 @@ package maptracker
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/pinhistory"
+	"github.com/ipfs/ipfs-cluster/pintracker/pinrate"
 
 	rpc "github.com/hsanjuan/go-libp2p-gorpc"
 	cid "github.com/ipfs/go-cid"
@@ -23,16 +27,29 @@ var (
 	errPinningTimeout   = errors.New("pinning operation is taking too long")
 	errPinned           = errors.New("the item is unexpectedly pinned on IPFS")
 	errUnpinned         = errors.New("the item is unexpectedly not pinned on IPFS")
+	errOverLimit        = errors.New("this peer has reached its pin limit")
 )
 
 // MapPinTracker is a PinTracker implementation which uses a Go map
 // to store the status of the tracked Cids. This component is thread-safe.
 type MapPinTracker struct {
-	mux    sync.RWMutex
-	status map[string]api.PinInfo
-	config *Config
+	mux     sync.RWMutex
+	status  map[string]api.PinInfo
+	retries map[string]pinRetry
+	config  *Config
+
+	// depths holds the MaxDepth of the tracked pins which have one,
+	// as unpinning them needs it.
+	depths map[string]int
 
 	optracker *operationTracker
+	history   *pinhistory.History
+
+	pinRate    *pinrate.Counter
+	pinsFailed uint64 // accessed atomically
+
+	pendingGC int64 // unpins since the last repo GC, accessed atomically
+	unpinned  chan struct{}
 
 	ctx    context.Context
 	cancel func()
@@ -40,9 +57,12 @@ type MapPinTracker struct {
 	rpcClient *rpc.Client
 	rpcReady  chan struct{}
 
-	peerID  peer.ID
-	pinCh   chan api.Pin
-	unpinCh chan api.Pin
+	peerID        peer.ID
+	pinCh         chan api.Pin
+	priorityPinCh chan api.Pin
+	unpinCh       chan api.Pin
+	statusCh      chan api.PinInfo
+	remoteOnly    bool
 
 	shutdownLock sync.Mutex
 	shutdown     bool
@@ -58,36 +78,70 @@ func NewMapPinTracker(cfg *Config, pid peer.ID) *MapPinTracker {
 		ctx:       ctx,
 		cancel:    cancel,
 		status:    make(map[string]api.PinInfo),
+		retries:   make(map[string]pinRetry),
 		config:    cfg,
+		depths:    make(map[string]int),
 		optracker: newOperationTracker(ctx),
+		history:   pinhistory.New(cfg.HistorySize),
+		pinRate:   pinrate.NewCounter(time.Minute),
 		rpcReady:  make(chan struct{}, 1),
 		peerID:    pid,
 		pinCh:     make(chan api.Pin, cfg.MaxPinQueueSize),
 		unpinCh:   make(chan api.Pin, cfg.MaxPinQueueSize),
+		unpinned:  make(chan struct{}, 1),
+
+		priorityPinCh: make(chan api.Pin, cfg.MaxPinQueueSize),
+		statusCh:      make(chan api.PinInfo, cfg.MaxPinQueueSize),
 	}
 	for i := 0; i < mpt.config.ConcurrentPins; i++ {
 		go mpt.pinWorker()
 	}
 	go mpt.unpinWorker()
+	if cfg.GCAfterUnpins > 0 {
+		go mpt.gcWorker()
+	}
+
+	if path := cfg.GetHistoryPath(); path != "" {
+		if err := mpt.history.Load(path); err != nil {
+			logger.Errorf("error loading pin history: %s", err)
+		}
+		go mpt.saveHistory()
+	}
 	return mpt
 }
 
-// reads the queue and makes pins to the IPFS daemon one by one
+// reads the queues and makes pins to the IPFS daemon one by one. High
+// priority pins are always taken first.
 func (mpt *MapPinTracker) pinWorker() {
 	for {
+		var p api.Pin
 		select {
-		case p := <-mpt.pinCh:
-			if opc, ok := mpt.optracker.get(p.Cid); ok && opc.op == operationPin {
-				mpt.optracker.updateOperationPhase(
-					p.Cid,
-					phaseInProgress,
-				)
-				mpt.pin(p)
+		case p = <-mpt.priorityPinCh:
+		default:
+			select {
+			case p = <-mpt.priorityPinCh:
+			case p = <-mpt.pinCh:
+			case <-mpt.ctx.Done():
+				return
 			}
-		case <-mpt.ctx.Done():
-			return
 		}
+
+		if opc, ok := mpt.optracker.get(p.Cid); ok && opc.op == operationPin {
+			mpt.optracker.updateOperationPhase(
+				p.Cid,
+				phaseInProgress,
+			)
+			mpt.pin(p)
+		}
+	}
+}
+
+// pinQueue returns the queue in which the given pin should wait.
+func (mpt *MapPinTracker) pinQueue(c api.Pin) chan api.Pin {
+	if c.Priority == api.PinPriorityHigh {
+		return mpt.priorityPinCh
 	}
+	return mpt.pinCh
 }
 
 // reads the queue and makes unpin requests to the IPFS daemon
@@ -108,6 +162,48 @@ func (mpt *MapPinTracker) unpinWorker() {
 	}
 }
 
+// gcWorker batches the unpins done by the unpinWorker and requests a
+// garbage collection of the IPFS repository when GCAfterUnpins is
+// reached or when no new unpins happen during GCDelay.
+func (mpt *MapPinTracker) gcWorker() {
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-mpt.unpinned:
+			if atomic.LoadInt64(&mpt.pendingGC) >= int64(mpt.config.GCAfterUnpins) {
+				mpt.repoGC()
+				timer = nil
+			} else {
+				timer = time.After(mpt.config.GCDelay)
+			}
+		case <-timer:
+			mpt.repoGC()
+			timer = nil
+		case <-mpt.ctx.Done():
+			return
+		}
+	}
+}
+
+func (mpt *MapPinTracker) repoGC() {
+	pending := atomic.SwapInt64(&mpt.pendingGC, 0)
+	if pending == 0 {
+		return
+	}
+	logger.Infof("requesting IPFS repo GC after %d unpins", pending)
+	err := mpt.rpcClient.CallContext(
+		mpt.ctx,
+		"",
+		"Cluster",
+		"IPFSRepoGC",
+		struct{}{},
+		&struct{}{},
+	)
+	if err != nil {
+		logger.Errorf("error running IPFS repo GC: %s", err)
+	}
+}
+
 // Shutdown finishes the services provided by the MapPinTracker and cancels
 // any active context.
 func (mpt *MapPinTracker) Shutdown() error {
@@ -123,6 +219,11 @@ func (mpt *MapPinTracker) Shutdown() error {
 	mpt.cancel()
 	close(mpt.rpcReady)
 	mpt.wg.Wait()
+	if path := mpt.config.GetHistoryPath(); path != "" {
+		if err := mpt.history.Save(path); err != nil {
+			logger.Errorf("error saving pin history: %s", err)
+		}
+	}
 	mpt.shutdown = true
 	return nil
 }
@@ -134,20 +235,51 @@ func (mpt *MapPinTracker) set(c *cid.Cid, s api.TrackerStatus) {
 }
 
 func (mpt *MapPinTracker) unsafeSet(c *cid.Cid, s api.TrackerStatus) {
-	if s == api.TrackerStatusUnpinned {
+	prev := mpt.unsafeGet(c).Status
+	switch s {
+	case api.TrackerStatusUnpinned:
 		delete(mpt.status, c.String())
+		delete(mpt.retries, c.String())
+		// remote items were not pinned here in the first place
+		if prev != s && prev != api.TrackerStatusRemote {
+			mpt.notifyStatus(mpt.unsafeGet(c))
+		}
 		return
+	case api.TrackerStatusPinned, api.TrackerStatusRemote:
+		delete(mpt.retries, c.String())
+	}
+
+	pInfo := api.PinInfo{
+		Cid:      c,
+		Peer:     mpt.peerID,
+		Status:   s,
+		TS:       time.Now(),
+		Error:    "",
+		Attempts: mpt.retries[c.String()].failures,
+	}
+	mpt.status[c.String()] = pInfo
+	if prev != s {
+		mpt.notifyStatus(pInfo)
 	}
+}
 
-	mpt.status[c.String()] = api.PinInfo{
-		Cid:    c,
-		Peer:   mpt.peerID,
-		Status: s,
-		TS:     time.Now(),
-		Error:  "",
+// notifyStatus sends a status change to the StatusChanges channel,
+// unless it is full.
+func (mpt *MapPinTracker) notifyStatus(pInfo api.PinInfo) {
+	select {
+	case mpt.statusCh <- pInfo:
+	default:
+		logger.Debugf("dropping the status change of %s", pInfo.Cid)
 	}
 }
 
+// StatusChanges returns a channel on which the new status of the items
+// is sent whenever it changes. Changes are dropped when more than
+// MaxPinQueueSize are waiting to be received.
+func (mpt *MapPinTracker) StatusChanges() <-chan api.PinInfo {
+	return mpt.statusCh
+}
+
 func (mpt *MapPinTracker) get(c *cid.Cid) api.PinInfo {
 	mpt.mux.RLock()
 	defer mpt.mux.RUnlock()
@@ -177,27 +309,50 @@ func (mpt *MapPinTracker) setError(c *cid.Cid, err error) {
 
 func (mpt *MapPinTracker) unsafeSetError(c *cid.Cid, err error) {
 	p := mpt.unsafeGet(c)
+	var pInfo api.PinInfo
 	switch p.Status {
 	case api.TrackerStatusPinned, api.TrackerStatusPinning, api.TrackerStatusPinError:
-		mpt.status[c.String()] = api.PinInfo{
-			Cid:    c,
-			Peer:   mpt.peerID,
-			Status: api.TrackerStatusPinError,
-			TS:     time.Now(),
-			Error:  err.Error(),
+		retry := mpt.retries[c.String()]
+		pInfo = api.PinInfo{
+			Cid:       c,
+			Peer:      mpt.peerID,
+			Status:    api.TrackerStatusPinError,
+			TS:        time.Now(),
+			Error:     err.Error(),
+			Attempts:  retry.failures,
+			NextRetry: retry.next,
 		}
 	case api.TrackerStatusUnpinned, api.TrackerStatusUnpinning, api.TrackerStatusUnpinError:
-		mpt.status[c.String()] = api.PinInfo{
-			Cid:    c,
-			Peer:   mpt.peerID,
-			Status: api.TrackerStatusUnpinError,
-			TS:     time.Now(),
-			Error:  err.Error(),
+		retry := mpt.retries[c.String()]
+		pInfo = api.PinInfo{
+			Cid:       c,
+			Peer:      mpt.peerID,
+			Status:    api.TrackerStatusUnpinError,
+			TS:        time.Now(),
+			Error:     err.Error(),
+			Attempts:  retry.failures,
+			NextRetry: retry.next,
 		}
+	default:
+		return
 	}
+	mpt.status[c.String()] = pInfo
+	if p.Status != pInfo.Status {
+		mpt.notifyStatus(pInfo)
+	}
+}
+
+// SetRemoteOnly makes the tracker consider every pin as remote, so that
+// nothing is pinned. It is used by peers which do not store content
+// (see the cluster roles) and must be called before tracking any pin.
+func (mpt *MapPinTracker) SetRemoteOnly(remoteOnly bool) {
+	mpt.remoteOnly = remoteOnly
 }
 
 func (mpt *MapPinTracker) isRemote(c api.Pin) bool {
+	if mpt.remoteOnly {
+		return true
+	}
 	if c.ReplicationFactorMax < 0 {
 		return false
 	}
@@ -215,7 +370,14 @@ func (mpt *MapPinTracker) isRemote(c api.Pin) bool {
 
 func (mpt *MapPinTracker) pin(c api.Pin) error {
 	logger.Debugf("issuing pin call for %s", c.Cid)
-	mpt.set(c.Cid, api.TrackerStatusPinning)
+	mpt.mux.Lock()
+	mpt.unsafeSet(c.Cid, api.TrackerStatusPinning)
+	if c.Recursive && c.MaxDepth > 0 {
+		mpt.depths[c.Cid.String()] = c.MaxDepth
+	} else {
+		delete(mpt.depths, c.Cid.String())
+	}
+	mpt.mux.Unlock()
 
 	var ctx context.Context
 	opc, ok := mpt.optracker.get(c.Cid)
@@ -226,6 +388,7 @@ func (mpt *MapPinTracker) pin(c api.Pin) error {
 		ctx = opc.ctx
 	}
 
+	start := time.Now()
 	err := mpt.rpcClient.CallContext(
 		ctx,
 		"",
@@ -234,16 +397,97 @@ func (mpt *MapPinTracker) pin(c api.Pin) error {
 		c.ToSerial(),
 		&struct{}{},
 	)
+	mpt.history.Record(c.Cid, mpt.peerID, "pin", start, err)
 	if err != nil {
-		mpt.setError(c.Cid, err)
+		if ctx.Err() != nil { // cancelled
+			mpt.setError(c.Cid, err)
+			return err
+		}
+		atomic.AddUint64(&mpt.pinsFailed, 1)
+		mpt.opFailed(c, operationPin, ctx, err)
 		return err
 	}
+	mpt.pinRate.Add()
 
 	mpt.set(c.Cid, api.TrackerStatusPinned)
 	mpt.optracker.finish(c.Cid)
 	return nil
 }
 
+// pinRetry keeps the failed attempts to pin or unpin an item.
+type pinRetry struct {
+	failures int
+	next     time.Time // zero when no more retries are scheduled
+}
+
+// opFailed sets a Cid in error state and, unless the operation has
+// failed MaxPinRetries times already, schedules a new attempt with
+// exponential backoff. The retry is abandoned when the operation is
+// cancelled or replaced (i.e. by Untrack, Track or Recover).
+func (mpt *MapPinTracker) opFailed(c api.Pin, op operationType, ctx context.Context, err error) {
+	key := c.Cid.String()
+	mpt.mux.Lock()
+	retry := mpt.retries[key]
+	retry.failures++
+	retry.next = time.Time{}
+	var delay time.Duration
+	if retry.failures <= mpt.config.MaxPinRetries {
+		delay = mpt.config.retryDelay(retry.failures)
+		retry.next = time.Now().Add(delay)
+	}
+	mpt.retries[key] = retry
+	mpt.unsafeSetError(c.Cid, err)
+	mpt.mux.Unlock()
+
+	if retry.next.IsZero() {
+		return
+	}
+
+	name := "pin"
+	if op == operationUnpin {
+		name = "unpin"
+	}
+	logger.Infof("%s of %s (origin: %s) failed %d times, retrying in %s", name, c.Cid, c.Origin, retry.failures, delay)
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		mpt.retryOp(c, op, retry.next)
+	}()
+}
+
+// retryOp queues again a pin or an unpin which failed, if it is still
+// in error state and no other retry was scheduled after the given one.
+func (mpt *MapPinTracker) retryOp(c api.Pin, op operationType, scheduled time.Time) {
+	errStatus, queuedStatus := api.TrackerStatusPinError, api.TrackerStatusPinQueued
+	queue, full := mpt.pinQueue(c), "pin queue is full"
+	if op == operationUnpin {
+		errStatus, queuedStatus = api.TrackerStatusUnpinError, api.TrackerStatusUnpinQueued
+		queue, full = mpt.unpinCh, "unpin queue is full"
+	}
+
+	mpt.mux.Lock()
+	p := mpt.unsafeGet(c.Cid)
+	if p.Status != errStatus || !p.NextRetry.Equal(scheduled) {
+		mpt.mux.Unlock()
+		return
+	}
+	mpt.unsafeSet(c.Cid, queuedStatus)
+	mpt.mux.Unlock()
+
+	mpt.optracker.updateOperationPhase(c.Cid, phaseQueued)
+	select {
+	case queue <- c:
+	default:
+		err := errors.New(full)
+		mpt.setError(c.Cid, err)
+		mpt.optracker.finish(c.Cid)
+		logger.Error(err.Error())
+	}
+}
+
 func (mpt *MapPinTracker) unpin(c api.Pin) error {
 	logger.Debugf("issuing unpin call for %s", c.Cid)
 	mpt.set(c.Cid, api.TrackerStatusUnpinning)
@@ -257,6 +501,7 @@ func (mpt *MapPinTracker) unpin(c api.Pin) error {
 		ctx = opc.ctx
 	}
 
+	start := time.Now()
 	err := mpt.rpcClient.CallContext(
 		ctx,
 		"",
@@ -266,19 +511,36 @@ func (mpt *MapPinTracker) unpin(c api.Pin) error {
 		&struct{}{},
 	)
 	if err != nil {
-		mpt.setError(c.Cid, err)
+		mpt.history.Record(c.Cid, mpt.peerID, "unpin", start, err)
+		if ctx.Err() != nil { // cancelled
+			mpt.setError(c.Cid, err)
+			return err
+		}
+		mpt.opFailed(c, operationUnpin, ctx, err)
 		return err
 	}
+	mpt.history.Forget(c.Cid)
+	mpt.mux.Lock()
+	delete(mpt.depths, c.Cid.String())
+	mpt.mux.Unlock()
 
 	mpt.set(c.Cid, api.TrackerStatusUnpinned)
 	mpt.optracker.finish(c.Cid)
+
+	if mpt.config.GCAfterUnpins > 0 {
+		atomic.AddInt64(&mpt.pendingGC, 1)
+		select {
+		case mpt.unpinned <- struct{}{}:
+		default: // the gcWorker is already notified
+		}
+	}
 	return nil
 }
 
 // Track tells the MapPinTracker to start managing a Cid,
 // possibly triggering Pin operations on the IPFS daemon.
 func (mpt *MapPinTracker) Track(c api.Pin) error {
-	logger.Debugf("tracking %s", c.Cid)
+	logger.Debugf("tracking %s (origin: %s)", c.Cid, c.Origin)
 	if mpt.isRemote(c) {
 		if mpt.get(c.Cid).Status == api.TrackerStatusPinned {
 			mpt.optracker.trackNewOperation(
@@ -306,11 +568,20 @@ func (mpt *MapPinTracker) Track(c api.Pin) error {
 		}
 	}
 
+	if mpt.overLimit(c.Cid) {
+		logger.Errorf("not pinning %s: %s", c.Cid, errOverLimit)
+		mpt.set(c.Cid, api.TrackerStatusOverLimit)
+		return errOverLimit
+	}
+
 	mpt.optracker.trackNewOperation(mpt.ctx, c.Cid, operationPin)
-	mpt.set(c.Cid, api.TrackerStatusPinQueued)
+	mpt.mux.Lock()
+	delete(mpt.retries, c.Cid.String()) // start over
+	mpt.unsafeSet(c.Cid, api.TrackerStatusPinQueued)
+	mpt.mux.Unlock()
 
 	select {
-	case mpt.pinCh <- c:
+	case mpt.pinQueue(c) <- c:
 	default:
 		err := errors.New("pin queue is full")
 		mpt.setError(c.Cid, err)
@@ -321,6 +592,50 @@ func (mpt *MapPinTracker) Track(c api.Pin) error {
 	return nil
 }
 
+// localPins returns the number of items which are pinned
+// or to be pinned by this peer.
+func (mpt *MapPinTracker) localPins() int {
+	mpt.mux.RLock()
+	defer mpt.mux.RUnlock()
+	n := 0
+	for _, p := range mpt.status {
+		switch p.Status {
+		case api.TrackerStatusRemote, api.TrackerStatusOverLimit:
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// overLimit returns true when tracking c locally would make this
+// peer go over its pin limit.
+func (mpt *MapPinTracker) overLimit(c *cid.Cid) bool {
+	if mpt.config.MaxPins <= 0 {
+		return false
+	}
+
+	switch mpt.get(c).Status {
+	case api.TrackerStatusRemote, api.TrackerStatusOverLimit, api.TrackerStatusUnpinned:
+		return mpt.localPins() >= mpt.config.MaxPins
+	default: // already counted
+		return false
+	}
+}
+
+// Capacity returns how many more items can be pinned by this peer
+// before reaching the configured limit, or -1 when there is no limit.
+func (mpt *MapPinTracker) Capacity() int {
+	if mpt.config.MaxPins <= 0 {
+		return -1
+	}
+	free := mpt.config.MaxPins - mpt.localPins()
+	if free < 0 {
+		return 0
+	}
+	return free
+}
+
 // Untrack tells the MapPinTracker to stop managing a Cid.
 // If the Cid is pinned locally, it will be unpinned.
 func (mpt *MapPinTracker) Untrack(c *cid.Cid) error {
@@ -338,15 +653,23 @@ func (mpt *MapPinTracker) Untrack(c *cid.Cid) error {
 		}
 	}
 
-	if pinStatus := mpt.get(c); pinStatus.Status == api.TrackerStatusUnpinned {
+	switch mpt.get(c).Status {
+	case api.TrackerStatusUnpinned:
+		return nil
+	case api.TrackerStatusOverLimit:
+		// it was never pinned
+		mpt.set(c, api.TrackerStatusUnpinned)
 		return nil
 	}
 
 	mpt.optracker.trackNewOperation(mpt.ctx, c, operationUnpin)
-	mpt.set(c, api.TrackerStatusUnpinQueued)
+	mpt.mux.Lock()
+	delete(mpt.retries, c.String()) // start over
+	mpt.unsafeSet(c, api.TrackerStatusUnpinQueued)
+	mpt.mux.Unlock()
 
 	select {
-	case mpt.unpinCh <- api.PinCid(c):
+	case mpt.unpinCh <- mpt.unpinRequest(c):
 	default:
 		err := errors.New("unpin queue is full")
 		mpt.setError(c, err)
@@ -357,6 +680,59 @@ func (mpt *MapPinTracker) Untrack(c *cid.Cid) error {
 	return nil
 }
 
+// unpinRequest returns the pin to unpin a Cid, with its max depth
+// when it was tracked with one.
+func (mpt *MapPinTracker) unpinRequest(c *cid.Cid) api.Pin {
+	pin := api.PinCid(c)
+	mpt.mux.RLock()
+	pin.MaxDepth = mpt.depths[c.String()]
+	mpt.mux.RUnlock()
+	return pin
+}
+
+// PinQueue describes the pin and unpin operations which are queued or in
+// progress, oldest first.
+func (mpt *MapPinTracker) PinQueue() api.PinQueue {
+	queue := api.PinQueue{
+		MaxQueueSize:   mpt.config.MaxPinQueueSize,
+		ConcurrentPins: mpt.config.ConcurrentPins,
+		PinsDone:       mpt.pinRate.Total(),
+		PinsFailed:     atomic.LoadUint64(&mpt.pinsFailed),
+		PinRate:        mpt.pinRate.Rate(),
+		PendingGC:      int(atomic.LoadInt64(&mpt.pendingGC)),
+	}
+
+	for _, opc := range mpt.optracker.list() {
+		status := mpt.get(opc.cid).Status
+		switch status {
+		case api.TrackerStatusPinQueued:
+			queue.PinQueued++
+		case api.TrackerStatusUnpinQueued:
+			queue.UnpinQueued++
+		case api.TrackerStatusPinning, api.TrackerStatusUnpinning:
+			queue.InProgress++
+		default: // finished or failed
+			continue
+		}
+
+		opType := "pin"
+		if opc.op == operationUnpin {
+			opType = "unpin"
+		}
+		queue.Operations = append(queue.Operations, api.QueuedOperation{
+			Cid:    opc.cid.String(),
+			Type:   opType,
+			Status: status.String(),
+			Since:  opc.ts,
+		})
+	}
+
+	sort.Slice(queue.Operations, func(i, j int) bool {
+		return queue.Operations[i].Since.Before(queue.Operations[j].Since)
+	})
+	return queue
+}
+
 // Status returns information for a Cid tracked by this
 // MapPinTracker.
 func (mpt *MapPinTracker) Status(c *cid.Cid) api.PinInfo {
@@ -399,6 +775,30 @@ func (mpt *MapPinTracker) Sync(c *cid.Cid) (api.PinInfo, error) {
 	return mpt.syncStatus(c, ips), nil
 }
 
+// ipfsPins lists the recursive and the direct pins in the IPFS daemon.
+func (mpt *MapPinTracker) ipfsPins() (map[string]api.IPFSPinStatus, error) {
+	ipsMap := make(map[string]api.IPFSPinStatus)
+	for _, typeFilter := range []string{"recursive", "direct"} {
+		var pins map[string]api.IPFSPinStatus
+		err := mpt.rpcClient.Call(
+			"",
+			"Cluster",
+			"IPFSPinLs",
+			typeFilter,
+			&pins,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range pins {
+			if _, ok := ipsMap[k]; !ok {
+				ipsMap[k] = v
+			}
+		}
+	}
+	return ipsMap, nil
+}
+
 // SyncAll verifies that the statuses of all tracked Cids match the
 // one reported by the IPFS daemon. If not, they will be transitioned
 // to PinError or UnpinError.
@@ -408,15 +808,8 @@ func (mpt *MapPinTracker) Sync(c *cid.Cid) (api.PinInfo, error) {
 // with Recover().
 // An error is returned if we are unable to contact the IPFS daemon.
 func (mpt *MapPinTracker) SyncAll() ([]api.PinInfo, error) {
-	var ipsMap map[string]api.IPFSPinStatus
 	var pInfos []api.PinInfo
-	err := mpt.rpcClient.Call(
-		"",
-		"Cluster",
-		"IPFSPinLs",
-		"recursive",
-		&ipsMap,
-	)
+	ipsMap, err := mpt.ipfsPins()
 	if err != nil {
 		mpt.mux.Lock()
 		for k := range mpt.status {
@@ -486,11 +879,14 @@ func (mpt *MapPinTracker) Recover(c *cid.Cid) (api.PinInfo, error) {
 	var err error
 	switch p.Status {
 	case api.TrackerStatusPinError:
-		// FIXME: This always recovers recursive == true
-		// but sharding will bring direct-pin objects
-		err = mpt.pin(api.PinCid(c))
+		err = mpt.pin(mpt.pinRequest(c))
 	case api.TrackerStatusUnpinError:
-		err = mpt.unpin(api.PinCid(c))
+		err = mpt.unpin(mpt.unpinRequest(c))
+	case api.TrackerStatusOverLimit:
+		if mpt.overLimit(c) {
+			return p, errOverLimit
+		}
+		err = mpt.pin(mpt.pinRequest(c))
 	default:
 		logger.Warningf("%s does not need recovery. Try syncing first", c)
 		return p, nil
@@ -501,6 +897,19 @@ func (mpt *MapPinTracker) Recover(c *cid.Cid) (api.PinInfo, error) {
 	return mpt.get(c), err
 }
 
+// pinRequest returns the pin to re-pin a Cid, as found in the shared
+// state. Direct and depth pins would be pinned recursively otherwise.
+func (mpt *MapPinTracker) pinRequest(c *cid.Cid) api.Pin {
+	pin := api.PinCid(c)
+	var pinS api.PinSerial
+	err := mpt.rpcClient.Call("", "Cluster", "PinGet", pin.ToSerial(), &pinS)
+	if err != nil {
+		logger.Warningf("could not get the pin of %s, recovering it recursively: %s", c, err)
+		return pin
+	}
+	return pinS.ToPin()
+}
+
 // RecoverAll attempts to recover all items tracked by this peer.
 func (mpt *MapPinTracker) RecoverAll() ([]api.PinInfo, error) {
 	statuses := mpt.StatusAll()
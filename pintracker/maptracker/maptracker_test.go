@@ -136,6 +136,244 @@ func TestTrack(t *testing.T) {
 	}
 }
 
+func TestPinQueue(t *testing.T) {
+	mpt := testSlowMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	slowH, _ := cid.Decode(test.TestSlowCid1)
+	h, _ := cid.Decode(test.TestCid1)
+	for _, c := range []*cid.Cid{slowH, h} {
+		err := mpt.Track(api.Pin{
+			Cid:                  c,
+			ReplicationFactorMin: -1,
+			ReplicationFactorMax: -1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	queue := mpt.PinQueue()
+	if queue.InProgress != 1 || queue.PinQueued != 1 || queue.UnpinQueued != 0 {
+		t.Fatalf("unexpected queue: %+v", queue)
+	}
+	if len(queue.Operations) != 2 ||
+		queue.Operations[0].Cid != test.TestSlowCid1 ||
+		queue.Operations[0].Status != api.TrackerStatusPinning.String() ||
+		queue.Operations[1].Status != api.TrackerStatusPinQueued.String() {
+		t.Errorf("unexpected queued operations: %+v", queue.Operations)
+	}
+
+	time.Sleep(2500 * time.Millisecond) // let them be pinned
+
+	queue = mpt.PinQueue()
+	if len(queue.Operations) != 0 {
+		t.Error("expected an empty queue")
+	}
+	if queue.PinsDone != 2 || queue.PinsFailed != 0 || queue.PinRate <= 0 {
+		t.Errorf("unexpected pin counters: %+v", queue)
+	}
+}
+
+func TestPinRetries(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MaxPinRetries = 2
+	cfg.PinRetryDelay = 100 * time.Millisecond
+	cfg.PinRetryMaxDelay = 200 * time.Millisecond
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	mpt.SetClient(mockRPCClient(t))
+	defer mpt.Shutdown()
+
+	h, _ := cid.Decode(pinCancelCid) // pinning it always fails
+	c := api.Pin{
+		Cid:                  h,
+		ReplicationFactorMin: -1,
+		ReplicationFactorMax: -1,
+	}
+
+	mpt.Track(c)
+	time.Sleep(50 * time.Millisecond)
+	st := mpt.Status(h)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 1 || st.NextRetry.IsZero() {
+		t.Fatalf("expected a retry to be scheduled: %+v", st)
+	}
+
+	time.Sleep(500 * time.Millisecond) // 100ms + 200ms
+	st = mpt.Status(h)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 3 || !st.NextRetry.IsZero() {
+		t.Fatalf("expected retries to stop after 3 attempts: %+v", st)
+	}
+
+	mpt.Track(c)
+	time.Sleep(50 * time.Millisecond)
+	if st = mpt.Status(h); st.Attempts != 1 {
+		t.Errorf("tracking again should reset the attempts: %+v", st)
+	}
+}
+
+func TestUnpinRetries(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MaxPinRetries = 1
+	cfg.PinRetryDelay = 100 * time.Millisecond
+	cfg.PinRetryMaxDelay = 100 * time.Millisecond
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	mpt.SetClient(mockRPCClient(t))
+	defer mpt.Shutdown()
+
+	h, _ := cid.Decode(unpinCancelCid) // unpinning it always fails
+	mpt.Track(api.Pin{Cid: h, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	time.Sleep(50 * time.Millisecond)
+
+	mpt.Untrack(h)
+	time.Sleep(50 * time.Millisecond)
+	st := mpt.Status(h)
+	if st.Status != api.TrackerStatusUnpinError || st.Attempts != 1 || st.NextRetry.IsZero() {
+		t.Fatalf("expected an unpin retry to be scheduled: %+v", st)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	st = mpt.Status(h)
+	if st.Status != api.TrackerStatusUnpinError || st.Attempts != 2 || !st.NextRetry.IsZero() {
+		t.Fatalf("expected retries to stop after 2 attempts: %+v", st)
+	}
+}
+
+func TestStatusChanges(t *testing.T) {
+	mpt := testSlowMapPinTracker(t)
+	defer mpt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(pinCancelCid) // pinning it always fails
+	mpt.Track(api.Pin{Cid: h1, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	mpt.Track(api.Pin{Cid: h2, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	time.Sleep(200 * time.Millisecond)
+	mpt.Untrack(h1)
+	time.Sleep(200 * time.Millisecond)
+
+	seen := make(map[string]bool)
+	for len(mpt.StatusChanges()) > 0 {
+		pInfo := <-mpt.StatusChanges()
+		seen[pInfo.Cid.String()+" "+pInfo.Status.String()] = true
+	}
+	for _, change := range []string{
+		test.TestCid1 + " pinned",
+		test.TestCid1 + " unpinned",
+		pinCancelCid + " pin_error",
+	} {
+		if !seen[change] {
+			t.Errorf("expected the status change %q: %v", change, seen)
+		}
+	}
+}
+
+func TestUnpinGC(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.GCAfterUnpins = 2
+	cfg.GCDelay = 100 * time.Millisecond
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	mpt.SetClient(test.NewMockRPCClient(t))
+	defer mpt.Shutdown()
+
+	untrack := func(c string) {
+		h, _ := cid.Decode(c)
+		mpt.Track(api.Pin{Cid: h, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+		time.Sleep(50 * time.Millisecond)
+		mpt.Untrack(h)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	untrack(test.TestCid1)
+	if n := mpt.PinQueue().PendingGC; n != 1 {
+		t.Fatalf("expected 1 unpin pending GC, got %d", n)
+	}
+	untrack(test.TestCid2)
+	if n := mpt.PinQueue().PendingGC; n != 0 {
+		t.Fatalf("expected GC to run after 2 unpins, got %d pending", n)
+	}
+
+	untrack(test.TestCid3)
+	time.Sleep(200 * time.Millisecond)
+	if n := mpt.PinQueue().PendingGC; n != 0 {
+		t.Errorf("expected GC to run after gc_delay, got %d pending", n)
+	}
+}
+
+func TestTrackRemoteOnly(t *testing.T) {
+	mpt := testMapPinTracker(t)
+	defer mpt.Shutdown()
+	mpt.SetRemoteOnly(true)
+
+	h, _ := cid.Decode(test.TestCid1)
+	c := api.Pin{
+		Cid:                  h,
+		Allocations:          []peer.ID{},
+		ReplicationFactorMin: -1,
+		ReplicationFactorMax: -1,
+	}
+
+	err := mpt.Track(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := mpt.Status(h)
+	if st.Status != api.TrackerStatusRemote {
+		t.Fatalf("cid should be remote and is %s", st.Status)
+	}
+}
+
+func TestTrackOverLimit(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MaxPins = 1
+	mpt := NewMapPinTracker(cfg, test.TestPeerID1)
+	mpt.SetClient(test.NewMockRPCClient(t))
+	defer mpt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+
+	if mpt.Capacity() != 1 {
+		t.Fatal("expected capacity for one pin")
+	}
+
+	err := mpt.Track(api.PinCid(h1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mpt.Track(api.PinCid(h2))
+	if err != errOverLimit {
+		t.Fatal("expected an over limit error")
+	}
+
+	if st := mpt.Status(h2).Status; st != api.TrackerStatusOverLimit {
+		t.Errorf("expected over_limit status and got %s", st)
+	}
+
+	if mpt.Capacity() != 0 {
+		t.Error("expected no capacity left")
+	}
+
+	err = mpt.Untrack(h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond) // let it be unpinned
+
+	_, err = mpt.Recover(h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := mpt.Status(h2).Status; st != api.TrackerStatusPinned {
+		t.Errorf("expected pinned status after recover and got %s", st)
+	}
+}
+
 func TestUntrack(t *testing.T) {
 	mpt := testMapPinTracker(t)
 	defer mpt.Shutdown()
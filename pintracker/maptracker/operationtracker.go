@@ -3,6 +3,7 @@ package maptracker
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/ipfs/go-cid"
 )
@@ -34,6 +35,7 @@ type operation struct {
 	cid    *cid.Cid
 	op     operationType
 	phase  phase
+	ts     time.Time // when the phase was last updated
 	ctx    context.Context
 	cancel func()
 }
@@ -44,6 +46,7 @@ func newOperationWithContext(ctx context.Context, c *cid.Cid, op operationType)
 		cid:    c,
 		op:     op,
 		phase:  phaseQueued,
+		ts:     time.Now(),
 		ctx:    ctx,
 		cancel: cancel, // use *operationTracker.cancelOperation() instead
 	}
@@ -85,6 +88,7 @@ func (opt *operationTracker) updateOperationPhase(c *cid.Cid, p phase) {
 		return
 	}
 	opc.phase = p
+	opc.ts = time.Now()
 	opt.set(opc)
 	logger.Debugf(
 		"'%s' on cid '%s' has been updated to phase '%s'",
@@ -107,6 +111,17 @@ func (opt *operationTracker) get(c *cid.Cid) (operation, bool) {
 	return opc, ok
 }
 
+// list returns all the tracked operations.
+func (opt *operationTracker) list() []operation {
+	opt.mu.RLock()
+	defer opt.mu.RUnlock()
+	ops := make([]operation, 0, len(opt.operations))
+	for _, opc := range opt.operations {
+		ops = append(ops, opc)
+	}
+	return ops
+}
+
 // finish cancels the operation context and removes it from the map
 func (opt *operationTracker) finish(c *cid.Cid) {
 	opt.mu.Lock()
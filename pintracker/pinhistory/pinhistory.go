@@ -0,0 +1,129 @@
+// Package pinhistory provides a bounded history of the pin and unpin
+// attempts made on every item, which can be persisted to a file. It is
+// used by the PinTracker implementations to implement PinHistorian.
+package pinhistory
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// History keeps the last attempts made on every item, up to a maximum
+// per item. It is thread-safe.
+type History struct {
+	mu       sync.RWMutex
+	size     int
+	attempts map[string][]api.PinAttempt
+	dirty    bool
+}
+
+// New returns a History which keeps up to size attempts per item.
+func New(size int) *History {
+	return &History{
+		size:     size,
+		attempts: make(map[string][]api.PinAttempt),
+	}
+}
+
+// Record adds an attempt of the given operation ("pin" or "unpin") which
+// started at the given time and finished now with the given error,
+// dropping the oldest ones over the limit.
+func (h *History) Record(c *cid.Cid, pid peer.ID, op string, start time.Time, err error) {
+	attempt := api.PinAttempt{
+		Cid:       c.String(),
+		Peer:      peer.IDB58Encode(pid),
+		Operation: op,
+		Timestamp: start,
+		Duration:  time.Since(start).String(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	attempts := append(h.attempts[c.String()], attempt)
+	if len(attempts) > h.size {
+		attempts = attempts[len(attempts)-h.size:]
+	}
+	h.attempts[c.String()] = attempts
+	h.dirty = true
+}
+
+// Forget removes the history of an item.
+func (h *History) Forget(c *cid.Cid) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.attempts[c.String()]; ok {
+		delete(h.attempts, c.String())
+		h.dirty = true
+	}
+}
+
+// Get returns the attempts made on an item, oldest first.
+func (h *History) Get(c *cid.Cid) []api.PinAttempt {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	attempts := h.attempts[c.String()]
+	res := make([]api.PinAttempt, len(attempts), len(attempts))
+	copy(res, attempts)
+	return res
+}
+
+// Load reads the history from the given file, if it exists.
+func (h *History) Load(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	attempts := make(map[string][]api.PinAttempt)
+	err = json.Unmarshal(raw, &attempts)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for k, v := range attempts {
+		if len(v) > h.size {
+			v = v[len(v)-h.size:]
+		}
+		h.attempts[k] = v
+	}
+	return nil
+}
+
+// Save writes the history to the given file when it has changed since
+// the last save. The file is replaced atomically.
+func (h *History) Save(path string) error {
+	h.mu.Lock()
+	if !h.dirty {
+		h.mu.Unlock()
+		return nil
+	}
+	raw, err := json.Marshal(h.attempts)
+	h.dirty = false
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, raw, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
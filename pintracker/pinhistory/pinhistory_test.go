@@ -0,0 +1,51 @@
+package pinhistory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestHistorySize(t *testing.T) {
+	hist := New(2)
+	h, _ := cid.Decode(test.TestCid1)
+	for i := 0; i < 3; i++ {
+		hist.Record(h, test.TestPeerID1, "pin", time.Now(), nil)
+	}
+	if len(hist.Get(h)) != 2 {
+		t.Error("history should be limited to 2 attempts")
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pinhistory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+
+	h, _ := cid.Decode(test.TestCid1)
+	hist := New(10)
+	hist.Record(h, test.TestPeerID1, "pin", time.Now(), nil)
+	err = hist.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hist = New(10)
+	err = hist.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempts := hist.Get(h)
+	if len(attempts) != 1 || attempts[0].Peer != test.TestPeerID1.Pretty() {
+		t.Error("the history should have been loaded")
+	}
+}
@@ -0,0 +1,60 @@
+// Package pinrate provides a counter of completed operations which can
+// report how many of them happened recently. It is used by the PinTracker
+// implementations to report their pin throughput.
+package pinrate
+
+import (
+	"sync"
+	"time"
+)
+
+// Counter counts events and remembers when the recent ones happened. It
+// is thread-safe.
+type Counter struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	total  uint64
+	recent []time.Time
+}
+
+// NewCounter returns a Counter which reports rates over the given window.
+func NewCounter(window time.Duration) *Counter {
+	return &Counter{
+		window: window,
+	}
+}
+
+// Add records an event happening now.
+func (c *Counter) Add() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.total++
+	c.recent = append(c.prune(now), now)
+}
+
+// Total returns the number of events recorded since the Counter was
+// created.
+func (c *Counter) Total() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// Rate returns the number of events per second over the window.
+func (c *Counter) Rate() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recent = c.prune(time.Now())
+	return float64(len(c.recent)) / c.window.Seconds()
+}
+
+// prune drops the events which are older than the window.
+func (c *Counter) prune(now time.Time) []time.Time {
+	i := 0
+	for i < len(c.recent) && now.Sub(c.recent[i]) > c.window {
+		i++
+	}
+	return c.recent[i:]
+}
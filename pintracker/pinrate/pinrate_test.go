@@ -0,0 +1,32 @@
+package pinrate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter(100 * time.Millisecond)
+	if c.Rate() != 0 || c.Total() != 0 {
+		t.Fatal("expected an empty counter")
+	}
+
+	for i := 0; i < 5; i++ {
+		c.Add()
+	}
+	if c.Total() != 5 {
+		t.Error("expected 5 events")
+	}
+	if r := c.Rate(); r != 50 {
+		t.Errorf("expected 50 events per second, got %f", r)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	c.Add()
+	if c.Total() != 6 {
+		t.Error("expected 6 events")
+	}
+	if r := c.Rate(); r != 10 {
+		t.Errorf("expected old events to be forgotten, got %f", r)
+	}
+}
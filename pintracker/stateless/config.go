@@ -0,0 +1,171 @@
+package stateless
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const configKey = "stateless"
+
+// Default values for this Config.
+const (
+	DefaultMaxPinQueueSize  = 4096
+	DefaultConcurrentPins   = 1
+	DefaultHistorySize      = 10
+	DefaultMaxPinRetries    = 3
+	DefaultPinRetryDelay    = 10 * time.Second
+	DefaultPinRetryMaxDelay = 5 * time.Minute
+)
+
+// Config allows to initialize a StatelessPinTracker and customize some
+// parameters.
+type Config struct {
+	config.Saver
+
+	// If higher, they will automatically marked with an error.
+	MaxPinQueueSize int
+	// ConcurrentPins specifies how many pin requests can be sent to the ipfs
+	// daemon in parallel. Unpin requests are always processed one by one.
+	ConcurrentPins int
+	// HistorySize is the number of pin and unpin attempts remembered
+	// for every item.
+	HistorySize int
+	// HistoryFile is the file, relative to the configuration folder,
+	// in which the history of attempts is persisted. When empty, the
+	// history is lost on restart.
+	HistoryFile string
+	// MaxPinRetries is the number of times a failed pin or unpin is
+	// retried before leaving it in error until it is recovered. 0
+	// disables retries.
+	MaxPinRetries int
+	// PinRetryDelay is the time to wait before the first retry. It
+	// doubles with every new attempt, up to PinRetryMaxDelay.
+	PinRetryDelay    time.Duration
+	PinRetryMaxDelay time.Duration
+}
+
+type jsonConfig struct {
+	MaxPinQueueSize int    `json:"max_pin_queue_size"`
+	ConcurrentPins  int    `json:"concurrent_pins"`
+	HistorySize     int    `json:"history_size,omitempty"`
+	HistoryFile     string `json:"history_file,omitempty"`
+
+	MaxPinRetries    *int   `json:"max_pin_retries,omitempty"`
+	PinRetryDelay    string `json:"pin_retry_delay,omitempty"`
+	PinRetryMaxDelay string `json:"pin_retry_max_delay,omitempty"`
+}
+
+// ConfigKey provides a human-friendly identifier for this type of Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default sets the fields of this Config to sensible values.
+func (cfg *Config) Default() error {
+	cfg.MaxPinQueueSize = DefaultMaxPinQueueSize
+	cfg.ConcurrentPins = DefaultConcurrentPins
+	cfg.HistorySize = DefaultHistorySize
+	cfg.HistoryFile = ""
+	cfg.MaxPinRetries = DefaultMaxPinRetries
+	cfg.PinRetryDelay = DefaultPinRetryDelay
+	cfg.PinRetryMaxDelay = DefaultPinRetryMaxDelay
+	return nil
+}
+
+// Validate checks that the fields of this Config have working values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	if cfg.MaxPinQueueSize <= 0 {
+		return errors.New("stateless.max_pin_queue_size too low")
+	}
+
+	if cfg.ConcurrentPins <= 0 {
+		return errors.New("stateless.concurrent_pins is too low")
+	}
+
+	if cfg.HistorySize <= 0 {
+		return errors.New("stateless.history_size is invalid")
+	}
+
+	if cfg.MaxPinRetries < 0 {
+		return errors.New("stateless.max_pin_retries is invalid")
+	}
+
+	if cfg.PinRetryDelay <= 0 || cfg.PinRetryMaxDelay < cfg.PinRetryDelay {
+		return errors.New("stateless.pin_retry_delay or pin_retry_max_delay are invalid")
+	}
+	return nil
+}
+
+// LoadJSON sets the fields of this Config to the values defined by the JSON
+// representation of it, as generated by ToJSON.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling stateless tracker config")
+		return err
+	}
+
+	cfg.Default()
+
+	config.SetIfNotDefault(jcfg.MaxPinQueueSize, &cfg.MaxPinQueueSize)
+	config.SetIfNotDefault(jcfg.ConcurrentPins, &cfg.ConcurrentPins)
+	config.SetIfNotDefault(jcfg.HistorySize, &cfg.HistorySize)
+	config.SetIfNotDefault(jcfg.HistoryFile, &cfg.HistoryFile)
+	// 0 disables retries, so an omitted key keeps the default
+	if jcfg.MaxPinRetries != nil {
+		cfg.MaxPinRetries = *jcfg.MaxPinRetries
+	}
+	retryDelay, _ := time.ParseDuration(jcfg.PinRetryDelay)
+	config.SetIfNotDefault(retryDelay, &cfg.PinRetryDelay)
+	retryMaxDelay, _ := time.ParseDuration(jcfg.PinRetryMaxDelay)
+	config.SetIfNotDefault(retryMaxDelay, &cfg.PinRetryMaxDelay)
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := &jsonConfig{}
+
+	jcfg.MaxPinQueueSize = cfg.MaxPinQueueSize
+	jcfg.ConcurrentPins = cfg.ConcurrentPins
+	jcfg.HistorySize = cfg.HistorySize
+	jcfg.HistoryFile = cfg.HistoryFile
+	jcfg.MaxPinRetries = &cfg.MaxPinRetries
+	jcfg.PinRetryDelay = cfg.PinRetryDelay.String()
+	jcfg.PinRetryMaxDelay = cfg.PinRetryMaxDelay.String()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+// retryDelay returns how long to wait before retrying a pin or an unpin
+// which failed the given number of times.
+func (cfg *Config) retryDelay(failures int) time.Duration {
+	d := cfg.PinRetryDelay
+	for i := 1; i < failures && d < cfg.PinRetryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > cfg.PinRetryMaxDelay {
+		d = cfg.PinRetryMaxDelay
+	}
+	return d
+}
+
+// GetHistoryPath returns the full path of the HistoryFile, obtained by
+// concatenating that value with BaseDir of the configuration, if set.
+// An empty string is returned when no HistoryFile is configured.
+func (cfg *Config) GetHistoryPath() string {
+	if cfg.HistoryFile == "" {
+		return ""
+	}
+	if filepath.IsAbs(cfg.HistoryFile) || cfg.BaseDir == "" {
+		return cfg.HistoryFile
+	}
+	return filepath.Join(cfg.BaseDir, cfg.HistoryFile)
+}
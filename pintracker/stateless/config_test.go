@@ -0,0 +1,102 @@
+package stateless
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var cfgJSON = []byte(`
+{
+      "max_pin_queue_size": 4092,
+      "concurrent_pins": 2,
+      "history_size": 20
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := &jsonConfig{}
+
+	json.Unmarshal(cfgJSON, j)
+	j.ConcurrentPins = 10
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Error("did not expect an error")
+	}
+	if cfg.ConcurrentPins != 10 {
+		t.Error("expected 10 concurrent pins")
+	}
+	if cfg.MaxPinQueueSize != 4092 {
+		t.Error("expected max_pin_queue_size to be loaded")
+	}
+	if cfg.HistorySize != 20 {
+		t.Error("expected history_size to be loaded")
+	}
+	if cfg.MaxPinRetries != DefaultMaxPinRetries {
+		t.Error("expected the default max_pin_retries when the key is omitted")
+	}
+
+	zero := 0
+	j.MaxPinRetries = &zero
+	j.PinRetryDelay = "1s"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxPinRetries != 0 || cfg.PinRetryDelay != time.Second {
+		t.Error("expected retry options to be loaded")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.ConcurrentPins = -2
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MaxPinQueueSize = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.HistorySize = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.PinRetryMaxDelay = time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
@@ -0,0 +1,831 @@
+// Package stateless implements a PinTracker component for IPFS Cluster
+// which does not keep the status of every pin. The status is worked out
+// when requested by comparing the shared state with the pins in the IPFS
+// daemon, so the memory used does not grow with the pinset. Only the
+// operations in progress and those which failed are kept, along with a
+// bounded history of the attempts made on every item.
+//
+// Unlike the map-based tracker, it cannot limit the number of items
+// pinned by the peer, as it does not count them.
+package stateless
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/pinhistory"
+	"github.com/ipfs/ipfs-cluster/pintracker/pinrate"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var logger = logging.Logger("pintracker")
+
+var (
+	errUnpinned = errors.New("the item is unexpectedly not pinned on IPFS")
+)
+
+// historySaveInterval specifies how often the history is written to the
+// HistoryFile when it has changed.
+var historySaveInterval = time.Minute
+
+type operationType int
+
+const (
+	operationPin operationType = iota
+	operationUnpin
+)
+
+// operation is a pin or an unpin which is queued, in progress or which
+// failed.
+type operation struct {
+	pin    api.Pin
+	op     operationType
+	status api.TrackerStatus
+	err    string
+	ts     time.Time
+
+	failures int
+	next     time.Time // zero when no retry is scheduled
+
+	ctx    context.Context
+	cancel func()
+}
+
+// StatelessPinTracker is a PinTracker implementation which obtains the
+// status of the pins from the shared state and the IPFS daemon. This
+// component is thread-safe.
+type StatelessPinTracker struct {
+	config *Config
+	peerID peer.ID
+
+	opsMux sync.RWMutex
+	ops    map[string]*operation
+	// depths holds the MaxDepth of the pinned items which have one,
+	// as unpinning them needs it.
+	depths map[string]int
+
+	pinRate    *pinrate.Counter
+	pinsFailed uint64 // accessed atomically
+	history    *pinhistory.History
+	statusCh   chan api.PinInfo
+
+	ctx    context.Context
+	cancel func()
+
+	rpcClient *rpc.Client
+	rpcReady  chan struct{}
+
+	pinCh         chan *operation
+	priorityPinCh chan *operation
+	unpinCh       chan *operation
+	remoteOnly    bool
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+}
+
+// NewStatelessPinTracker returns a new object which has been correctly
+// initialized with the given configuration.
+func NewStatelessPinTracker(cfg *Config, pid peer.ID) *StatelessPinTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	spt := &StatelessPinTracker{
+		config:   cfg,
+		peerID:   pid,
+		ops:      make(map[string]*operation),
+		depths:   make(map[string]int),
+		pinRate:  pinrate.NewCounter(time.Minute),
+		history:  pinhistory.New(cfg.HistorySize),
+		statusCh: make(chan api.PinInfo, cfg.MaxPinQueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		rpcReady: make(chan struct{}, 1),
+		pinCh:    make(chan *operation, cfg.MaxPinQueueSize),
+		unpinCh:  make(chan *operation, cfg.MaxPinQueueSize),
+
+		priorityPinCh: make(chan *operation, cfg.MaxPinQueueSize),
+	}
+	for i := 0; i < cfg.ConcurrentPins; i++ {
+		go spt.pinWorker()
+	}
+	go spt.worker(spt.unpinCh)
+
+	if path := cfg.GetHistoryPath(); path != "" {
+		if err := spt.history.Load(path); err != nil {
+			logger.Errorf("error loading pin history: %s", err)
+		}
+		go spt.saveHistory()
+	}
+	return spt
+}
+
+// reads a queue and runs the operations one by one
+func (spt *StatelessPinTracker) worker(queue <-chan *operation) {
+	for {
+		select {
+		case op := <-queue:
+			spt.run(op)
+		case <-spt.ctx.Done():
+			return
+		}
+	}
+}
+
+// reads the pin queues and runs the operations one by one. High priority
+// pins are always taken first.
+func (spt *StatelessPinTracker) pinWorker() {
+	for {
+		var op *operation
+		select {
+		case op = <-spt.priorityPinCh:
+		default:
+			select {
+			case op = <-spt.priorityPinCh:
+			case op = <-spt.pinCh:
+			case <-spt.ctx.Done():
+				return
+			}
+		}
+		spt.run(op)
+	}
+}
+
+// Shutdown finishes the services provided by the StatelessPinTracker and
+// cancels any active context.
+func (spt *StatelessPinTracker) Shutdown() error {
+	spt.shutdownLock.Lock()
+	defer spt.shutdownLock.Unlock()
+
+	if spt.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping StatelessPinTracker")
+	spt.cancel()
+	close(spt.rpcReady)
+	if path := spt.config.GetHistoryPath(); path != "" {
+		if err := spt.history.Save(path); err != nil {
+			logger.Errorf("error saving pin history: %s", err)
+		}
+	}
+	spt.shutdown = true
+	return nil
+}
+
+// SetClient makes the StatelessPinTracker ready to perform RPC requests
+// to other components.
+func (spt *StatelessPinTracker) SetClient(c *rpc.Client) {
+	spt.rpcClient = c
+	spt.rpcReady <- struct{}{}
+}
+
+// SetRemoteOnly makes the tracker consider every pin as remote, so that
+// nothing is pinned. It is used by peers which do not store content
+// (see the cluster roles) and must be called before tracking any pin.
+func (spt *StatelessPinTracker) SetRemoteOnly(remoteOnly bool) {
+	spt.remoteOnly = remoteOnly
+}
+
+func (spt *StatelessPinTracker) isRemote(c api.Pin) bool {
+	if spt.remoteOnly {
+		return true
+	}
+	if c.ReplicationFactorMax < 0 {
+		return false
+	}
+
+	for _, p := range c.Allocations {
+		if p == spt.peerID {
+			return false
+		}
+	}
+	return true
+}
+
+// newOperation registers an operation on a pin, cancelling any other
+// operation on it. It returns nil when the same operation is already
+// queued or in progress.
+func (spt *StatelessPinTracker) newOperation(pin api.Pin, opType operationType) *operation {
+	spt.opsMux.Lock()
+	defer spt.opsMux.Unlock()
+
+	key := pin.Cid.String()
+	if prev, ok := spt.ops[key]; ok {
+		if prev.op == opType && prev.err == "" {
+			return nil
+		}
+		prev.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(spt.ctx)
+	op := &operation{
+		pin:    pin,
+		op:     opType,
+		ts:     time.Now(),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	op.status = op.queuedStatus()
+	spt.ops[key] = op
+	spt.notifyStatus(op.pin.Cid, op.status, nil)
+	return op
+}
+
+// cancelOperation cancels and forgets the operation on a Cid, if any.
+func (spt *StatelessPinTracker) cancelOperation(c *cid.Cid) {
+	spt.opsMux.Lock()
+	defer spt.opsMux.Unlock()
+	if op, ok := spt.ops[c.String()]; ok {
+		op.cancel()
+		delete(spt.ops, c.String())
+	}
+}
+
+// setStatus updates an operation unless it was cancelled. Operations
+// which succeed are forgotten.
+func (spt *StatelessPinTracker) setStatus(op *operation, status api.TrackerStatus, err error) {
+	spt.opsMux.Lock()
+	defer spt.opsMux.Unlock()
+
+	key := op.pin.Cid.String()
+	if spt.ops[key] != op {
+		return // cancelled
+	}
+
+	spt.notifyStatus(op.pin.Cid, status, err)
+
+	switch status {
+	case api.TrackerStatusPinned, api.TrackerStatusUnpinned:
+		op.cancel()
+		delete(spt.ops, key)
+		return
+	}
+
+	op.status = status
+	op.ts = time.Now()
+	if err != nil {
+		op.err = err.Error()
+	}
+}
+
+// notifyStatus sends a status change to the StatusChanges channel,
+// unless it is full.
+func (spt *StatelessPinTracker) notifyStatus(c *cid.Cid, status api.TrackerStatus, err error) {
+	pInfo := api.PinInfo{
+		Cid:    c,
+		Peer:   spt.peerID,
+		Status: status,
+		TS:     time.Now(),
+	}
+	if err != nil {
+		pInfo.Error = err.Error()
+	}
+	select {
+	case spt.statusCh <- pInfo:
+	default:
+		logger.Debugf("dropping the status change of %s", c)
+	}
+}
+
+// StatusChanges returns a channel on which the new status of the items
+// is sent whenever it changes. Changes are dropped when more than
+// MaxPinQueueSize are waiting to be received.
+func (spt *StatelessPinTracker) StatusChanges() <-chan api.PinInfo {
+	return spt.statusCh
+}
+
+// History returns the last pin and unpin attempts made by this peer on
+// the given Cid, oldest first. The history of an item is forgotten once
+// it is successfully unpinned.
+func (spt *StatelessPinTracker) History(c *cid.Cid) []api.PinAttempt {
+	return spt.history.Get(c)
+}
+
+// saveHistory regularly persists the history to the HistoryFile until
+// the tracker is shut down.
+func (spt *StatelessPinTracker) saveHistory() {
+	ticker := time.NewTicker(historySaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := spt.history.Save(spt.config.GetHistoryPath()); err != nil {
+				logger.Errorf("error saving pin history: %s", err)
+			}
+		case <-spt.ctx.Done():
+			return
+		}
+	}
+}
+
+// run performs an operation against the IPFS daemon.
+func (spt *StatelessPinTracker) run(op *operation) error {
+	if op.ctx.Err() != nil {
+		return op.ctx.Err() // cancelled while queued
+	}
+
+	method := "IPFSPin"
+	progress := api.TrackerStatusPinning
+	done := api.TrackerStatusPinned
+	failed := api.TrackerStatusPinError
+	if op.op == operationUnpin {
+		method = "IPFSUnpin"
+		progress = api.TrackerStatusUnpinning
+		done = api.TrackerStatusUnpinned
+		failed = api.TrackerStatusUnpinError
+	}
+
+	logger.Debugf("issuing %s call for %s", method, op.pin.Cid)
+	spt.setStatus(op, progress, nil)
+	start := time.Now()
+	err := spt.rpcClient.CallContext(
+		op.ctx,
+		"",
+		"Cluster",
+		method,
+		op.pin.ToSerial(),
+		&struct{}{},
+	)
+	spt.history.Record(op.pin.Cid, spt.peerID, op.name(), start, err)
+	if err != nil {
+		if op.ctx.Err() != nil { // cancelled
+			spt.setStatus(op, failed, err)
+			return err
+		}
+		if op.op == operationPin {
+			atomic.AddUint64(&spt.pinsFailed, 1)
+		}
+		spt.opFailed(op, err)
+		return err
+	}
+	if op.op == operationPin {
+		spt.pinRate.Add()
+	}
+	if op.op == operationUnpin {
+		spt.history.Forget(op.pin.Cid)
+	}
+	spt.setDepth(op)
+	spt.setStatus(op, done, nil)
+	return nil
+}
+
+// opFailed sets an operation in error state and, unless it has failed
+// MaxPinRetries times already, schedules a new attempt with exponential
+// backoff. The retry is abandoned when the operation is cancelled or
+// replaced.
+func (spt *StatelessPinTracker) opFailed(op *operation, err error) {
+	spt.opsMux.Lock()
+	if spt.ops[op.pin.Cid.String()] != op {
+		spt.opsMux.Unlock()
+		return // cancelled
+	}
+	op.failures++
+	op.next = time.Time{}
+	var delay time.Duration
+	if op.failures <= spt.config.MaxPinRetries {
+		delay = spt.config.retryDelay(op.failures)
+		op.next = time.Now().Add(delay)
+	}
+	op.status = op.failedStatus()
+	op.ts = time.Now()
+	op.err = err.Error()
+	spt.notifyStatus(op.pin.Cid, op.status, err)
+	next := op.next
+	failures := op.failures
+	spt.opsMux.Unlock()
+
+	if next.IsZero() {
+		return
+	}
+
+	logger.Infof("%s of %s (origin: %s) failed %d times, retrying in %s", op.name(), op.pin.Cid, op.pin.Origin, failures, delay)
+	go func() {
+		select {
+		case <-op.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		spt.retry(op, next)
+	}()
+}
+
+// retry queues again an operation which failed, if it is still the
+// current one for its Cid and no other retry was scheduled after the
+// given one.
+func (spt *StatelessPinTracker) retry(op *operation, scheduled time.Time) {
+	spt.opsMux.Lock()
+	if spt.ops[op.pin.Cid.String()] != op || !op.next.Equal(scheduled) {
+		spt.opsMux.Unlock()
+		return
+	}
+	op.status = op.queuedStatus()
+	op.ts = time.Now()
+	op.err = ""
+	op.next = time.Time{}
+	spt.notifyStatus(op.pin.Cid, op.status, nil)
+	spt.opsMux.Unlock()
+
+	select {
+	case spt.queue(op) <- op:
+	default:
+		err := errors.New("queue is full")
+		spt.setStatus(op, op.failedStatus(), err)
+		logger.Error(err.Error())
+	}
+}
+
+// setDepth records the max depth of a pinned item, or forgets it once
+// the item is unpinned.
+func (spt *StatelessPinTracker) setDepth(op *operation) {
+	spt.opsMux.Lock()
+	defer spt.opsMux.Unlock()
+	key := op.pin.Cid.String()
+	if op.op == operationPin && op.pin.Recursive && op.pin.MaxDepth > 0 {
+		spt.depths[key] = op.pin.MaxDepth
+	} else {
+		delete(spt.depths, key)
+	}
+}
+
+// unpinRequest returns the pin to unpin a Cid, with its max depth when
+// it was pinned with one.
+func (spt *StatelessPinTracker) unpinRequest(c *cid.Cid) api.Pin {
+	pin := api.PinCid(c)
+	spt.opsMux.RLock()
+	pin.MaxDepth = spt.depths[c.String()]
+	spt.opsMux.RUnlock()
+	return pin
+}
+
+// enqueue registers an operation and queues it.
+func (spt *StatelessPinTracker) enqueue(pin api.Pin, opType operationType) error {
+	op := spt.newOperation(pin, opType)
+	if op == nil {
+		return nil
+	}
+
+	select {
+	case spt.queue(op) <- op:
+	default:
+		err := errors.New("queue is full")
+		spt.setStatus(op, op.failedStatus(), err)
+		logger.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// queue returns the queue in which an operation waits to be run.
+func (spt *StatelessPinTracker) queue(op *operation) chan *operation {
+	switch {
+	case op.op == operationUnpin:
+		return spt.unpinCh
+	case op.pin.Priority == api.PinPriorityHigh:
+		return spt.priorityPinCh
+	default:
+		return spt.pinCh
+	}
+}
+
+func (op *operation) name() string {
+	if op.op == operationUnpin {
+		return "unpin"
+	}
+	return "pin"
+}
+
+func (op *operation) queuedStatus() api.TrackerStatus {
+	if op.op == operationUnpin {
+		return api.TrackerStatusUnpinQueued
+	}
+	return api.TrackerStatusPinQueued
+}
+
+func (op *operation) failedStatus() api.TrackerStatus {
+	if op.op == operationUnpin {
+		return api.TrackerStatusUnpinError
+	}
+	return api.TrackerStatusPinError
+}
+
+func (spt *StatelessPinTracker) operationInfo(op *operation) api.PinInfo {
+	return api.PinInfo{
+		Cid:    op.pin.Cid,
+		Peer:   spt.peerID,
+		Status: op.status,
+		TS:     op.ts,
+		Error:  op.err,
+
+		Attempts:  op.failures,
+		NextRetry: op.next,
+	}
+}
+
+// getOperation returns the status of the operation on a Cid, if any.
+func (spt *StatelessPinTracker) getOperation(c *cid.Cid) (api.PinInfo, bool) {
+	spt.opsMux.RLock()
+	defer spt.opsMux.RUnlock()
+	op, ok := spt.ops[c.String()]
+	if !ok {
+		return api.PinInfo{}, false
+	}
+	return spt.operationInfo(op), true
+}
+
+// PinQueue describes the pin and unpin operations which are queued or in
+// progress, oldest first.
+func (spt *StatelessPinTracker) PinQueue() api.PinQueue {
+	queue := api.PinQueue{
+		MaxQueueSize:   spt.config.MaxPinQueueSize,
+		ConcurrentPins: spt.config.ConcurrentPins,
+		PinsDone:       spt.pinRate.Total(),
+		PinsFailed:     atomic.LoadUint64(&spt.pinsFailed),
+		PinRate:        spt.pinRate.Rate(),
+	}
+
+	spt.opsMux.RLock()
+	defer spt.opsMux.RUnlock()
+	for _, op := range spt.ops {
+		switch op.status {
+		case api.TrackerStatusPinQueued:
+			queue.PinQueued++
+		case api.TrackerStatusUnpinQueued:
+			queue.UnpinQueued++
+		case api.TrackerStatusPinning, api.TrackerStatusUnpinning:
+			queue.InProgress++
+		default: // failed
+			continue
+		}
+
+		opType := "pin"
+		if op.op == operationUnpin {
+			opType = "unpin"
+		}
+		queue.Operations = append(queue.Operations, api.QueuedOperation{
+			Cid:    op.pin.Cid.String(),
+			Type:   opType,
+			Status: op.status.String(),
+			Since:  op.ts,
+		})
+	}
+
+	sort.Slice(queue.Operations, func(i, j int) bool {
+		return queue.Operations[i].Since.Before(queue.Operations[j].Since)
+	})
+	return queue
+}
+
+// Track tells the StatelessPinTracker to start managing a Cid, possibly
+// triggering Pin operations on the IPFS daemon.
+func (spt *StatelessPinTracker) Track(c api.Pin) error {
+	logger.Debugf("tracking %s (origin: %s)", c.Cid, c.Origin)
+	if spt.isRemote(c) {
+		spt.cancelOperation(c.Cid)
+		if spt.ipfsStatus(c.Cid).IsPinned() {
+			return spt.enqueue(c, operationUnpin)
+		}
+		return nil
+	}
+	return spt.enqueue(c, operationPin)
+}
+
+// Untrack tells the StatelessPinTracker to stop managing a Cid.
+// If the Cid is pinned locally, it will be unpinned.
+func (spt *StatelessPinTracker) Untrack(c *cid.Cid) error {
+	logger.Debugf("untracking %s", c)
+	return spt.enqueue(spt.unpinRequest(c), operationUnpin)
+}
+
+// ipfsStatus returns the status of a Cid in the IPFS daemon. Errors are
+// logged and reported as unpinned.
+func (spt *StatelessPinTracker) ipfsStatus(c *cid.Cid) api.IPFSPinStatus {
+	var ips api.IPFSPinStatus
+	err := spt.rpcClient.Call(
+		"",
+		"Cluster",
+		"IPFSPinLsCid",
+		api.PinCid(c).ToSerial(),
+		&ips,
+	)
+	if err != nil {
+		logger.Error(err)
+		return api.IPFSPinStatusUnpinned
+	}
+	return ips
+}
+
+// Status returns the local status of a Cid, obtained from the operations
+// in progress or, when there are none, from the shared state and the
+// IPFS daemon.
+func (spt *StatelessPinTracker) Status(c *cid.Cid) api.PinInfo {
+	if info, ok := spt.getOperation(c); ok {
+		return info
+	}
+
+	info := api.PinInfo{
+		Cid:    c,
+		Peer:   spt.peerID,
+		Status: api.TrackerStatusUnpinned,
+		TS:     time.Now(),
+	}
+
+	var pinS api.PinSerial
+	err := spt.rpcClient.Call(
+		"",
+		"Cluster",
+		"PinGet",
+		api.PinCid(c).ToSerial(),
+		&pinS,
+	)
+	if err != nil { // not in the shared state
+		return info
+	}
+
+	if spt.isRemote(pinS.ToPin()) {
+		info.Status = api.TrackerStatusRemote
+		return info
+	}
+
+	var ips api.IPFSPinStatus
+	err = spt.rpcClient.Call(
+		"",
+		"Cluster",
+		"IPFSPinLsCid",
+		api.PinCid(c).ToSerial(),
+		&ips,
+	)
+	switch {
+	case err != nil:
+		info.Status = api.TrackerStatusPinError
+		info.Error = err.Error()
+	case ips.IsPinned():
+		info.Status = api.TrackerStatusPinned
+	default:
+		info.Status = api.TrackerStatusPinError
+		info.Error = errUnpinned.Error()
+	}
+	return info
+}
+
+// ipfsPins lists the recursive and the direct pins in the IPFS daemon.
+func (spt *StatelessPinTracker) ipfsPins() (map[string]api.IPFSPinStatus, error) {
+	ipsMap := make(map[string]api.IPFSPinStatus)
+	for _, typeFilter := range []string{"recursive", "direct"} {
+		var pins map[string]api.IPFSPinStatus
+		err := spt.rpcClient.Call(
+			"",
+			"Cluster",
+			"IPFSPinLs",
+			typeFilter,
+			&pins,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range pins {
+			if _, ok := ipsMap[k]; !ok {
+				ipsMap[k] = v
+			}
+		}
+	}
+	return ipsMap, nil
+}
+
+// StatusAll returns the local status of all the pins in the shared state,
+// along with the unpin operations in progress or which failed.
+func (spt *StatelessPinTracker) StatusAll() []api.PinInfo {
+	var pinsS []api.PinSerial
+	err := spt.rpcClient.Call(
+		"",
+		"Cluster",
+		"Pins",
+		struct{}{},
+		&pinsS,
+	)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+
+	ipsMap, ipfsErr := spt.ipfsPins()
+
+	spt.opsMux.RLock()
+	defer spt.opsMux.RUnlock()
+
+	now := time.Now()
+	pins := make([]api.PinInfo, 0, len(pinsS))
+	seen := make(map[string]struct{}, len(spt.ops))
+	for _, pinS := range pinsS {
+		pin := pinS.ToPin()
+		if op, ok := spt.ops[pinS.Cid]; ok {
+			pins = append(pins, spt.operationInfo(op))
+			seen[pinS.Cid] = struct{}{}
+			continue
+		}
+
+		info := api.PinInfo{
+			Cid:    pin.Cid,
+			Peer:   spt.peerID,
+			Status: api.TrackerStatusPinned,
+			TS:     now,
+		}
+		switch {
+		case spt.isRemote(pin):
+			info.Status = api.TrackerStatusRemote
+		case ipfsErr != nil:
+			info.Status = api.TrackerStatusPinError
+			info.Error = ipfsErr.Error()
+		case !ipsMap[pinS.Cid].IsPinned():
+			info.Status = api.TrackerStatusPinError
+			info.Error = errUnpinned.Error()
+		}
+		pins = append(pins, info)
+	}
+
+	// operations on items which are not in the shared state anymore
+	for k, op := range spt.ops {
+		if _, ok := seen[k]; !ok {
+			pins = append(pins, spt.operationInfo(op))
+		}
+	}
+	return pins
+}
+
+// Sync returns the local status of a Cid. The StatelessPinTracker always
+// obtains it from the IPFS daemon, so there is nothing to update.
+func (spt *StatelessPinTracker) Sync(c *cid.Cid) (api.PinInfo, error) {
+	return spt.Status(c), nil
+}
+
+// SyncAll returns the local status of the items in error states. The
+// StatelessPinTracker always obtains it from the IPFS daemon, so there is
+// nothing to update. Cids in error states can be recovered with Recover().
+func (spt *StatelessPinTracker) SyncAll() ([]api.PinInfo, error) {
+	var pInfos []api.PinInfo
+	for _, info := range spt.StatusAll() {
+		switch info.Status {
+		case api.TrackerStatusPinError, api.TrackerStatusUnpinError:
+			pInfos = append(pInfos, info)
+		}
+	}
+	return pInfos, nil
+}
+
+// Recover will re-track or re-untrack a Cid in error state,
+// possibly retriggering an IPFS pinning operation and returning
+// only when it is done. The pinning/unpinning operation happens
+// synchronously, jumping the queues.
+func (spt *StatelessPinTracker) Recover(c *cid.Cid) (api.PinInfo, error) {
+	info := spt.Status(c)
+	logger.Infof("Attempting to recover %s", c)
+
+	var op *operation
+	switch info.Status {
+	case api.TrackerStatusPinError:
+		pin := api.PinCid(c)
+		var pinS api.PinSerial
+		err := spt.rpcClient.Call("", "Cluster", "PinGet", pin.ToSerial(), &pinS)
+		if err == nil {
+			pin = pinS.ToPin()
+		}
+		op = spt.newOperation(pin, operationPin)
+	case api.TrackerStatusUnpinError:
+		op = spt.newOperation(spt.unpinRequest(c), operationUnpin)
+	default:
+		logger.Warningf("%s does not need recovery", c)
+		return info, nil
+	}
+
+	if op == nil { // already in progress
+		return spt.Status(c), nil
+	}
+	err := spt.run(op)
+	if err != nil {
+		logger.Errorf("error recovering %s: %s", c, err)
+	}
+	return spt.Status(c), err
+}
+
+// RecoverAll attempts to recover all items in error states.
+func (spt *StatelessPinTracker) RecoverAll() ([]api.PinInfo, error) {
+	statuses, _ := spt.SyncAll()
+	resp := make([]api.PinInfo, 0)
+	for _, st := range statuses {
+		r, err := spt.Recover(st.Cid)
+		if err != nil {
+			return resp, err
+		}
+		resp = append(resp, r)
+	}
+	return resp, nil
+}
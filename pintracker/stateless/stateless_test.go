@@ -0,0 +1,423 @@
+package stateless
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+// mockService keeps a shared state and the pins of an IPFS daemon.
+type mockService struct {
+	mu     sync.Mutex
+	state  map[string]api.PinSerial
+	pinned map[string]bool
+	order  []string // cids in the order they were pinned
+}
+
+func newMockService() *mockService {
+	return &mockService{
+		state:  make(map[string]api.PinSerial),
+		pinned: make(map[string]bool),
+	}
+}
+
+func (mock *mockService) addPin(c string, allocations ...peer.ID) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	h, _ := cid.Decode(c)
+	pin := api.PinCid(h)
+	pin.ReplicationFactorMin = -1
+	pin.ReplicationFactorMax = -1
+	if len(allocations) > 0 {
+		pin.ReplicationFactorMin = len(allocations)
+		pin.ReplicationFactorMax = len(allocations)
+		pin.Allocations = allocations
+	}
+	mock.state[c] = pin.ToSerial()
+}
+
+func (mock *mockService) rmPin(c string) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	delete(mock.state, c)
+}
+
+func (mock *mockService) isPinned(c string) bool {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	return mock.pinned[c]
+}
+
+func (mock *mockService) setPinned(c string, pinned bool) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	mock.pinned[c] = pinned
+	if pinned {
+		mock.order = append(mock.order, c)
+	}
+}
+
+func (mock *mockService) pinOrder() []string {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	return append([]string{}, mock.order...)
+}
+
+func (mock *mockService) Pins(ctx context.Context, in struct{}, out *[]api.PinSerial) error {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	for _, p := range mock.state {
+		*out = append(*out, p)
+	}
+	return nil
+}
+
+func (mock *mockService) PinGet(ctx context.Context, in api.PinSerial, out *api.PinSerial) error {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	p, ok := mock.state[in.Cid]
+	if !ok {
+		return errors.New("cid is not part of the global state")
+	}
+	*out = p
+	return nil
+}
+
+func (mock *mockService) IPFSPin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	switch in.Cid {
+	case test.ErrorCid:
+		return errors.New("expected error when using ErrorCid")
+	case test.TestSlowCid1:
+		select {
+		case <-time.After(2 * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	mock.setPinned(in.Cid, true)
+	return nil
+}
+
+func (mock *mockService) IPFSUnpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	mock.setPinned(in.Cid, false)
+	return nil
+}
+
+func (mock *mockService) IPFSPinLsCid(ctx context.Context, in api.PinSerial, out *api.IPFSPinStatus) error {
+	*out = api.IPFSPinStatusUnpinned
+	if mock.isPinned(in.Cid) {
+		*out = api.IPFSPinStatusRecursive
+	}
+	return nil
+}
+
+func (mock *mockService) IPFSPinLs(ctx context.Context, in string, out *map[string]api.IPFSPinStatus) error {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	m := make(map[string]api.IPFSPinStatus)
+	for k, v := range mock.pinned {
+		if v {
+			m[k] = api.IPFSPinStatusRecursive
+		}
+	}
+	*out = m
+	return nil
+}
+
+func testStatelessPinTracker(t *testing.T) (*StatelessPinTracker, *mockService) {
+	cfg := &Config{}
+	cfg.Default()
+	spt := NewStatelessPinTracker(cfg, test.TestPeerID1)
+
+	mock := newMockService()
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("Cluster", mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spt.SetClient(c)
+	return spt, mock
+}
+
+func waitForStatus(t *testing.T, spt *StatelessPinTracker, c *cid.Cid, status api.TrackerStatus) {
+	for i := 0; i < 50; i++ {
+		if spt.Status(c).Status == status {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("expected %s to be %s, got %s", c, status, spt.Status(c).Status)
+}
+
+func TestNew(t *testing.T) {
+	spt, _ := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+}
+
+func TestShutdown(t *testing.T) {
+	spt, _ := testStatelessPinTracker(t)
+	err := spt.Shutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spt.Shutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrackUntrack(t *testing.T) {
+	spt, mock := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.TestCid1)
+	mock.addPin(test.TestCid1)
+	err := spt.Track(api.Pin{Cid: h, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, spt, h, api.TrackerStatusPinned)
+	if !mock.isPinned(test.TestCid1) {
+		t.Error("expected the item to be pinned in IPFS")
+	}
+
+	mock.rmPin(test.TestCid1)
+	err = spt.Untrack(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, spt, h, api.TrackerStatusUnpinned)
+	if mock.isPinned(test.TestCid1) {
+		t.Error("expected the item to be unpinned in IPFS")
+	}
+	if len(spt.StatusAll()) != 0 {
+		t.Error("expected no items to be tracked")
+	}
+}
+
+func TestHistoryAndStatusChanges(t *testing.T) {
+	spt, mock := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.TestCid1)
+	mock.addPin(test.TestCid1)
+	spt.Track(api.Pin{Cid: h, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	waitForStatus(t, spt, h, api.TrackerStatusPinned)
+
+	hist := spt.History(h)
+	if len(hist) != 1 || hist[0].Operation != "pin" || hist[0].Error != "" {
+		t.Fatal("expected a successful pin attempt: ", hist)
+	}
+
+	expected := []api.TrackerStatus{
+		api.TrackerStatusPinQueued,
+		api.TrackerStatusPinning,
+		api.TrackerStatusPinned,
+	}
+	for _, status := range expected {
+		select {
+		case pInfo := <-spt.StatusChanges():
+			if pInfo.Status != status || !pInfo.Cid.Equals(h) {
+				t.Errorf("expected %s, got %s", status, pInfo.Status)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected a %s status change", status)
+		}
+	}
+
+	mock.rmPin(test.TestCid1)
+	spt.Untrack(h)
+	waitForStatus(t, spt, h, api.TrackerStatusUnpinned)
+	time.Sleep(100 * time.Millisecond)
+	if len(spt.History(h)) != 0 {
+		t.Error("history should be forgotten after unpinning")
+	}
+}
+
+func TestTrackRemote(t *testing.T) {
+	spt, mock := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.TestCid1)
+	mock.addPin(test.TestCid1, test.TestPeerID2)
+	mock.setPinned(test.TestCid1, true)
+	err := spt.Track(api.Pin{
+		Cid:                  h,
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+		Allocations:          []peer.ID{test.TestPeerID2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, spt, h, api.TrackerStatusRemote)
+	if mock.isPinned(test.TestCid1) {
+		t.Error("remote items should be unpinned in IPFS")
+	}
+}
+
+func TestTrackError(t *testing.T) {
+	spt, mock := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.ErrorCid)
+	mock.addPin(test.ErrorCid)
+	spt.Track(api.Pin{Cid: h, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	waitForStatus(t, spt, h, api.TrackerStatusPinError)
+	if spt.Status(h).Error == "" {
+		t.Error("expected an error message")
+	}
+}
+
+func TestPinRetries(t *testing.T) {
+	spt, mock := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+	spt.config.MaxPinRetries = 1
+	spt.config.PinRetryDelay = 100 * time.Millisecond
+	spt.config.PinRetryMaxDelay = 100 * time.Millisecond
+
+	h, _ := cid.Decode(test.ErrorCid) // pinning it always fails
+	mock.addPin(test.ErrorCid)
+	spt.Track(api.Pin{Cid: h, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	waitForStatus(t, spt, h, api.TrackerStatusPinError)
+	st := spt.Status(h)
+	if st.Attempts != 1 || st.NextRetry.IsZero() {
+		t.Fatalf("expected a retry to be scheduled: %+v", st)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	st = spt.Status(h)
+	if st.Status != api.TrackerStatusPinError || st.Attempts != 2 || !st.NextRetry.IsZero() {
+		t.Fatalf("expected retries to stop after 2 attempts: %+v", st)
+	}
+	if len(spt.History(h)) != 2 {
+		t.Error("expected both attempts in the history")
+	}
+}
+
+func TestUntrackCancelsPin(t *testing.T) {
+	spt, mock := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h, _ := cid.Decode(test.TestSlowCid1)
+	mock.addPin(test.TestSlowCid1)
+	spt.Track(api.Pin{Cid: h, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	waitForStatus(t, spt, h, api.TrackerStatusPinning)
+
+	mock.rmPin(test.TestSlowCid1)
+	spt.Untrack(h)
+	waitForStatus(t, spt, h, api.TrackerStatusUnpinned)
+	if mock.isPinned(test.TestSlowCid1) {
+		t.Error("the pin should have been cancelled")
+	}
+}
+
+func TestPinQueue(t *testing.T) {
+	spt, mock := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	slowH, _ := cid.Decode(test.TestSlowCid1)
+	h, _ := cid.Decode(test.TestCid1)
+	mock.addPin(test.TestSlowCid1)
+	mock.addPin(test.TestCid1)
+	spt.Track(api.Pin{Cid: slowH, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	waitForStatus(t, spt, slowH, api.TrackerStatusPinning)
+	spt.Track(api.Pin{Cid: h, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+
+	queue := spt.PinQueue()
+	if queue.InProgress != 1 || queue.PinQueued != 1 {
+		t.Fatalf("unexpected queue: %+v", queue)
+	}
+	if len(queue.Operations) != 2 || queue.Operations[0].Cid != test.TestSlowCid1 {
+		t.Errorf("unexpected queued operations: %+v", queue.Operations)
+	}
+
+	time.Sleep(2 * time.Second) // let the slow pin finish
+	waitForStatus(t, spt, slowH, api.TrackerStatusPinned)
+	waitForStatus(t, spt, h, api.TrackerStatusPinned)
+	queue = spt.PinQueue()
+	if len(queue.Operations) != 0 || queue.PinsDone != 2 {
+		t.Errorf("unexpected queue after pinning: %+v", queue)
+	}
+}
+
+func TestPinPriority(t *testing.T) {
+	spt, mock := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	slowH, _ := cid.Decode(test.TestSlowCid1)
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	mock.addPin(test.TestSlowCid1)
+	mock.addPin(test.TestCid1)
+	mock.addPin(test.TestCid2)
+
+	// keep the only pin worker busy while the other pins are queued
+	spt.Track(api.Pin{Cid: slowH, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	waitForStatus(t, spt, slowH, api.TrackerStatusPinning)
+	spt.Track(api.Pin{Cid: h1, ReplicationFactorMin: -1, ReplicationFactorMax: -1})
+	spt.Track(api.Pin{Cid: h2, ReplicationFactorMin: -1, ReplicationFactorMax: -1, Priority: api.PinPriorityHigh})
+
+	time.Sleep(2 * time.Second) // let the slow pin finish
+	waitForStatus(t, spt, h1, api.TrackerStatusPinned)
+	waitForStatus(t, spt, h2, api.TrackerStatusPinned)
+
+	order := mock.pinOrder()
+	if len(order) != 3 || order[1] != test.TestCid2 || order[2] != test.TestCid1 {
+		t.Errorf("expected the high priority pin to go first: %v", order)
+	}
+}
+
+func TestStatusAllAndRecover(t *testing.T) {
+	spt, mock := testStatelessPinTracker(t)
+	defer spt.Shutdown()
+
+	h1, _ := cid.Decode(test.TestCid1)
+	h2, _ := cid.Decode(test.TestCid2)
+	h3, _ := cid.Decode(test.TestCid3)
+	mock.addPin(test.TestCid1)
+	mock.addPin(test.TestCid2)
+	mock.addPin(test.TestCid3, test.TestPeerID2)
+	mock.setPinned(test.TestCid1, true)
+
+	expected := map[string]api.TrackerStatus{
+		h1.String(): api.TrackerStatusPinned,
+		h2.String(): api.TrackerStatusPinError, // not pinned in IPFS
+		h3.String(): api.TrackerStatusRemote,
+	}
+	statuses := spt.StatusAll()
+	if len(statuses) != len(expected) {
+		t.Fatalf("expected %d items, got %d", len(expected), len(statuses))
+	}
+	for _, st := range statuses {
+		if st.Status != expected[st.Cid.String()] {
+			t.Errorf("%s: expected %s, got %s", st.Cid, expected[st.Cid.String()], st.Status)
+		}
+	}
+
+	errored, err := spt.SyncAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errored) != 1 || !errored[0].Cid.Equals(h2) {
+		t.Fatal("expected only the unpinned item to be in error")
+	}
+
+	info, err := spt.Recover(h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != api.TrackerStatusPinned {
+		t.Error("expected the item to be pinned after recovering")
+	}
+}
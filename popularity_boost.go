@@ -0,0 +1,188 @@
+package ipfscluster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/informer/popularity"
+)
+
+// popularityMetricName is the name of the metric broadcasted by the
+// popularity informer (informer/popularity) with the number of
+// retrievals of the most popular Cids.
+const popularityMetricName = "popularity"
+
+// popularityBoostKeyPrefix prefixes the keys of the KV records which
+// keep the original replication factors of the boosted pins, so that
+// any leader can restore them.
+const popularityBoostKeyPrefix = "popularity-boost:"
+
+// IPFSRetrievals returns the number of retrievals of every root Cid
+// through the IPFS proxy since the previous call. It is empty when the
+// IPFSConnector does not count them.
+func (c *Cluster) IPFSRetrievals() map[string]uint64 {
+	counter, ok := c.ipfs.(RetrievalCounter)
+	if !ok {
+		return map[string]uint64{}
+	}
+	return counter.Retrievals()
+}
+
+// checkPopularity adjusts, in the leader, the replication factors of the
+// pins according to their popularity. It boosts the replication factors
+// of the pins retrieved more than PopularityHotThreshold times and
+// restores those of the boosted pins once they have been retrieved
+// PopularityColdThreshold times or less for PopularityCooldown. Only the
+// retrieved and the boosted pins are looked up in the state.
+func (c *Cluster) checkPopularity(snap *stateSnapshot) {
+	retrievals := make(map[string]uint64)
+	for _, m := range c.monitor.LastMetrics(popularityMetricName) {
+		if !m.Valid {
+			continue
+		}
+		for k, n := range popularity.ParseRetrievals(m.Value) {
+			retrievals[k] += n
+		}
+	}
+
+	boosted := make(map[string]api.KV)
+	for _, kv := range snap.ListKV() {
+		if strings.HasPrefix(kv.Key, popularityBoostKeyPrefix) {
+			boosted[strings.TrimPrefix(kv.Key, popularityBoostKeyPrefix)] = kv
+		}
+	}
+
+	for cidStr, n := range retrievals {
+		if _, ok := boosted[cidStr]; ok || n <= uint64(c.config.PopularityHotThreshold) {
+			continue
+		}
+		if pin, ok := snapshotPin(snap, cidStr); ok {
+			c.boostPin(pin)
+		}
+	}
+
+	now := time.Now()
+	c.lastWarmMux.Lock()
+	defer c.lastWarmMux.Unlock()
+	for cidStr, kv := range boosted {
+		pin, ok := snapshotPin(snap, cidStr)
+		if !ok {
+			// Forget the pins which were unpinned while boosted.
+			delete(c.lastWarm, cidStr)
+			if err := c.consensus.LogRmKV(kv.Key); err != nil {
+				logger.Warning(err)
+			}
+			continue
+		}
+
+		if retrievals[cidStr] > uint64(c.config.PopularityColdThreshold) {
+			c.lastWarm[cidStr] = now
+			continue
+		}
+
+		warm, ok := c.lastWarm[cidStr]
+		if !ok {
+			// This leader has not seen the pin warm: count from
+			// the boost.
+			warm = boostTime(kv)
+		}
+		if now.Sub(warm) < c.config.PopularityCooldown {
+			continue
+		}
+		delete(c.lastWarm, cidStr)
+		c.restorePin(pin, kv)
+	}
+}
+
+// snapshotPin returns the pin for a Cid string from the snapshot, and
+// whether it is pinned.
+func snapshotPin(snap *stateSnapshot, cidStr string) (api.Pin, bool) {
+	ci, err := cid.Decode(cidStr)
+	if err != nil || !snap.Has(ci) {
+		return api.Pin{}, false
+	}
+	return snap.Get(ci), true
+}
+
+// boostTime returns the time at which a pin was boosted, as kept in its
+// boost record. Records written before it was kept return the zero
+// time.
+func boostTime(kv api.KV) time.Time {
+	fields := strings.Split(kv.Value, ",")
+	if len(fields) < 3 {
+		return time.Time{}
+	}
+	nsecs, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, nsecs)
+}
+
+// boostPin raises the replication factors of a pin up to
+// PopularityReplicationFactorMax, keeping the original ones and the
+// time of the boost in the shared state. The minimum is bounded by the
+// number of peers which can be allocated.
+func (c *Cluster) boostPin(pin api.Pin) {
+	rplMin, rplMax := pin.ReplicationFactorMin, pin.ReplicationFactorMax
+	boostMax := c.config.PopularityReplicationFactorMax
+	if rplMin == -1 || rplMax >= boostMax {
+		return
+	}
+
+	metrics, err := c.getInformerMetrics()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	boostMin := minInt(boostMax, len(metrics))
+	if boostMin < rplMin {
+		boostMin = rplMin
+	}
+
+	kv := api.KV{
+		Key:   popularityBoostKeyPrefix + pin.Cid.String(),
+		Value: fmt.Sprintf("%d,%d,%d", rplMin, rplMax, time.Now().UnixNano()),
+	}
+	if err := c.consensus.LogSetKV(kv); err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	pin.ReplicationFactorMin = boostMin
+	pin.ReplicationFactorMax = boostMax
+	c.repinWithPopularity(pin, "boosted")
+}
+
+// restorePin sets the original replication factors of a boosted pin
+// back and forgets them.
+func (c *Cluster) restorePin(pin api.Pin, kv api.KV) {
+	var rplMin, rplMax int
+	_, err := fmt.Sscanf(kv.Value, "%d,%d", &rplMin, &rplMax)
+	if err == nil {
+		pin.ReplicationFactorMin = rplMin
+		pin.ReplicationFactorMax = rplMax
+		c.repinWithPopularity(pin, "restored")
+	}
+
+	if err := c.consensus.LogRmKV(kv.Key); err != nil {
+		logger.Warning(err)
+	}
+}
+
+func (c *Cluster) repinWithPopularity(pin api.Pin, action string) {
+	pin, _, err := c.pin(pin, []peer.ID{}, []peer.ID{}, api.AllocationRebalance)
+	if err != nil {
+		logger.Warningf("error adjusting the replication of %s: %s", pin.Cid, err)
+		return
+	}
+	msg := fmt.Sprintf("replication %s to %d-%d", action, pin.ReplicationFactorMin, pin.ReplicationFactorMax)
+	logger.Infof("%s: %s", pin.Cid, msg)
+	c.recordEvent(api.InternalOrigin("popularity"), api.EventPin, pin.Cid, "", msg)
+}
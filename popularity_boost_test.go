@@ -0,0 +1,91 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+// pushPopularity pushes a popularity metric and waits until the monitor
+// has it.
+func pushPopularity(t *testing.T, cl *Cluster, value string) {
+	m := api.Metric{Name: popularityMetricName, Value: value}
+	m.SetTTL(30)
+	if err := cl.PushMetric(m); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		metrics := cl.monitor.LastMetrics(popularityMetricName)
+		if len(metrics) == 1 && metrics[0].Value == value {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("the popularity metric should have reached the monitor")
+}
+
+// waitReplication waits until the pin has the given maximum replication
+// factor.
+func waitReplication(t *testing.T, cl *Cluster, c *cid.Cid, rplMax int) {
+	for i := 0; i < 50; i++ {
+		pin, err := cl.PinGet(c)
+		if err == nil && pin.ReplicationFactorMax == rplMax {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("expected a maximum replication factor of %d", rplMax)
+}
+
+func TestClusterPopularityBoost(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	cl.config.PopularityHotThreshold = 5
+	cl.config.PopularityColdThreshold = 1
+	cl.config.PopularityReplicationFactorMax = 3
+	cl.config.PopularityCooldown = time.Hour
+
+	c, _ := cid.Decode(test.TestCid1)
+	err := cl.Pin(api.Pin{
+		Cid:                  c,
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the allocations need the informer metric
+	for i := 0; i < 50 && len(cl.monitor.LastMetrics(cl.informers[0].Name())) == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	pushPopularity(t, cl, test.TestCid1+"=10")
+	cl.checkPopularity(testStateSnapshot(t, cl))
+	waitReplication(t, cl, c, 3)
+	if _, err := cl.KVGet(popularityBoostKeyPrefix + test.TestCid1); err != nil {
+		t.Error("the original replication factors should be kept")
+	}
+
+	// cold, but not for the whole cool-down
+	pushPopularity(t, cl, test.TestCid1+"=1")
+	cl.checkPopularity(testStateSnapshot(t, cl))
+	time.Sleep(500 * time.Millisecond)
+	if _, err := cl.KVGet(popularityBoostKeyPrefix + test.TestCid1); err != nil {
+		t.Fatal("the pin should stay boosted during the cool-down")
+	}
+
+	cl.config.PopularityCooldown = 0
+	cl.checkPopularity(testStateSnapshot(t, cl))
+	waitReplication(t, cl, c, 1)
+	time.Sleep(500 * time.Millisecond)
+	if _, err := cl.KVGet(popularityBoostKeyPrefix + test.TestCid1); err == nil {
+		t.Error("the original replication factors should be forgotten")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -98,7 +99,8 @@ func (pm *Manager) RmPeer(pid peer.ID) error {
 }
 
 // if the peer has dns addresses, return only those, otherwise
-// return all. In all cases, encapsulate the peer ID.
+// return all, sorted by preference (see api.SortMultiaddrs). In all cases,
+// encapsulate the peer ID.
 func (pm *Manager) filteredPeerAddrs(p peer.ID) []ma.Multiaddr {
 	all := pm.host.Peerstore().Addrs(p)
 	peerAddrs := []ma.Multiaddr{}
@@ -118,6 +120,7 @@ func (pm *Manager) filteredPeerAddrs(p peer.ID) []ma.Multiaddr {
 		return peerDNSAddrs
 	}
 
+	api.SortMultiaddrs(peerAddrs)
 	return peerAddrs
 }
 
@@ -177,18 +180,19 @@ func (pm *Manager) LoadPeerstore() (addrs []ma.Multiaddr) {
 
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		addrStr := scanner.Text()
-		if addrStr[0] != '/' {
+		addrStr := strings.TrimSpace(scanner.Text())
+		if len(addrStr) == 0 || addrStr[0] != '/' {
 			// skip anything that is not going to be a multiaddress
 			continue
 		}
 		addr, err := ma.NewMultiaddr(addrStr)
 		if err != nil {
-			logger.Error(
+			logger.Errorf(
 				"error parsing multiaddress from %s: %s",
 				pm.peerstorePath,
 				err,
 			)
+			continue
 		}
 		addrs = append(addrs, addr)
 	}
@@ -103,3 +103,27 @@ func TestPeerstore(t *testing.T) {
 		t.Error("expected 2 addresses from the peerstore")
 	}
 }
+
+func TestLoadPeerstoreBadLines(t *testing.T) {
+	pm := makeMgr(t)
+	defer clean(pm)
+
+	content := "\n# comment\n/ip4/127.0.0.1/tcp/1234/ipfs/" + pid +
+		"\n/ip4/notanip/tcp/1234\n  /ip6/::1/tcp/1234/ipfs/" + pid + "\n"
+	f, err := os.Create(pm.peerstorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(content))
+	f.Close()
+
+	addrs := pm.LoadPeerstore()
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 valid addresses, got %d", len(addrs))
+	}
+	for _, a := range addrs {
+		if a == nil {
+			t.Error("nil address loaded")
+		}
+	}
+}
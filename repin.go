@@ -0,0 +1,108 @@
+package ipfscluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// When a peer stops responding, the leader re-allocates the pins
+// allocated to it once the RepinDelay has passed, unless the peer comes
+// back before. The pins of removed peers are re-allocated right away.
+// At most RepinConcurrency pins are re-allocated at the same time,
+// shared by all the peers being re-allocated. DisableRepinning turns
+// all of this off.
+
+// scheduleRepin re-allocates the pins of the given peer after the
+// RepinDelay, unless cancelRepin is called before.
+func (c *Cluster) scheduleRepin(p peer.ID) {
+	if c.config.DisableRepinning {
+		logger.Warningf("repinning is disabled. Will not re-allocate cids from %s", p.Pretty())
+		return
+	}
+
+	if c.config.RepinDelay <= 0 {
+		c.repinFromPeer(p)
+		return
+	}
+
+	c.repinMux.Lock()
+	defer c.repinMux.Unlock()
+	if _, ok := c.pendingRepins[p]; ok {
+		return
+	}
+
+	logger.Infof("cids allocated to %s will be re-allocated in %s unless it comes back", p.Pretty(), c.config.RepinDelay)
+	c.pendingRepins[p] = time.AfterFunc(c.config.RepinDelay, func() {
+		c.repinMux.Lock()
+		delete(c.pendingRepins, p)
+		c.repinMux.Unlock()
+
+		if c.ctx.Err() != nil {
+			return
+		}
+		// leadership may have changed in the meantime
+		leader, err := c.consensus.Leader()
+		if err != nil || leader != c.id {
+			return
+		}
+		c.repinFromPeer(p)
+	})
+}
+
+// cancelRepin cancels the re-allocation of the pins of the given peer,
+// if one is scheduled.
+func (c *Cluster) cancelRepin(p peer.ID) {
+	c.repinMux.Lock()
+	defer c.repinMux.Unlock()
+	timer, ok := c.pendingRepins[p]
+	if !ok {
+		return
+	}
+	timer.Stop()
+	delete(c.pendingRepins, p)
+	logger.Infof("cancelled the re-allocation of the cids allocated to %s", p.Pretty())
+}
+
+// repinFromPeer finds all Cids pinned to a given peer and triggers re-pins
+// on them.
+func (c *Cluster) repinFromPeer(p peer.ID) {
+	if c.config.DisableRepinning {
+		logger.Warningf("repinning is disabled. Will not re-allocate cids from %s", p.Pretty())
+		return
+	}
+
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, pin := range cState.ListAllocatedTo(p) {
+		if !containsPeer(pin.Allocations, p) { // replicated everywhere
+			continue
+		}
+
+		select {
+		case c.repinSem <- struct{}{}:
+		case <-c.ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(pin api.Pin) {
+			defer wg.Done()
+			defer func() { <-c.repinSem }()
+			_, ok, err := c.pin(pin, []peer.ID{p}, []peer.ID{}, api.AllocationFailure) // pin blacklisting this peer
+			if ok && err == nil {
+				logger.Infof("repinned %s out of %s", pin.Cid, p.Pretty())
+				c.recordEvent(api.InternalOrigin("repin"), api.EventRepin, pin.Cid, p, "")
+			}
+		}(pin)
+	}
+	wg.Wait()
+}
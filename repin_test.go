@@ -0,0 +1,51 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func isRepinPending(cl *Cluster) bool {
+	cl.repinMux.Lock()
+	defer cl.repinMux.Unlock()
+	_, ok := cl.pendingRepins[test.TestPeerID1]
+	return ok
+}
+
+func TestClusterScheduleRepin(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	cl.config.RepinDelay = time.Minute
+	cl.scheduleRepin(test.TestPeerID1)
+	if !isRepinPending(cl) {
+		t.Fatal("the re-allocation should have been scheduled")
+	}
+
+	cl.cancelRepin(test.TestPeerID1)
+	if isRepinPending(cl) {
+		t.Fatal("the re-allocation should have been cancelled")
+	}
+
+	cl.config.DisableRepinning = true
+	cl.scheduleRepin(test.TestPeerID1)
+	if isRepinPending(cl) {
+		t.Fatal("the re-allocation should not be scheduled when repinning is disabled")
+	}
+}
+
+func TestClusterScheduleRepinDelay(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	cl.config.RepinDelay = 100 * time.Millisecond
+	cl.scheduleRepin(test.TestPeerID1)
+	time.Sleep(time.Second)
+	if isRepinPending(cl) {
+		t.Fatal("the re-allocation should have happened")
+	}
+}
@@ -3,7 +3,9 @@ package ipfscluster
 import (
 	"context"
 	"errors"
+	"time"
 
+	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
@@ -33,13 +35,97 @@ func (rpcapi *RPCAPI) ID(ctx context.Context, in struct{}, out *api.IDSerial) er
 
 // Pin runs Cluster.Pin().
 func (rpcapi *RPCAPI) Pin(ctx context.Context, in api.PinSerial, out *struct{}) error {
-	return rpcapi.c.Pin(in.ToPin())
+	pin := in.ToPin()
+	if err := pin.Validate(); err != nil {
+		return err
+	}
+	_, err := rpcapi.c.pinWithResult(api.OriginFromContext(ctx), pin)
+	return err
+}
+
+// PinBatch runs Cluster.PinBatch().
+func (rpcapi *RPCAPI) PinBatch(ctx context.Context, in []api.PinSerial, out *struct{}) error {
+	pins := make([]api.Pin, len(in), len(in))
+	for i, p := range in {
+		pins[i] = p.ToPin()
+		if err := pins[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return rpcapi.c.pinBatch(api.OriginFromContext(ctx), pins)
+}
+
+// PinWithResult runs Cluster.PinWithResult().
+func (rpcapi *RPCAPI) PinWithResult(ctx context.Context, in api.PinSerial, out *api.PinResult) error {
+	pin := in.ToPin()
+	if err := pin.Validate(); err != nil {
+		return err
+	}
+	res, err := rpcapi.c.pinWithResult(api.OriginFromContext(ctx), pin)
+	*out = res
+	return err
+}
+
+// PinOverwrite runs Cluster.PinOverwrite().
+func (rpcapi *RPCAPI) PinOverwrite(ctx context.Context, in api.PinSerial, out *api.PinResult) error {
+	pin := in.ToPin()
+	if err := pin.Validate(); err != nil {
+		return err
+	}
+	res, err := rpcapi.c.pinWithPolicy(api.OriginFromContext(ctx), pin, PinMergeOverwrite)
+	*out = res
+	return err
+}
+
+// PinUpdate runs Cluster.PinUpdate().
+func (rpcapi *RPCAPI) PinUpdate(ctx context.Context, in api.PinUpdateRequest, out *api.PinSerial) error {
+	from, err := cid.Decode(in.From)
+	if err != nil {
+		return err
+	}
+	to, err := cid.Decode(in.To)
+	if err != nil {
+		return err
+	}
+	pin, err := rpcapi.c.pinUpdate(api.OriginFromContext(ctx), from, to, in.Unpin)
+	*out = pin.ToSerial()
+	return err
+}
+
+// Add runs Cluster.Add().
+func (rpcapi *RPCAPI) Add(ctx context.Context, in api.AddRequest, out *[]api.AddedOutput) error {
+	added, err := rpcapi.c.add(ctx, api.OriginFromContext(ctx), in)
+	*out = added
+	return err
+}
+
+// ImportCAR runs Cluster.ImportCAR().
+func (rpcapi *RPCAPI) ImportCAR(ctx context.Context, in api.CARImportRequest, out *[]api.PinSerial) error {
+	pins, err := rpcapi.c.importCAR(ctx, api.OriginFromContext(ctx), in)
+	serials := make([]api.PinSerial, 0, len(pins))
+	for _, pin := range pins {
+		serials = append(serials, pin.ToSerial())
+	}
+	*out = serials
+	return err
+}
+
+// ExportCAR runs Cluster.ExportCAR().
+func (rpcapi *RPCAPI) ExportCAR(ctx context.Context, in api.CARExportRequest, out *struct{}) error {
+	c, err := cid.Decode(in.Cid)
+	if err != nil {
+		return err
+	}
+	if in.Writer == nil {
+		return errors.New("nowhere to export to")
+	}
+	return rpcapi.c.exportCAR(ctx, c, in.Writer)
 }
 
 // Unpin runs Cluster.Unpin().
 func (rpcapi *RPCAPI) Unpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
 	c := in.ToPin().Cid
-	return rpcapi.c.Unpin(c)
+	return rpcapi.c.unpin(api.OriginFromContext(ctx), c)
 }
 
 // Pins runs Cluster.Pins().
@@ -63,6 +149,80 @@ func (rpcapi *RPCAPI) PinGet(ctx context.Context, in api.PinSerial, out *api.Pin
 	return err
 }
 
+// AllocationPreview runs Cluster.AllocationPreview().
+func (rpcapi *RPCAPI) AllocationPreview(ctx context.Context, in api.PinSerial, out *api.PinSerial) error {
+	pin := in.ToPin()
+	if err := pin.Validate(); err != nil {
+		return err
+	}
+	preview, err := rpcapi.c.AllocationPreview(pin)
+	if err == nil {
+		*out = preview.ToSerial()
+	}
+	return err
+}
+
+// PinEstimate runs Cluster.PinEstimate().
+func (rpcapi *RPCAPI) PinEstimate(ctx context.Context, in api.PinSerial, out *api.PinEstimate) error {
+	pin := in.ToPin()
+	if err := pin.Validate(); err != nil {
+		return err
+	}
+	est, err := rpcapi.c.PinEstimate(ctx, pin)
+	*out = est
+	return err
+}
+
+// KVs runs Cluster.KVs().
+func (rpcapi *RPCAPI) KVs(ctx context.Context, in struct{}, out *[]api.KV) error {
+	*out = rpcapi.c.KVs()
+	return nil
+}
+
+// KVGet runs Cluster.KVGet().
+func (rpcapi *RPCAPI) KVGet(ctx context.Context, in string, out *api.KV) error {
+	kv, err := rpcapi.c.KVGet(in)
+	*out = kv
+	return err
+}
+
+// KVSet runs Cluster.KVSet().
+func (rpcapi *RPCAPI) KVSet(ctx context.Context, in api.KV, out *struct{}) error {
+	return rpcapi.c.KVSet(in)
+}
+
+// AnnotatePeer runs Cluster.AnnotatePeer().
+func (rpcapi *RPCAPI) AnnotatePeer(ctx context.Context, in api.PeerAnnotation, out *struct{}) error {
+	pid, err := peer.IDB58Decode(in.Peer)
+	if err != nil {
+		return err
+	}
+	return rpcapi.c.AnnotatePeer(pid, in.Annotation)
+}
+
+// KVRm runs Cluster.KVRm().
+func (rpcapi *RPCAPI) KVRm(ctx context.Context, in string, out *struct{}) error {
+	return rpcapi.c.KVRm(in)
+}
+
+// Webhooks runs Cluster.Webhooks().
+func (rpcapi *RPCAPI) Webhooks(ctx context.Context, in struct{}, out *[]api.Webhook) error {
+	*out = rpcapi.c.Webhooks()
+	return nil
+}
+
+// WebhookAdd runs Cluster.WebhookAdd().
+func (rpcapi *RPCAPI) WebhookAdd(ctx context.Context, in api.Webhook, out *api.Webhook) error {
+	wh, err := rpcapi.c.WebhookAdd(in)
+	*out = wh
+	return err
+}
+
+// WebhookRm runs Cluster.WebhookRm().
+func (rpcapi *RPCAPI) WebhookRm(ctx context.Context, in string, out *struct{}) error {
+	return rpcapi.c.WebhookRm(in)
+}
+
 // Version runs Cluster.Version().
 func (rpcapi *RPCAPI) Version(ctx context.Context, in struct{}, out *api.Version) error {
 	*out = api.Version{
@@ -71,6 +231,154 @@ func (rpcapi *RPCAPI) Version(ctx context.Context, in struct{}, out *api.Version
 	return nil
 }
 
+// Features runs Cluster.Features().
+func (rpcapi *RPCAPI) Features(ctx context.Context, in struct{}, out *[]api.FeatureSupport) error {
+	support, err := rpcapi.c.Features()
+	*out = support
+	return err
+}
+
+// MetricsSince runs Cluster.MetricsSince().
+func (rpcapi *RPCAPI) MetricsSince(ctx context.Context, in api.MetricsQuery, out *[]api.MetricSerial) error {
+	metrics, err := rpcapi.c.MetricsSince(in.Name, in.Peer, in.Since)
+	*out = metricsToSerial(metrics)
+	return err
+}
+
+func metricsToSerial(metrics []api.Metric) []api.MetricSerial {
+	serials := make([]api.MetricSerial, len(metrics), len(metrics))
+	for i, m := range metrics {
+		serials[i] = m.ToSerial()
+	}
+	return serials
+}
+
+// PushMetric runs Cluster.PushMetric().
+func (rpcapi *RPCAPI) PushMetric(ctx context.Context, in api.MetricSerial, out *struct{}) error {
+	return rpcapi.c.PushMetric(in.ToMetric())
+}
+
+// FailPeer runs Cluster.FailPeer().
+func (rpcapi *RPCAPI) FailPeer(ctx context.Context, in api.FailPeerRequest, out *struct{}) error {
+	return rpcapi.c.FailPeer(in.Peer, in.Duration)
+}
+
+// PeerLatencies runs Cluster.PeerLatencies().
+func (rpcapi *RPCAPI) PeerLatencies(ctx context.Context, in time.Duration, out *[]api.PeerLatency) error {
+	latencies, err := rpcapi.c.PeerLatencies(ctx, in)
+	*out = latencies
+	return err
+}
+
+// ShutdownAll runs Cluster.ShutdownAll().
+func (rpcapi *RPCAPI) ShutdownAll(ctx context.Context, in struct{}, out *struct{}) error {
+	return rpcapi.c.ShutdownAll()
+}
+
+// ShutdownLocal runs Cluster.ShutdownLocal().
+func (rpcapi *RPCAPI) ShutdownLocal(ctx context.Context, in struct{}, out *struct{}) error {
+	return rpcapi.c.ShutdownLocal()
+}
+
+// PausePinsLocal runs Cluster.PausePinsLocal().
+func (rpcapi *RPCAPI) PausePinsLocal(ctx context.Context, in struct{}, out *struct{}) error {
+	rpcapi.c.PausePinsLocal()
+	return nil
+}
+
+// ResumePinsLocal runs Cluster.ResumePinsLocal().
+func (rpcapi *RPCAPI) ResumePinsLocal(ctx context.Context, in struct{}, out *struct{}) error {
+	rpcapi.c.ResumePinsLocal()
+	return nil
+}
+
+// Unquarantine runs Cluster.Unquarantine().
+func (rpcapi *RPCAPI) Unquarantine(ctx context.Context, in peer.ID, out *struct{}) error {
+	return rpcapi.c.Unquarantine(in)
+}
+
+// StrayPins runs Cluster.StrayPins().
+func (rpcapi *RPCAPI) StrayPins(ctx context.Context, in struct{}, out *[]api.StrayPin) error {
+	strays, err := rpcapi.c.StrayPins()
+	*out = strays
+	return err
+}
+
+// StrayPinsLocal runs Cluster.StrayPinsLocal().
+func (rpcapi *RPCAPI) StrayPinsLocal(ctx context.Context, in struct{}, out *[]api.StrayPin) error {
+	strays, err := rpcapi.c.StrayPinsLocal()
+	*out = strays
+	return err
+}
+
+// RemediateStrayPin runs Cluster.RemediateStrayPin().
+func (rpcapi *RPCAPI) RemediateStrayPin(ctx context.Context, in api.StrayPinRemediation, out *struct{}) error {
+	p, err := peer.IDB58Decode(in.Peer)
+	if err != nil {
+		return err
+	}
+	h, err := cid.Decode(in.Cid)
+	if err != nil {
+		return err
+	}
+	return rpcapi.c.RemediateStrayPin(p, h, in.Action)
+}
+
+// RemediateStrayPinLocal runs Cluster.RemediateStrayPinLocal().
+func (rpcapi *RPCAPI) RemediateStrayPinLocal(ctx context.Context, in api.StrayPinRemediation, out *struct{}) error {
+	h, err := cid.Decode(in.Cid)
+	if err != nil {
+		return err
+	}
+	return rpcapi.c.RemediateStrayPinLocal(h, in.Action)
+}
+
+// LastMetrics runs Cluster.LastMetrics().
+func (rpcapi *RPCAPI) LastMetrics(ctx context.Context, in string, out *[]api.MetricSerial) error {
+	metrics, err := rpcapi.c.LastMetrics(in)
+	*out = metricsToSerial(metrics)
+	return err
+}
+
+// PeerMetrics runs Cluster.PeerMetrics().
+func (rpcapi *RPCAPI) PeerMetrics(ctx context.Context, in peer.ID, out *[]api.MetricSerial) error {
+	metrics, err := rpcapi.c.PeerMetrics(in)
+	*out = metricsToSerial(metrics)
+	return err
+}
+
+// Observations runs Cluster.Observations().
+func (rpcapi *RPCAPI) Observations(ctx context.Context, in struct{}, out *[]api.Observation) error {
+	*out = rpcapi.c.Observations()
+	return nil
+}
+
+// Readiness runs Cluster.Readiness().
+func (rpcapi *RPCAPI) Readiness(ctx context.Context, in struct{}, out *api.Readiness) error {
+	*out = rpcapi.c.Readiness()
+	return nil
+}
+
+// RaftHealth runs Cluster.RaftHealth().
+func (rpcapi *RPCAPI) RaftHealth(ctx context.Context, in struct{}, out *api.RaftHealth) error {
+	health, err := rpcapi.c.RaftHealth()
+	*out = health
+	return err
+}
+
+// PinQueue runs Cluster.PinQueue().
+func (rpcapi *RPCAPI) PinQueue(ctx context.Context, in struct{}, out *api.PinQueue) error {
+	queue, err := rpcapi.c.PinQueue()
+	*out = queue
+	return err
+}
+
+// Events runs Cluster.Events().
+func (rpcapi *RPCAPI) Events(ctx context.Context, in time.Time, out *[]api.Event) error {
+	*out = rpcapi.c.Events(in)
+	return nil
+}
+
 // Peers runs Cluster.Peers().
 func (rpcapi *RPCAPI) Peers(ctx context.Context, in struct{}, out *[]api.IDSerial) error {
 	peers := rpcapi.c.Peers()
@@ -85,7 +393,7 @@ func (rpcapi *RPCAPI) Peers(ctx context.Context, in struct{}, out *[]api.IDSeria
 // PeerAdd runs Cluster.PeerAdd().
 func (rpcapi *RPCAPI) PeerAdd(ctx context.Context, in api.MultiaddrSerial, out *api.IDSerial) error {
 	addr := in.ToMultiaddr()
-	id, err := rpcapi.c.PeerAdd(addr)
+	id, err := rpcapi.c.peerAdd(api.OriginFromContext(ctx), addr)
 	*out = id.ToSerial()
 	return err
 }
@@ -99,7 +407,21 @@ func (rpcapi *RPCAPI) ConnectGraph(ctx context.Context, in struct{}, out *api.Co
 
 // PeerRemove runs Cluster.PeerRm().
 func (rpcapi *RPCAPI) PeerRemove(ctx context.Context, in peer.ID, out *struct{}) error {
-	return rpcapi.c.PeerRemove(in)
+	return rpcapi.c.peerRemove(api.OriginFromContext(ctx), in)
+}
+
+// PeerLeave runs Cluster.PeerDrain() or, when not draining,
+// Cluster.PeerRemove().
+func (rpcapi *RPCAPI) PeerLeave(ctx context.Context, in api.PeerLeaveRequest, out *struct{}) error {
+	pid, err := peer.IDB58Decode(in.Peer)
+	if err != nil {
+		return err
+	}
+	origin := api.OriginFromContext(ctx)
+	if in.Drain {
+		return rpcapi.c.peerDrain(ctx, origin, pid)
+	}
+	return rpcapi.c.peerRemove(origin, pid)
 }
 
 // Join runs Cluster.Join().
@@ -116,6 +438,17 @@ func (rpcapi *RPCAPI) StatusAll(ctx context.Context, in struct{}, out *[]api.Glo
 	return err
 }
 
+// StatusCids runs Cluster.StatusCids().
+func (rpcapi *RPCAPI) StatusCids(ctx context.Context, in []string, out *[]api.GlobalPinInfoSerial) error {
+	cids, err := decodeCids(in)
+	if err != nil {
+		return err
+	}
+	pinfos, err := rpcapi.c.StatusCids(cids)
+	*out = globalPinInfoSliceToSerial(pinfos)
+	return err
+}
+
 // StatusAllLocal runs Cluster.StatusAllLocal().
 func (rpcapi *RPCAPI) StatusAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	pinfos := rpcapi.c.StatusAllLocal()
@@ -131,6 +464,36 @@ func (rpcapi *RPCAPI) Status(ctx context.Context, in api.PinSerial, out *api.Glo
 	return err
 }
 
+// PinHistory runs Cluster.PinHistory().
+func (rpcapi *RPCAPI) PinHistory(ctx context.Context, in api.PinSerial, out *[]api.PinAttempt) error {
+	c := in.ToPin().Cid
+	history, err := rpcapi.c.PinHistory(c)
+	*out = history
+	return err
+}
+
+// PinHistoryLocal runs Cluster.PinHistoryLocal().
+func (rpcapi *RPCAPI) PinHistoryLocal(ctx context.Context, in api.PinSerial, out *[]api.PinAttempt) error {
+	c := in.ToPin().Cid
+	*out = rpcapi.c.PinHistoryLocal(c)
+	return nil
+}
+
+// AllocationHistory runs Cluster.AllocationHistory().
+func (rpcapi *RPCAPI) AllocationHistory(ctx context.Context, in api.PinSerial, out *[]api.AllocationChange) error {
+	c := in.ToPin().Cid
+	history, err := rpcapi.c.AllocationHistory(c)
+	*out = history
+	return err
+}
+
+// AllocationHistoryLocal runs Cluster.AllocationHistoryLocal().
+func (rpcapi *RPCAPI) AllocationHistoryLocal(ctx context.Context, in api.PinSerial, out *[]api.AllocationChange) error {
+	c := in.ToPin().Cid
+	*out = rpcapi.c.AllocationHistoryLocal(c)
+	return nil
+}
+
 // StatusLocal runs Cluster.StatusLocal().
 func (rpcapi *RPCAPI) StatusLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
 	c := in.ToPin().Cid
@@ -208,26 +571,38 @@ func (rpcapi *RPCAPI) Track(ctx context.Context, in api.PinSerial, out *struct{}
 	return rpcapi.c.tracker.Track(in.ToPin())
 }
 
-// Untrack runs PinTracker.Untrack().
+// Untrack runs PinTracker.Untrack() and forgets the allocation history
+// of the unpinned item.
 func (rpcapi *RPCAPI) Untrack(ctx context.Context, in api.PinSerial, out *struct{}) error {
 	c := in.ToPin().Cid
+	rpcapi.c.allocHistory.forget(c)
 	return rpcapi.c.tracker.Untrack(c)
 }
 
-// TrackerStatusAll runs PinTracker.StatusAll().
+// TrackerStatusAll runs Cluster.StatusAllLocal().
 func (rpcapi *RPCAPI) TrackerStatusAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
-	*out = pinInfoSliceToSerial(rpcapi.c.tracker.StatusAll())
+	*out = pinInfoSliceToSerial(rpcapi.c.StatusAllLocal())
 	return nil
 }
 
-// TrackerStatus runs PinTracker.Status().
+// TrackerStatus runs Cluster.StatusLocal().
 func (rpcapi *RPCAPI) TrackerStatus(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
 	c := in.ToPin().Cid
-	pinfo := rpcapi.c.tracker.Status(c)
+	pinfo := rpcapi.c.StatusLocal(c)
 	*out = pinfo.ToSerial()
 	return nil
 }
 
+// TrackerStatusCids runs Cluster.StatusCidsLocal().
+func (rpcapi *RPCAPI) TrackerStatusCids(ctx context.Context, in []string, out *[]api.PinInfoSerial) error {
+	cids, err := decodeCids(in)
+	if err != nil {
+		return err
+	}
+	*out = pinInfoSliceToSerial(rpcapi.c.StatusCidsLocal(cids))
+	return nil
+}
+
 // TrackerRecoverAll runs PinTracker.RecoverAll().
 func (rpcapi *RPCAPI) TrackerRecoverAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	pinfos, err := rpcapi.c.tracker.RecoverAll()
@@ -249,15 +624,12 @@ func (rpcapi *RPCAPI) TrackerRecover(ctx context.Context, in api.PinSerial, out
 
 // IPFSPin runs IPFSConnector.Pin().
 func (rpcapi *RPCAPI) IPFSPin(ctx context.Context, in api.PinSerial, out *struct{}) error {
-	c := in.ToPin().Cid
-	r := in.ToPin().Recursive
-	return rpcapi.c.ipfs.Pin(ctx, c, r)
+	return rpcapi.c.ipfsPin(ctx, in.ToPin())
 }
 
 // IPFSUnpin runs IPFSConnector.Unpin().
 func (rpcapi *RPCAPI) IPFSUnpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
-	c := in.ToPin().Cid
-	return rpcapi.c.ipfs.Unpin(ctx, c)
+	return rpcapi.c.ipfsUnpin(ctx, in.ToPin())
 }
 
 // IPFSPinLsCid runs IPFSConnector.PinLsCid().
@@ -302,6 +674,28 @@ func (rpcapi *RPCAPI) IPFSRepoSize(ctx context.Context, in struct{}, out *uint64
 	return err
 }
 
+// IPFSRepoGC runs IPFSConnector.RepoGC(), when supported.
+func (rpcapi *RPCAPI) IPFSRepoGC(ctx context.Context, in struct{}, out *struct{}) error {
+	gc, ok := rpcapi.c.ipfs.(GarbageCollector)
+	if !ok {
+		return errors.New("the IPFS connector does not support garbage collection")
+	}
+	return gc.RepoGC(ctx)
+}
+
+// IPFSBandwidthStats runs IPFSConnector.BandwidthStats().
+func (rpcapi *RPCAPI) IPFSBandwidthStats(ctx context.Context, in struct{}, out *api.IPFSBandwidth) error {
+	res, err := rpcapi.c.ipfs.BandwidthStats()
+	*out = res
+	return err
+}
+
+// IPFSRetrievals runs Cluster.IPFSRetrievals().
+func (rpcapi *RPCAPI) IPFSRetrievals(ctx context.Context, in struct{}, out *map[string]uint64) error {
+	*out = rpcapi.c.IPFSRetrievals()
+	return nil
+}
+
 // IPFSSwarmPeers runs IPFSConnector.SwarmPeers().
 func (rpcapi *RPCAPI) IPFSSwarmPeers(ctx context.Context, in struct{}, out *api.SwarmPeersSerial) error {
 	res, err := rpcapi.c.ipfs.SwarmPeers()
@@ -325,11 +719,30 @@ func (rpcapi *RPCAPI) ConsensusLogUnpin(ctx context.Context, in api.PinSerial, o
 	return rpcapi.c.consensus.LogUnpin(c)
 }
 
+// ConsensusLogSetKV runs Consensus.LogSetKV().
+func (rpcapi *RPCAPI) ConsensusLogSetKV(ctx context.Context, in api.KV, out *struct{}) error {
+	return rpcapi.c.consensus.LogSetKV(in)
+}
+
+// ConsensusLogRmKV runs Consensus.LogRmKV().
+func (rpcapi *RPCAPI) ConsensusLogRmKV(ctx context.Context, in string, out *struct{}) error {
+	return rpcapi.c.consensus.LogRmKV(in)
+}
+
 // ConsensusAddPeer runs Consensus.AddPeer().
 func (rpcapi *RPCAPI) ConsensusAddPeer(ctx context.Context, in peer.ID, out *struct{}) error {
 	return rpcapi.c.consensus.AddPeer(in)
 }
 
+// ConsensusAddNonVoter runs Consensus.AddNonVoter() when supported.
+func (rpcapi *RPCAPI) ConsensusAddNonVoter(ctx context.Context, in peer.ID, out *struct{}) error {
+	nonVoterCon, ok := rpcapi.c.consensus.(NonVoterConsensus)
+	if !ok {
+		return errors.New("the consensus does not support non-voting peers")
+	}
+	return nonVoterCon.AddNonVoter(in)
+}
+
 // ConsensusRmPeer runs Consensus.RmPeer().
 func (rpcapi *RPCAPI) ConsensusRmPeer(ctx context.Context, in peer.ID, out *struct{}) error {
 	return rpcapi.c.consensus.RmPeer(in)
@@ -364,10 +777,10 @@ func (rpcapi *RPCAPI) PeerManagerImportAddresses(ctx context.Context, in api.Mul
    PeerMonitor
 */
 
-// PeerMonitorLogMetric runs PeerMonitor.LogMetric().
+// PeerMonitorLogMetric runs PeerMonitor.LogMetric() for metrics
+// carrying a valid signature.
 func (rpcapi *RPCAPI) PeerMonitorLogMetric(ctx context.Context, in api.Metric, out *struct{}) error {
-	rpcapi.c.monitor.LogMetric(in)
-	return nil
+	return rpcapi.c.logMetric(in)
 }
 
 // PeerMonitorLastMetrics runs PeerMonitor.LastMetrics().
@@ -376,6 +789,40 @@ func (rpcapi *RPCAPI) PeerMonitorLastMetrics(ctx context.Context, in string, out
 	return nil
 }
 
+// PeerMonitorPeerMetrics runs PeerMonitor.PeerMetrics().
+func (rpcapi *RPCAPI) PeerMonitorPeerMetrics(ctx context.Context, in peer.ID, out *[]api.Metric) error {
+	*out = rpcapi.c.monitor.PeerMetrics(in)
+	return nil
+}
+
+// PeerMonitorFailPeer runs PeerMonitor.FailPeer(). It requires
+// EnableDebugRPC.
+func (rpcapi *RPCAPI) PeerMonitorFailPeer(ctx context.Context, in api.FailPeerRequest, out *struct{}) error {
+	if !rpcapi.c.config.EnableDebugRPC {
+		return errors.New("debug operations are disabled (enable_debug_rpc)")
+	}
+	rpcapi.c.monitor.FailPeer(in.Peer, in.Duration)
+	return nil
+}
+
+// PeerMonitorUnquarantine runs PeerMonitor.Unquarantine().
+func (rpcapi *RPCAPI) PeerMonitorUnquarantine(ctx context.Context, in peer.ID, out *struct{}) error {
+	rpcapi.c.monitor.Unquarantine(in)
+	return nil
+}
+
+// PeerMonitorLatestMetrics runs PeerMonitor.LatestMetrics().
+func (rpcapi *RPCAPI) PeerMonitorLatestMetrics(ctx context.Context, in string, out *[]api.Metric) error {
+	*out = rpcapi.c.monitor.LatestMetrics(in)
+	return nil
+}
+
+// PeerMonitorMetricsSince runs PeerMonitor.MetricsSince().
+func (rpcapi *RPCAPI) PeerMonitorMetricsSince(ctx context.Context, in api.MetricsQuery, out *[]api.Metric) error {
+	*out = rpcapi.c.monitor.MetricsSince(in.Name, in.Peer, in.Since)
+	return nil
+}
+
 /*
    Other
 */
@@ -0,0 +1,210 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+)
+
+// RPCCompressedProtocol is used for RPC between cluster peers which
+// support compression. Peers negotiate it when opening streams and fall
+// back to RPCProtocol when the other side does not support it.
+var RPCCompressedProtocol = protocol.ID(string(RPCProtocol) + "+deflate")
+
+// maxFrameSize limits the size of the frames read from compressed
+// streams, before and after decompression. Larger writes are split in
+// several frames.
+const maxFrameSize = 64 << 20
+
+var errFrameTooLarge = errors.New("compressed stream frame too large")
+
+const (
+	frameRaw byte = iota
+	frameDeflate
+)
+
+// compressingHost wraps a host so that the RPC streams it opens and
+// accepts compress the payloads above a size threshold. It is only
+// handed to the RPC server and client. Compressed streams are always
+// accepted, but only opened while enabled returns true.
+type compressingHost struct {
+	host.Host
+	threshold int
+	enabled   func() bool
+}
+
+func newCompressingHost(h host.Host, threshold int, enabled func() bool) *compressingHost {
+	return &compressingHost{
+		Host:      h,
+		threshold: threshold,
+		enabled:   enabled,
+	}
+}
+
+// SetStreamHandler registers the handler for the given protocol and
+// for its compressed variant.
+func (ch *compressingHost) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	ch.Host.SetStreamHandler(pid, handler)
+	ch.Host.SetStreamHandler(compressedProtocol(pid), func(s inet.Stream) {
+		handler(newCompressedStream(s, ch.threshold))
+	})
+}
+
+// RemoveStreamHandler removes the handlers set by SetStreamHandler.
+func (ch *compressingHost) RemoveStreamHandler(pid protocol.ID) {
+	ch.Host.RemoveStreamHandler(pid)
+	ch.Host.RemoveStreamHandler(compressedProtocol(pid))
+}
+
+// NewStream opens a stream preferring the compressed variant of the
+// given protocols, when enabled.
+func (ch *compressingHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	if !ch.enabled() {
+		return ch.Host.NewStream(ctx, p, pids...)
+	}
+
+	withCompressed := make([]protocol.ID, 0, 2*len(pids))
+	for _, pid := range pids {
+		withCompressed = append(withCompressed, compressedProtocol(pid))
+	}
+	withCompressed = append(withCompressed, pids...)
+
+	s, err := ch.Host.NewStream(ctx, p, withCompressed...)
+	if err != nil {
+		return nil, err
+	}
+	for _, pid := range pids {
+		if s.Protocol() == compressedProtocol(pid) {
+			return newCompressedStream(s, ch.threshold), nil
+		}
+	}
+	return s, nil
+}
+
+func compressedProtocol(pid protocol.ID) protocol.ID {
+	if pid == RPCProtocol {
+		return RPCCompressedProtocol
+	}
+	return protocol.ID(string(pid) + "+deflate")
+}
+
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+// compressedStream sends every Write as a frame: a type byte, the
+// big-endian length of the payload and the payload, which is deflated
+// when the write is larger than the threshold.
+type compressedStream struct {
+	inet.Stream
+	threshold int
+
+	readBuf bytes.Reader
+}
+
+func newCompressedStream(s inet.Stream, threshold int) *compressedStream {
+	return &compressedStream{
+		Stream:    s,
+		threshold: threshold,
+	}
+}
+
+func (cs *compressedStream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+		if err := cs.writeFrame(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (cs *compressedStream) writeFrame(p []byte) error {
+	frameType := frameRaw
+	payload := p
+	if len(p) >= cs.threshold {
+		var buf bytes.Buffer
+		fw := flateWriters.Get().(*flate.Writer)
+		fw.Reset(&buf)
+		fw.Write(p)
+		err := fw.Close()
+		flateWriters.Put(fw)
+		if err != nil {
+			return err
+		}
+		if buf.Len() < len(p) {
+			frameType = frameDeflate
+			payload = buf.Bytes()
+		}
+	}
+
+	header := make([]byte, 5)
+	header[0] = frameType
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	_, err := cs.Stream.Write(append(header, payload...))
+	return err
+}
+
+func (cs *compressedStream) Read(p []byte) (int, error) {
+	if cs.readBuf.Len() == 0 {
+		if err := cs.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	return cs.readBuf.Read(p)
+}
+
+func (cs *compressedStream) readFrame() error {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(cs.Stream, header)
+	if err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return errFrameTooLarge
+	}
+	payload := make([]byte, size)
+	_, err = io.ReadFull(cs.Stream, payload)
+	if err != nil {
+		return err
+	}
+
+	switch header[0] {
+	case frameRaw:
+	case frameDeflate:
+		fr := flate.NewReader(bytes.NewReader(payload))
+		payload, err = ioutil.ReadAll(io.LimitReader(fr, maxFrameSize+1))
+		fr.Close()
+		if err != nil {
+			return err
+		}
+		if len(payload) > maxFrameSize {
+			return errFrameTooLarge
+		}
+	default:
+		return errors.New("unknown compressed stream frame type")
+	}
+	cs.readBuf.Reset(payload)
+	return nil
+}
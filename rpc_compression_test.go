@@ -0,0 +1,73 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	inet "github.com/libp2p/go-libp2p-net"
+)
+
+// bufStream is an inet.Stream which reads what was written to it.
+type bufStream struct {
+	inet.Stream
+	buf bytes.Buffer
+}
+
+func (s *bufStream) Read(p []byte) (int, error) {
+	return s.buf.Read(p)
+}
+
+func (s *bufStream) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+func TestCompressedStream(t *testing.T) {
+	bs := &bufStream{}
+	cs := newCompressedStream(bs, 100)
+
+	small := []byte("hello")
+	large := bytes.Repeat([]byte("ipfs-cluster"), 1000)
+
+	cs.Write(small)
+	cs.Write(large)
+	if bs.buf.Len() >= len(small)+len(large) {
+		t.Error("large payloads should have been compressed")
+	}
+
+	read, err := ioutil.ReadAll(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, append(small, large...)) {
+		t.Error("read payload does not match what was written")
+	}
+}
+
+func TestCompressedStreamFrameTooLarge(t *testing.T) {
+	var payload bytes.Buffer
+	fw, _ := flate.NewWriter(&payload, flate.BestCompression)
+	fw.Write(make([]byte, maxFrameSize+1))
+	fw.Close()
+
+	bs := &bufStream{}
+	header := make([]byte, 5)
+	header[0] = frameDeflate
+	binary.BigEndian.PutUint32(header[1:], uint32(payload.Len()))
+	bs.buf.Write(header)
+	bs.buf.Write(payload.Bytes())
+
+	cs := newCompressedStream(bs, 100)
+	_, err := ioutil.ReadAll(cs)
+	if err != errFrameTooLarge {
+		t.Errorf("expected errFrameTooLarge, got %v", err)
+	}
+}
+
+func TestCompressedProtocol(t *testing.T) {
+	if compressedProtocol(RPCProtocol) != RPCCompressedProtocol {
+		t.Error("unexpected compressed protocol for RPCProtocol")
+	}
+}
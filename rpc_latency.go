@@ -0,0 +1,85 @@
+package ipfscluster
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// rpcLatencies accumulates the time taken by the RPC requests sent to
+// other peers, by method, so that they can be exported along with the
+// rest of the observations of the peer.
+type rpcLatencies struct {
+	mux     sync.Mutex
+	methods map[string]*rpcLatency
+}
+
+type rpcLatency struct {
+	count  uint64
+	errors uint64
+	total  time.Duration
+}
+
+func newRPCLatencies() *rpcLatencies {
+	return &rpcLatencies{
+		methods: make(map[string]*rpcLatency),
+	}
+}
+
+// record adds a request to the given method which took d.
+func (rl *rpcLatencies) record(method string, d time.Duration, err error) {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	l, ok := rl.methods[method]
+	if !ok {
+		l = &rpcLatency{}
+		rl.methods[method] = l
+	}
+	l.count++
+	l.total += d
+	if err != nil {
+		l.errors++
+	}
+}
+
+// observations describes the latencies following the Prometheus summary
+// conventions (sum and count).
+func (rl *rpcLatencies) observations() []api.Observation {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	methods := make([]string, 0, len(rl.methods))
+	for m := range rl.methods {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+
+	var obs []api.Observation
+	for _, m := range methods {
+		l := rl.methods[m]
+		labels := map[string]string{"method": m}
+		obs = append(obs,
+			api.Observation{
+				Name:   "ipfscluster_rpc_duration_seconds_sum",
+				Help:   "Time spent in RPC requests to other peers by method",
+				Labels: labels,
+				Value:  l.total.Seconds(),
+			},
+			api.Observation{
+				Name:   "ipfscluster_rpc_duration_seconds_count",
+				Help:   "Number of RPC requests to other peers by method",
+				Labels: labels,
+				Value:  float64(l.count),
+			},
+			api.Observation{
+				Name:   "ipfscluster_rpc_errors_total",
+				Help:   "Number of failed RPC requests to other peers by method",
+				Labels: labels,
+				Value:  float64(l.errors),
+			},
+		)
+	}
+	return obs
+}
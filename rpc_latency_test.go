@@ -0,0 +1,26 @@
+package ipfscluster
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRPCLatencies(t *testing.T) {
+	rl := newRPCLatencies()
+	rl.record("Cluster.ID", time.Second, nil)
+	rl.record("Cluster.ID", 3*time.Second, errors.New("timeout"))
+
+	values := make(map[string]float64)
+	for _, o := range rl.observations() {
+		if o.Labels["method"] != "Cluster.ID" {
+			t.Fatal("unexpected method label:", o.Labels)
+		}
+		values[o.Name] = o.Value
+	}
+	if values["ipfscluster_rpc_duration_seconds_sum"] != 4 ||
+		values["ipfscluster_rpc_duration_seconds_count"] != 2 ||
+		values["ipfscluster_rpc_errors_total"] != 1 {
+		t.Error("unexpected observations:", values)
+	}
+}
@@ -0,0 +1,269 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+var errUntrustedRPC = errors.New("this request is only accepted from trusted peers")
+
+// trustingHost wraps a host so that the RPC streams opened by untrusted
+// peers (see TrustingConsensus) are served by a restricted RPC server,
+// which rejects the methods modifying the shared state or acting on
+// behalf of this peer. It is only handed to the RPC server.
+type trustingHost struct {
+	host.Host
+	isTrusted func(peer.ID) bool
+	untrusted inet.StreamHandler
+}
+
+// newTrustingHost builds a trustingHost which serves the given restricted
+// RPC service to untrusted peers.
+func newTrustingHost(h host.Host, pid protocol.ID, isTrusted func(peer.ID) bool, untrustedSvc interface{}) (*trustingHost, error) {
+	hh := &handlerHost{Host: h}
+	server := rpc.NewServer(hh, pid)
+	if err := server.RegisterName("Cluster", untrustedSvc); err != nil {
+		return nil, err
+	}
+	return &trustingHost{
+		Host:      h,
+		isTrusted: isTrusted,
+		untrusted: hh.handler,
+	}, nil
+}
+
+// SetStreamHandler registers a handler which hands the streams of the
+// untrusted peers to the restricted RPC server.
+func (th *trustingHost) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	th.Host.SetStreamHandler(pid, func(s inet.Stream) {
+		if th.isTrusted(s.Conn().RemotePeer()) {
+			handler(s)
+			return
+		}
+		th.untrusted(s)
+	})
+}
+
+// handlerHost keeps the stream handler set by an RPC server instead of
+// registering it, so that it can be called by another handler.
+type handlerHost struct {
+	host.Host
+	handler inet.StreamHandler
+}
+
+func (hh *handlerHost) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	hh.handler = handler
+}
+
+func (hh *handlerHost) RemoveStreamHandler(pid protocol.ID) {
+	hh.handler = nil
+}
+
+// untrustedRPCAPI is the RPCAPI served to untrusted peers. The methods
+// which modify the shared state, or which make this peer pin, unpin,
+// change its peerset or shut down, are rejected. The rest are the ones of
+// RPCAPI, so that untrusted peers can still send their metrics, follow
+// the shared state and report the status of their pins.
+type untrustedRPCAPI struct {
+	*RPCAPI
+}
+
+func (rpcapi *untrustedRPCAPI) Pin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PinBatch(ctx context.Context, in []api.PinSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PinWithResult(ctx context.Context, in api.PinSerial, out *api.PinResult) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PinOverwrite(ctx context.Context, in api.PinSerial, out *api.PinResult) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PinUpdate(ctx context.Context, in api.PinUpdateRequest, out *api.PinSerial) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) Add(ctx context.Context, in api.AddRequest, out *[]api.AddedOutput) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ImportCAR(ctx context.Context, in api.CARImportRequest, out *[]api.PinSerial) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) Unpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) KVSet(ctx context.Context, in api.KV, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) AnnotatePeer(ctx context.Context, in api.PeerAnnotation, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) KVRm(ctx context.Context, in string, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) WebhookAdd(ctx context.Context, in api.Webhook, out *api.Webhook) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) WebhookRm(ctx context.Context, in string, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PushMetric(ctx context.Context, in api.MetricSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) FailPeer(ctx context.Context, in api.FailPeerRequest, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ShutdownAll(ctx context.Context, in struct{}, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ShutdownLocal(ctx context.Context, in struct{}, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PausePinsLocal(ctx context.Context, in struct{}, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ResumePinsLocal(ctx context.Context, in struct{}, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) Unquarantine(ctx context.Context, in peer.ID, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) RemediateStrayPin(ctx context.Context, in api.StrayPinRemediation, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) RemediateStrayPinLocal(ctx context.Context, in api.StrayPinRemediation, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PeerAdd(ctx context.Context, in api.MultiaddrSerial, out *api.IDSerial) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PeerRemove(ctx context.Context, in peer.ID, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PeerLeave(ctx context.Context, in api.PeerLeaveRequest, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) Join(ctx context.Context, in api.MultiaddrSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) RecoverAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) Recover(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) RecoverLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) StateSync(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) Track(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) Untrack(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) TrackerRecoverAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) TrackerRecover(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) IPFSPin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) IPFSUnpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) IPFSRepoGC(ctx context.Context, in struct{}, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ConsensusLogPin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ConsensusLogUnpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ConsensusLogSetKV(ctx context.Context, in api.KV, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ConsensusLogRmKV(ctx context.Context, in string, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ConsensusAddPeer(ctx context.Context, in peer.ID, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ConsensusAddNonVoter(ctx context.Context, in peer.ID, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) ConsensusRmPeer(ctx context.Context, in peer.ID, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PeerManagerAddPeer(ctx context.Context, in api.MultiaddrSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PeerManagerImportAddresses(ctx context.Context, in api.MultiaddrsSerial, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PeerMonitorFailPeer(ctx context.Context, in api.FailPeerRequest, out *struct{}) error {
+	return errUntrustedRPC
+}
+
+func (rpcapi *untrustedRPCAPI) PeerMonitorUnquarantine(ctx context.Context, in peer.ID, out *struct{}) error {
+	return errUntrustedRPC
+}
@@ -0,0 +1,86 @@
+package ipfscluster
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	libp2p "github.com/libp2p/go-libp2p"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+)
+
+type trustTestService struct{}
+
+func (svc *trustTestService) Read(ctx context.Context, in struct{}, out *string) error {
+	*out = "read"
+	return nil
+}
+
+func (svc *trustTestService) Write(ctx context.Context, in struct{}, out *string) error {
+	*out = "written"
+	return nil
+}
+
+type untrustedTestService struct {
+	*trustTestService
+}
+
+func (svc *untrustedTestService) Write(ctx context.Context, in struct{}, out *string) error {
+	return errUntrustedRPC
+}
+
+func TestTrustingHost(t *testing.T) {
+	ctx := context.Background()
+	h1, err := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h1.Close()
+	h2, err := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+
+	pid := protocol.ID("/ipfscluster/trust-test")
+	var trusted int32
+	isTrusted := func(p peer.ID) bool { return atomic.LoadInt32(&trusted) == 1 && p == h2.ID() }
+	th, err := newTrustingHost(h1, pid, isTrusted, &untrustedTestService{&trustTestService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rpc.NewServer(th, pid)
+	if err := server.RegisterName("Cluster", &trustTestService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h2.Connect(ctx, h1.Peerstore().PeerInfo(h1.ID())); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.NewClient(h2, pid)
+
+	var out string
+	if err := client.Call(h1.ID(), "Cluster", "Read", struct{}{}, &out); err != nil || out != "read" {
+		t.Error("untrusted peers should be able to read:", err)
+	}
+	err = client.Call(h1.ID(), "Cluster", "Write", struct{}{}, &out)
+	if err == nil || err.Error() != errUntrustedRPC.Error() {
+		t.Error("untrusted peers should not be able to write:", err)
+	}
+
+	atomic.StoreInt32(&trusted, 1)
+	if err := client.Call(h1.ID(), "Cluster", "Write", struct{}{}, &out); err != nil || out != "written" {
+		t.Error("trusted peers should be able to write:", err)
+	}
+}
+
+func TestUntrustedRPCAPI(t *testing.T) {
+	rpcapi := &untrustedRPCAPI{&RPCAPI{}}
+	if err := rpcapi.Pin(context.Background(), api.PinSerial{}, &struct{}{}); err != errUntrustedRPC {
+		t.Error("untrusted peers should not be able to pin:", err)
+	}
+}
@@ -0,0 +1,579 @@
+package ipfscluster
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// Sharding allows to add content larger than the repository of any
+// single peer. The files of the added content are streamed to the IPFS
+// daemon of the peer receiving them in segments of up to the shard size,
+// each imported as a file of its own and pinned until it is replicated.
+// Segments are grouped, in order, into shards: nodes linking to them,
+// which are stored in IPFS and pinned recursively, each with the options
+// of the original pin and allocated, when possible, to peers which hold
+// no other shard. As soon as a shard is full, it is pinned and its
+// blocks are sent to its allocations, and the temporary pins of its
+// segments are removed once these report it as pinned, so that the peer
+// receiving the content only holds about a shard at a time.
+//
+// The segments of every file are then assembled in a UnixFS file node,
+// and the files in UnixFS directory nodes. These nodes, the "spine" of
+// the DAG, are pinned directly with the same options. Finally, every
+// root of the added content is pinned directly as a meta pin, which the
+// other pins of its DAG reference. Shards never hold segments of several
+// roots, so unpinning a meta pin only unpins the shards and spine nodes
+// of its DAG. Shards only reference their meta pin once it is pinned:
+// those left by an add which did not finish can be unpinned on their
+// own.
+//
+// Sizes are those given by the DAGSizer. Since their DAGs are assembled
+// from segments, the roots of sharded files differ from those of the
+// same files added without sharding.
+
+// maxShardLinks limits the number of links of a shard node, so that it
+// fits in a block.
+const maxShardLinks = 4096
+
+// dagUnit is a segment of an added file, which fits in a shard.
+type dagUnit struct {
+	cid  *cid.Cid
+	size uint64
+}
+
+// shardedAdd is an add which shards the added content.
+type shardedAdd struct {
+	c      *Cluster
+	ctx    context.Context
+	origin api.Origin
+	req    api.AddRequest
+
+	adder  ContentAdder
+	sizer  DAGSizer
+	linker DAGLinker
+
+	params    api.AddParams // of the imported segments
+	shardSize uint64
+
+	units     []dagUnit // segments of the shard being filled
+	unitsSize uint64
+	used      []peer.ID // peers holding previous shards
+	pending   []*cid.Cid
+	added     []api.AddedOutput
+
+	// the root being added
+	rootName string
+	root     api.UnixFSLink
+	dirs     map[string][]api.UnixFSLink // entries of its directories
+	shards   []api.Pin                   // committed for it
+	spine    []*cid.Cid
+}
+
+// addSharded performs add with the Shard parameter.
+func (c *Cluster) addSharded(ctx context.Context, origin api.Origin, req api.AddRequest) ([]api.AddedOutput, error) {
+	adder, ok1 := c.ipfs.(ContentAdder)
+	sizer, ok2 := c.ipfs.(DAGSizer)
+	linker, ok3 := c.ipfs.(DAGLinker)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, errors.New("the IPFS connector cannot shard added content")
+	}
+	if c.pinsPaused() {
+		return nil, errPinsPaused
+	}
+	_, mParams, err := mime.ParseMediaType(req.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	sa := &shardedAdd{
+		c:         c,
+		ctx:       ctx,
+		origin:    origin,
+		req:       req,
+		adder:     adder,
+		sizer:     sizer,
+		linker:    linker,
+		params:    req.Params,
+		shardSize: req.Params.ShardSize,
+		dirs:      make(map[string][]api.UnixFSLink),
+	}
+	sa.params.WrapWithDirectory = false
+	sa.params.Shard = false
+	sa.params.ShardSize = 0
+	if sa.shardSize == 0 {
+		sa.shardSize = api.DefaultShardSize
+	}
+
+	err = sa.run(multipart.NewReader(req.Body, mParams["boundary"]))
+	if err != nil {
+		if rmErr := c.unpinShards(origin, sa.shards); rmErr != nil {
+			logger.Errorf("error unpinning the shards of %s: %s", sa.rootName, rmErr)
+		}
+	}
+	// the segments not released yet and the spine nodes are pinned
+	// until their allocations pin them
+	pending := sa.pending
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.releaseAddedRoots(pending)
+	}()
+	return sa.added, err
+}
+
+// run adds the files and directories in the multipart body. Without
+// WrapWithDirectory, each top-level file or directory is a root of its
+// own, finished before the next one starts.
+func (sa *shardedAdd) run(mr *multipart.Reader) error {
+	wrap := sa.req.Params.WrapWithDirectory
+	started := false
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, err := partPath(part)
+		if err != nil {
+			return err
+		}
+
+		if top := strings.SplitN(name, "/", 2)[0]; !started || (!wrap && top != sa.rootName) {
+			if started {
+				if err := sa.finishRoot(); err != nil {
+					return err
+				}
+			}
+			started = true
+			sa.startRoot(top)
+		}
+
+		if part.Header.Get("Content-Type") == "application/x-directory" {
+			sa.addDir(name)
+			continue
+		}
+		if err := sa.addFile(name, part); err != nil {
+			return err
+		}
+	}
+	if !started {
+		return errors.New("nothing was added")
+	}
+	return sa.finishRoot()
+}
+
+// partPath returns the path of a file or directory in the multipart
+// body, as given by its escaped file name.
+func partPath(part *multipart.Part) (string, error) {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return "", err
+	}
+	name, err := url.QueryUnescape(params["filename"])
+	if err != nil {
+		return "", err
+	}
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "", errors.New("a part of the multipart body has no file name")
+	}
+	return name, nil
+}
+
+// startRoot resets the state of the root being added. When wrapping,
+// the root is the wrapping directory, whose name is empty.
+func (sa *shardedAdd) startRoot(name string) {
+	if sa.req.Params.WrapWithDirectory {
+		name = ""
+		sa.dirs = map[string][]api.UnixFSLink{"": nil}
+	} else {
+		sa.dirs = make(map[string][]api.UnixFSLink)
+	}
+	sa.rootName = name
+	sa.root = api.UnixFSLink{}
+	sa.shards = nil
+	sa.spine = nil
+}
+
+// addDir records a directory and its parents.
+func (sa *shardedAdd) addDir(name string) {
+	for name != "" {
+		if _, ok := sa.dirs[name]; ok {
+			return
+		}
+		sa.dirs[name] = nil
+		name = parentDir(name)
+	}
+}
+
+// addLink adds a file or directory to its parent directory, or makes it
+// the root.
+func (sa *shardedAdd) addLink(name string, link api.UnixFSLink) {
+	if name == sa.rootName {
+		sa.root = link
+		return
+	}
+	parent := parentDir(name)
+	sa.addDir(parent)
+	link.Name = path.Base(name)
+	sa.dirs[parent] = append(sa.dirs[parent], link)
+}
+
+// parentDir returns the parent of a path, or "" for top-level paths.
+func parentDir(name string) string {
+	if dir := path.Dir(name); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// addFile imports a file in segments of up to the shard size, which are
+// assembled in a UnixFS file when there are several.
+func (sa *shardedAdd) addFile(name string, r io.Reader) error {
+	br := bufio.NewReader(r)
+	var segments []api.UnixFSLink
+	for {
+		segment, err := sa.addSegment(name, io.LimitReader(br, int64(sa.shardSize)))
+		if err != nil {
+			return err
+		}
+		segments = append(segments, segment)
+		if err := sa.addUnit(dagUnit{cid: segment.Cid, size: segment.Size}); err != nil {
+			return err
+		}
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	file := segments[0]
+	if len(segments) > 1 {
+		var err error
+		file, err = sa.putNode(api.UnixFSNode{Links: segments})
+		if err != nil {
+			return err
+		}
+	}
+	sa.added = append(sa.added, api.AddedOutput{Name: name, Cid: file.Cid.String()})
+	sa.addLink(name, file)
+	return nil
+}
+
+// addSegment imports a segment of a file in the IPFS daemon, which pins
+// it until it is released.
+func (sa *shardedAdd) addSegment(name string, r io.Reader) (api.UnixFSLink, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	var n int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition",
+			fmt.Sprintf(`form-data; name="file"; filename="%s"`, url.QueryEscape(path.Base(name))))
+		header.Set("Content-Type", "application/octet-stream")
+		fw, err := mw.CreatePart(header)
+		if err == nil {
+			n, err = io.Copy(fw, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	added, err := sa.adder.Add(sa.ctx, sa.params, mw.FormDataContentType(), pr)
+	pr.Close() // in case the import stopped before the end
+	<-done
+	if err != nil {
+		return api.UnixFSLink{}, err
+	}
+	if len(added) == 0 {
+		return api.UnixFSLink{}, errors.New("the segment was not imported")
+	}
+
+	segment, err := cid.Decode(added[len(added)-1].Cid)
+	if err != nil {
+		return api.UnixFSLink{}, err
+	}
+	sa.pin(segment)
+	size, err := sa.sizer.DAGSize(sa.ctx, segment)
+	if err != nil {
+		return api.UnixFSLink{}, err
+	}
+	return api.UnixFSLink{Cid: segment, Size: size, FileSize: uint64(n)}, nil
+}
+
+// putNode stores a UnixFS node, which is pinned until it is released and
+// is part of the spine of the root.
+func (sa *shardedAdd) putNode(node api.UnixFSNode) (api.UnixFSLink, error) {
+	c, err := sa.linker.PutUnixFS(sa.ctx, node)
+	if err != nil {
+		return api.UnixFSLink{}, err
+	}
+	sa.pin(c)
+	sa.spine = append(sa.spine, c)
+
+	size, err := sa.sizer.DAGSize(sa.ctx, c)
+	if err != nil {
+		return api.UnixFSLink{}, err
+	}
+	var fileSize uint64
+	for _, l := range node.Links {
+		fileSize += l.FileSize
+	}
+	return api.UnixFSLink{Cid: c, Size: size, FileSize: fileSize}, nil
+}
+
+// pin records a temporary pin made by the IPFS daemon.
+func (sa *shardedAdd) pin(c *cid.Cid) {
+	sa.pending = append(sa.pending, c)
+	if err := sa.c.tempPins.add([]*cid.Cid{c}); err != nil {
+		logger.Errorf("error persisting temporary pins: %s", err)
+	}
+}
+
+// addUnit adds a segment to the shard being filled, after pinning it
+// when the segment does not fit.
+func (sa *shardedAdd) addUnit(u dagUnit) error {
+	full := sa.unitsSize+u.size > sa.shardSize || len(sa.units) >= maxShardLinks
+	if len(sa.units) > 0 && full {
+		if err := sa.flush(); err != nil {
+			return err
+		}
+	}
+	sa.units = append(sa.units, u)
+	sa.unitsSize += u.size
+	return nil
+}
+
+// flush pins the shard being filled and sends its blocks to its
+// allocations. The temporary pins of its segments are released once
+// these report it as pinned.
+func (sa *shardedAdd) flush() error {
+	if len(sa.units) == 0 {
+		return nil
+	}
+	segments := make([]*cid.Cid, 0, len(sa.units))
+	for _, u := range sa.units {
+		segments = append(segments, u.cid)
+	}
+	sa.units = nil
+	sa.unitsSize = 0
+
+	shardCid, err := sa.linker.PutLinks(sa.ctx, segments)
+	if err != nil {
+		return err
+	}
+	n := len(sa.shards)
+	shard := sa.basePin()
+	shard.Cid = shardCid
+	shard.Recursive = true
+	shard.Name = shardPinName(shard.Name, fmt.Sprintf("shard-%d", n))
+	submitted, ok, err := sa.c.pinShard(sa.origin, shard, sa.used)
+	if err != nil {
+		return fmt.Errorf("error pinning shard %d: %s", n, err)
+	}
+	if ok {
+		sa.shards = append(sa.shards, submitted)
+	}
+	sa.used = append(sa.used, submitted.Allocations...)
+
+	sa.c.pushAdded(sa.ctx, shardCid)
+	if err := sa.c.waitAddedPinned(sa.ctx, shardCid); err != nil {
+		return fmt.Errorf("error waiting for shard %d to be pinned: %s", n, err)
+	}
+	sa.c.releaseAddedRoots(segments)
+	pending := sa.pending[:0]
+	for _, c := range sa.pending {
+		if !containsCid(segments, c) {
+			pending = append(pending, c)
+		}
+	}
+	sa.pending = pending
+	return nil
+}
+
+// basePin returns the options of the shards and spine nodes of the root
+// being added: those of the meta pin, which expires and takes the
+// others with it.
+func (sa *shardedAdd) basePin() api.Pin {
+	base := sa.c.addedPin(sa.req, sa.rootName)
+	base.Type = api.ShardType
+	base.ExpireAt = time.Time{}
+	base.PinUpdate = nil
+	base.Allocations = nil
+	return base
+}
+
+// finishRoot pins the last shard of the root being added, assembles its
+// directories and pins them, along with its meta pin, which the shards
+// are then updated to reference.
+func (sa *shardedAdd) finishRoot() error {
+	if err := sa.flush(); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(sa.dirs))
+	for name := range sa.dirs {
+		names = append(names, name)
+	}
+	// directories are assembled after their entries
+	sort.Slice(names, func(i, j int) bool {
+		di, dj := pathDepth(names[i]), pathDepth(names[j])
+		return di > dj || (di == dj && names[i] < names[j])
+	})
+	for _, name := range names {
+		entries := sa.dirs[name]
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name < entries[j].Name
+		})
+		dir, err := sa.putNode(api.UnixFSNode{Directory: true, Links: entries})
+		if err != nil {
+			return err
+		}
+		sa.added = append(sa.added, api.AddedOutput{Name: name, Cid: dir.Cid.String()})
+		sa.addLink(name, dir)
+	}
+
+	root := sa.root.Cid
+	meta := sa.c.addedPin(sa.req, sa.rootName)
+	meta.Cid = root
+	meta.Type = api.MetaType
+	meta.Recursive = false
+	if err := meta.Validate(); err != nil {
+		return err
+	}
+
+	for i, node := range sa.spine {
+		if node.Equals(root) {
+			continue
+		}
+		spinePin := sa.basePin()
+		spinePin.Cid = node
+		spinePin.Reference = root
+		spinePin.Recursive = false
+		spinePin.Name = shardPinName(spinePin.Name, fmt.Sprintf("node-%d", i))
+		submitted, ok, err := sa.c.pinShard(sa.origin, spinePin, nil)
+		if err != nil {
+			return err
+		}
+		if ok {
+			sa.shards = append(sa.shards, submitted)
+		}
+	}
+	for _, shard := range sa.shards {
+		if shard.Reference != nil {
+			continue
+		}
+		shard.Reference = root
+		if err := sa.c.consensus.LogPin(shard); err != nil {
+			return err
+		}
+	}
+	if _, err := sa.c.pinWithResult(sa.origin, meta); err != nil {
+		return err
+	}
+	sa.shards = nil // unpinned along with the meta pin from now on
+	return nil
+}
+
+// pathDepth returns the number of elements of a path.
+func pathDepth(name string) int {
+	if name == "" {
+		return 0
+	}
+	return strings.Count(name, "/") + 1
+}
+
+// waitAddedPinned waits until the allocations of an added root report it
+// as pinned.
+func (c *Cluster) waitAddedPinned(ctx context.Context, root *cid.Cid) error {
+	ticker := time.NewTicker(addCheckInterval)
+	defer ticker.Stop()
+	for !c.addedRootPinned(root) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.ctx.Done():
+			return errors.New("shutting down")
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// pinShard pins a shard avoiding the given peers, unless there are not
+// enough other peers to allocate it. It returns whether the shard was
+// committed to the shared state.
+func (c *Cluster) pinShard(origin api.Origin, shard api.Pin, avoid []peer.ID) (api.Pin, bool, error) {
+	submitted, ok, err := c.pin(shard, avoid, nil, api.AllocationRebalance)
+	if err != nil && len(avoid) > 0 {
+		logger.Debugf("cannot allocate %s to other peers: %s", shard.Cid, err)
+		submitted, ok, err = c.pin(shard, nil, nil, api.AllocationRebalance)
+	}
+	if err != nil {
+		return submitted, false, err
+	}
+	if ok {
+		c.recordEvent(origin, api.EventPin, shard.Cid, "", shard.Name)
+	}
+	return submitted, ok, nil
+}
+
+// unpinShards removes the given shards from the shared state.
+func (c *Cluster) unpinShards(origin api.Origin, shards []api.Pin) error {
+	for _, shard := range shards {
+		if err := c.consensus.LogUnpin(api.Pin{Cid: shard.Cid}); err != nil {
+			return err
+		}
+		c.recordPinEvent(origin, api.EventUnpin, shard, "", "")
+	}
+	return nil
+}
+
+// shardPinName names the pins of a sharded DAG after its name, trimming
+// it so that the result is not too long.
+func shardPinName(name, suffix string) string {
+	if name == "" {
+		return suffix
+	}
+	if max := api.MaxPinNameLength - len(suffix) - 1; len(name) > max {
+		name = name[:max]
+	}
+	return name + "-" + suffix
+}
+
+// shardsOf returns the pins which reference the given meta pin.
+func (c *Cluster) shardsOf(root *cid.Cid) ([]api.Pin, error) {
+	cState, err := c.consensus.State()
+	if err != nil {
+		return nil, err
+	}
+	var shards []api.Pin
+	for _, p := range cState.ListReferencing(root) {
+		if p.Type == api.ShardType {
+			shards = append(shards, p)
+		}
+	}
+	return shards, nil
+}
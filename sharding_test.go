@@ -0,0 +1,182 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestShardPinName(t *testing.T) {
+	if n := shardPinName("", "shard-0"); n != "shard-0" {
+		t.Error("unexpected name:", n)
+	}
+	if n := shardPinName("movies", "shard-1"); n != "movies-shard-1" {
+		t.Error("unexpected name:", n)
+	}
+	long := strings.Repeat("a", api.MaxPinNameLength)
+	if n := shardPinName(long, "node-2"); len(n) != api.MaxPinNameLength || !strings.HasSuffix(n, "-node-2") {
+		t.Error("long names should be trimmed:", n)
+	}
+}
+
+// shardedBody returns a multipart body with the given files and
+// directories, the latter having an empty content.
+func shardedBody(t *testing.T, files ...string) (*bytes.Buffer, string) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	for i := 0; i < len(files); i += 2 {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition",
+			fmt.Sprintf(`form-data; name="file"; filename="%s"`, url.QueryEscape(files[i])))
+		if files[i+1] == "" {
+			header.Set("Content-Type", "application/x-directory")
+		}
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, files[i+1])
+	}
+	mw.Close()
+	return body, mw.FormDataContentType()
+}
+
+func TestClusterAddSharded(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+	ipfs.HashContent = true
+	defer func(d time.Duration) { addCheckInterval = d }(addCheckInterval)
+	addCheckInterval = 100 * time.Millisecond
+
+	// "big" is imported in 3 segments of up to 1500 bytes, which
+	// are 1000 bytes large for the mock, so each gets its own shard.
+	// The segment of "small" gets the last one.
+	body, contentType := shardedBody(t,
+		"dir", "",
+		"dir/big", strings.Repeat("a", 4000),
+		"dir/sub", "",
+		"dir/sub/small", "small",
+	)
+	pin := api.Pin{ReplicationFactorMin: 1, ReplicationFactorMax: 1}
+	params := api.AddParams{Shard: true, ShardSize: 1500}
+	added, err := cl.Add(params, pin, contentType, body)
+	if err != nil {
+		t.Fatal("add should have worked:", err)
+	}
+	var names []string
+	for _, a := range added {
+		names = append(names, a.Name)
+	}
+	if strings.Join(names, ",") != "dir/big,dir/sub/small,dir/sub,dir" {
+		t.Fatal("unexpected added items:", names)
+	}
+
+	root, _ := cid.Decode(added[len(added)-1].Cid)
+	meta, err := cl.PinGet(root)
+	if err != nil {
+		t.Fatal("the root should be pinned:", err)
+	}
+	if meta.Type != api.MetaType || meta.Recursive || meta.Name != "dir" {
+		t.Error("unexpected meta pin:", meta)
+	}
+
+	shards, err := cl.shardsOf(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recursive, direct int
+	for _, s := range shards {
+		if !strings.HasPrefix(s.Name, "dir-") {
+			t.Error("unexpected shard pin:", s)
+		}
+		if s.Recursive {
+			recursive++
+		} else {
+			direct++
+		}
+	}
+	// "big" and "dir/sub" are part of the spine
+	if recursive != 4 || direct != 2 {
+		t.Errorf("expected 4 shards and 2 spine nodes, got %d and %d", recursive, direct)
+	}
+
+	// the segments and spine nodes are released once pinned
+	delay()
+	if roots := cl.tempPins.list(); len(roots) != 0 {
+		t.Error("the temporary pins should have been released:", roots)
+	}
+
+	if err := cl.Unpin(shards[0].Cid); err == nil {
+		t.Error("expected an error unpinning a shard")
+	}
+	if err := cl.Unpin(root); err != nil {
+		t.Fatal("unpin should have worked:", err)
+	}
+	delay()
+	if pins := cl.Pins(); len(pins) != 0 {
+		t.Error("unpinning the meta pin should unpin the shards:", pins)
+	}
+}
+
+func TestClusterAddShardedRoots(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+	ipfs.HashContent = true
+	defer func(d time.Duration) { addCheckInterval = d }(addCheckInterval)
+	addCheckInterval = 100 * time.Millisecond
+
+	// each top-level file is a root with its own shards
+	body, contentType := shardedBody(t, "a", "aaa", "b", "bbb")
+	params := api.AddParams{Shard: true, ShardSize: 1500}
+	added, err := cl.Add(params, api.Pin{ReplicationFactorMin: -1, ReplicationFactorMax: -1}, contentType, body)
+	if err != nil {
+		t.Fatal("add should have worked:", err)
+	}
+	if len(added) != 2 {
+		t.Fatal("unexpected added items:", added)
+	}
+	for _, a := range added {
+		root, _ := cid.Decode(a.Cid)
+		shards, err := cl.shardsOf(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shards) != 1 || shards[0].Name != a.Name+"-shard-0" {
+			t.Error("expected a single shard:", shards)
+		}
+	}
+}
+
+func TestClusterAddShardedError(t *testing.T) {
+	cl, _, ipfs, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+	ipfs.HashContent = true
+	defer func(d time.Duration) { addCheckInterval = d }(addCheckInterval)
+	addCheckInterval = 100 * time.Millisecond
+
+	// the second segment is imported as ErrorCid, so its shard cannot
+	// be stored
+	body, contentType := shardedBody(t, "big", strings.Repeat("a", 1500)+"error")
+	params := api.AddParams{Shard: true, ShardSize: 1500}
+	pin := api.Pin{ReplicationFactorMin: 1, ReplicationFactorMax: 1}
+	if _, err := cl.Add(params, pin, contentType, body); err == nil {
+		t.Fatal("expected an error sharding the content")
+	}
+	delay()
+	if pins := cl.Pins(); len(pins) != 0 {
+		t.Error("the committed shards should have been unpinned:", pins)
+	}
+}
@@ -0,0 +1,109 @@
+package ipfscluster
+
+import (
+	"errors"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// errPinsPaused is returned by pin and unpin operations while the
+// cluster is being shut down.
+var errPinsPaused = errors.New("pins are paused: the cluster is shutting down")
+
+// ShutdownDelay is how long a peer asked to shut down (see ShutdownLocal)
+// waits before doing so, which lets it answer the request.
+var ShutdownDelay = time.Second
+
+// ShutdownAll stops all the cluster peers in an orderly way, for the
+// maintenance of the whole installation. The leader coordinates it: new
+// pins and unpins (including re-pinnings) are paused everywhere, the
+// consensus log is applied, the other peers are shut down and finally
+// the leader shuts down, snapshotting the state. Peers do not leave the
+// cluster, regardless of LeaveOnShutdown, so it can be started again
+// as it was. Unreachable peers are skipped.
+func (c *Cluster) ShutdownAll() error {
+	leader, err := c.consensus.Leader()
+	if err != nil {
+		return err
+	}
+	if leader != c.id {
+		return c.rpcClient.Call(leader,
+			"Cluster", "ShutdownAll",
+			struct{}{},
+			&struct{}{})
+	}
+
+	members, err := c.consensus.Peers()
+	if err != nil {
+		return err
+	}
+
+	logger.Warning("shutting down all the cluster peers")
+	c.multiRPCLogErrors(members, "PausePinsLocal")
+
+	err = c.consensus.WaitForSync()
+	if err != nil {
+		logger.Errorf("error applying the consensus log, aborting the shutdown: %s", err)
+		c.multiRPCLogErrors(members, "ResumePinsLocal")
+		return err
+	}
+
+	var others []peer.ID
+	for _, p := range members {
+		if p != c.id {
+			others = append(others, p)
+		}
+	}
+	c.multiRPCLogErrors(others, "ShutdownLocal")
+	return c.ShutdownLocal()
+}
+
+// ShutdownLocal pauses pins in this peer and shuts it down after
+// ShutdownDelay, without leaving the cluster.
+func (c *Cluster) ShutdownLocal() error {
+	c.PausePinsLocal()
+	go func() {
+		time.Sleep(ShutdownDelay)
+		if err := c.shutdown(false); err != nil {
+			logger.Errorf("error shutting down: %s", err)
+		}
+	}()
+	return nil
+}
+
+// PausePinsLocal makes this peer reject new pin and unpin operations,
+// including the re-pinnings triggered by alerts.
+func (c *Cluster) PausePinsLocal() {
+	c.pausedMux.Lock()
+	defer c.pausedMux.Unlock()
+	c.paused = true
+}
+
+// ResumePinsLocal makes this peer accept pin and unpin operations again.
+func (c *Cluster) ResumePinsLocal() {
+	c.pausedMux.Lock()
+	defer c.pausedMux.Unlock()
+	c.paused = false
+}
+
+func (c *Cluster) pinsPaused() bool {
+	c.pausedMux.RLock()
+	defer c.pausedMux.RUnlock()
+	return c.paused
+}
+
+// multiRPCLogErrors calls a method without arguments nor results in the
+// given peers and logs the errors.
+func (c *Cluster) multiRPCLogErrors(dests []peer.ID, method string) {
+	errs := c.multiRPC(dests,
+		"Cluster",
+		method,
+		struct{}{},
+		copyEmptyStructToIfaces(make([]struct{}, len(dests), len(dests))))
+	for i, err := range errs {
+		if err != nil {
+			logger.Errorf("%s: error calling %s in %s: %s", c.id, method, dests[i].Pretty(), err)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	cid "github.com/ipfs/go-cid"
 	"github.com/ipfs/ipfs-cluster/api"
+	peer "github.com/libp2p/go-libp2p-peer"
 )
 
 // State is used by the Consensus component to keep track of
@@ -19,10 +20,23 @@ type State interface {
 	Rm(*cid.Cid) error
 	// List lists all the pins in the state
 	List() []api.Pin
+	// ListAllocatedTo lists the pins allocated to a peer, including
+	// those replicated everywhere
+	ListAllocatedTo(peer.ID) []api.Pin
+	// ListReferencing lists the pins whose Reference is the given Cid
+	ListReferencing(*cid.Cid) []api.Pin
 	// Has returns true if the state is holding information for a Cid
 	Has(*cid.Cid) bool
 	// Get returns the information attacthed to this pin
 	Get(*cid.Cid) api.Pin
+	// SetKV stores a KV record
+	SetKV(api.KV) error
+	// RmKV removes a KV record
+	RmKV(key string) error
+	// GetKV returns a KV record and whether it was found
+	GetKV(key string) (api.KV, bool)
+	// ListKV lists all the KV records, sorted by key
+	ListKV() []api.KV
 	// Migrate restores the serialized format of an outdated state to the current version
 	Migrate(r io.Reader) error
 	// Return the version of this state
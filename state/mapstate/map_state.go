@@ -7,19 +7,21 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"sort"
 	"sync"
 
 	msgpack "github.com/multiformats/go-multicodec/msgpack"
 
 	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-peer"
 
 	"github.com/ipfs/ipfs-cluster/api"
 )
 
 // Version is the map state Version. States with old versions should
 // perform an upgrade before.
-const Version = 4
+const Version = 6
 
 var logger = logging.Logger("mapstate")
 
@@ -28,13 +30,23 @@ var logger = logging.Logger("mapstate")
 type MapState struct {
 	pinMux  sync.RWMutex
 	PinMap  map[string]api.PinSerial
+	KVMap   map[string]string
 	Version int
+
+	// in-memory indexes of the pins allocated to every peer and of the
+	// pins referencing every other pin, which are not serialized. They
+	// are built on the first ListAllocatedTo or ListReferencing call
+	// and dropped when the state is restored.
+	allocIndex      map[string]map[string]struct{}
+	everywhereIndex map[string]struct{}
+	refIndex        map[string]map[string]struct{}
 }
 
 // NewMapState initializes the internal map and returns a new MapState object.
 func NewMapState() *MapState {
 	return &MapState{
 		PinMap:  make(map[string]api.PinSerial),
+		KVMap:   make(map[string]string),
 		Version: Version,
 	}
 }
@@ -43,7 +55,13 @@ func NewMapState() *MapState {
 func (st *MapState) Add(c api.Pin) error {
 	st.pinMux.Lock()
 	defer st.pinMux.Unlock()
-	st.PinMap[c.Cid.String()] = c.ToSerial()
+	key := c.Cid.String()
+	if old, ok := st.PinMap[key]; ok {
+		st.unindex(old)
+	}
+	pinS := c.ToSerial()
+	st.PinMap[key] = pinS
+	st.index(pinS)
 	return nil
 }
 
@@ -51,10 +69,87 @@ func (st *MapState) Add(c api.Pin) error {
 func (st *MapState) Rm(c *cid.Cid) error {
 	st.pinMux.Lock()
 	defer st.pinMux.Unlock()
-	delete(st.PinMap, c.String())
+	key := c.String()
+	if old, ok := st.PinMap[key]; ok {
+		st.unindex(old)
+	}
+	delete(st.PinMap, key)
 	return nil
 }
 
+// index adds a pin to the indexes, if they were built. Pins replicated
+// everywhere are indexed apart since they are allocated to every peer.
+func (st *MapState) index(pinS api.PinSerial) {
+	if st.allocIndex == nil {
+		return
+	}
+	if pinS.Reference != "" {
+		cids, ok := st.refIndex[pinS.Reference]
+		if !ok {
+			cids = make(map[string]struct{})
+			st.refIndex[pinS.Reference] = cids
+		}
+		cids[pinS.Cid] = struct{}{}
+	}
+	if pinS.ReplicationFactorMin == -1 {
+		st.everywhereIndex[pinS.Cid] = struct{}{}
+		return
+	}
+	for _, p := range pinS.Allocations {
+		cids, ok := st.allocIndex[p]
+		if !ok {
+			cids = make(map[string]struct{})
+			st.allocIndex[p] = cids
+		}
+		cids[pinS.Cid] = struct{}{}
+	}
+}
+
+// unindex removes a pin from the indexes, if they were built.
+func (st *MapState) unindex(pinS api.PinSerial) {
+	if st.allocIndex == nil {
+		return
+	}
+	if refs, ok := st.refIndex[pinS.Reference]; ok {
+		delete(refs, pinS.Cid)
+		if len(refs) == 0 {
+			delete(st.refIndex, pinS.Reference)
+		}
+	}
+	delete(st.everywhereIndex, pinS.Cid)
+	for _, p := range pinS.Allocations {
+		cids := st.allocIndex[p]
+		delete(cids, pinS.Cid)
+		if len(cids) == 0 {
+			delete(st.allocIndex, p)
+		}
+	}
+}
+
+// buildIndex builds the indexes from the PinMap.
+func (st *MapState) buildIndex() {
+	st.allocIndex = make(map[string]map[string]struct{})
+	st.everywhereIndex = make(map[string]struct{})
+	st.refIndex = make(map[string]map[string]struct{})
+	for _, pinS := range st.PinMap {
+		st.index(pinS)
+	}
+}
+
+// rLockIndexed read-locks the state once the indexes are built.
+func (st *MapState) rLockIndexed() {
+	st.pinMux.RLock()
+	for st.allocIndex == nil {
+		st.pinMux.RUnlock()
+		st.pinMux.Lock()
+		if st.allocIndex == nil {
+			st.buildIndex()
+		}
+		st.pinMux.Unlock()
+		st.pinMux.RLock()
+	}
+}
+
 // Get returns Pin information for a CID.
 // The returned object has its Cid and Allocations
 // fields initialized, regardless of the
@@ -92,6 +187,75 @@ func (st *MapState) List() []api.Pin {
 	return cids
 }
 
+// ListAllocatedTo provides the list of Pins allocated to the given peer,
+// including those replicated everywhere, without going through the full
+// pinset once the allocation index is built.
+func (st *MapState) ListAllocatedTo(p peer.ID) []api.Pin {
+	st.rLockIndexed()
+	defer st.pinMux.RUnlock()
+	cids := st.allocIndex[peer.IDB58Encode(p)]
+	pins := make([]api.Pin, 0, len(cids)+len(st.everywhereIndex))
+	for k := range cids {
+		pins = append(pins, st.PinMap[k].ToPin())
+	}
+	for k := range st.everywhereIndex {
+		pins = append(pins, st.PinMap[k].ToPin())
+	}
+	return pins
+}
+
+// ListReferencing provides the list of Pins whose Reference is the given
+// Cid (i.e. the shards of a meta pin), without going through the full
+// pinset once the reference index is built.
+func (st *MapState) ListReferencing(c *cid.Cid) []api.Pin {
+	st.rLockIndexed()
+	defer st.pinMux.RUnlock()
+	cids := st.refIndex[c.String()]
+	pins := make([]api.Pin, 0, len(cids))
+	for k := range cids {
+		pins = append(pins, st.PinMap[k].ToPin())
+	}
+	return pins
+}
+
+// SetKV stores a KV record in the internal map.
+func (st *MapState) SetKV(kv api.KV) error {
+	st.pinMux.Lock()
+	defer st.pinMux.Unlock()
+	st.KVMap[kv.Key] = kv.Value
+	return nil
+}
+
+// RmKV removes a KV record from the internal map.
+func (st *MapState) RmKV(key string) error {
+	st.pinMux.Lock()
+	defer st.pinMux.Unlock()
+	delete(st.KVMap, key)
+	return nil
+}
+
+// GetKV returns the KV record for the given key.
+func (st *MapState) GetKV(key string) (api.KV, bool) {
+	st.pinMux.RLock()
+	defer st.pinMux.RUnlock()
+	v, ok := st.KVMap[key]
+	return api.KV{Key: key, Value: v}, ok
+}
+
+// ListKV provides the list of KV records sorted by key.
+func (st *MapState) ListKV() []api.KV {
+	st.pinMux.RLock()
+	defer st.pinMux.RUnlock()
+	kvs := make([]api.KV, 0, len(st.KVMap))
+	for k, v := range st.KVMap {
+		kvs = append(kvs, api.KV{Key: k, Value: v})
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
+	return kvs
+}
+
 // Migrate restores a snapshot from the state's internal bytes and if
 // necessary migrates the format to the current version.
 func (st *MapState) Migrate(r io.Reader) error {
@@ -112,6 +276,9 @@ func (st *MapState) Migrate(r io.Reader) error {
 		return err
 	}
 	st.Version = Version
+	st.pinMux.Lock()
+	st.allocIndex = nil
+	st.pinMux.Unlock()
 	return nil
 }
 
@@ -166,6 +333,11 @@ func (st *MapState) Unmarshal(bs []byte) error {
 	}
 
 	st.PinMap = newState.PinMap
+	st.KVMap = newState.KVMap
+	if st.KVMap == nil { // snapshots from before KVs were introduced
+		st.KVMap = make(map[string]string)
+	}
 	st.Version = newState.Version
+	st.allocIndex = nil
 	return err
 }
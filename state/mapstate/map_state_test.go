@@ -15,6 +15,9 @@ import (
 var testCid1, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
 var testPeerID1, _ = peer.IDB58Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
 
+var testCid2, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma")
+var testPeerID2, _ = peer.IDB58Decode("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+
 var c = api.Pin{
 	Cid:                  testCid1,
 	Allocations:          []peer.ID{testPeerID1},
@@ -94,6 +97,124 @@ func TestMarshalUnmarshal(t *testing.T) {
 	}
 }
 
+func TestKV(t *testing.T) {
+	ms := NewMapState()
+	ms.SetKV(api.KV{Key: "b", Value: "2"})
+	ms.SetKV(api.KV{Key: "a", Value: "1"})
+
+	kv, ok := ms.GetKV("a")
+	if !ok || kv.Value != "1" {
+		t.Error("should have stored the value")
+	}
+
+	list := ms.ListKV()
+	if len(list) != 2 || list[0].Key != "a" || list[1].Key != "b" {
+		t.Error("expected a sorted list of two records")
+	}
+
+	b, err := ms.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms2 := NewMapState()
+	err = ms2.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, ok = ms2.GetKV("b")
+	if !ok || kv.Value != "2" {
+		t.Error("records should survive a marshal/unmarshal round")
+	}
+
+	ms.RmKV("a")
+	if _, ok := ms.GetKV("a"); ok {
+		t.Error("should have removed it")
+	}
+}
+
+func TestListAllocatedTo(t *testing.T) {
+	ms := NewMapState()
+	ms.Add(c) // replicated everywhere
+	pin2 := api.Pin{
+		Cid:                  testCid2,
+		Allocations:          []peer.ID{testPeerID1},
+		ReplicationFactorMax: 1,
+		ReplicationFactorMin: 1,
+	}
+	ms.Add(pin2)
+
+	if n := len(ms.ListAllocatedTo(testPeerID1)); n != 2 {
+		t.Error("expected 2 pins allocated to peer1:", n)
+	}
+	if n := len(ms.ListAllocatedTo(testPeerID2)); n != 1 {
+		t.Error("expected 1 pin allocated to peer2:", n)
+	}
+
+	pin2.Allocations = []peer.ID{testPeerID2}
+	ms.Add(pin2)
+	if n := len(ms.ListAllocatedTo(testPeerID1)); n != 1 {
+		t.Error("re-allocated pins should leave the index of peer1:", n)
+	}
+	if n := len(ms.ListAllocatedTo(testPeerID2)); n != 2 {
+		t.Error("expected 2 pins allocated to peer2:", n)
+	}
+
+	b, err := ms.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms2 := NewMapState()
+	err = ms2.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(ms2.ListAllocatedTo(testPeerID2)); n != 2 {
+		t.Error("the index should be rebuilt on unmarshal:", n)
+	}
+
+	ms3 := &MapState{PinMap: ms.PinMap}
+	if n := len(ms3.ListAllocatedTo(testPeerID2)); n != 2 {
+		t.Error("the index should be built for any MapState:", n)
+	}
+
+	ms.Rm(c.Cid)
+	ms.Rm(pin2.Cid)
+	if n := len(ms.ListAllocatedTo(testPeerID2)); n != 0 {
+		t.Error("removed pins should leave the index:", n)
+	}
+}
+
+func TestListReferencing(t *testing.T) {
+	ms := NewMapState()
+	ms.Add(c)
+	shard := api.Pin{
+		Cid:                  testCid2,
+		Type:                 api.ShardType,
+		Reference:            c.Cid,
+		ReplicationFactorMax: -1,
+		ReplicationFactorMin: -1,
+	}
+	ms.Add(shard)
+
+	if pins := ms.ListReferencing(c.Cid); len(pins) != 1 || !pins[0].Cid.Equals(testCid2) {
+		t.Error("expected the pin referencing c:", pins)
+	}
+	if pins := ms.ListReferencing(testCid2); len(pins) != 0 {
+		t.Error("no pin references testCid2:", pins)
+	}
+
+	shard.Reference = testCid2
+	ms.Add(shard)
+	if pins := ms.ListReferencing(c.Cid); len(pins) != 0 {
+		t.Error("updated pins should leave the index:", pins)
+	}
+
+	ms.Rm(shard.Cid)
+	if pins := ms.ListReferencing(testCid2); len(pins) != 0 {
+		t.Error("removed pins should leave the index:", pins)
+	}
+}
+
 func TestMigrateFromV1(t *testing.T) {
 	// Construct the bytes of a v1 state
 	var v1State mapStateV1
@@ -131,3 +252,66 @@ func TestMigrateFromV1(t *testing.T) {
 		t.Logf("%+v", get)
 	}
 }
+
+func TestMigrateFromV4(t *testing.T) {
+	var v4State mapStateV4
+	v4State.PinMap = map[string]api.PinSerial{
+		c.Cid.String(): c.ToSerial(),
+	}
+	v4State.Version = 4
+	buf := new(bytes.Buffer)
+	enc := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Encoder(buf)
+	err := enc.Encode(v4State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v4Bytes := append([]byte{4}, buf.Bytes()...)
+
+	ms := NewMapState()
+	err = ms.Migrate(bytes.NewBuffer(v4Bytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.Version != Version {
+		t.Error("the state should have been upgraded")
+	}
+	get := ms.Get(c.Cid)
+	if !get.Cid.Equals(c.Cid) || len(get.Allocations) != len(c.Allocations) {
+		t.Error("the pin was not migrated:", get)
+	}
+	if len(ms.ListKV()) != 0 {
+		t.Error("a migrated state should have no key-value records")
+	}
+}
+
+func TestMigrateFromV5(t *testing.T) {
+	var v5State mapStateV5
+	v5State.PinMap = map[string]api.PinSerial{
+		c.Cid.String(): c.ToSerial(),
+	}
+	v5State.KVMap = map[string]string{"a": "b"}
+	v5State.Version = 5
+	buf := new(bytes.Buffer)
+	enc := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Encoder(buf)
+	err := enc.Encode(v5State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v5Bytes := append([]byte{5}, buf.Bytes()...)
+
+	ms := NewMapState()
+	err = ms.Migrate(bytes.NewBuffer(v5Bytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.Version != Version {
+		t.Error("the state should have been upgraded")
+	}
+	get := ms.Get(c.Cid)
+	if !get.Cid.Equals(c.Cid) || get.Timestamp.IsZero() {
+		t.Error("migrated pins should have a creation time:", get)
+	}
+	if kv, ok := ms.GetKV("a"); !ok || kv.Value != "b" {
+		t.Error("the key-value records should have been migrated")
+	}
+}
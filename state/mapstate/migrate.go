@@ -8,6 +8,7 @@ package mapstate
 import (
 	"bytes"
 	"errors"
+	"time"
 
 	msgpack "github.com/multiformats/go-multicodec/msgpack"
 
@@ -135,13 +136,76 @@ func (st *mapStateV4) unmarshal(bs []byte) error {
 }
 
 func (st *mapStateV4) next() migrateable {
+	var mst5 mapStateV5
+	mst5.PinMap = make(map[string]api.PinSerial)
+	mst5.KVMap = make(map[string]string)
+	for k, v := range st.PinMap {
+		mst5.PinMap[k] = v
+	}
+	return &mst5
+}
+
+/* V5 */
+
+// V5 adds the key-value records and the new optional Pin fields, which
+// take their zero value when migrating from V4.
+type mapStateV5 struct {
+	PinMap  map[string]api.PinSerial
+	KVMap   map[string]string
+	Version int
+}
+
+func (st *mapStateV5) unmarshal(bs []byte) error {
+	buf := bytes.NewBuffer(bs)
+	dec := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Decoder(buf)
+	return dec.Decode(st)
+}
+
+func (st *mapStateV5) next() migrateable {
+	var mst6 mapStateV6
+	mst6.PinMap = make(map[string]api.PinSerial)
+	mst6.KVMap = make(map[string]string)
+	// the time the pins were created is unknown
+	now := time.Now().UnixNano()
+	for k, v := range st.PinMap {
+		if v.Timestamp == 0 {
+			v.Timestamp = now
+		}
+		mst6.PinMap[k] = v
+	}
+	for k, v := range st.KVMap {
+		mst6.KVMap[k] = v
+	}
+	return &mst6
+}
+
+/* V6 */
+
+// V6 adds the creation time of the pins, which is set to the time of
+// the migration when migrating from V5, and their providers.
+type mapStateV6 struct {
+	PinMap  map[string]api.PinSerial
+	KVMap   map[string]string
+	Version int
+}
+
+func (st *mapStateV6) unmarshal(bs []byte) error {
+	buf := bytes.NewBuffer(bs)
+	dec := msgpack.Multicodec(msgpack.DefaultMsgpackHandle()).Decoder(buf)
+	return dec.Decode(st)
+}
+
+func (st *mapStateV6) next() migrateable {
 	return nil
 }
 
-func finalCopy(st *MapState, internal *mapStateV4) {
+func finalCopy(st *MapState, internal *mapStateV6) {
 	for k, v := range internal.PinMap {
 		st.PinMap[k] = v
 	}
+	for k, v := range internal.KVMap {
+		st.KVMap[k] = v
+	}
 }
 
 func (st *MapState) migrateFrom(version int, snap []byte) error {
@@ -156,6 +220,12 @@ func (st *MapState) migrateFrom(version int, snap []byte) error {
 	case 3:
 		var mst3 mapStateV3
 		m = &mst3
+	case 4:
+		var mst4 mapStateV4
+		m = &mst4
+	case 5:
+		var mst5 mapStateV5
+		m = &mst5
 	default:
 		return errors.New("version migration not supported")
 	}
@@ -168,11 +238,11 @@ func (st *MapState) migrateFrom(version int, snap []byte) error {
 	for {
 		next = m.next()
 		if next == nil {
-			mst4, ok := m.(*mapStateV4)
+			mst6, ok := m.(*mapStateV6)
 			if !ok {
 				return errors.New("migration ended prematurely")
 			}
-			finalCopy(st, mst4)
+			finalCopy(st, mst6)
 			return nil
 		}
 		m = next
@@ -0,0 +1,74 @@
+package ipfscluster
+
+import (
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// When the Consensus component is a StateNotifier, the PinTracker
+// follows the pins and unpins as they are applied to the shared state,
+// instead of being asked to Track and Untrack them over RPC. The
+// periodic StateSync, which scans the whole state, is then only needed
+// when some changes were missed.
+
+// stateChangeRetryInterval is how often the changes which could not be
+// applied to the tracker are retried.
+var stateChangeRetryInterval = 10 * time.Second
+
+// watchStateChanges tracks and untracks the items as they are changed
+// in the shared state. Changes which fail are retried every
+// stateChangeRetryInterval, unless a newer change for the same Cid
+// arrives first.
+func (c *Cluster) watchStateChanges(changes <-chan api.StateChange) {
+	failed := make(map[string]api.StateChange)
+	ticker := time.NewTicker(stateChangeRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case change := <-changes:
+			key := change.Pin.Cid.String()
+			delete(failed, key)
+			if err := c.applyStateChange(change); err != nil {
+				failed[key] = change
+			}
+		case <-ticker.C:
+			for key, change := range failed {
+				if c.applyStateChange(change) == nil {
+					delete(failed, key)
+				}
+			}
+		}
+	}
+}
+
+// applyStateChange tracks or untracks the item of a change.
+func (c *Cluster) applyStateChange(change api.StateChange) error {
+	var err error
+	switch change.Type {
+	case api.StateChangePin:
+		err = c.tracker.Track(change.Pin)
+	case api.StateChangeUnpin:
+		c.allocHistory.forget(change.Pin.Cid)
+		err = c.tracker.Untrack(change.Pin.Cid)
+	default:
+		logger.Errorf("unknown state change type: %s", change.Type)
+		return nil
+	}
+	if err != nil {
+		logger.Errorf("error applying the %s of %s to the tracker: %s", change.Type, change.Pin.Cid, err)
+	}
+	return err
+}
+
+// stateSyncNeeded tells whether the periodic StateSync should run.
+func (c *Cluster) stateSyncNeeded() bool {
+	notifier, ok := c.consensus.(StateNotifier)
+	if !ok {
+		return true
+	}
+	return notifier.MissedChanges()
+}
@@ -0,0 +1,153 @@
+package ipfscluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+)
+
+// StrayPins returns the items which are pinned in the IPFS daemons of the
+// cluster peers without being allocated to them in the shared state.
+// Unreachable peers are skipped.
+func (c *Cluster) StrayPins() ([]api.StrayPin, error) {
+	members, err := c.consensus.Peers()
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make([][]api.StrayPin, len(members), len(members))
+	ifaces := make([]interface{}, len(members), len(members))
+	for i := range replies {
+		ifaces[i] = &replies[i]
+	}
+	errs := c.multiRPC(members, "Cluster", "StrayPinsLocal", struct{}{}, ifaces)
+
+	var strays []api.StrayPin
+	for i, err := range errs {
+		if err != nil {
+			logger.Errorf("%s: error listing stray pins in %s: %s", c.id, members[i], err)
+			continue
+		}
+		strays = append(strays, replies[i]...)
+	}
+	return strays, nil
+}
+
+// StrayPinsLocal returns the items which are pinned recursively in the IPFS
+// daemon of this peer without being allocated to it in the shared state.
+func (c *Cluster) StrayPinsLocal() ([]api.StrayPin, error) {
+	ipfsPins, err := c.ipfs.PinLs(c.ctx, "recursive")
+	if err != nil {
+		return nil, err
+	}
+
+	cState, err := c.consensus.State()
+	if err != nil {
+		return nil, err
+	}
+
+	c.strayMux.Lock()
+	defer c.strayMux.Unlock()
+
+	strays := []api.StrayPin{}
+	for cidStr := range ipfsPins {
+		h, err := cid.Decode(cidStr)
+		if err != nil {
+			continue
+		}
+		stray, tracked := c.isStray(cState, h)
+		if !stray {
+			continue
+		}
+		_, ignored := c.ignoredStrays[h.String()]
+		strays = append(strays, api.StrayPin{
+			Cid:      h.String(),
+			Peer:     peer.IDB58Encode(c.id),
+			Peername: c.config.Peername,
+			Tracked:  tracked,
+			Ignored:  ignored,
+		})
+	}
+	sort.Slice(strays, func(i, j int) bool {
+		return strays[i].Cid < strays[j].Cid
+	})
+	return strays, nil
+}
+
+// isStray returns whether the given item should not be pinned in this
+// peer and whether it is tracked by the cluster at all.
+func (c *Cluster) isStray(cState state.State, h *cid.Cid) (bool, bool) {
+	if !cState.Has(h) {
+		return true, false
+	}
+	pin := cState.Get(h)
+	if pin.ReplicationFactorMax < 0 || containsPeer(pin.Allocations, c.id) {
+		return false, true
+	}
+	return true, true
+}
+
+// RemediateStrayPin applies an action to an item reported as stray
+// by the given peer:
+//
+//   - "adopt" pins the item in the cluster. Only items which are not
+//     tracked by the cluster can be adopted.
+//   - "ignore" marks the item as ignored in the reports of the peer, until
+//     it restarts.
+//   - "remove" unpins the item from the IPFS daemon of the peer.
+func (c *Cluster) RemediateStrayPin(p peer.ID, h *cid.Cid, action api.StrayPinAction) error {
+	in := api.StrayPinRemediation{
+		Peer:   peer.IDB58Encode(p),
+		Cid:    h.String(),
+		Action: action,
+	}
+	return c.rpcClient.Call(p, "Cluster", "RemediateStrayPinLocal", in, &struct{}{})
+}
+
+// RemediateStrayPinLocal applies an action to an item reported as stray
+// by this peer. See RemediateStrayPin.
+func (c *Cluster) RemediateStrayPinLocal(h *cid.Cid, action api.StrayPinAction) error {
+	switch action {
+	case api.StrayPinAdopt, api.StrayPinIgnore, api.StrayPinRemove:
+	default:
+		return fmt.Errorf("unknown stray pin action: %s", action)
+	}
+
+	cState, err := c.consensus.State()
+	if err != nil {
+		return err
+	}
+	stray, tracked := c.isStray(cState, h)
+	if !stray {
+		return errors.New("the item is allocated to this peer")
+	}
+
+	switch action {
+	case api.StrayPinAdopt:
+		if tracked {
+			return errors.New("the item is already pinned in the cluster")
+		}
+		err = c.Pin(api.PinCid(h))
+	case api.StrayPinIgnore:
+		c.strayMux.Lock()
+		c.ignoredStrays[h.String()] = struct{}{}
+		c.strayMux.Unlock()
+		return nil
+	case api.StrayPinRemove:
+		err = c.ipfs.Unpin(c.ctx, h)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.strayMux.Lock()
+	delete(c.ignoredStrays, h.String())
+	c.strayMux.Unlock()
+	return nil
+}
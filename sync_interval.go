@@ -0,0 +1,47 @@
+package ipfscluster
+
+import "time"
+
+// adaptiveInterval provides the time to wait until the next run of a
+// periodic sync operation. When bounds are given, the interval is halved
+// (down to min) after a run which found discrepancies or errors, and
+// grows by half (up to max) after a clean run. Without bounds, the
+// interval is constant.
+type adaptiveInterval struct {
+	current  time.Duration
+	min, max time.Duration
+}
+
+func newAdaptiveInterval(interval, min, max time.Duration) *adaptiveInterval {
+	return &adaptiveInterval{
+		current: interval,
+		min:     min,
+		max:     max,
+	}
+}
+
+func (ai *adaptiveInterval) adaptive() bool {
+	return ai.min > 0 && ai.max > 0
+}
+
+// next updates the interval with the outcome of the last run and
+// returns it.
+func (ai *adaptiveInterval) next(drift bool) time.Duration {
+	if !ai.adaptive() {
+		return ai.current
+	}
+
+	if drift {
+		ai.current = ai.current / 2
+	} else {
+		ai.current = ai.current + ai.current/2
+	}
+
+	if ai.current < ai.min {
+		ai.current = ai.min
+	}
+	if ai.current > ai.max {
+		ai.current = ai.max
+	}
+	return ai.current
+}
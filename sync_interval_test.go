@@ -0,0 +1,30 @@
+package ipfscluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveInterval(t *testing.T) {
+	ai := newAdaptiveInterval(time.Minute, 0, 0)
+	if ai.next(true) != time.Minute || ai.next(false) != time.Minute {
+		t.Error("interval should be constant without bounds")
+	}
+
+	ai = newAdaptiveInterval(time.Minute, 20*time.Second, 2*time.Minute)
+	if d := ai.next(true); d != 30*time.Second {
+		t.Error("interval should be halved after a drift: ", d)
+	}
+	if d := ai.next(true); d != 20*time.Second {
+		t.Error("interval should not go below min: ", d)
+	}
+	if d := ai.next(false); d != 30*time.Second {
+		t.Error("interval should grow after a clean run: ", d)
+	}
+	for i := 0; i < 10; i++ {
+		ai.next(false)
+	}
+	if ai.current != 2*time.Minute {
+		t.Error("interval should not go above max: ", ai.current)
+	}
+}
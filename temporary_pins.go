@@ -0,0 +1,119 @@
+package ipfscluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	cid "github.com/ipfs/go-cid"
+)
+
+var temporaryPinsBucket = []byte("temporary-pins")
+
+// temporaryPins are the roots of the content added through this peer
+// which its IPFS daemon pins until their allocations do. They are
+// persisted in a BoltDB datastore, when open, so that the pins left
+// when the peer shuts down are released after it restarts.
+type temporaryPins struct {
+	mu    sync.Mutex
+	roots map[string]*cid.Cid
+	db    *bolt.DB
+}
+
+func newTemporaryPins() *temporaryPins {
+	return &temporaryPins{
+		roots: make(map[string]*cid.Cid),
+	}
+}
+
+// open loads the temporary pins from the datastore at the given path,
+// creating it if needed, and keeps it open to save the changes.
+func (tp *temporaryPins) open(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(temporaryPinsBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			c, err := cid.Decode(string(k))
+			if err != nil {
+				logger.Warningf("skipping malformed temporary pin: %s", err)
+				return nil
+			}
+			tp.roots[c.String()] = c
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	tp.db = db
+	return nil
+}
+
+// add records new temporary pins.
+func (tp *temporaryPins) add(roots []*cid.Cid) error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for _, c := range roots {
+		tp.roots[c.String()] = c
+	}
+	if tp.db == nil {
+		return nil
+	}
+	// the values tell when the items were added
+	added := []byte(time.Now().UTC().Format(time.RFC3339))
+	return tp.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(temporaryPinsBucket)
+		for _, c := range roots {
+			if err := bucket.Put([]byte(c.String()), added); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// remove forgets a temporary pin once it has been released.
+func (tp *temporaryPins) remove(c *cid.Cid) error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	delete(tp.roots, c.String())
+	if tp.db == nil {
+		return nil
+	}
+	return tp.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(temporaryPinsBucket).Delete([]byte(c.String()))
+	})
+}
+
+// list returns the temporary pins.
+func (tp *temporaryPins) list() []*cid.Cid {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	roots := make([]*cid.Cid, 0, len(tp.roots))
+	for _, c := range tp.roots {
+		roots = append(roots, c)
+	}
+	return roots
+}
+
+// close closes the datastore.
+func (tp *temporaryPins) close() error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.db == nil {
+		return nil
+	}
+	err := tp.db.Close()
+	tp.db = nil
+	return err
+}
@@ -0,0 +1,42 @@
+package ipfscluster
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestTemporaryPins(t *testing.T) {
+	path := "temporaryPinsFromTests"
+	defer os.Remove(path)
+
+	tp := newTemporaryPins()
+	if err := tp.open(path); err != nil {
+		t.Fatal(err)
+	}
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	if err := tp.add([]*cid.Cid{c1, c2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tp.remove(c1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tp.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pins left are loaded again
+	tp = newTemporaryPins()
+	if err := tp.open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.close()
+	roots := tp.list()
+	if len(roots) != 1 || !roots[0].Equals(c2) {
+		t.Error("unexpected temporary pins:", roots)
+	}
+}
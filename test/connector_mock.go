@@ -0,0 +1,258 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// ErrMockConnector is returned by the MockConnector operations when
+// ReturnError is set.
+var ErrMockConnector = errors.New("this is an expected error from the mock connector")
+
+// MockConnector is an IPFSConnector which does not contact any IPFS
+// daemon. Pins and unpins succeed, PinLs lists the Pins and every Cid
+// is reported as recursively pinned by PinLsCid.
+type MockConnector struct {
+	// ReturnError makes most operations fail with ErrMockConnector.
+	ReturnError bool
+	// Pins are the pins listed by PinLs.
+	Pins map[string]api.IPFSPinStatus
+	// HashContent makes Add report the files it reads with a Cid
+	// derived from their content, or ErrorCid when it is "error",
+	// rather than TestCid3.
+	HashContent bool
+
+	rpcClient *rpc.Client
+}
+
+// SetClient stores the given RPC client.
+func (ipfs *MockConnector) SetClient(client *rpc.Client) {
+	ipfs.rpcClient = client
+}
+
+// Shutdown does nothing.
+func (ipfs *MockConnector) Shutdown() error {
+	return nil
+}
+
+// ID returns TestPeerID1 as the IPFS daemon ID.
+func (ipfs *MockConnector) ID() (api.IPFSID, error) {
+	if ipfs.ReturnError {
+		return api.IPFSID{}, ErrMockConnector
+	}
+	return api.IPFSID{
+		ID: TestPeerID1,
+	}, nil
+}
+
+// Pin does nothing.
+func (ipfs *MockConnector) Pin(ctx context.Context, c *cid.Cid, recursive bool) error {
+	if ipfs.ReturnError {
+		return ErrMockConnector
+	}
+	return nil
+}
+
+// PinDepth does nothing.
+func (ipfs *MockConnector) PinDepth(ctx context.Context, c *cid.Cid, maxDepth int) error {
+	if ipfs.ReturnError {
+		return ErrMockConnector
+	}
+	return nil
+}
+
+// UnpinDepth does nothing.
+func (ipfs *MockConnector) UnpinDepth(ctx context.Context, c *cid.Cid, maxDepth int, keep []api.Pin) error {
+	if ipfs.ReturnError {
+		return ErrMockConnector
+	}
+	return nil
+}
+
+// PinUpdate does nothing.
+func (ipfs *MockConnector) PinUpdate(ctx context.Context, from, to *cid.Cid) error {
+	if ipfs.ReturnError {
+		return ErrMockConnector
+	}
+	return nil
+}
+
+// Add reads the files in the multipart body and reports each of them as
+// imported with TestCid3 (see HashContent).
+func (ipfs *MockConnector) Add(ctx context.Context, params api.AddParams, contentType string, body io.Reader) ([]api.AddedOutput, error) {
+	if ipfs.ReturnError {
+		return nil, ErrMockConnector
+	}
+	_, mParams, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	var added []api.AddedOutput
+	mr := multipart.NewReader(body, mParams["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, api.AddedOutput{
+			Name: part.FileName(),
+			Cid:  ipfs.addedCid(content),
+		})
+	}
+	if len(added) == 0 {
+		return nil, errors.New("nothing was added")
+	}
+	return added, nil
+}
+
+func (ipfs *MockConnector) addedCid(content []byte) string {
+	switch {
+	case !ipfs.HashContent:
+		return TestCid3
+	case string(content) == "error":
+		return ErrorCid
+	}
+	base, _ := cid.Decode(TestCid1)
+	c, _ := base.Prefix().Sum(content)
+	return c.String()
+}
+
+// DAGImport reads the CAR file and does nothing with it.
+func (ipfs *MockConnector) DAGImport(ctx context.Context, car io.Reader, pinRoots bool) error {
+	if ipfs.ReturnError {
+		return ErrMockConnector
+	}
+	n, err := io.Copy(ioutil.Discard, car)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("empty CAR file")
+	}
+	return nil
+}
+
+// DAGExport writes "car:" followed by the given Cid.
+func (ipfs *MockConnector) DAGExport(ctx context.Context, c *cid.Cid, w io.Writer) error {
+	if ipfs.ReturnError {
+		return ErrMockConnector
+	}
+	_, err := io.WriteString(w, "car:"+c.String())
+	return err
+}
+
+// Unpin does nothing.
+func (ipfs *MockConnector) Unpin(ctx context.Context, c *cid.Cid) error {
+	if ipfs.ReturnError {
+		return ErrMockConnector
+	}
+	return nil
+}
+
+// PinLsCid reports every Cid as recursively pinned.
+func (ipfs *MockConnector) PinLsCid(ctx context.Context, c *cid.Cid) (api.IPFSPinStatus, error) {
+	if ipfs.ReturnError {
+		return api.IPFSPinStatusError, ErrMockConnector
+	}
+	return api.IPFSPinStatusRecursive, nil
+}
+
+// PinLs returns a copy of the Pins, regardless of the filter.
+func (ipfs *MockConnector) PinLs(ctx context.Context, filter string) (map[string]api.IPFSPinStatus, error) {
+	if ipfs.ReturnError {
+		return nil, ErrMockConnector
+	}
+	m := make(map[string]api.IPFSPinStatus)
+	for k, v := range ipfs.Pins {
+		m[k] = v
+	}
+	return m, nil
+}
+
+// SwarmPeers returns TestPeerID4 and TestPeerID5.
+func (ipfs *MockConnector) SwarmPeers() (api.SwarmPeers, error) {
+	return []peer.ID{TestPeerID4, TestPeerID5}, nil
+}
+
+// ConnectSwarms does nothing.
+func (ipfs *MockConnector) ConnectSwarms() error { return nil }
+
+// ConfigKey returns nil for every key.
+func (ipfs *MockConnector) ConfigKey(keypath string) (interface{}, error) { return nil, nil }
+
+// FreeSpace returns 100.
+func (ipfs *MockConnector) FreeSpace() (uint64, error) { return 100, nil }
+
+// RepoSize returns 0.
+func (ipfs *MockConnector) RepoSize() (uint64, error) { return 0, nil }
+
+// BandwidthStats returns empty statistics.
+func (ipfs *MockConnector) BandwidthStats() (api.IPFSBandwidth, error) {
+	return api.IPFSBandwidth{}, nil
+}
+
+// DAGSize returns 1000 for every Cid.
+func (ipfs *MockConnector) DAGSize(ctx context.Context, c *cid.Cid) (uint64, error) {
+	if ipfs.ReturnError {
+		return 0, ErrMockConnector
+	}
+	return 1000, nil
+}
+
+// PutLinks returns a Cid derived from the given ones, without storing
+// anything. It fails when one of them is ErrorCid.
+func (ipfs *MockConnector) PutLinks(ctx context.Context, links []*cid.Cid) (*cid.Cid, error) {
+	if ipfs.ReturnError {
+		return nil, ErrMockConnector
+	}
+	if len(links) == 0 {
+		return nil, errors.New("no links")
+	}
+	var data []byte
+	for _, l := range links {
+		if l.String() == ErrorCid {
+			return nil, ErrMockConnector
+		}
+		data = append(data, l.Bytes()...)
+	}
+	return links[0].Prefix().Sum(data)
+}
+
+// PutUnixFS returns a Cid derived from the names and Cids of the links,
+// without storing anything. It fails when one of them is ErrorCid.
+func (ipfs *MockConnector) PutUnixFS(ctx context.Context, node api.UnixFSNode) (*cid.Cid, error) {
+	if ipfs.ReturnError {
+		return nil, ErrMockConnector
+	}
+	if len(node.Links) == 0 && !node.Directory {
+		return nil, errors.New("no links")
+	}
+	data := []byte(fmt.Sprintf("unixfs:%t", node.Directory))
+	for _, l := range node.Links {
+		if l.Cid.String() == ErrorCid {
+			return nil, ErrMockConnector
+		}
+		data = append(data, l.Name...)
+		data = append(data, l.Cid.Bytes()...)
+	}
+	base, _ := cid.Decode(TestCid1)
+	return base.Prefix().Sum(data)
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	rpc "github.com/hsanjuan/go-libp2p-gorpc"
+)
+
+// MockInformer is an Informer which provides a metric with a fixed
+// value. The metric is invalid after Shutdown.
+type MockInformer struct {
+	MetricName string
+	Value      string
+	TTL        time.Duration
+
+	rpcClient *rpc.Client
+	shutdown  bool
+}
+
+// NewMockInformer returns a MockInformer providing a metric with the
+// given name and value, valid for 30 seconds.
+func NewMockInformer(name, value string) *MockInformer {
+	return &MockInformer{
+		MetricName: name,
+		Value:      value,
+		TTL:        30 * time.Second,
+	}
+}
+
+// Name returns the MetricName.
+func (inf *MockInformer) Name() string {
+	return inf.MetricName
+}
+
+// SetClient stores the given RPC client.
+func (inf *MockInformer) SetClient(client *rpc.Client) {
+	inf.rpcClient = client
+}
+
+// Shutdown invalidates the metrics from this point.
+func (inf *MockInformer) Shutdown() error {
+	inf.shutdown = true
+	return nil
+}
+
+// GetMetric returns the metric with the configured value.
+func (inf *MockInformer) GetMetric() api.Metric {
+	m := api.Metric{
+		Name:  inf.MetricName,
+		Value: inf.Value,
+		Valid: !inf.shutdown,
+	}
+	m.SetTTLDuration(inf.TTL)
+	return m
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state/mapstate"
@@ -21,6 +22,7 @@ type IpfsMock struct {
 	Addr   string
 	Port   int
 	pinMap *mapstate.MapState
+	gcRuns int32
 }
 
 type mockPinResp struct {
@@ -51,6 +53,20 @@ type mockRepoStatResp struct {
 	StorageMax uint64
 }
 
+type mockBandwidthResp struct {
+	TotalIn  uint64
+	TotalOut uint64
+	RateIn   float64
+	RateOut  float64
+}
+
+type mockObjectStatResp struct {
+	Hash           string
+	Key            string
+	CumulativeSize uint64
+	Size           uint64
+}
+
 type mockConfigResp struct {
 	Datastore struct {
 		StorageMax string
@@ -95,6 +111,12 @@ func NewIpfsMock() *IpfsMock {
 
 }
 
+// GCRuns returns how many times the repository garbage collection
+// was requested.
+func (m *IpfsMock) GCRuns() int {
+	return int(atomic.LoadInt32(&m.gcRuns))
+}
+
 // FIXME: what if IPFS API changes?
 func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 	p := r.URL.Path
@@ -110,9 +132,6 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		j, _ := json.Marshal(resp)
 		w.Write(j)
 	case "add":
-		c, _ := cid.Decode(TestCid3)
-		// add also pins
-		m.pinMap.Add(api.PinCid(c))
 		_, fheader, err := r.FormFile("file")
 		if err != nil {
 			http.Error(w, "no file in /add", 500)
@@ -120,6 +139,11 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		query := r.URL.Query()
+		// add also pins, unless told not to
+		if query.Get("pin") != "false" {
+			c, _ := cid.Decode(TestCid3)
+			m.pinMap.Add(api.PinCid(c))
+		}
 		progress, ok := query["progress"]
 		if ok && len(progress) > 0 && progress[0] != "false" {
 			progressResp := mockAddResp{
@@ -137,35 +161,61 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		j, _ := json.Marshal(resp)
 		w.Write(j)
 	case "pin/add":
-		arg, ok := extractCid(r.URL)
-		if !ok {
+		args := r.URL.Query()["arg"]
+		if len(args) == 0 {
+			goto ERROR
+		}
+		for _, arg := range args {
+			if arg == ErrorCid {
+				goto ERROR
+			}
+			c, err := cid.Decode(arg)
+			if err != nil {
+				goto ERROR
+			}
+			m.pinMap.Add(api.PinCid(c))
+		}
+		resp := mockPinResp{
+			Pins: args,
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
+	case "pin/update":
+		args := r.URL.Query()["arg"]
+		if len(args) != 2 {
 			goto ERROR
 		}
-		if arg == ErrorCid {
+		from, err := cid.Decode(args[0])
+		if err != nil {
 			goto ERROR
 		}
-		c, err := cid.Decode(arg)
+		to, err := cid.Decode(args[1])
 		if err != nil {
 			goto ERROR
 		}
-		m.pinMap.Add(api.PinCid(c))
+		if !m.pinMap.Has(from) {
+			goto ERROR
+		}
+		m.pinMap.Add(api.PinCid(to))
 		resp := mockPinResp{
-			Pins: []string{arg},
+			Pins: []string{args[0], args[1]},
 		}
 		j, _ := json.Marshal(resp)
 		w.Write(j)
 	case "pin/rm":
-		arg, ok := extractCid(r.URL)
-		if !ok {
+		args := r.URL.Query()["arg"]
+		if len(args) == 0 {
 			goto ERROR
 		}
-		c, err := cid.Decode(arg)
-		if err != nil {
-			goto ERROR
+		for _, arg := range args {
+			c, err := cid.Decode(arg)
+			if err != nil {
+				goto ERROR
+			}
+			m.pinMap.Rm(c)
 		}
-		m.pinMap.Rm(c)
 		resp := mockPinResp{
-			Pins: []string{arg},
+			Pins: args,
 		}
 		j, _ := json.Marshal(resp)
 		w.Write(j)
@@ -235,6 +285,31 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		}
 		j, _ := json.Marshal(resp)
 		w.Write(j)
+	case "repo/gc":
+		atomic.AddInt32(&m.gcRuns, 1)
+		w.Write([]byte("{}"))
+	case "stats/bw":
+		resp := mockBandwidthResp{
+			TotalIn:  1000000,
+			TotalOut: 500000,
+			RateIn:   2048.5,
+			RateOut:  1024,
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
+	case "object/stat", "block/stat":
+		arg, ok := extractCid(r.URL)
+		if !ok {
+			goto ERROR
+		}
+		resp := mockObjectStatResp{
+			Hash:           arg,
+			Key:            arg,
+			CumulativeSize: 1000,
+			Size:           1000,
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
 	case "config/show":
 		resp := mockConfigResp{
 			Datastore: struct {
@@ -255,6 +330,32 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		}
 		j, _ := json.Marshal(resp)
 		w.Write(j)
+	case "dag/put":
+		if _, _, err := r.FormFile("file"); err != nil {
+			http.Error(w, "no file in /dag/put", 500)
+			return
+		}
+		w.Write([]byte(`{"Cid":{"/":"` + TestCid2 + `"}}`))
+	case "object/put":
+		if _, _, err := r.FormFile("file"); err != nil {
+			http.Error(w, "no file in /object/put", 500)
+			return
+		}
+		w.Write([]byte(`{"Hash":"` + TestCid3 + `"}`))
+	case "dag/import":
+		if pinRoots := r.URL.Query().Get("pin-roots"); pinRoots != "true" && pinRoots != "false" {
+			goto ERROR
+		}
+		if _, _, err := r.FormFile("file"); err != nil {
+			http.Error(w, "no file in /dag/import", 500)
+			return
+		}
+	case "dag/export":
+		arg, ok := extractCid(r.URL)
+		if !ok {
+			goto ERROR
+		}
+		w.Write([]byte("car:" + arg))
 	case "version":
 		w.Write([]byte("{\"Version\":\"m.o.c.k\"}"))
 	default:
@@ -3,6 +3,8 @@ package test
 import (
 	"context"
 	"errors"
+	"io"
+	"io/ioutil"
 	"testing"
 	"time"
 
@@ -18,7 +20,17 @@ import (
 // fail.
 var ErrBadCid = errors.New("this is an expected error when using ErrorCid")
 
-type mockService struct{}
+// ErrorKey is a key-value record key for which operations always fail.
+const ErrorKey = "errorkey"
+
+// MockService implements the ipfs-cluster RPC API ("Cluster" service)
+// with canned responses, so that components can be tested without
+// a running cluster peer. Operations on ErrorCid and ErrorKey fail.
+//
+// Component tests which need different responses can register a type
+// which embeds MockService and overrides some of its methods with
+// NewMockRPCClientWithService.
+type MockService struct{}
 
 // NewMockRPCClient creates a mock ipfs-cluster RPC server and returns
 // a client to it.
@@ -29,53 +41,281 @@ func NewMockRPCClient(t *testing.T) *rpc.Client {
 // NewMockRPCClientWithHost returns a mock ipfs-cluster RPC server
 // initialized with a given host.
 func NewMockRPCClientWithHost(t *testing.T, h host.Host) *rpc.Client {
+	return NewMockRPCClientWithService(t, h, &MockService{})
+}
+
+// NewMockRPCClientWithService returns a client to an RPC server, using
+// the given host, which serves the given service as the "Cluster"
+// service. It is usually a type embedding MockService.
+func NewMockRPCClientWithService(t *testing.T, h host.Host, svc interface{}) *rpc.Client {
 	s := rpc.NewServer(h, "mock")
 	c := rpc.NewClientWithServer(h, "mock", s)
-	err := s.RegisterName("Cluster", &mockService{})
+	err := s.RegisterName("Cluster", svc)
 	if err != nil {
 		t.Fatal(err)
 	}
 	return c
 }
 
-func (mock *mockService) Pin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (mock *MockService) Pin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	return nil
+}
+
+func (mock *MockService) PinBatch(ctx context.Context, in []api.PinSerial, out *struct{}) error {
+	for _, p := range in {
+		if p.Cid == ErrorCid {
+			return ErrBadCid
+		}
+	}
+	return nil
+}
+
+func (mock *MockService) PinWithResult(ctx context.Context, in api.PinSerial, out *api.PinResult) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	*out = api.PinResult{
+		Action: api.PinActionPinned,
+		Pin:    in,
+	}
+	return nil
+}
+
+func (mock *MockService) PinOverwrite(ctx context.Context, in api.PinSerial, out *api.PinResult) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	*out = api.PinResult{
+		Action: api.PinActionOverwritten,
+		Pin:    in,
+	}
+	return nil
+}
+
+func (mock *MockService) Add(ctx context.Context, in api.AddRequest, out *[]api.AddedOutput) error {
+	if in.Body == nil {
+		return errors.New("nothing to add")
+	}
+	*out = []api.AddedOutput{
+		{
+			Name: "file",
+			Cid:  TestCid1,
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) ImportCAR(ctx context.Context, in api.CARImportRequest, out *[]api.PinSerial) error {
+	if in.Body == nil {
+		return errors.New("empty CAR file")
+	}
+	car, err := ioutil.ReadAll(in.Body)
+	if err != nil {
+		return err
+	}
+	if len(car) == 0 {
+		return errors.New("empty CAR file")
+	}
+	pin := in.Pin
+	pin.Cid = TestCid1
+	*out = []api.PinSerial{pin}
+	return nil
+}
+
+func (mock *MockService) ExportCAR(ctx context.Context, in api.CARExportRequest, out *struct{}) error {
 	if in.Cid == ErrorCid {
 		return ErrBadCid
 	}
+	_, err := io.WriteString(in.Writer, "car:"+in.Cid)
+	return err
+}
+
+func (mock *MockService) PinUpdate(ctx context.Context, in api.PinUpdateRequest, out *api.PinSerial) error {
+	if in.From == ErrorCid || in.To == ErrorCid {
+		return ErrBadCid
+	}
+	*out = api.PinSerial{
+		Cid:                  in.To,
+		Name:                 "dataset",
+		ReplicationFactorMin: -1,
+		ReplicationFactorMax: -1,
+		PinUpdate:            in.From,
+	}
 	return nil
 }
 
-func (mock *mockService) Unpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (mock *MockService) Unpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
 	if in.Cid == ErrorCid {
 		return ErrBadCid
 	}
 	return nil
 }
 
-func (mock *mockService) Pins(ctx context.Context, in struct{}, out *[]api.PinSerial) error {
+func (mock *MockService) Pins(ctx context.Context, in struct{}, out *[]api.PinSerial) error {
 	*out = []api.PinSerial{
 		{
-			Cid: TestCid1,
+			Cid:       TestCid1,
+			Recursive: true,
 		},
 		{
-			Cid: TestCid2,
+			Cid:       TestCid2,
+			Name:      "dataset",
+			Metadata:  map[string]string{"owner": "alice"},
+			Recursive: true,
 		},
 		{
-			Cid: TestCid3,
+			Cid:       TestCid3,
+			Recursive: true,
+			MaxDepth:  1,
 		},
 	}
 	return nil
 }
 
-func (mock *mockService) PinGet(ctx context.Context, in api.PinSerial, out *api.PinSerial) error {
+func (mock *MockService) PinGet(ctx context.Context, in api.PinSerial, out *api.PinSerial) error {
+	if in.Cid == ErrorCid {
+		return errors.New("expected error when using ErrorCid")
+	}
+	*out = in
+	return nil
+}
+
+func (mock *MockService) AllocationPreview(ctx context.Context, in api.PinSerial, out *api.PinSerial) error {
 	if in.Cid == ErrorCid {
 		return errors.New("expected error when using ErrorCid")
 	}
 	*out = in
+	out.Allocations = []string{TestPeerID1.Pretty(), TestPeerID2.Pretty()}
+	return nil
+}
+
+func (mock *MockService) PinEstimate(ctx context.Context, in api.PinSerial, out *api.PinEstimate) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	*out = api.PinEstimate{
+		Cid:         in.Cid,
+		Size:        1000,
+		Replication: 2,
+		TotalSize:   2000,
+		Allocations: []string{TestPeerID1.Pretty(), TestPeerID2.Pretty()},
+		Feasible:    true,
+	}
+	return nil
+}
+
+func (mock *MockService) KVs(ctx context.Context, in struct{}, out *[]api.KV) error {
+	*out = []api.KV{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "2"},
+	}
+	return nil
+}
+
+func (mock *MockService) KVGet(ctx context.Context, in string, out *api.KV) error {
+	if in == ErrorKey {
+		return errors.New("key is not part of the global state")
+	}
+	*out = api.KV{Key: in, Value: "1"}
+	return nil
+}
+
+func (mock *MockService) KVSet(ctx context.Context, in api.KV, out *struct{}) error {
+	if in.Key == ErrorKey {
+		return errors.New("expected error when using ErrorKey")
+	}
+	return nil
+}
+
+func (mock *MockService) KVRm(ctx context.Context, in string, out *struct{}) error {
+	if in == ErrorKey {
+		return errors.New("key is not part of the global state")
+	}
+	return nil
+}
+
+func (mock *MockService) Webhooks(ctx context.Context, in struct{}, out *[]api.Webhook) error {
+	*out = []api.Webhook{
+		{
+			ID:       "1",
+			URL:      "http://localhost:9999/events",
+			Events:   []string{api.EventPinError},
+			Metadata: map[string]string{"tenant": "acme"},
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) WebhookAdd(ctx context.Context, in api.Webhook, out *api.Webhook) error {
+	if err := in.Validate(); err != nil {
+		return err
+	}
+	in.ID = "2"
+	*out = in
+	return nil
+}
+
+func (mock *MockService) WebhookRm(ctx context.Context, in string, out *struct{}) error {
+	if in == ErrorKey {
+		return errors.New("webhook does not exist")
+	}
+	return nil
+}
+
+func (mock *MockService) AnnotatePeer(ctx context.Context, in api.PeerAnnotation, out *struct{}) error {
+	if in.Peer == TestPeerID3.Pretty() {
+		return errors.New("annotation rejected")
+	}
+	return nil
+}
+
+func (mock *MockService) PushMetric(ctx context.Context, in api.MetricSerial, out *struct{}) error {
+	if in.Name == "ping" {
+		return errors.New("ping metrics are produced by the peer and cannot be pushed")
+	}
+	return nil
+}
+
+func (mock *MockService) FailPeer(ctx context.Context, in api.FailPeerRequest, out *struct{}) error {
+	if in.Peer == TestPeerID3 {
+		return errors.New("debug operations are disabled")
+	}
+	return nil
+}
+
+func (mock *MockService) ShutdownAll(ctx context.Context, in struct{}, out *struct{}) error {
+	return nil
+}
+
+func (mock *MockService) ShutdownLocal(ctx context.Context, in struct{}, out *struct{}) error {
+	return nil
+}
+
+func (mock *MockService) Unquarantine(ctx context.Context, in peer.ID, out *struct{}) error {
 	return nil
 }
 
-func (mock *mockService) ID(ctx context.Context, in struct{}, out *api.IDSerial) error {
+func (mock *MockService) StrayPins(ctx context.Context, in struct{}, out *[]api.StrayPin) error {
+	*out = []api.StrayPin{
+		{
+			Cid:  TestCid2,
+			Peer: TestPeerID1.Pretty(),
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) RemediateStrayPin(ctx context.Context, in api.StrayPinRemediation, out *struct{}) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	return nil
+}
+
+func (mock *MockService) ID(ctx context.Context, in struct{}, out *api.IDSerial) error {
 	//_, pubkey, _ := crypto.GenerateKeyPair(
 	//	DefaultConfigCrypto,
 	//	DefaultConfigKeyLength)
@@ -93,14 +333,152 @@ func (mock *mockService) ID(ctx context.Context, in struct{}, out *api.IDSerial)
 	return nil
 }
 
-func (mock *mockService) Version(ctx context.Context, in struct{}, out *api.Version) error {
+func (mock *MockService) Version(ctx context.Context, in struct{}, out *api.Version) error {
 	*out = api.Version{
 		Version: "0.0.mock",
 	}
 	return nil
 }
 
-func (mock *mockService) Peers(ctx context.Context, in struct{}, out *[]api.IDSerial) error {
+func (mock *MockService) Features(ctx context.Context, in struct{}, out *[]api.FeatureSupport) error {
+	*out = []api.FeatureSupport{
+		{
+			Feature: api.FeatureDrain,
+			Peers:   []string{TestPeerID1.Pretty(), TestPeerID2.Pretty()},
+			Total:   2,
+			All:     true,
+			Quorum:  true,
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) MetricsSince(ctx context.Context, in api.MetricsQuery, out *[]api.MetricSerial) error {
+	m := api.Metric{
+		Name:     in.Name,
+		Peer:     in.Peer,
+		Value:    "1",
+		Valid:    true,
+		Received: time.Now().UnixNano(),
+	}
+	m.SetTTL(10)
+	*out = []api.MetricSerial{m.ToSerial()}
+	return nil
+}
+
+func (mock *MockService) LastMetrics(ctx context.Context, in string, out *[]api.MetricSerial) error {
+	var metrics []api.MetricSerial
+	for _, p := range []peer.ID{TestPeerID1, TestPeerID2} {
+		m := api.Metric{
+			Name:     in,
+			Peer:     p,
+			Value:    "1",
+			Valid:    true,
+			Received: time.Now().UnixNano(),
+		}
+		m.SetTTL(10)
+		metrics = append(metrics, m.ToSerial())
+	}
+	*out = metrics
+	return nil
+}
+
+func (mock *MockService) PeerMetrics(ctx context.Context, in peer.ID, out *[]api.MetricSerial) error {
+	m := api.Metric{
+		Name:     "ping",
+		Peer:     in,
+		Value:    "1",
+		Valid:    true,
+		Received: time.Now().UnixNano(),
+	}
+	m.SetTTL(10)
+	*out = []api.MetricSerial{m.ToSerial()}
+	return nil
+}
+
+func (mock *MockService) Observations(ctx context.Context, in struct{}, out *[]api.Observation) error {
+	*out = []api.Observation{
+		{
+			Name:  "ipfscluster_peers",
+			Help:  "Number of peers in the cluster",
+			Value: 3,
+		},
+		{
+			Name:   "ipfscluster_tracker_items",
+			Help:   "Number of items tracked by this peer by status",
+			Labels: map[string]string{"status": "pinned"},
+			Value:  2,
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) Readiness(ctx context.Context, in struct{}, out *api.Readiness) error {
+	*out = api.Readiness{
+		Ready: true,
+		Components: map[string]bool{
+			"consensus": true,
+			"ipfs":      true,
+			"tracker":   true,
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) RaftHealth(ctx context.Context, in struct{}, out *api.RaftHealth) error {
+	*out = api.RaftHealth{
+		Peer:          TestPeerID1.Pretty(),
+		State:         "Leader",
+		Leader:        TestPeerID1.Pretty(),
+		Term:          2,
+		LastLogIndex:  10,
+		CommitIndex:   10,
+		AppliedIndex:  10,
+		LogEntries:    10,
+		LeaderChanges: 1,
+		CommitLatency: "5ms",
+	}
+	return nil
+}
+
+func (mock *MockService) PinQueue(ctx context.Context, in struct{}, out *api.PinQueue) error {
+	*out = api.PinQueue{
+		Peer:           TestPeerID1.Pretty(),
+		MaxQueueSize:   4096,
+		ConcurrentPins: 1,
+		PinQueued:      1,
+		InProgress:     1,
+		PinsDone:       10,
+		PinRate:        0.5,
+		PendingGC:      2,
+		Operations: []api.QueuedOperation{
+			{
+				Cid:    TestCid1,
+				Type:   "pin",
+				Status: api.TrackerStatusPinning.String(),
+			},
+			{
+				Cid:    TestCid2,
+				Type:   "pin",
+				Status: api.TrackerStatusPinQueued.String(),
+			},
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) Events(ctx context.Context, in time.Time, out *[]api.Event) error {
+	*out = []api.Event{
+		{
+			Type:      api.EventPin,
+			Timestamp: time.Now(),
+			Cid:       TestCid1,
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) Peers(ctx context.Context, in struct{}, out *[]api.IDSerial) error {
 	id := api.IDSerial{}
 	mock.ID(ctx, in, &id)
 
@@ -108,18 +486,22 @@ func (mock *mockService) Peers(ctx context.Context, in struct{}, out *[]api.IDSe
 	return nil
 }
 
-func (mock *mockService) PeerAdd(ctx context.Context, in api.MultiaddrSerial, out *api.IDSerial) error {
+func (mock *MockService) PeerAdd(ctx context.Context, in api.MultiaddrSerial, out *api.IDSerial) error {
 	id := api.IDSerial{}
 	mock.ID(ctx, struct{}{}, &id)
 	*out = id
 	return nil
 }
 
-func (mock *mockService) PeerRemove(ctx context.Context, in peer.ID, out *struct{}) error {
+func (mock *MockService) PeerRemove(ctx context.Context, in peer.ID, out *struct{}) error {
+	return nil
+}
+
+func (mock *MockService) PeerLeave(ctx context.Context, in api.PeerLeaveRequest, out *struct{}) error {
 	return nil
 }
 
-func (mock *mockService) ConnectGraph(ctx context.Context, in struct{}, out *api.ConnectGraphSerial) error {
+func (mock *MockService) ConnectGraph(ctx context.Context, in struct{}, out *api.ConnectGraphSerial) error {
 	*out = api.ConnectGraphSerial{
 		ClusterID: TestPeerID1.Pretty(),
 		IPFSLinks: map[string][]string{
@@ -141,7 +523,7 @@ func (mock *mockService) ConnectGraph(ctx context.Context, in struct{}, out *api
 	return nil
 }
 
-func (mock *mockService) StatusAll(ctx context.Context, in struct{}, out *[]api.GlobalPinInfoSerial) error {
+func (mock *MockService) StatusAll(ctx context.Context, in struct{}, out *[]api.GlobalPinInfoSerial) error {
 	c1, _ := cid.Decode(TestCid1)
 	c2, _ := cid.Decode(TestCid2)
 	c3, _ := cid.Decode(TestCid3)
@@ -177,17 +559,58 @@ func (mock *mockService) StatusAll(ctx context.Context, in struct{}, out *[]api.
 					Status: api.TrackerStatusPinError,
 					TS:     time.Now(),
 				},
+				TestPeerID2: {
+					Cid:         c3,
+					Peer:        TestPeerID2,
+					Status:      api.TrackerStatusRemote,
+					TS:          time.Now(),
+					Allocations: []peer.ID{TestPeerID1},
+				},
 			},
 		},
 	})
 	return nil
 }
 
-func (mock *mockService) StatusAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (mock *MockService) StatusAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	return mock.TrackerStatusAll(ctx, in, out)
 }
 
-func (mock *mockService) Status(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
+func (mock *MockService) PinHistory(ctx context.Context, in api.PinSerial, out *[]api.PinAttempt) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	*out = []api.PinAttempt{
+		{
+			Cid:       in.Cid,
+			Peer:      TestPeerID1.Pretty(),
+			Operation: "pin",
+			Timestamp: time.Now(),
+			Duration:  "1s",
+			Error:     "pinning operation is taking too long",
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) AllocationHistory(ctx context.Context, in api.PinSerial, out *[]api.AllocationChange) error {
+	if in.Cid == ErrorCid {
+		return ErrBadCid
+	}
+	*out = []api.AllocationChange{
+		{
+			Cid:       in.Cid,
+			Peer:      TestPeerID1.Pretty(),
+			Timestamp: time.Now(),
+			From:      []string{TestPeerID1.Pretty()},
+			To:        []string{TestPeerID2.Pretty()},
+			Reason:    api.AllocationFailure,
+		},
+	}
+	return nil
+}
+
+func (mock *MockService) Status(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
 	if in.Cid == ErrorCid {
 		return ErrBadCid
 	}
@@ -206,54 +629,77 @@ func (mock *mockService) Status(ctx context.Context, in api.PinSerial, out *api.
 	return nil
 }
 
-func (mock *mockService) StatusLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (mock *MockService) StatusCids(ctx context.Context, in []string, out *[]api.GlobalPinInfoSerial) error {
+	gpis := make([]api.GlobalPinInfoSerial, len(in), len(in))
+	for i, c := range in {
+		if c == ErrorCid {
+			return ErrBadCid
+		}
+		h, _ := cid.Decode(c)
+		gpis[i] = api.GlobalPinInfo{
+			Cid: h,
+			PeerMap: map[peer.ID]api.PinInfo{
+				TestPeerID1: {
+					Cid:    h,
+					Peer:   TestPeerID1,
+					Status: api.TrackerStatusPinned,
+					TS:     time.Now(),
+				},
+			},
+		}.ToSerial()
+	}
+	*out = gpis
+	return nil
+}
+
+func (mock *MockService) StatusLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
 	return mock.TrackerStatus(ctx, in, out)
 }
 
-func (mock *mockService) SyncAll(ctx context.Context, in struct{}, out *[]api.GlobalPinInfoSerial) error {
+func (mock *MockService) SyncAll(ctx context.Context, in struct{}, out *[]api.GlobalPinInfoSerial) error {
 	return mock.StatusAll(ctx, in, out)
 }
 
-func (mock *mockService) SyncAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (mock *MockService) SyncAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	return mock.StatusAllLocal(ctx, in, out)
 }
 
-func (mock *mockService) Sync(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
+func (mock *MockService) Sync(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
 	return mock.Status(ctx, in, out)
 }
 
-func (mock *mockService) SyncLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (mock *MockService) SyncLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
 	return mock.StatusLocal(ctx, in, out)
 }
 
-func (mock *mockService) StateSync(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (mock *MockService) StateSync(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	*out = make([]api.PinInfoSerial, 0, 0)
 	return nil
 }
 
-func (mock *mockService) RecoverAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (mock *MockService) RecoverAllLocal(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	return mock.TrackerRecoverAll(ctx, in, out)
 }
 
-func (mock *mockService) Recover(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
+func (mock *MockService) Recover(ctx context.Context, in api.PinSerial, out *api.GlobalPinInfoSerial) error {
 	return mock.Status(ctx, in, out)
 }
 
-func (mock *mockService) RecoverLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (mock *MockService) RecoverLocal(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
 	return mock.TrackerRecover(ctx, in, out)
 }
 
 /* Tracker methods */
 
-func (mock *mockService) Track(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (mock *MockService) Track(ctx context.Context, in api.PinSerial, out *struct{}) error {
 	return nil
 }
 
-func (mock *mockService) Untrack(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (mock *MockService) Untrack(ctx context.Context, in api.PinSerial, out *struct{}) error {
 	return nil
 }
 
-func (mock *mockService) TrackerStatusAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (mock *MockService) TrackerStatusAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	c1, _ := cid.Decode(TestCid1)
 	c3, _ := cid.Decode(TestCid3)
 
@@ -274,7 +720,7 @@ func (mock *mockService) TrackerStatusAll(ctx context.Context, in struct{}, out
 	return nil
 }
 
-func (mock *mockService) TrackerStatus(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (mock *MockService) TrackerStatus(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
 	if in.Cid == ErrorCid {
 		return ErrBadCid
 	}
@@ -289,12 +735,30 @@ func (mock *mockService) TrackerStatus(ctx context.Context, in api.PinSerial, ou
 	return nil
 }
 
-func (mock *mockService) TrackerRecoverAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
+func (mock *MockService) TrackerStatusCids(ctx context.Context, in []string, out *[]api.PinInfoSerial) error {
+	pis := make([]api.PinInfoSerial, len(in), len(in))
+	for i, c := range in {
+		if c == ErrorCid {
+			return ErrBadCid
+		}
+		h, _ := cid.Decode(c)
+		pis[i] = api.PinInfo{
+			Cid:    h,
+			Peer:   TestPeerID1,
+			Status: api.TrackerStatusPinned,
+			TS:     time.Now(),
+		}.ToSerial()
+	}
+	*out = pis
+	return nil
+}
+
+func (mock *MockService) TrackerRecoverAll(ctx context.Context, in struct{}, out *[]api.PinInfoSerial) error {
 	*out = make([]api.PinInfoSerial, 0, 0)
 	return nil
 }
 
-func (mock *mockService) TrackerRecover(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
+func (mock *MockService) TrackerRecover(ctx context.Context, in api.PinSerial, out *api.PinInfoSerial) error {
 	in2 := in.ToPin()
 	*out = api.PinInfo{
 		Cid:    in2.Cid,
@@ -307,21 +771,21 @@ func (mock *mockService) TrackerRecover(ctx context.Context, in api.PinSerial, o
 
 /* PeerManager methods */
 
-func (mock *mockService) PeerManagerAddPeer(ctx context.Context, in api.MultiaddrSerial, out *struct{}) error {
+func (mock *MockService) PeerManagerAddPeer(ctx context.Context, in api.MultiaddrSerial, out *struct{}) error {
 	return nil
 }
 
 /* IPFSConnector methods */
 
-func (mock *mockService) IPFSPin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (mock *MockService) IPFSPin(ctx context.Context, in api.PinSerial, out *struct{}) error {
 	return nil
 }
 
-func (mock *mockService) IPFSUnpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
+func (mock *MockService) IPFSUnpin(ctx context.Context, in api.PinSerial, out *struct{}) error {
 	return nil
 }
 
-func (mock *mockService) IPFSPinLsCid(ctx context.Context, in api.PinSerial, out *api.IPFSPinStatus) error {
+func (mock *MockService) IPFSPinLsCid(ctx context.Context, in api.PinSerial, out *api.IPFSPinStatus) error {
 	if in.Cid == TestCid1 || in.Cid == TestCid3 {
 		*out = api.IPFSPinStatusRecursive
 	} else {
@@ -330,7 +794,7 @@ func (mock *mockService) IPFSPinLsCid(ctx context.Context, in api.PinSerial, out
 	return nil
 }
 
-func (mock *mockService) IPFSPinLs(ctx context.Context, in string, out *map[string]api.IPFSPinStatus) error {
+func (mock *MockService) IPFSPinLs(ctx context.Context, in string, out *map[string]api.IPFSPinStatus) error {
 	m := map[string]api.IPFSPinStatus{
 		TestCid1: api.IPFSPinStatusRecursive,
 		TestCid3: api.IPFSPinStatusRecursive,
@@ -339,16 +803,16 @@ func (mock *mockService) IPFSPinLs(ctx context.Context, in string, out *map[stri
 	return nil
 }
 
-func (mock *mockService) IPFSConnectSwarms(ctx context.Context, in struct{}, out *struct{}) error {
+func (mock *MockService) IPFSConnectSwarms(ctx context.Context, in struct{}, out *struct{}) error {
 	return nil
 }
 
-func (mock *mockService) IPFSSwarmPeers(ctx context.Context, in struct{}, out *api.SwarmPeersSerial) error {
+func (mock *MockService) IPFSSwarmPeers(ctx context.Context, in struct{}, out *api.SwarmPeersSerial) error {
 	*out = []string{TestPeerID2.Pretty(), TestPeerID3.Pretty()}
 	return nil
 }
 
-func (mock *mockService) IPFSConfigKey(ctx context.Context, in string, out *interface{}) error {
+func (mock *MockService) IPFSConfigKey(ctx context.Context, in string, out *interface{}) error {
 	switch in {
 	case "Datastore/StorageMax":
 		*out = "100KB"
@@ -358,27 +822,50 @@ func (mock *mockService) IPFSConfigKey(ctx context.Context, in string, out *inte
 	return nil
 }
 
-func (mock *mockService) IPFSRepoSize(ctx context.Context, in struct{}, out *uint64) error {
+func (mock *MockService) IPFSRepoSize(ctx context.Context, in struct{}, out *uint64) error {
 	// since we have two pins. Assume each is 1KB.
 	*out = 2000
 	return nil
 }
 
-func (mock *mockService) IPFSFreeSpace(ctx context.Context, in struct{}, out *uint64) error {
+func (mock *MockService) IPFSRepoGC(ctx context.Context, in struct{}, out *struct{}) error {
+	return nil
+}
+
+func (mock *MockService) IPFSFreeSpace(ctx context.Context, in struct{}, out *uint64) error {
 	// RepoSize is 2KB, StorageMax is 100KB
 	*out = 98000
 	return nil
 }
 
-func (mock *mockService) ConsensusAddPeer(ctx context.Context, in peer.ID, out *struct{}) error {
+func (mock *MockService) IPFSRetrievals(ctx context.Context, in struct{}, out *map[string]uint64) error {
+	*out = map[string]uint64{
+		TestCid1: 10,
+		TestCid2: 5,
+		TestCid3: 1,
+	}
+	return nil
+}
+
+func (mock *MockService) IPFSBandwidthStats(ctx context.Context, in struct{}, out *api.IPFSBandwidth) error {
+	*out = api.IPFSBandwidth{
+		TotalIn:  1000000,
+		TotalOut: 500000,
+		RateIn:   2048.5,
+		RateOut:  1024,
+	}
+	return nil
+}
+
+func (mock *MockService) ConsensusAddPeer(ctx context.Context, in peer.ID, out *struct{}) error {
 	return errors.New("mock rpc cannot redirect")
 }
 
-func (mock *mockService) ConsensusRmPeer(ctx context.Context, in peer.ID, out *struct{}) error {
+func (mock *MockService) ConsensusRmPeer(ctx context.Context, in peer.ID, out *struct{}) error {
 	return errors.New("mock rpc cannot redirect")
 }
 
-func (mock *mockService) ConsensusPeers(ctx context.Context, in struct{}, out *[]peer.ID) error {
+func (mock *MockService) ConsensusPeers(ctx context.Context, in struct{}, out *[]peer.ID) error {
 	*out = []peer.ID{TestPeerID1, TestPeerID2, TestPeerID3}
 	return nil
 }
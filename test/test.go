@@ -1,3 +1,12 @@
 // Package test offers testing utilities to ipfs-cluster like
-// mocks
+// mocks.
+//
+// They are used by the ipfs-cluster tests and can be used to unit-test
+// third-party components (allocators, informers...) against the same
+// contracts:
+//
+//   - MockService (see NewMockRPCClient) mocks the cluster RPC API.
+//   - IpfsMock mocks the HTTP API of an IPFS daemon.
+//   - MockConnector mocks an IPFSConnector component.
+//   - MockInformer mocks an Informer component.
 package test
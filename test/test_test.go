@@ -7,6 +7,21 @@ import (
 	ipfscluster "github.com/ipfs/ipfs-cluster"
 )
 
+func TestComponentMocksValid(t *testing.T) {
+	var _ ipfscluster.IPFSConnector = &MockConnector{}
+	var _ ipfscluster.DAGSizer = &MockConnector{}
+	var _ ipfscluster.Informer = &MockInformer{}
+
+	inf := NewMockInformer("mock", "10")
+	if m := inf.GetMetric(); m.Name != "mock" || m.Value != "10" || m.Discard() {
+		t.Error("expected a valid metric")
+	}
+	inf.Shutdown()
+	if m := inf.GetMetric(); !m.Discard() {
+		t.Error("expected an invalid metric after shutdown")
+	}
+}
+
 func TestIpfsMock(t *testing.T) {
 	ipfsmock := NewIpfsMock()
 	defer ipfsmock.Close()
@@ -14,7 +29,7 @@ func TestIpfsMock(t *testing.T) {
 
 // Test that our RPC mock resembles the original
 func TestRPCMockValid(t *testing.T) {
-	mock := &mockService{}
+	mock := &MockService{}
 	real := &ipfscluster.RPCAPI{}
 	mockT := reflect.TypeOf(mock)
 	realT := reflect.TypeOf(real)
@@ -0,0 +1,75 @@
+package ipfscluster
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// trackedPinsMetricName is the name of the metric broadcasted by the
+// tracked pins informer (informer/tracked) with the number of items
+// pinned by a peer.
+const trackedPinsMetricName = "trackedpins"
+
+// trackedPinsAlertName is the metric name used in the alerts sent when
+// the number of pins tracked by a peer deviates from the expected one.
+// It differs from trackedPinsMetricName so that the monitor does not
+// clear these alerts whenever a new trackedpins metric arrives.
+const trackedPinsAlertName = "trackedpinsdeviation"
+
+// checkTrackedPins compares, in the leader, the trackedpins metric of
+// every peer with the number of pins allocated to it in the shared
+// state. This catches trackers which stopped processing their queue. It
+// raises an alert for every peer whose number of tracked pins deviates
+// from the expected one by more than TrackedPinsMaxDeviation, and a
+// recovery alert when it does not.
+func (c *Cluster) checkTrackedPins(snap *stateSnapshot) {
+	metrics := c.monitor.LastMetrics(trackedPinsMetricName)
+	if len(metrics) == 0 {
+		return
+	}
+
+	for _, m := range metrics {
+		if !m.Valid {
+			continue
+		}
+		tracked, err := strconv.Atoi(m.Value)
+		if err != nil {
+			continue
+		}
+		expected := len(snap.ListAllocatedTo(m.Peer))
+
+		alrt := api.Alert{
+			Peer:        m.Peer,
+			Peername:    m.Peername,
+			MetricName:  trackedPinsAlertName,
+			Severity:    api.AlertWarning,
+			TriggeredAt: time.Now(),
+			MetricTTL:   time.Duration(m.Expire - m.Received),
+			LastValue:   m.Value,
+		}
+
+		if pinCountDeviation(tracked, expected) > c.config.TrackedPinsMaxDeviation {
+			logger.Warningf("%s tracks %d pins but %d are allocated to it", m.Peer.Pretty(), tracked, expected)
+			c.monitor.RaiseAlert(alrt)
+			continue
+		}
+		alrt.Recovered = true
+		c.monitor.RaiseAlert(alrt)
+	}
+}
+
+// pinCountDeviation returns the difference between the tracked and
+// expected pin counts as a fraction of the expected one. When no pins
+// are expected, any tracked pin is a full deviation.
+func pinCountDeviation(tracked, expected int) float64 {
+	if expected == 0 {
+		if tracked == 0 {
+			return 0
+		}
+		return 1
+	}
+	return math.Abs(float64(tracked-expected)) / float64(expected)
+}
@@ -0,0 +1,20 @@
+package ipfscluster
+
+import (
+	"testing"
+)
+
+func TestPinCountDeviation(t *testing.T) {
+	if d := pinCountDeviation(0, 0); d != 0 {
+		t.Error("no pins should not deviate: ", d)
+	}
+	if d := pinCountDeviation(3, 0); d != 1 {
+		t.Error("tracking unexpected pins should be a full deviation: ", d)
+	}
+	if d := pinCountDeviation(5, 10); d != 0.5 {
+		t.Error("expected a 0.5 deviation: ", d)
+	}
+	if d := pinCountDeviation(15, 10); d != 0.5 {
+		t.Error("expected a 0.5 deviation: ", d)
+	}
+}
@@ -0,0 +1,105 @@
+package ipfscluster
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// With the "accept" UnderReplicationPolicy, pins are accepted during
+// partial outages even when there are fewer peers available than their
+// ReplicationFactorMin, as long as they can be allocated to one peer.
+// The leader then regularly tries to add allocations to these
+// under-replicated pins until they reach their ReplicationFactorMin.
+
+// topUpMaxBackoff is the longest time to wait between two attempts to
+// top up an under-replicated pin.
+var topUpMaxBackoff = 10 * time.Minute
+
+// topUpBackoff keeps the attempts to top up an under-replicated pin.
+type topUpBackoff struct {
+	attempts int
+	next     time.Time
+}
+
+// toppingUp returns true when the leader is already trying to top up the
+// given Cid.
+func (c *Cluster) toppingUp(h *cid.Cid) bool {
+	c.underReplicatedMux.Lock()
+	defer c.underReplicatedMux.Unlock()
+	_, ok := c.underReplicated[h.String()]
+	return ok
+}
+
+// topUpUnderReplicated re-allocates, in the leader, the under-replicated
+// pins and returns how many of them got new allocations. Pins which
+// cannot be topped up are retried with exponential backoff, starting at
+// MonitorPingInterval.
+func (c *Cluster) topUpUnderReplicated(snap *stateSnapshot) int {
+	now := time.Now()
+	seen := make(map[string]struct{})
+	toppedUp := 0
+	for _, pin := range snap.List() {
+		if c.ctx.Err() != nil {
+			break
+		}
+		if !pin.UnderReplicated() {
+			continue
+		}
+
+		key := pin.Cid.String()
+		seen[key] = struct{}{}
+		c.underReplicatedMux.Lock()
+		backoff, ok := c.underReplicated[key]
+		if !ok {
+			backoff = &topUpBackoff{}
+			c.underReplicated[key] = backoff
+		}
+		c.underReplicatedMux.Unlock()
+		if now.Before(backoff.next) {
+			continue
+		}
+
+		before := len(pin.Allocations)
+		newPin, ok, err := c.pin(pin, []peer.ID{}, pin.Allocations, api.AllocationTopUp)
+		if err == nil && ok {
+			toppedUp++
+			msg := fmt.Sprintf("allocations raised from %d to %d", before, len(newPin.Allocations))
+			logger.Infof("under-replicated pin %s: %s", pin.Cid, msg)
+			c.recordEvent(api.InternalOrigin("replication"), api.EventPin, pin.Cid, "", msg)
+			if !newPin.UnderReplicated() {
+				c.underReplicatedMux.Lock()
+				delete(c.underReplicated, key)
+				c.underReplicatedMux.Unlock()
+				continue
+			}
+		}
+
+		backoff.attempts++
+		delay := c.config.MonitorPingInterval
+		for i := 1; i < backoff.attempts && delay < topUpMaxBackoff; i++ {
+			delay *= 2
+		}
+		if delay > topUpMaxBackoff {
+			delay = topUpMaxBackoff
+		}
+		backoff.next = now.Add(delay)
+		if err != nil {
+			logger.Debugf("cannot top up %s yet, retrying in %s: %s", pin.Cid, delay, err)
+		}
+	}
+
+	// forget the pins which were unpinned or replicated otherwise
+	c.underReplicatedMux.Lock()
+	for key := range c.underReplicated {
+		if _, ok := seen[key]; !ok {
+			delete(c.underReplicated, key)
+		}
+	}
+	c.underReplicatedMux.Unlock()
+	return toppedUp
+}
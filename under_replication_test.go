@@ -0,0 +1,61 @@
+package ipfscluster
+
+import (
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestClusterPinUnderReplicated(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	c, _ := cid.Decode(test.TestCid1)
+	pin := api.Pin{
+		Cid:                  c,
+		ReplicationFactorMin: 2,
+		ReplicationFactorMax: 3,
+	}
+	if err := cl.Pin(pin); err == nil {
+		t.Fatal("expected an error with the reject policy")
+	}
+
+	cl.config.UnderReplicationPolicy = UnderReplicationAccept
+	if err := cl.Pin(pin); err != nil {
+		t.Fatal("pin should have been accepted:", err)
+	}
+
+	pinned, err := cl.PinGet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinned.Allocations) != 1 || pinned.Allocations[0] != cl.id {
+		t.Error("expected the pin to be allocated to the only peer:", pinned.Allocations)
+	}
+	if !pinned.UnderReplicated() {
+		t.Error("the pin should be under-replicated")
+	}
+
+	if n := cl.topUpUnderReplicated(testStateSnapshot(t, cl)); n != 0 {
+		t.Error("there are no more peers to top up the pin:", n)
+	}
+	backoff, ok := cl.underReplicated[c.String()]
+	if !ok || backoff.attempts != 1 || backoff.next.IsZero() {
+		t.Fatal("expected the top up to be retried later")
+	}
+
+	cl.topUpUnderReplicated(testStateSnapshot(t, cl))
+	if backoff.attempts != 1 {
+		t.Error("the top up should not be retried before the backoff expires")
+	}
+
+	cl.Unpin(c)
+	cl.topUpUnderReplicated(testStateSnapshot(t, cl))
+	if cl.toppingUp(c) {
+		t.Error("unpinned items should be forgotten")
+	}
+}
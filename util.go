@@ -6,6 +6,7 @@ import (
 
 	"github.com/ipfs/ipfs-cluster/api"
 
+	cid "github.com/ipfs/go-cid"
 	host "github.com/libp2p/go-libp2p-host"
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
@@ -126,6 +127,18 @@ func globalPinInfoSliceToSerial(gpi []api.GlobalPinInfo) []api.GlobalPinInfoSeri
 	return gpis
 }
 
+func decodeCids(in []string) ([]*cid.Cid, error) {
+	cids := make([]*cid.Cid, len(in), len(in))
+	for i, s := range in {
+		c, err := cid.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %s", s, err)
+		}
+		cids[i] = c
+	}
+	return cids, nil
+}
+
 func logError(fmtstr string, args ...interface{}) error {
 	msg := fmt.Sprintf(fmtstr, args...)
 	logger.Error(msg)
@@ -141,6 +154,15 @@ func containsPeer(list []peer.ID, peer peer.ID) bool {
 	return false
 }
 
+func containsCid(list []*cid.Cid, c *cid.Cid) bool {
+	for _, l := range list {
+		if l.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
+
 func minInt(x, y int) int {
 	if x < y {
 		return x
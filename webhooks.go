@@ -0,0 +1,256 @@
+package ipfscluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/monitor/basic"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// Webhooks let external systems follow the lifecycle of the pins: every
+// peer POSTs the events it produces to the webhooks whose filters they
+// match. Those are the pin, unpin and repin events recorded in its
+// events log and, when the PinTracker is a StatusNotifier, the changes
+// of the local status of the pins. Webhooks are stored as KV records in
+// the shared state, so that every peer knows about them, and cached for
+// webhooksRefreshInterval. Events are delivered in the background by
+// webhookWorkers workers, which retry failed deliveries.
+//
+// Status changes of items which are no longer in the shared state, like
+// unpinned ones, carry neither a name nor metadata, so they only match
+// webhooks which do not filter on them.
+
+// webhookPrefix is the prefix of the keys of the KV records which hold
+// the webhooks.
+const webhookPrefix = "webhook:"
+
+// WebhookTimeout specifies how long the delivery of an event to a
+// webhook may take before it is cancelled.
+var WebhookTimeout = 10 * time.Second
+
+// WebhookRetries is how many times the delivery of an event is retried
+// after failing. The first retry happens after WebhookRetryDelay, which
+// doubles on every attempt.
+var WebhookRetries = 3
+
+// WebhookRetryDelay is the delay before the first retry of a failed
+// delivery.
+var WebhookRetryDelay = time.Second
+
+// webhooksRefreshInterval is how long the registered webhooks are
+// cached before being read again from the shared state. The changes
+// made through this peer are seen immediately.
+var webhooksRefreshInterval = 10 * time.Second
+
+const (
+	// webhookWorkers is the number of concurrent deliveries.
+	webhookWorkers = 4
+	// webhookQueueSize is the number of events which can wait to be
+	// delivered. Events are dropped when the queue is full.
+	webhookQueueSize = 1024
+)
+
+// webhookCache holds the webhooks decoded from the shared state.
+type webhookCache struct {
+	mux      sync.Mutex
+	webhooks []api.Webhook
+	loaded   time.Time
+}
+
+// webhookDelivery is an event waiting to be delivered to a webhook.
+type webhookDelivery struct {
+	webhook api.Webhook
+	event   api.WebhookEvent
+}
+
+// Webhooks returns the webhooks registered in the cluster.
+func (c *Cluster) Webhooks() []api.Webhook {
+	c.webhooks.mux.Lock()
+	defer c.webhooks.mux.Unlock()
+	if time.Since(c.webhooks.loaded) < webhooksRefreshInterval {
+		return c.webhooks.webhooks
+	}
+
+	cState, err := c.consensus.State()
+	if err != nil {
+		logger.Error(err)
+		return []api.Webhook{}
+	}
+	webhooks := []api.Webhook{}
+	for _, kv := range cState.ListKV() {
+		if !strings.HasPrefix(kv.Key, webhookPrefix) {
+			continue
+		}
+		var wh api.Webhook
+		if err := json.Unmarshal([]byte(kv.Value), &wh); err != nil {
+			logger.Errorf("error decoding webhook %s: %s", kv.Key, err)
+			continue
+		}
+		webhooks = append(webhooks, wh)
+	}
+	c.webhooks.webhooks = webhooks
+	c.webhooks.loaded = time.Now()
+	return webhooks
+}
+
+// refreshWebhooks makes the next call to Webhooks read them from the
+// shared state.
+func (c *Cluster) refreshWebhooks() {
+	c.webhooks.mux.Lock()
+	c.webhooks.loaded = time.Time{}
+	c.webhooks.mux.Unlock()
+}
+
+// WebhookAdd registers a webhook in the cluster, with a new ID. It
+// returns the registered webhook.
+func (c *Cluster) WebhookAdd(wh api.Webhook) (api.Webhook, error) {
+	if err := wh.Validate(); err != nil {
+		return api.Webhook{}, err
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return api.Webhook{}, err
+	}
+	wh.ID = hex.EncodeToString(buf)
+
+	value, err := json.Marshal(wh)
+	if err != nil {
+		return api.Webhook{}, err
+	}
+	err = c.KVSet(api.KV{Key: webhookPrefix + wh.ID, Value: string(value)})
+	if err != nil {
+		return api.Webhook{}, err
+	}
+	c.refreshWebhooks()
+	return wh, nil
+}
+
+// WebhookRm removes a webhook from the cluster.
+func (c *Cluster) WebhookRm(id string) error {
+	if _, err := c.KVGet(webhookPrefix + id); err != nil {
+		return fmt.Errorf("webhook %s does not exist", id)
+	}
+	defer c.refreshWebhooks()
+	return c.KVRm(webhookPrefix + id)
+}
+
+// notifyWebhooks queues an event about the given pin for delivery to
+// the matching webhooks.
+func (c *Cluster) notifyWebhooks(ev api.Event, pin api.Pin) {
+	if ev.Cid == "" {
+		return
+	}
+	for _, wh := range c.Webhooks() {
+		if !wh.Matches(ev, pin, c.config.Namespace) {
+			continue
+		}
+		delivery := webhookDelivery{
+			webhook: wh,
+			event: api.WebhookEvent{
+				Event:     ev,
+				Webhook:   wh.ID,
+				Namespace: c.config.Namespace,
+				Name:      pin.Name,
+				Metadata:  pin.Metadata,
+			},
+		}
+		select {
+		case c.webhookQueue <- delivery:
+		default:
+			logger.Errorf("webhook queue is full: dropping %s event for webhook %s", ev.Type, wh.ID)
+		}
+	}
+}
+
+// deliverWebhooks delivers the queued events until shutdown.
+func (c *Cluster) deliverWebhooks() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case delivery := <-c.webhookQueue:
+			c.deliverWebhook(delivery)
+		}
+	}
+}
+
+// deliverWebhook POSTs an event to the URL of a webhook, retrying
+// WebhookRetries times when it fails.
+func (c *Cluster) deliverWebhook(delivery webhookDelivery) {
+	notifier := basic.NewWebhookNotifier(delivery.webhook.URL)
+	delay := WebhookRetryDelay
+	for retries := 0; ; retries++ {
+		ctx, cancel := context.WithTimeout(c.ctx, WebhookTimeout)
+		err := notifier.Post(ctx, delivery.event)
+		cancel()
+		if err == nil {
+			return
+		}
+		if retries == WebhookRetries {
+			logger.Errorf("error delivering %s event to webhook %s: %s",
+				delivery.event.Type, delivery.webhook.ID, err)
+			return
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// statusEventTypes are the event types of the changes of the local
+// status of the pins.
+var statusEventTypes = map[api.TrackerStatus]string{
+	api.TrackerStatusPinned:     api.EventPinned,
+	api.TrackerStatusPinError:   api.EventPinError,
+	api.TrackerStatusUnpinned:   api.EventUnpinned,
+	api.TrackerStatusUnpinError: api.EventUnpinError,
+}
+
+// watchStatusChanges records the changes of the local status of the
+// pins in the events log and delivers them to the webhooks, when the
+// PinTracker reports them.
+func (c *Cluster) watchStatusChanges() {
+	notifier, ok := c.tracker.(StatusNotifier)
+	if !ok {
+		return
+	}
+
+	changes := notifier.StatusChanges()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case pInfo := <-changes:
+			evType, ok := statusEventTypes[pInfo.Status]
+			if !ok {
+				continue
+			}
+			pin, exists := c.getCurrentPin(pInfo.Cid)
+			if !exists {
+				pin = api.PinCid(pInfo.Cid)
+			}
+			ev := api.Event{
+				Type:      evType,
+				Timestamp: pInfo.TS,
+				Peer:      peer.IDB58Encode(c.id),
+				Cid:       pInfo.Cid.String(),
+				Message:   pInfo.Error,
+			}
+			c.events.Append(ev)
+			c.notifyWebhooks(ev, pin)
+		}
+	}
+}
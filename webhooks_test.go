@@ -0,0 +1,127 @@
+package ipfscluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestClusterWebhooks(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+
+	var mux sync.Mutex
+	var received []api.WebhookEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev api.WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		mux.Lock()
+		received = append(received, ev)
+		mux.Unlock()
+	}))
+	defer srv.Close()
+
+	wh, err := cl.WebhookAdd(api.Webhook{
+		URL:      srv.URL,
+		Events:   []string{api.EventPin, api.EventUnpin},
+		Metadata: map[string]string{"tenant": "acme"},
+	})
+	if err != nil {
+		t.Fatal("adding the webhook should have worked:", err)
+	}
+	if wh.ID == "" {
+		t.Fatal("the webhook should have an ID")
+	}
+	if _, err := cl.WebhookAdd(api.Webhook{URL: "not an url"}); err == nil {
+		t.Error("expected an error adding an invalid webhook")
+	}
+	if webhooks := cl.Webhooks(); len(webhooks) != 1 || webhooks[0].ID != wh.ID {
+		t.Fatal("unexpected webhooks:", webhooks)
+	}
+
+	c1, _ := cid.Decode(test.TestCid1)
+	c2, _ := cid.Decode(test.TestCid2)
+	pin := api.PinCid(c1)
+	pin.Metadata = map[string]string{"tenant": "acme"}
+	if err := cl.Pin(pin); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Pin(api.PinCid(c2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Unpin(c1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	// deliveries are concurrent
+	mux.Lock()
+	types := make(map[string]bool)
+	for _, ev := range received {
+		if ev.Cid != test.TestCid1 || ev.Metadata["tenant"] != "acme" || ev.Webhook != wh.ID {
+			t.Error("unexpected delivery:", ev)
+		}
+		types[ev.Type] = true
+	}
+	if len(received) != 2 || !types[api.EventPin] || !types[api.EventUnpin] {
+		t.Error("expected the pin and the unpin of the matching pin:", received)
+	}
+	mux.Unlock()
+
+	if err := cl.WebhookRm(wh.ID); err != nil {
+		t.Fatal("removing the webhook should have worked:", err)
+	}
+	if err := cl.WebhookRm(wh.ID); err == nil {
+		t.Error("expected an error removing a missing webhook")
+	}
+	if webhooks := cl.Webhooks(); len(webhooks) != 0 {
+		t.Error("the webhook should be gone:", webhooks)
+	}
+}
+
+func TestClusterWebhookRetries(t *testing.T) {
+	cl, _, _, _, _ := testingCluster(t)
+	defer cleanRaft()
+	defer cl.Shutdown()
+	defer func(d time.Duration) { WebhookRetryDelay = d }(WebhookRetryDelay)
+	WebhookRetryDelay = 50 * time.Millisecond
+
+	var mux sync.Mutex
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	_, err := cl.WebhookAdd(api.Webhook{URL: srv.URL, Events: []string{api.EventPin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := cid.Decode(test.TestCid1)
+	if err := cl.Pin(api.PinCid(c)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	mux.Lock()
+	defer mux.Unlock()
+	if attempts != 3 {
+		t.Error("the delivery should be retried until it works, got attempts:", attempts)
+	}
+}